@@ -0,0 +1,161 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+// With abandon_after, an endpoint that stayed DOWN for that long, such as a decommissioned service
+// nobody removed from the configuration, is abandoned: its checks are paused, so reports stay
+// focused on live services. The pause is recorded with an endpoint_abandoned event, the notifiers
+// comment on the open issue of the endpoint, and the skipped checks are recorded as unknown, which
+// excludes them from availability. Reloading the configuration or restarting the program resumes
+// the checks, and the endpoint is abandoned again if it stays DOWN for abandon_after from then on.
+
+// ErrorKindAbandoned classifies the checks skipped because the endpoint was abandoned.
+const ErrorKindAbandoned string = "abandoned"
+
+// EventEndpointAbandoned is the event type reporting that the checks of an endpoint were paused
+// after it stayed DOWN for its abandon_after. It is emitted at the end of the cycle in which the
+// endpoint was abandoned.
+const EventEndpointAbandoned string = "endpoint_abandoned"
+
+// AbandonedEvent is the payload of an EventEndpointAbandoned event.
+type AbandonedEvent struct {
+	Endpoint    string    `json:"endpoint"`
+	Url         string    `json:"url"`
+	Domain      string    `json:"domain,omitempty"`
+	DownSince   time.Time `json:"down_since"`
+	AbandonedAt time.Time `json:"abandoned_at"`
+
+	// DownDurationMs is how long the endpoint had been DOWN when it was abandoned.
+	DownDurationMs int64 `json:"down_duration_ms"`
+}
+
+// Abandonment is an endpoint abandoned at At, after being DOWN since DownSince.
+type Abandonment struct {
+	Endpoint  string
+	Url       string
+	Domain    string
+	DownSince time.Time
+	At        time.Time
+}
+
+// Abandon abandons the endpoint at the provided time when it has been DOWN for after or longer,
+// counting from its last resumption, see Resume. It returns when the endpoint went DOWN and whether
+// it was abandoned. A zero after never abandons the endpoint.
+func (state *EndpointState) Abandon(after time.Duration, at time.Time) (time.Time, bool) {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	if after <= 0 || state.state != StateDown || !state.abandoned_at.IsZero() {
+		return time.Time{}, false
+	}
+	since := state.since
+	if state.resumed_at.After(since) {
+		since = state.resumed_at
+	}
+	if at.Sub(since) < after {
+		return time.Time{}, false
+	}
+	state.abandoned_at = at
+	return state.since, true
+}
+
+// Resume resumes the checks of an abandoned endpoint at the provided time. It returns whether the
+// endpoint was abandoned.
+func (state *EndpointState) Resume(at time.Time) bool {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	if state.abandoned_at.IsZero() {
+		return false
+	}
+	state.abandoned_at = time.Time{}
+	state.resumed_at = at
+	return true
+}
+
+// AbandonedAt returns when the endpoint was abandoned, zero when its checks aren't paused.
+func (state *EndpointState) AbandonedAt() time.Time {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	return state.abandoned_at
+}
+
+// abandonedAt returns when the endpoint was abandoned, zero when it isn't or wasn't checked yet.
+func (endpoint *Endpoint) abandonedAt() time.Time {
+	if endpoint.State == nil {
+		return time.Time{}
+	}
+	return endpoint.State.AbandonedAt()
+}
+
+// AbandonEndpoints is a method for HealthCheckTargets that abandons the endpoints DOWN for their
+// abandon_after at the provided time, and returns them in the order of the configuration.
+func (target *HealthCheckTargets) AbandonEndpoints(at time.Time) []Abandonment {
+	var abandonments []Abandonment
+	for i := range *target.Endpoints {
+		endpoint := &(*target.Endpoints)[i]
+		if endpoint.State == nil {
+			continue
+		}
+		since, ok := endpoint.State.Abandon(endpoint.AbandonAfter, at)
+		if !ok {
+			continue
+		}
+
+		abandonment := Abandonment{Endpoint: endpoint.Name, Url: endpoint.Url, DownSince: since, At: at}
+		if endpoint.Domain != nil {
+			abandonment.Domain = endpoint.Domain.Name
+		}
+		abandonments = append(abandonments, abandonment)
+	}
+	return abandonments
+}
+
+// AbandonEvents is a method for HealthCheckTargets that returns an EventEndpointAbandoned event for
+// each abandonment, signed when a signer is configured.
+func (target *HealthCheckTargets) AbandonEvents(abandonments []Abandonment) []Event {
+	var events []Event
+	for _, abandonment := range abandonments {
+		event := NewEvent(EventEndpointAbandoned, abandonment.At)
+		event.Abandoned = &AbandonedEvent{
+			Endpoint:       abandonment.Endpoint,
+			Url:            abandonment.Url,
+			Domain:         abandonment.Domain,
+			DownSince:      abandonment.DownSince.UTC(),
+			AbandonedAt:    abandonment.At.UTC(),
+			DownDurationMs: abandonment.At.Sub(abandonment.DownSince).Milliseconds(),
+		}
+		events = append(events, event)
+	}
+
+	if err := target.Signer.Sign(events); err != nil {
+		log.Printf("Failed to sign events: %v", err)
+	}
+	return events
+}
+
+// LogAbandonments is a method for HealthCheckTargets that prints each abandonment to the console in
+// the configured output format.
+func (target *HealthCheckTargets) LogAbandonments(abandonments []Abandonment) {
+	if target.Settings.Output == OutputJSON {
+		if err := WriteEvents(os.Stdout, target.AbandonEvents(abandonments)); err != nil {
+			log.Printf("Failed to write JSON output: %v", err)
+		}
+		return
+	}
+
+	for _, abandonment := range abandonments {
+		fmt.Println(abandonment.String())
+	}
+}
+
+// String describes the abandonment for the text output.
+func (abandonment Abandonment) String() string {
+	return fmt.Sprintf("%s is abandoned, DOWN for %v, its checks are paused", abandonment.Endpoint, abandonment.At.Sub(abandonment.DownSince).Round(time.Second))
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/go-playground/assert/v2"
+)
+
+func TestAbandonEndpoints(t *testing.T) {
+	endpoints := Endpoints{
+		{Name: "legacy", Url: "http://127.0.0.1:1/legacy", DownAfter: 1, AbandonAfter: time.Hour},
+		{Name: "index", Url: "http://127.0.0.1:1/", DownAfter: 1},
+	}
+	targets, err := endpoints.CreateNewTargets()
+	assert.Equal(t, err, nil)
+	targets.Settings = Settings{Output: OutputText, Interval: 15 * time.Second}
+
+	down_since := time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+	targets.RecordResults([]CheckResult{
+		{Endpoint: "legacy", Url: "http://127.0.0.1:1/legacy", Status: StatusDown, FinishedAt: down_since},
+		{Endpoint: "index", Url: "http://127.0.0.1:1/", Status: StatusDown, FinishedAt: down_since},
+	})
+
+	// not down for long enough, and endpoints without abandon_after are never abandoned
+	assert.Equal(t, len(targets.AbandonEndpoints(down_since.Add(59*time.Minute))), 0)
+
+	abandoned_at := down_since.Add(time.Hour)
+	abandonments := targets.AbandonEndpoints(abandoned_at)
+	assert.Equal(t, abandonments, []Abandonment{{Endpoint: "legacy", Url: "http://127.0.0.1:1/legacy", Domain: "127.0.0.1", DownSince: down_since, At: abandoned_at}})
+	assert.Equal(t, abandonments[0].String(), "legacy is abandoned, DOWN for 1h0m0s, its checks are paused")
+	assert.Equal(t, len(targets.AbandonEndpoints(abandoned_at.Add(time.Hour))), 0)
+
+	var output bytes.Buffer
+	assert.Equal(t, WriteEvents(&output, targets.AbandonEvents(abandonments)), nil)
+	assert.Equal(t, output.String(), `{"schema_version":"1.18","type":"endpoint_abandoned","timestamp":"2023-06-01T13:00:00Z",`+
+		`"abandoned":{"endpoint":"legacy","url":"http://127.0.0.1:1/legacy","domain":"127.0.0.1","down_since":"2023-06-01T12:00:00Z",`+
+		`"abandoned_at":"2023-06-01T13:00:00Z","down_duration_ms":3600000}}`+"\n")
+
+	states := targets.EndpointStates()
+	assert.Equal(t, *states[0].AbandonedAt, abandoned_at)
+	assert.Equal(t, states[1].AbandonedAt, (*time.Time)(nil))
+
+	// the checks of the abandoned endpoint are skipped and recorded as unknown
+	result := (*targets.Endpoints)[0].GetEndpointHealth(time.Second)
+	assert.Equal(t, result.Status, StatusUnknown)
+	assert.Equal(t, result.ErrorKind, ErrorKindAbandoned)
+	assert.Equal(t, result.skipped, true)
+
+	// resuming restarts the abandon_after of the endpoint still DOWN
+	resumed_at := abandoned_at.Add(24 * time.Hour)
+	assert.Equal(t, (*targets.Endpoints)[0].State.Resume(resumed_at), true)
+	assert.Equal(t, (*targets.Endpoints)[0].State.Resume(resumed_at), false)
+	assert.Equal(t, len(targets.AbandonEndpoints(resumed_at.Add(time.Minute))), 0)
+	abandonments = targets.AbandonEndpoints(resumed_at.Add(time.Hour))
+	assert.Equal(t, len(abandonments), 1)
+	assert.Equal(t, abandonments[0].DownSince, down_since)
+}
+
+func TestReloadResumesAbandonedEndpoints(t *testing.T) {
+	endpoints := Endpoints{{Name: "legacy", Url: "https://fetch.com/legacy", DownAfter: 1, AbandonAfter: time.Hour}}
+	targets, err := endpoints.CreateNewTargets()
+	assert.Equal(t, err, nil)
+	targets.Settings = Settings{Output: OutputText, Interval: 15 * time.Second}
+
+	down_since := time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+	targets.RecordResults([]CheckResult{{Endpoint: "legacy", Url: "https://fetch.com/legacy", Status: StatusDown, FinishedAt: down_since}})
+	assert.Equal(t, len(targets.AbandonEndpoints(down_since.Add(time.Hour))), 1)
+
+	_, _, err = targets.Reload(Config{
+		Settings:  Settings{Output: OutputText, Interval: 15 * time.Second},
+		Endpoints: Endpoints{{Name: "legacy", Url: "https://fetch.com/legacy", DownAfter: 1, AbandonAfter: time.Hour}},
+	})
+	assert.Equal(t, err, nil)
+	assert.Equal(t, (*targets.Endpoints)[0].abandonedAt().IsZero(), true)
+	assert.Equal(t, targets.EndpointStates()[0].State, StateDown)
+}
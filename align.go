@@ -0,0 +1,78 @@
+package main
+
+import (
+	"time"
+)
+
+// NextAlignedCycle returns the first wall-clock boundary strictly after now that is a multiple of
+// interval since the Unix epoch, e.g. :00, :15, :30 and :45 seconds for a 15 second interval.
+// Checker instances aligning their cycles to these boundaries run their checks at the same moments,
+// so their results are comparable when aggregated.
+func NextAlignedCycle(now time.Time, interval time.Duration) time.Time {
+	if interval <= 0 {
+		return now
+	}
+	return now.Truncate(interval).Add(interval)
+}
+
+// cycleTimer waits between check cycles on a Clock, either a fixed interval after the previous
+// cycle started or until the next wall-clock boundary when aligned.
+type cycleTimer struct {
+	clock    Clock
+	interval time.Duration
+	align    bool
+	ticker   Ticker
+}
+
+// newCycleTimer creates a cycleTimer for the interval on clock, aligning cycles to wall-clock
+// boundaries when align is true.
+func newCycleTimer(clock Clock, interval time.Duration, align bool) *cycleTimer {
+	timer := &cycleTimer{clock: clock, interval: interval, align: align}
+	if !align {
+		timer.ticker = clock.NewTicker(interval)
+	}
+	return timer
+}
+
+// Start blocks until the first cycle should start, which is immediately unless aligned, and
+// returns the time the cycle was due. False is returned if done is closed first.
+func (timer *cycleTimer) Start(done <-chan struct{}) (time.Time, bool) {
+	if !timer.align {
+		return timer.clock.Now(), true
+	}
+	deadline := NextAlignedCycle(timer.clock.Now(), timer.interval)
+	return deadline, timer.waitUntil(deadline, done)
+}
+
+// Wait blocks until the next cycle should start and returns the time it was due, which is earlier
+// than now when the previous cycle overran its interval. Cycles that were missed entirely are
+// skipped. False is returned if done is closed first.
+func (timer *cycleTimer) Wait(done <-chan struct{}) (time.Time, bool) {
+	if !timer.align {
+		select {
+		case scheduled := <-timer.ticker.C():
+			return scheduled, true
+		case <-done:
+			return time.Time{}, false
+		}
+	}
+	deadline := NextAlignedCycle(timer.clock.Now(), timer.interval)
+	return deadline, timer.waitUntil(deadline, done)
+}
+
+// Stop releases the ticker of the timer.
+func (timer *cycleTimer) Stop() {
+	if timer.ticker != nil {
+		timer.ticker.Stop()
+	}
+}
+
+// waitUntil waits until deadline, returning false if done is closed first.
+func (timer *cycleTimer) waitUntil(deadline time.Time, done <-chan struct{}) bool {
+	select {
+	case <-timer.clock.After(deadline.Sub(timer.clock.Now())):
+		return true
+	case <-done:
+		return false
+	}
+}
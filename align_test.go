@@ -0,0 +1,88 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-playground/assert/v2"
+)
+
+func TestNextAlignedCycle(t *testing.T) {
+	base := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		name     string
+		now      time.Time
+		interval time.Duration
+		expected time.Time
+	}{
+		{
+			name:     "Within Quarter Minute",
+			now:      base.Add(7 * time.Second),
+			interval: 15 * time.Second,
+			expected: base.Add(15 * time.Second),
+		},
+		{
+			name:     "On Boundary Moves To Next",
+			now:      base.Add(30 * time.Second),
+			interval: 15 * time.Second,
+			expected: base.Add(45 * time.Second),
+		},
+		{
+			name:     "Next Minute",
+			now:      base.Add(59*time.Second + 999*time.Millisecond),
+			interval: 15 * time.Second,
+			expected: base.Add(time.Minute),
+		},
+		{
+			name:     "Quarter Hour",
+			now:      base.Add(20 * time.Minute),
+			interval: 15 * time.Minute,
+			expected: base.Add(30 * time.Minute),
+		},
+		{
+			name:     "Zero Interval",
+			now:      base,
+			interval: 0,
+			expected: base,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, NextAlignedCycle(tc.now, tc.interval), tc.expected)
+		})
+	}
+}
+
+func TestCycleTimerAligned(t *testing.T) {
+	interval := 15 * time.Second
+	clock := newFakeClock(time.Date(2021, 6, 1, 12, 0, 7, 0, time.UTC))
+	timer := newCycleTimer(clock, interval, true)
+
+	// the first cycle waits for the next boundary
+	started := make(chan time.Time)
+	go func() {
+		scheduled, _ := timer.Start(nil)
+		started <- scheduled
+	}()
+	clock.AwaitWaiters(1)
+	clock.Advance(8 * time.Second)
+	assert.Equal(t, <-started, time.Date(2021, 6, 1, 12, 0, 15, 0, time.UTC))
+
+	// a cycle overrunning its interval skips the boundaries it missed
+	clock.Advance(20 * time.Second)
+	go func() {
+		scheduled, _ := timer.Wait(nil)
+		started <- scheduled
+	}()
+	clock.AwaitWaiters(1)
+	clock.Advance(10 * time.Second)
+	assert.Equal(t, <-started, time.Date(2021, 6, 1, 12, 0, 45, 0, time.UTC))
+
+	// waiting stops when done is closed
+	done := make(chan struct{})
+	close(done)
+	_, ok := timer.Wait(done)
+	assert.Equal(t, ok, false)
+}
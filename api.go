@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// APIPrefix is the path the read-only REST API is served under by the metrics server, see
+// APIHandler.
+const APIPrefix string = "/api/v1/"
+
+// EndpointHistory is the history of an endpoint, as served on /api/v1/endpoints/{name}/history.
+type EndpointHistory struct {
+	Endpoint string        `json:"endpoint"`
+	Url      string        `json:"url"`
+	History  []CheckRecord `json:"history"`
+}
+
+// apiError is the body of the responses of the REST API to invalid requests.
+type apiError struct {
+	Error string `json:"error"`
+}
+
+// DomainStatuses is a method for HealthCheckTargets that returns the availability of every domain
+// at now, in the order of the configuration, reported like in domain_availability events.
+func (target *HealthCheckTargets) DomainStatuses(now time.Time) []*DomainEvent {
+	// copy the domains, which are replaced when the configuration is reloaded and updated while
+	// checks are recorded
+	var domains []Domain
+	domain_stats.Lock()
+	for domain := target.Domains; domain != nil; domain = domain.Next {
+		if domain.Name != "" {
+			domains = append(domains, *domain)
+		}
+	}
+	domain_stats.Unlock()
+
+	statuses := []*DomainEvent{}
+	location := target.Settings.AvailabilityLocation()
+	for i := range domains {
+		statuses = append(statuses, target.domainEvent(&domains[i], now, location))
+	}
+	return statuses
+}
+
+// EndpointHistory is a method for HealthCheckTargets that returns the history of the endpoint
+// named name. False is returned if there is no such endpoint.
+func (target *HealthCheckTargets) EndpointHistory(name string) (EndpointHistory, bool) {
+	// the endpoints are replaced when the configuration is reloaded
+	domain_stats.Lock()
+	endpoints := target.Endpoints
+	domain_stats.Unlock()
+	if endpoints == nil {
+		return EndpointHistory{}, false
+	}
+
+	for i := range *endpoints {
+		endpoint := &(*endpoints)[i]
+		if endpoint.Name != name {
+			continue
+		}
+
+		history := EndpointHistory{Endpoint: endpoint.Name, Url: endpoint.Url, History: []CheckRecord{}}
+		if endpoint.State != nil {
+			history.History = endpoint.State.History()
+		}
+		return history, true
+	}
+	return EndpointHistory{}, false
+}
+
+// APIHandler is a method for HealthCheckTargets that returns an http.Handler serving the read-only
+// REST API under APIPrefix:
+//
+//	GET /api/v1/domains                  the availability of every domain, see DomainStatuses
+//	GET /api/v1/endpoints[?label=k=v]    the state of every endpoint, or of those with the labels
+//	GET /api/v1/endpoints/{name}/history the last checks of an endpoint, see EndpointHistory
+//	GET /api/v1/heatmap[?format=csv]     the latency heatmap of the endpoints, see LatencyHeatmap
+//	GET /api/v1/canaries                 the canary comparisons, see CanaryComparisons
+//	GET /api/v1/integrations             the circuit breakers of the sinks and notifiers
+//
+// Endpoint names are path escaped, e.g. "fetch%20index%20page", and label selectors are repeated
+// to select the endpoints having all of them, e.g. "?label=team=payments&label=env=prod". Errors
+// are reported as a JSON object with an error message.
+func (target *HealthCheckTargets) APIHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			writeAPI(w, http.StatusMethodNotAllowed, apiError{Error: fmt.Sprintf("method %s not allowed", r.Method)})
+			return
+		}
+
+		path := strings.TrimPrefix(r.URL.EscapedPath(), strings.TrimSuffix(APIPrefix, "/"))
+		switch {
+		case path == "/domains":
+			writeAPI(w, http.StatusOK, target.DomainStatuses(time.Now()))
+		case path == "/endpoints":
+			selector, err := parseLabelSelector(r.URL.Query()["label"])
+			if err != nil {
+				writeAPI(w, http.StatusBadRequest, apiError{Error: err.Error()})
+				return
+			}
+			statuses := []EndpointStatus{}
+			for _, status := range target.EndpointStates() {
+				if matchLabels(status.Labels, selector) {
+					statuses = append(statuses, status)
+				}
+			}
+			writeAPI(w, http.StatusOK, statuses)
+		case strings.HasPrefix(path, "/endpoints/") && strings.HasSuffix(path, "/history"):
+			name, err := url.PathUnescape(strings.TrimSuffix(strings.TrimPrefix(path, "/endpoints/"), "/history"))
+			if err != nil || name == "" {
+				writeAPI(w, http.StatusBadRequest, apiError{Error: "invalid endpoint name"})
+				return
+			}
+			history, ok := target.EndpointHistory(name)
+			if !ok {
+				writeAPI(w, http.StatusNotFound, apiError{Error: fmt.Sprintf("unknown endpoint %q", name)})
+				return
+			}
+			writeAPI(w, http.StatusOK, history)
+		case path == "/heatmap":
+			switch format := r.URL.Query().Get("format"); format {
+			case "", "json":
+				writeAPI(w, http.StatusOK, target.Heatmap.Heatmap())
+			case "csv":
+				w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+				w.Header().Set("Cache-Control", "no-store")
+				if err := WriteHeatmapCSV(w, target.Heatmap.Heatmap()); err != nil {
+					log.Printf("Failed to write API response: %v", err)
+				}
+			default:
+				writeAPI(w, http.StatusBadRequest, apiError{Error: fmt.Sprintf("unsupported format %q, expected \"json\" or \"csv\"", format)})
+			}
+		case path == "/canaries":
+			writeAPI(w, http.StatusOK, target.CanaryStatuses())
+		case path == "/integrations":
+			writeAPI(w, http.StatusOK, target.IntegrationHealth())
+		default:
+			writeAPI(w, http.StatusNotFound, apiError{Error: fmt.Sprintf("unknown path %s", r.URL.Path)})
+		}
+	})
+}
+
+// writeAPI writes value as the indented JSON response of the REST API with the status code.
+func writeAPI(w http.ResponseWriter, code int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(value); err != nil {
+		log.Printf("Failed to write API response: %v", err)
+	}
+}
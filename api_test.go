@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-playground/assert/v2"
+)
+
+func TestAPIHandler(t *testing.T) {
+	endpoints := Endpoints{
+		{Name: "example index", Url: "https://example.com/"},
+		{Name: "careers", Url: "https://example.com/careers"},
+	}
+	targets, err := endpoints.CreateNewTargets()
+	assert.Equal(t, err, nil)
+
+	at := time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+	targets.RecordResults([]CheckResult{
+		{Endpoint: "example index", Url: "https://example.com/", Status: StatusUp, Latency: 120 * time.Millisecond, FinishedAt: at},
+		{Endpoint: "careers", Url: "https://example.com/careers", Status: StatusDown, StatusCode: 503, ErrorKind: ErrorKindStatus, Error: "unexpected status code 503", FinishedAt: at},
+	})
+	targets.RecordResults([]CheckResult{
+		{Endpoint: "example index", Url: "https://example.com/", Status: StatusUnknown, FinishedAt: at.Add(15 * time.Second)},
+		{Endpoint: "careers", Url: "https://example.com/careers", Status: StatusUp, Latency: 80 * time.Millisecond, FinishedAt: at.Add(15 * time.Second)},
+	})
+
+	cases := []struct {
+		name   string
+		method string
+		path   string
+		code   int
+	}{
+		{name: "Domains", path: "/api/v1/domains", code: http.StatusOK},
+		{name: "Endpoints", path: "/api/v1/endpoints", code: http.StatusOK},
+		{name: "History", path: "/api/v1/endpoints/careers/history", code: http.StatusOK},
+		{name: "Escaped Name", path: "/api/v1/endpoints/example%20index/history", code: http.StatusOK},
+		{name: "Unknown Endpoint", path: "/api/v1/endpoints/unknown/history", code: http.StatusNotFound},
+		{name: "Heatmap", path: "/api/v1/heatmap", code: http.StatusOK},
+		{name: "Unsupported Heatmap Format", path: "/api/v1/heatmap?format=xml", code: http.StatusBadRequest},
+		{name: "Unknown Path", path: "/api/v1/unknown", code: http.StatusNotFound},
+		{name: "Read Only", method: http.MethodPost, path: "/api/v1/endpoints", code: http.StatusMethodNotAllowed},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			method := tc.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			recorder := httptest.NewRecorder()
+			targets.APIHandler().ServeHTTP(recorder, httptest.NewRequest(method, tc.path, nil))
+			assert.Equal(t, recorder.Code, tc.code)
+			assert.Equal(t, recorder.Header().Get("Content-Type"), "application/json")
+			if tc.code != http.StatusOK {
+				var body apiError
+				assert.Equal(t, json.Unmarshal(recorder.Body.Bytes(), &body), nil)
+				assert.NotEqual(t, body.Error, "")
+			}
+		})
+	}
+
+	get := func(path string, value interface{}) {
+		recorder := httptest.NewRecorder()
+		targets.APIHandler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+		assert.Equal(t, json.Unmarshal(recorder.Body.Bytes(), value), nil)
+	}
+
+	var domains []DomainEvent
+	get("/api/v1/domains", &domains)
+	assert.Equal(t, len(domains), 1)
+	assert.Equal(t, domains[0].Name, "example.com")
+	assert.Equal(t, domains[0].Availability, 67)
+
+	var statuses []EndpointStatus
+	get("/api/v1/endpoints", &statuses)
+	assert.Equal(t, len(statuses), 2)
+	assert.Equal(t, statuses[1].Endpoint, "careers")
+	assert.Equal(t, statuses[1].State, StateUp)
+
+	// unknown checks are part of the history
+	var history EndpointHistory
+	get("/api/v1/endpoints/example%20index/history", &history)
+	assert.Equal(t, history, EndpointHistory{
+		Endpoint: "example index",
+		Url:      "https://example.com/",
+		History: []CheckRecord{
+			{At: at, Status: StatusUp, LatencyMs: 120},
+			{At: at.Add(15 * time.Second), Status: StatusUnknown},
+		},
+	})
+
+	get("/api/v1/endpoints/careers/history", &history)
+	assert.Equal(t, history.History, []CheckRecord{
+		{At: at, Status: StatusDown, StatusCode: 503, ErrorKind: ErrorKindStatus, Error: "unexpected status code 503"},
+		{At: at.Add(15 * time.Second), Status: StatusUp, LatencyMs: 80},
+	})
+
+	// the heatmap is also served as CSV
+	targets.Heatmap.Observe([]CheckResult{
+		{Endpoint: "careers", Url: "https://example.com/careers", Status: StatusUp, Latency: 80 * time.Millisecond, StartedAt: at},
+	}, time.UTC)
+	var heatmap Heatmap
+	get("/api/v1/heatmap", &heatmap)
+	assert.Equal(t, len(heatmap.Endpoints), 1)
+
+	recorder := httptest.NewRecorder()
+	targets.APIHandler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/v1/heatmap?format=csv", nil))
+	assert.Equal(t, recorder.Code, http.StatusOK)
+	assert.Equal(t, recorder.Header().Get("Content-Type"), "text/csv; charset=utf-8")
+	assert.Equal(t, recorder.Body.String(), "endpoint,url,day,hour,checks,mean_latency_ms,max_latency_ms\n"+
+		"careers,https://example.com/careers,thursday,12,1,80,80\n")
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// AuthBasic and AuthBearer are the supported types of the auth option of HTTP and gRPC endpoints,
+// sending HTTP basic authentication or a bearer token in the Authorization header of their
+// requests.
+const (
+	AuthBasic  string = "basic"
+	AuthBearer string = "bearer"
+)
+
+// EndpointAuth is the authentication of the requests of an endpoint. The password of basic
+// authentication and the bearer token are either set inline, or read from an environment variable
+// or a file, so secrets don't have to be stored in the configuration file. They are read when the
+// configuration is loaded, so rotated secrets are picked up by a reload.
+type EndpointAuth struct {
+	Type     string `yaml:"type"`
+	Username string `yaml:"username,omitempty"`
+
+	Password     string `yaml:"password,omitempty"`
+	PasswordEnv  string `yaml:"password_env,omitempty"`
+	PasswordFile string `yaml:"password_file,omitempty"`
+
+	Token     string `yaml:"token,omitempty"`
+	TokenEnv  string `yaml:"token_env,omitempty"`
+	TokenFile string `yaml:"token_file,omitempty"`
+}
+
+// Authorization is a method for EndpointAuth that returns the value of the Authorization header
+// of the requests. An error is returned if the secret can't be resolved.
+func (auth *EndpointAuth) Authorization() (string, error) {
+	switch auth.Type {
+	case AuthBasic:
+		password, err := resolveSecret("password", auth.Password, auth.PasswordEnv, auth.PasswordFile)
+		if err != nil {
+			return "", err
+		}
+		credentials := base64.StdEncoding.EncodeToString([]byte(auth.Username + ":" + password))
+		return "Basic " + credentials, nil
+	case AuthBearer:
+		token, err := resolveSecret("token", auth.Token, auth.TokenEnv, auth.TokenFile)
+		if err != nil {
+			return "", err
+		}
+		return "Bearer " + token, nil
+	}
+	return "", fmt.Errorf("unsupported auth type %q, expected %q or %q", auth.Type, AuthBasic, AuthBearer)
+}
+
+// resolveSecret returns the named secret set inline, held by the environment variable env, or
+// stored in file without its trailing newline. An error is returned unless exactly one of them is
+// set, or if the secret is empty.
+func resolveSecret(name string, inline string, env string, file string) (string, error) {
+	configured := 0
+	for _, is_set := range []bool{inline != "", env != "", file != ""} {
+		if is_set {
+			configured++
+		}
+	}
+	if configured != 1 {
+		return "", fmt.Errorf("auth requires exactly one of %s, %s_env or %s_file", name, name, name)
+	}
+
+	secret := inline
+	switch {
+	case env != "":
+		secret = os.Getenv(env)
+		if secret == "" {
+			return "", fmt.Errorf("environment variable %s is not set", env)
+		}
+	case file != "":
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return "", fmt.Errorf("failed to read %s_file: %v", name, err)
+		}
+		secret = strings.TrimRight(string(content), "\r\n")
+		if secret == "" {
+			return "", fmt.Errorf("%s_file %s is empty", name, file)
+		}
+	}
+	return secret, nil
+}
+
+// validateAuth rejects auth of endpoints that aren't HTTP or gRPC endpoints, basic authentication
+// without a username or with a token, bearer authentication with a username or password, auth
+// combined with an Authorization header, and secrets that can't be resolved.
+func (endpoint *Endpoint) validateAuth() error {
+	auth := endpoint.Auth
+	if auth == nil {
+		return nil
+	}
+	if endpoint.Type != "" && endpoint.Type != EndpointTypeHTTP && endpoint.Type != EndpointTypeGRPC {
+		return fmt.Errorf("auth is only supported by %s and %s endpoints", EndpointTypeHTTP, EndpointTypeGRPC)
+	}
+	for field := range endpoint.Headers {
+		if strings.EqualFold(field, "Authorization") {
+			return errors.New("auth can't be combined with an Authorization header")
+		}
+	}
+
+	switch auth.Type {
+	case AuthBasic:
+		if auth.Username == "" {
+			return errors.New("basic auth requires a username")
+		}
+		if auth.Token != "" || auth.TokenEnv != "" || auth.TokenFile != "" {
+			return errors.New("basic auth can't set a token")
+		}
+	case AuthBearer:
+		if auth.Username != "" || auth.Password != "" || auth.PasswordEnv != "" || auth.PasswordFile != "" {
+			return errors.New("bearer auth can't set a username or password")
+		}
+	}
+
+	_, err := auth.Authorization()
+	return err
+}
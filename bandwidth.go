@@ -0,0 +1,156 @@
+package main
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"time"
+)
+
+// BandwidthExceededHead and BandwidthExceededReduce are the actions taken for the endpoints of a
+// domain that exceeded its bandwidth cap, until the bandwidth window resets:
+//
+//	head    endpoints are checked with HEAD, like with prefer_head (default)
+//	reduce  endpoints are only checked every BandwidthReduceFactor cycles, and the skipped
+//	        checks are recorded as unknown
+const (
+	BandwidthExceededHead   string = "head"
+	BandwidthExceededReduce string = "reduce"
+)
+
+// DefaultBandwidthWindow is the period over which the bandwidth of a domain is compared to its
+// cap when bandwidth_window isn't set.
+const DefaultBandwidthWindow time.Duration = 24 * time.Hour
+
+// BandwidthReduceFactor is the number of cycles between two checks of an endpoint whose domain
+// exceeded its bandwidth cap under the reduce action.
+const BandwidthReduceFactor int = 4
+
+// ErrorKindBandwidth classifies checks skipped because the bandwidth cap of the endpoint's domain
+// was exceeded.
+const ErrorKindBandwidth string = "bandwidth"
+
+// BandwidthCapWindow is a method for Settings that returns the configured bandwidth window, or
+// DefaultBandwidthWindow.
+func (settings Settings) BandwidthCapWindow() time.Duration {
+	if settings.BandwidthWindow <= 0 {
+		return DefaultBandwidthWindow
+	}
+	return settings.BandwidthWindow
+}
+
+// RecordBandwidth is a method for a domain to add the bytes sent and received by a check of one of
+// its endpoints to its totals.
+//
+// Returns immediately if the domain pointer passed is nil.
+func (domain *Domain) RecordBandwidth(sent int64, received int64) {
+	if domain == nil {
+		return
+	}
+
+	domain_stats.Lock()
+	defer domain_stats.Unlock()
+
+	domain.BytesSent += sent
+	domain.BytesReceived += received
+}
+
+// WindowBytes is a method for a domain that returns the bytes sent and received by the checks of
+// its endpoints since the start of the current bandwidth window. A new window starts at now when
+// the current one is older than window.
+func (domain *Domain) WindowBytes(now time.Time, window time.Duration) int64 {
+	domain_stats.Lock()
+	defer domain_stats.Unlock()
+
+	total := domain.BytesSent + domain.BytesReceived
+	if domain.window_start.IsZero() || now.Sub(domain.window_start) >= window {
+		domain.window_start = now
+		domain.window_base = total
+	}
+	return total - domain.window_base
+}
+
+// ApplyBandwidthCaps is a method for HealthCheckTargets that compares the bandwidth used by every
+// domain with a cap in the current window to its cap, before a check cycle starting at now. The
+// endpoints of the domains exceeding their cap are switched to HEAD, or checked less often,
+// according to the bandwidth_exceeded setting. Domains crossing their cap are logged.
+func (target *HealthCheckTargets) ApplyBandwidthCaps(now time.Time) {
+	if len(target.Settings.BandwidthCaps) == 0 || target.Endpoints == nil {
+		return
+	}
+
+	exceeded := map[*Domain]bool{}
+	for domain := target.Domains; domain != nil; domain = domain.Next {
+		limit, ok := target.Settings.BandwidthCaps[domain.Name]
+		if !ok || limit <= 0 {
+			continue
+		}
+
+		used := domain.WindowBytes(now, target.Settings.BandwidthCapWindow())
+		exceeded[domain] = used >= limit
+		if exceeded[domain] != domain.bandwidth_exceeded {
+			if exceeded[domain] {
+				log.Printf("WARNING: %s used %d bytes of its %d bytes bandwidth cap, reducing its checks until the window resets", domain.Name, used, limit)
+			} else {
+				log.Printf("%s is within its bandwidth cap again", domain.Name)
+			}
+			domain.bandwidth_exceeded = exceeded[domain]
+		}
+	}
+
+	for i := range *target.Endpoints {
+		endpoint := &(*target.Endpoints)[i]
+		over := exceeded[endpoint.Domain]
+
+		if target.Settings.BandwidthExceeded == BandwidthExceededReduce {
+			endpoint.BandwidthSkip = over && endpoint.bandwidth_cycles%BandwidthReduceFactor != 0
+			endpoint.bandwidth_cycles++
+			if !over {
+				endpoint.bandwidth_cycles = 0
+			}
+		} else {
+			endpoint.BandwidthHead = over
+		}
+	}
+}
+
+// countingReader counts the bytes read from a response body.
+type countingReader struct {
+	io.ReadCloser
+	count *int64
+}
+
+func (reader countingReader) Read(p []byte) (int, error) {
+	n, err := reader.ReadCloser.Read(p)
+	*reader.count += int64(n)
+	return n, err
+}
+
+// requestSize returns the approximate number of bytes sent for a request: its request line,
+// headers and body.
+func requestSize(request *http.Request) int64 {
+	size := int64(len(request.Method) + 1 + len(request.URL.RequestURI()) + len(" HTTP/1.1\r\n"))
+	size += int64(len("Host: \r\n") + len(request.URL.Host))
+	size += headerSize(request.Header) + 2
+	if request.ContentLength > 0 {
+		size += request.ContentLength
+	}
+	return size
+}
+
+// responseHeaderSize returns the approximate number of bytes received for the status line and
+// headers of a response.
+func responseHeaderSize(response *http.Response) int64 {
+	return int64(len(response.Proto)+1+len(response.Status)+2) + headerSize(response.Header) + 2
+}
+
+// headerSize returns the number of bytes of the header fields as written on the wire.
+func headerSize(header http.Header) int64 {
+	var size int64
+	for name, values := range header {
+		for _, value := range values {
+			size += int64(len(name) + len(": ") + len(value) + len("\r\n"))
+		}
+	}
+	return size
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-playground/assert/v2"
+)
+
+func TestDomainWindowBytes(t *testing.T) {
+	base := time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	var nil_domain *Domain
+	nil_domain.RecordBandwidth(100, 100)
+	assert.Equal(t, nil_domain, nil)
+
+	domain := &Domain{Name: "example.com"}
+	domain.RecordBandwidth(100, 400)
+	assert.Equal(t, domain.WindowBytes(base, time.Hour), int64(0))
+
+	domain.RecordBandwidth(50, 150)
+	assert.Equal(t, domain.BytesSent, int64(150))
+	assert.Equal(t, domain.BytesReceived, int64(550))
+	assert.Equal(t, domain.WindowBytes(base.Add(30*time.Minute), time.Hour), int64(200))
+
+	// a new window starts from the current totals
+	assert.Equal(t, domain.WindowBytes(base.Add(time.Hour), time.Hour), int64(0))
+}
+
+func TestApplyBandwidthCaps(t *testing.T) {
+	cases := []struct {
+		name          string
+		exceeded      string
+		used          int64
+		expectedHead  []bool
+		expectedSkips []bool
+	}{
+		{
+			name:          "Within Cap",
+			used:          100,
+			expectedHead:  []bool{false, false, false, false, false},
+			expectedSkips: []bool{false, false, false, false, false},
+		},
+		{
+			name:          "Head When Exceeded",
+			used:          1000,
+			expectedHead:  []bool{true, true, true, true, true},
+			expectedSkips: []bool{false, false, false, false, false},
+		},
+		{
+			name:          "Reduce When Exceeded",
+			exceeded:      BandwidthExceededReduce,
+			used:          1000,
+			expectedHead:  []bool{false, false, false, false, false},
+			expectedSkips: []bool{false, true, true, true, false},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			base := time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+			endpoints := Endpoints{{Name: "example", Url: "https://example.com/"}}
+			targets, err := endpoints.CreateNewTargets()
+			assert.Equal(t, err, nil)
+			targets.Settings = Settings{
+				BandwidthCaps:     map[string]int64{"example.com": 500},
+				BandwidthExceeded: tc.exceeded,
+			}
+
+			// the first cycle starts the window
+			targets.ApplyBandwidthCaps(base)
+			targets.Domains.RecordBandwidth(0, tc.used)
+
+			for i := range tc.expectedHead {
+				targets.ApplyBandwidthCaps(base.Add(time.Duration(i+1) * time.Minute))
+				endpoint := (*targets.Endpoints)[0]
+				assert.Equal(t, endpoint.BandwidthHead, tc.expectedHead[i])
+				assert.Equal(t, endpoint.BandwidthSkip, tc.expectedSkips[i])
+			}
+		})
+	}
+}
+
+func TestGetEndpointHealthBandwidth(t *testing.T) {
+	mock_server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(strings.Repeat("a", 1000)))
+	}))
+	defer mock_server.Close()
+
+	endpoint := Endpoint{Name: "Bandwidth Test", Url: mock_server.URL, Body: "hello", Method: http.MethodPost}
+	result := endpoint.GetEndpointHealth(2 * time.Second)
+	assert.Equal(t, result.Status, StatusUp)
+	assert.Equal(t, result.BytesSent > int64(len("hello")), true)
+	assert.Equal(t, result.BytesReceived > 1000, true)
+
+	endpoint = Endpoint{Name: "Bandwidth Test", Url: mock_server.URL, BandwidthHead: true}
+	result = endpoint.GetEndpointHealth(2 * time.Second)
+	assert.Equal(t, result.Method, http.MethodHead)
+	assert.Equal(t, result.BytesReceived < 1000, true)
+
+	endpoint = Endpoint{Name: "Bandwidth Test", Url: mock_server.URL, BandwidthSkip: true}
+	result = endpoint.GetEndpointHealth(2 * time.Second)
+	assert.Equal(t, result.Status, StatusUnknown)
+	assert.Equal(t, result.ErrorKind, ErrorKindBandwidth)
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// DefaultMaxBodySize is the maximum decompressed size, in bytes, of a response body read by a
+// check when the endpoint doesn't set max_body_size.
+const DefaultMaxBodySize int64 = 10 * 1024 * 1024
+
+// ErrBodyTooLarge is returned when a response body decompresses to more than the endpoint's maximum
+// body size. It is a distinct failure kind, since it usually points at a hostile or broken target
+// (e.g. a decompression bomb) rather than an outage.
+var ErrBodyTooLarge = errors.New("response body exceeds the maximum decompressed size")
+
+// ReadResponseBody reads the body of response, decompressing gzip and deflate content that the
+// transport didn't already decompress, and stops reading as soon as more than limit decompressed
+// bytes have been produced, returning ErrBodyTooLarge. A limit of zero or less selects
+// DefaultMaxBodySize.
+//
+// When keep is false the body is discarded as it is read, so only the size limit applies.
+func ReadResponseBody(response *http.Response, limit int64, keep bool) ([]byte, error) {
+	if limit <= 0 {
+		limit = DefaultMaxBodySize
+	}
+
+	reader, err := decodeResponseBody(response)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	// read one byte past the limit to detect bodies exceeding it
+	limited := io.LimitReader(reader, limit+1)
+
+	var body []byte
+	var read int64
+	if keep {
+		body, err = io.ReadAll(limited)
+		read = int64(len(body))
+	} else {
+		read, err = io.Copy(io.Discard, limited)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if read > limit {
+		return nil, ErrBodyTooLarge
+	}
+
+	return body, nil
+}
+
+// ReadResponseBodyPrefix reads at most limit decompressed bytes of the body of response, like
+// ReadResponseBody, but stops there without an error, so the rest of the body isn't downloaded.
+// The connection of a response with unread bytes is closed instead of reused.
+func ReadResponseBodyPrefix(response *http.Response, limit int64, keep bool) ([]byte, error) {
+	reader, err := decodeResponseBody(response)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	limited := io.LimitReader(reader, limit)
+	if keep {
+		return io.ReadAll(limited)
+	}
+	_, err = io.Copy(io.Discard, limited)
+	return nil, err
+}
+
+// decodeResponseBody returns a reader of the body of response, decompressing gzip and deflate
+// content that the transport didn't already decompress. Closing it doesn't close the body.
+func decodeResponseBody(response *http.Response) (io.ReadCloser, error) {
+	// the transport only decompresses responses to requests it added Accept-Encoding to
+	if !response.Uncompressed {
+		switch strings.ToLower(strings.TrimSpace(response.Header.Get("Content-Encoding"))) {
+		case "gzip", "x-gzip":
+			gzip_reader, err := gzip.NewReader(response.Body)
+			if err != nil {
+				return nil, fmt.Errorf("failed to decompress response body: %v", err)
+			}
+			return gzip_reader, nil
+		case "deflate":
+			return flate.NewReader(response.Body), nil
+		}
+	}
+	return io.NopCloser(response.Body), nil
+}
+
+// bodyFileContentType returns the media type of the endpoint's body_file by its extension, e.g.
+// "application/json" for payload.json, or "" when there is no body file or the extension is
+// unknown, in which case no Content-Type is sent unless a header sets it.
+func (endpoint *Endpoint) bodyFileContentType() string {
+	if endpoint.BodyFile == "" {
+		return ""
+	}
+	return mime.TypeByExtension(filepath.Ext(endpoint.BodyFile))
+}
+
+// validateBodyFile rejects a body_file that isn't a readable regular file, so a missing payload is
+// reported when the configuration is loaded instead of failing every check. The file is only
+// opened, as it is streamed again on every check.
+func (endpoint *Endpoint) validateBodyFile() error {
+	if endpoint.BodyFile == "" {
+		return nil
+	}
+	file, err := os.Open(endpoint.BodyFile)
+	if err != nil {
+		return fmt.Errorf("failed to open body_file: %v", err)
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to open body_file: %v", err)
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("body_file %s is not a regular file", endpoint.BodyFile)
+	}
+	return nil
+}
+
+// bodyRegex returns the endpoint's compiled expect_body_regex, compiling ExpectBodyRegex when the
+// endpoint wasn't created by CreateNewTargets. It returns nil when the endpoint doesn't set one.
+func (endpoint *Endpoint) bodyRegex() (*regexp.Regexp, error) {
+	if endpoint.BodyRegex != nil || endpoint.ExpectBodyRegex == "" {
+		return endpoint.BodyRegex, nil
+	}
+	return regexp.Compile(endpoint.ExpectBodyRegex)
+}
+
+// expectsBody reports whether the endpoint asserts on the content of response bodies.
+func (endpoint *Endpoint) expectsBody() bool {
+	return endpoint.ExpectBodyContains != "" || endpoint.ExpectBodyRegex != "" || len(endpoint.ExpectJSON) > 0
+}
+
+// checkBody returns an error describing why body doesn't satisfy the endpoint's body assertions:
+// it must contain ExpectBodyContains, match body_regex and satisfy the expect_json assertions,
+// when they are set.
+func (endpoint *Endpoint) checkBody(body []byte, body_regex *regexp.Regexp) error {
+	if endpoint.ExpectBodyContains != "" && !bytes.Contains(body, []byte(endpoint.ExpectBodyContains)) {
+		return fmt.Errorf("response body doesn't contain %q", endpoint.ExpectBodyContains)
+	}
+	if body_regex != nil && !body_regex.Match(body) {
+		return fmt.Errorf("response body doesn't match %q", body_regex)
+	}
+	if len(endpoint.ExpectJSON) > 0 {
+		assertions, err := endpoint.jsonAssertions()
+		if err != nil {
+			return fmt.Errorf("invalid expect_json: %v", err)
+		}
+		return CheckJSON(body, assertions)
+	}
+	return nil
+}
@@ -0,0 +1,339 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-playground/assert/v2"
+)
+
+// gzipBody returns size zero bytes compressed with gzip, which compress to a tiny fraction of their
+// decompressed size.
+func gzipBody(t *testing.T, size int) []byte {
+	var buffer bytes.Buffer
+	writer := gzip.NewWriter(&buffer)
+	if _, err := writer.Write(make([]byte, size)); err != nil {
+		t.Fatalf("failed to compress body: %v", err)
+	}
+	writer.Close()
+	return buffer.Bytes()
+}
+
+func TestReadResponseBody(t *testing.T) {
+	cases := []struct {
+		name          string
+		header        http.Header
+		body          []byte
+		limit         int64
+		expectedBody  []byte
+		expectedError error
+	}{
+		{
+			name:         "Plain Body Within Limit",
+			header:       http.Header{},
+			body:         []byte("hello"),
+			limit:        5,
+			expectedBody: []byte("hello"),
+		},
+		{
+			name:          "Plain Body Over Limit",
+			header:        http.Header{},
+			body:          []byte("hello!"),
+			limit:         5,
+			expectedError: ErrBodyTooLarge,
+		},
+		{
+			name:         "Gzip Body Within Limit",
+			header:       http.Header{"Content-Encoding": {"gzip"}},
+			body:         gzipBody(t, 1024),
+			limit:        1024,
+			expectedBody: make([]byte, 1024),
+		},
+		{
+			name:          "Gzip Bomb",
+			header:        http.Header{"Content-Encoding": {"gzip"}},
+			body:          gzipBody(t, 1024*1024),
+			limit:         1024,
+			expectedError: ErrBodyTooLarge,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			response := &http.Response{
+				Header: tc.header,
+				Body:   io.NopCloser(bytes.NewReader(tc.body)),
+			}
+
+			body, err := ReadResponseBody(response, tc.limit, true)
+			assert.Equal(t, err, tc.expectedError)
+			assert.Equal(t, body, tc.expectedBody)
+		})
+	}
+}
+
+func TestGetEndpointHealthDecompressionBomb(t *testing.T) {
+	bomb := gzipBody(t, 1024*1024)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Write(bomb)
+	}))
+	defer server.Close()
+
+	cases := []struct {
+		name              string
+		maxBodySize       int64
+		expectedStatus    string
+		expectedErrorKind string
+	}{
+		{
+			name:           "Default Limit",
+			maxBodySize:    0,
+			expectedStatus: StatusUp,
+		},
+		{
+			name:              "Exceeds Limit",
+			maxBodySize:       1024,
+			expectedStatus:    StatusDown,
+			expectedErrorKind: ErrorKindBodyTooLarge,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			endpoint := Endpoint{
+				Name:        "bomb",
+				Url:         server.URL,
+				MaxBodySize: tc.maxBodySize,
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			result := endpoint.runCheck(ctx, http.DefaultClient)
+			assert.Equal(t, result.Status, tc.expectedStatus)
+			assert.Equal(t, result.ErrorKind, tc.expectedErrorKind)
+			assert.Equal(t, result.Err() == ErrBodyTooLarge, tc.expectedErrorKind == ErrorKindBodyTooLarge)
+		})
+	}
+}
+
+func TestApplySettingsMaxBodySize(t *testing.T) {
+	config, err := ParseConfig([]byte(strings.Join([]string{
+		"max_body_size: 2048",
+		"endpoints:",
+		"  - name: default",
+		"    url: https://example.com/",
+		"  - name: override",
+		"    url: https://example.com/",
+		"    max_body_size: 512",
+	}, "\n")))
+	if err != nil {
+		t.Fatalf("failed to parse config: %v", err)
+	}
+	if err := config.ApplySettings(); err != nil {
+		t.Fatalf("failed to apply settings: %v", err)
+	}
+
+	assert.Equal(t, config.Endpoints[0].MaxBodySize, int64(2048))
+	assert.Equal(t, config.Endpoints[1].MaxBodySize, int64(512))
+}
+
+func TestGetEndpointHealthBodyAssertions(t *testing.T) {
+	mock_server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<html><body>Service temporarily unavailable</body></html>`))
+	}))
+	defer mock_server.Close()
+
+	cases := []struct {
+		name           string
+		contains       string
+		regex          string
+		expectedStatus string
+		expectedKind   string
+	}{
+		{
+			name:           "No Assertions",
+			expectedStatus: StatusUp,
+		},
+		{
+			name:           "Contains Match",
+			contains:       "<body>",
+			expectedStatus: StatusUp,
+		},
+		{
+			name:           "Contains Mismatch",
+			contains:       `"status":"ok"`,
+			expectedStatus: StatusDown,
+			expectedKind:   ErrorKindBody,
+		},
+		{
+			name:           "Regex Match",
+			regex:          `(?i)service\s+temporarily`,
+			expectedStatus: StatusUp,
+		},
+		{
+			name:           "Regex Mismatch",
+			regex:          `^\{`,
+			expectedStatus: StatusDown,
+			expectedKind:   ErrorKindBody,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			endpoint := Endpoint{
+				Name:               "Body Assertion Test",
+				Url:                mock_server.URL,
+				ExpectBodyContains: tc.contains,
+				ExpectBodyRegex:    tc.regex,
+			}
+
+			result := endpoint.GetEndpointHealth(2 * time.Second)
+			assert.Equal(t, result.Status, tc.expectedStatus)
+			assert.Equal(t, result.ErrorKind, tc.expectedKind)
+		})
+	}
+}
+
+func TestCreateNewTargetsBodyRegex(t *testing.T) {
+	valid := Endpoints{{Name: "valid", Url: "https://example.com/", ExpectBodyRegex: `"status":\s*"ok"`}}
+	targets, err := valid.CreateNewTargets()
+	assert.Equal(t, err, nil)
+	assert.NotEqual(t, (*targets.Endpoints)[0].BodyRegex, nil)
+
+	invalid := Endpoints{{Name: "invalid", Url: "https://example.com/", ExpectBodyRegex: `(`}}
+	_, err = invalid.CreateNewTargets()
+	assert.NotEqual(t, err, nil)
+}
+
+func TestBodyFile(t *testing.T) {
+	dir := t.TempDir()
+	json_file := filepath.Join(dir, "payload.json")
+	assert.Equal(t, os.WriteFile(json_file, []byte(`{"foo":"bar"}`), 0o644), nil)
+	binary_file := filepath.Join(dir, "payload")
+	assert.Equal(t, os.WriteFile(binary_file, []byte{0x00, 0xff, 0x10}, 0o644), nil)
+
+	cases := []struct {
+		name                string
+		endpoint            Endpoint
+		expectedContentType string
+		expectedFail        bool
+	}{
+		{name: "Inferred Content Type", endpoint: Endpoint{BodyFile: json_file}, expectedContentType: "application/json"},
+		{name: "Content Type Header", endpoint: Endpoint{BodyFile: json_file, Headers: map[string]string{"content-type": "application/vnd.api+json"}}, expectedContentType: "application/vnd.api+json"},
+		{name: "Unknown Extension", endpoint: Endpoint{BodyFile: binary_file}},
+		{name: "Missing File", endpoint: Endpoint{BodyFile: filepath.Join(dir, "missing.xml")}, expectedFail: true},
+		{name: "Directory", endpoint: Endpoint{BodyFile: dir}, expectedFail: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.endpoint.Url = "http://example.com/"
+			tc.endpoint.Method = http.MethodPost
+			err := tc.endpoint.validateBodyFile()
+			if tc.expectedFail {
+				assert.NotEqual(t, err, nil)
+				return
+			}
+			assert.Equal(t, err, nil)
+
+			request, err := tc.endpoint.CreateRequest(context.Background())
+			assert.Equal(t, err, nil)
+			assert.Equal(t, request.Header.Get("Content-Type"), tc.expectedContentType)
+		})
+	}
+}
+
+func TestGetEndpointHealthRemovedBodyFile(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	body_file := filepath.Join(t.TempDir(), "payload.json")
+	assert.Equal(t, os.WriteFile(body_file, []byte(`{"foo":"bar"}`), 0o644), nil)
+
+	endpoints := Endpoints{{Name: "upload", Url: server.URL, Method: http.MethodPost, BodyFile: body_file}}
+	targets, err := endpoints.CreateNewTargets()
+	assert.Equal(t, err, nil)
+
+	// a body file removed after the configuration was loaded only fails the check
+	assert.Equal(t, os.Remove(body_file), nil)
+	result := (*targets.Endpoints)[0].GetEndpointHealth(2 * time.Second)
+	assert.Equal(t, result.Status, StatusDown)
+	assert.Equal(t, result.ErrorKind, ErrorKindConnection)
+	assert.Equal(t, strings.Contains(result.Error, "failed to open request body"), true)
+}
+
+func TestGetEndpointHealthBodyReadLimit(t *testing.T) {
+	large_body := strings.Repeat("a", 4*1024*1024) + "tail"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/gzip" {
+			w.Header().Set("Content-Encoding", "gzip")
+			w.Write(gzipBody(t, 4*1024*1024))
+			return
+		}
+		w.Write([]byte(large_body))
+	}))
+	defer server.Close()
+
+	cases := []struct {
+		name               string
+		path               string
+		bodyReadLimit      int64
+		maxBodySize        int64
+		expectBodyContains string
+		expectedStatus     string
+		expectedPartial    bool
+	}{
+		{name: "Whole Body", expectedStatus: StatusUp},
+		{name: "Read Limit", bodyReadLimit: 1024, expectedStatus: StatusUp, expectedPartial: true},
+		{name: "Compressed Read Limit", path: "/gzip", bodyReadLimit: 1024, maxBodySize: 2048, expectedStatus: StatusUp, expectedPartial: true},
+		{name: "Assertion Within Limit", bodyReadLimit: 1024, expectBodyContains: "aaa", expectedStatus: StatusUp, expectedPartial: true},
+		{name: "Assertion Past Limit", bodyReadLimit: 1024, expectBodyContains: "tail", expectedStatus: StatusDown, expectedPartial: true},
+		{name: "Limit Above Max Body Size", bodyReadLimit: 8 * 1024 * 1024, maxBodySize: 1024, expectedStatus: StatusDown, expectedPartial: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			endpoint := Endpoint{
+				Name:               "catalog",
+				Url:                server.URL + tc.path,
+				BodyReadLimit:      tc.bodyReadLimit,
+				MaxBodySize:        tc.maxBodySize,
+				ExpectBodyContains: tc.expectBodyContains,
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			result := endpoint.runCheck(ctx, http.DefaultClient)
+			assert.Equal(t, result.Status, tc.expectedStatus)
+			assert.Equal(t, result.BytesReceived < 1024*1024, tc.expectedPartial)
+		})
+	}
+}
+
+func TestApplySettingsBodyReadLimit(t *testing.T) {
+	config := Config{
+		Settings: Settings{BodyReadLimit: 4096},
+		Endpoints: Endpoints{
+			{Name: "default", Url: "https://example.com/"},
+			{Name: "override", Url: "https://example.com/", BodyReadLimit: 512},
+		},
+	}
+	assert.Equal(t, config.ApplySettings(), nil)
+	assert.Equal(t, config.Endpoints[0].BodyReadLimit, int64(4096))
+	assert.Equal(t, config.Endpoints[1].BodyReadLimit, int64(512))
+
+	config = Config{Endpoints: Endpoints{{Name: "negative", Url: "https://example.com/", BodyReadLimit: -1}}}
+	assert.NotEqual(t, config.ApplySettings(), nil)
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultBreakerFailureThreshold and DefaultBreakerCooldown are used when a circuit breaker's
+// configuration doesn't set failure_threshold or cooldown.
+const (
+	DefaultBreakerFailureThreshold int           = 5
+	DefaultBreakerCooldown         time.Duration = time.Minute
+)
+
+// BreakerClosed, BreakerOpen and BreakerHalfOpen are the states of a CircuitBreaker. A closed
+// breaker lets calls through. An open breaker rejects calls until its cooldown elapses, after which
+// it is half-open and lets a single trial call through to decide whether to close or open again.
+const (
+	BreakerClosed   string = "closed"
+	BreakerOpen     string = "open"
+	BreakerHalfOpen string = "half-open"
+)
+
+// ErrCircuitOpen is returned by CircuitBreaker.Call when the call was rejected without being made.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// BreakerConfig is the circuit breaker configuration of an external integration such as a sink.
+type BreakerConfig struct {
+	FailureThreshold int           `yaml:"failure_threshold,omitempty"`
+	Cooldown         time.Duration `yaml:"cooldown,omitempty"`
+}
+
+// BreakerStatus is a point in time report of a CircuitBreaker's health.
+type BreakerStatus struct {
+	Name                string     `json:"name"`
+	State               string     `json:"state"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	Rejected            int        `json:"rejected"`
+	LastError           string     `json:"last_error,omitempty"`
+	OpenedAt            *time.Time `json:"opened_at,omitempty"`
+}
+
+// CircuitBreaker guards calls to an external integration (webhooks, metrics pushes, database
+// writes) so a broken integration degrades gracefully instead of failing, and logging, on every
+// cycle. After FailureThreshold consecutive failures the breaker opens and calls are rejected with
+// ErrCircuitOpen until Cooldown has elapsed. State transitions are logged once each.
+type CircuitBreaker struct {
+	name              string
+	failure_threshold int
+	cooldown          time.Duration
+	now               func() time.Time
+
+	mu        sync.Mutex
+	state     string
+	failures  int
+	rejected  int
+	last_err  error
+	opened_at time.Time
+	in_trial  bool
+}
+
+// NewCircuitBreaker creates a closed CircuitBreaker for the named integration. Zero or negative
+// configuration values select the defaults.
+func NewCircuitBreaker(name string, config BreakerConfig) *CircuitBreaker {
+	if config.FailureThreshold <= 0 {
+		config.FailureThreshold = DefaultBreakerFailureThreshold
+	}
+	if config.Cooldown <= 0 {
+		config.Cooldown = DefaultBreakerCooldown
+	}
+
+	return &CircuitBreaker{
+		name:              name,
+		failure_threshold: config.FailureThreshold,
+		cooldown:          config.Cooldown,
+		now:               time.Now,
+		state:             BreakerClosed,
+	}
+}
+
+// Call runs fn if the breaker allows it and records the outcome. ErrCircuitOpen is returned without
+// running fn when the breaker is open.
+func (breaker *CircuitBreaker) Call(fn func() error) error {
+	if !breaker.allow() {
+		return ErrCircuitOpen
+	}
+
+	err := fn()
+	breaker.record(err)
+	return err
+}
+
+// allow reports whether a call may be made, moving an open breaker to half-open once its cooldown
+// has elapsed. Only one trial call is let through while half-open.
+func (breaker *CircuitBreaker) allow() bool {
+	breaker.mu.Lock()
+	defer breaker.mu.Unlock()
+
+	switch breaker.state {
+	case BreakerOpen:
+		if breaker.now().Sub(breaker.opened_at) < breaker.cooldown {
+			breaker.rejected++
+			return false
+		}
+		breaker.state = BreakerHalfOpen
+		breaker.in_trial = true
+		return true
+	case BreakerHalfOpen:
+		if breaker.in_trial {
+			breaker.rejected++
+			return false
+		}
+		breaker.in_trial = true
+		return true
+	default:
+		return true
+	}
+}
+
+// record updates the breaker state with the outcome of a call.
+func (breaker *CircuitBreaker) record(err error) {
+	breaker.mu.Lock()
+	defer breaker.mu.Unlock()
+
+	breaker.in_trial = false
+
+	if err == nil {
+		if breaker.state != BreakerClosed {
+			log.Printf("%s recovered, circuit breaker closed after rejecting %d calls", breaker.name, breaker.rejected)
+		}
+		breaker.state = BreakerClosed
+		breaker.failures = 0
+		breaker.rejected = 0
+		breaker.last_err = nil
+		return
+	}
+
+	breaker.failures++
+	breaker.last_err = err
+
+	if breaker.state == BreakerHalfOpen || breaker.failures >= breaker.failure_threshold {
+		if breaker.state == BreakerClosed {
+			log.Printf("WARNING: %s failed %d consecutive times, circuit breaker opened for %v: %v", breaker.name, breaker.failures, breaker.cooldown, err)
+		}
+		breaker.state = BreakerOpen
+		breaker.opened_at = breaker.now()
+	}
+}
+
+// State returns the current state of the breaker.
+func (breaker *CircuitBreaker) State() string {
+	breaker.mu.Lock()
+	defer breaker.mu.Unlock()
+	return breaker.state
+}
+
+// Status returns a report of the breaker's health.
+func (breaker *CircuitBreaker) Status() BreakerStatus {
+	breaker.mu.Lock()
+	defer breaker.mu.Unlock()
+
+	status := BreakerStatus{
+		Name:                breaker.name,
+		State:               breaker.state,
+		ConsecutiveFailures: breaker.failures,
+		Rejected:            breaker.rejected,
+	}
+	if breaker.last_err != nil {
+		status.LastError = breaker.last_err.Error()
+	}
+	if breaker.state != BreakerClosed {
+		opened_at := breaker.opened_at
+		status.OpenedAt = &opened_at
+	}
+	return status
+}
+
+// IntegrationHealth is a method for HealthCheckTargets that returns the circuit breaker status of
+// every configured sink and notifier, sorted by name, so integration health is reported alongside
+// endpoint health on /healthz, /readyz, /metrics and /api/v1/integrations. Integrations of the
+// same type are numbered in the order of the configuration, e.g. "webhook sink (2)".
+func (target *HealthCheckTargets) IntegrationHealth() []BreakerStatus {
+	statuses := []BreakerStatus{}
+	for _, sink := range target.Sinks {
+		statuses = append(statuses, sink.breaker.Status())
+	}
+	for _, notifier := range target.Notifiers {
+		statuses = append(statuses, notifier.breaker.Status())
+	}
+
+	seen := map[string]int{}
+	for i := range statuses {
+		seen[statuses[i].Name]++
+		if count := seen[statuses[i].Name]; count > 1 {
+			statuses[i].Name = fmt.Sprintf("%s (%d)", statuses[i].Name, count)
+		}
+	}
+
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Name < statuses[j].Name
+	})
+	return statuses
+}
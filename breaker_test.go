@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-playground/assert/v2"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	now := time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+	failure := errors.New("integration unavailable")
+
+	breaker := NewCircuitBreaker("test", BreakerConfig{FailureThreshold: 2, Cooldown: time.Minute})
+	breaker.now = func() time.Time { return now }
+
+	calls := 0
+	succeed := func() error { calls++; return nil }
+	fail := func() error { calls++; return failure }
+
+	// failures below the threshold keep the breaker closed
+	assert.Equal(t, breaker.Call(fail), failure)
+	assert.Equal(t, breaker.State(), BreakerClosed)
+
+	// reaching the threshold opens the breaker
+	assert.Equal(t, breaker.Call(fail), failure)
+	assert.Equal(t, breaker.State(), BreakerOpen)
+
+	// calls are rejected without being made while open
+	assert.Equal(t, breaker.Call(succeed), ErrCircuitOpen)
+	assert.Equal(t, calls, 2)
+	assert.Equal(t, breaker.Status().Rejected, 1)
+
+	// a failed trial after the cooldown opens the breaker again
+	now = now.Add(time.Minute)
+	assert.Equal(t, breaker.Call(fail), failure)
+	assert.Equal(t, breaker.State(), BreakerOpen)
+	assert.Equal(t, breaker.Call(succeed), ErrCircuitOpen)
+
+	// a successful trial after the cooldown closes the breaker
+	now = now.Add(time.Minute)
+	assert.Equal(t, breaker.Call(succeed), nil)
+	assert.Equal(t, breaker.State(), BreakerClosed)
+	assert.Equal(t, breaker.Status(), BreakerStatus{Name: "test", State: BreakerClosed})
+}
+
+func TestCircuitBreakerDefaults(t *testing.T) {
+	breaker := NewCircuitBreaker("test", BreakerConfig{})
+
+	assert.Equal(t, breaker.failure_threshold, DefaultBreakerFailureThreshold)
+	assert.Equal(t, breaker.cooldown, DefaultBreakerCooldown)
+	assert.Equal(t, breaker.State(), BreakerClosed)
+}
+
+func TestIntegrationHealth(t *testing.T) {
+	endpoints := Endpoints{{Name: "index", Url: "https://example.com/"}}
+	targets, err := endpoints.CreateNewTargets()
+	assert.Equal(t, err, nil)
+
+	// two webhook sinks, the second failing, and a notifier
+	broken := NewBatchSink("webhook", &recordingSink{err: errors.New("write failed")}, SinkConfig{
+		BatchSize:      1,
+		FlushInterval:  time.Hour,
+		CircuitBreaker: BreakerConfig{FailureThreshold: 1, Cooldown: time.Hour},
+	})
+	broken.Emit(testEvents(1)...)
+	assert.Equal(t, broken.Close(), nil)
+	healthy := NewBatchSink("webhook", &recordingSink{}, SinkConfig{})
+	defer healthy.Close()
+	notifier := newOutageNotifier("jira", &recordingNotifier{}, NotifierConfig{})
+	defer notifier.Close()
+	targets.Sinks = []*BatchSink{healthy, broken}
+	targets.Notifiers = []*OutageNotifier{notifier}
+
+	statuses := targets.IntegrationHealth()
+	assert.Equal(t, len(statuses), 3)
+	assert.Equal(t, statuses[0], BreakerStatus{Name: "jira notifier", State: BreakerClosed})
+	assert.Equal(t, statuses[1], BreakerStatus{Name: "webhook sink", State: BreakerClosed})
+	assert.Equal(t, statuses[2].Name, "webhook sink (2)")
+	assert.Equal(t, statuses[2].State, BreakerOpen)
+	assert.Equal(t, statuses[2].LastError, "write failed")
+	assert.NotEqual(t, statuses[2].OpenedAt, nil)
+
+	// reported by the probes, which an open breaker doesn't fail, the API and the metrics
+	recorder := httptest.NewRecorder()
+	targets.HealthzHandler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	assert.Equal(t, recorder.Code, http.StatusOK)
+	var status LoopStatus
+	assert.Equal(t, json.Unmarshal(recorder.Body.Bytes(), &status), nil)
+	assert.Equal(t, len(status.Integrations), 3)
+	assert.Equal(t, status.Integrations[2].State, BreakerOpen)
+
+	recorder = httptest.NewRecorder()
+	targets.ReadyzHandler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	status = LoopStatus{}
+	assert.Equal(t, json.Unmarshal(recorder.Body.Bytes(), &status), nil)
+	assert.Equal(t, len(status.Integrations), 3)
+
+	recorder = httptest.NewRecorder()
+	targets.APIHandler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/v1/integrations", nil))
+	assert.Equal(t, recorder.Code, http.StatusOK)
+	var api_statuses []BreakerStatus
+	assert.Equal(t, json.Unmarshal(recorder.Body.Bytes(), &api_statuses), nil)
+	assert.Equal(t, len(api_statuses), 3)
+	assert.Equal(t, api_statuses[0].OpenedAt, nil)
+
+	var output strings.Builder
+	assert.Equal(t, targets.WriteMetrics(&output), nil)
+	assert.Equal(t, strings.Contains(output.String(), `checkhealth_integration_breaker_state{integration="webhook sink (2)",state="open"} 1`), true)
+	assert.Equal(t, strings.Contains(output.String(), `checkhealth_integration_breaker_state{integration="jira notifier",state="closed"} 1`), true)
+	assert.Equal(t, strings.Contains(output.String(), `checkhealth_integration_consecutive_failures{integration="webhook sink (2)"} 1`), true)
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+// An endpoint setting a baseline_url and a canary_url, instead of a url, compares a canary
+// deployment with its baseline during a progressive rollout: it is expanded into a baseline and a
+// canary endpoint, checked like any other, and every cycle the availability and latency of the
+// recent checks of the canary are compared with those of the baseline, see CanaryComparisons, so
+// an automated canary analysis can promote or roll back the canary from the deltas.
+
+// Canary variants
+const (
+	CanaryVariantBaseline string = "baseline"
+	CanaryVariantCanary   string = "canary"
+)
+
+// EventCanaryComparison is the event type comparing the recent checks of the canary of an endpoint
+// with those of its baseline. It is emitted at the end of each check cycle for every endpoint with
+// a baseline_url and a canary_url once both were checked.
+const EventCanaryComparison string = "canary_comparison"
+
+// CanaryEvent is the payload of an EventCanaryComparison event, and the comparison served on
+// /api/v1/canaries.
+type CanaryEvent struct {
+	Name     string             `json:"name"`
+	Baseline CanaryVariantEvent `json:"baseline"`
+	Canary   CanaryVariantEvent `json:"canary"`
+
+	// AvailabilityDelta and the latency deltas are the differences between the canary and the
+	// baseline, negative when the canary is less available or faster.
+	AvailabilityDelta int     `json:"availability_delta"`
+	LatencyP50DeltaMs float64 `json:"latency_p50_delta_ms"`
+	LatencyP95DeltaMs float64 `json:"latency_p95_delta_ms"`
+}
+
+// CanaryVariantEvent is the baseline or the canary of a CanaryEvent.
+type CanaryVariantEvent struct {
+	Endpoint     string  `json:"endpoint"`
+	Url          string  `json:"url"`
+	State        string  `json:"state"`
+	Availability int     `json:"availability"`
+	Checks       int     `json:"checks"`
+	LatencyP50Ms float64 `json:"latency_p50_ms"`
+	LatencyP95Ms float64 `json:"latency_p95_ms"`
+}
+
+// CanaryComparison compares the recent checks of the canary of the endpoint Name with those of its
+// baseline.
+type CanaryComparison struct {
+	Name     string
+	Baseline CanaryVariant
+	Canary   CanaryVariant
+}
+
+// CanaryVariant is the baseline or the canary of a CanaryComparison: the availability of its last
+// Checks conclusive checks, out of at most RecentChecks, and the distribution of their latencies,
+// zero when none had a latency.
+type CanaryVariant struct {
+	Endpoint     string
+	Url          string
+	State        string
+	Availability int
+	Checks       int
+	Latency      LatencySummary
+}
+
+// ExpandCanaries is a method for Endpoints that returns the endpoints with every endpoint setting a
+// baseline_url and a canary_url replaced by a baseline and a canary endpoint, checking each URL,
+// with the variant appended to its name, e.g. "checkout (canary)".
+//
+// An error is returned if an endpoint sets only one of baseline_url and canary_url, or sets them
+// with a url, a path or hosts.
+func (endpoints Endpoints) ExpandCanaries() (Endpoints, error) {
+	expanded := make(Endpoints, 0, len(endpoints))
+
+	for _, endpoint := range endpoints {
+		switch {
+		case endpoint.BaselineUrl == "" && endpoint.CanaryUrl == "":
+			expanded = append(expanded, endpoint)
+			continue
+		case endpoint.BaselineUrl == "" || endpoint.CanaryUrl == "":
+			return nil, fmt.Errorf("endpoint %q must set both a baseline_url and a canary_url", endpoint.Name)
+		case endpoint.Url != "":
+			return nil, fmt.Errorf("endpoint %q sets both a url and a baseline_url and canary_url", endpoint.Name)
+		case endpoint.Path != "":
+			return nil, fmt.Errorf("endpoint %q sets both a path and a baseline_url and canary_url", endpoint.Name)
+		case len(endpoint.Hosts) > 0:
+			return nil, fmt.Errorf("endpoint %q lists hosts with a baseline_url and canary_url", endpoint.Name)
+		}
+
+		for _, variant := range []string{CanaryVariantBaseline, CanaryVariantCanary} {
+			variant_endpoint := endpoint
+			variant_endpoint.Name = fmt.Sprintf("%s (%s)", endpoint.Name, variant)
+			variant_endpoint.Url = endpoint.BaselineUrl
+			if variant == CanaryVariantCanary {
+				variant_endpoint.Url = endpoint.CanaryUrl
+			}
+			variant_endpoint.BaselineUrl = ""
+			variant_endpoint.CanaryUrl = ""
+			variant_endpoint.Canary = endpoint.Name
+			variant_endpoint.Variant = variant
+			if endpoint.Headers != nil {
+				variant_endpoint.Headers = make(map[string]string, len(endpoint.Headers))
+				for key, value := range endpoint.Headers {
+					variant_endpoint.Headers[key] = value
+				}
+			}
+			expanded = append(expanded, variant_endpoint)
+		}
+	}
+
+	return expanded, nil
+}
+
+// recentLatencySummary returns the distribution of the recent latencies, zero if there are none.
+func (state *EndpointState) recentLatencySummary() LatencySummary {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	if len(state.recent_latencies) == 0 {
+		return LatencySummary{}
+	}
+	return summarizeLatencies(append([]time.Duration(nil), state.recent_latencies...))
+}
+
+// CanaryComparisons is a method for HealthCheckTargets that compares the canary of every endpoint
+// setting a baseline_url and a canary_url with its baseline, in the order of the configuration.
+// Endpoints whose baseline or canary has no conclusive recent check aren't compared yet.
+func (target *HealthCheckTargets) CanaryComparisons() []CanaryComparison {
+	comparisons := []CanaryComparison{}
+
+	// the endpoints are replaced when the configuration is reloaded
+	domain_stats.Lock()
+	endpoints := target.Endpoints
+	domain_stats.Unlock()
+	if endpoints == nil {
+		return comparisons
+	}
+
+	var names []string
+	variants := map[string]map[string]CanaryVariant{}
+	for i := range *endpoints {
+		endpoint := &(*endpoints)[i]
+		if endpoint.Canary == "" || endpoint.State == nil {
+			continue
+		}
+
+		status := endpoint.State.Status()
+		if status.RecentCheckCount == 0 {
+			continue
+		}
+		if variants[endpoint.Canary] == nil {
+			variants[endpoint.Canary] = map[string]CanaryVariant{}
+			names = append(names, endpoint.Canary)
+		}
+		variants[endpoint.Canary][endpoint.Variant] = CanaryVariant{
+			Endpoint:     endpoint.Name,
+			Url:          endpoint.Url,
+			State:        status.State,
+			Availability: status.RecentAvailability,
+			Checks:       status.RecentCheckCount,
+			Latency:      endpoint.State.recentLatencySummary(),
+		}
+	}
+
+	for _, name := range names {
+		baseline, baseline_ok := variants[name][CanaryVariantBaseline]
+		canary, canary_ok := variants[name][CanaryVariantCanary]
+		if !baseline_ok || !canary_ok {
+			continue
+		}
+		comparisons = append(comparisons, CanaryComparison{Name: name, Baseline: baseline, Canary: canary})
+	}
+	return comparisons
+}
+
+// Event returns the comparison as the payload of an EventCanaryComparison event.
+func (comparison CanaryComparison) Event() *CanaryEvent {
+	return &CanaryEvent{
+		Name:              comparison.Name,
+		Baseline:          comparison.Baseline.event(),
+		Canary:            comparison.Canary.event(),
+		AvailabilityDelta: comparison.Canary.Availability - comparison.Baseline.Availability,
+		LatencyP50DeltaMs: latencyMilliseconds(comparison.Canary.Latency.P50 - comparison.Baseline.Latency.P50),
+		LatencyP95DeltaMs: latencyMilliseconds(comparison.Canary.Latency.P95 - comparison.Baseline.Latency.P95),
+	}
+}
+
+// event returns the variant as the baseline or the canary of a CanaryEvent.
+func (variant CanaryVariant) event() CanaryVariantEvent {
+	return CanaryVariantEvent{
+		Endpoint:     variant.Endpoint,
+		Url:          variant.Url,
+		State:        variant.State,
+		Availability: variant.Availability,
+		Checks:       variant.Checks,
+		LatencyP50Ms: latencyMilliseconds(variant.Latency.P50),
+		LatencyP95Ms: latencyMilliseconds(variant.Latency.P95),
+	}
+}
+
+// CanaryStatuses is a method for HealthCheckTargets that returns the canary comparisons as served
+// on /api/v1/canaries, see CanaryComparisons.
+func (target *HealthCheckTargets) CanaryStatuses() []*CanaryEvent {
+	statuses := []*CanaryEvent{}
+	for _, comparison := range target.CanaryComparisons() {
+		statuses = append(statuses, comparison.Event())
+	}
+	return statuses
+}
+
+// CanaryEvents is a method for HealthCheckTargets that returns an EventCanaryComparison event for
+// each canary comparison, signed when a signer is configured.
+func (target *HealthCheckTargets) CanaryEvents(timestamp time.Time) []Event {
+	var events []Event
+	for _, comparison := range target.CanaryComparisons() {
+		event := NewEvent(EventCanaryComparison, timestamp)
+		event.Canary = comparison.Event()
+		events = append(events, event)
+	}
+
+	if err := target.Signer.Sign(events); err != nil {
+		log.Printf("Failed to sign events: %v", err)
+	}
+	return events
+}
+
+// LogCanaryComparisons is a method for HealthCheckTargets that prints the canary comparisons to
+// the console in the configured output format.
+func (target *HealthCheckTargets) LogCanaryComparisons() {
+	if target.Settings.Output == OutputJSON {
+		if err := WriteEvents(os.Stdout, target.CanaryEvents(time.Now())); err != nil {
+			log.Printf("Failed to write JSON output: %v", err)
+		}
+		return
+	}
+
+	for _, comparison := range target.CanaryComparisons() {
+		fmt.Println(comparison.String())
+	}
+}
+
+// String describes the comparison for the text output on a single line, canary first, e.g.
+//
+//	checkout canary vs baseline: availability 95% vs 100% (-5), p50 130ms vs 120ms (+10ms),
+//	p95 310ms vs 250ms (+60ms)
+func (comparison CanaryComparison) String() string {
+	baseline, canary := comparison.Baseline, comparison.Canary
+	return fmt.Sprintf("%s canary vs baseline: availability %d%% vs %d%% (%+d), p50 %s vs %s (%s), p95 %s vs %s (%s)",
+		comparison.Name, canary.Availability, baseline.Availability, canary.Availability-baseline.Availability,
+		roundLatency(canary.Latency.P50), roundLatency(baseline.Latency.P50), formatLatencyDelta(canary.Latency.P50-baseline.Latency.P50),
+		roundLatency(canary.Latency.P95), roundLatency(baseline.Latency.P95), formatLatencyDelta(canary.Latency.P95-baseline.Latency.P95))
+}
+
+// formatLatencyDelta formats a latency difference with its sign, e.g. "+10ms" or "-2ms".
+func formatLatencyDelta(delta time.Duration) string {
+	if delta < 0 {
+		return "-" + roundLatency(-delta).String()
+	}
+	return "+" + roundLatency(delta).String()
+}
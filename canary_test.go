@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/go-playground/assert/v2"
+)
+
+func TestExpandCanaries(t *testing.T) {
+	cases := []struct {
+		name              string
+		endpoints         Endpoints
+		expectedFail      bool
+		expectedEndpoints Endpoints
+	}{
+		{
+			name:              "Without Canary",
+			endpoints:         Endpoints{{Name: "index", Url: "https://example.com/"}},
+			expectedEndpoints: Endpoints{{Name: "index", Url: "https://example.com/"}},
+		},
+		{
+			name: "Baseline And Canary",
+			endpoints: Endpoints{{
+				Name:        "checkout",
+				Method:      "POST",
+				BaselineUrl: "https://stable.example.com/healthz",
+				CanaryUrl:   "https://canary.example.com/healthz",
+			}},
+			expectedEndpoints: Endpoints{
+				{Name: "checkout (baseline)", Url: "https://stable.example.com/healthz", Method: "POST", Canary: "checkout", Variant: CanaryVariantBaseline},
+				{Name: "checkout (canary)", Url: "https://canary.example.com/healthz", Method: "POST", Canary: "checkout", Variant: CanaryVariantCanary},
+			},
+		},
+		{
+			name:         "Baseline Without Canary",
+			endpoints:    Endpoints{{Name: "checkout", BaselineUrl: "https://stable.example.com/"}},
+			expectedFail: true,
+		},
+		{
+			name:         "Canary With URL",
+			endpoints:    Endpoints{{Name: "checkout", Url: "https://example.com/", BaselineUrl: "https://stable.example.com/", CanaryUrl: "https://canary.example.com/"}},
+			expectedFail: true,
+		},
+		{
+			name:         "Canary With Path",
+			endpoints:    Endpoints{{Name: "checkout", Path: "/healthz", BaselineUrl: "https://stable.example.com/", CanaryUrl: "https://canary.example.com/"}},
+			expectedFail: true,
+		},
+		{
+			name:         "Canary With Hosts",
+			endpoints:    Endpoints{{Name: "checkout", Hosts: []string{"a"}, BaselineUrl: "https://stable.example.com/", CanaryUrl: "https://canary.example.com/"}},
+			expectedFail: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			endpoints, err := tc.endpoints.ExpandCanaries()
+			if tc.expectedFail {
+				assert.NotEqual(t, err, nil)
+				return
+			}
+
+			assert.Equal(t, err, nil)
+			assert.Equal(t, endpoints, tc.expectedEndpoints)
+		})
+	}
+}
+
+func TestCanaryComparisons(t *testing.T) {
+	endpoints, err := Endpoints{
+		{Name: "checkout", BaselineUrl: "http://127.0.0.1:1/stable", CanaryUrl: "http://127.0.0.1:1/canary"},
+		{Name: "index", Url: "http://127.0.0.1:1/"},
+	}.ExpandCanaries()
+	assert.Equal(t, err, nil)
+	targets, err := endpoints.CreateNewTargets()
+	assert.Equal(t, err, nil)
+	targets.Settings = Settings{Output: OutputText, Interval: 15 * time.Second}
+
+	// endpoints aren't compared until both variants were checked, and unknown checks are ignored
+	at := time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+	targets.RecordResults([]CheckResult{
+		{Endpoint: "checkout (baseline)", Url: "http://127.0.0.1:1/stable", Status: StatusUp, Latency: 100 * time.Millisecond, FinishedAt: at},
+		{Endpoint: "checkout (canary)", Url: "http://127.0.0.1:1/canary", Status: StatusUnknown, FinishedAt: at},
+		{Endpoint: "index", Url: "http://127.0.0.1:1/", Status: StatusUp, Latency: 50 * time.Millisecond, FinishedAt: at},
+	})
+	assert.Equal(t, targets.CanaryComparisons(), []CanaryComparison{})
+
+	targets.RecordResults([]CheckResult{
+		{Endpoint: "checkout (baseline)", Url: "http://127.0.0.1:1/stable", Status: StatusUp, Latency: 120 * time.Millisecond, FinishedAt: at},
+		{Endpoint: "checkout (canary)", Url: "http://127.0.0.1:1/canary", Status: StatusUp, Latency: 150 * time.Millisecond, FinishedAt: at},
+		{Endpoint: "index", Url: "http://127.0.0.1:1/", Status: StatusUp, Latency: 50 * time.Millisecond, FinishedAt: at},
+	})
+	targets.RecordResults([]CheckResult{
+		{Endpoint: "checkout (baseline)", Url: "http://127.0.0.1:1/stable", Status: StatusUnknown, FinishedAt: at},
+		{Endpoint: "checkout (canary)", Url: "http://127.0.0.1:1/canary", Status: StatusDown, Latency: 90 * time.Millisecond, FinishedAt: at},
+		{Endpoint: "index", Url: "http://127.0.0.1:1/", Status: StatusUp, Latency: 50 * time.Millisecond, FinishedAt: at},
+	})
+
+	comparisons := targets.CanaryComparisons()
+	assert.Equal(t, len(comparisons), 1)
+	assert.Equal(t, comparisons[0].Name, "checkout")
+	assert.Equal(t, comparisons[0].Baseline.Availability, 100)
+	assert.Equal(t, comparisons[0].Canary.Availability, 50)
+	assert.Equal(t, comparisons[0].Canary.Checks, 2)
+	assert.Equal(t, comparisons[0].String(), "checkout canary vs baseline: availability 50% vs 100% (-50), p50 90ms vs 100ms (-10ms), p95 150ms vs 120ms (+30ms)")
+
+	var output bytes.Buffer
+	assert.Equal(t, WriteEvents(&output, targets.CanaryEvents(at)), nil)
+	assert.Equal(t, output.String(), `{"schema_version":"1.18","type":"canary_comparison","timestamp":"2023-06-01T12:00:00Z","canary":{"name":"checkout",`+
+		`"baseline":{"endpoint":"checkout (baseline)","url":"http://127.0.0.1:1/stable","state":"UP","availability":100,"checks":2,"latency_p50_ms":100,"latency_p95_ms":120},`+
+		`"canary":{"endpoint":"checkout (canary)","url":"http://127.0.0.1:1/canary","state":"DEGRADED","availability":50,"checks":2,"latency_p50_ms":90,"latency_p95_ms":150},`+
+		`"availability_delta":-50,"latency_p50_delta_ms":-10,"latency_p95_delta_ms":30}}`+"\n")
+}
+
+func TestApplySettingsExpandsCanaries(t *testing.T) {
+	config := Config{
+		Settings:  Settings{DownAfter: 5},
+		Endpoints: Endpoints{{Name: "checkout", BaselineUrl: "https://stable.example.com/", CanaryUrl: "https://canary.example.com/"}},
+	}
+
+	assert.Equal(t, config.ApplySettings(), nil)
+	assert.Equal(t, len(config.Endpoints), 2)
+	assert.Equal(t, config.Endpoints[1].Name, "checkout (canary)")
+	assert.Equal(t, config.Endpoints[1].DownAfter, 5)
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// StatusUp, StatusDegraded, StatusDown and StatusUnknown are the statuses of a CheckResult.
+// Degraded checks, such as rate-limited responses under the degraded policy, count as available.
+// Unknown checks, such as DNS failures under the unknown policy, are excluded from availability.
+const (
+	StatusUp       string = "up"
+	StatusDegraded string = "degraded"
+	StatusDown     string = "down"
+	StatusUnknown  string = "unknown"
+)
+
+// ErrorKindTimeout, ErrorKindDNS, ErrorKindTLS, ErrorKindConnection, ErrorKindStatus,
+// ErrorKindPredicate, ErrorKindBody, ErrorKindInterim, ErrorKindBodyTooLarge and
+// ErrorKindRateLimited classify why a check didn't succeed, so failures can be told apart without
+// parsing error messages.
+const (
+	ErrorKindTimeout      string = "timeout"
+	ErrorKindDNS          string = "dns"
+	ErrorKindTLS          string = "tls"
+	ErrorKindConnection   string = "connection"
+	ErrorKindStatus       string = "status"
+	ErrorKindPredicate    string = "predicate"
+	ErrorKindBody         string = "body"
+	ErrorKindInterim      string = "interim"
+	ErrorKindBodyTooLarge string = "body_too_large"
+	ErrorKindRateLimited  string = "rate_limited"
+)
+
+// EndpointTypeHTTP, EndpointTypeGRPC and EndpointTypeSSH are the types of endpoint checks, along
+// with the file transfer types EndpointTypeFTP and EndpointTypeSFTP. HTTP endpoints are checked
+// with a request to their URL (default). Other types are implemented by optional files registering
+// themselves with RegisterCheckType.
+const (
+	EndpointTypeHTTP string = "http"
+	EndpointTypeGRPC string = "grpc"
+	EndpointTypeSSH  string = "ssh"
+)
+
+// CheckType is the implementation of a type of endpoint check other than HTTP. Validate rejects
+// endpoints the check can't handle when the configuration is loaded, and Check checks the
+// endpoint within the deadline of ctx.
+type CheckType struct {
+	Validate func(endpoint *Endpoint) error
+	Check    func(endpoint *Endpoint, ctx context.Context) CheckResult
+}
+
+// check_types holds the check types compiled into the binary, by name.
+var check_types = struct {
+	sync.Mutex
+	types map[string]CheckType
+}{
+	types: map[string]CheckType{},
+}
+
+// RegisterCheckType makes a type of endpoint check available to the type field of endpoints and
+// records it as a feature. It is intended to be called from init functions.
+func RegisterCheckType(name string, check_type CheckType) {
+	RegisterFeature(FeatureCheckType, name)
+
+	check_types.Lock()
+	defer check_types.Unlock()
+	check_types.types[name] = check_type
+}
+
+// LookupCheckType returns the registered check type for the type of an endpoint. An error is
+// returned if the type isn't compiled into the binary.
+func LookupCheckType(name string) (CheckType, error) {
+	check_types.Lock()
+	check_type, ok := check_types.types[name]
+	check_types.Unlock()
+
+	if !ok {
+		return CheckType{}, fmt.Errorf("unknown type %q, expected one of %v", name, registeredFeatures(FeatureCheckType))
+	}
+	return check_type, nil
+}
+
+// CheckResult is the result of a single check of an endpoint. It is returned by GetEndpointHealth
+// without modifying any Domain, leaving aggregation to the scheduler.
+type CheckResult struct {
+	Endpoint string `json:"endpoint"`
+	Url      string `json:"url"`
+	Status   string `json:"status"`
+
+	// Method is the HTTP method of the request the result is based on, which is HEAD for endpoints
+	// with prefer_head, or GET after they rejected it.
+	Method string `json:"method,omitempty"`
+
+	// StatusCode is the status code of the final response, zero when no response was received.
+	StatusCode int           `json:"status_code,omitempty"`
+	Latency    time.Duration `json:"latency"`
+
+	// ErrorKind classifies the failure of a check that isn't up, and Error describes it.
+	ErrorKind string `json:"error_kind,omitempty"`
+	Error     string `json:"error,omitempty"`
+
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+
+	// BytesSent and BytesReceived are the approximate bytes transferred by the check.
+	BytesSent     int64 `json:"bytes_sent,omitempty"`
+	BytesReceived int64 `json:"bytes_received,omitempty"`
+
+	// Retries is the number of times the check was retried within its cycle, see
+	// checkWithRetries.
+	Retries int `json:"retries,omitempty"`
+
+	// RedirectTarget is where the final response redirected to, see redirectTarget.
+	RedirectTarget string `json:"redirect_target,omitempty"`
+
+	// Redirects are the redirect responses followed by the check, with the time spent on each.
+	Redirects []RedirectHop `json:"redirects,omitempty"`
+
+	// RemoteIP is the address the request was sent to, empty when no connection was made.
+	RemoteIP string `json:"remote_ip,omitempty"`
+
+	// Timing is the latency breakdown of the last request of an HTTP check, nil when no connection
+	// was requested.
+	Timing *CheckTiming `json:"timing,omitempty"`
+
+	// Components are the component statuses reported by a health+json response.
+	Components []ComponentStatus `json:"components,omitempty"`
+
+	// Families holds the result for each address family of a dual-stack endpoint.
+	Families map[string]CheckResult `json:"families,omitempty"`
+
+	// Fallback is the result of the check of the endpoint's fallback URL, made when it was down.
+	Fallback *CheckResult `json:"fallback,omitempty"`
+
+	// err is the error that caused the check to fail, kept for callers matching on it.
+	err error
+
+	// retry_after is the delay requested by the Retry-After header of a 429 or 503 response, when
+	// retry_after_ok is set.
+	retry_after    time.Duration
+	retry_after_ok bool
+
+	// head_rejected is set when the endpoint rejected a HEAD request and was checked with GET.
+	head_rejected bool
+
+	// backoff is how long the endpoint mustn't be checked again, set for rate-limited checks under
+	// the unknown policy.
+	backoff time.Duration
+
+	// skipped is set when the endpoint wasn't checked, while backing off or over the bandwidth cap
+	// of its domain.
+	skipped bool
+}
+
+// Up reports whether the check succeeded.
+func (result CheckResult) Up() bool {
+	return result.Status == StatusUp
+}
+
+// Available reports whether the check counts as available for the domain, which is the case for
+// successful and degraded checks.
+func (result CheckResult) Available() bool {
+	return result.Status == StatusUp || result.Status == StatusDegraded
+}
+
+// Err returns the error that caused the check to fail, or nil.
+func (result CheckResult) Err() error {
+	return result.err
+}
+
+// fail marks the result with status and the error that caused it, classified as kind.
+func (result *CheckResult) fail(status string, kind string, err error) {
+	result.Status = status
+	result.ErrorKind = kind
+	result.err = err
+	if err != nil {
+		result.Error = err.Error()
+	}
+}
+
+// ErrorKind classifies an error returned while sending a request or reading its response.
+func ErrorKind(err error) string {
+	var net_err net.Error
+	var certificate_err x509.CertificateInvalidError
+	var authority_err x509.UnknownAuthorityError
+	var hostname_err x509.HostnameError
+	var record_err tls.RecordHeaderError
+
+	switch {
+	case errors.Is(err, ErrBodyTooLarge):
+		return ErrorKindBodyTooLarge
+	case errors.Is(err, ErrTooManyRedirects):
+		return ErrorKindRedirect
+	case IsDNSError(err):
+		return ErrorKindDNS
+	case errors.Is(err, context.DeadlineExceeded):
+		return ErrorKindTimeout
+	case errors.As(err, &net_err) && net_err.Timeout():
+		return ErrorKindTimeout
+	case errors.As(err, &certificate_err), errors.As(err, &authority_err), errors.As(err, &hostname_err), errors.As(err, &record_err):
+		return ErrorKindTLS
+	default:
+		return ErrorKindConnection
+	}
+}
+
+// withRemoteIP returns a context recording the remote address of the connection used by a request
+// into result.
+func withRemoteIP(ctx context.Context, result *CheckResult) context.Context {
+	var mu sync.Mutex
+	return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			if info.Conn == nil {
+				return
+			}
+			host, _, err := net.SplitHostPort(info.Conn.RemoteAddr().String())
+			if err != nil {
+				return
+			}
+			mu.Lock()
+			result.RemoteIP = host
+			mu.Unlock()
+		},
+	})
+}
+
+// RecordResult is a method for a domain to aggregate the result of a check of one of its
+// endpoints, including the per-family results of dual-stack endpoints and the result of the
+// fallback check of a down endpoint.
+//
+// Returns immediately if the domain pointer passed is nil.
+func (domain *Domain) RecordResult(result CheckResult) {
+	if domain == nil {
+		return
+	}
+
+	switch result.Status {
+	case StatusUp:
+		domain.UpdateDomainStats(EndpointUp)
+	case StatusDegraded:
+		domain.UpdateDomainStats(EndpointUp)
+		domain.RecordDegraded()
+	case StatusUnknown:
+		domain.RecordUnknown()
+	default:
+		domain.UpdateDomainStats(EndpointDown)
+	}
+
+	domain.RecordBandwidth(result.BytesSent, result.BytesReceived)
+	if result.Status != StatusUnknown && result.Latency > 0 {
+		domain.RecordLatency(result.Latency)
+	}
+
+	for family, family_result := range result.Families {
+		domain.UpdateFamilyStats(family, family_result.Available())
+	}
+
+	if result.Fallback != nil {
+		domain.UpdateFallbackStats(result.Fallback.Available())
+	}
+}
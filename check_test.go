@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/go-playground/assert/v2"
+)
+
+func TestErrorKind(t *testing.T) {
+	cases := []struct {
+		name     string
+		err      error
+		expected string
+	}{
+		{
+			name:     "Body Too Large",
+			err:      ErrBodyTooLarge,
+			expected: ErrorKindBodyTooLarge,
+		},
+		{
+			name:     "DNS",
+			err:      fmt.Errorf("dial: %w", &net.DNSError{Err: "no such host", Name: "nonexistent.invalid"}),
+			expected: ErrorKindDNS,
+		},
+		{
+			name:     "Deadline",
+			err:      fmt.Errorf("request: %w", context.DeadlineExceeded),
+			expected: ErrorKindTimeout,
+		},
+		{
+			name:     "Network Timeout",
+			err:      &net.OpError{Op: "read", Err: timeoutError{}},
+			expected: ErrorKindTimeout,
+		},
+		{
+			name:     "Unknown Authority",
+			err:      fmt.Errorf("get: %w", x509.UnknownAuthorityError{}),
+			expected: ErrorKindTLS,
+		},
+		{
+			name:     "Connection Refused",
+			err:      errors.New("connect: connection refused"),
+			expected: ErrorKindConnection,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, ErrorKind(tc.err), tc.expected)
+		})
+	}
+}
+
+// timeoutError is a net.Error reporting a timeout.
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestRecordResult(t *testing.T) {
+	var nil_domain *Domain
+	nil_domain.RecordResult(CheckResult{Status: StatusUp})
+
+	domain := &Domain{Name: "fetch.com"}
+	domain.RecordResult(CheckResult{Status: StatusUp})
+	domain.RecordResult(CheckResult{Status: StatusDown, ErrorKind: ErrorKindStatus})
+	domain.RecordResult(CheckResult{Status: StatusUnknown, ErrorKind: ErrorKindDNS})
+	domain.RecordResult(CheckResult{Status: StatusDegraded, ErrorKind: ErrorKindWarning})
+	domain.RecordResult(CheckResult{
+		Status: StatusDown,
+		Families: map[string]CheckResult{
+			FamilyIPv4: {Status: StatusUp},
+			FamilyIPv6: {Status: StatusDown},
+		},
+	})
+
+	assert.Equal(t, domain.UpCount, 2)
+	assert.Equal(t, domain.TotalRequests, 4)
+	assert.Equal(t, domain.UnknownCount, 1)
+	assert.Equal(t, domain.DegradedCount, 1)
+	assert.Equal(t, domain.FailedCount(), 2)
+	assert.Equal(t, *domain.Families[FamilyIPv4], FamilyStats{UpCount: 1, TotalRequests: 1})
+	assert.Equal(t, *domain.Families[FamilyIPv6], FamilyStats{UpCount: 0, TotalRequests: 1})
+}
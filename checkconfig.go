@@ -0,0 +1,182 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+)
+
+// CheckConfigUsage provides help text for the check-config subcommand.
+const CheckConfigUsage string = `
+USAGE: checkhealth check-config [flags] file
+
+	Parses and validates the configuration file with the same flags as the program, prints the
+	resolved endpoints, domains and effective settings, and exits without checking any
+	endpoint. It fails when the configuration is invalid, so configuration changes can be
+	linted in CI before they are deployed. With -next-config, the pending configuration is
+	validated and printed after it.
+`
+
+// RunCheckConfig is the entry point for the check-config subcommand. It loads the configuration
+// from args like the program does, creates the targets without checking them, and writes the
+// resolved configuration to w, followed by the pending configuration set with -next-config.
+func RunCheckConfig(args []string, w io.Writer) error {
+	config, err := LoadConfig(args)
+	if err != nil {
+		return err
+	}
+	next, err := LoadNextConfig(config)
+	if err != nil {
+		return err
+	}
+
+	targets, err := config.Endpoints.CreateNewTargets()
+	if err != nil {
+		return fmt.Errorf("invalid configuration: %v\n%s", err, CheckConfigUsage)
+	}
+	targets.Settings = config.Settings
+	if err := targets.WriteResolvedConfig(w); err != nil {
+		return err
+	}
+	if next == nil {
+		return nil
+	}
+
+	next_targets, err := next.Endpoints.CreateNewTargets()
+	if err != nil {
+		return fmt.Errorf("invalid next configuration %s: %v\n%s", config.NextConfig, err, CheckConfigUsage)
+	}
+	next_targets.Settings = next.Settings
+	if _, err := fmt.Fprintf(w, "\nNext configuration %s:\n\n", config.NextConfig); err != nil {
+		return err
+	}
+	return next_targets.WriteResolvedConfig(w)
+}
+
+// WriteResolvedConfig is a method for HealthCheckTargets that writes the effective settings, the
+// endpoints with their effective method, type and timeout, and the domains they are grouped in, in
+// a human readable format.
+func (target *HealthCheckTargets) WriteResolvedConfig(w io.Writer) error {
+	settings := target.Settings
+	var builder strings.Builder
+
+	concurrency := "1 worker (in series)"
+	switch tuner, _ := NewConcurrencyTuner(settings, settings.CheckInterval()); {
+	case tuner == nil:
+	case tuner.auto:
+		concurrency = fmt.Sprintf("auto, %d to %d workers", tuner.min, tuner.max)
+	case tuner.workers > 1:
+		concurrency = fmt.Sprintf("%d workers", tuner.workers)
+	}
+
+	builder.WriteString("Settings:\n")
+	fmt.Fprintf(&builder, "  output:       %s\n", settings.Output)
+	fmt.Fprintf(&builder, "  interval:     %s\n", settings.CheckInterval())
+	fmt.Fprintf(&builder, "  max latency:  %s\n", settings.MaxCheckLatency())
+	fmt.Fprintf(&builder, "  concurrency:  %s\n", concurrency)
+	if len(settings.CheckTypes) > 0 {
+		pools := []string{"one per type"}
+		for name, check_type := range settings.CheckTypes {
+			if check_type.Concurrency > 0 {
+				pools = append(pools, fmt.Sprintf("%s %d workers", name, check_type.Concurrency))
+			}
+		}
+		sort.Strings(pools[1:])
+		fmt.Fprintf(&builder, "  type pools:   %s\n", strings.Join(pools, ", "))
+	}
+	fmt.Fprintf(&builder, "  align:        %t\n", settings.Align)
+	fmt.Fprintf(&builder, "  listen:       %s\n", orNone(settings.Listen))
+	fmt.Fprintf(&builder, "  state file:   %s\n", orNone(settings.StateFile))
+	if len(settings.AvailabilityPeriods) > 0 {
+		fmt.Fprintf(&builder, "  periods:      %s (%s)\n", strings.Join(settings.AvailabilityPeriods, ", "), settings.AvailabilityLocation())
+	}
+	sinks := make([]string, len(settings.Sinks))
+	for i, sink := range settings.Sinks {
+		sinks[i] = sink.Type
+	}
+	fmt.Fprintf(&builder, "  sinks:        %s\n", orNone(strings.Join(sinks, ", ")))
+	notifiers := make([]string, len(settings.Notifiers))
+	for i, notifier := range settings.Notifiers {
+		notifiers[i] = notifier.Type
+	}
+	fmt.Fprintf(&builder, "  notifiers:    %s\n", orNone(strings.Join(notifiers, ", ")))
+
+	endpoints := Endpoints{}
+	if target.Endpoints != nil {
+		endpoints = *target.Endpoints
+	}
+	fmt.Fprintf(&builder, "\nEndpoints (%d):\n", len(endpoints))
+	for _, endpoint := range endpoints {
+		fmt.Fprintf(&builder, "  %s\n", endpoint.Name)
+
+		check_type := endpoint.checkType()
+		if check_type == EndpointTypeHTTP {
+			method := endpoint.Method
+			if method == "" {
+				method = http.MethodGet
+			}
+			if endpoint.PreferHead {
+				method += " (HEAD preferred)"
+			}
+			fmt.Fprintf(&builder, "    %s %s\n", method, endpoint.Url)
+		} else {
+			fmt.Fprintf(&builder, "    %s\n", endpoint.Url)
+		}
+		if endpoint.FallbackUrl != "" {
+			fmt.Fprintf(&builder, "    fallback %s\n", endpoint.FallbackUrl)
+		}
+		if len(endpoint.TLSAcceptNames) > 0 {
+			fmt.Fprintf(&builder, "    WARNING: accepts certificates valid for %s instead of the verified name\n", strings.Join(endpoint.TLSAcceptNames, ", "))
+		}
+		if endpoint.TLSInsecureSkipVerify {
+			fmt.Fprintf(&builder, "    WARNING: doesn't verify the server certificate\n")
+		}
+		timeout := endpoint.checkTimeout(settings.MaxCheckLatency())
+		if threshold := endpoint.latencyThreshold(settings.MaxCheckLatency()); threshold < timeout {
+			fmt.Fprintf(&builder, "    type %s, timeout %s, max latency %s, domain %s\n", check_type, timeout, threshold, endpoint.Domain.Name)
+		} else {
+			fmt.Fprintf(&builder, "    type %s, timeout %s, domain %s\n", check_type, timeout, endpoint.Domain.Name)
+		}
+	}
+
+	counts := map[*Domain]int{}
+	for _, endpoint := range endpoints {
+		counts[endpoint.Domain]++
+	}
+	domains := 0
+	for domain := target.Domains; domain != nil; domain = domain.Next {
+		domains++
+	}
+	fmt.Fprintf(&builder, "\nDomains (%d):\n", domains)
+	for domain := target.Domains; domain != nil; domain = domain.Next {
+		plural := "s"
+		if counts[domain] == 1 {
+			plural = ""
+		}
+		fmt.Fprintf(&builder, "  %s (%d endpoint%s)\n", domain.Name, counts[domain], plural)
+	}
+
+	builder.WriteString("\nConfiguration OK, no endpoint was checked.\n")
+	_, err := io.WriteString(w, builder.String())
+	return err
+}
+
+// orNone returns value, or "none" when it is empty.
+func orNone(value string) string {
+	if value == "" {
+		return "none"
+	}
+	return value
+}
+
+func init() {
+	RegisterCommand(Command{
+		Name: "check-config",
+		Run: func(args []string) error {
+			return RunCheckConfig(args, os.Stdout)
+		},
+	})
+}
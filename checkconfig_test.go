@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-playground/assert/v2"
+)
+
+func TestRunCheckConfig(t *testing.T) {
+	invalid := filepath.Join(t.TempDir(), "invalid.yaml")
+	assert.Equal(t, os.WriteFile(invalid, []byte("- name: index\n  url: https://fetch.com/\n  success_when: status ==\n"), 0o600), nil)
+	insecure := filepath.Join(t.TempDir(), "insecure.yaml")
+	assert.Equal(t, os.WriteFile(insecure, []byte("- name: printer\n  url: https://10.0.9.20/\n  tls_insecure_skip_verify: true\n"), 0o600), nil)
+
+	cases := []struct {
+		name           string
+		args           []string
+		expectedOutput []string
+		expectedFail   bool
+	}{
+		{
+			name: "Resolved Configuration",
+			args: []string{"-interval", "30s", "-max-latency", "250ms", "config.yaml"},
+			expectedOutput: []string{
+				"  interval:     30s\n",
+				"  max latency:  250ms\n",
+				"Endpoints (4):\n",
+				"  fetch.com some post endpoint\n    POST https://fetch.com/some/post/endpoint\n    type http, timeout 250ms, domain fetch.com\n",
+				"Domains (2):\n  fetch.com (3 endpoints)\n  www.fetchrewards.com (1 endpoint)\n",
+			},
+		},
+		{
+			name:           "Insecure Endpoint",
+			args:           []string{insecure},
+			expectedOutput: []string{"  printer\n    GET https://10.0.9.20/\n    WARNING: doesn't verify the server certificate\n"},
+		},
+		{
+			name:         "Missing File",
+			args:         []string{},
+			expectedFail: true,
+		},
+		{
+			name:         "Invalid Flag",
+			args:         []string{"-interval", "fast", "config.yaml"},
+			expectedFail: true,
+		},
+		{
+			name:         "Invalid Endpoint",
+			args:         []string{invalid},
+			expectedFail: true,
+		},
+		{
+			name:           "Next Configuration",
+			args:           []string{"-next-config", insecure, "config.yaml"},
+			expectedOutput: []string{"Endpoints (4):\n", "\nNext configuration " + insecure + ":\n\nSettings:\n", "Endpoints (1):\n  printer\n"},
+		},
+		{
+			name:         "Invalid Next Configuration",
+			args:         []string{"-next-config", invalid, "config.yaml"},
+			expectedFail: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var output bytes.Buffer
+
+			err := RunCheckConfig(tc.args, &output)
+			if tc.expectedFail {
+				assert.NotEqual(t, err, nil)
+				return
+			}
+
+			assert.Equal(t, err, nil)
+			for _, expected := range tc.expectedOutput {
+				assert.Equal(t, strings.Contains(output.String(), expected), true)
+			}
+		})
+	}
+}
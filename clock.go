@@ -0,0 +1,53 @@
+package main
+
+import (
+	"time"
+)
+
+// Clock tells the time and waits for the scheduler of RunCheckHealth, so the scheduling of check
+// cycles can be driven deterministically by a fake clock in tests, or by another scheduler.
+// SystemClock is the wall clock. The checks themselves always time their requests with the wall
+// clock.
+type Clock interface {
+	Now() time.Time
+
+	// After returns a channel receiving the time once d has elapsed.
+	After(d time.Duration) <-chan time.Time
+
+	// NewTicker returns a Ticker ticking every d.
+	NewTicker(d time.Duration) Ticker
+}
+
+// Ticker delivers ticks at intervals on its channel, like a time.Ticker. Ticks are dropped when the
+// receiver falls behind.
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// SystemClock is the Clock of the wall clock, backed by the time package.
+var SystemClock Clock = systemClock{}
+
+// systemClock is the Clock of the wall clock.
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+func (systemClock) NewTicker(d time.Duration) Ticker {
+	return systemTicker{time.NewTicker(d)}
+}
+
+// systemTicker is the Ticker of the wall clock, a time.Ticker.
+type systemTicker struct {
+	*time.Ticker
+}
+
+func (ticker systemTicker) C() <-chan time.Time {
+	return ticker.Ticker.C
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-playground/assert/v2"
+)
+
+// fakeClock is a Clock whose time only moves forward with Advance, firing the timers and tickers
+// due by then.
+type fakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []*fakeWaiter
+}
+
+// fakeWaiter is a timer of a fakeClock, or a ticker when every is set.
+type fakeWaiter struct {
+	at    time.Time
+	every time.Duration
+	c     chan time.Time
+}
+
+func newFakeClock(now time.Time) *fakeClock {
+	return &fakeClock{now: now}
+}
+
+func (clock *fakeClock) Now() time.Time {
+	clock.mu.Lock()
+	defer clock.mu.Unlock()
+	return clock.now
+}
+
+func (clock *fakeClock) After(d time.Duration) <-chan time.Time {
+	clock.mu.Lock()
+	defer clock.mu.Unlock()
+
+	waiter := &fakeWaiter{at: clock.now.Add(d), c: make(chan time.Time, 1)}
+	if d <= 0 {
+		waiter.c <- clock.now
+		return waiter.c
+	}
+	clock.waiters = append(clock.waiters, waiter)
+	return waiter.c
+}
+
+func (clock *fakeClock) NewTicker(d time.Duration) Ticker {
+	clock.mu.Lock()
+	defer clock.mu.Unlock()
+
+	waiter := &fakeWaiter{at: clock.now.Add(d), every: d, c: make(chan time.Time, 1)}
+	clock.waiters = append(clock.waiters, waiter)
+	return &fakeTicker{clock: clock, waiter: waiter}
+}
+
+// Advance moves the time forward by d, firing the timers due and ticking the tickers, dropping the
+// ticks of tickers whose last tick wasn't received yet.
+func (clock *fakeClock) Advance(d time.Duration) {
+	clock.mu.Lock()
+	defer clock.mu.Unlock()
+
+	clock.now = clock.now.Add(d)
+	var pending []*fakeWaiter
+	for _, waiter := range clock.waiters {
+		for !waiter.at.After(clock.now) {
+			select {
+			case waiter.c <- waiter.at:
+			default:
+			}
+			if waiter.every == 0 {
+				break
+			}
+			waiter.at = waiter.at.Add(waiter.every)
+		}
+		if waiter.at.After(clock.now) {
+			pending = append(pending, waiter)
+		}
+	}
+	clock.waiters = pending
+}
+
+// AwaitWaiters blocks until n timers or tickers are pending.
+func (clock *fakeClock) AwaitWaiters(n int) {
+	for {
+		clock.mu.Lock()
+		pending := len(clock.waiters)
+		clock.mu.Unlock()
+		if pending >= n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// fakeTicker is a Ticker of a fakeClock.
+type fakeTicker struct {
+	clock  *fakeClock
+	waiter *fakeWaiter
+}
+
+func (ticker *fakeTicker) C() <-chan time.Time {
+	return ticker.waiter.c
+}
+
+func (ticker *fakeTicker) Stop() {
+	ticker.clock.mu.Lock()
+	defer ticker.clock.mu.Unlock()
+
+	for i, waiter := range ticker.clock.waiters {
+		if waiter == ticker.waiter {
+			ticker.clock.waiters = append(ticker.clock.waiters[:i], ticker.clock.waiters[i+1:]...)
+			return
+		}
+	}
+}
+
+func TestRunCheckHealthClock(t *testing.T) {
+	var checks int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&checks, 1)
+	}))
+	defer server.Close()
+
+	// wait for the checks of a cycle to be made
+	awaitChecks := func(expected int32) {
+		deadline := time.Now().Add(5 * time.Second)
+		for atomic.LoadInt32(&checks) < expected && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+		assert.Equal(t, atomic.LoadInt32(&checks), expected)
+	}
+
+	endpoints := Endpoints{{Name: "index", Url: server.URL}}
+	targets, err := endpoints.CreateNewTargets()
+	assert.Equal(t, err, nil)
+	targets.Settings.Interval = time.Minute
+
+	clock := newFakeClock(time.Now())
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		targets.RunCheckHealth(ctx, clock)
+		close(stopped)
+	}()
+
+	// the first cycle starts right away, and the next ones every interval of the clock
+	awaitChecks(1)
+	clock.Advance(30 * time.Second)
+	time.Sleep(10 * time.Millisecond)
+	assert.Equal(t, atomic.LoadInt32(&checks), int32(1))
+	clock.Advance(30 * time.Second)
+	awaitChecks(2)
+
+	// no cycle starts once the context is done
+	cancel()
+	<-stopped
+	clock.Advance(time.Minute)
+	assert.Equal(t, atomic.LoadInt32(&checks), int32(2))
+}
+
+func TestRunCheckHealthOnce(t *testing.T) {
+	var checks int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&checks, 1)
+	}))
+	defer server.Close()
+
+	endpoints := Endpoints{{Name: "index", Url: server.URL}}
+	targets, err := endpoints.CreateNewTargets()
+	assert.Equal(t, err, nil)
+	targets.Settings.Interval = time.Minute
+	targets.MaxCycles = 1
+
+	// a bounded run returns once its cycles are complete, without waiting for the next interval
+	stopped := make(chan struct{})
+	go func() {
+		targets.RunCheckHealth(context.Background(), newFakeClock(time.Now()))
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("RunCheckHealth didn't return after a single cycle")
+	}
+	assert.Equal(t, atomic.LoadInt32(&checks), int32(1))
+	assert.Equal(t, targets.Run.Report(time.Now(), nil).Cycles, 1)
+}
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultCheckInterval is the time between the start of two check cycles and DefaultMaxLatency is
+// the maximum latency of an endpoint before it's considered down.
+const (
+	DefaultCheckInterval time.Duration = 15 * time.Second
+	DefaultMaxLatency    time.Duration = 500 * time.Millisecond
+)
+
+// CheckInterval is a method for Settings that returns the interval setting, or
+// DefaultCheckInterval when it isn't set.
+func (settings Settings) CheckInterval() time.Duration {
+	if settings.Interval <= 0 {
+		return DefaultCheckInterval
+	}
+	return settings.Interval
+}
+
+// MaxCheckLatency is a method for Settings that returns the max_latency setting, or
+// DefaultMaxLatency when it isn't set.
+func (settings Settings) MaxCheckLatency() time.Duration {
+	if settings.MaxLatency <= 0 {
+		return DefaultMaxLatency
+	}
+	return settings.MaxLatency
+}
+
+// ConcurrencyAuto is the concurrency setting that lets a ConcurrencyTuner pick the number of
+// workers checking endpoints from the measured cycle durations.
+const ConcurrencyAuto string = "auto"
+
+// DefaultConcurrencyMin and DefaultConcurrencyMax bound the number of workers in the auto
+// concurrency mode when concurrency_min or concurrency_max aren't set.
+const (
+	DefaultConcurrencyMin int = 1
+	DefaultConcurrencyMax int = 64
+)
+
+// concurrencyTargetRatio is the fraction of the interval a check cycle aims to finish within in the
+// auto concurrency mode, leaving headroom for latency spikes.
+const concurrencyTargetRatio float64 = 0.5
+
+// domain_stats guards the statistics of every Domain, so they can be read while the results of a
+// cycle are recorded.
+var domain_stats sync.Mutex
+
+// ConcurrencyTuner decides how many workers check endpoints concurrently. With a fixed concurrency
+// it always returns the same number of workers. In the auto mode it observes the duration of each
+// cycle and adjusts the workers, within its bounds, so cycles finish comfortably within the
+// interval. Each adjustment is logged.
+type ConcurrencyTuner struct {
+	auto     bool
+	workers  int
+	min      int
+	max      int
+	interval time.Duration
+}
+
+// NewConcurrencyTuner creates a ConcurrencyTuner from the concurrency settings. An empty
+// concurrency checks endpoints in series. An error is returned if the settings are invalid.
+func NewConcurrencyTuner(settings Settings, interval time.Duration) (*ConcurrencyTuner, error) {
+	tuner := &ConcurrencyTuner{
+		workers:  1,
+		min:      settings.ConcurrencyMin,
+		max:      settings.ConcurrencyMax,
+		interval: interval,
+	}
+	if tuner.min <= 0 {
+		tuner.min = DefaultConcurrencyMin
+	}
+	if tuner.max <= 0 {
+		tuner.max = DefaultConcurrencyMax
+	}
+	if tuner.min > tuner.max {
+		return nil, fmt.Errorf("concurrency_min %d is greater than concurrency_max %d", tuner.min, tuner.max)
+	}
+
+	concurrency := strings.TrimSpace(settings.Concurrency)
+	switch concurrency {
+	case "":
+	case ConcurrencyAuto:
+		tuner.auto = true
+		tuner.workers = tuner.min
+	default:
+		workers, err := strconv.Atoi(concurrency)
+		if err != nil || workers <= 0 {
+			return nil, fmt.Errorf("unsupported concurrency %q, expected a positive number of workers or %q", settings.Concurrency, ConcurrencyAuto)
+		}
+		tuner.workers = workers
+	}
+
+	return tuner, nil
+}
+
+// Workers returns the number of workers to use for the next cycle.
+func (tuner *ConcurrencyTuner) Workers() int {
+	return tuner.workers
+}
+
+// Observe records the duration of a cycle that checked the provided number of endpoints and, in
+// the auto mode, adjusts the workers for the next cycle. Workers are added as soon as a cycle
+// exceeds its target duration, but only removed once the cycle would still finish in time with
+// half as many, so the tuner doesn't oscillate around the target.
+func (tuner *ConcurrencyTuner) Observe(cycle time.Duration, endpoints int) {
+	if !tuner.auto || cycle <= 0 {
+		return
+	}
+
+	target := time.Duration(float64(tuner.interval) * concurrencyTargetRatio)
+	// estimate the workers needed assuming cycle duration is inversely proportional to workers
+	needed := int((int64(tuner.workers)*int64(cycle) + int64(target) - 1) / int64(target))
+
+	workers := tuner.workers
+	if needed > tuner.workers {
+		workers = needed
+	} else if needed <= tuner.workers/2 {
+		workers = needed
+	}
+
+	// more workers than endpoints would be idle
+	upper := tuner.max
+	if endpoints > 0 && endpoints < upper {
+		upper = endpoints
+	}
+	if workers > upper {
+		workers = upper
+	}
+	if workers < tuner.min {
+		workers = tuner.min
+	}
+
+	if workers == tuner.workers {
+		if needed > workers && cycle > target {
+			log.Printf("WARNING: concurrency: cycle took %v, over its %v target, but workers are capped at %d", cycle.Round(time.Millisecond), target, workers)
+		}
+		return
+	}
+
+	direction := "increasing"
+	if workers < tuner.workers {
+		direction = "decreasing"
+	}
+	log.Printf("concurrency: cycle of %d endpoints took %v (target %v), %s workers from %d to %d", endpoints, cycle.Round(time.Millisecond), target, direction, tuner.workers, workers)
+	tuner.workers = workers
+}
+
+// CheckTypeSettings are the options of a type of endpoint check, in the check_types setting. With
+// check_types, the endpoints of every type are checked in a pool of their own, of Concurrency
+// workers, or of the workers of the concurrency setting when it is zero, so slow checks of one
+// type, such as SSH commands, can't starve the checks of the others. Timeout and MaxLatency are
+// the defaults of the endpoints of the type that don't set their own, MaxLatency being ignored
+// for endpoints with a lower timeout.
+type CheckTypeSettings struct {
+	Concurrency int           `yaml:"concurrency,omitempty"`
+	Timeout     time.Duration `yaml:"timeout,omitempty"`
+	MaxLatency  time.Duration `yaml:"max_latency,omitempty"`
+}
+
+// ValidateCheckTypes rejects the check_types of types that aren't compiled into the binary, and
+// negative options.
+func ValidateCheckTypes(check_types map[string]CheckTypeSettings) error {
+	for name, check_type := range check_types {
+		if name != EndpointTypeHTTP {
+			if _, err := LookupCheckType(name); err != nil {
+				return fmt.Errorf("check_types: %v", err)
+			}
+		}
+		if check_type.Concurrency < 0 || check_type.Timeout < 0 || check_type.MaxLatency < 0 {
+			return fmt.Errorf("check_types: the concurrency, timeout and max_latency of %s must not be negative", name)
+		}
+	}
+	return nil
+}
+
+// checkType returns the type of the endpoint's check, EndpointTypeHTTP when it doesn't set one.
+func (endpoint *Endpoint) checkType() string {
+	if endpoint.Type == "" {
+		return EndpointTypeHTTP
+	}
+	return endpoint.Type
+}
+
+// CheckEndpoints is a method for HealthCheckTargets that checks every endpoint once, using up to
+// workers concurrent workers, or a pool of workers per type of check with the check_types
+// setting, and returns the results in the order of the endpoints once all checks are complete.
+// Results aren't recorded, see RecordResults.
+func (target *HealthCheckTargets) CheckEndpoints(workers int, max_latency time.Duration) []CheckResult {
+	return target.checkEndpoints(context.Background(), workers, max_latency)
+}
+
+// checkEndpoints is CheckEndpoints, the endpoints not checked yet once ctx is done being skipped,
+// see checkEndpoint.
+func (target *HealthCheckTargets) checkEndpoints(ctx context.Context, workers int, max_latency time.Duration) []CheckResult {
+	endpoints := *target.Endpoints
+	results := make([]CheckResult, len(endpoints))
+	if len(target.Settings.CheckTypes) == 0 {
+		indexes := make([]int, len(endpoints))
+		for i := range indexes {
+			indexes[i] = i
+		}
+		checkPool(ctx, endpoints, indexes, results, workers, max_latency)
+		return results
+	}
+
+	// group the endpoints by type, in the order the types first appear
+	var types []string
+	pools := map[string][]int{}
+	for i := range endpoints {
+		check_type := endpoints[i].checkType()
+		if _, ok := pools[check_type]; !ok {
+			types = append(types, check_type)
+		}
+		pools[check_type] = append(pools[check_type], i)
+	}
+
+	var wait_group sync.WaitGroup
+	for _, check_type := range types {
+		pool_workers := workers
+		if concurrency := target.Settings.CheckTypes[check_type].Concurrency; concurrency > 0 {
+			pool_workers = concurrency
+		}
+
+		wait_group.Add(1)
+		go func(indexes []int, workers int) {
+			defer wait_group.Done()
+			checkPool(ctx, endpoints, indexes, results, workers, max_latency)
+		}(pools[check_type], pool_workers)
+	}
+	wait_group.Wait()
+
+	return results
+}
+
+// checkEndpoint checks the endpoint with ctx. When ctx is already done, the endpoint isn't
+// requested and its check is skipped and recorded as unknown.
+func checkEndpoint(ctx context.Context, endpoint *Endpoint, max_latency time.Duration) CheckResult {
+	if err := ctx.Err(); err != nil {
+		result := CheckResult{Endpoint: endpoint.Name, Url: endpoint.Url}
+		result.fail(StatusUnknown, "", fmt.Errorf("skipped: %v", err))
+		result.skipped = true
+		return result
+	}
+	return endpoint.GetEndpointHealthContext(ctx, max_latency)
+}
+
+// checkPool checks the endpoints at indexes once, using up to workers concurrent workers, and
+// stores their results at the same indexes of results.
+func checkPool(ctx context.Context, endpoints Endpoints, indexes []int, results []CheckResult, workers int, max_latency time.Duration) {
+	if workers <= 1 {
+		for _, i := range indexes {
+			results[i] = checkEndpoint(ctx, &endpoints[i], max_latency)
+		}
+		return
+	}
+
+	queue := make(chan int)
+	var wait_group sync.WaitGroup
+	for worker := 0; worker < workers; worker++ {
+		wait_group.Add(1)
+		go func() {
+			defer wait_group.Done()
+			for i := range queue {
+				results[i] = checkEndpoint(ctx, &endpoints[i], max_latency)
+			}
+		}()
+	}
+
+	for _, i := range indexes {
+		queue <- i
+	}
+	close(queue)
+	wait_group.Wait()
+}
+
+// RecordResults is a method for HealthCheckTargets that aggregates the results returned by
+// CheckEndpoints into the domains of their endpoints, including their latency_windows and
+// availability_periods, and advances the endpoints' state machines.
+// The state transitions are returned.
+func (target *HealthCheckTargets) RecordResults(results []CheckResult) []StateTransition {
+	var transitions []StateTransition
+	location := target.Settings.AvailabilityLocation()
+	for i, result := range results {
+		endpoint := &(*target.Endpoints)[i]
+		endpoint.Domain.RecordResult(result)
+		if result.Status != StatusUnknown && result.Latency > 0 {
+			endpoint.Domain.RecordWindowLatency(result.FinishedAt, result.Latency, target.Settings.LatencyWindows)
+		}
+		if result.Status != StatusUnknown {
+			endpoint.Domain.UpdatePeriodStats(result.FinishedAt, result.Available(), target.Settings.AvailabilityPeriods, location)
+		}
+
+		if endpoint.State == nil {
+			endpoint.State = NewEndpointState(endpoint.DownAfter, endpoint.ErrorHistory)
+		}
+		if transition, changed := endpoint.State.Record(result, result.FinishedAt); changed {
+			transition.Labels = endpoint.Labels
+			transitions = append(transitions, transition)
+		}
+	}
+	return transitions
+}
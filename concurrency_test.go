@@ -0,0 +1,291 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-playground/assert/v2"
+)
+
+func TestNewConcurrencyTuner(t *testing.T) {
+	cases := []struct {
+		name            string
+		settings        Settings
+		expectedWorkers int
+		expectedAuto    bool
+		expectedError   bool
+	}{
+		{
+			name:            "Default Series",
+			settings:        Settings{},
+			expectedWorkers: 1,
+		},
+		{
+			name:            "Fixed Workers",
+			settings:        Settings{Concurrency: "8"},
+			expectedWorkers: 8,
+		},
+		{
+			name:            "Auto Starts At Minimum",
+			settings:        Settings{Concurrency: ConcurrencyAuto, ConcurrencyMin: 4},
+			expectedWorkers: 4,
+			expectedAuto:    true,
+		},
+		{
+			name:          "Invalid Concurrency",
+			settings:      Settings{Concurrency: "many"},
+			expectedError: true,
+		},
+		{
+			name:          "Zero Workers",
+			settings:      Settings{Concurrency: "0"},
+			expectedError: true,
+		},
+		{
+			name:          "Inverted Bounds",
+			settings:      Settings{Concurrency: ConcurrencyAuto, ConcurrencyMin: 10, ConcurrencyMax: 2},
+			expectedError: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			tuner, err := NewConcurrencyTuner(tc.settings, DefaultCheckInterval)
+			assert.Equal(t, err != nil, tc.expectedError)
+			if err != nil {
+				return
+			}
+			assert.Equal(t, tuner.Workers(), tc.expectedWorkers)
+			assert.Equal(t, tuner.auto, tc.expectedAuto)
+		})
+	}
+}
+
+func TestConcurrencyTunerObserve(t *testing.T) {
+	cases := []struct {
+		name            string
+		settings        Settings
+		workers         int
+		cycle           time.Duration
+		endpoints       int
+		expectedWorkers int
+	}{
+		{
+			name:            "Fixed Concurrency Isn't Tuned",
+			settings:        Settings{Concurrency: "2"},
+			workers:         2,
+			cycle:           time.Minute,
+			endpoints:       100,
+			expectedWorkers: 2,
+		},
+		{
+			name:            "Slow Cycle Adds Workers",
+			settings:        Settings{Concurrency: ConcurrencyAuto},
+			workers:         2,
+			cycle:           30 * time.Second,
+			endpoints:       100,
+			expectedWorkers: 8,
+		},
+		{
+			name:            "Capped At Maximum",
+			settings:        Settings{Concurrency: ConcurrencyAuto, ConcurrencyMax: 4},
+			workers:         2,
+			cycle:           30 * time.Second,
+			endpoints:       100,
+			expectedWorkers: 4,
+		},
+		{
+			name:            "Capped At Endpoints",
+			settings:        Settings{Concurrency: ConcurrencyAuto},
+			workers:         2,
+			cycle:           30 * time.Second,
+			endpoints:       5,
+			expectedWorkers: 5,
+		},
+		{
+			name:            "Comfortable Cycle Keeps Workers",
+			settings:        Settings{Concurrency: ConcurrencyAuto},
+			workers:         8,
+			cycle:           5 * time.Second,
+			endpoints:       100,
+			expectedWorkers: 8,
+		},
+		{
+			name:            "Fast Cycle Removes Workers",
+			settings:        Settings{Concurrency: ConcurrencyAuto},
+			workers:         8,
+			cycle:           time.Second,
+			endpoints:       100,
+			expectedWorkers: 2,
+		},
+		{
+			name:            "Kept At Minimum",
+			settings:        Settings{Concurrency: ConcurrencyAuto, ConcurrencyMin: 4},
+			workers:         8,
+			cycle:           time.Second,
+			endpoints:       100,
+			expectedWorkers: 4,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			tuner, err := NewConcurrencyTuner(tc.settings, DefaultCheckInterval)
+			if err != nil {
+				t.Fatalf("failed to create tuner: %v", err)
+			}
+			tuner.workers = tc.workers
+
+			tuner.Observe(tc.cycle, tc.endpoints)
+			assert.Equal(t, tuner.Workers(), tc.expectedWorkers)
+		})
+	}
+}
+
+func TestCheckEndpointsConcurrently(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+	}))
+	defer server.Close()
+
+	var endpoints Endpoints
+	for i := 0; i < 10; i++ {
+		endpoints = append(endpoints, Endpoint{Name: "slow", Url: server.URL})
+	}
+	targets, err := endpoints.CreateNewTargets()
+	if err != nil {
+		t.Fatalf("failed to create targets: %v", err)
+	}
+
+	start := time.Now()
+	results := targets.CheckEndpoints(10, DefaultMaxLatency)
+
+	// in series, the checks would take at least a second
+	assert.Equal(t, time.Since(start) < time.Second, true)
+	assert.Equal(t, len(results), 10)
+
+	targets.RecordResults(results)
+	assert.Equal(t, targets.Domains.UpCount, 10)
+	assert.Equal(t, targets.Domains.TotalRequests, 10)
+}
+
+func TestParseConfigYAMLConcurrency(t *testing.T) {
+	config, err := ParseConfig([]byte(strings.Join([]string{
+		"concurrency: 8",
+		"concurrency_max: 16",
+		"endpoints:",
+		"  - name: index",
+		"    url: https://example.com/",
+	}, "\n")))
+	if err != nil {
+		t.Fatalf("failed to parse config: %v", err)
+	}
+
+	assert.Equal(t, config.Concurrency, "8")
+	assert.Equal(t, config.ConcurrencyMax, 16)
+}
+
+func TestCheckEndpointsByType(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	// a TCP server that never answers, so raw-tcp checks run until their timeout
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Equal(t, err, nil)
+	defer listener.Close()
+	go func() {
+		var conns []net.Conn
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				for _, conn := range conns {
+					conn.Close()
+				}
+				return
+			}
+			conns = append(conns, conn)
+		}
+	}()
+
+	var endpoints Endpoints
+	for i := 0; i < 4; i++ {
+		endpoints = append(endpoints, Endpoint{Name: "silent", Url: "tcp://" + listener.Addr().String(), Type: EndpointTypeRawTCP, ExpectPrefix: "220", Timeout: 200 * time.Millisecond})
+	}
+	for i := 0; i < 4; i++ {
+		endpoints = append(endpoints, Endpoint{Name: "fast", Url: server.URL})
+	}
+	targets, err := endpoints.CreateNewTargets()
+	assert.Equal(t, err, nil)
+	targets.Settings.CheckTypes = map[string]CheckTypeSettings{EndpointTypeRawTCP: {Concurrency: 2}}
+
+	start := time.Now()
+	results := targets.CheckEndpoints(1, time.Second)
+
+	// the raw-tcp checks run two at a time, while the HTTP checks don't wait for them
+	assert.Equal(t, time.Since(start) >= 400*time.Millisecond, true)
+	assert.Equal(t, time.Since(start) < 800*time.Millisecond, true)
+	for _, result := range results[4:] {
+		assert.Equal(t, result.Status, StatusUp)
+		assert.Equal(t, result.FinishedAt.Sub(start) < 200*time.Millisecond, true)
+	}
+	for _, result := range results[:4] {
+		assert.Equal(t, result.ErrorKind, ErrorKindTimeout)
+	}
+}
+
+func TestValidateCheckTypes(t *testing.T) {
+	cases := []struct {
+		name         string
+		check_types  map[string]CheckTypeSettings
+		expectedFail bool
+	}{
+		{name: "No Check Types", check_types: nil},
+		{name: "HTTP And Raw TCP", check_types: map[string]CheckTypeSettings{EndpointTypeHTTP: {Concurrency: 32}, EndpointTypeRawTCP: {Concurrency: 2, Timeout: 10 * time.Second}}},
+		{name: "Unknown Type", check_types: map[string]CheckTypeSettings{"exec": {Concurrency: 2}}, expectedFail: true},
+		{name: "Negative Concurrency", check_types: map[string]CheckTypeSettings{EndpointTypeRawTCP: {Concurrency: -1}}, expectedFail: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ValidateCheckTypes(tc.check_types)
+			if tc.expectedFail {
+				assert.NotEqual(t, err, nil)
+			} else {
+				assert.Equal(t, err, nil)
+			}
+		})
+	}
+}
+
+func TestCheckTypeDefaults(t *testing.T) {
+	config, err := ParseConfig([]byte(strings.Join([]string{
+		"interval: 1m",
+		"check_types:",
+		"  raw-tcp:",
+		"    concurrency: 2",
+		"    timeout: 10s",
+		"    max_latency: 5s",
+		"endpoints:",
+		"  - name: index",
+		"    url: https://example.com/",
+		"  - name: smtp",
+		"    url: tcp://mx1.example.com:25",
+		"    type: raw-tcp",
+		"  - name: imap",
+		"    url: tcp://mx1.example.com:143",
+		"    type: raw-tcp",
+		"    timeout: 3s",
+	}, "\n")))
+	assert.Equal(t, err, nil)
+	assert.Equal(t, config.ApplySettings(), nil)
+
+	assert.Equal(t, config.Endpoints[0].Timeout, time.Duration(0))
+	assert.Equal(t, config.Endpoints[1].Timeout, 10*time.Second)
+	assert.Equal(t, config.Endpoints[1].MaxLatency, 5*time.Second)
+	assert.Equal(t, config.Endpoints[2].Timeout, 3*time.Second)
+	assert.Equal(t, config.Endpoints[2].MaxLatency, time.Duration(0))
+}
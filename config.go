@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"gopkg.in/yaml.v2"
+)
+
+// MaxConfigSize, MaxConfigDepth and MaxConfigNodes bound the configurations accepted by
+// ParseConfig. The depth is the nesting of mappings and lists, and the nodes are counted after
+// aliases are expanded, so a small document can't expand into a huge configuration.
+const (
+	MaxConfigSize  int = 4 << 20
+	MaxConfigDepth int = 32
+	MaxConfigNodes int = 1 << 20
+)
+
+// ErrConfigTooLarge is returned by ParseConfig when a configuration exceeds MaxConfigSize.
+var ErrConfigTooLarge = errors.New("configuration too large")
+
+// ParseConfig parses a YAML configuration, which is either a plain list of endpoints or a mapping
+// containing the settings and an endpoints list. It is safe to use on untrusted input, such as a
+// configuration fetched from a remote source: configurations larger than MaxConfigSize, containing
+// NUL bytes, nested deeper than MaxConfigDepth or expanding to more than MaxConfigNodes are
+// rejected with an error.
+//
+// The returned configuration isn't validated, which is done by ValidateConfig and
+// Config.ApplySettings.
+func ParseConfig(loaded_config []byte) (config Config, err error) {
+	if len(loaded_config) > MaxConfigSize {
+		return Config{}, fmt.Errorf("%w: %d bytes exceeds the limit of %d bytes", ErrConfigTooLarge, len(loaded_config), MaxConfigSize)
+	}
+	if position := bytes.IndexByte(loaded_config, 0); position >= 0 {
+		return Config{}, fmt.Errorf("unexpected NUL byte at offset %d", position)
+	}
+
+	// the YAML decoder reports its own errors, but a panic on malformed input must not take down
+	// the caller
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			config, err = Config{}, fmt.Errorf("failed to parse configuration: %v", recovered)
+		}
+	}()
+
+	// determine the shape of the document before unmarshaling it into Config
+	var document interface{}
+	if err := yaml.Unmarshal(loaded_config, &document); err != nil {
+		return Config{}, err
+	}
+	nodes := 0
+	if err := checkConfigNode(document, 1, &nodes); err != nil {
+		return Config{}, err
+	}
+
+	switch document.(type) {
+	case []interface{}:
+		if err := yaml.Unmarshal(loaded_config, &config.Endpoints); err != nil {
+			return Config{}, err
+		}
+	case map[interface{}]interface{}:
+		if err := yaml.Unmarshal(loaded_config, &config); err != nil {
+			return Config{}, err
+		}
+	default:
+		return Config{}, fmt.Errorf("expected a list of endpoints or a mapping with an endpoints list")
+	}
+
+	return config, nil
+}
+
+// checkConfigNode walks a decoded YAML document, returning an error as soon as it is nested deeper
+// than MaxConfigDepth or nodes exceeds MaxConfigNodes.
+func checkConfigNode(node interface{}, depth int, nodes *int) error {
+	*nodes++
+	if *nodes > MaxConfigNodes {
+		return fmt.Errorf("configuration exceeds %d values", MaxConfigNodes)
+	}
+
+	switch value := node.(type) {
+	case []interface{}:
+		if depth > MaxConfigDepth {
+			return fmt.Errorf("configuration is nested deeper than %d levels", MaxConfigDepth)
+		}
+		for _, item := range value {
+			if err := checkConfigNode(item, depth+1, nodes); err != nil {
+				return err
+			}
+		}
+	case map[interface{}]interface{}:
+		if depth > MaxConfigDepth {
+			return fmt.Errorf("configuration is nested deeper than %d levels", MaxConfigDepth)
+		}
+		for key, item := range value {
+			if err := checkConfigNode(key, depth+1, nodes); err != nil {
+				return err
+			}
+			if err := checkConfigNode(item, depth+1, nodes); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// readConfigFile loads a configuration file into memory, reading at most one byte more than
+// MaxConfigSize so ParseConfig rejects oversized files without loading them entirely.
+func readConfigFile(path string) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return io.ReadAll(io.LimitReader(file, int64(MaxConfigSize)+1))
+}
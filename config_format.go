@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ConfigFormatYAML, ConfigFormatJSON and ConfigFormatTOML are the formats of the configuration
+// file, selected with the -format flag or detected from the extension of the file.
+const (
+	ConfigFormatYAML string = "yaml"
+	ConfigFormatJSON string = "json"
+	ConfigFormatTOML string = "toml"
+)
+
+// ConfigFormat converts a configuration file of another format into the YAML read by ParseConfig,
+// so every format shares the same schema and validation.
+type ConfigFormat struct {
+	Name string
+
+	// Extensions are the file extensions detected as the format, including the dot.
+	Extensions []string
+
+	// Convert returns the YAML equivalent of a configuration in the format.
+	Convert func(loaded_config []byte) ([]byte, error)
+
+	// KeepsLines reports whether the lines of the converted YAML are those of the original file,
+	// so the problems reported by ValidateConfig can point to them.
+	KeepsLines bool
+}
+
+// config_formats holds the configuration formats registered by the files compiled into the binary.
+var config_formats = struct {
+	sync.Mutex
+	formats map[string]ConfigFormat
+}{
+	formats: map[string]ConfigFormat{},
+}
+
+// RegisterConfigFormat makes a configuration format available to LoadConfig and records it as a
+// feature. It is intended to be called from init functions.
+func RegisterConfigFormat(format ConfigFormat) {
+	RegisterFeature(FeatureConfigFormat, format.Name)
+
+	config_formats.Lock()
+	defer config_formats.Unlock()
+	config_formats.formats[format.Name] = format
+}
+
+// LookupConfigFormat returns the configuration format of a file: the registered format named
+// name, or when name is empty the format registered for the extension of path, YAML by default.
+func LookupConfigFormat(path string, name string) (ConfigFormat, error) {
+	config_formats.Lock()
+	defer config_formats.Unlock()
+
+	if name != "" {
+		format, ok := config_formats.formats[strings.ToLower(name)]
+		if !ok {
+			names := make([]string, 0, len(config_formats.formats))
+			for existing := range config_formats.formats {
+				names = append(names, strconv.Quote(existing))
+			}
+			sort.Strings(names)
+			return ConfigFormat{}, fmt.Errorf("unsupported configuration format %q, expected one of %s", name, strings.Join(names, ", "))
+		}
+		return format, nil
+	}
+
+	extension := strings.ToLower(filepath.Ext(path))
+	for _, format := range config_formats.formats {
+		for _, existing := range format.Extensions {
+			if existing == extension {
+				return format, nil
+			}
+		}
+	}
+	return config_formats.formats[ConfigFormatYAML], nil
+}
+
+// convertJSONConfig converts a JSON configuration into YAML. JSON is mostly a subset of YAML, so
+// the document is kept as is, line for line, except for its strings: escapes such as "\/" and
+// surrogate pairs are valid JSON but not YAML, so every string is quoted again in a form both
+// accept.
+func convertJSONConfig(loaded_config []byte) ([]byte, error) {
+	if !json.Valid(loaded_config) {
+		var document interface{}
+		err := json.Unmarshal(loaded_config, &document)
+		if syntax_err, ok := err.(*json.SyntaxError); ok {
+			line := 1 + bytes.Count(loaded_config[:syntax_err.Offset], []byte("\n"))
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		return nil, err
+	}
+
+	var converted bytes.Buffer
+	converted.Grow(len(loaded_config))
+	for i := 0; i < len(loaded_config); i++ {
+		if loaded_config[i] != '"' {
+			converted.WriteByte(loaded_config[i])
+			continue
+		}
+
+		// the document is valid, so the string ends at the first quote that isn't escaped
+		end := i + 1
+		for loaded_config[end] != '"' {
+			if loaded_config[end] == '\\' {
+				end++
+			}
+			end++
+		}
+		var value string
+		if err := json.Unmarshal(loaded_config[i:end+1], &value); err != nil {
+			return nil, err
+		}
+		converted.WriteString(strconv.Quote(value))
+		i = end
+	}
+	return converted.Bytes(), nil
+}
+
+// withoutLines returns the problems of a configuration converted from a format that doesn't keep
+// its lines, without the lines of the converted YAML, which don't match those of the file.
+func withoutLines(err error) error {
+	problems, ok := err.(ConfigErrors)
+	if !ok {
+		return err
+	}
+	stripped := make(ConfigErrors, len(problems))
+	for i, problem := range problems {
+		stripped[i] = ConfigProblem{Message: problem.Message, Endpoint: problem.Endpoint}
+	}
+	return stripped
+}
+
+func init() {
+	// built-in configuration formats that are always compiled in
+	RegisterConfigFormat(ConfigFormat{
+		Name:       ConfigFormatYAML,
+		Extensions: []string{".yaml", ".yml"},
+		Convert: func(loaded_config []byte) ([]byte, error) {
+			return loaded_config, nil
+		},
+		KeepsLines: true,
+	})
+	RegisterConfigFormat(ConfigFormat{
+		Name:       ConfigFormatJSON,
+		Extensions: []string{".json"},
+		Convert:    convertJSONConfig,
+		KeepsLines: true,
+	})
+}
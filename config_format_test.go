@@ -0,0 +1,115 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-playground/assert/v2"
+)
+
+func TestLookupConfigFormat(t *testing.T) {
+	cases := []struct {
+		name           string
+		path           string
+		format         string
+		expectedFormat string
+		expectedFail   bool
+	}{
+		{name: "YAML Extension", path: "config.yaml", expectedFormat: ConfigFormatYAML},
+		{name: "Short YAML Extension", path: "config.yml", expectedFormat: ConfigFormatYAML},
+		{name: "JSON Extension", path: "config.JSON", expectedFormat: ConfigFormatJSON},
+		{name: "Unknown Extension", path: "endpoints.conf", expectedFormat: ConfigFormatYAML},
+		{name: "Flag Overrides Extension", path: "endpoints.conf", format: "json", expectedFormat: ConfigFormatJSON},
+		{name: "Unsupported Flag", path: "config.yaml", format: "xml", expectedFail: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			format, err := LookupConfigFormat(tc.path, tc.format)
+			assert.Equal(t, err != nil, tc.expectedFail)
+			assert.Equal(t, format.Name, tc.expectedFormat)
+		})
+	}
+}
+
+func TestConvertJSONConfig(t *testing.T) {
+	cases := []struct {
+		name         string
+		config       string
+		expected     Endpoints
+		expectedFail bool
+	}{
+		{
+			name:     "Plain List",
+			config:   "[\n\t{\"name\": \"index\", \"url\": \"https://fetch.com/\", \"method\": \"GET\"}\n]",
+			expected: Endpoints{{Name: "index", Url: "https://fetch.com/", Method: "GET"}},
+		},
+		{
+			name:     "Escapes Only Valid In JSON",
+			config:   `[{"name": "smile 😀", "url": "https:\/\/fetch.com\/"}]`,
+			expected: Endpoints{{Name: "smile \U0001F600", Url: "https://fetch.com/"}},
+		},
+		{
+			name:     "Mapping With Settings",
+			config:   `{"interval": "1m", "endpoints": [{"name": "say \"hi\"", "url": "https://fetch.com/"}]}`,
+			expected: Endpoints{{Name: `say "hi"`, Url: "https://fetch.com/"}},
+		},
+		{
+			name:         "Syntax Error",
+			config:       "[\n  {\"name\": \"index\",}\n]",
+			expectedFail: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			converted, err := convertJSONConfig([]byte(tc.config))
+			if tc.expectedFail {
+				assert.NotEqual(t, err, nil)
+				assert.Equal(t, strings.HasPrefix(err.Error(), "line 2: "), true)
+				return
+			}
+			assert.Equal(t, err, nil)
+
+			// the strings are quoted again without moving anything to another line
+			assert.Equal(t, strings.Count(string(converted), "\n"), strings.Count(tc.config, "\n"))
+
+			config, err := ParseConfig(converted)
+			assert.Equal(t, err, nil)
+			assert.Equal(t, config.Endpoints, tc.expected)
+		})
+	}
+}
+
+func TestLoadConfigJSON(t *testing.T) {
+	dir := t.TempDir()
+	valid := filepath.Join(dir, "config.json")
+	assert.Equal(t, os.WriteFile(valid, []byte(`{
+  "interval": "30s",
+  "endpoints": [
+    {"name": "index", "url": "https://fetch.com/"}
+  ]
+}
+`), 0o600), nil)
+	invalid := filepath.Join(dir, "endpoints.conf")
+	assert.Equal(t, os.WriteFile(invalid, []byte(`[
+  {"name": "index", "url": "https://fetch.com/"},
+  {"name": "careers", "url": "https://fetch.com/careers", "methd": "POST"}
+]
+`), 0o600), nil)
+
+	config, err := LoadConfig([]string{valid})
+	assert.Equal(t, err, nil)
+	assert.Equal(t, config.Interval.String(), "30s")
+	assert.Equal(t, len(config.Endpoints), 1)
+
+	// the extension isn't detected, and unknown fields are reported with their line in the file
+	_, err = LoadConfig([]string{"-format", "json", invalid})
+	assert.NotEqual(t, err, nil)
+	assert.Equal(t, strings.Contains(err.Error(), "line 3: unknown endpoint field methd"), true)
+
+	_, err = LoadConfig([]string{"-format", "xml", invalid})
+	assert.NotEqual(t, err, nil)
+}
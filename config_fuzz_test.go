@@ -0,0 +1,38 @@
+//go:build go1.18
+// +build go1.18
+
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+// FuzzParseConfig checks ParseConfig never panics and enforces its limits on arbitrary input. Run
+// it with:
+//
+//	go test -run '^$' -fuzz FuzzParseConfig
+func FuzzParseConfig(f *testing.F) {
+	if sample, err := os.ReadFile("config.yaml"); err == nil {
+		f.Add(sample)
+	}
+	f.Add([]byte("output: json\nconcurrency: auto\nendpoints:\n  - name: example\n    url: https://example.com/\n"))
+	f.Add([]byte("- name: a\n  url: https://example.com/\n  headers: &h {x: y}\n- name: b\n  url: https://example.com/\n  headers: *h\n"))
+	f.Add([]byte(strings.Repeat("[", 64) + strings.Repeat("]", 64)))
+	f.Add([]byte("a: &a [x, x]\nb: &b [*a, *a]\nendpoints: [*b]\n"))
+	f.Add([]byte("- name: \x00\n"))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		config, err := ParseConfig(data)
+		if err != nil {
+			return
+		}
+		if len(data) > MaxConfigSize {
+			t.Fatalf("accepted a configuration of %d bytes", len(data))
+		}
+		if len(config.Endpoints) > MaxConfigNodes {
+			t.Fatalf("accepted %d endpoints", len(config.Endpoints))
+		}
+	})
+}
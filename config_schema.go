@@ -0,0 +1,245 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// SchemaUsage provides help text for the schema subcommand.
+const SchemaUsage string = `
+USAGE: checkhealth schema
+
+	Prints a JSON Schema describing the configuration file format, so generated configurations
+	can be validated before they are deployed. The schema is generated from the configuration
+	types compiled into the binary.
+`
+
+// ConfigSchemaID is the identifier of the configuration file JSON Schema.
+const ConfigSchemaID string = "https://github.com/gpjservais/LetsCheckHealth/config_schema.json"
+
+// durationPattern matches the durations accepted by time.ParseDuration, such as 250ms or 1m30s.
+const durationPattern string = `^-?(0|([0-9]+(\.[0-9]*)?(ns|us|µs|ms|s|m|h))+)$`
+
+// schema_overrides refines the schema generated for fields whose Go type is broader than the
+// values they accept. They are keyed by the Go type name and the YAML name of the field.
+var schema_overrides = map[string]map[string]interface{}{
+	"Settings.output": {
+		"type": "string",
+		"enum": []string{OutputText, OutputJSON, OutputJUnit},
+	},
+	"Settings.log_level": {
+		"type": "string",
+		"enum": []string{LogLevelDebug, LogLevelInfo, LogLevelWarn, LogLevelError},
+	},
+	"Settings.log_format": {
+		"type": "string",
+		"enum": []string{LogFormatText, LogFormatJSON},
+	},
+	"Settings.concurrency": {
+		"oneOf": []interface{}{
+			map[string]interface{}{"type": "integer", "minimum": 1},
+			map[string]interface{}{"type": "string", "pattern": "^(" + ConcurrencyAuto + "|[1-9][0-9]*)$"},
+		},
+	},
+	"Settings.dns_failure": {
+		"type": "string",
+		"enum": []string{DNSFailureDown, DNSFailureRetry, DNSFailureUnknown},
+	},
+	"Endpoint.dns_failure": {
+		"type": "string",
+		"enum": []string{DNSFailureDown, DNSFailureRetry, DNSFailureUnknown},
+	},
+	"Settings.bandwidth_exceeded": {
+		"type": "string",
+		"enum": []string{BandwidthExceededHead, BandwidthExceededReduce},
+	},
+	"Settings.rate_limited": {
+		"type": "string",
+		"enum": []string{RateLimitedDown, RateLimitedDegraded, RateLimitedUnknown},
+	},
+	"Endpoint.rate_limited": {
+		"type": "string",
+		"enum": []string{RateLimitedDown, RateLimitedDegraded, RateLimitedUnknown},
+	},
+	"Endpoint.proxy_protocol": {
+		"type": "string",
+		"enum": []string{ProxyProtocolV1, ProxyProtocolV2},
+	},
+	"Endpoint.record_type": {
+		"type": "string",
+		"enum": []string{RecordTypeA, RecordTypeAAAA, RecordTypeCNAME, RecordTypeTXT, RecordTypeMX, RecordTypeNS, RecordTypeCAA},
+	},
+	"DerivedMetricConfig.aggregate": {
+		"type": "string",
+		"enum": []string{AggregateDownRatio, AggregateDownCount, AggregateMaxLatency, AggregateMeanLatency},
+	},
+	"Endpoint.type": {
+		"type": "string",
+		"enum": []string{EndpointTypeHTTP, EndpointTypeGRPC, EndpointTypeSSH, EndpointTypeFTP, EndpointTypeSFTP, EndpointTypeDNS},
+	},
+	"Endpoint.labels": {
+		"type":                 "object",
+		"propertyNames":        map[string]interface{}{"pattern": labelNamePattern},
+		"additionalProperties": map[string]interface{}{"type": "string"},
+	},
+}
+
+// ConfigSchema returns a JSON Schema for the configuration file, generated from the Config and
+// Endpoints types. A configuration is either a list of endpoints or a mapping of settings with an
+// endpoints list. Fields without omitempty in their YAML tag are required, and unknown fields are
+// rejected so typos are caught before deployment.
+func ConfigSchema() map[string]interface{} {
+	generator := &schemaGenerator{definitions: map[string]interface{}{}}
+	endpoints := generator.typeSchema(reflect.TypeOf(Endpoints{}))
+	config := generator.typeSchema(reflect.TypeOf(Config{}))
+
+	return map[string]interface{}{
+		"$schema":     "https://json-schema.org/draft/2020-12/schema",
+		"$id":         ConfigSchemaID,
+		"title":       "CheckHealth configuration file",
+		"description": "A list of endpoints to check, or a mapping of settings with an endpoints list.",
+		"oneOf":       []interface{}{endpoints, config},
+		"$defs":       generator.definitions,
+	}
+}
+
+// WriteConfigSchema writes the configuration file JSON Schema as an indented JSON object.
+func WriteConfigSchema(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.SetEscapeHTML(false)
+	return encoder.Encode(ConfigSchema())
+}
+
+// schemaGenerator builds JSON Schemas from Go types, collecting structs as named definitions.
+type schemaGenerator struct {
+	definitions map[string]interface{}
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// typeSchema returns the schema of a Go type as decoded by the YAML configuration parser.
+func (generator *schemaGenerator) typeSchema(t reflect.Type) map[string]interface{} {
+	if t == durationType {
+		return map[string]interface{}{"type": "string", "pattern": durationPattern}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return generator.typeSchema(t.Elem())
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer", "minimum": 0}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": generator.typeSchema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": generator.typeSchema(t.Elem())}
+	case reflect.Struct:
+		if _, ok := generator.definitions[t.Name()]; !ok {
+			// reserve the name first, so recursive types refer to the definition being built
+			generator.definitions[t.Name()] = nil
+			generator.definitions[t.Name()] = generator.structSchema(t)
+		}
+		return map[string]interface{}{"$ref": "#/$defs/" + t.Name()}
+	default:
+		return map[string]interface{}{}
+	}
+}
+
+// structSchema returns the object schema of a struct from the YAML tags of its fields. Inlined
+// structs contribute their fields to the object.
+func (generator *schemaGenerator) structSchema(t reflect.Type) map[string]interface{} {
+	properties := map[string]interface{}{}
+	required := []string{}
+	generator.addFields(t, properties, &required)
+
+	schema := map[string]interface{}{
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": false,
+	}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+// addFields adds the fields of t to properties, appending the names of required fields.
+func (generator *schemaGenerator) addFields(t reflect.Type, properties map[string]interface{}, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" && !field.Anonymous {
+			continue
+		}
+
+		tag := strings.Split(field.Tag.Get("yaml"), ",")
+		name, options := tag[0], tag[1:]
+		if name == "-" {
+			continue
+		}
+		if containsString(options, "inline") {
+			generator.addFields(field.Type, properties, required)
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(field.Name)
+		}
+
+		if override, ok := schema_overrides[t.Name()+"."+name]; ok {
+			properties[name] = override
+		} else {
+			properties[name] = generator.typeSchema(field.Type)
+		}
+		if !containsString(options, "omitempty") {
+			*required = append(*required, name)
+		}
+	}
+}
+
+// containsString reports whether values include value.
+func containsString(values []string, value string) bool {
+	for _, existing := range values {
+		if existing == value {
+			return true
+		}
+	}
+	return false
+}
+
+// RunSchema is the entry point for the schema subcommand. It writes the configuration file JSON
+// Schema to w.
+func RunSchema(args []string, w io.Writer) error {
+	flags := flag.NewFlagSet("schema", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+
+	if err := flags.Parse(args); err != nil {
+		return fmt.Errorf("failed to parse schema arguments: %v\n%s", err, SchemaUsage)
+	}
+	if flags.NArg() != 0 {
+		return fmt.Errorf("schema does not accept positional arguments.\n%s", SchemaUsage)
+	}
+
+	return WriteConfigSchema(w)
+}
+
+func init() {
+	RegisterCommand(Command{
+		Name: "schema",
+		Run: func(args []string) error {
+			return RunSchema(args, os.Stdout)
+		},
+	})
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/go-playground/assert/v2"
+	"gopkg.in/yaml.v2"
+)
+
+func TestConfigSchema(t *testing.T) {
+	definitions := ConfigSchema()["$defs"].(map[string]interface{})
+
+	cases := []struct {
+		name             string
+		definition       string
+		property         string
+		expectedType     interface{}
+		expectedRequired bool
+	}{
+		{
+			name:             "Required Endpoint Name",
+			definition:       "Endpoint",
+			property:         "name",
+			expectedType:     "string",
+			expectedRequired: true,
+		},
+		{
+			name:         "Endpoint Headers",
+			definition:   "Endpoint",
+			property:     "headers",
+			expectedType: "object",
+		},
+		{
+			name:         "Endpoint Duration",
+			definition:   "Endpoint",
+			property:     "expect_continue_timeout",
+			expectedType: "string",
+		},
+		{
+			name:         "Inlined Setting",
+			definition:   "Config",
+			property:     "interval",
+			expectedType: "string",
+		},
+		{
+			name:             "Required Endpoints List",
+			definition:       "Config",
+			property:         "endpoints",
+			expectedType:     "array",
+			expectedRequired: true,
+		},
+		{
+			name:         "Overridden Concurrency",
+			definition:   "Config",
+			property:     "concurrency",
+			expectedType: nil,
+		},
+		{
+			name:             "Required Sink Type",
+			definition:       "SinkConfig",
+			property:         "type",
+			expectedType:     "string",
+			expectedRequired: true,
+		},
+		{
+			name:         "Nested Breaker",
+			definition:   "NotifierConfig",
+			property:     "circuit_breaker",
+			expectedType: nil,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			definition := definitions[tc.definition].(map[string]interface{})
+			properties := definition["properties"].(map[string]interface{})
+
+			property, ok := properties[tc.property].(map[string]interface{})
+			assert.Equal(t, ok, true)
+			assert.Equal(t, property["type"], tc.expectedType)
+
+			required, _ := definition["required"].([]string)
+			assert.Equal(t, containsString(required, tc.property), tc.expectedRequired)
+		})
+	}
+}
+
+// TestConfigSchemaCoversSettings guards against the schema drifting from the configuration types,
+// by checking every YAML field of Settings and Endpoint is described.
+func TestConfigSchemaCoversSettings(t *testing.T) {
+	definitions := ConfigSchema()["$defs"].(map[string]interface{})
+
+	for definition, value := range map[string]interface{}{"Config": Settings{}, "Endpoint": Endpoint{}} {
+		properties := definitions[definition].(map[string]interface{})["properties"].(map[string]interface{})
+
+		fields := reflect.TypeOf(value)
+		for i := 0; i < fields.NumField(); i++ {
+			name := regexp.MustCompile(`^[^,]*`).FindString(fields.Field(i).Tag.Get("yaml"))
+			if name == "-" {
+				continue
+			}
+			if _, ok := properties[name]; !ok {
+				t.Errorf("%s field %q is missing from the schema", definition, name)
+			}
+		}
+	}
+}
+
+func TestConfigSchemaPatterns(t *testing.T) {
+	duration := regexp.MustCompile(durationPattern)
+	for _, value := range []string{"0", "15s", "250ms", "1m30s", "1.5h", "-1s"} {
+		_, err := time.ParseDuration(value)
+		assert.Equal(t, err, nil)
+		assert.Equal(t, duration.MatchString(value), true)
+	}
+	for _, value := range []string{"", "15", "fast", "15 s"} {
+		assert.Equal(t, duration.MatchString(value), false)
+	}
+
+	// the concurrency setting accepts an integer in YAML although it is decoded into a string
+	var config Config
+	err := yaml.Unmarshal([]byte("concurrency: 4\nendpoints: []\n"), &config)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, config.Concurrency, "4")
+}
+
+func TestRunSchema(t *testing.T) {
+	cases := []struct {
+		name         string
+		args         []string
+		expectedFail bool
+	}{
+		{
+			name: "No Arguments",
+			args: []string{},
+		},
+		{
+			name:         "Unknown Flag",
+			args:         []string{"-foo"},
+			expectedFail: true,
+		},
+		{
+			name:         "Positional Argument",
+			args:         []string{"foo"},
+			expectedFail: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var output bytes.Buffer
+
+			err := RunSchema(tc.args, &output)
+			if tc.expectedFail {
+				assert.NotEqual(t, err, nil)
+				return
+			}
+
+			assert.Equal(t, err, nil)
+
+			var schema map[string]interface{}
+			assert.Equal(t, json.Unmarshal(output.Bytes(), &schema), nil)
+			assert.Equal(t, schema["$id"], ConfigSchemaID)
+		})
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-playground/assert/v2"
+)
+
+func TestParseConfig(t *testing.T) {
+	cases := []struct {
+		name           string
+		content        string
+		expectedFail   bool
+		expectedConfig Config
+	}{
+		{
+			name: "List of Endpoints",
+			content: `
+- name: example
+  url: https://example.com/
+`,
+			expectedConfig: Config{
+				Endpoints: Endpoints{{Name: "example", Url: "https://example.com/"}},
+			},
+		},
+		{
+			name: "Mapping With Settings",
+			content: `
+output: json
+sinks:
+  - type: file
+    path: results.jsonl
+    batch_size: 10
+    flush_interval: 5s
+endpoints:
+  - name: example
+    url: https://example.com/
+`,
+			expectedConfig: Config{
+				Settings: Settings{
+					Output: OutputJSON,
+					Sinks: []SinkConfig{
+						{Type: "file", Path: "results.jsonl", BatchSize: 10, FlushInterval: 5 * time.Second},
+					},
+				},
+				Endpoints: Endpoints{{Name: "example", Url: "https://example.com/"}},
+			},
+		},
+		{
+			name: "Mapping With Timings",
+			content: `
+interval: 30s
+max_latency: 250ms
+endpoints:
+  - name: example
+    url: https://example.com/
+`,
+			expectedConfig: Config{
+				Settings: Settings{
+					Interval:   30 * time.Second,
+					MaxLatency: 250 * time.Millisecond,
+				},
+				Endpoints: Endpoints{{Name: "example", Url: "https://example.com/"}},
+			},
+		},
+		{
+			name:         "Scalar Document",
+			content:      "foo",
+			expectedFail: true,
+		},
+		{
+			name:         "Invalid Settings",
+			content:      "sinks: foo\nendpoints: []\n",
+			expectedFail: true,
+		},
+		{
+			name:         "NUL Byte",
+			content:      "- name: example\n  url: https://example.com/\x00\n",
+			expectedFail: true,
+		},
+		{
+			name:         "Too Large",
+			content:      "# " + strings.Repeat("x", MaxConfigSize) + "\n[]\n",
+			expectedFail: true,
+		},
+		{
+			name:         "Deep Flow Nesting",
+			content:      strings.Repeat("[", MaxConfigDepth+1) + strings.Repeat("]", MaxConfigDepth+1),
+			expectedFail: true,
+		},
+		{
+			name:         "Deep Nesting In Unknown Setting",
+			content:      "extra: " + strings.Repeat("{a: ", MaxConfigDepth) + "b" + strings.Repeat("}", MaxConfigDepth) + "\nendpoints: []\n",
+			expectedFail: true,
+		},
+		{
+			name:         "Too Many Values",
+			content:      "[" + strings.Repeat("1,", MaxConfigNodes) + "1]",
+			expectedFail: true,
+		},
+		{
+			name:         "Alias Expansion",
+			content:      aliasBomb(9),
+			expectedFail: true,
+		},
+		{
+			name: "Shared Anchor",
+			content: `
+- name: first
+  url: https://example.com/first
+  headers: &headers
+    user-agent: checkhealth
+- name: second
+  url: https://example.com/second
+  headers: *headers
+`,
+			expectedConfig: Config{
+				Endpoints: Endpoints{
+					{Name: "first", Url: "https://example.com/first", Headers: map[string]string{"user-agent": "checkhealth"}},
+					{Name: "second", Url: "https://example.com/second", Headers: map[string]string{"user-agent": "checkhealth"}},
+				},
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			config, err := ParseConfig([]byte(tc.content))
+			if tc.expectedFail {
+				assert.NotEqual(t, err, nil)
+				return
+			}
+
+			assert.Equal(t, err, nil)
+			assert.Equal(t, config, tc.expectedConfig)
+		})
+	}
+}
+
+// aliasBomb returns a document where every level is an anchored list referring ten times to the
+// previous one, expanding to 10^levels values.
+func aliasBomb(levels int) string {
+	var builder strings.Builder
+	builder.WriteString("a0: &a0 [x, x, x, x, x, x, x, x, x, x]\n")
+	for i := 1; i <= levels; i++ {
+		previous := fmt.Sprintf("*a%d", i-1)
+		fmt.Fprintf(&builder, "a%d: &a%d [%s]\n", i, i, strings.TrimSuffix(strings.Repeat(previous+", ", 10), ", "))
+	}
+	builder.WriteString("endpoints: []\n")
+	return builder.String()
+}
+
+func TestParseConfigTooLarge(t *testing.T) {
+	_, err := ParseConfig(make([]byte, MaxConfigSize+1))
+	assert.Equal(t, errors.Is(err, ErrConfigTooLarge), true)
+}
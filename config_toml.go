@@ -0,0 +1,33 @@
+//go:build !notoml
+// +build !notoml
+
+package main
+
+import (
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v2"
+)
+
+// convertTOMLConfig converts a TOML configuration into YAML. A TOML document is always a table, so
+// the settings are top-level keys and the endpoints an array of tables:
+//
+//	interval = "1m"
+//
+//	[[endpoints]]
+//	name = "fetch index page"
+//	url = "https://fetch.com/"
+func convertTOMLConfig(loaded_config []byte) ([]byte, error) {
+	var document map[string]interface{}
+	if err := toml.Unmarshal(loaded_config, &document); err != nil {
+		return nil, err
+	}
+	return yaml.Marshal(document)
+}
+
+func init() {
+	RegisterConfigFormat(ConfigFormat{
+		Name:       ConfigFormatTOML,
+		Extensions: []string{".toml"},
+		Convert:    convertTOMLConfig,
+	})
+}
@@ -0,0 +1,80 @@
+//go:build !notoml
+// +build !notoml
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-playground/assert/v2"
+)
+
+func TestLoadConfigTOML(t *testing.T) {
+	dir := t.TempDir()
+
+	cases := []struct {
+		name              string
+		config            string
+		expectedEndpoints []string
+		expectedError     string
+	}{
+		{
+			name: "Settings And Endpoints",
+			config: `interval = "1m"
+max_latency = "250ms"
+
+[[endpoints]]
+name = "index"
+url = "https://fetch.com/"
+
+[[endpoints]]
+name = "careers"
+url = "https://fetch.com/careers"
+method = "POST"
+headers = { content-type = "application/json" }
+`,
+			expectedEndpoints: []string{"index", "careers"},
+		},
+		{
+			name: "Invalid Endpoint",
+			config: `[[endpoints]]
+name = "index"
+url = "fetch.com"
+`,
+			// the lines of the converted YAML aren't reported
+			expectedError: "\n" + `endpoint "index": url "fetch.com" must be an absolute http:// or https:// URL` + "\n",
+		},
+		{
+			name:          "Syntax Error",
+			config:        "[[endpoints]]\nname = index\n",
+			expectedError: "line 2",
+		},
+	}
+
+	for i, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			file := filepath.Join(dir, strings.Repeat("c", i+1)+".toml")
+			assert.Equal(t, os.WriteFile(file, []byte(tc.config), 0o600), nil)
+
+			config, err := LoadConfig([]string{file})
+			if tc.expectedError != "" {
+				assert.NotEqual(t, err, nil)
+				assert.Equal(t, strings.Contains(err.Error(), tc.expectedError), true)
+				return
+			}
+
+			assert.Equal(t, err, nil)
+			assert.Equal(t, config.Interval.String(), "1m0s")
+			assert.Equal(t, config.MaxLatency.String(), "250ms")
+			names := make([]string, len(config.Endpoints))
+			for i, endpoint := range config.Endpoints {
+				names[i] = endpoint.Name
+			}
+			assert.Equal(t, names, tc.expectedEndpoints)
+			assert.Equal(t, config.Endpoints[1].Headers["content-type"], "application/json")
+		})
+	}
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// ConfigProblem is a problem found in a configuration by ValidateConfig, with the line of the
+// configuration file it was found on, or 0 when the line isn't known. Endpoint is the position,
+// from 1, of the endpoint the problem was found in, or 0 for the other problems.
+type ConfigProblem struct {
+	Line     int
+	Message  string
+	Endpoint int
+}
+
+// String returns the problem prefixed with its line, e.g. `line 4: endpoint "careers": url is
+// required`.
+func (problem ConfigProblem) String() string {
+	if problem.Line == 0 {
+		return problem.Message
+	}
+	return fmt.Sprintf("line %d: %s", problem.Line, problem.Message)
+}
+
+// ConfigErrors is the error returned by ValidateConfig, listing every problem found in a
+// configuration.
+type ConfigErrors []ConfigProblem
+
+// Error returns the problems, one per line.
+func (problems ConfigErrors) Error() string {
+	lines := make([]string, len(problems))
+	for i, problem := range problems {
+		lines[i] = problem.String()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// strictFieldError matches the errors of yaml.UnmarshalStrict for unknown and duplicate fields.
+var strictFieldError = regexp.MustCompile(`^line (\d+): field (.+) (not found|already set) in type main\.(\w+)$`)
+
+// standardMethods are the HTTP methods of RFC 9110 and RFC 5789.
+var standardMethods = []string{
+	http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+	http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace,
+}
+
+// ValidateConfig checks a configuration parsed by ParseConfig from loaded_config before it is
+// used, and returns a ConfigErrors listing every problem found, or nil:
+//   - unknown and duplicate fields, usually typos of an option name.
+//   - endpoints without a name, or without a url, a path or a baseline_url and canary_url.
+//   - urls that can't be parsed, such as IPv6 literals without brackets, HTTP endpoint urls that
+//     aren't absolute http:// or https:// URLs, and ports outside of 1 to 65535.
+//   - HTTP methods that aren't valid tokens, or standard methods that aren't upper case.
+//   - endpoints sharing a name.
+//
+// Problems are reported with the line of the configuration file they were found on. The options of
+// each endpoint are validated further by Config.ApplySettings and CreateNewTargets.
+func ValidateConfig(loaded_config []byte, config Config) error {
+	var problems ConfigErrors
+
+	// decode the configuration again, strictly this time
+	var document interface{}
+	if err := yaml.Unmarshal(loaded_config, &document); err != nil {
+		return ConfigErrors{{Message: err.Error()}}
+	}
+	lines := endpointLines(loaded_config)
+	if len(lines) != len(config.Endpoints) {
+		lines = nil
+	}
+
+	var err error
+	if _, ok := document.([]interface{}); ok {
+		err = yaml.UnmarshalStrict(loaded_config, &Endpoints{})
+	} else {
+		err = yaml.UnmarshalStrict(loaded_config, &Config{})
+	}
+	if type_err, ok := err.(*yaml.TypeError); ok {
+		for _, message := range type_err.Errors {
+			problems = append(problems, strictProblem(message, lines))
+		}
+	}
+
+	names := map[string]int{}
+	for i, endpoint := range config.Endpoints {
+		problem := ConfigProblem{Endpoint: i + 1}
+		if lines != nil {
+			problem.Line = lines[i]
+		}
+		label := fmt.Sprintf("endpoint %d", i+1)
+		if endpoint.Name != "" {
+			label = fmt.Sprintf("endpoint %q", endpoint.Name)
+		}
+		report := func(format string, args ...interface{}) {
+			problem.Message = label + ": " + fmt.Sprintf(format, args...)
+			problems = append(problems, problem)
+		}
+
+		if endpoint.Name == "" {
+			report("name is required")
+		} else if first, ok := names[endpoint.Name]; ok {
+			if first > 0 {
+				report("duplicate name, already used by the endpoint on line %d", first)
+			} else {
+				report("duplicate name")
+			}
+		} else {
+			names[endpoint.Name] = problem.Line
+		}
+
+		is_http := endpoint.Type == "" || endpoint.Type == EndpointTypeHTTP
+		switch parsed_url, err := url.Parse(endpoint.Url); {
+		case endpoint.Url == "" && endpoint.Path == "" && endpoint.BaselineUrl == "" && endpoint.CanaryUrl == "":
+			report("url is required unless path or baseline_url and canary_url are set")
+		case endpoint.Url == "":
+		case err != nil:
+			report("invalid url %q: %v", endpoint.Url, urlHostError(endpoint.Url, err))
+		case is_http && ((parsed_url.Scheme != "http" && parsed_url.Scheme != "https") || parsed_url.Host == ""):
+			report("url %q must be an absolute http:// or https:// URL", endpoint.Url)
+		case validateHost(parsed_url) != nil:
+			report("invalid url %q: %v", endpoint.Url, validateHost(parsed_url))
+		}
+		switch parsed_url, err := url.Parse(endpoint.FallbackUrl); {
+		case endpoint.FallbackUrl == "":
+		case err != nil:
+			report("invalid fallback_url %q: %v", endpoint.FallbackUrl, urlHostError(endpoint.FallbackUrl, err))
+		case is_http && ((parsed_url.Scheme != "http" && parsed_url.Scheme != "https") || parsed_url.Host == ""):
+			report("fallback_url %q must be an absolute http:// or https:// URL", endpoint.FallbackUrl)
+		case validateHost(parsed_url) != nil:
+			report("invalid fallback_url %q: %v", endpoint.FallbackUrl, validateHost(parsed_url))
+		}
+		for _, variant := range []struct{ field, url string }{{"baseline_url", endpoint.BaselineUrl}, {"canary_url", endpoint.CanaryUrl}} {
+			switch parsed_url, err := url.Parse(variant.url); {
+			case variant.url == "":
+			case err != nil:
+				report("invalid %s %q: %v", variant.field, variant.url, urlHostError(variant.url, err))
+			case is_http && ((parsed_url.Scheme != "http" && parsed_url.Scheme != "https") || parsed_url.Host == ""):
+				report("%s %q must be an absolute http:// or https:// URL", variant.field, variant.url)
+			case validateHost(parsed_url) != nil:
+				report("invalid %s %q: %v", variant.field, variant.url, validateHost(parsed_url))
+			}
+		}
+
+		if is_http && endpoint.Method != "" {
+			if !isToken(endpoint.Method) {
+				report("invalid method %q", endpoint.Method)
+			}
+			for _, method := range standardMethods {
+				if endpoint.Method != method && strings.EqualFold(endpoint.Method, method) {
+					report("method %q must be upper case, %s", endpoint.Method, method)
+				}
+			}
+		}
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+	sort.SliceStable(problems, func(i, j int) bool { return problems[i].Line < problems[j].Line })
+	return problems
+}
+
+// strictProblem converts an error message of yaml.UnmarshalStrict into a ConfigProblem. Problems
+// of endpoint fields are attributed to the endpoint starting at the closest of lines above them.
+func strictProblem(message string, lines []int) ConfigProblem {
+	match := strictFieldError.FindStringSubmatch(message)
+	if match == nil {
+		problem := ConfigProblem{Message: message}
+		if rest := strings.TrimPrefix(message, "line "); rest != message {
+			if i := strings.Index(rest, ": "); i > 0 {
+				if line, err := strconv.Atoi(rest[:i]); err == nil {
+					problem = ConfigProblem{Line: line, Message: rest[i+2:]}
+				}
+			}
+		}
+		return problem
+	}
+
+	line, _ := strconv.Atoi(match[1])
+	kind := "field"
+	switch match[4] {
+	case "Endpoint":
+		kind = "endpoint field"
+	case "Config":
+		kind = "setting"
+	}
+	problem := ConfigProblem{Line: line, Message: fmt.Sprintf("unknown %s %s", kind, match[2])}
+	if match[3] == "already set" {
+		problem.Message = fmt.Sprintf("duplicate %s %s", kind, match[2])
+	}
+	if match[4] == "Endpoint" {
+		for i, start := range lines {
+			if start <= line {
+				problem.Endpoint = i + 1
+			}
+		}
+	}
+	return problem
+}
+
+// errorCause returns the cause of a *url.Error, which already quotes the url.
+func errorCause(err error) error {
+	if url_err, ok := err.(*url.Error); ok {
+		return url_err.Err
+	}
+	return err
+}
+
+// isToken reports whether value is a token of RFC 9110, as HTTP methods must be.
+func isToken(value string) bool {
+	if value == "" {
+		return false
+	}
+	for _, r := range value {
+		if r > 0x7f || !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("!#$%&'*+-.^_`|~", r)) {
+			return false
+		}
+	}
+	return true
+}
+
+// endpointLines returns the lines of the items of the endpoints list of a configuration written in
+// block style, in order. Configurations written in flow style return no lines.
+func endpointLines(loaded_config []byte) []int {
+	var lines []int
+	in_list := false
+	seen_key := false
+	indent := -1
+	for i, line := range strings.Split(string(loaded_config), "\n") {
+		trimmed := strings.TrimLeft(line, " ")
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") || strings.TrimSpace(trimmed) == "---" {
+			continue
+		}
+		line_indent := len(line) - len(trimmed)
+		is_item := trimmed == "-" || strings.HasPrefix(trimmed, "- ")
+
+		switch {
+		case line_indent == 0 && !is_item:
+			// a top-level key starts the endpoints list or ends it
+			seen_key = true
+			in_list = strings.HasPrefix(trimmed, "endpoints:") && strings.TrimSpace(strings.TrimPrefix(trimmed, "endpoints:")) == ""
+			indent = -1
+		case !seen_key:
+			// a plain list of endpoints
+			in_list = true
+		}
+		if !in_list || !is_item {
+			continue
+		}
+		if indent == -1 {
+			indent = line_indent
+		}
+		if line_indent == indent {
+			lines = append(lines, i+1)
+		}
+	}
+	return lines
+}
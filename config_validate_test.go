@@ -0,0 +1,127 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/go-playground/assert/v2"
+)
+
+func TestValidateConfig(t *testing.T) {
+	cases := []struct {
+		name     string
+		config   string
+		expected []string
+	}{
+		{
+			name: "Valid List",
+			config: `- name: index
+  url: https://fetch.com/
+  method: POST
+- name: records
+  type: dns
+  url: dns://fetch.com
+`,
+		},
+		{
+			name: "Valid Mapping",
+			config: `# checked every minute
+interval: 1m
+endpoints:
+  - name: login
+    path: /login
+environments:
+  production: https://fetch.com
+`,
+		},
+		{
+			name: "Every Problem Reported",
+			config: `- name: index
+  url: https://fetch.com/
+  methd: POST
+- url: https://fetch.com/careers
+- name: index
+  url: fetch.com/about
+  method: get
+- name: upload
+  url: "https://fetch.com/%zz"
+  method: "PO ST"
+`,
+			expected: []string{
+				`line 3: unknown endpoint field methd`,
+				`line 4: endpoint 2: name is required`,
+				`line 5: endpoint "index": duplicate name, already used by the endpoint on line 1`,
+				`line 5: endpoint "index": url "fetch.com/about" must be an absolute http:// or https:// URL`,
+				`line 5: endpoint "index": method "get" must be upper case, GET`,
+				`line 8: endpoint "upload": invalid url "https://fetch.com/%zz": invalid URL escape "%zz"`,
+				`line 8: endpoint "upload": invalid method "PO ST"`,
+			},
+		},
+		{
+			name: "Unknown Setting",
+			config: `---
+intervall: 1m
+endpoints:
+- name: index
+- name: careers
+  url: https://fetch.com/careers
+sinks:
+- type: file
+  pth: events.jsonl
+`,
+			expected: []string{
+				`line 2: unknown setting intervall`,
+				`line 4: endpoint "index": url is required unless path or baseline_url and canary_url are set`,
+				`line 9: unknown field pth`,
+			},
+		},
+		{
+			name: "Duplicate Field",
+			config: `- name: index
+  url: https://fetch.com/
+  url: https://fetch.com/index.html
+`,
+			expected: []string{`line 3: duplicate endpoint field url`},
+		},
+		{
+			name: "Invalid Fallback URL",
+			config: `- name: index
+  url: https://fetch.com/
+  fallback_url: dr.fetch.com
+`,
+			expected: []string{`line 1: endpoint "index": fallback_url "dr.fetch.com" must be an absolute http:// or https:// URL`},
+		},
+		{
+			name: "Invalid Canary URL",
+			config: `- name: checkout
+  baseline_url: https://stable.fetch.com/
+  canary_url: canary.fetch.com
+`,
+			expected: []string{`line 1: endpoint "checkout": canary_url "canary.fetch.com" must be an absolute http:// or https:// URL`},
+		},
+		{
+			name:     "Flow Style",
+			config:   `[{name: index, url: "https://fetch.com/"}, {url: "https://fetch.com/careers"}]`,
+			expected: []string{`endpoint 2: name is required`},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			config, err := ParseConfig([]byte(tc.config))
+			assert.Equal(t, err, nil)
+
+			err = ValidateConfig([]byte(tc.config), config)
+			if tc.expected == nil {
+				assert.Equal(t, err, nil)
+				return
+			}
+			problems, ok := err.(ConfigErrors)
+			assert.Equal(t, ok, true)
+			messages := make([]string, len(problems))
+			for i, problem := range problems {
+				messages[i] = problem.String()
+			}
+			assert.Equal(t, messages, tc.expected)
+		})
+	}
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Every applied reload is audited: the configuration file it replaced is archived to the
+// config_backup_dir, and the endpoints added, removed and changed, and the settings changed, are
+// logged and emitted as an EventConfigChange event, so availability shifts can be correlated with
+// configuration changes.
+
+// EventConfigChange is the event type reporting the changes applied by a configuration reload.
+const EventConfigChange string = "config_change"
+
+// ConfigBackups is the number of archived configuration files kept in the config_backup_dir, the
+// oldest being removed first.
+const ConfigBackups int = 20
+
+// ConfigSource is the content of the configuration file a Config was loaded from, in its format
+// before conversion to YAML.
+type ConfigSource struct {
+	Format  string
+	Content []byte
+}
+
+// ConfigChange is the difference between two configurations: the names of the endpoints added and
+// removed, the endpoints changed with the options that changed, and the settings changed.
+type ConfigChange struct {
+	Added    []string
+	Removed  []string
+	Changed  []EndpointChange
+	Settings []string
+}
+
+// EndpointChange is an endpoint present in both configurations whose options changed.
+type EndpointChange struct {
+	Endpoint string
+	Fields   []string
+}
+
+// ConfigChangeEvent is the payload of an EventConfigChange event.
+type ConfigChangeEvent struct {
+	Added    []string              `json:"added,omitempty"`
+	Removed  []string              `json:"removed,omitempty"`
+	Changed  []EndpointChangeEvent `json:"changed,omitempty"`
+	Settings []string              `json:"settings,omitempty"`
+
+	// Backup is the path the replaced configuration file was archived to.
+	Backup string `json:"backup,omitempty"`
+}
+
+// EndpointChangeEvent is an endpoint whose options, by name, were changed by a reload.
+type EndpointChangeEvent struct {
+	Endpoint string   `json:"endpoint"`
+	Fields   []string `json:"fields"`
+}
+
+// Empty reports whether the configurations are equivalent.
+func (change ConfigChange) Empty() bool {
+	return len(change.Added) == 0 && len(change.Removed) == 0 && len(change.Changed) == 0 && len(change.Settings) == 0
+}
+
+// DiffConfigs compares the endpoints, by name, and the settings of two configurations. Options are
+// compared by their configuration name, after the defaults of the settings were applied.
+func DiffConfigs(previous Config, current Config) ConfigChange {
+	var change ConfigChange
+
+	endpoints := map[string]*Endpoint{}
+	for i := range previous.Endpoints {
+		endpoints[previous.Endpoints[i].Name] = &previous.Endpoints[i]
+	}
+	for i := range current.Endpoints {
+		endpoint := &current.Endpoints[i]
+		before, ok := endpoints[endpoint.Name]
+		if !ok {
+			change.Added = append(change.Added, endpoint.Name)
+			continue
+		}
+		delete(endpoints, endpoint.Name)
+
+		if fields := changedFields(before, endpoint); len(fields) > 0 {
+			change.Changed = append(change.Changed, EndpointChange{Endpoint: endpoint.Name, Fields: fields})
+		}
+	}
+	for name := range endpoints {
+		change.Removed = append(change.Removed, name)
+	}
+	sort.Strings(change.Added)
+	sort.Strings(change.Removed)
+	sort.Slice(change.Changed, func(i, j int) bool { return change.Changed[i].Endpoint < change.Changed[j].Endpoint })
+
+	change.Settings = changedFields(previous.Settings, current.Settings)
+	return change
+}
+
+// changedFields returns the sorted configuration names of the options that differ between two
+// values of the same type, as they are written in a configuration file.
+func changedFields(previous interface{}, current interface{}) []string {
+	before, after := configFields(previous), configFields(current)
+
+	var fields []string
+	for name, value := range after {
+		if !reflect.DeepEqual(before[name], value) {
+			fields = append(fields, fmt.Sprint(name))
+		}
+	}
+	for name := range before {
+		if _, ok := after[name]; !ok {
+			fields = append(fields, fmt.Sprint(name))
+		}
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// configFields returns the options of a value by their configuration name, omitting those left
+// empty.
+func configFields(value interface{}) map[interface{}]interface{} {
+	fields := map[interface{}]interface{}{}
+	content, err := yaml.Marshal(value)
+	if err != nil {
+		return fields
+	}
+	yaml.Unmarshal(content, &fields)
+	return fields
+}
+
+// BackupConfig writes the content of a replaced configuration file to dir, named after the time it
+// was replaced, and removes the oldest archives beyond ConfigBackups. The path of the archive is
+// returned.
+func BackupConfig(dir string, source ConfigSource, at time.Time) (string, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("failed to create config backup directory: %v", err)
+	}
+
+	extension := source.Format
+	if extension == "" {
+		extension = ConfigFormatYAML
+	}
+	path := filepath.Join(dir, fmt.Sprintf("config-%s.%s", at.UTC().Format("20060102T150405.000Z"), extension))
+	if err := os.WriteFile(path, source.Content, 0o600); err != nil {
+		return "", fmt.Errorf("failed to write config backup: %v", err)
+	}
+
+	// archive names sort by time
+	archives, err := filepath.Glob(filepath.Join(dir, "config-*"))
+	if err != nil {
+		return path, nil
+	}
+	sort.Strings(archives)
+	for len(archives) > ConfigBackups {
+		if err := os.Remove(archives[0]); err != nil {
+			log.Printf("Failed to remove old config backup %s: %v", archives[0], err)
+		}
+		archives = archives[1:]
+	}
+	return path, nil
+}
+
+// currentConfig returns the configuration currently checked by the targets.
+func (target *HealthCheckTargets) currentConfig() Config {
+	config := Config{Settings: target.Settings, Source: target.Source}
+	if target.Endpoints != nil {
+		config.Endpoints = append(Endpoints(nil), *target.Endpoints...)
+	}
+	return config
+}
+
+// AuditReload is a method for HealthCheckTargets that records the changes applied by a reload
+// from previous, the configuration checked before it. When the configuration file changed and a
+// config_backup_dir is set, its previous content is archived first. The changes are logged and
+// emitted to the sinks as an EventConfigChange event, also printed in the JSON output mode.
+func (target *HealthCheckTargets) AuditReload(previous Config, at time.Time) {
+	change := DiffConfigs(previous, target.currentConfig())
+
+	backup := ""
+	if dir := target.Settings.ConfigBackupDir; dir != "" && len(previous.Source.Content) > 0 && !bytes.Equal(previous.Source.Content, target.Source.Content) {
+		path, err := BackupConfig(dir, previous.Source, at)
+		if err != nil {
+			log.Printf("Failed to archive the previous configuration: %v", err)
+		} else {
+			backup = path
+			log.Printf("Archived the previous configuration to %s", path)
+		}
+	}
+
+	if change.Empty() {
+		log.Printf("Configuration change: none")
+		return
+	}
+	for _, name := range change.Added {
+		log.Printf("Configuration change: endpoint %q added", name)
+	}
+	for _, name := range change.Removed {
+		log.Printf("Configuration change: endpoint %q removed", name)
+	}
+	for _, changed := range change.Changed {
+		log.Printf("Configuration change: endpoint %q changed %s", changed.Endpoint, strings.Join(changed.Fields, ", "))
+	}
+	if len(change.Settings) > 0 {
+		log.Printf("Configuration change: settings changed %s", strings.Join(change.Settings, ", "))
+	}
+
+	events := []Event{NewConfigChangeEvent(change, backup, at)}
+	if err := target.Signer.Sign(events); err != nil {
+		log.Printf("Failed to sign events: %v", err)
+	}
+	if target.Settings.Output == OutputJSON {
+		if err := WriteEvents(os.Stdout, events); err != nil {
+			log.Printf("Failed to write JSON output: %v", err)
+		}
+	}
+	target.EmitEvents(events)
+}
+
+// NewConfigChangeEvent returns the EventConfigChange event of a change, with the path its previous
+// configuration file was archived to, if any.
+func NewConfigChangeEvent(change ConfigChange, backup string, at time.Time) Event {
+	event := NewEvent(EventConfigChange, at)
+	event.ConfigChange = &ConfigChangeEvent{
+		Added:    change.Added,
+		Removed:  change.Removed,
+		Settings: change.Settings,
+		Backup:   backup,
+	}
+	for _, changed := range change.Changed {
+		event.ConfigChange.Changed = append(event.ConfigChange.Changed, EndpointChangeEvent{Endpoint: changed.Endpoint, Fields: changed.Fields})
+	}
+	return event
+}
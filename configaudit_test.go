@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-playground/assert/v2"
+)
+
+func TestDiffConfigs(t *testing.T) {
+	previous := Config{
+		Settings: Settings{Interval: 15 * time.Second, MaxLatency: 500 * time.Millisecond},
+		Endpoints: Endpoints{
+			{Name: "index", Url: "https://fetch.com/"},
+			{Name: "careers", Url: "https://fetch.com/careers", Headers: map[string]string{"user-agent": "checkhealth"}},
+			{Name: "api", Url: "https://api.fetch.com/", Method: "POST", Body: "{}"},
+		},
+	}
+
+	cases := []struct {
+		name     string
+		current  Config
+		expected ConfigChange
+	}{
+		{
+			name:    "Unchanged",
+			current: previous,
+		},
+		{
+			name: "Endpoints",
+			current: Config{
+				Settings: previous.Settings,
+				Endpoints: Endpoints{
+					{Name: "status", Url: "https://status.fetch.com/"},
+					{Name: "index", Url: "https://fetch.com/", DownAfter: 1},
+					{Name: "careers", Url: "https://careers.fetch.com/", Headers: map[string]string{"user-agent": "checkhealth/2"}},
+				},
+			},
+			expected: ConfigChange{
+				Added:   []string{"status"},
+				Removed: []string{"api"},
+				Changed: []EndpointChange{
+					{Endpoint: "careers", Fields: []string{"headers", "url"}},
+					{Endpoint: "index", Fields: []string{"down_after"}},
+				},
+			},
+		},
+		{
+			name: "Removed Option And Settings",
+			current: Config{
+				Settings: Settings{Interval: 15 * time.Second, MaxLatency: time.Second, LatencyWindows: []time.Duration{time.Hour}},
+				Endpoints: Endpoints{
+					previous.Endpoints[0],
+					previous.Endpoints[1],
+					{Name: "api", Url: "https://api.fetch.com/", Method: "POST"},
+				},
+			},
+			expected: ConfigChange{
+				Changed:  []EndpointChange{{Endpoint: "api", Fields: []string{"body"}}},
+				Settings: []string{"latency_windows", "max_latency"},
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			change := DiffConfigs(previous, tc.current)
+			assert.Equal(t, change, tc.expected)
+			assert.Equal(t, change.Empty(), tc.name == "Unchanged")
+		})
+	}
+}
+
+func TestBackupConfig(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "backups")
+	at := time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	path, err := BackupConfig(dir, ConfigSource{Format: ConfigFormatTOML, Content: []byte("interval = \"30s\"\n")}, at)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, path, filepath.Join(dir, "config-20230601T120000.000Z.toml"))
+	content, err := os.ReadFile(path)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, string(content), "interval = \"30s\"\n")
+
+	// only the most recent archives are kept
+	for i := 1; i <= ConfigBackups; i++ {
+		_, err := BackupConfig(dir, ConfigSource{Content: []byte(fmt.Sprintf("# %d\n", i))}, at.Add(time.Duration(i)*time.Minute))
+		assert.Equal(t, err, nil)
+	}
+	archives, err := filepath.Glob(filepath.Join(dir, "config-*"))
+	assert.Equal(t, err, nil)
+	assert.Equal(t, len(archives), ConfigBackups)
+	_, err = os.Stat(path)
+	assert.Equal(t, os.IsNotExist(err), true)
+	assert.Equal(t, filepath.Base(archives[len(archives)-1]), "config-20230601T122000.000Z.yaml")
+}
+
+func TestApplyReloadAudit(t *testing.T) {
+	endpoints := Endpoints{{Name: "index", Url: "https://fetch.com/"}}
+	targets, err := endpoints.CreateNewTargets()
+	assert.Equal(t, err, nil)
+	dir := t.TempDir()
+	targets.Settings = Settings{Output: OutputText, ConfigBackupDir: dir}
+	targets.Source = ConfigSource{Format: ConfigFormatYAML, Content: []byte("- name: index\n")}
+	sink := &recordingSink{}
+	targets.Sinks = []*BatchSink{NewBatchSink("test", sink, SinkConfig{})}
+
+	targets.ApplyReload(Config{
+		Settings: Settings{Output: OutputText, ConfigBackupDir: dir},
+		Endpoints: Endpoints{
+			{Name: "index", Url: "https://fetch.com/"},
+			{Name: "careers", Url: "https://fetch.com/careers"},
+		},
+		Source: ConfigSource{Format: ConfigFormatYAML, Content: []byte("- name: index\n- name: careers\n")},
+	})
+	targets.CloseSinks()
+
+	// the replaced configuration file is archived
+	archives, err := filepath.Glob(filepath.Join(dir, "config-*.yaml"))
+	assert.Equal(t, err, nil)
+	assert.Equal(t, len(archives), 1)
+	content, err := os.ReadFile(archives[0])
+	assert.Equal(t, err, nil)
+	assert.Equal(t, string(content), "- name: index\n")
+
+	// and the changes are emitted
+	assert.Equal(t, len(sink.batches), 1)
+	event := sink.batches[0][0]
+	assert.Equal(t, event.Type, EventConfigChange)
+	assert.Equal(t, *event.ConfigChange, ConfigChangeEvent{Added: []string{"careers"}, Backup: archives[0]})
+}
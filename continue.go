@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptrace"
+	"net/textproto"
+	"sync"
+	"time"
+)
+
+// expect_continue_clients caches the HTTP clients with a custom Expect: 100-continue timeout, by
+// timeout, so connections are reused across checks.
+var expect_continue_clients = struct {
+	sync.Mutex
+	clients map[time.Duration]*http.Client
+}{
+	clients: map[time.Duration]*http.Client{},
+}
+
+// ExpectContinueClient returns an HTTP client that waits up to timeout for a "100 Continue"
+// response before sending the body of a request with an "Expect: 100-continue" header.
+func ExpectContinueClient(timeout time.Duration) *http.Client {
+	expect_continue_clients.Lock()
+	defer expect_continue_clients.Unlock()
+
+	if client, ok := expect_continue_clients.clients[timeout]; ok {
+		return client
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ExpectContinueTimeout = timeout
+
+	client := &http.Client{Transport: transport}
+	expect_continue_clients.clients[timeout] = client
+	return client
+}
+
+// InterimResponses records the interim (1xx) status codes received while performing a request.
+type InterimResponses struct {
+	mu    sync.Mutex
+	codes []int
+}
+
+// WithInterimTrace returns a context that records the interim responses of requests made with it.
+func WithInterimTrace(ctx context.Context) (context.Context, *InterimResponses) {
+	interim := &InterimResponses{}
+
+	trace := &httptrace.ClientTrace{
+		Got1xxResponse: func(code int, header textproto.MIMEHeader) error {
+			interim.mu.Lock()
+			defer interim.mu.Unlock()
+			interim.codes = append(interim.codes, code)
+			return nil
+		},
+	}
+
+	return httptrace.WithClientTrace(ctx, trace), interim
+}
+
+// Received reports whether an interim response with the provided status code was received.
+func (interim *InterimResponses) Received(code int) bool {
+	interim.mu.Lock()
+	defer interim.mu.Unlock()
+
+	for _, received := range interim.codes {
+		if received == code {
+			return true
+		}
+	}
+	return false
+}
+
+// Codes returns the interim status codes received, in order.
+func (interim *InterimResponses) Codes() []int {
+	interim.mu.Lock()
+	defer interim.mu.Unlock()
+	return append([]int{}, interim.codes...)
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-playground/assert/v2"
+)
+
+func TestCreateRequestExpectContinue(t *testing.T) {
+	cases := []struct {
+		name           string
+		endpoint       Endpoint
+		expectedHeader string
+	}{
+		{
+			name: "Request With Body",
+			endpoint: Endpoint{
+				Url:            "http://example.com/",
+				Method:         "POST",
+				Body:           `{"foo":"bar"}`,
+				ExpectContinue: true,
+			},
+			expectedHeader: "100-continue",
+		},
+		{
+			name: "Request Without Body",
+			endpoint: Endpoint{
+				Url:            "http://example.com/",
+				ExpectContinue: true,
+			},
+			expectedHeader: "",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			request, err := tc.endpoint.CreateRequest(context.Background())
+			assert.Equal(t, err, nil)
+			assert.Equal(t, request.Header.Get("Expect"), tc.expectedHeader)
+		})
+	}
+}
+
+func TestGetEndpointHealthExpectInterim(t *testing.T) {
+	cases := []struct {
+		name       string
+		readBody   bool
+		expectedUp int
+	}{
+		{
+			// the server only sends 100 Continue once the handler reads the body
+			name:       "Server Continues",
+			readBody:   true,
+			expectedUp: 1,
+		},
+		{
+			name:       "Server Responds Without Continuing",
+			readBody:   false,
+			expectedUp: 0,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			mock_server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tc.readBody {
+					io.ReadAll(r.Body)
+				}
+			}))
+			defer mock_server.Close()
+
+			endpoint := Endpoint{
+				Name:                  "Expect Continue Test",
+				Url:                   mock_server.URL,
+				Method:                "POST",
+				Body:                  `{"foo":"bar"}`,
+				ExpectContinue:        true,
+				ExpectContinueTimeout: time.Second,
+				ExpectInterim:         http.StatusContinue,
+				Domain:                &Domain{Name: "127.0.0.1"},
+			}
+
+			endpoint.Domain.RecordResult(endpoint.GetEndpointHealth(2 * time.Second))
+			assert.Equal(t, endpoint.Domain.UpCount, tc.expectedUp)
+			assert.Equal(t, endpoint.Domain.TotalRequests, 1)
+		})
+	}
+}
+
+func TestExpectContinueClient(t *testing.T) {
+	client := ExpectContinueClient(3 * time.Second)
+
+	// clients are cached per timeout
+	assert.Equal(t, ExpectContinueClient(3*time.Second) == client, true)
+	assert.Equal(t, client.Transport.(*http.Transport).ExpectContinueTimeout, 3*time.Second)
+}
+
+func TestInterimResponses(t *testing.T) {
+	// a raw server, since not every supported Go version can send interim responses from a handler
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Equal(t, err, nil)
+	defer listener.Close()
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		http.ReadRequest(bufio.NewReader(conn))
+		io.WriteString(conn, "HTTP/1.1 103 Early Hints\r\nLink: </style.css>; rel=preload\r\n\r\n")
+		io.WriteString(conn, "HTTP/1.1 200 OK\r\nContent-Length: 0\r\n\r\n")
+	}()
+
+	ctx, interim := WithInterimTrace(context.Background())
+	request, err := http.NewRequestWithContext(ctx, "GET", "http://"+listener.Addr().String()+"/", nil)
+	assert.Equal(t, err, nil)
+
+	response, err := http.DefaultClient.Do(request)
+	assert.Equal(t, err, nil)
+	response.Body.Close()
+
+	assert.Equal(t, interim.Codes(), []int{103})
+	assert.Equal(t, interim.Received(103), true)
+	assert.Equal(t, interim.Received(http.StatusContinue), false)
+}
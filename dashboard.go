@@ -0,0 +1,61 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+)
+
+// DashboardRefresh is how often the dashboard page polls /dashboard.json for the current state.
+const DashboardRefresh time.Duration = 5 * time.Second
+
+// dashboardPage is the dashboard served on / by the metrics server, rendering the Dashboard polled
+// from /dashboard.json without any external resource.
+//
+//go:embed dashboard.html
+var dashboardPage []byte
+
+// Dashboard is the current state rendered by the dashboard page: the availability of every domain
+// and the state, recent latencies and last failures of every endpoint.
+type Dashboard struct {
+	GeneratedAt time.Time `json:"generated_at"`
+
+	// RefreshMs is how often the page polls the dashboard, in milliseconds.
+	RefreshMs int64 `json:"refresh_ms"`
+
+	Domains   []*DomainEvent   `json:"domains"`
+	Endpoints []EndpointStatus `json:"endpoints"`
+}
+
+// Dashboard is a method for HealthCheckTargets that returns the Dashboard at now, see
+// DomainStatuses and EndpointStates.
+func (target *HealthCheckTargets) Dashboard(now time.Time) Dashboard {
+	return Dashboard{
+		GeneratedAt: now.UTC(),
+		RefreshMs:   DashboardRefresh.Milliseconds(),
+		Domains:     target.DomainStatuses(now),
+		Endpoints:   target.EndpointStates(),
+	}
+}
+
+// DashboardHandler is a method for HealthCheckTargets that returns an http.Handler serving the
+// dashboard page on / and its data as JSON on /dashboard.json. Other paths are not found.
+func (target *HealthCheckTargets) DashboardHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Write(dashboardPage)
+		case "/dashboard.json":
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Cache-Control", "no-store")
+			if err := json.NewEncoder(w).Encode(target.Dashboard(time.Now())); err != nil {
+				log.Printf("Failed to write dashboard: %v", err)
+			}
+		default:
+			http.NotFound(w, r)
+		}
+	})
+}
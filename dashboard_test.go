@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-playground/assert/v2"
+)
+
+func TestDashboardHandler(t *testing.T) {
+	endpoints := Endpoints{
+		{Name: "index", Url: "https://example.com/"},
+		{Name: "careers", Url: "https://example.com/careers"},
+	}
+	targets, err := endpoints.CreateNewTargets()
+	assert.Equal(t, err, nil)
+
+	at := time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+	targets.RecordResults([]CheckResult{
+		{Endpoint: "index", Url: "https://example.com/", Status: StatusUp, Latency: 120 * time.Millisecond, FinishedAt: at},
+		{Endpoint: "careers", Url: "https://example.com/careers", Status: StatusDown, StatusCode: 503, ErrorKind: ErrorKindStatus, Error: "unexpected status code 503", FinishedAt: at},
+	})
+	targets.Domains.UpdateDomainStats(true)
+	targets.Domains.UpdateDomainStats(false)
+
+	cases := []struct {
+		name        string
+		path        string
+		code        int
+		contentType string
+	}{
+		{name: "Page", path: "/", code: http.StatusOK, contentType: "text/html; charset=utf-8"},
+		{name: "Data", path: "/dashboard.json", code: http.StatusOK, contentType: "application/json"},
+		{name: "Not Found", path: "/unknown", code: http.StatusNotFound},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			targets.DashboardHandler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, tc.path, nil))
+			assert.Equal(t, recorder.Code, tc.code)
+			if tc.contentType != "" {
+				assert.Equal(t, recorder.Header().Get("Content-Type"), tc.contentType)
+			}
+		})
+	}
+
+	recorder := httptest.NewRecorder()
+	targets.DashboardHandler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, strings.Contains(recorder.Body.String(), "dashboard.json"), true)
+
+	recorder = httptest.NewRecorder()
+	targets.DashboardHandler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/dashboard.json", nil))
+	var dashboard Dashboard
+	assert.Equal(t, json.Unmarshal(recorder.Body.Bytes(), &dashboard), nil)
+	assert.Equal(t, dashboard.RefreshMs, DashboardRefresh.Milliseconds())
+
+	assert.Equal(t, len(dashboard.Domains), 1)
+	assert.Equal(t, dashboard.Domains[0].Name, "example.com")
+	assert.Equal(t, dashboard.Domains[0].Availability, 50)
+
+	assert.Equal(t, len(dashboard.Endpoints), 2)
+	assert.Equal(t, dashboard.Endpoints[0].RecentLatenciesMs, []float64{120})
+	assert.Equal(t, dashboard.Endpoints[1].State, StateDegraded)
+	assert.Equal(t, dashboard.Endpoints[1].RecentErrors[0].Error, "unexpected status code 503")
+}
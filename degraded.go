@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+)
+
+// Checks are UP, DEGRADED or DOWN: a degraded check succeeded, so it counts as available, but
+// exceeded the endpoint's max_latency or met a warning condition, such as its degraded_when
+// expression. Domains count their degraded checks separately from their failed checks.
+
+// ErrorKindWarning classifies successful checks marked degraded by the endpoint's degraded_when
+// expression.
+const ErrorKindWarning string = "warning"
+
+// degradedPredicate returns the endpoint's compiled degraded_when predicate, compiling
+// DegradedWhen when the endpoint wasn't created by CreateNewTargets. It is nil when the endpoint
+// has no warning condition.
+func (endpoint *Endpoint) degradedPredicate() (*Predicate, error) {
+	if endpoint.DegradedPredicate != nil || endpoint.DegradedWhen == "" {
+		return endpoint.DegradedPredicate, nil
+	}
+	return CompilePredicate(endpoint.DegradedWhen)
+}
+
+// judgeWarning marks a successful result degraded, with the warning error kind, when the signals
+// of its response satisfy the degraded predicate.
+func (result *CheckResult) judgeWarning(degraded *Predicate, signals PredicateSignals) {
+	if degraded == nil || result.Status != StatusUp {
+		return
+	}
+	if degraded.Evaluate(signals) {
+		result.fail(StatusDegraded, ErrorKindWarning, fmt.Errorf("degraded_when %q was met", degraded))
+	}
+}
+
+// RecordDegraded is a method for a domain to count a degraded check of one of its endpoints, which
+// is also counted as up by UpdateDomainStats.
+//
+// Returns immediately if the domain pointer passed is nil.
+func (domain *Domain) RecordDegraded() {
+	if domain == nil {
+		return
+	}
+
+	domain_stats.Lock()
+	defer domain_stats.Unlock()
+
+	domain.DegradedCount += 1
+}
+
+// FailedCount is a method for a domain that returns the number of its checks that were down.
+func (domain *Domain) FailedCount() int {
+	domain_stats.Lock()
+	defer domain_stats.Unlock()
+
+	return domain.TotalRequests - domain.UpCount
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-playground/assert/v2"
+)
+
+func TestGetEndpointHealthDegradedWhen(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Warning", `199 - "replica lagging"`)
+		if r.URL.Path == "/down" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		w.Write([]byte(`{"status": "degraded"}`))
+	}))
+	defer server.Close()
+
+	cases := []struct {
+		name              string
+		path              string
+		degradedWhen      string
+		expectedStatus    string
+		expectedErrorKind string
+	}{
+		{
+			name:           "No Warning Condition",
+			expectedStatus: StatusUp,
+		},
+		{
+			name:              "Warning Header",
+			degradedWhen:      `header["Warning"] != ""`,
+			expectedStatus:    StatusDegraded,
+			expectedErrorKind: ErrorKindWarning,
+		},
+		{
+			name:              "Warning Body",
+			degradedWhen:      `body contains "degraded"`,
+			expectedStatus:    StatusDegraded,
+			expectedErrorKind: ErrorKindWarning,
+		},
+		{
+			name:           "Condition Not Met",
+			degradedWhen:   `latency > 10s`,
+			expectedStatus: StatusUp,
+		},
+		{
+			name:              "Failed Checks Stay Down",
+			path:              "/down",
+			degradedWhen:      `header["Warning"] != ""`,
+			expectedStatus:    StatusDown,
+			expectedErrorKind: ErrorKindStatus,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			endpoints := Endpoints{{Name: "replica", Url: server.URL + tc.path, DegradedWhen: tc.degradedWhen, PreferHead: true}}
+			_, err := endpoints.CreateNewTargets()
+			assert.Equal(t, err, nil)
+
+			result := endpoints[0].GetEndpointHealth(time.Second)
+			assert.Equal(t, result.Status, tc.expectedStatus)
+			assert.Equal(t, result.ErrorKind, tc.expectedErrorKind)
+		})
+	}
+}
+
+func TestDegradedWhenSettings(t *testing.T) {
+	endpoints := Endpoints{{Name: "invalid", Url: "https://example.com/", DegradedWhen: "latency >"}}
+	_, err := endpoints.CreateNewTargets()
+	assert.NotEqual(t, err, nil)
+
+	config := Config{Endpoints: Endpoints{{Name: "records", Url: "dns://fetch.com", Type: EndpointTypeDNS, DegradedWhen: "latency > 1s"}}}
+	assert.NotEqual(t, config.ApplySettings(), nil)
+}
@@ -0,0 +1,191 @@
+//go:build !nodemo
+// +build !nodemo
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// DemoUsage provides help text for the demo subcommand.
+const DemoUsage string = `
+USAGE: checkhealth demo [-addr address] [-config file]
+
+	Starts a local target server with endpoints exhibiting various behaviors and prints a
+	matching sample configuration file. Run checkhealth against that configuration in another
+	terminal to see how each behavior is reported.
+
+FLAGS:
+
+	-addr address
+		The address for the demo server to listen on. Defaults to 127.0.0.1:8099.
+
+	-config file
+		Writes the sample configuration to file in addition to printing it to the console.
+`
+
+// DemoDefaultAddr is the address the demo server listens on when -addr isn't provided.
+const DemoDefaultAddr string = "127.0.0.1:8099"
+
+// DemoSlowDelay is how long the demo server's slow endpoint waits before responding. It is longer
+// than the default 500ms latency limit so the endpoint is reported as down.
+const DemoSlowDelay time.Duration = 750 * time.Millisecond
+
+// DemoHandler returns an http.Handler serving the demo target endpoints:
+//
+//	/healthy        always responds with 200
+//	/slow           responds with 200 after DemoSlowDelay
+//	/flaky          alternates between 200 and 503 on every request
+//	/error          always responds with 500
+//	/redirect       redirects to /healthy
+//	/redirect-loop  redirects to itself forever
+//	/post           responds with 200 to a POST with a JSON content type, 400 otherwise
+func DemoHandler() http.Handler {
+	var flaky_count uint64 = 0
+
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/healthy", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(DemoSlowDelay):
+			fmt.Fprintln(w, "ok, eventually")
+		case <-r.Context().Done():
+		}
+	})
+
+	mux.HandleFunc("/flaky", func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddUint64(&flaky_count, 1)%2 == 0 {
+			http.Error(w, "temporarily unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintln(w, "ok, this time")
+	})
+
+	mux.HandleFunc("/error", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+	})
+
+	mux.HandleFunc("/redirect", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/healthy", http.StatusFound)
+	})
+
+	mux.HandleFunc("/redirect-loop", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/redirect-loop", http.StatusFound)
+	})
+
+	mux.HandleFunc("/post", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			http.Error(w, "expected a JSON POST request", http.StatusBadRequest)
+			return
+		}
+
+		// added to ensure that the connection closes properly
+		_, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, "failed to read request body", http.StatusBadRequest)
+			return
+		}
+		fmt.Fprintln(w, "ok")
+	})
+
+	return mux
+}
+
+// DemoConfig returns the endpoint configuration matching the endpoints served by DemoHandler, where
+// base_url is the scheme and host the demo server is reachable at (e.g. "http://127.0.0.1:8099").
+func DemoConfig(base_url string) Endpoints {
+	return Endpoints{
+		{
+			Name: "demo healthy endpoint",
+			Url:  base_url + "/healthy",
+		},
+		{
+			Name: "demo slow endpoint",
+			Url:  base_url + "/slow",
+		},
+		{
+			Name: "demo flaky endpoint",
+			Url:  base_url + "/flaky",
+		},
+		{
+			Name: "demo error endpoint",
+			Url:  base_url + "/error",
+		},
+		{
+			Name: "demo redirect endpoint",
+			Url:  base_url + "/redirect",
+		},
+		{
+			Name: "demo redirect loop endpoint",
+			Url:  base_url + "/redirect-loop",
+		},
+		{
+			Name:   "demo post endpoint",
+			Url:    base_url + "/post",
+			Method: "POST",
+			Headers: map[string]string{
+				"content-type": "application/json",
+				"user-agent":   "checkhealth-demo",
+			},
+			Body: `{"foo":"bar"}`,
+		},
+	}
+}
+
+// RunDemo is the entry point for the demo subcommand. It parses the demo flags from args, prints
+// (and optionally writes) a sample configuration for the demo endpoints and then serves
+// DemoHandler until the process is terminated.
+func RunDemo(args []string) error {
+	flags := flag.NewFlagSet("demo", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	addr := flags.String("addr", DemoDefaultAddr, "")
+	config_file := flags.String("config", "", "")
+
+	if err := flags.Parse(args); err != nil {
+		return fmt.Errorf("failed to parse demo arguments: %v\n%s", err, DemoUsage)
+	}
+	if flags.NArg() != 0 {
+		return fmt.Errorf("demo does not accept positional arguments.\n%s", DemoUsage)
+	}
+
+	// listen before printing the config so the printed port is always correct, even for ":0"
+	listener, err := net.Listen("tcp", *addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %v", *addr, err)
+	}
+	defer listener.Close()
+
+	config, err := yaml.Marshal(DemoConfig("http://" + listener.Addr().String()))
+	if err != nil {
+		return fmt.Errorf("failed to marshal demo config: %v", err)
+	}
+
+	if *config_file != "" {
+		if err := os.WriteFile(*config_file, config, 0644); err != nil {
+			return fmt.Errorf("failed to write demo config: %v", err)
+		}
+	}
+
+	fmt.Printf("# demo server listening on http://%s\n%s", listener.Addr().String(), config)
+	log.Printf("Demo server started. Press Ctrl+C to stop.")
+
+	return http.Serve(listener, DemoHandler())
+}
+
+func init() {
+	RegisterCommand(Command{Name: "demo", Run: RunDemo})
+}
@@ -0,0 +1,137 @@
+//go:build !nodemo
+// +build !nodemo
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-playground/assert/v2"
+)
+
+func TestDemoHandler(t *testing.T) {
+	cases := []struct {
+		name           string
+		method         string
+		path           string
+		contentType    string
+		expectedStatus int
+		expectedHeader string
+	}{
+		{
+			name:           "Healthy Endpoint",
+			method:         "GET",
+			path:           "/healthy",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Error Endpoint",
+			method:         "GET",
+			path:           "/error",
+			expectedStatus: http.StatusInternalServerError,
+		},
+		{
+			name:           "Redirect Endpoint",
+			method:         "GET",
+			path:           "/redirect",
+			expectedStatus: http.StatusFound,
+			expectedHeader: "/healthy",
+		},
+		{
+			name:           "Redirect Loop Endpoint",
+			method:         "GET",
+			path:           "/redirect-loop",
+			expectedStatus: http.StatusFound,
+			expectedHeader: "/redirect-loop",
+		},
+		{
+			name:           "Post Endpoint With JSON",
+			method:         "POST",
+			path:           "/post",
+			contentType:    "application/json",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Post Endpoint With GET",
+			method:         "GET",
+			path:           "/post",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Unknown Endpoint",
+			method:         "GET",
+			path:           "/foo",
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	handler := DemoHandler()
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			request := httptest.NewRequest(tc.method, tc.path, strings.NewReader(`{"foo":"bar"}`))
+			if tc.contentType != "" {
+				request.Header.Set("Content-Type", tc.contentType)
+			}
+			recorder := httptest.NewRecorder()
+
+			handler.ServeHTTP(recorder, request)
+
+			assert.Equal(t, recorder.Code, tc.expectedStatus)
+			assert.Equal(t, recorder.Header().Get("Location"), tc.expectedHeader)
+		})
+	}
+}
+
+func TestDemoHandlerFlaky(t *testing.T) {
+	handler := DemoHandler()
+
+	// the flaky endpoint alternates between success and failure
+	expected := []int{http.StatusOK, http.StatusServiceUnavailable, http.StatusOK, http.StatusServiceUnavailable}
+	for _, status := range expected {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest("GET", "/flaky", nil))
+		assert.Equal(t, recorder.Code, status)
+	}
+}
+
+func TestDemoConfig(t *testing.T) {
+	config := DemoConfig("http://127.0.0.1:8099")
+
+	targets, err := config.CreateNewTargets()
+	assert.Equal(t, err, nil)
+
+	// every demo endpoint is served by the same host, so there is a single domain
+	assert.Equal(t, targets.Domains.Name, "127.0.0.1")
+	assert.Equal(t, targets.Domains.Next, nil)
+
+	for _, endpoint := range config {
+		assert.Equal(t, strings.HasPrefix(endpoint.Url, "http://127.0.0.1:8099/"), true)
+	}
+}
+
+func TestRunDemoInvalidArguments(t *testing.T) {
+	cases := []struct {
+		name string
+		args []string
+	}{
+		{
+			name: "Unknown Flag",
+			args: []string{"-foo"},
+		},
+		{
+			name: "Positional Argument",
+			args: []string{"config.yaml"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := RunDemo(tc.args)
+			assert.NotEqual(t, err, nil)
+		})
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"time"
+)
+
+// EventDerivedMetric is the event type reporting the value of a derived metric. It is emitted to
+// the sinks at the end of each check cycle for every derived metric with a value.
+const EventDerivedMetric string = "derived_metric"
+
+// The aggregates of a derived metric over the checks of a cycle of its endpoints: the ratio
+// (between 0 and 1) or the number of conclusive checks that were down, and the maximum or mean
+// latency of the conclusive checks, in milliseconds.
+const (
+	AggregateDownRatio   string = "down_ratio"
+	AggregateDownCount   string = "down_count"
+	AggregateMaxLatency  string = "max_latency"
+	AggregateMeanLatency string = "mean_latency"
+)
+
+// DerivedMetricConfig declares a metric aggregated every check cycle over the results of a set of
+// endpoints, such as the ratio of critical endpoints that are down, so sinks receive simple
+// aggregates without recording rules.
+type DerivedMetricConfig struct {
+	Name      string `yaml:"name"`
+	Aggregate string `yaml:"aggregate"`
+
+	// Endpoints is a regular expression selecting endpoints by name, and Owner and Domain select
+	// the endpoints of an owner and of a domain. Every endpoint is selected by default.
+	Endpoints string `yaml:"endpoints,omitempty"`
+	Owner     string `yaml:"owner,omitempty"`
+	Domain    string `yaml:"domain,omitempty"`
+
+	// matcher is Endpoints compiled by ValidateDerivedMetrics.
+	matcher *regexp.Regexp
+}
+
+// DerivedEvent is the payload of an EventDerivedMetric event.
+type DerivedEvent struct {
+	Name      string  `json:"name"`
+	Aggregate string  `json:"aggregate"`
+	Value     float64 `json:"value"`
+
+	// Endpoints is the number of selected endpoints with a conclusive check in the cycle.
+	Endpoints int `json:"endpoints"`
+}
+
+// ValidateDerivedMetrics checks that every derived metric has a unique name and a supported
+// aggregate, and compiles their endpoints regular expressions.
+func ValidateDerivedMetrics(metrics []DerivedMetricConfig) error {
+	names := map[string]bool{}
+	for i := range metrics {
+		metric := &metrics[i]
+		if metric.Name == "" {
+			return fmt.Errorf("derived metric %d requires a name", i+1)
+		}
+		if names[metric.Name] {
+			return fmt.Errorf("derived metric %q is declared more than once", metric.Name)
+		}
+		names[metric.Name] = true
+
+		switch metric.Aggregate {
+		case AggregateDownRatio, AggregateDownCount, AggregateMaxLatency, AggregateMeanLatency:
+		default:
+			return fmt.Errorf("derived metric %q has unsupported aggregate %q, expected %q, %q, %q or %q", metric.Name, metric.Aggregate, AggregateDownRatio, AggregateDownCount, AggregateMaxLatency, AggregateMeanLatency)
+		}
+
+		if metric.Endpoints != "" {
+			matcher, err := regexp.Compile(metric.Endpoints)
+			if err != nil {
+				return fmt.Errorf("derived metric %q has invalid endpoints: %v", metric.Name, err)
+			}
+			metric.matcher = matcher
+		}
+	}
+	return nil
+}
+
+// selects reports whether the derived metric aggregates the results of endpoint.
+func (metric *DerivedMetricConfig) selects(endpoint *Endpoint) bool {
+	if metric.Owner != "" && endpoint.Owner != metric.Owner {
+		return false
+	}
+	if metric.Domain != "" && (endpoint.Domain == nil || endpoint.Domain.Name != metric.Domain) {
+		return false
+	}
+	if metric.Endpoints != "" {
+		if metric.matcher == nil {
+			metric.matcher, _ = regexp.Compile(metric.Endpoints)
+		}
+		return metric.matcher != nil && metric.matcher.MatchString(endpoint.Name)
+	}
+	return true
+}
+
+// Compute returns the value of the derived metric over the results of a check cycle, in the order
+// of the endpoints, and the number of selected endpoints with a conclusive check. Unknown results
+// are ignored, and ok is false when no selected endpoint has a conclusive check.
+func (metric *DerivedMetricConfig) Compute(endpoints Endpoints, results []CheckResult) (value float64, count int, ok bool) {
+	down := 0
+	var max_latency, total_latency time.Duration
+	for i, result := range results {
+		if i >= len(endpoints) || result.Status == StatusUnknown || !metric.selects(&endpoints[i]) {
+			continue
+		}
+		count++
+		if result.Status == StatusDown {
+			down++
+		}
+		if result.Latency > max_latency {
+			max_latency = result.Latency
+		}
+		total_latency += result.Latency
+	}
+	if count == 0 {
+		return 0, 0, false
+	}
+
+	switch metric.Aggregate {
+	case AggregateDownRatio:
+		value = float64(down) / float64(count)
+	case AggregateDownCount:
+		value = float64(down)
+	case AggregateMaxLatency:
+		value = latencyMilliseconds(max_latency)
+	case AggregateMeanLatency:
+		value = latencyMilliseconds(total_latency / time.Duration(count))
+	}
+	return value, count, true
+}
+
+// DerivedEvents is a method for HealthCheckTargets that returns an EventDerivedMetric event for
+// each configured derived metric with a value over the results of a check cycle, stamped with the
+// provided timestamp and signed when a signer is configured.
+func (target *HealthCheckTargets) DerivedEvents(results []CheckResult, timestamp time.Time) []Event {
+	if target.Endpoints == nil {
+		return nil
+	}
+
+	var events []Event
+	for i := range target.Settings.DerivedMetrics {
+		metric := &target.Settings.DerivedMetrics[i]
+		value, count, ok := metric.Compute(*target.Endpoints, results)
+		if !ok {
+			continue
+		}
+		event := NewEvent(EventDerivedMetric, timestamp)
+		event.Derived = &DerivedEvent{
+			Name:      metric.Name,
+			Aggregate: metric.Aggregate,
+			Value:     value,
+			Endpoints: count,
+		}
+		events = append(events, event)
+	}
+
+	if err := target.Signer.Sign(events); err != nil {
+		log.Printf("Failed to sign events: %v", err)
+	}
+	return events
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/go-playground/assert/v2"
+)
+
+func TestDerivedMetricCompute(t *testing.T) {
+	endpoints := Endpoints{
+		{Name: "checkout", Url: "https://fetch.com/checkout", Owner: "payments"},
+		{Name: "checkout api", Url: "https://api.fetch.com/checkout", Owner: "payments"},
+		{Name: "careers", Url: "https://fetch.com/careers", Owner: "web"},
+		{Name: "index", Url: "https://fetch.com/", Owner: "web"},
+	}
+	targets, err := endpoints.CreateNewTargets()
+	assert.Equal(t, err, nil)
+	results := []CheckResult{
+		{Status: StatusDown, ErrorKind: ErrorKindTimeout, Latency: 500 * time.Millisecond},
+		{Status: StatusUp, Latency: 100 * time.Millisecond},
+		{Status: StatusDegraded, ErrorKind: ErrorKindLatency, Latency: 300 * time.Millisecond},
+		{Status: StatusUnknown},
+	}
+
+	cases := []struct {
+		name          string
+		metric        DerivedMetricConfig
+		expectedValue float64
+		expectedCount int
+		expectedOk    bool
+	}{
+		{
+			name:          "Down Ratio Of Owner",
+			metric:        DerivedMetricConfig{Aggregate: AggregateDownRatio, Owner: "payments"},
+			expectedValue: 0.5,
+			expectedCount: 2,
+			expectedOk:    true,
+		},
+		{
+			name:          "Down Count Of Every Endpoint",
+			metric:        DerivedMetricConfig{Aggregate: AggregateDownCount},
+			expectedValue: 1,
+			expectedCount: 3,
+			expectedOk:    true,
+		},
+		{
+			name:          "Max Latency Of Names",
+			metric:        DerivedMetricConfig{Aggregate: AggregateMaxLatency, Endpoints: "^c"},
+			expectedValue: 500,
+			expectedCount: 3,
+			expectedOk:    true,
+		},
+		{
+			name:          "Mean Latency Of Domain",
+			metric:        DerivedMetricConfig{Aggregate: AggregateMeanLatency, Domain: "api.fetch.com"},
+			expectedValue: 100,
+			expectedCount: 1,
+			expectedOk:    true,
+		},
+		{
+			name:   "Only Unknown Results",
+			metric: DerivedMetricConfig{Aggregate: AggregateDownRatio, Endpoints: "^index$"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			value, count, ok := tc.metric.Compute(*targets.Endpoints, results)
+			assert.Equal(t, value, tc.expectedValue)
+			assert.Equal(t, count, tc.expectedCount)
+			assert.Equal(t, ok, tc.expectedOk)
+		})
+	}
+}
+
+func TestValidateDerivedMetrics(t *testing.T) {
+	cases := []struct {
+		name         string
+		metrics      []DerivedMetricConfig
+		expectedFail bool
+	}{
+		{name: "Valid", metrics: []DerivedMetricConfig{{Name: "critical_down", Aggregate: AggregateDownRatio, Endpoints: "critical"}}},
+		{name: "Missing Name", metrics: []DerivedMetricConfig{{Aggregate: AggregateDownRatio}}, expectedFail: true},
+		{name: "Duplicate Name", metrics: []DerivedMetricConfig{{Name: "down", Aggregate: AggregateDownRatio}, {Name: "down", Aggregate: AggregateDownCount}}, expectedFail: true},
+		{name: "Unsupported Aggregate", metrics: []DerivedMetricConfig{{Name: "p99", Aggregate: "p99_latency"}}, expectedFail: true},
+		{name: "Invalid Endpoints", metrics: []DerivedMetricConfig{{Name: "down", Aggregate: AggregateDownRatio, Endpoints: "("}}, expectedFail: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ValidateDerivedMetrics(tc.metrics)
+			assert.Equal(t, err != nil, tc.expectedFail)
+		})
+	}
+}
+
+func TestDerivedEvents(t *testing.T) {
+	endpoints := Endpoints{
+		{Name: "index", Url: "https://fetch.com/"},
+		{Name: "careers", Url: "https://fetch.com/careers"},
+	}
+	targets, err := endpoints.CreateNewTargets()
+	assert.Equal(t, err, nil)
+	targets.Settings.DerivedMetrics = []DerivedMetricConfig{
+		{Name: "site_down_ratio", Aggregate: AggregateDownRatio},
+		{Name: "status_max_latency", Aggregate: AggregateMaxLatency, Endpoints: "^status$"},
+	}
+	assert.Equal(t, ValidateDerivedMetrics(targets.Settings.DerivedMetrics), nil)
+
+	// the status page isn't configured, so its metric has no value
+	timestamp := time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+	events := targets.DerivedEvents([]CheckResult{
+		{Status: StatusUp, Latency: 120 * time.Millisecond},
+		{Status: StatusDown, ErrorKind: ErrorKindStatus, StatusCode: 503},
+	}, timestamp)
+
+	var output bytes.Buffer
+	assert.Equal(t, WriteEvents(&output, events), nil)
+	assert.Equal(t, output.String(), `{"schema_version":"1.18","type":"derived_metric","timestamp":"2023-06-01T12:00:00Z",`+
+		`"derived":{"name":"site_down_ratio","aggregate":"down_ratio","value":0.5,"endpoints":2}}`+"\n")
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// DNSFailureDown, DNSFailureRetry and DNSFailureUnknown are the policies for handling DNS
+// resolution failures of an endpoint's host:
+//
+//	down     the endpoint is marked down immediately (default)
+//	retry    the request is retried once resolving the host with the secondary resolver, and the
+//	         endpoint is marked down only if that fails as well
+//	unknown  the check is recorded as unknown and excluded from availability, since resolver
+//	         flakiness at the monitor says nothing about the target
+const (
+	DNSFailureDown    string = "down"
+	DNSFailureRetry   string = "retry"
+	DNSFailureUnknown string = "unknown"
+)
+
+// acceptsDNSRetry reports whether the retry DNS failure policy can be used by the endpoint, whose
+// retry resolves the host with a client of its own: endpoints sending the PROXY protocol, or with
+// TLS options, need the transport of their own client.
+func (endpoint *Endpoint) acceptsDNSRetry() bool {
+	return endpoint.ProxyProtocol == "" && !endpoint.hasTLSOptions()
+}
+
+// IsDNSError reports whether err was caused by a failure to resolve a host name.
+func IsDNSError(err error) bool {
+	var dns_err *net.DNSError
+	return errors.As(err, &dns_err)
+}
+
+// resolver_clients caches the HTTP clients resolving hosts through a secondary resolver, by
+// resolver address, so connections are reused across checks.
+var resolver_clients = struct {
+	sync.Mutex
+	clients map[string]*http.Client
+}{
+	clients: map[string]*http.Client{},
+}
+
+// ResolverClient returns an HTTP client that resolves host names with the DNS server at address
+// (host:port) instead of the system resolver.
+func ResolverClient(address string) *http.Client {
+	resolver_clients.Lock()
+	defer resolver_clients.Unlock()
+
+	if client, ok := resolver_clients.clients[address]; ok {
+		return client
+	}
+
+	dialer := &net.Dialer{
+		Timeout:  30 * time.Second,
+		Resolver: NewResolver(address),
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+
+	client := &http.Client{Transport: transport}
+	resolver_clients.clients[address] = client
+	return client
+}
+
+// NewResolver returns a resolver querying the DNS server at address (host:port) instead of the
+// servers of the system configuration.
+func NewResolver(address string) *net.Resolver {
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network string, _ string) (net.Conn, error) {
+			var resolver_dialer net.Dialer
+			return resolver_dialer.DialContext(ctx, network, address)
+		},
+	}
+}
+
+// RecordUnknown is a method for a domain to record a check whose outcome is unknown. Unknown checks
+// are counted separately and don't affect the domain's availability.
+//
+// Returns immediately if the domain pointer passed is nil.
+func (domain *Domain) RecordUnknown() {
+	if domain == nil {
+		return
+	}
+
+	domain_stats.Lock()
+	defer domain_stats.Unlock()
+
+	domain.UnknownCount += 1
+}
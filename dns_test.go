@@ -0,0 +1,240 @@
+package main
+
+import (
+	"encoding/binary"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/go-playground/assert/v2"
+)
+
+// startTestResolver starts a DNS server on a local UDP port that answers every A query with
+// 127.0.0.1 and every other query with an empty answer. It returns the server's address.
+func startTestResolver(t *testing.T) string {
+	t.Helper()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to start test resolver: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	go func() {
+		buffer := make([]byte, 512)
+		for {
+			n, addr, err := conn.ReadFrom(buffer)
+			if err != nil {
+				return
+			}
+			query := buffer[:n]
+
+			// find the end of the question: name labels, then type and class
+			end := 12
+			for end < n && query[end] != 0 {
+				end += int(query[end]) + 1
+			}
+			end += 5
+			if end > n {
+				continue
+			}
+			question_type := binary.BigEndian.Uint16(query[end-4 : end-2])
+
+			response := append([]byte{}, query[:end]...)
+			response[2], response[3] = 0x81, 0x80 // response, recursion desired and available
+			binary.BigEndian.PutUint16(response[6:8], 0)
+			binary.BigEndian.PutUint16(response[8:10], 0)
+			binary.BigEndian.PutUint16(response[10:12], 0)
+
+			if question_type == 1 {
+				binary.BigEndian.PutUint16(response[6:8], 1)
+				response = append(response,
+					0xc0, 0x0c, // pointer to the question name
+					0x00, 0x01, 0x00, 0x01, // type A, class IN
+					0x00, 0x00, 0x00, 0x3c, // TTL
+					0x00, 0x04, 127, 0, 0, 1,
+				)
+			}
+
+			conn.WriteTo(response, addr)
+		}
+	}()
+
+	return conn.LocalAddr().String()
+}
+
+func TestIsDNSError(t *testing.T) {
+	_, lookup_err := net.LookupHost("nonexistent.invalid")
+
+	assert.Equal(t, IsDNSError(lookup_err), true)
+	assert.Equal(t, IsDNSError(&url.Error{Op: "Get", URL: "http://nonexistent.invalid/", Err: lookup_err}), true)
+	assert.Equal(t, IsDNSError(nil), false)
+	assert.Equal(t, IsDNSError(&net.OpError{Op: "dial"}), false)
+}
+
+func TestGetEndpointHealthDNSFailure(t *testing.T) {
+	mock_server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer mock_server.Close()
+
+	server_url, err := url.Parse(mock_server.URL)
+	assert.Equal(t, err, nil)
+
+	// the host only resolves through the test resolver
+	unresolvable_url := "http://nonexistent.invalid:" + server_url.Port() + "/"
+	resolver := startTestResolver(t)
+
+	cases := []struct {
+		name            string
+		dnsFailure      string
+		dnsResolver     string
+		expectedUp      int
+		expectedTotal   int
+		expectedUnknown int
+	}{
+		{
+			name:          "Default Policy Marks Down",
+			dnsFailure:    "",
+			expectedUp:    0,
+			expectedTotal: 1,
+		},
+		{
+			name:          "Down Policy",
+			dnsFailure:    DNSFailureDown,
+			expectedUp:    0,
+			expectedTotal: 1,
+		},
+		{
+			name:            "Unknown Policy",
+			dnsFailure:      DNSFailureUnknown,
+			expectedUp:      0,
+			expectedTotal:   0,
+			expectedUnknown: 1,
+		},
+		{
+			name:          "Retry Policy With Working Resolver",
+			dnsFailure:    DNSFailureRetry,
+			dnsResolver:   resolver,
+			expectedUp:    1,
+			expectedTotal: 1,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			endpoint := Endpoint{
+				Name:        "DNS Test",
+				Url:         unresolvable_url,
+				DNSFailure:  tc.dnsFailure,
+				DNSResolver: tc.dnsResolver,
+				Domain:      &Domain{Name: "nonexistent.invalid"},
+			}
+
+			endpoint.Domain.RecordResult(endpoint.GetEndpointHealth(2 * time.Second))
+
+			assert.Equal(t, endpoint.Domain.UpCount, tc.expectedUp)
+			assert.Equal(t, endpoint.Domain.TotalRequests, tc.expectedTotal)
+			assert.Equal(t, endpoint.Domain.UnknownCount, tc.expectedUnknown)
+		})
+	}
+}
+
+func TestApplySettingsDNSFailure(t *testing.T) {
+	cases := []struct {
+		name             string
+		config           Config
+		expectedFail     bool
+		expectedPolicy   string
+		expectedResolver string
+	}{
+		{
+			name: "Endpoint Inherits Settings",
+			config: Config{
+				Settings:  Settings{DNSFailure: DNSFailureRetry, DNSResolver: "8.8.8.8:53"},
+				Endpoints: Endpoints{{Name: "example"}},
+			},
+			expectedPolicy:   DNSFailureRetry,
+			expectedResolver: "8.8.8.8:53",
+		},
+		{
+			name: "Endpoint Overrides Settings",
+			config: Config{
+				Settings:  Settings{DNSFailure: DNSFailureRetry, DNSResolver: "8.8.8.8:53"},
+				Endpoints: Endpoints{{Name: "example", DNSFailure: DNSFailureUnknown}},
+			},
+			expectedPolicy:   DNSFailureUnknown,
+			expectedResolver: "8.8.8.8:53",
+		},
+		{
+			name: "Retry Without Resolver",
+			config: Config{
+				Endpoints: Endpoints{{Name: "example", DNSFailure: DNSFailureRetry}},
+			},
+			expectedFail: true,
+		},
+		{
+			name: "Retry With TLS Options",
+			config: Config{
+				Endpoints: Endpoints{{Name: "example", Url: "https://example.com/", DNSFailure: DNSFailureRetry, DNSResolver: "8.8.8.8:53", TLSServerName: "internal.example.com"}},
+			},
+			expectedFail: true,
+		},
+		{
+			name: "Retry With Proxy Protocol",
+			config: Config{
+				Endpoints: Endpoints{{Name: "example", Url: "http://example.com/", DNSFailure: DNSFailureRetry, DNSResolver: "8.8.8.8:53", ProxyProtocol: ProxyProtocolV1}},
+			},
+			expectedFail: true,
+		},
+		{
+			name: "Settings Retry With TLS Options",
+			config: Config{
+				Settings:  Settings{DNSFailure: DNSFailureRetry, DNSResolver: "8.8.8.8:53"},
+				Endpoints: Endpoints{{Name: "example", Url: "https://example.com/", TLSServerName: "internal.example.com"}},
+			},
+			expectedResolver: "8.8.8.8:53",
+		},
+		{
+			name: "Settings Retry With Proxy Protocol",
+			config: Config{
+				Settings:  Settings{DNSFailure: DNSFailureRetry, DNSResolver: "8.8.8.8:53"},
+				Endpoints: Endpoints{{Name: "example", Url: "http://example.com/", ProxyProtocol: ProxyProtocolV1}},
+			},
+			expectedResolver: "8.8.8.8:53",
+		},
+		{
+			name: "Unsupported Policy",
+			config: Config{
+				Endpoints: Endpoints{{Name: "example", DNSFailure: "ignore"}},
+			},
+			expectedFail: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.config.ApplySettings()
+			if tc.expectedFail {
+				assert.NotEqual(t, err, nil)
+				return
+			}
+
+			assert.Equal(t, err, nil)
+			assert.Equal(t, tc.config.Endpoints[0].DNSFailure, tc.expectedPolicy)
+			assert.Equal(t, tc.config.Endpoints[0].DNSResolver, tc.expectedResolver)
+		})
+	}
+}
+
+func TestRecordUnknown(t *testing.T) {
+	var nil_domain *Domain
+	nil_domain.RecordUnknown()
+	assert.Equal(t, nil_domain, nil)
+
+	domain := &Domain{Name: "example.com", UpCount: 1, TotalRequests: 1}
+	domain.RecordUnknown()
+	assert.Equal(t, domain.UnknownCount, 1)
+	assert.Equal(t, domain.Availability(), 100)
+}
@@ -0,0 +1,420 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DNS endpoints look up the records of the name in their dns://name URL, with the server of
+// dns_resolver or the system configuration, and assert on their contents, so accidental changes
+// of records such as the SPF policy or the mail exchangers are detected. The records, one per line
+// in their presentation format, are evaluated as the body by the body assertions.
+
+// EndpointTypeDNS is the type of DNS record endpoint checks.
+const EndpointTypeDNS string = "dns"
+
+// RecordTypeA, RecordTypeAAAA, RecordTypeCNAME, RecordTypeTXT, RecordTypeMX, RecordTypeNS and
+// RecordTypeCAA are the record types DNS endpoints look up. A records are looked up by default.
+const (
+	RecordTypeA     string = "A"
+	RecordTypeAAAA  string = "AAAA"
+	RecordTypeCNAME string = "CNAME"
+	RecordTypeTXT   string = "TXT"
+	RecordTypeMX    string = "MX"
+	RecordTypeNS    string = "NS"
+	RecordTypeCAA   string = "CAA"
+)
+
+// ErrorKindRecord classifies DNS checks whose records didn't include the expected ones.
+const ErrorKindRecord string = "record"
+
+// dnsTypeCAA is the wire type of CAA records, which aren't supported by net.Resolver.
+const dnsTypeCAA uint16 = 257
+
+// ResolvConfPath is the resolver configuration the server of CAA lookups is read from when
+// dns_resolver isn't set.
+const ResolvConfPath string = "/etc/resolv.conf"
+
+// validateDNS rejects DNS endpoints whose URL doesn't name a host, whose record type isn't
+// supported, or which set a success predicate.
+func (endpoint *Endpoint) validateDNS() error {
+	if endpoint.SuccessWhen != "" {
+		return errors.New("success_when isn't supported by dns endpoints")
+	}
+	if _, err := endpoint.dnsName(); err != nil {
+		return err
+	}
+	switch endpoint.recordType() {
+	case RecordTypeA, RecordTypeAAAA, RecordTypeCNAME, RecordTypeTXT, RecordTypeMX, RecordTypeNS, RecordTypeCAA:
+		return nil
+	default:
+		return fmt.Errorf("unsupported record_type %q, expected one of A, AAAA, CNAME, TXT, MX, NS or CAA", endpoint.RecordType)
+	}
+}
+
+// dnsName returns the name looked up by the DNS endpoint.
+func (endpoint *Endpoint) dnsName() (string, error) {
+	target, err := url.Parse(endpoint.Url)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse url: %v", err)
+	}
+	if target.Scheme != EndpointTypeDNS || target.Hostname() == "" || target.Port() != "" {
+		return "", fmt.Errorf("url %q of a dns endpoint must be of the form dns://name", endpoint.Url)
+	}
+	return target.Hostname(), nil
+}
+
+// recordType returns the record type looked up by the DNS endpoint.
+func (endpoint *Endpoint) recordType() string {
+	if endpoint.RecordType == "" {
+		return RecordTypeA
+	}
+	return strings.ToUpper(endpoint.RecordType)
+}
+
+// runDNSCheck looks up the records of the DNS endpoint and returns its result. The endpoint is up
+// when the lookup succeeds, the expected records are present, in order with ExpectRecordsOrdered,
+// and the body assertions hold for the records.
+func (endpoint *Endpoint) runDNSCheck(ctx context.Context) CheckResult {
+	result := CheckResult{Status: StatusUp}
+
+	name, err := endpoint.dnsName()
+	if err != nil {
+		result.fail(StatusDown, ErrorKindConnection, err)
+		return result
+	}
+
+	body_regex, err := endpoint.bodyRegex()
+	if err != nil {
+		result.fail(StatusDown, ErrorKindBody, fmt.Errorf("failed to compile expect_body_regex: %w", err))
+		return result
+	}
+
+	start := time.Now()
+	records, err := endpoint.lookupRecords(ctx, name)
+	result.Latency = time.Since(start)
+	if err != nil {
+		result.fail(StatusDown, ErrorKind(err), err)
+		return result
+	}
+
+	if err := checkRecords(endpoint.recordType(), records, endpoint.ExpectRecords, endpoint.ExpectRecordsOrdered); err != nil {
+		result.fail(StatusDown, ErrorKindRecord, err)
+		return result
+	}
+
+	body := []byte(strings.Join(records, "\n") + "\n")
+	if err := endpoint.checkBody(body, body_regex); err != nil {
+		result.fail(StatusDown, ErrorKindBody, err)
+		return result
+	}
+
+	return result
+}
+
+// lookupRecords returns the records of name of the endpoint's record type, in their presentation
+// format. MX records are ordered by preference, and other records sorted, except TXT records which
+// are kept in the order of the response.
+func (endpoint *Endpoint) lookupRecords(ctx context.Context, name string) ([]string, error) {
+	resolver := net.DefaultResolver
+	if endpoint.DNSResolver != "" {
+		resolver = NewResolver(endpoint.DNSResolver)
+	}
+
+	var records []string
+	switch endpoint.recordType() {
+	case RecordTypeA, RecordTypeAAAA:
+		network := "ip4"
+		if endpoint.recordType() == RecordTypeAAAA {
+			network = "ip6"
+		}
+		addresses, err := resolver.LookupIP(ctx, network, name)
+		if err != nil {
+			return nil, err
+		}
+		for _, address := range addresses {
+			records = append(records, address.String())
+		}
+		sort.Strings(records)
+	case RecordTypeCNAME:
+		canonical, err := resolver.LookupCNAME(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		records = []string{normalizeRecordName(canonical)}
+	case RecordTypeTXT:
+		texts, err := resolver.LookupTXT(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		records = texts
+	case RecordTypeMX:
+		exchangers, err := resolver.LookupMX(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		sort.SliceStable(exchangers, func(i, j int) bool {
+			if exchangers[i].Pref != exchangers[j].Pref {
+				return exchangers[i].Pref < exchangers[j].Pref
+			}
+			return exchangers[i].Host < exchangers[j].Host
+		})
+		for _, exchanger := range exchangers {
+			records = append(records, fmt.Sprintf("%d %s", exchanger.Pref, normalizeRecordName(exchanger.Host)))
+		}
+	case RecordTypeNS:
+		servers, err := resolver.LookupNS(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		for _, server := range servers {
+			records = append(records, normalizeRecordName(server.Host))
+		}
+		sort.Strings(records)
+	case RecordTypeCAA:
+		server := endpoint.DNSResolver
+		if server == "" {
+			var err error
+			if server, err = systemNameserver(ResolvConfPath); err != nil {
+				return nil, err
+			}
+		}
+		var err error
+		if records, err = LookupCAA(ctx, server, name); err != nil {
+			return nil, err
+		}
+		sort.Strings(records)
+	}
+	return records, nil
+}
+
+// normalizeRecordName lowercases a domain name and removes its trailing dot, so names compare equal
+// regardless of how they were written.
+func normalizeRecordName(name string) string {
+	return strings.TrimSuffix(strings.ToLower(name), ".")
+}
+
+// normalizeRecord normalizes a record in presentation format for comparison. Names are compared
+// case-insensitively and without their trailing dot, and TXT records are compared exactly.
+func normalizeRecord(record_type string, record string) string {
+	if record_type == RecordTypeTXT {
+		return record
+	}
+	fields := strings.Fields(record)
+	for i := range fields {
+		fields[i] = normalizeRecordName(fields[i])
+	}
+	return strings.Join(fields, " ")
+}
+
+// checkRecords returns an error if any of the expected records isn't among records, or, when
+// ordered is set, if they don't appear in the same order as in records.
+func checkRecords(record_type string, records []string, expected []string, ordered bool) error {
+	position := map[string]int{}
+	for i := len(records) - 1; i >= 0; i-- {
+		position[normalizeRecord(record_type, records[i])] = i
+	}
+
+	var missing []string
+	previous := -1
+	for _, record := range expected {
+		i, ok := position[normalizeRecord(record_type, record)]
+		if !ok {
+			missing = append(missing, strconv.Quote(record))
+			continue
+		}
+		if ordered && i < previous {
+			return fmt.Errorf("%s record %q is out of order, got %s", record_type, record, strings.Join(records, ", "))
+		}
+		previous = i
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("missing %s records %s, got %s", record_type, strings.Join(missing, ", "), strings.Join(records, ", "))
+	}
+	return nil
+}
+
+// systemNameserver returns the address of the first nameserver of the resolver configuration at
+// path.
+func systemNameserver(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read resolver configuration: %v", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == "nameserver" {
+			return net.JoinHostPort(fields[1], "53"), nil
+		}
+	}
+	return "", fmt.Errorf("no nameserver in %s, set dns_resolver", path)
+}
+
+// LookupCAA returns the CAA records of name, as "flags tag \"value\"", queried from the DNS server
+// at address (host:port). Names without CAA records return no records. Truncated UDP responses are
+// queried again over TCP.
+func LookupCAA(ctx context.Context, address string, name string) ([]string, error) {
+	query, id, err := newDNSQuery(name, dnsTypeCAA)
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := exchangeDNS(ctx, "udp", address, query)
+	if err == nil && len(response) > 2 && response[2]&0x02 != 0 {
+		response, err = exchangeDNS(ctx, "tcp", address, query)
+	}
+	if err != nil {
+		return nil, &net.DNSError{Err: err.Error(), Name: name, Server: address}
+	}
+	return parseCAAResponse(response, id, name, address)
+}
+
+// newDNSQuery returns a recursive query for the records of name of record_type, and its id.
+func newDNSQuery(name string, record_type uint16) ([]byte, uint16, error) {
+	var id_bytes [2]byte
+	if _, err := rand.Read(id_bytes[:]); err != nil {
+		return nil, 0, err
+	}
+	id := binary.BigEndian.Uint16(id_bytes[:])
+
+	// header: id, recursion desired, one question
+	query := []byte{id_bytes[0], id_bytes[1], 0x01, 0x00, 0, 1, 0, 0, 0, 0, 0, 0}
+	for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		if len(label) == 0 || len(label) > 63 {
+			return nil, 0, fmt.Errorf("invalid DNS name %q", name)
+		}
+		query = append(query, byte(len(label)))
+		query = append(query, label...)
+	}
+	query = append(query, 0)
+	query = append(query, byte(record_type>>8), byte(record_type), 0, 1)
+	return query, id, nil
+}
+
+// exchangeDNS sends query to the DNS server at address over network and returns its response.
+func exchangeDNS(ctx context.Context, network string, address string, query []byte) ([]byte, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, network, address)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	if network == "tcp" {
+		// messages over TCP are prefixed with their length
+		message := make([]byte, 2, 2+len(query))
+		binary.BigEndian.PutUint16(message, uint16(len(query)))
+		if _, err := conn.Write(append(message, query...)); err != nil {
+			return nil, err
+		}
+		var length [2]byte
+		if _, err := io.ReadFull(conn, length[:]); err != nil {
+			return nil, err
+		}
+		response := make([]byte, binary.BigEndian.Uint16(length[:]))
+		_, err := io.ReadFull(conn, response)
+		return response, err
+	}
+
+	if _, err := conn.Write(query); err != nil {
+		return nil, err
+	}
+	response := make([]byte, 4096)
+	n, err := conn.Read(response)
+	return response[:n], err
+}
+
+// parseCAAResponse returns the CAA records in the answer of a DNS response to the query id.
+func parseCAAResponse(response []byte, id uint16, name string, server string) ([]string, error) {
+	invalid := &net.DNSError{Err: "invalid DNS response", Name: name, Server: server}
+	if len(response) < 12 || binary.BigEndian.Uint16(response) != id || response[2]&0x80 == 0 {
+		return nil, invalid
+	}
+	switch response[3] & 0x0f {
+	case 0:
+	case 3:
+		return nil, &net.DNSError{Err: "no such host", Name: name, Server: server, IsNotFound: true}
+	default:
+		return nil, &net.DNSError{Err: fmt.Sprintf("server failure with rcode %d", response[3]&0x0f), Name: name, Server: server}
+	}
+	questions := binary.BigEndian.Uint16(response[4:])
+	answers := binary.BigEndian.Uint16(response[6:])
+
+	offset := 12
+	for i := uint16(0); i < questions; i++ {
+		var ok bool
+		if offset, ok = skipDNSName(response, offset); !ok || offset+4 > len(response) {
+			return nil, invalid
+		}
+		offset += 4
+	}
+
+	var records []string
+	for i := uint16(0); i < answers; i++ {
+		var ok bool
+		if offset, ok = skipDNSName(response, offset); !ok || offset+10 > len(response) {
+			return nil, invalid
+		}
+		record_type := binary.BigEndian.Uint16(response[offset:])
+		length := int(binary.BigEndian.Uint16(response[offset+8:]))
+		offset += 10
+		if offset+length > len(response) {
+			return nil, invalid
+		}
+		data := response[offset : offset+length]
+		offset += length
+
+		// answers also hold the CNAME records followed to the CAA records
+		if record_type != dnsTypeCAA {
+			continue
+		}
+		if len(data) < 2 || 2+int(data[1]) > len(data) {
+			return nil, invalid
+		}
+		tag := string(data[2 : 2+data[1]])
+		records = append(records, fmt.Sprintf("%d %s %q", data[0], strings.ToLower(tag), string(data[2+data[1]:])))
+	}
+	return records, nil
+}
+
+// skipDNSName returns the offset following the possibly compressed name at offset in message.
+func skipDNSName(message []byte, offset int) (int, bool) {
+	for offset < len(message) {
+		length := int(message[offset])
+		switch {
+		case length == 0:
+			return offset + 1, true
+		case length&0xc0 == 0xc0:
+			// a pointer ends the name
+			return offset + 2, offset+2 <= len(message)
+		default:
+			offset += 1 + length
+		}
+	}
+	return 0, false
+}
+
+func init() {
+	RegisterCheckType(EndpointTypeDNS, CheckType{
+		Validate: (*Endpoint).validateDNS,
+		Check:    (*Endpoint).runDNSCheck,
+	})
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-playground/assert/v2"
+)
+
+// dnsTestRecord is a record served by serveDNSTest, with its wire type and data.
+type dnsTestRecord struct {
+	record_type uint16
+	data        []byte
+}
+
+// dnsTestName encodes name in wire format, without compression.
+func dnsTestName(name string) []byte {
+	var encoded []byte
+	for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		encoded = append(encoded, byte(len(label)))
+		encoded = append(encoded, label...)
+	}
+	return append(encoded, 0)
+}
+
+// serveDNSTest is a minimal UDP DNS server answering queries for example.com with its records, and
+// queries for other names with NXDOMAIN. It returns the address of the server.
+func serveDNSTest(t *testing.T) string {
+	mx := func(preference uint16, host string) []byte {
+		return append([]byte{byte(preference >> 8), byte(preference)}, dnsTestName(host)...)
+	}
+	caa := func(tag string, value string) []byte {
+		return append(append([]byte{0, byte(len(tag))}, tag...), value...)
+	}
+	txt := func(text string) []byte {
+		return append([]byte{byte(len(text))}, text...)
+	}
+	records := []dnsTestRecord{
+		{1, []byte{192, 0, 2, 10}},
+		{1, []byte{192, 0, 2, 1}},
+		{16, txt("v=spf1 include:_spf.example.com -all")},
+		{16, txt("google-site-verification=abc")},
+		{15, mx(20, "mx2.example.com")},
+		{15, mx(10, "mx1.example.com")},
+		{2, dnsTestName("ns2.example.net")},
+		{2, dnsTestName("ns1.example.net")},
+		{257, caa("issue", "letsencrypt.org")},
+	}
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.Equal(t, err, nil)
+	t.Cleanup(func() { conn.Close() })
+
+	go func() {
+		buffer := make([]byte, 512)
+		for {
+			n, address, err := conn.ReadFrom(buffer)
+			if err != nil {
+				return
+			}
+			query := buffer[:n]
+			end, ok := skipDNSName(query, 12)
+			if !ok || end+4 > len(query) {
+				continue
+			}
+			name := string(query[12:end])
+			question_type := binary.BigEndian.Uint16(query[end:])
+
+			// the question is echoed, and answers point to its name
+			response := append([]byte{query[0], query[1], 0x81, 0x80, 0, 1, 0, 0, 0, 0, 0, 0}, query[12:end+4]...)
+			answers := 0
+			if name != string(dnsTestName("example.com")) {
+				response[3] |= 3
+			} else {
+				for _, record := range records {
+					if record.record_type != question_type {
+						continue
+					}
+					response = append(response, 0xc0, 12, byte(record.record_type>>8), byte(record.record_type), 0, 1, 0, 0, 0, 60)
+					response = append(response, byte(len(record.data)>>8), byte(len(record.data)))
+					response = append(response, record.data...)
+					answers++
+				}
+			}
+			binary.BigEndian.PutUint16(response[6:], uint16(answers))
+			conn.WriteTo(response, address)
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+func TestRunDNSCheck(t *testing.T) {
+	address := serveDNSTest(t)
+
+	cases := []struct {
+		name              string
+		endpoint          Endpoint
+		expectedStatus    string
+		expectedErrorKind string
+	}{
+		{
+			name:           "A Records",
+			endpoint:       Endpoint{Url: "dns://example.com", ExpectRecords: []string{"192.0.2.1"}},
+			expectedStatus: StatusUp,
+		},
+		{
+			name:              "Missing A Record",
+			endpoint:          Endpoint{Url: "dns://example.com", ExpectRecords: []string{"192.0.2.99"}},
+			expectedStatus:    StatusDown,
+			expectedErrorKind: ErrorKindRecord,
+		},
+		{
+			name:           "SPF Present",
+			endpoint:       Endpoint{Url: "dns://example.com", RecordType: "TXT", ExpectBodyRegex: `(?m)^v=spf1 .*-all$`},
+			expectedStatus: StatusUp,
+		},
+		{
+			name:              "SPF Changed",
+			endpoint:          Endpoint{Url: "dns://example.com", RecordType: "txt", ExpectRecords: []string{"v=spf1 -all"}},
+			expectedStatus:    StatusDown,
+			expectedErrorKind: ErrorKindRecord,
+		},
+		{
+			name:           "MX Ordered",
+			endpoint:       Endpoint{Url: "dns://example.com", RecordType: "MX", ExpectRecords: []string{"10 MX1.example.com.", "20 mx2.example.com"}, ExpectRecordsOrdered: true},
+			expectedStatus: StatusUp,
+		},
+		{
+			name:              "MX Out Of Order",
+			endpoint:          Endpoint{Url: "dns://example.com", RecordType: "MX", ExpectRecords: []string{"20 mx2.example.com", "10 mx1.example.com"}, ExpectRecordsOrdered: true},
+			expectedStatus:    StatusDown,
+			expectedErrorKind: ErrorKindRecord,
+		},
+		{
+			name:           "NS Records",
+			endpoint:       Endpoint{Url: "dns://example.com", RecordType: "NS", ExpectRecords: []string{"ns1.example.net", "ns2.example.net"}},
+			expectedStatus: StatusUp,
+		},
+		{
+			name:           "CAA Records",
+			endpoint:       Endpoint{Url: "dns://example.com", RecordType: "CAA", ExpectRecords: []string{`0 issue "letsencrypt.org"`}},
+			expectedStatus: StatusUp,
+		},
+		{
+			name:              "Unknown Name",
+			endpoint:          Endpoint{Url: "dns://missing.example.com", RecordType: "CAA"},
+			expectedStatus:    StatusDown,
+			expectedErrorKind: ErrorKindDNS,
+		},
+		{
+			name:              "Body Assertion",
+			endpoint:          Endpoint{Url: "dns://example.com", RecordType: "NS", ExpectBodyContains: "cloudflare"},
+			expectedStatus:    StatusDown,
+			expectedErrorKind: ErrorKindBody,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.endpoint.Name = tc.name
+			tc.endpoint.Type = EndpointTypeDNS
+			tc.endpoint.DNSResolver = address
+			result := tc.endpoint.GetEndpointHealth(2 * time.Second)
+			assert.Equal(t, result.Status, tc.expectedStatus)
+			assert.Equal(t, result.ErrorKind, tc.expectedErrorKind)
+		})
+	}
+}
+
+func TestLookupCAA(t *testing.T) {
+	address := serveDNSTest(t)
+
+	records, err := LookupCAA(context.Background(), address, "example.com")
+	assert.Equal(t, err, nil)
+	assert.Equal(t, records, []string{`0 issue "letsencrypt.org"`})
+
+	_, err = LookupCAA(context.Background(), address, "missing.example.com")
+	dns_err, ok := err.(*net.DNSError)
+	assert.Equal(t, ok, true)
+	assert.Equal(t, dns_err.IsNotFound, true)
+}
+
+func TestCheckRecords(t *testing.T) {
+	records := []string{"10 mx1.example.com", "20 mx2.example.com"}
+
+	cases := []struct {
+		name         string
+		expected     []string
+		ordered      bool
+		expectedFail bool
+	}{
+		{name: "Present", expected: []string{"20 mx2.example.com"}},
+		{name: "Case And Trailing Dot", expected: []string{"10 MX1.Example.com."}},
+		{name: "Missing", expected: []string{"30 mx3.example.com"}, expectedFail: true},
+		{name: "Unordered", expected: []string{"20 mx2.example.com", "10 mx1.example.com"}},
+		{name: "Out Of Order", expected: []string{"20 mx2.example.com", "10 mx1.example.com"}, ordered: true, expectedFail: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := checkRecords(RecordTypeMX, records, tc.expected, tc.ordered)
+			assert.Equal(t, err != nil, tc.expectedFail)
+		})
+	}
+}
+
+func TestApplySettingsDNS(t *testing.T) {
+	cases := []struct {
+		name         string
+		endpoint     Endpoint
+		expectedFail bool
+	}{
+		{name: "Valid", endpoint: Endpoint{Url: "dns://example.com", RecordType: "MX"}},
+		{name: "Default Record Type", endpoint: Endpoint{Url: "dns://example.com"}},
+		{name: "Wrong Scheme", endpoint: Endpoint{Url: "https://example.com"}, expectedFail: true},
+		{name: "Port", endpoint: Endpoint{Url: "dns://example.com:53"}, expectedFail: true},
+		{name: "Unsupported Record Type", endpoint: Endpoint{Url: "dns://example.com", RecordType: "SRV"}, expectedFail: true},
+		{name: "Success Predicate", endpoint: Endpoint{Url: "dns://example.com", SuccessWhen: "status == 200"}, expectedFail: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.endpoint.Name = "records"
+			tc.endpoint.Type = EndpointTypeDNS
+			config := Config{Endpoints: Endpoints{tc.endpoint}}
+			err := config.ApplySettings()
+			assert.Equal(t, err != nil, tc.expectedFail)
+		})
+	}
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FamilyIPv4 and FamilyIPv6 are the address families checked for dual-stack endpoints.
+const (
+	FamilyIPv4 string = "ipv4"
+	FamilyIPv6 string = "ipv6"
+)
+
+// FamilyStats keeps the availability statistics of a domain for a single address family.
+type FamilyStats struct {
+	UpCount       int
+	TotalRequests int
+}
+
+// Availability computes the cumulative availability of the address family as a percentage, the
+// same way as Domain.Availability.
+func (stats *FamilyStats) Availability() int {
+	domain := Domain{UpCount: stats.UpCount, TotalRequests: stats.TotalRequests}
+	return domain.Availability()
+}
+
+// UpdateFamilyStats is a method for a domain to update the availability statistics of an address
+// family, following UpdateDomainStats.
+//
+// Returns immediately if the domain pointer passed is nil.
+func (domain *Domain) UpdateFamilyStats(family string, is_up bool) {
+	if domain == nil {
+		return
+	}
+
+	domain_stats.Lock()
+	defer domain_stats.Unlock()
+
+	if domain.Families == nil {
+		domain.Families = map[string]*FamilyStats{}
+	}
+	stats, ok := domain.Families[family]
+	if !ok {
+		stats = &FamilyStats{}
+		domain.Families[family] = stats
+	}
+
+	if is_up {
+		stats.UpCount += 1
+	}
+	stats.TotalRequests += 1
+}
+
+// FamilyNames returns the address families with statistics for the domain, sorted by name.
+func (domain *Domain) FamilyNames() []string {
+	var families []string
+	for family := range domain.Families {
+		families = append(families, family)
+	}
+	sort.Strings(families)
+	return families
+}
+
+// LookupFamilies resolves the endpoint's host and returns the first address of each family, using
+// the endpoint's secondary resolver when the DNS failure policy is "retry" and the system resolver
+// fails. IP literals are returned as-is.
+func (endpoint *Endpoint) LookupFamilies(ctx context.Context) (map[string]net.IP, error) {
+	parsed_url, err := url.Parse(endpoint.Url)
+	if err != nil {
+		return nil, err
+	}
+	host := parsed_url.Hostname()
+
+	var addresses []net.IPAddr
+	if ip := net.ParseIP(host); ip != nil {
+		addresses = []net.IPAddr{{IP: ip}}
+	} else {
+		addresses, err = net.DefaultResolver.LookupIPAddr(ctx, host)
+		if err != nil && IsDNSError(err) && endpoint.DNSFailure == DNSFailureRetry {
+			resolver := &net.Resolver{
+				PreferGo: true,
+				Dial: func(ctx context.Context, network string, _ string) (net.Conn, error) {
+					var dialer net.Dialer
+					return dialer.DialContext(ctx, network, endpoint.DNSResolver)
+				},
+			}
+			addresses, err = resolver.LookupIPAddr(ctx, host)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	families := map[string]net.IP{}
+	for _, address := range addresses {
+		family := FamilyIPv6
+		if address.IP.To4() != nil {
+			family = FamilyIPv4
+		}
+		if _, ok := families[family]; !ok {
+			families[family] = address.IP
+		}
+	}
+	return families, nil
+}
+
+// GetDualStackHealth checks the endpoint once per address family of its host, concurrently and
+// within the deadline of ctx, so breakage of one family isn't masked by clients falling back to the
+// other. Each family's result is returned in the result's Families, and the returned status is up
+// only when every family is up.
+//
+// When the host only has addresses of a single family, a regular check is performed.
+func (endpoint *Endpoint) GetDualStackHealth(ctx context.Context) CheckResult {
+	families, err := endpoint.LookupFamilies(ctx)
+	if err != nil {
+		var result CheckResult
+		if IsDNSError(err) && endpoint.DNSFailure == DNSFailureUnknown {
+			result.fail(StatusUnknown, ErrorKindDNS, err)
+		} else {
+			result.fail(StatusDown, ErrorKind(err), err)
+		}
+		return result
+	}
+	if len(families) < 2 {
+		return endpoint.runClientCheck(ctx)
+	}
+
+	return endpoint.checkFamilies(ctx, families)
+}
+
+// checkFamilies checks the endpoint against each provided family address concurrently and returns
+// the per-family results. The overall result carries the failure of a failed family, or else of a
+// degraded family, and the slowest family's latency.
+func (endpoint *Endpoint) checkFamilies(ctx context.Context, families map[string]net.IP) CheckResult {
+	var host string
+	if parsed_url, err := url.Parse(endpoint.Url); err == nil {
+		host = parsed_url.Hostname()
+	}
+
+	var wait_group sync.WaitGroup
+	var mu sync.Mutex
+	results := map[string]CheckResult{}
+
+	for family, ip := range families {
+		wait_group.Add(1)
+		go func(family string, ip net.IP) {
+			defer wait_group.Done()
+
+			client := familyClient(host, ip, endpoint.clientOptions())
+			defer client.CloseIdleConnections()
+
+			result := endpoint.runCheck(ctx, client)
+
+			mu.Lock()
+			results[family] = result
+			mu.Unlock()
+		}(family, ip)
+	}
+	wait_group.Wait()
+
+	overall := CheckResult{Status: StatusUp, Families: results}
+	for _, family := range sortedFamilyNames(results) {
+		result := results[family]
+		if result.Latency > overall.Latency {
+			overall.Latency = result.Latency
+		}
+		if overall.StatusCode == 0 {
+			overall.StatusCode, overall.RedirectTarget = result.StatusCode, result.RedirectTarget
+		}
+		if overall.Components == nil {
+			overall.Components = result.Components
+		}
+		if overall.Method == "" {
+			overall.Method = result.Method
+		}
+		overall.head_rejected = overall.head_rejected || result.head_rejected
+		overall.BytesSent += result.BytesSent
+		overall.BytesReceived += result.BytesReceived
+		if result.backoff > overall.backoff {
+			overall.backoff = result.backoff
+		}
+		switch {
+		case result.Status == StatusDegraded && overall.Up():
+			overall.fail(StatusDegraded, result.ErrorKind, fmt.Errorf("%s: %w", family, result.Err()))
+			overall.StatusCode, overall.RedirectTarget = result.StatusCode, result.RedirectTarget
+		case !result.Available() && overall.Available():
+			overall.fail(StatusDown, result.ErrorKind, fmt.Errorf("%s: %w", family, result.Err()))
+			overall.StatusCode, overall.RedirectTarget = result.StatusCode, result.RedirectTarget
+		}
+	}
+	return overall
+}
+
+// sortedFamilyNames returns the families of results sorted by name, so the reported failure of a
+// dual-stack check is deterministic.
+func sortedFamilyNames(results map[string]CheckResult) []string {
+	var families []string
+	for family := range results {
+		families = append(families, family)
+	}
+	sort.Strings(families)
+	return families
+}
+
+// familyClient returns an HTTP client that connects directly to ip for the requests to host, so a
+// specific address family is exercised. Requests to other hosts, e.g. after a redirect, connect to
+// the addresses of their own host. TLS verification still uses the request's host. The client is
+// tuned with options, whose proxy must be empty or ProxyDirect.
+func familyClient(host string, ip net.IP, options ClientOptions) *http.Client {
+	dialer := &net.Dialer{Timeout: 30 * time.Second}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = func(ctx context.Context, network string, address string) (net.Conn, error) {
+		dial_host, port, err := net.SplitHostPort(address)
+		if err != nil {
+			return nil, err
+		}
+		if !strings.EqualFold(dial_host, host) {
+			return dialer.DialContext(ctx, network, address)
+		}
+		return dialer.DialContext(ctx, network, net.JoinHostPort(ip.String(), port))
+	}
+	options.Proxy = ProxyDirect
+	options.apply(transport)
+
+	return &http.Client{Transport: transport, CheckRedirect: options.checkRedirect()}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/go-playground/assert/v2"
+)
+
+func TestUpdateFamilyStats(t *testing.T) {
+	var nil_domain *Domain
+	nil_domain.UpdateFamilyStats(FamilyIPv4, EndpointUp)
+	assert.Equal(t, nil_domain, nil)
+
+	domain := &Domain{Name: "example.com"}
+	domain.UpdateFamilyStats(FamilyIPv6, EndpointDown)
+	domain.UpdateFamilyStats(FamilyIPv4, EndpointUp)
+	domain.UpdateFamilyStats(FamilyIPv4, EndpointDown)
+
+	assert.Equal(t, domain.FamilyNames(), []string{FamilyIPv4, FamilyIPv6})
+	assert.Equal(t, *domain.Families[FamilyIPv4], FamilyStats{UpCount: 1, TotalRequests: 2})
+	assert.Equal(t, *domain.Families[FamilyIPv6], FamilyStats{UpCount: 0, TotalRequests: 1})
+	assert.Equal(t, domain.Families[FamilyIPv4].Availability(), 50)
+
+	// family statistics don't affect the domain's own counts
+	assert.Equal(t, domain.TotalRequests, 0)
+}
+
+func TestLookupFamilies(t *testing.T) {
+	cases := []struct {
+		name             string
+		url              string
+		expectedFail     bool
+		expectedFamilies map[string]net.IP
+	}{
+		{
+			name:             "IPv4 Literal",
+			url:              "http://127.0.0.1:8080/",
+			expectedFamilies: map[string]net.IP{FamilyIPv4: net.ParseIP("127.0.0.1")},
+		},
+		{
+			name:             "IPv6 Literal",
+			url:              "http://[::1]:8080/",
+			expectedFamilies: map[string]net.IP{FamilyIPv6: net.ParseIP("::1")},
+		},
+		{
+			name:         "Unresolvable Host",
+			url:          "http://nonexistent.invalid/",
+			expectedFail: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			endpoint := Endpoint{Url: tc.url}
+
+			families, err := endpoint.LookupFamilies(context.Background())
+			if tc.expectedFail {
+				assert.NotEqual(t, err, nil)
+				return
+			}
+
+			assert.Equal(t, err, nil)
+			assert.Equal(t, families, tc.expectedFamilies)
+		})
+	}
+}
+
+func TestCheckFamilies(t *testing.T) {
+	// an IPv4 server that is healthy
+	ipv4_server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ipv4_server.Close()
+
+	server_url, err := url.Parse(ipv4_server.URL)
+	assert.Equal(t, err, nil)
+
+	// an IPv6 server on the same port that is broken
+	listener, err := net.Listen("tcp6", "[::1]:"+server_url.Port())
+	if err != nil {
+		t.Skipf("IPv6 loopback is unavailable: %v", err)
+	}
+	ipv6_server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	ipv6_server.Listener.Close()
+	ipv6_server.Listener = listener
+	ipv6_server.Start()
+	defer ipv6_server.Close()
+
+	endpoint := Endpoint{
+		Name:      "Dual Stack Test",
+		Url:       "http://localhost:" + server_url.Port() + "/",
+		DualStack: true,
+		Domain:    &Domain{Name: "localhost"},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	result := endpoint.checkFamilies(ctx, map[string]net.IP{
+		FamilyIPv4: net.ParseIP("127.0.0.1"),
+		FamilyIPv6: net.ParseIP("::1"),
+	})
+
+	// IPv6 breakage isn't masked by the healthy IPv4 path
+	assert.Equal(t, result.Status, StatusDown)
+	assert.Equal(t, result.ErrorKind, ErrorKindStatus)
+	assert.Equal(t, result.StatusCode, http.StatusInternalServerError)
+	assert.Equal(t, result.Families[FamilyIPv4].Status, StatusUp)
+	assert.Equal(t, result.Families[FamilyIPv4].RemoteIP, "127.0.0.1")
+	assert.Equal(t, result.Families[FamilyIPv6].Status, StatusDown)
+	assert.Equal(t, result.Families[FamilyIPv6].RemoteIP, "::1")
+
+	// the domain is only updated once the result is recorded
+	assert.Equal(t, len(endpoint.Domain.Families), 0)
+	endpoint.Domain.RecordResult(result)
+	assert.Equal(t, *endpoint.Domain.Families[FamilyIPv4], FamilyStats{UpCount: 1, TotalRequests: 1})
+	assert.Equal(t, *endpoint.Domain.Families[FamilyIPv6], FamilyStats{UpCount: 0, TotalRequests: 1})
+}
+
+func TestFamilyClientRedirect(t *testing.T) {
+	// a server on another address the endpoint redirects to
+	listener, err := net.Listen("tcp", "127.0.0.2:0")
+	if err != nil {
+		t.Skipf("127.0.0.2 is unavailable: %v", err)
+	}
+	target_server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	target_server.Listener.Close()
+	target_server.Listener = listener
+	target_server.Start()
+	defer target_server.Close()
+
+	mock_server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, target_server.URL+"/", http.StatusFound)
+	}))
+	defer mock_server.Close()
+
+	server_url, err := url.Parse(mock_server.URL)
+	assert.Equal(t, err, nil)
+
+	// only the endpoint's host is pinned to the address, the redirect target is dialed as is
+	client := familyClient("fetch.com", net.ParseIP("127.0.0.1"), ClientOptions{})
+	defer client.CloseIdleConnections()
+	response, err := client.Get("http://fetch.com:" + server_url.Port() + "/")
+	if err != nil {
+		t.Fatalf("failed to follow the redirect: %v", err)
+	}
+	response.Body.Close()
+	assert.Equal(t, response.StatusCode, http.StatusOK)
+	assert.Equal(t, response.Request.URL.Host, listener.Addr().String())
+}
+
+func TestGetDualStackHealthSingleFamily(t *testing.T) {
+	mock_server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer mock_server.Close()
+
+	endpoint := Endpoint{
+		Name:      "Single Family Test",
+		Url:       mock_server.URL,
+		DualStack: true,
+		Domain:    &Domain{Name: "127.0.0.1"},
+	}
+
+	// a host with a single family is checked normally, without family statistics
+	endpoint.Domain.RecordResult(endpoint.GetEndpointHealth(2 * time.Second))
+	assert.Equal(t, endpoint.Domain.UpCount, 1)
+	assert.Equal(t, endpoint.Domain.TotalRequests, 1)
+	assert.Equal(t, len(endpoint.Domain.Families), 0)
+}
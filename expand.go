@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// ExpandHosts is a method for Endpoints that returns the endpoints with every endpoint listing
+// hosts replaced by one endpoint per host. Each expanded endpoint keeps the path, method, headers
+// and body of its entry, with the host of its URL replaced by the listed host and the host
+// appended to its name, e.g. "api health (10.0.0.1)". Hosts without a port keep the port of the
+// URL. IPv6 addresses are listed bare, e.g. "::1", or in brackets to set a port, e.g. "[::1]:8080".
+//
+// An error is returned if an endpoint listing hosts has an invalid URL, or lists an empty or
+// duplicate host.
+func (endpoints Endpoints) ExpandHosts() (Endpoints, error) {
+	expanded := make(Endpoints, 0, len(endpoints))
+
+	for _, endpoint := range endpoints {
+		if len(endpoint.Hosts) == 0 {
+			expanded = append(expanded, endpoint)
+			continue
+		}
+
+		parsed_url, err := url.Parse(endpoint.Url)
+		if err != nil || parsed_url.Host == "" {
+			return nil, fmt.Errorf("endpoint %q lists hosts but has an invalid url %q", endpoint.Name, endpoint.Url)
+		}
+
+		seen := map[string]bool{}
+		for _, host := range endpoint.Hosts {
+			if host == "" {
+				return nil, fmt.Errorf("endpoint %q lists an empty host", endpoint.Name)
+			}
+			if seen[host] {
+				return nil, fmt.Errorf("endpoint %q lists host %q more than once", endpoint.Name, host)
+			}
+			seen[host] = true
+
+			host_url := *parsed_url
+			host_url.Host = hostWithPort(host, parsed_url.Port())
+
+			host_endpoint := endpoint
+			host_endpoint.Name = fmt.Sprintf("%s (%s)", endpoint.Name, host)
+			host_endpoint.Url = host_url.String()
+			host_endpoint.Hosts = nil
+			if endpoint.Headers != nil {
+				host_endpoint.Headers = make(map[string]string, len(endpoint.Headers))
+				for key, value := range endpoint.Headers {
+					host_endpoint.Headers[key] = value
+				}
+			}
+			expanded = append(expanded, host_endpoint)
+		}
+	}
+
+	return expanded, nil
+}
+
+// ExpandEnvironments is a method for Endpoints that returns the endpoints with every endpoint
+// declaring a path replaced by one endpoint per environment it applies to. The URL of each
+// expanded endpoint is the path joined to the base URL of the environment, and the environment is
+// appended to its name, e.g. "login [staging]". An endpoint without environments applies to every
+// environment.
+//
+// When selected isn't empty, only the selected environments are expanded. Endpoints with a URL
+// apply to every environment and are kept as-is.
+//
+// An error is returned if an endpoint sets both a URL and a path, lists environments without a
+// path, or refers to an environment that isn't defined.
+func (endpoints Endpoints) ExpandEnvironments(environments map[string]string, selected []string) (Endpoints, error) {
+	for _, name := range selected {
+		if _, ok := environments[name]; !ok {
+			return nil, fmt.Errorf("selected environment %q isn't defined in environments", name)
+		}
+	}
+
+	expanded := make(Endpoints, 0, len(endpoints))
+	for _, endpoint := range endpoints {
+		switch {
+		case endpoint.Url != "" && endpoint.Path != "":
+			return nil, fmt.Errorf("endpoint %q sets both a url and a path", endpoint.Name)
+		case endpoint.Path == "" && len(endpoint.Environments) > 0:
+			return nil, fmt.Errorf("endpoint %q lists environments without a path", endpoint.Name)
+		case endpoint.Path == "":
+			expanded = append(expanded, endpoint)
+			continue
+		}
+
+		names := endpoint.Environments
+		if len(names) == 0 {
+			names = sortedEnvironmentNames(environments)
+			if len(names) == 0 {
+				return nil, fmt.Errorf("endpoint %q sets a path, but no environments are defined", endpoint.Name)
+			}
+		}
+
+		for _, name := range names {
+			base, ok := environments[name]
+			if !ok {
+				return nil, fmt.Errorf("endpoint %q refers to environment %q that isn't defined", endpoint.Name, name)
+			}
+			if len(selected) > 0 && !containsString(selected, name) {
+				continue
+			}
+
+			environment_endpoint := endpoint
+			environment_endpoint.Name = fmt.Sprintf("%s [%s]", endpoint.Name, name)
+			environment_endpoint.Url = strings.TrimSuffix(base, "/") + "/" + strings.TrimPrefix(endpoint.Path, "/")
+			environment_endpoint.Path = ""
+			environment_endpoint.Environments = nil
+			expanded = append(expanded, environment_endpoint)
+		}
+	}
+
+	return expanded, nil
+}
+
+// SelectedEnvironments is a method for Settings that returns the environments selected by the env
+// setting, or nil when every environment is checked.
+func (settings Settings) SelectedEnvironments() []string {
+	var selected []string
+	for _, name := range strings.Split(settings.Env, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			selected = append(selected, name)
+		}
+	}
+	return selected
+}
+
+// sortedEnvironmentNames returns the names of the environments in alphabetical order.
+func sortedEnvironmentNames(environments map[string]string) []string {
+	names := make([]string, 0, len(environments))
+	for name := range environments {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
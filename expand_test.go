@@ -0,0 +1,220 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/go-playground/assert/v2"
+)
+
+func TestExpandHosts(t *testing.T) {
+	cases := []struct {
+		name              string
+		endpoints         Endpoints
+		expectedFail      bool
+		expectedEndpoints Endpoints
+	}{
+		{
+			name:              "Without Hosts",
+			endpoints:         Endpoints{{Name: "index", Url: "https://example.com/"}},
+			expectedEndpoints: Endpoints{{Name: "index", Url: "https://example.com/"}},
+		},
+		{
+			name: "Hosts Replace URL Host",
+			endpoints: Endpoints{{
+				Name:    "health",
+				Url:     "https://placeholder/healthz?full=1",
+				Method:  "POST",
+				Headers: map[string]string{"user-agent": "checkhealth"},
+				Hosts:   []string{"api-1.internal", "10.0.0.1"},
+			}},
+			expectedEndpoints: Endpoints{
+				{
+					Name:    "health (api-1.internal)",
+					Url:     "https://api-1.internal/healthz?full=1",
+					Method:  "POST",
+					Headers: map[string]string{"user-agent": "checkhealth"},
+				},
+				{
+					Name:    "health (10.0.0.1)",
+					Url:     "https://10.0.0.1/healthz?full=1",
+					Method:  "POST",
+					Headers: map[string]string{"user-agent": "checkhealth"},
+				},
+			},
+		},
+		{
+			name: "Hosts Keep URL Port",
+			endpoints: Endpoints{{
+				Name:  "health",
+				Url:   "http://placeholder:8080/healthz",
+				Hosts: []string{"api-1.internal", "api-2.internal:9090", "[2001:db8::1]"},
+			}},
+			expectedEndpoints: Endpoints{
+				{Name: "health (api-1.internal)", Url: "http://api-1.internal:8080/healthz"},
+				{Name: "health (api-2.internal:9090)", Url: "http://api-2.internal:9090/healthz"},
+				{Name: "health ([2001:db8::1])", Url: "http://[2001:db8::1]:8080/healthz"},
+			},
+		},
+		{
+			name:         "Relative URL",
+			endpoints:    Endpoints{{Name: "health", Url: "/healthz", Hosts: []string{"api-1.internal"}}},
+			expectedFail: true,
+		},
+		{
+			name:         "Empty Host",
+			endpoints:    Endpoints{{Name: "health", Url: "https://placeholder/", Hosts: []string{""}}},
+			expectedFail: true,
+		},
+		{
+			name:         "Duplicate Host",
+			endpoints:    Endpoints{{Name: "health", Url: "https://placeholder/", Hosts: []string{"a", "a"}}},
+			expectedFail: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			endpoints, err := tc.endpoints.ExpandHosts()
+			if tc.expectedFail {
+				assert.NotEqual(t, err, nil)
+				return
+			}
+
+			assert.Equal(t, err, nil)
+			assert.Equal(t, endpoints, tc.expectedEndpoints)
+		})
+	}
+}
+
+func TestExpandHostsCopiesHeaders(t *testing.T) {
+	endpoints, err := Endpoints{{
+		Name:    "health",
+		Url:     "https://placeholder/",
+		Headers: map[string]string{"user-agent": "checkhealth"},
+		Hosts:   []string{"a", "b"},
+	}}.ExpandHosts()
+	assert.Equal(t, err, nil)
+
+	endpoints[0].Headers["user-agent"] = "changed"
+	assert.Equal(t, endpoints[1].Headers["user-agent"], "checkhealth")
+}
+
+func TestApplySettingsExpandsHosts(t *testing.T) {
+	config := Config{
+		Settings:  Settings{DownAfter: 5},
+		Endpoints: Endpoints{{Name: "health", Url: "https://placeholder/", Hosts: []string{"a", "b"}}},
+	}
+
+	assert.Equal(t, config.ApplySettings(), nil)
+	assert.Equal(t, len(config.Endpoints), 2)
+	assert.Equal(t, config.Endpoints[1].Url, "https://b/")
+	assert.Equal(t, config.Endpoints[1].DownAfter, 5)
+}
+
+func TestExpandEnvironments(t *testing.T) {
+	environments := map[string]string{
+		"production": "https://example.com",
+		"staging":    "https://staging.example.com/api/",
+	}
+
+	cases := []struct {
+		name              string
+		endpoints         Endpoints
+		selected          []string
+		expectedFail      bool
+		expectedEndpoints Endpoints
+	}{
+		{
+			name:              "Absolute URL Kept",
+			endpoints:         Endpoints{{Name: "index", Url: "https://example.org/"}},
+			selected:          []string{"staging"},
+			expectedEndpoints: Endpoints{{Name: "index", Url: "https://example.org/"}},
+		},
+		{
+			name:      "Path In Every Environment",
+			endpoints: Endpoints{{Name: "login", Path: "/login?next=1", Method: "POST"}},
+			expectedEndpoints: Endpoints{
+				{Name: "login [production]", Url: "https://example.com/login?next=1", Method: "POST"},
+				{Name: "login [staging]", Url: "https://staging.example.com/api/login?next=1", Method: "POST"},
+			},
+		},
+		{
+			name:      "Path In Listed Environments",
+			endpoints: Endpoints{{Name: "login", Path: "login", Environments: []string{"staging"}}},
+			expectedEndpoints: Endpoints{
+				{Name: "login [staging]", Url: "https://staging.example.com/api/login"},
+			},
+		},
+		{
+			name: "Selected Environment",
+			endpoints: Endpoints{
+				{Name: "login", Path: "/login"},
+				{Name: "search", Path: "/search", Environments: []string{"staging"}},
+			},
+			selected: []string{"production"},
+			expectedEndpoints: Endpoints{
+				{Name: "login [production]", Url: "https://example.com/login"},
+			},
+		},
+		{
+			name:         "Unknown Selected Environment",
+			endpoints:    Endpoints{{Name: "login", Path: "/login"}},
+			selected:     []string{"qa"},
+			expectedFail: true,
+		},
+		{
+			name:         "Unknown Listed Environment",
+			endpoints:    Endpoints{{Name: "login", Path: "/login", Environments: []string{"qa"}}},
+			expectedFail: true,
+		},
+		{
+			name:         "URL And Path",
+			endpoints:    Endpoints{{Name: "login", Url: "https://example.com/login", Path: "/login"}},
+			expectedFail: true,
+		},
+		{
+			name:         "Environments Without Path",
+			endpoints:    Endpoints{{Name: "login", Url: "https://example.com/login", Environments: []string{"staging"}}},
+			expectedFail: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			endpoints, err := tc.endpoints.ExpandEnvironments(environments, tc.selected)
+			if tc.expectedFail {
+				assert.NotEqual(t, err, nil)
+				return
+			}
+
+			assert.Equal(t, err, nil)
+			assert.Equal(t, endpoints, tc.expectedEndpoints)
+		})
+	}
+}
+
+func TestExpandEnvironmentsWithoutEnvironments(t *testing.T) {
+	_, err := Endpoints{{Name: "login", Path: "/login"}}.ExpandEnvironments(nil, nil)
+	assert.NotEqual(t, err, nil)
+}
+
+func TestSelectedEnvironments(t *testing.T) {
+	assert.Equal(t, len(Settings{}.SelectedEnvironments()), 0)
+	assert.Equal(t, Settings{Env: "staging"}.SelectedEnvironments(), []string{"staging"})
+	assert.Equal(t, Settings{Env: " staging, production ,"}.SelectedEnvironments(), []string{"staging", "production"})
+}
+
+func TestApplySettingsExpandsEnvironmentsThenHosts(t *testing.T) {
+	config := Config{
+		Settings: Settings{
+			Environments: map[string]string{"staging": "https://staging.example.com:8443", "production": "https://example.com"},
+			Env:          "staging",
+		},
+		Endpoints: Endpoints{{Name: "health", Path: "/healthz", Hosts: []string{"a", "b"}}},
+	}
+
+	assert.Equal(t, config.ApplySettings(), nil)
+	assert.Equal(t, len(config.Endpoints), 2)
+	assert.Equal(t, config.Endpoints[0].Name, "health [staging] (a)")
+	assert.Equal(t, config.Endpoints[1].Url, "https://b:8443/healthz")
+}
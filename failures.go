@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// EventEndpointFailures is the event type reporting the failure reasons of an endpoint's failed
+// checks. It is emitted at the end of each check cycle for every endpoint with failed checks.
+const EventEndpointFailures string = "endpoint_failures"
+
+// FailuresEvent is the payload of an EventEndpointFailures event.
+type FailuresEvent struct {
+	Endpoint string `json:"endpoint"`
+	Url      string `json:"url"`
+
+	// Reasons counts the failed checks of the endpoint by FailureReason, over the lifetime of the
+	// process.
+	Reasons map[string]int `json:"reasons"`
+
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// FailureReason returns why a failed check failed: its error kind, refined with the status code of
+// status failures (e.g. "status 503") and with refused connections ("connection refused").
+func FailureReason(result CheckResult) string {
+	switch {
+	case result.ErrorKind == ErrorKindStatus && result.StatusCode != 0:
+		return fmt.Sprintf("%s %d", ErrorKindStatus, result.StatusCode)
+	case result.ErrorKind == ErrorKindConnection && strings.Contains(result.Error, "connection refused"):
+		return "connection refused"
+	case result.ErrorKind == "":
+		return "other"
+	default:
+		return result.ErrorKind
+	}
+}
+
+// FailureEvents is a method for HealthCheckTargets that returns an EventEndpointFailures event for
+// each endpoint with failed checks, in the order of the configuration, stamped with the provided
+// timestamp and signed when a signer is configured.
+func (target *HealthCheckTargets) FailureEvents(timestamp time.Time) []Event {
+	var events []Event
+	for _, status := range target.EndpointStates() {
+		if len(status.FailureReasons) == 0 {
+			continue
+		}
+		event := NewEvent(EventEndpointFailures, timestamp)
+		event.Failures = &FailuresEvent{
+			Endpoint: status.Endpoint,
+			Url:      status.Url,
+			Reasons:  status.FailureReasons,
+			Labels:   status.Labels,
+		}
+		events = append(events, event)
+	}
+
+	if err := target.Signer.Sign(events); err != nil {
+		log.Printf("Failed to sign events: %v", err)
+	}
+	return events
+}
+
+// LogFailureReasons is a method for HealthCheckTargets that prints the failure reasons of every
+// endpoint with failed checks to the console in the configured output format, e.g.
+//
+//	fetch.com careers page failed 5 times: timeout 3, status 503 2
+//
+// Reasons are ordered from the most to the least frequent.
+func (target *HealthCheckTargets) LogFailureReasons() {
+	if target.Settings.Output == OutputJSON {
+		if err := WriteEvents(os.Stdout, target.FailureEvents(time.Now())); err != nil {
+			log.Printf("Failed to write JSON output: %v", err)
+		}
+		return
+	}
+
+	for _, status := range target.EndpointStates() {
+		if len(status.FailureReasons) == 0 {
+			continue
+		}
+		fmt.Println(formatFailureReasons(status.Endpoint, status.FailureReasons))
+	}
+}
+
+// formatFailureReasons returns the console line reporting the failure reasons of an endpoint.
+func formatFailureReasons(endpoint string, reasons map[string]int) string {
+	names := make([]string, 0, len(reasons))
+	total := 0
+	for reason, count := range reasons {
+		names = append(names, reason)
+		total += count
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if reasons[names[i]] != reasons[names[j]] {
+			return reasons[names[i]] > reasons[names[j]]
+		}
+		return names[i] < names[j]
+	})
+
+	counts := make([]string, len(names))
+	for i, reason := range names {
+		counts[i] = fmt.Sprintf("%s %d", reason, reasons[reason])
+	}
+	times := "times"
+	if total == 1 {
+		times = "time"
+	}
+	return fmt.Sprintf("%s failed %d %s: %s", endpoint, total, times, strings.Join(counts, ", "))
+}
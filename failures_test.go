@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/go-playground/assert/v2"
+)
+
+func TestFailureReason(t *testing.T) {
+	cases := []struct {
+		name     string
+		result   CheckResult
+		expected string
+	}{
+		{
+			name:     "Status Code",
+			result:   CheckResult{ErrorKind: ErrorKindStatus, StatusCode: 503, Error: "unexpected status code 503"},
+			expected: "status 503",
+		},
+		{
+			name:     "Connection Refused",
+			result:   CheckResult{ErrorKind: ErrorKindConnection, Error: "dial tcp 127.0.0.1:1: connect: connection refused"},
+			expected: "connection refused",
+		},
+		{
+			name:     "Connection Reset",
+			result:   CheckResult{ErrorKind: ErrorKindConnection, Error: "read: connection reset by peer"},
+			expected: ErrorKindConnection,
+		},
+		{
+			name:     "Body Mismatch",
+			result:   CheckResult{ErrorKind: ErrorKindBody, StatusCode: 200},
+			expected: ErrorKindBody,
+		},
+		{
+			name:     "Unclassified",
+			result:   CheckResult{},
+			expected: "other",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, FailureReason(tc.result), tc.expected)
+		})
+	}
+}
+
+func TestFormatFailureReasons(t *testing.T) {
+	assert.Equal(t, formatFailureReasons("careers", map[string]int{"status 503": 2, "timeout": 3, "dns": 2}),
+		"careers failed 7 times: timeout 3, dns 2, status 503 2")
+	assert.Equal(t, formatFailureReasons("careers", map[string]int{"tls": 1}), "careers failed 1 time: tls 1")
+}
+
+func TestFailureEvents(t *testing.T) {
+	endpoints := Endpoints{
+		{Name: "index", Url: "https://fetch.com/"},
+		{Name: "careers", Url: "https://fetch.com/careers"},
+	}
+	targets, err := endpoints.CreateNewTargets()
+	assert.Equal(t, err, nil)
+
+	finished_at := time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+	targets.RecordResults([]CheckResult{
+		{Endpoint: "index", Url: "https://fetch.com/", Status: StatusUp, FinishedAt: finished_at},
+		{Endpoint: "careers", Url: "https://fetch.com/careers", Status: StatusDown, ErrorKind: ErrorKindTimeout, FinishedAt: finished_at},
+	})
+	targets.RecordResults([]CheckResult{
+		{Endpoint: "index", Url: "https://fetch.com/", Status: StatusDegraded, ErrorKind: ErrorKindLatency, FinishedAt: finished_at},
+		{Endpoint: "careers", Url: "https://fetch.com/careers", Status: StatusDown, ErrorKind: ErrorKindStatus, StatusCode: 503, FinishedAt: finished_at},
+	})
+
+	// degraded checks aren't failures, so only careers is reported
+	var output bytes.Buffer
+	assert.Equal(t, WriteEvents(&output, targets.FailureEvents(finished_at)), nil)
+	assert.Equal(t, output.String(), `{"schema_version":"1.18","type":"endpoint_failures","timestamp":"2023-06-01T12:00:00Z",`+
+		`"failures":{"endpoint":"careers","url":"https://fetch.com/careers","reasons":{"status 503":1,"timeout":1}}}`+"\n")
+}
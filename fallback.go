@@ -0,0 +1,70 @@
+package main
+
+import (
+	"log"
+	"time"
+)
+
+// FallbackStats keeps the availability statistics of the fallback checks of a domain's endpoints,
+// which only happen while their primary URL is down.
+type FallbackStats struct {
+	UpCount       int
+	TotalRequests int
+}
+
+// Availability computes the cumulative availability of the fallback checks as a percentage, the
+// same way as Domain.Availability.
+func (stats *FallbackStats) Availability() int {
+	domain := Domain{UpCount: stats.UpCount, TotalRequests: stats.TotalRequests}
+	return domain.Availability()
+}
+
+// UpdateFallbackStats is a method for a domain to update the availability statistics of the
+// fallback checks of its endpoints, following UpdateDomainStats.
+//
+// Returns immediately if the domain pointer passed is nil.
+func (domain *Domain) UpdateFallbackStats(is_up bool) {
+	if domain == nil {
+		return
+	}
+
+	domain_stats.Lock()
+	defer domain_stats.Unlock()
+
+	if domain.Fallback == nil {
+		domain.Fallback = &FallbackStats{}
+	}
+	if is_up {
+		domain.Fallback.UpCount += 1
+	}
+	domain.Fallback.TotalRequests += 1
+}
+
+// fallback returns the endpoint checked in place of endpoint at its FallbackUrl: a copy with the
+// same request and assertions, but without the state learned from the primary URL, such as the
+// latency baseline or a rate limit backoff.
+func (endpoint *Endpoint) fallback() *Endpoint {
+	fallback := *endpoint
+	fallback.Url = endpoint.FallbackUrl
+	fallback.FallbackUrl = ""
+	fallback.Template = nil
+	fallback.RateLimitedUntil = time.Time{}
+	fallback.HeadRejected = false
+	fallback.Baseline = nil
+	fallback.State = nil
+	fallback.Domain = nil
+	return &fallback
+}
+
+// checkFallback checks the endpoint's FallbackUrl right after a failed check of its primary URL,
+// recording the result in the Fallback of the primary's result, so failover targets are verified
+// while they would actually be used. The primary's status is unchanged.
+func (endpoint *Endpoint) checkFallback(result *CheckResult, max_latency time.Duration) {
+	if endpoint.FallbackUrl == "" || result.Status != StatusDown {
+		return
+	}
+
+	fallback_result := endpoint.fallback().GetEndpointHealth(max_latency)
+	result.Fallback = &fallback_result
+	log.Printf("%s is down, its fallback %s is %s", endpoint.Name, endpoint.FallbackUrl, fallback_result.Status)
+}
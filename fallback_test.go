@@ -0,0 +1,101 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-playground/assert/v2"
+)
+
+func TestCheckFallback(t *testing.T) {
+	primary_status, fallback_status := http.StatusOK, http.StatusOK
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(primary_status)
+	}))
+	defer primary.Close()
+	fallback := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(fallback_status)
+	}))
+	defer fallback.Close()
+
+	cases := []struct {
+		name             string
+		primaryStatus    int
+		fallbackStatus   int
+		expectedStatus   string
+		expectedFallback string
+	}{
+		{
+			name:           "Primary Up",
+			primaryStatus:  http.StatusOK,
+			fallbackStatus: http.StatusServiceUnavailable,
+			expectedStatus: StatusUp,
+		},
+		{
+			name:             "Failover Works",
+			primaryStatus:    http.StatusServiceUnavailable,
+			fallbackStatus:   http.StatusOK,
+			expectedStatus:   StatusDown,
+			expectedFallback: StatusUp,
+		},
+		{
+			name:             "Failover Broken",
+			primaryStatus:    http.StatusServiceUnavailable,
+			fallbackStatus:   http.StatusBadGateway,
+			expectedStatus:   StatusDown,
+			expectedFallback: StatusDown,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			primary_status, fallback_status = tc.primaryStatus, tc.fallbackStatus
+			endpoints := Endpoints{{Name: "index", Url: primary.URL, FallbackUrl: fallback.URL}}
+			targets, err := endpoints.CreateNewTargets()
+			assert.Equal(t, err, nil)
+
+			endpoint := &(*targets.Endpoints)[0]
+			result := endpoint.GetEndpointHealth(time.Second)
+			assert.Equal(t, result.Status, tc.expectedStatus)
+			assert.Equal(t, result.Url, primary.URL)
+			if tc.expectedFallback == "" {
+				assert.Equal(t, result.Fallback == nil, true)
+				return
+			}
+			assert.Equal(t, result.Fallback.Status, tc.expectedFallback)
+			assert.Equal(t, result.Fallback.Url, fallback.URL)
+
+			// the fallback is reported with the domain of the endpoint
+			targets.RecordResults([]CheckResult{result})
+			assert.Equal(t, endpoint.Domain.TotalRequests, 1)
+			assert.Equal(t, endpoint.Domain.UpCount, 0)
+			assert.Equal(t, endpoint.Domain.Fallback.TotalRequests, 1)
+			assert.Equal(t, endpoint.Domain.Fallback.Availability() == 100, tc.expectedFallback == StatusUp)
+
+			events := targets.DomainEvents(time.Now())
+			assert.Equal(t, events[0].Domain.Fallback.TotalRequests, 1)
+		})
+	}
+}
+
+func TestFallbackEndpoint(t *testing.T) {
+	endpoint := Endpoint{
+		Name:             "index",
+		Url:              "https://fetch.com/",
+		FallbackUrl:      "https://dr.fetch.com/",
+		Method:           http.MethodPost,
+		RateLimitedUntil: time.Now().Add(time.Hour),
+		Baseline:         NewLatencyBaseline(5),
+	}
+
+	// the fallback keeps the request, but not the state learned from the primary
+	fallback := endpoint.fallback()
+	assert.Equal(t, fallback.Url, "https://dr.fetch.com/")
+	assert.Equal(t, fallback.FallbackUrl, "")
+	assert.Equal(t, fallback.Method, http.MethodPost)
+	assert.Equal(t, fallback.RateLimitedUntil.IsZero(), true)
+	assert.Equal(t, fallback.Baseline == nil, true)
+	assert.Equal(t, endpoint.Url, "https://fetch.com/")
+}
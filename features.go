@@ -0,0 +1,127 @@
+package main
+
+import (
+	"sort"
+	"sync"
+)
+
+// Optional integrations are compiled in by default and can be excluded from the binary with build
+// tags to produce a slimmer executable, for example:
+//
+//	go build -tags nodemo
+//
+// Each optional integration lives in its own file guarded by a "no<name>" build constraint and
+// registers itself from an init function, so the features present in a binary are discoverable at
+// runtime through EnabledFeatures and the version subcommand.
+
+// FeatureCheckType, FeatureSink, FeatureNotifier, FeatureCommand, FeatureConfigFormat and
+// FeatureExport are the kinds of features that can be registered with RegisterFeature.
+const (
+	FeatureCheckType    string = "check_type"
+	FeatureSink         string = "sink"
+	FeatureNotifier     string = "notifier"
+	FeatureCommand      string = "command"
+	FeatureConfigFormat string = "config_format"
+	FeatureExport       string = "export"
+)
+
+// Features lists the capabilities compiled into the binary, so automation can gate on them.
+type Features struct {
+	CheckTypes    []string `json:"check_types"`
+	Sinks         []string `json:"sinks"`
+	Notifiers     []string `json:"notifiers"`
+	Commands      []string `json:"commands"`
+	ConfigFormats []string `json:"config_formats"`
+	Exports       []string `json:"exports"`
+}
+
+// Command is a subcommand of the checkhealth program, e.g. "checkhealth demo". Run receives the
+// arguments following the subcommand name.
+type Command struct {
+	Name string
+	Run  func(args []string) error
+}
+
+// feature_registry holds the features and commands registered by the files compiled into the
+// binary.
+var feature_registry = struct {
+	sync.Mutex
+	features map[string][]string
+	commands map[string]Command
+}{
+	features: map[string][]string{},
+	commands: map[string]Command{},
+}
+
+// RegisterFeature records that a feature of the given kind is compiled into the binary. It is
+// intended to be called from init functions.
+func RegisterFeature(kind string, name string) {
+	feature_registry.Lock()
+	defer feature_registry.Unlock()
+
+	for _, existing := range feature_registry.features[kind] {
+		if existing == name {
+			return
+		}
+	}
+	feature_registry.features[kind] = append(feature_registry.features[kind], name)
+}
+
+// RegisterCommand makes a subcommand available to main and records it as a feature. It is
+// intended to be called from init functions.
+func RegisterCommand(command Command) {
+	RegisterFeature(FeatureCommand, command.Name)
+
+	feature_registry.Lock()
+	defer feature_registry.Unlock()
+	feature_registry.commands[command.Name] = command
+}
+
+// LookupCommand returns the registered subcommand with the provided name.
+func LookupCommand(name string) (Command, bool) {
+	feature_registry.Lock()
+	defer feature_registry.Unlock()
+
+	command, ok := feature_registry.commands[name]
+	return command, ok
+}
+
+// registeredFeatures returns a sorted copy of the registered features of the provided kind. An
+// empty, non-nil slice is returned when nothing of that kind is registered.
+func registeredFeatures(kind string) []string {
+	feature_registry.Lock()
+	defer feature_registry.Unlock()
+
+	names := append([]string{}, feature_registry.features[kind]...)
+	sort.Strings(names)
+	return names
+}
+
+// featureEnabled reports whether a feature of the given kind is compiled into the binary.
+func featureEnabled(kind string, name string) bool {
+	for _, registered := range registeredFeatures(kind) {
+		if registered == name {
+			return true
+		}
+	}
+	return false
+}
+
+// EnabledFeatures returns the check types, output sinks, notifiers, subcommands, configuration
+// formats and history export formats available in this binary.
+func EnabledFeatures() Features {
+	return Features{
+		CheckTypes:    registeredFeatures(FeatureCheckType),
+		Sinks:         registeredFeatures(FeatureSink),
+		Notifiers:     registeredFeatures(FeatureNotifier),
+		Commands:      registeredFeatures(FeatureCommand),
+		ConfigFormats: registeredFeatures(FeatureConfigFormat),
+		Exports:       registeredFeatures(FeatureExport),
+	}
+}
+
+func init() {
+	// built-in features that are always compiled in
+	RegisterFeature(FeatureCheckType, "http")
+	RegisterFeature(FeatureSink, "console")
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/go-playground/assert/v2"
+)
+
+func TestRegisterFeature(t *testing.T) {
+	RegisterFeature("test_kind", "b")
+	RegisterFeature("test_kind", "a")
+	RegisterFeature("test_kind", "b")
+
+	// features are de-duplicated and sorted
+	assert.Equal(t, registeredFeatures("test_kind"), []string{"a", "b"})
+	assert.Equal(t, registeredFeatures("unknown_kind"), []string{})
+}
+
+func TestLookupCommand(t *testing.T) {
+	cases := []struct {
+		name          string
+		command       string
+		expectedFound bool
+	}{
+		{
+			name:          "Built-in Command",
+			command:       "version",
+			expectedFound: true,
+		},
+		{
+			name:          "Unknown Command",
+			command:       "config.yaml",
+			expectedFound: false,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			command, ok := LookupCommand(tc.command)
+			assert.Equal(t, ok, tc.expectedFound)
+
+			if tc.expectedFound {
+				assert.Equal(t, command.Name, tc.command)
+			}
+		})
+	}
+}
+
+func TestEnabledFeatures(t *testing.T) {
+	features := EnabledFeatures()
+
+	// built-in features are always compiled in
+	assert.Equal(t, hasFeature(features.CheckTypes, "http"), true)
+	assert.Equal(t, hasFeature(features.Sinks, "console"), true)
+	assert.Equal(t, hasFeature(features.Sinks, "file"), true)
+	assert.Equal(t, hasFeature(features.Commands, "version"), true)
+}
+
+func hasFeature(features []string, name string) bool {
+	for _, feature := range features {
+		if feature == name {
+			return true
+		}
+	}
+	return false
+}
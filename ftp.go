@@ -0,0 +1,289 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FTP endpoints log in to the server of their ftp://[user@]host[:port] URL, and optionally list a
+// directory or stat a file, within the latency budget of the check. Users without a password
+// log in anonymously. The listing is evaluated as the body by the body assertions.
+
+// EndpointTypeFTP and EndpointTypeSFTP are the types of file transfer endpoint checks.
+const (
+	EndpointTypeFTP  string = "ftp"
+	EndpointTypeSFTP string = "sftp"
+)
+
+// DefaultFTPPort is the port FTP endpoints connect to when their URL doesn't have one.
+const DefaultFTPPort string = "21"
+
+// ErrorKindLogin and ErrorKindFile classify file transfer checks that failed to log in, and that
+// failed to list their directory or stat their file.
+const (
+	ErrorKindLogin string = "login"
+	ErrorKindFile  string = "file"
+)
+
+// ftpError is an error reply of an FTP server, classified as kind.
+type ftpError struct {
+	kind string
+	err  error
+}
+
+func (err ftpError) Error() string {
+	return err.err.Error()
+}
+
+// validateFTP rejects FTP endpoints whose URL isn't an FTP URL, or which set a success predicate.
+func (endpoint *Endpoint) validateFTP() error {
+	if endpoint.SuccessWhen != "" {
+		return errors.New("success_when isn't supported by ftp endpoints")
+	}
+	_, _, _, err := endpoint.ftpLogin()
+	return err
+}
+
+// ftpLogin returns the address, user and password the FTP endpoint logs in with.
+func (endpoint *Endpoint) ftpLogin() (string, string, string, error) {
+	target, err := url.Parse(endpoint.Url)
+	if err != nil {
+		return "", "", "", fmt.Errorf("failed to parse url: %v", err)
+	}
+	if target.Scheme != EndpointTypeFTP || target.Hostname() == "" {
+		return "", "", "", fmt.Errorf("url %q of an ftp endpoint must be of the form ftp://[user@]host[:port]", endpoint.Url)
+	}
+	if _, ok := target.User.Password(); ok {
+		return "", "", "", errors.New("the password of an ftp endpoint must be provided with password_env, not in its url")
+	}
+	port := target.Port()
+	if port == "" {
+		port = DefaultFTPPort
+	}
+
+	user := "anonymous"
+	password := "anonymous@"
+	if target.User != nil && target.User.Username() != "" {
+		user = target.User.Username()
+		password = ""
+	}
+	if endpoint.PasswordEnv != "" {
+		password = os.Getenv(endpoint.PasswordEnv)
+	}
+	return net.JoinHostPort(target.Hostname(), port), user, password, nil
+}
+
+// runFTPCheck logs in to the FTP endpoint, stats its StatFile and lists its ListDirectory when
+// set, and returns its result. The whole session is bounded by the deadline of ctx.
+func (endpoint *Endpoint) runFTPCheck(ctx context.Context) CheckResult {
+	result := CheckResult{Status: StatusUp}
+
+	address, user, password, err := endpoint.ftpLogin()
+	if err != nil {
+		result.fail(StatusDown, ErrorKindConnection, err)
+		return result
+	}
+
+	body_regex, err := endpoint.bodyRegex()
+	if err != nil {
+		result.fail(StatusDown, ErrorKindBody, fmt.Errorf("failed to compile expect_body_regex: %w", err))
+		return result
+	}
+
+	start := time.Now()
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		result.Latency = time.Since(start)
+		result.fail(StatusDown, ErrorKind(err), err)
+		return result
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	if host, _, err := net.SplitHostPort(conn.RemoteAddr().String()); err == nil {
+		result.RemoteIP = host
+	}
+
+	session := ftpSession{ctx: ctx, conn: textproto.NewConn(conn), host: result.RemoteIP}
+	listing, err := session.run(user, password, endpoint.StatFile, endpoint.ListDirectory, endpoint.maxBodySize())
+	result.Latency = time.Since(start)
+	if err != nil {
+		var reply_err ftpError
+		if errors.As(err, &reply_err) {
+			result.fail(StatusDown, reply_err.kind, err)
+		} else {
+			result.fail(StatusDown, ErrorKind(err), err)
+		}
+		return result
+	}
+
+	if err := endpoint.checkBody(listing, body_regex); err != nil {
+		result.fail(StatusDown, ErrorKindBody, err)
+		return result
+	}
+
+	return result
+}
+
+// ftpSession is the control connection of an FTP check to the server at host.
+type ftpSession struct {
+	ctx  context.Context
+	conn *textproto.Conn
+	host string
+}
+
+// run logs in as user, stats stat_file and lists list_directory when set, and quits. It returns the
+// names listed, up to limit bytes.
+func (session ftpSession) run(user string, password string, stat_file string, list_directory string, limit int64) ([]byte, error) {
+	if _, _, err := session.conn.ReadResponse(220); err != nil {
+		return nil, fmt.Errorf("unexpected greeting: %w", err)
+	}
+
+	code, _, err := session.command(ErrorKindLogin, 0, "USER %s", user)
+	if err != nil {
+		return nil, err
+	}
+	if code == 331 {
+		if _, _, err := session.command(ErrorKindLogin, 230, "PASS %s", password); err != nil {
+			return nil, err
+		}
+	} else if code != 230 {
+		return nil, ftpError{kind: ErrorKindLogin, err: fmt.Errorf("login failed with reply %d", code)}
+	}
+
+	if stat_file != "" {
+		// SIZE is only answered in binary mode by some servers
+		if _, _, err := session.command(ErrorKindFile, 200, "TYPE I"); err != nil {
+			return nil, err
+		}
+		if _, _, err := session.command(ErrorKindFile, 213, "SIZE %s", stat_file); err != nil {
+			return nil, err
+		}
+	}
+
+	var listing []byte
+	if list_directory != "" {
+		listing, err = session.list(list_directory, limit)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// the server may close the connection without replying
+	session.conn.PrintfLine("QUIT")
+	return listing, nil
+}
+
+// command sends a command and reads its reply, which is expected to have the code expect_code, or
+// any positive completion or intermediate code when zero. Negative replies are classified as kind.
+func (session ftpSession) command(kind string, expect_code int, format string, args ...interface{}) (int, string, error) {
+	if err := session.conn.PrintfLine(format, args...); err != nil {
+		return 0, "", err
+	}
+	verb := strings.Fields(format)[0]
+	code, message, err := session.conn.ReadResponse(expect_code)
+	if err != nil {
+		return code, message, replyError(kind, verb, err)
+	}
+	if expect_code == 0 && code >= 400 {
+		return code, message, ftpError{kind: kind, err: fmt.Errorf("%s failed: %d %s", verb, code, message)}
+	}
+	return code, message, nil
+}
+
+// replyError wraps an error reading the reply to the command verb. Unexpected replies are
+// classified as kind, and connection errors are left to ErrorKind.
+func replyError(kind string, verb string, err error) error {
+	var protocol_err *textproto.Error
+	if errors.As(err, &protocol_err) {
+		return ftpError{kind: kind, err: fmt.Errorf("%s failed: %v", verb, err)}
+	}
+	return fmt.Errorf("%s failed: %w", verb, err)
+}
+
+// list lists the names of directory over a passive data connection, reading up to limit bytes.
+func (session ftpSession) list(directory string, limit int64) ([]byte, error) {
+	port, err := session.passivePort()
+	if err != nil {
+		return nil, err
+	}
+
+	var dialer net.Dialer
+	data, err := dialer.DialContext(session.ctx, "tcp", net.JoinHostPort(session.host, port))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open data connection: %w", err)
+	}
+	defer data.Close()
+	if deadline, ok := session.ctx.Deadline(); ok {
+		data.SetDeadline(deadline)
+	}
+
+	if _, _, err := session.command(ErrorKindFile, 1, "NLST %s", directory); err != nil {
+		return nil, err
+	}
+	listing, err := io.ReadAll(io.LimitReader(data, limit))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read listing: %w", err)
+	}
+	data.Close()
+
+	if _, _, err := session.conn.ReadResponse(2); err != nil {
+		return nil, replyError(ErrorKindFile, "NLST", err)
+	}
+	return listing, nil
+}
+
+// passivePort enters extended passive mode, falling back to passive mode for servers not
+// supporting it, and returns the port of the data connection. The address returned by PASV is
+// ignored, as servers behind NAT often advertise a private one.
+func (session ftpSession) passivePort() (string, error) {
+	code, message, err := session.command(ErrorKindConnection, 0, "EPSV")
+	if err == nil && code == 229 {
+		// 229 Entering Extended Passive Mode (|||port|)
+		start := strings.Index(message, "(|||")
+		end := strings.LastIndex(message, "|)")
+		if start < 0 || end < start+4 {
+			return "", fmt.Errorf("invalid EPSV reply %q", message)
+		}
+		return message[start+4 : end], nil
+	}
+
+	_, message, err = session.command(ErrorKindConnection, 227, "PASV")
+	if err != nil {
+		return "", err
+	}
+	// 227 Entering Passive Mode (h1,h2,h3,h4,p1,p2)
+	start := strings.Index(message, "(")
+	end := strings.LastIndex(message, ")")
+	if start < 0 || end < start {
+		return "", fmt.Errorf("invalid PASV reply %q", message)
+	}
+	fields := strings.Split(message[start+1:end], ",")
+	if len(fields) != 6 {
+		return "", fmt.Errorf("invalid PASV reply %q", message)
+	}
+	high, err_high := strconv.Atoi(strings.TrimSpace(fields[4]))
+	low, err_low := strconv.Atoi(strings.TrimSpace(fields[5]))
+	if err_high != nil || err_low != nil {
+		return "", fmt.Errorf("invalid PASV reply %q", message)
+	}
+	return strconv.Itoa(high<<8 | low), nil
+}
+
+func init() {
+	RegisterCheckType(EndpointTypeFTP, CheckType{
+		Validate: (*Endpoint).validateFTP,
+		Check:    (*Endpoint).runFTPCheck,
+	})
+}
@@ -3,6 +3,8 @@ module github.com/gpjservais/checkhealth
 go 1.16
 
 require (
+	github.com/BurntSushi/toml v1.3.2
 	github.com/go-playground/assert/v2 v2.2.0
+	golang.org/x/crypto v0.14.0
 	gopkg.in/yaml.v2 v2.4.0
 )
@@ -0,0 +1,293 @@
+//go:build !nogrpc
+// +build !nogrpc
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// gRPC endpoints are checked with the standard grpc.health.v1.Health/Check RPC, against the server
+// at their URL: https:// for TLS, http:// for plaintext HTTP/2.
+
+// GRPCHealthCheckPath is the path of the gRPC health checking protocol's Check method.
+const GRPCHealthCheckPath string = "/grpc.health.v1.Health/Check"
+
+// ErrorKindGRPC classifies gRPC health checks that failed with a gRPC error, or whose service
+// isn't serving.
+const ErrorKindGRPC string = "grpc"
+
+// grpcServing is the SERVING status of a grpc.health.v1.HealthCheckResponse.
+const grpcServing uint64 = 1
+
+// grpc_serving_statuses names the statuses of a grpc.health.v1.HealthCheckResponse.
+var grpc_serving_statuses = map[uint64]string{
+	0: "UNKNOWN",
+	1: "SERVING",
+	2: "NOT_SERVING",
+	3: "SERVICE_UNKNOWN",
+}
+
+// GRPCOptions are the TLS options of a gRPC endpoint's connections.
+type GRPCOptions struct {
+	// Plaintext selects HTTP/2 without TLS, for http:// URLs.
+	Plaintext bool
+
+	// CAFile is a PEM file of the certificate authorities trusted instead of the system ones,
+	// ServerName overrides the name verified in the server certificate, and InsecureSkipVerify
+	// disables the verification.
+	CAFile             string
+	ServerName         string
+	InsecureSkipVerify bool
+
+	// AcceptNames are the comma separated names the server certificate may be valid for instead
+	// of ServerName, see acceptNames.
+	AcceptNames string
+
+	// ClientCert and ClientKey are the PEM files of the client certificate presented to servers
+	// requiring mutual TLS.
+	ClientCert string
+	ClientKey  string
+}
+
+// grpc_clients caches the HTTP clients of gRPC endpoints, by options, so connections are reused
+// across checks.
+var grpc_clients = struct {
+	sync.Mutex
+	clients map[GRPCOptions]*http.Client
+}{
+	clients: map[GRPCOptions]*http.Client{},
+}
+
+// GRPCClient returns an HTTP/2 client for gRPC endpoints with the provided options. An error is
+// returned if the CA file or the client certificate can't be loaded, or if plaintext HTTP/2 isn't
+// supported by this build.
+func GRPCClient(options GRPCOptions) (*http.Client, error) {
+	grpc_clients.Lock()
+	defer grpc_clients.Unlock()
+
+	if client, ok := grpc_clients.clients[options]; ok {
+		return client, nil
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ForceAttemptHTTP2 = true
+
+	if options.Plaintext {
+		if err := enableUnencryptedHTTP2(transport); err != nil {
+			return nil, err
+		}
+	} else {
+		config := &tls.Config{
+			ServerName:         options.ServerName,
+			InsecureSkipVerify: options.InsecureSkipVerify,
+		}
+		if err := configureTLS(config, options.CAFile, options.ClientCert, options.ClientKey); err != nil {
+			return nil, err
+		}
+		acceptNames(config, options.AcceptNames)
+		transport.TLSClientConfig = config
+	}
+
+	client := &http.Client{Transport: transport}
+	grpc_clients.clients[options] = client
+	return client, nil
+}
+
+// validateGRPC rejects gRPC endpoints with a success predicate, which has no response to evaluate,
+// or whose TLS options can't be loaded.
+func (endpoint *Endpoint) validateGRPC() error {
+	if endpoint.SuccessWhen != "" {
+		return fmt.Errorf("success_when isn't supported by gRPC endpoints")
+	}
+	_, err := GRPCClient(endpoint.grpcOptions())
+	return err
+}
+
+// grpcOptions returns the gRPC options of the endpoint.
+func (endpoint *Endpoint) grpcOptions() GRPCOptions {
+	return GRPCOptions{
+		Plaintext:          strings.HasPrefix(strings.ToLower(endpoint.Url), "http://"),
+		CAFile:             endpoint.TLSCAFile,
+		ServerName:         endpoint.TLSServerName,
+		InsecureSkipVerify: endpoint.TLSInsecureSkipVerify,
+		AcceptNames:        strings.Join(endpoint.TLSAcceptNames, ","),
+		ClientCert:         endpoint.TLSClientCert,
+		ClientKey:          endpoint.TLSClientKey,
+	}
+}
+
+// runGRPCCheck calls the grpc.health.v1.Health/Check method of the endpoint's server for its
+// GRPCService, the overall server health when empty, and returns its result. The endpoint is up
+// when the service is SERVING.
+func (endpoint *Endpoint) runGRPCCheck(ctx context.Context) CheckResult {
+	result := CheckResult{Status: StatusUp, Method: http.MethodPost}
+	ctx = withRemoteIP(ctx, &result)
+
+	client, err := GRPCClient(endpoint.grpcOptions())
+	if err != nil {
+		result.fail(StatusDown, ErrorKindConnection, err)
+		return result
+	}
+
+	message := encodeGRPCHealthCheckRequest(endpoint.GRPCService)
+	url := strings.TrimSuffix(endpoint.Url, "/") + GRPCHealthCheckPath
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(message))
+	if err != nil {
+		result.fail(StatusDown, ErrorKindConnection, fmt.Errorf("failed to create gRPC request: %v", err))
+		return result
+	}
+	request.Header.Set("Content-Type", "application/grpc")
+	request.Header.Set("TE", "trailers")
+	for field, value := range endpoint.Headers {
+		request.Header.Set(field, value)
+	}
+	if endpoint.Auth != nil {
+		authorization, err := endpoint.Auth.Authorization()
+		if err != nil {
+			result.fail(StatusDown, ErrorKindConnection, fmt.Errorf("failed to resolve auth: %v", err))
+			return result
+		}
+		request.Header.Set("Authorization", authorization)
+	}
+	result.BytesSent = requestSize(request)
+
+	start := time.Now()
+	response, err := client.Do(request)
+	if err != nil {
+		result.Latency = time.Since(start)
+		result.fail(StatusDown, ErrorKind(err), err)
+		return result
+	}
+	defer response.Body.Close()
+	result.StatusCode = response.StatusCode
+	result.BytesReceived = responseHeaderSize(response)
+
+	// the trailers are only available once the body has been read
+	body, err := io.ReadAll(io.LimitReader(countingReader{ReadCloser: response.Body, count: &result.BytesReceived}, endpoint.maxBodySize()))
+	result.Latency = time.Since(start)
+	if err != nil {
+		result.fail(StatusDown, ErrorKind(err), err)
+		return result
+	}
+	if response.StatusCode != http.StatusOK {
+		result.fail(StatusDown, ErrorKindStatus, fmt.Errorf("unexpected status code %d", response.StatusCode))
+		return result
+	}
+
+	// trailers-only responses carry the gRPC status in their headers
+	grpc_status := response.Trailer.Get("Grpc-Status")
+	grpc_message := response.Trailer.Get("Grpc-Message")
+	if grpc_status == "" {
+		grpc_status = response.Header.Get("Grpc-Status")
+		grpc_message = response.Header.Get("Grpc-Message")
+	}
+	if grpc_status != "0" {
+		result.fail(StatusDown, ErrorKindGRPC, fmt.Errorf("gRPC status %s: %s", grpc_status, grpc_message))
+		return result
+	}
+
+	status, err := decodeGRPCHealthCheckResponse(body)
+	if err != nil {
+		result.fail(StatusDown, ErrorKindGRPC, err)
+		return result
+	}
+	if status != grpcServing {
+		name, ok := grpc_serving_statuses[status]
+		if !ok {
+			name = strconv.FormatUint(status, 10)
+		}
+		result.fail(StatusDown, ErrorKindGRPC, fmt.Errorf("service %q is %s", endpoint.GRPCService, name))
+		return result
+	}
+
+	return result
+}
+
+// encodeGRPCHealthCheckRequest returns a length-prefixed gRPC message of a
+// grpc.health.v1.HealthCheckRequest for service.
+func encodeGRPCHealthCheckRequest(service string) []byte {
+	var message []byte
+	if service != "" {
+		// field 1, length-delimited
+		message = append(message, 0x0a)
+		message = appendUvarint(message, uint64(len(service)))
+		message = append(message, service...)
+	}
+
+	frame := make([]byte, 5, 5+len(message))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(message)))
+	return append(frame, message...)
+}
+
+// decodeGRPCHealthCheckResponse returns the status of the grpc.health.v1.HealthCheckResponse in a
+// length-prefixed gRPC message.
+func decodeGRPCHealthCheckResponse(frame []byte) (uint64, error) {
+	if len(frame) < 5 {
+		return 0, errors.New("gRPC response has no message")
+	}
+	if frame[0] != 0 {
+		return 0, errors.New("compressed gRPC responses aren't supported")
+	}
+	length := binary.BigEndian.Uint32(frame[1:5])
+	if uint64(len(frame)-5) < uint64(length) {
+		return 0, errors.New("gRPC response message is truncated")
+	}
+	message := frame[5 : 5+length]
+
+	// fields other than the status are skipped, and a missing status is UNKNOWN
+	var status uint64
+	for len(message) > 0 {
+		key, n := binary.Uvarint(message)
+		if n <= 0 {
+			return 0, errors.New("invalid gRPC response message")
+		}
+		message = message[n:]
+
+		switch key & 7 {
+		case 0:
+			value, n := binary.Uvarint(message)
+			if n <= 0 {
+				return 0, errors.New("invalid gRPC response message")
+			}
+			message = message[n:]
+			if key>>3 == 1 {
+				status = value
+			}
+		case 2:
+			length, n := binary.Uvarint(message)
+			if n <= 0 || uint64(len(message)-n) < length {
+				return 0, errors.New("invalid gRPC response message")
+			}
+			message = message[uint64(n)+length:]
+		default:
+			return 0, fmt.Errorf("unsupported wire type %d in gRPC response message", key&7)
+		}
+	}
+	return status, nil
+}
+
+// appendUvarint appends the varint encoding of value to buffer.
+func appendUvarint(buffer []byte, value uint64) []byte {
+	var encoded [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(encoded[:], value)
+	return append(buffer, encoded[:n]...)
+}
+
+func init() {
+	RegisterCheckType(EndpointTypeGRPC, CheckType{
+		Validate: (*Endpoint).validateGRPC,
+		Check:    (*Endpoint).runGRPCCheck,
+	})
+}
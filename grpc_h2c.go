@@ -0,0 +1,15 @@
+//go:build go1.24
+// +build go1.24
+
+package main
+
+import "net/http"
+
+// enableUnencryptedHTTP2 configures transport to speak HTTP/2 with prior knowledge over plaintext
+// connections, as gRPC servers without TLS expect.
+func enableUnencryptedHTTP2(transport *http.Transport) error {
+	protocols := new(http.Protocols)
+	protocols.SetUnencryptedHTTP2(true)
+	transport.Protocols = protocols
+	return nil
+}
@@ -0,0 +1,14 @@
+//go:build !go1.24
+// +build !go1.24
+
+package main
+
+import (
+	"errors"
+	"net/http"
+)
+
+// enableUnencryptedHTTP2 fails, as plaintext HTTP/2 needs the transport protocols of Go 1.24.
+func enableUnencryptedHTTP2(transport *http.Transport) error {
+	return errors.New("plaintext gRPC endpoints need checkhealth built with Go 1.24 or later, use an https:// URL")
+}
@@ -0,0 +1,26 @@
+//go:build go1.24 && !nogrpc
+// +build go1.24,!nogrpc
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-playground/assert/v2"
+)
+
+func TestRunGRPCCheckPlaintext(t *testing.T) {
+	server := httptest.NewUnstartedServer(grpcHealthServer(t, map[string]uint64{"": grpcServing}))
+	server.Config.Protocols = new(http.Protocols)
+	server.Config.Protocols.SetUnencryptedHTTP2(true)
+	server.Start()
+	defer server.Close()
+
+	endpoint := Endpoint{Name: "plaintext", Url: server.URL, Type: EndpointTypeGRPC}
+	result := endpoint.GetEndpointHealth(5 * time.Second)
+	assert.Equal(t, result.Status, StatusUp)
+	assert.Equal(t, result.StatusCode, http.StatusOK)
+}
@@ -0,0 +1,173 @@
+//go:build !nogrpc
+// +build !nogrpc
+
+package main
+
+import (
+	"encoding/binary"
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-playground/assert/v2"
+)
+
+// grpcHealthServer returns a handler implementing grpc.health.v1.Health/Check with the statuses of
+// services, answering unknown services with grpc-status 5 (NOT_FOUND) like the reference server.
+func grpcHealthServer(t *testing.T, services map[string]uint64) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, r.URL.Path, GRPCHealthCheckPath)
+		assert.Equal(t, r.Header.Get("Content-Type"), "application/grpc")
+
+		frame, err := io.ReadAll(r.Body)
+		assert.Equal(t, err, nil)
+		service := ""
+		if len(frame) > 5 {
+			length, n := binary.Uvarint(frame[6:])
+			service = string(frame[6+n : 6+n+int(length)])
+		}
+
+		w.Header().Set("Content-Type", "application/grpc")
+		status, ok := services[service]
+		if !ok {
+			w.Header().Set("Grpc-Status", "5")
+			w.Header().Set("Grpc-Message", "unknown service")
+			return
+		}
+
+		message := appendUvarint([]byte{0x08}, status)
+		response := make([]byte, 5, 5+len(message))
+		binary.BigEndian.PutUint32(response[1:], uint32(len(message)))
+		w.Write(append(response, message...))
+		w.Header().Set(http.TrailerPrefix+"Grpc-Status", "0")
+	})
+}
+
+func TestRunGRPCCheck(t *testing.T) {
+	server := httptest.NewUnstartedServer(grpcHealthServer(t, map[string]uint64{
+		"":            grpcServing,
+		"checkout":    grpcServing,
+		"maintenance": 2,
+	}))
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+
+	ca_file := filepath.Join(t.TempDir(), "ca.pem")
+	certificate := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	assert.Equal(t, os.WriteFile(ca_file, certificate, 0o600), nil)
+
+	cases := []struct {
+		name              string
+		endpoint          Endpoint
+		expectedStatus    string
+		expectedErrorKind string
+	}{
+		{
+			name:           "Server Serving",
+			endpoint:       Endpoint{Name: "server", Url: server.URL, TLSCAFile: ca_file},
+			expectedStatus: StatusUp,
+		},
+		{
+			name:           "Service Serving",
+			endpoint:       Endpoint{Name: "checkout", Url: server.URL, GRPCService: "checkout", TLSInsecureSkipVerify: true},
+			expectedStatus: StatusUp,
+		},
+		{
+			name:              "Service Not Serving",
+			endpoint:          Endpoint{Name: "maintenance", Url: server.URL, GRPCService: "maintenance", TLSInsecureSkipVerify: true},
+			expectedStatus:    StatusDown,
+			expectedErrorKind: ErrorKindGRPC,
+		},
+		{
+			name:              "Unknown Service",
+			endpoint:          Endpoint{Name: "unknown", Url: server.URL, GRPCService: "unknown", TLSInsecureSkipVerify: true},
+			expectedStatus:    StatusDown,
+			expectedErrorKind: ErrorKindGRPC,
+		},
+		{
+			name:              "Untrusted Certificate",
+			endpoint:          Endpoint{Name: "untrusted", Url: server.URL},
+			expectedStatus:    StatusDown,
+			expectedErrorKind: ErrorKindTLS,
+		},
+		{
+			name:              "Name Mismatch",
+			endpoint:          Endpoint{Name: "mismatch", Url: server.URL, TLSCAFile: ca_file, TLSServerName: "fetch.com"},
+			expectedStatus:    StatusDown,
+			expectedErrorKind: ErrorKindTLS,
+		},
+		{
+			name:           "Accepted Name Mismatch",
+			endpoint:       Endpoint{Name: "accepted", Url: server.URL, TLSCAFile: ca_file, TLSServerName: "fetch.com", TLSAcceptNames: []string{"example.com"}},
+			expectedStatus: StatusUp,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.endpoint.Type = EndpointTypeGRPC
+			result := tc.endpoint.GetEndpointHealth(5 * time.Second)
+			assert.Equal(t, result.Status, tc.expectedStatus)
+			assert.Equal(t, result.ErrorKind, tc.expectedErrorKind)
+			if tc.expectedStatus == StatusUp {
+				assert.Equal(t, result.StatusCode, http.StatusOK)
+				assert.NotEqual(t, result.BytesReceived, int64(0))
+			}
+		})
+	}
+}
+
+func TestGRPCHealthCheckMessages(t *testing.T) {
+	assert.Equal(t, encodeGRPCHealthCheckRequest(""), []byte{0, 0, 0, 0, 0})
+	assert.Equal(t, encodeGRPCHealthCheckRequest("db"), []byte{0, 0, 0, 0, 4, 0x0a, 2, 'd', 'b'})
+
+	cases := []struct {
+		name           string
+		frame          []byte
+		expectedStatus uint64
+		expectedFail   bool
+	}{
+		{name: "Serving", frame: []byte{0, 0, 0, 0, 2, 0x08, 1}, expectedStatus: 1},
+		{name: "Empty Message", frame: []byte{0, 0, 0, 0, 0}, expectedStatus: 0},
+		{name: "Unknown Field", frame: []byte{0, 0, 0, 0, 6, 0x12, 2, 'o', 'k', 0x08, 2}, expectedStatus: 2},
+		{name: "No Frame", frame: []byte{}, expectedFail: true},
+		{name: "Compressed", frame: []byte{1, 0, 0, 0, 2, 0x08, 1}, expectedFail: true},
+		{name: "Truncated", frame: []byte{0, 0, 0, 0, 3, 0x08, 1}, expectedFail: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			status, err := decodeGRPCHealthCheckResponse(tc.frame)
+			assert.Equal(t, err != nil, tc.expectedFail)
+			assert.Equal(t, status, tc.expectedStatus)
+		})
+	}
+}
+
+func TestApplySettingsGRPC(t *testing.T) {
+	cases := []struct {
+		name         string
+		endpoint     Endpoint
+		expectedFail bool
+	}{
+		{name: "gRPC", endpoint: Endpoint{Name: "example", Url: "https://example.com", Type: EndpointTypeGRPC, GRPCService: "checkout"}},
+		{name: "HTTP", endpoint: Endpoint{Name: "example", Url: "https://example.com", Type: EndpointTypeHTTP}},
+		{name: "Unsupported Type", endpoint: Endpoint{Name: "example", Url: "https://example.com", Type: "tcp"}, expectedFail: true},
+		{name: "Dual Stack", endpoint: Endpoint{Name: "example", Url: "https://example.com", Type: EndpointTypeGRPC, DualStack: true}, expectedFail: true},
+		{name: "Missing CA File", endpoint: Endpoint{Name: "example", Url: "https://example.com", Type: EndpointTypeGRPC, TLSCAFile: "nonexistent.pem"}, expectedFail: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			config := Config{Endpoints: Endpoints{tc.endpoint}}
+			err := config.ApplySettings()
+			assert.Equal(t, err != nil, tc.expectedFail)
+		})
+	}
+}
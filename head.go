@@ -0,0 +1,27 @@
+package main
+
+import "net/http"
+
+// RejectsHead reports whether a response status code means the target doesn't support HEAD
+// requests, so the check has to fall back to GET.
+func RejectsHead(status_code int) bool {
+	return status_code == http.StatusMethodNotAllowed || status_code == http.StatusNotImplemented
+}
+
+// useHead reports whether the endpoint is checked with HEAD: it prefers HEAD or its domain exceeded
+// its bandwidth cap, it hasn't rejected HEAD, it is checked with GET, and nothing is read from its
+// response body by the predicates or the body assertions.
+func (endpoint *Endpoint) useHead(predicates ...*Predicate) bool {
+	if !(endpoint.PreferHead || endpoint.BandwidthHead) || endpoint.HeadRejected {
+		return false
+	}
+	if endpoint.Method != "" && endpoint.Method != http.MethodGet {
+		return false
+	}
+	for _, predicate := range predicates {
+		if predicate != nil && predicate.NeedsBody() {
+			return false
+		}
+	}
+	return !endpoint.expectsBody()
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-playground/assert/v2"
+)
+
+func TestGetEndpointHealthPreferHead(t *testing.T) {
+	cases := []struct {
+		name                string
+		rejectHead          bool
+		expectBodyContains  string
+		expectedMethods     []string
+		expectedRequests    []string
+		expectedHeadRejects bool
+	}{
+		{
+			name:             "Head Supported",
+			expectedMethods:  []string{http.MethodHead, http.MethodHead},
+			expectedRequests: []string{http.MethodHead, http.MethodHead},
+		},
+		{
+			name:                "Fallback To Get",
+			rejectHead:          true,
+			expectedMethods:     []string{http.MethodGet, http.MethodGet},
+			expectedRequests:    []string{http.MethodHead, http.MethodGet, http.MethodGet},
+			expectedHeadRejects: true,
+		},
+		{
+			name:               "Body Assertions Use Get",
+			expectBodyContains: "ok",
+			expectedMethods:    []string{http.MethodGet, http.MethodGet},
+			expectedRequests:   []string{http.MethodGet, http.MethodGet},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var mu sync.Mutex
+			requests := []string{}
+			mock_server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				requests = append(requests, r.Method)
+				mu.Unlock()
+				if tc.rejectHead && r.Method == http.MethodHead {
+					w.WriteHeader(http.StatusMethodNotAllowed)
+					return
+				}
+				w.Write([]byte("ok"))
+			}))
+			defer mock_server.Close()
+
+			endpoint := Endpoint{
+				Name:               "Head Test",
+				Url:                mock_server.URL,
+				PreferHead:         true,
+				ExpectBodyContains: tc.expectBodyContains,
+			}
+
+			methods := []string{}
+			for i := 0; i < 2; i++ {
+				result := endpoint.GetEndpointHealth(2 * time.Second)
+				assert.Equal(t, result.Status, StatusUp)
+				methods = append(methods, result.Method)
+			}
+
+			assert.Equal(t, methods, tc.expectedMethods)
+			assert.Equal(t, requests, tc.expectedRequests)
+			assert.Equal(t, endpoint.HeadRejected, tc.expectedHeadRejects)
+		})
+	}
+}
+
+func TestApplySettingsPreferHead(t *testing.T) {
+	config := Config{Endpoints: Endpoints{{Name: "example", Url: "https://example.com/", Method: http.MethodGet, PreferHead: true}}}
+	assert.Equal(t, config.ApplySettings(), nil)
+
+	config = Config{Endpoints: Endpoints{{Name: "example", Url: "https://example.com/", Method: http.MethodPost, PreferHead: true}}}
+	assert.NotEqual(t, config.ApplySettings(), nil)
+
+	// the global prefer_head only applies to HTTP endpoints checked with GET
+	config = Config{
+		Settings: Settings{PreferHead: true},
+		Endpoints: Endpoints{
+			{Name: "index", Url: "https://example.com/"},
+			{Name: "upload", Url: "https://example.com/upload", Method: http.MethodPost},
+			{Name: "smtp", Url: "tcp://example.com:25", Type: EndpointTypeRawTCP},
+		},
+	}
+	assert.Equal(t, config.ApplySettings(), nil)
+	assert.Equal(t, config.Endpoints[0].PreferHead, true)
+	assert.Equal(t, config.Endpoints[1].PreferHead, false)
+	assert.Equal(t, config.Endpoints[2].PreferHead, false)
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// HealthJSONContentType is the media type of health check responses following the health check
+// response format for HTTP APIs (draft-inadarei-api-health-check). Responses of this type are
+// parsed, and the status of each component they report is surfaced with the check result.
+const HealthJSONContentType string = "application/health+json"
+
+// HealthPass, HealthWarn and HealthFail are the normalized statuses of a health+json response and
+// of its components. A failing response marks the endpoint down, and a warning one degraded.
+const (
+	HealthPass string = "pass"
+	HealthWarn string = "warn"
+	HealthFail string = "fail"
+)
+
+// ErrorKindHealth classifies checks whose health+json response reported a failure.
+const ErrorKindHealth string = "health"
+
+// ComponentStatus is the status of a component reported by a health+json response, such as a
+// database connection of the target.
+type ComponentStatus struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Output string `json:"output,omitempty"`
+}
+
+// healthDocument is the subset of a health+json response used by the checker.
+type healthDocument struct {
+	Status string                       `json:"status"`
+	Output string                       `json:"output"`
+	Checks map[string][]healthComponent `json:"checks"`
+}
+
+// healthComponent is a single entry of the checks of a health+json response.
+type healthComponent struct {
+	ComponentId string `json:"componentId"`
+	Status      string `json:"status"`
+	Output      string `json:"output"`
+}
+
+// IsHealthJSON reports whether the response headers declare a health+json body.
+func IsHealthJSON(header http.Header) bool {
+	media_type, _, err := mime.ParseMediaType(header.Get("Content-Type"))
+	return err == nil && media_type == HealthJSONContentType
+}
+
+// ParseHealthJSON parses a health+json response body, returning its normalized overall status and
+// the status of every component it reports, sorted by name. Components are named after their
+// check, e.g. "db:responseTime", followed by their component id when they have one.
+func ParseHealthJSON(body []byte) (string, []ComponentStatus, error) {
+	var document healthDocument
+	if err := json.Unmarshal(body, &document); err != nil {
+		return "", nil, fmt.Errorf("failed to decode health+json response: %v", err)
+	}
+	if document.Status == "" {
+		return "", nil, fmt.Errorf("health+json response has no status")
+	}
+
+	components := []ComponentStatus{}
+	for check, entries := range document.Checks {
+		for _, entry := range entries {
+			name := check
+			if entry.ComponentId != "" {
+				name = fmt.Sprintf("%s (%s)", check, entry.ComponentId)
+			}
+			components = append(components, ComponentStatus{
+				Name:   name,
+				Status: normalizeHealthStatus(entry.Status),
+				Output: entry.Output,
+			})
+		}
+	}
+	sort.Slice(components, func(i, j int) bool { return components[i].Name < components[j].Name })
+
+	return normalizeHealthStatus(document.Status), components, nil
+}
+
+// normalizeHealthStatus maps the status values allowed by the health+json format to HealthPass,
+// HealthWarn and HealthFail. Unrecognized values are returned lowercased.
+func normalizeHealthStatus(status string) string {
+	status = strings.ToLower(strings.TrimSpace(status))
+	switch status {
+	case "pass", "ok", "up":
+		return HealthPass
+	case "warn":
+		return HealthWarn
+	case "fail", "error", "down":
+		return HealthFail
+	default:
+		return status
+	}
+}
+
+// failedComponents returns the names of the components that aren't passing.
+func failedComponents(components []ComponentStatus) []string {
+	var names []string
+	for _, component := range components {
+		if component.Status != HealthPass {
+			names = append(names, component.Name)
+		}
+	}
+	return names
+}
+
+// applyHealthStatus applies the overall status reported by a health+json response to a result
+// that is otherwise up: a failing response marks it down and a warning one degraded, naming the
+// components that aren't passing.
+func (result *CheckResult) applyHealthStatus(status string) {
+	if result.Status != StatusUp || (status != HealthFail && status != HealthWarn) {
+		return
+	}
+
+	message := fmt.Sprintf("health check reported %s", status)
+	if names := failedComponents(result.Components); len(names) > 0 {
+		message += " for " + strings.Join(names, ", ")
+	}
+
+	if status == HealthFail {
+		result.fail(StatusDown, ErrorKindHealth, errors.New(message))
+	} else {
+		result.fail(StatusDegraded, ErrorKindHealth, errors.New(message))
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-playground/assert/v2"
+)
+
+func TestParseHealthJSON(t *testing.T) {
+	cases := []struct {
+		name               string
+		body               string
+		expectedFail       bool
+		expectedStatus     string
+		expectedComponents []ComponentStatus
+	}{
+		{
+			name:               "Passing Without Checks",
+			body:               `{"status": "pass"}`,
+			expectedStatus:     HealthPass,
+			expectedComponents: []ComponentStatus{},
+		},
+		{
+			name: "Components Sorted By Name",
+			body: `{"status": "warn", "checks": {
+				"postgres:responseTime": [{"componentId": "primary", "status": "pass"}, {"componentId": "replica", "status": "fail", "output": "timeout"}],
+				"cache:connections": [{"status": "warn"}]
+			}}`,
+			expectedStatus: HealthWarn,
+			expectedComponents: []ComponentStatus{
+				{Name: "cache:connections", Status: HealthWarn},
+				{Name: "postgres:responseTime (primary)", Status: HealthPass},
+				{Name: "postgres:responseTime (replica)", Status: HealthFail, Output: "timeout"},
+			},
+		},
+		{
+			name:               "Normalized Status",
+			body:               `{"status": "DOWN"}`,
+			expectedStatus:     HealthFail,
+			expectedComponents: []ComponentStatus{},
+		},
+		{
+			name:         "Missing Status",
+			body:         `{"checks": {}}`,
+			expectedFail: true,
+		},
+		{
+			name:         "Invalid JSON",
+			body:         `<html>`,
+			expectedFail: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			status, components, err := ParseHealthJSON([]byte(tc.body))
+			if tc.expectedFail {
+				assert.NotEqual(t, err, nil)
+				return
+			}
+
+			assert.Equal(t, err, nil)
+			assert.Equal(t, status, tc.expectedStatus)
+			assert.Equal(t, components, tc.expectedComponents)
+		})
+	}
+}
+
+func TestGetEndpointHealthHealthJSON(t *testing.T) {
+	cases := []struct {
+		name               string
+		contentType        string
+		statusCode         int
+		body               string
+		expectedStatus     string
+		expectedKind       string
+		expectedComponents int
+	}{
+		{
+			name:               "Passing",
+			contentType:        HealthJSONContentType,
+			statusCode:         http.StatusOK,
+			body:               `{"status": "pass", "checks": {"db:responseTime": [{"status": "pass"}]}}`,
+			expectedStatus:     StatusUp,
+			expectedComponents: 1,
+		},
+		{
+			name:               "Warning",
+			contentType:        HealthJSONContentType + "; charset=utf-8",
+			statusCode:         http.StatusOK,
+			body:               `{"status": "warn", "checks": {"db:responseTime": [{"status": "warn"}]}}`,
+			expectedStatus:     StatusDegraded,
+			expectedKind:       ErrorKindHealth,
+			expectedComponents: 1,
+		},
+		{
+			name:               "Failing",
+			contentType:        HealthJSONContentType,
+			statusCode:         http.StatusOK,
+			body:               `{"status": "fail", "checks": {"db:responseTime": [{"status": "fail"}]}}`,
+			expectedStatus:     StatusDown,
+			expectedKind:       ErrorKindHealth,
+			expectedComponents: 1,
+		},
+		{
+			name:               "Failing Status Code Keeps Components",
+			contentType:        HealthJSONContentType,
+			statusCode:         http.StatusServiceUnavailable,
+			body:               `{"status": "fail", "checks": {"db:responseTime": [{"status": "fail"}]}}`,
+			expectedStatus:     StatusDown,
+			expectedKind:       ErrorKindStatus,
+			expectedComponents: 1,
+		},
+		{
+			name:           "Other Content Type",
+			contentType:    "application/json",
+			statusCode:     http.StatusOK,
+			body:           `{"status": "fail"}`,
+			expectedStatus: StatusUp,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			mock_server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", tc.contentType)
+				w.WriteHeader(tc.statusCode)
+				w.Write([]byte(tc.body))
+			}))
+			defer mock_server.Close()
+
+			endpoint := Endpoint{Name: "Health Test", Url: mock_server.URL, State: NewEndpointState(0, 0)}
+			result := endpoint.GetEndpointHealth(2 * time.Second)
+			endpoint.State.Record(result, result.FinishedAt)
+
+			assert.Equal(t, result.Status, tc.expectedStatus)
+			assert.Equal(t, result.ErrorKind, tc.expectedKind)
+			assert.Equal(t, len(result.Components), tc.expectedComponents)
+			assert.Equal(t, len(endpoint.State.Status().Components), tc.expectedComponents)
+		})
+	}
+}
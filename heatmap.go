@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// The latencies of the checks of every endpoint are accumulated by day of the week and hour of the
+// day, in the availability_timezone, and served by the REST API on /api/v1/heatmap as JSON or CSV,
+// ready to be drawn as a heatmap, so recurring slow periods, such as nightly backups slowing down
+// production, stand out. The heatmap covers the checks made since the program started.
+
+// HeatmapDays are the days of the week of a heatmap, in its order.
+var HeatmapDays = []string{"monday", "tuesday", "wednesday", "thursday", "friday", "saturday", "sunday"}
+
+// LatencyHeatmap accumulates the latencies of the checks of every endpoint by day of the week and
+// hour of the day. It is safe for concurrent use, so the heatmap can be served while a cycle is
+// recorded.
+type LatencyHeatmap struct {
+	mu       sync.Mutex
+	timezone string
+
+	// endpoints are the endpoints checked, in the order they were first checked, so endpoints
+	// removed by a reload are still reported.
+	endpoints []*endpointHeatmap
+	index     map[string]*endpointHeatmap
+}
+
+// endpointHeatmap is the latencies of an endpoint, indexed by HeatmapDays and hour.
+type endpointHeatmap struct {
+	endpoint string
+	url      string
+	cells    [7][24]heatmapCell
+}
+
+type heatmapCell struct {
+	count int
+	total time.Duration
+	max   time.Duration
+}
+
+// Heatmap is the latency heatmap of the endpoints, as served on /api/v1/heatmap.
+type Heatmap struct {
+	// Timezone is the time zone the checks are bucketed in.
+	Timezone  string            `json:"timezone"`
+	Endpoints []EndpointHeatmap `json:"endpoints"`
+}
+
+// EndpointHeatmap is the latency heatmap of an endpoint, with a cell for each hour of the week with
+// checks, from monday 0:00 to sunday 23:00.
+type EndpointHeatmap struct {
+	Endpoint string        `json:"endpoint"`
+	Url      string        `json:"url"`
+	Cells    []HeatmapCell `json:"cells"`
+}
+
+// HeatmapCell is the latency of the checks of an endpoint made during an hour of a day of the week,
+// e.g. every monday from 2:00 to 2:59.
+type HeatmapCell struct {
+	Day           string  `json:"day"`
+	Hour          int     `json:"hour"`
+	Checks        int     `json:"checks"`
+	MeanLatencyMs float64 `json:"mean_latency_ms"`
+	MaxLatencyMs  float64 `json:"max_latency_ms"`
+}
+
+// Observe records the latencies of the results of a cycle, bucketed by the time the checks started
+// in location. Unknown checks and checks without a latency are ignored. Nil heatmaps are ignored,
+// as are the following methods.
+func (heatmap *LatencyHeatmap) Observe(results []CheckResult, location *time.Location) {
+	if heatmap == nil {
+		return
+	}
+	heatmap.mu.Lock()
+	defer heatmap.mu.Unlock()
+
+	if heatmap.index == nil {
+		heatmap.index = map[string]*endpointHeatmap{}
+	}
+	heatmap.timezone = location.String()
+
+	for _, result := range results {
+		if result.Status == StatusUnknown || result.Latency <= 0 {
+			continue
+		}
+		key := result.Endpoint + "\x00" + result.Url
+		endpoint, ok := heatmap.index[key]
+		if !ok {
+			endpoint = &endpointHeatmap{endpoint: result.Endpoint, url: result.Url}
+			heatmap.index[key] = endpoint
+			heatmap.endpoints = append(heatmap.endpoints, endpoint)
+		}
+
+		// weeks start on monday, while time.Weekday starts on sunday
+		local := result.StartedAt.In(location)
+		cell := &endpoint.cells[(local.Weekday()+6)%7][local.Hour()]
+		cell.count++
+		cell.total += result.Latency
+		if result.Latency > cell.max {
+			cell.max = result.Latency
+		}
+	}
+}
+
+// Heatmap returns the latency heatmap of the endpoints.
+func (heatmap *LatencyHeatmap) Heatmap() Heatmap {
+	report := Heatmap{Timezone: time.UTC.String(), Endpoints: []EndpointHeatmap{}}
+	if heatmap == nil {
+		return report
+	}
+	heatmap.mu.Lock()
+	defer heatmap.mu.Unlock()
+
+	if heatmap.timezone != "" {
+		report.Timezone = heatmap.timezone
+	}
+	for _, endpoint := range heatmap.endpoints {
+		cells := []HeatmapCell{}
+		for day := range endpoint.cells {
+			for hour, cell := range endpoint.cells[day] {
+				if cell.count == 0 {
+					continue
+				}
+				cells = append(cells, HeatmapCell{
+					Day:           HeatmapDays[day],
+					Hour:          hour,
+					Checks:        cell.count,
+					MeanLatencyMs: latencyMilliseconds(cell.total / time.Duration(cell.count)),
+					MaxLatencyMs:  latencyMilliseconds(cell.max),
+				})
+			}
+		}
+		report.Endpoints = append(report.Endpoints, EndpointHeatmap{Endpoint: endpoint.endpoint, Url: endpoint.url, Cells: cells})
+	}
+	return report
+}
+
+// WriteHeatmapCSV writes the heatmap as CSV, with a header and a row per cell:
+//
+//	endpoint,url,day,hour,checks,mean_latency_ms,max_latency_ms
+func WriteHeatmapCSV(w io.Writer, heatmap Heatmap) error {
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"endpoint", "url", "day", "hour", "checks", "mean_latency_ms", "max_latency_ms"})
+	for _, endpoint := range heatmap.Endpoints {
+		for _, cell := range endpoint.Cells {
+			writer.Write([]string{
+				endpoint.Endpoint,
+				endpoint.Url,
+				cell.Day,
+				strconv.Itoa(cell.Hour),
+				strconv.Itoa(cell.Checks),
+				strconv.FormatFloat(cell.MeanLatencyMs, 'f', -1, 64),
+				strconv.FormatFloat(cell.MaxLatencyMs, 'f', -1, 64),
+			})
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
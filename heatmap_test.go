@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/go-playground/assert/v2"
+)
+
+func TestLatencyHeatmap(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	assert.Equal(t, err, nil)
+
+	// sunday 2024-06-02 23:30 UTC is monday 1:30 in Paris
+	sunday := time.Date(2024, 6, 2, 23, 30, 0, 0, time.UTC)
+	heatmap := &LatencyHeatmap{}
+	heatmap.Observe([]CheckResult{
+		{Endpoint: "index", Url: "https://fetch.com/", Status: StatusUp, Latency: 100 * time.Millisecond, StartedAt: sunday},
+		{Endpoint: "careers", Url: "https://fetch.com/careers", Status: StatusUnknown, Latency: 50 * time.Millisecond, StartedAt: sunday},
+	}, paris)
+	heatmap.Observe([]CheckResult{
+		{Endpoint: "index", Url: "https://fetch.com/", Status: StatusDown, Latency: 500 * time.Millisecond, StartedAt: sunday.Add(15 * time.Minute)},
+		{Endpoint: "careers", Url: "https://fetch.com/careers", Status: StatusDown, StartedAt: sunday.Add(15 * time.Minute)},
+	}, paris)
+	heatmap.Observe([]CheckResult{
+		{Endpoint: "index", Url: "https://fetch.com/", Status: StatusDegraded, Latency: 200 * time.Millisecond, StartedAt: sunday.Add(-22 * time.Hour)},
+		{Endpoint: "careers", Url: "https://fetch.com/careers", Status: StatusUp, Latency: 80 * time.Millisecond, StartedAt: sunday.Add(-22 * time.Hour)},
+	}, paris)
+
+	// unknown checks and checks without a latency are ignored, and cells are ordered from monday
+	assert.Equal(t, heatmap.Heatmap(), Heatmap{
+		Timezone: "Europe/Paris",
+		Endpoints: []EndpointHeatmap{
+			{Endpoint: "index", Url: "https://fetch.com/", Cells: []HeatmapCell{
+				{Day: "monday", Hour: 1, Checks: 2, MeanLatencyMs: 300, MaxLatencyMs: 500},
+				{Day: "sunday", Hour: 3, Checks: 1, MeanLatencyMs: 200, MaxLatencyMs: 200},
+			}},
+			{Endpoint: "careers", Url: "https://fetch.com/careers", Cells: []HeatmapCell{
+				{Day: "sunday", Hour: 3, Checks: 1, MeanLatencyMs: 80, MaxLatencyMs: 80},
+			}},
+		},
+	})
+
+	var csv bytes.Buffer
+	assert.Equal(t, WriteHeatmapCSV(&csv, heatmap.Heatmap()), nil)
+	assert.Equal(t, csv.String(), "endpoint,url,day,hour,checks,mean_latency_ms,max_latency_ms\n"+
+		"index,https://fetch.com/,monday,1,2,300,500\n"+
+		"index,https://fetch.com/,sunday,3,1,200,200\n"+
+		"careers,https://fetch.com/careers,sunday,3,1,80,80\n")
+
+	// nil heatmaps are empty
+	var disabled *LatencyHeatmap
+	disabled.Observe([]CheckResult{{Endpoint: "index", Status: StatusUp, Latency: time.Second}}, time.UTC)
+	assert.Equal(t, disabled.Heatmap(), Heatmap{Timezone: "UTC", Endpoints: []EndpointHeatmap{}})
+}
@@ -0,0 +1,205 @@
+//go:build !noparquet
+// +build !noparquet
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// With parquet_dir, the result of every check is exported to Parquet files partitioned by day, in
+// Hive-style date=YYYY-MM-DD directories, so the check history can be queried at scale by DuckDB,
+// Spark or Athena without a bespoke ETL job, e.g.:
+//
+//	SELECT domain, avg(CASE WHEN status = 'DOWN' THEN 0 ELSE 1 END)
+//	FROM read_parquet('history/*/*.parquet', hive_partitioning = true)
+//	WHERE status != 'UNKNOWN' GROUP BY domain
+//
+// Since Parquet files can't be appended to, results are buffered and written to a new file at
+// least every ParquetFlushInterval, every ParquetMaxRows results, when the day changes and when the
+// program exits.
+
+// ParquetFlushInterval is the maximum time results are buffered before they are written.
+const ParquetFlushInterval time.Duration = time.Hour
+
+// ParquetMaxRows is the maximum number of results written to a single Parquet file.
+const ParquetMaxRows int = 100000
+
+// ParquetExporter exports the check history to Parquet files in a directory, partitioned by day.
+type ParquetExporter struct {
+	mu  sync.Mutex
+	dir string
+
+	// rows are the results buffered since buffered_at, all started the same day.
+	rows        []historyRow
+	buffered_at time.Time
+}
+
+// historyRow is a check result exported by a ParquetExporter.
+type historyRow struct {
+	result CheckResult
+	domain string
+}
+
+// NewParquetExporter creates a ParquetExporter writing to dir, which is created if it doesn't
+// exist.
+func NewParquetExporter(dir string) (*ParquetExporter, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create parquet directory: %v", err)
+	}
+	return &ParquetExporter{dir: dir}, nil
+}
+
+// Observe is a method for ParquetExporter that buffers the results of a check cycle, along with
+// the domains of their endpoints, writing the buffered results first when they are due. Nil
+// exporters are ignored.
+func (exporter *ParquetExporter) Observe(results []CheckResult, endpoints *Endpoints) {
+	if exporter == nil {
+		return
+	}
+
+	exporter.mu.Lock()
+	defer exporter.mu.Unlock()
+
+	for i, result := range results {
+		day := result.StartedAt.UTC().Format("2006-01-02")
+		if len(exporter.rows) > 0 && (day != exporter.rows[0].result.StartedAt.UTC().Format("2006-01-02") || len(exporter.rows) >= ParquetMaxRows) {
+			exporter.flush()
+		}
+		if len(exporter.rows) == 0 {
+			exporter.buffered_at = time.Now()
+		}
+
+		row := historyRow{result: result}
+		if endpoints != nil && i < len(*endpoints) && (*endpoints)[i].Domain != nil {
+			row.domain = (*endpoints)[i].Domain.Name
+		}
+		exporter.rows = append(exporter.rows, row)
+	}
+
+	if len(exporter.rows) > 0 && time.Since(exporter.buffered_at) >= ParquetFlushInterval {
+		exporter.flush()
+	}
+}
+
+// Close is a method for ParquetExporter that writes the buffered results. Nil exporters are
+// ignored.
+func (exporter *ParquetExporter) Close() {
+	if exporter == nil {
+		return
+	}
+
+	exporter.mu.Lock()
+	defer exporter.mu.Unlock()
+	exporter.flush()
+}
+
+// flush writes the buffered results to a new file in the partition of their day, logging
+// failures. The results are dropped either way, so a failing directory doesn't exhaust memory.
+func (exporter *ParquetExporter) flush() {
+	if len(exporter.rows) == 0 {
+		return
+	}
+	rows := exporter.rows
+	exporter.rows = nil
+
+	if _, err := writeHistory(exporter.dir, rows, time.Now()); err != nil {
+		log.Printf("Failed to export %d results to parquet: %v", len(rows), err)
+	}
+}
+
+// writeHistory writes rows to a new Parquet file named after the time it is written at, in the
+// date=YYYY-MM-DD partition of dir of the first row, and returns its path. The file is written
+// under a temporary name first, so readers never see it partially written.
+func writeHistory(dir string, rows []historyRow, at time.Time) (string, error) {
+	partition := filepath.Join(dir, "date="+rows[0].result.StartedAt.UTC().Format("2006-01-02"))
+	if err := os.MkdirAll(partition, 0o755); err != nil {
+		return "", fmt.Errorf("failed to create partition: %v", err)
+	}
+
+	var file bytes.Buffer
+	if err := writeParquet(&file, historyColumns(rows)); err != nil {
+		return "", err
+	}
+
+	// files written within the same millisecond are numbered
+	name := "checks-" + at.UTC().Format("20060102T150405.000Z")
+	path := filepath.Join(partition, name+".parquet")
+	for i := 1; fileExists(path); i++ {
+		path = filepath.Join(partition, fmt.Sprintf("%s-%d.parquet", name, i))
+	}
+	temporary := filepath.Join(partition, "."+filepath.Base(path)+".tmp")
+	if err := os.WriteFile(temporary, file.Bytes(), 0o644); err != nil {
+		return "", fmt.Errorf("failed to write %s: %v", temporary, err)
+	}
+	if err := os.Rename(temporary, path); err != nil {
+		os.Remove(temporary)
+		return "", fmt.Errorf("failed to rename %s: %v", temporary, err)
+	}
+	return path, nil
+}
+
+// fileExists reports whether a file exists at path.
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// historyColumns returns the columns of the Parquet table of the rows. Status codes, error kinds
+// and errors are null for the checks without one.
+func historyColumns(rows []historyRow) []parquetColumn {
+	columns := []parquetColumn{
+		{name: "started_at", kind: parquetInt64, converted: parquetTimestampMillis},
+		{name: "endpoint", kind: parquetByteArray, converted: parquetUTF8},
+		{name: "url", kind: parquetByteArray, converted: parquetUTF8},
+		{name: "domain", kind: parquetByteArray, converted: parquetUTF8},
+		{name: "status", kind: parquetByteArray, converted: parquetUTF8},
+		{name: "status_code", kind: parquetInt32, converted: parquetNoConversion, optional: true},
+		{name: "latency_ms", kind: parquetDouble, converted: parquetNoConversion},
+		{name: "error_kind", kind: parquetByteArray, converted: parquetUTF8, optional: true},
+		{name: "error", kind: parquetByteArray, converted: parquetUTF8, optional: true},
+		{name: "retries", kind: parquetInt32, converted: parquetNoConversion},
+	}
+	for i := range columns {
+		columns[i].values = make([]interface{}, 0, len(rows))
+	}
+
+	for _, row := range rows {
+		result := row.result
+		values := []interface{}{
+			result.StartedAt.UnixNano() / int64(time.Millisecond),
+			result.Endpoint,
+			result.Url,
+			row.domain,
+			result.Status,
+			nil,
+			float64(result.Latency) / float64(time.Millisecond),
+			nil,
+			nil,
+			int32(result.Retries),
+		}
+		if result.StatusCode != 0 {
+			values[5] = int32(result.StatusCode)
+		}
+		if result.ErrorKind != "" {
+			values[7] = result.ErrorKind
+		}
+		if result.Error != "" {
+			values[8] = result.Error
+		}
+		for i := range columns {
+			columns[i].values = append(columns[i].values, values[i])
+		}
+	}
+	return columns
+}
+
+func init() {
+	RegisterFeature(FeatureExport, "parquet")
+}
@@ -0,0 +1,148 @@
+//go:build !nosqlite
+// +build !nosqlite
+
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// With sqlite_file, the result of every check is also appended to the checks table of a SQLite
+// database at the end of each cycle, so the availability can be computed over any historical
+// window and the history queried with SQL after the fact, e.g.:
+//
+//	SELECT endpoint, 100.0 * sum(status != 'down') / count(*) FROM checks
+//	WHERE status != 'unknown' AND started_at >= '2024-06-01' GROUP BY endpoint
+//
+// Unlike parquet_dir, results aren't buffered: each cycle is a single write, and the database can
+// be queried while CheckHealth runs.
+
+// SQLiteTable is the table of the check history, and SQLiteSchema its definition.
+const (
+	SQLiteTable  string = "checks"
+	SQLiteSchema string = "CREATE TABLE checks (id INTEGER PRIMARY KEY, started_at TEXT NOT NULL, " +
+		"endpoint TEXT NOT NULL, url TEXT NOT NULL, domain TEXT, status TEXT NOT NULL, status_code INTEGER, " +
+		"latency_ms REAL NOT NULL, reason TEXT, error_kind TEXT, error TEXT)"
+)
+
+// SQLiteMaxText is the maximum length in bytes of the text values of a row, longer values being
+// truncated, so every row fits in a page of the database.
+const SQLiteMaxText int = 900
+
+// SQLiteHistory appends the check history to a SQLite database.
+type SQLiteHistory struct {
+	mu   sync.Mutex
+	path string
+	db   *sqliteDB
+}
+
+// NewSQLiteHistory creates a SQLiteHistory writing to the database at path, which is created with
+// the checks table if it doesn't exist. Existing databases must only hold the checks table.
+func NewSQLiteHistory(path string) (*SQLiteHistory, error) {
+	db, err := openSQLite(path, SQLiteTable, SQLiteSchema)
+	if err != nil {
+		return nil, err
+	}
+	return &SQLiteHistory{path: path, db: db}, nil
+}
+
+// Observe is a method for SQLiteHistory that appends the results of a check cycle, along with the
+// domains of their endpoints, to the database, logging failures. The database is opened again
+// first if it failed to. Nil histories are ignored.
+func (history *SQLiteHistory) Observe(results []CheckResult, endpoints *Endpoints) {
+	if history == nil || len(results) == 0 {
+		return
+	}
+
+	history.mu.Lock()
+	defer history.mu.Unlock()
+
+	if history.db == nil {
+		db, err := openSQLite(history.path, SQLiteTable, SQLiteSchema)
+		if err != nil {
+			log.Printf("Failed to write %d results to sqlite: %v", len(results), err)
+			return
+		}
+		history.db = db
+	}
+
+	records := make([][]byte, 0, len(results))
+	for i, result := range results {
+		domain := ""
+		if endpoints != nil && i < len(*endpoints) && (*endpoints)[i].Domain != nil {
+			domain = (*endpoints)[i].Domain.Name
+		}
+		records = append(records, sqliteRecord(sqliteHistoryValues(result, domain)))
+	}
+	if err := history.db.Append(records); err != nil {
+		log.Printf("Failed to write %d results to sqlite: %v", len(results), err)
+	}
+}
+
+// Close is a method for SQLiteHistory that closes the database. Nil histories are ignored.
+func (history *SQLiteHistory) Close() {
+	if history == nil {
+		return
+	}
+
+	history.mu.Lock()
+	defer history.mu.Unlock()
+	if history.db != nil {
+		history.db.Close()
+		history.db = nil
+	}
+}
+
+// sqliteHistoryValues returns the values of the row of a result in the checks table. Times are
+// stored as ISO 8601 UTC text, which SQLite's date functions understand, and the status codes,
+// failure reasons, error kinds and errors are null for the checks without one. The failure reason
+// is that of the down checks, see FailureReason.
+func sqliteHistoryValues(result CheckResult, domain string) []interface{} {
+	values := []interface{}{
+		nil, // id, an alias of the rowid
+		result.StartedAt.UTC().Format("2006-01-02T15:04:05.000Z"),
+		truncateText(result.Endpoint, SQLiteMaxText),
+		truncateText(result.Url, SQLiteMaxText),
+		nil,
+		result.Status,
+		nil,
+		float64(result.Latency) / float64(time.Millisecond),
+		nil,
+		nil,
+		nil,
+	}
+	if domain != "" {
+		values[4] = truncateText(domain, SQLiteMaxText)
+	}
+	if result.StatusCode != 0 {
+		values[6] = int64(result.StatusCode)
+	}
+	if result.Status == StatusDown {
+		values[8] = FailureReason(result)
+	}
+	if result.ErrorKind != "" {
+		values[9] = result.ErrorKind
+	}
+	if result.Error != "" {
+		values[10] = truncateText(result.Error, SQLiteMaxText)
+	}
+	return values
+}
+
+// truncateText returns the first length bytes of text, without splitting a UTF-8 character.
+func truncateText(text string, length int) string {
+	if len(text) <= length {
+		return text
+	}
+	for length > 0 && !utf8.RuneStart(text[length]) {
+		length--
+	}
+	return text[:length]
+}
+
+func init() {
+	RegisterFeature(FeatureExport, "sqlite")
+}
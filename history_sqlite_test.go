@@ -0,0 +1,92 @@
+//go:build !nosqlite
+// +build !nosqlite
+
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-playground/assert/v2"
+)
+
+func TestSQLiteHistory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.db")
+	history, err := NewSQLiteHistory(path)
+	assert.Equal(t, err, nil)
+
+	endpoints := Endpoints{
+		{Name: "index", Url: "https://fetch.com/"},
+		{Name: "careers", Url: "https://fetch.com/careers", Group: "fetch"},
+	}
+	_, err = endpoints.CreateNewTargets()
+	assert.Equal(t, err, nil)
+
+	// every cycle is appended, and kept when the database is opened again
+	started_at := time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+	history.Observe([]CheckResult{
+		{Endpoint: "index", Url: "https://fetch.com/", Status: StatusUp, StatusCode: 200, StartedAt: started_at, Latency: 120 * time.Millisecond},
+		{Endpoint: "careers", Url: "https://fetch.com/careers", Status: StatusDown, ErrorKind: ErrorKindConnection, Error: "dial tcp: connection refused", StartedAt: started_at},
+	}, &endpoints)
+	history.Close()
+
+	history, err = NewSQLiteHistory(path)
+	assert.Equal(t, err, nil)
+	history.Observe([]CheckResult{
+		{Endpoint: "index", Url: "https://fetch.com/", Status: StatusUp, StatusCode: 200, StartedAt: started_at.Add(time.Minute)},
+	}, &endpoints)
+
+	rows, err := history.db.rows(sqliteTableRoot)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, len(rows), 3)
+	assert.Equal(t, rows[0], []interface{}{nil, "2023-06-01T12:00:00.000Z", "index", "https://fetch.com/", "fetch.com", StatusUp, int64(200), 120.0, nil, nil, nil})
+	assert.Equal(t, rows[1], []interface{}{nil, "2023-06-01T12:00:00.000Z", "careers", "https://fetch.com/careers", "fetch", StatusDown, nil, 0.0, "connection refused", ErrorKindConnection, "dial tcp: connection refused"})
+	assert.Equal(t, rows[2][1], "2023-06-01T12:01:00.000Z")
+	history.Close()
+
+	// nil histories are ignored
+	var disabled *SQLiteHistory
+	disabled.Observe([]CheckResult{{Endpoint: "index"}}, &endpoints)
+	disabled.Close()
+}
+
+func TestSQLiteHistoryRetry(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "missing", "history.db")
+	_, err := NewSQLiteHistory(path)
+	assert.NotEqual(t, err, nil)
+
+	// the database is opened again on every cycle until it succeeds
+	history := &SQLiteHistory{path: path}
+	history.Observe([]CheckResult{{Endpoint: "index", Status: StatusUp}}, nil)
+	assert.Equal(t, history.db, nil)
+
+	history.path = filepath.Join(dir, "history.db")
+	history.Observe([]CheckResult{{Endpoint: "index", Status: StatusUp}}, nil)
+	defer history.Close()
+	rows, err := history.db.rows(sqliteTableRoot)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, len(rows), 1)
+}
+
+func TestSQLiteHistoryValues(t *testing.T) {
+	long_error := strings.Repeat("é", SQLiteMaxText)
+	values := sqliteHistoryValues(CheckResult{Endpoint: "index", Status: StatusDown, StatusCode: 503, ErrorKind: ErrorKindStatus, Error: long_error}, "")
+	assert.Equal(t, values[4], nil)
+	assert.Equal(t, values[6], int64(503))
+	assert.Equal(t, values[8], "status 503")
+	assert.Equal(t, values[10], strings.Repeat("é", SQLiteMaxText/2))
+
+	// degraded checks have an error kind but no failure reason
+	values = sqliteHistoryValues(CheckResult{Endpoint: "index", Status: StatusDegraded, ErrorKind: ErrorKindLatency}, "fetch.com")
+	assert.Equal(t, values[4], "fetch.com")
+	assert.Equal(t, values[8], nil)
+	assert.Equal(t, values[9], ErrorKindLatency)
+
+	// the largest rows still fit in a page
+	long := strings.Repeat("x", 2*SQLiteMaxText)
+	record := sqliteRecord(sqliteHistoryValues(CheckResult{Endpoint: long, Url: long, Status: StatusDown, ErrorKind: ErrorKindConnection, Error: long}, long))
+	assert.Equal(t, len(record) <= sqliteMaxPayload, true)
+}
@@ -0,0 +1,93 @@
+//go:build !noparquet
+// +build !noparquet
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-playground/assert/v2"
+)
+
+func TestParquetExporter(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "history")
+	exporter, err := NewParquetExporter(dir)
+	assert.Equal(t, err, nil)
+
+	endpoints := Endpoints{
+		{Name: "index", Url: "https://fetch.com/"},
+		{Name: "careers", Url: "https://fetch.com/careers", Group: "fetch"},
+	}
+	_, err = endpoints.CreateNewTargets()
+	assert.Equal(t, err, nil)
+
+	// results are buffered within a day
+	day := time.Now().UTC().Truncate(24 * time.Hour)
+	exporter.Observe([]CheckResult{
+		{Endpoint: "index", Url: "https://fetch.com/", Status: StatusUp, StatusCode: 200, StartedAt: day.Add(time.Hour)},
+		{Endpoint: "careers", Url: "https://fetch.com/careers", Status: StatusDown, ErrorKind: ErrorKindConnection, Error: "connection refused", StartedAt: day.Add(time.Hour)},
+	}, &endpoints)
+	files, _ := filepath.Glob(filepath.Join(dir, "*", "*.parquet"))
+	assert.Equal(t, len(files), 0)
+	assert.Equal(t, exporter.rows[0].domain, "fetch.com")
+	assert.Equal(t, exporter.rows[1].domain, "fetch")
+
+	// the results of the previous day are written once the day changes
+	exporter.Observe([]CheckResult{
+		{Endpoint: "index", Url: "https://fetch.com/", Status: StatusUp, StatusCode: 200, StartedAt: day.Add(25 * time.Hour)},
+	}, &endpoints)
+	files, _ = filepath.Glob(filepath.Join(dir, "date="+day.Format("2006-01-02"), "checks-*.parquet"))
+	assert.Equal(t, len(files), 1)
+	assert.Equal(t, len(exporter.rows), 1)
+
+	// the rest is written on close, in the partition of its day
+	exporter.Close()
+	files, _ = filepath.Glob(filepath.Join(dir, "date="+day.Add(24*time.Hour).Format("2006-01-02"), "checks-*.parquet"))
+	assert.Equal(t, len(files), 1)
+	assert.Equal(t, len(exporter.rows), 0)
+
+	// no temporary files are left behind
+	temporary, _ := filepath.Glob(filepath.Join(dir, "*", ".*.tmp"))
+	assert.Equal(t, len(temporary), 0)
+
+	// nil exporters are ignored
+	var disabled *ParquetExporter
+	disabled.Observe([]CheckResult{{Endpoint: "index"}}, &endpoints)
+	disabled.Close()
+}
+
+func TestHistoryColumns(t *testing.T) {
+	started_at := time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+	columns := historyColumns([]historyRow{
+		{result: CheckResult{Endpoint: "index", Url: "https://fetch.com/", Status: StatusUp, StatusCode: 200, Latency: 1500 * time.Microsecond, StartedAt: started_at}, domain: "fetch.com"},
+		{result: CheckResult{Endpoint: "careers", Url: "https://fetch.com/careers", Status: StatusDown, ErrorKind: ErrorKindTimeout, Error: "context deadline exceeded", Retries: 2, StartedAt: started_at}, domain: "fetch.com"},
+	})
+
+	values := map[string][]interface{}{}
+	for _, column := range columns {
+		values[column.name] = column.values
+	}
+	assert.Equal(t, values["started_at"], []interface{}{int64(1685620800000), int64(1685620800000)})
+	assert.Equal(t, values["status_code"], []interface{}{int32(200), nil})
+	assert.Equal(t, values["latency_ms"], []interface{}{1.5, 0.0})
+	assert.Equal(t, values["error_kind"], []interface{}{nil, ErrorKindTimeout})
+	assert.Equal(t, values["retries"], []interface{}{int32(0), int32(2)})
+
+	// files written at the same time don't replace each other
+	dir := t.TempDir()
+	rows := []historyRow{{result: CheckResult{Endpoint: "index", StartedAt: started_at}}}
+	first, err := writeHistory(dir, rows, started_at)
+	assert.Equal(t, err, nil)
+	second, err := writeHistory(dir, rows, started_at)
+	assert.Equal(t, err, nil)
+	assert.NotEqual(t, first, second)
+
+	// an unwritable directory fails the export
+	file := filepath.Join(t.TempDir(), "file")
+	assert.Equal(t, os.WriteFile(file, nil, 0o644), nil)
+	_, err = writeHistory(file, []historyRow{{result: CheckResult{StartedAt: started_at}}}, started_at)
+	assert.NotEqual(t, err, nil)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// URLs address their host by name, by IPv4 address, or by IPv6 literal enclosed in brackets, e.g.
+// http://[::1]:8080/health, with an optional port. Endpoints are aggregated into a domain per host
+// whatever their port. Names are compared in lower case without their trailing dot, and addresses
+// in their canonical form, so different spellings of the same host share a domain.
+
+// hostDomain returns the name of the domain of the host of a URL: the host name in lower case
+// without a trailing dot, or the canonical form of an IP address, e.g. "::1" for "[0:0::1]",
+// followed by its zone for scoped IPv6 addresses.
+func hostDomain(parsed *url.URL) string {
+	host, zone := splitZone(parsed.Hostname())
+	if ip := net.ParseIP(host); ip != nil {
+		return ip.String() + zone
+	}
+	return strings.TrimSuffix(strings.ToLower(parsed.Hostname()), ".")
+}
+
+// splitZone splits the zone of a scoped IPv6 address, e.g. "%eth0" of "fe80::1%eth0", from the
+// address.
+func splitZone(host string) (string, string) {
+	if i := strings.LastIndexByte(host, '%'); i >= 0 {
+		return host[:i], host[i:]
+	}
+	return host, ""
+}
+
+// ErrUnbracketedIPv6 is returned for URLs with an IPv6 literal that isn't enclosed in brackets,
+// whose port can't be told apart from the address.
+var ErrUnbracketedIPv6 = errors.New("IPv6 literals must be enclosed in brackets, e.g. http://[::1]:8080/")
+
+// validateHost rejects IPv6 literals that aren't enclosed in brackets and ports outside of 1 to
+// 65535, which url.Parse may accept.
+func validateHost(parsed *url.URL) error {
+	if strings.Count(parsed.Host, ":") > 1 && !strings.HasPrefix(parsed.Host, "[") {
+		return ErrUnbracketedIPv6
+	}
+	if port := parsed.Port(); port != "" {
+		if number, err := strconv.Atoi(port); err != nil || number < 1 || number > 65535 {
+			return fmt.Errorf("invalid port %s, expected 1 to 65535", port)
+		}
+	}
+	return nil
+}
+
+// urlHostError explains the failure to parse raw_url, pointing out IPv6 literals that aren't
+// enclosed in brackets, which url.Parse reports as an invalid port in recent Go versions.
+func urlHostError(raw_url string, err error) error {
+	err = errorCause(err)
+	authority := raw_url
+	if i := strings.Index(authority, "://"); i >= 0 {
+		authority = authority[i+3:]
+	}
+	if i := strings.IndexAny(authority, "/?#"); i >= 0 {
+		authority = authority[:i]
+	}
+	if i := strings.LastIndexByte(authority, '@'); i >= 0 {
+		authority = authority[i+1:]
+	}
+	if strings.Count(authority, ":") > 1 && !strings.HasPrefix(authority, "[") {
+		return ErrUnbracketedIPv6
+	}
+	return err
+}
+
+// hostWithPort returns an entry of hosts as the host of a URL, followed by port unless the entry
+// sets its own. Bare IPv6 addresses, such as "::1", are enclosed in brackets, as they can't set a
+// port of their own.
+func hostWithPort(host string, port string) string {
+	if address, _ := splitZone(host); strings.Contains(host, ":") && net.ParseIP(address) != nil {
+		if port == "" {
+			return "[" + host + "]"
+		}
+		return net.JoinHostPort(host, port)
+	}
+	if port == "" || (&url.URL{Host: host}).Port() != "" {
+		return host
+	}
+	return host + ":" + port
+}
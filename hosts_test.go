@@ -0,0 +1,123 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/go-playground/assert/v2"
+)
+
+func TestHostDomain(t *testing.T) {
+	cases := []struct {
+		name           string
+		url            string
+		expectedDomain string
+	}{
+		{name: "Host Name", url: "https://fetch.com/", expectedDomain: "fetch.com"},
+		{name: "Non-Standard Port", url: "https://fetch.com:8443/health", expectedDomain: "fetch.com"},
+		{name: "Upper Case And Trailing Dot", url: "https://FETCH.com./", expectedDomain: "fetch.com"},
+		{name: "IPv4", url: "http://10.0.4.12:8080/", expectedDomain: "10.0.4.12"},
+		{name: "IPv6 Literal", url: "http://[::1]:8080/health", expectedDomain: "::1"},
+		{name: "IPv6 Literal Without Port", url: "http://[2001:DB8::1]/", expectedDomain: "2001:db8::1"},
+		{name: "Expanded IPv6 Literal", url: "http://[2001:db8:0:0:0:0:0:1]:9090/", expectedDomain: "2001:db8::1"},
+		{name: "IPv4-Mapped IPv6 Literal", url: "http://[::ffff:10.0.4.12]/", expectedDomain: "10.0.4.12"},
+		{name: "Scoped IPv6 Literal", url: "http://[fe80::1%25eth0]:8080/", expectedDomain: "fe80::1%eth0"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			parsed, err := url.Parse(tc.url)
+			assert.Equal(t, err, nil)
+			assert.Equal(t, hostDomain(parsed), tc.expectedDomain)
+		})
+	}
+}
+
+func TestHostWithPort(t *testing.T) {
+	cases := []struct {
+		name         string
+		host         string
+		port         string
+		expectedHost string
+	}{
+		{name: "Host Name", host: "api-1.internal", port: "8080", expectedHost: "api-1.internal:8080"},
+		{name: "Host Name With Port", host: "api-1.internal:9090", port: "8080", expectedHost: "api-1.internal:9090"},
+		{name: "Host Name Without Port", host: "api-1.internal", port: "", expectedHost: "api-1.internal"},
+		{name: "Bare IPv6", host: "::1", port: "8080", expectedHost: "[::1]:8080"},
+		{name: "Bare IPv6 Without Port", host: "2001:db8::1", port: "", expectedHost: "[2001:db8::1]"},
+		{name: "Bracketed IPv6", host: "[::1]", port: "8080", expectedHost: "[::1]:8080"},
+		{name: "Bracketed IPv6 With Port", host: "[::1]:9090", port: "8080", expectedHost: "[::1]:9090"},
+		{name: "IPv4", host: "10.0.0.1", port: "8080", expectedHost: "10.0.0.1:8080"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, hostWithPort(tc.host, tc.port), tc.expectedHost)
+		})
+	}
+}
+
+func TestValidateConfigURLHosts(t *testing.T) {
+	cases := []struct {
+		name            string
+		url             string
+		expectedProblem string
+	}{
+		{name: "IPv6 Literal", url: "http://[::1]:8080/health"},
+		{name: "Unusual Port", url: "https://fetch.com:65535/"},
+		{name: "Unbracketed IPv6 Literal", url: "http://::1:8080/health", expectedProblem: "IPv6 literals must be enclosed in brackets"},
+		{name: "Port Out Of Range", url: "https://fetch.com:65536/", expectedProblem: "invalid port 65536"},
+		{name: "Port Zero", url: "https://fetch.com:0/", expectedProblem: "invalid port 0"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			loaded_config := []byte("- name: index\n  url: " + tc.url + "\n")
+			config, err := ParseConfig(loaded_config)
+			assert.Equal(t, err, nil)
+			err = ValidateConfig(loaded_config, config)
+			if tc.expectedProblem == "" {
+				assert.Equal(t, err, nil)
+				return
+			}
+			assert.NotEqual(t, err, nil)
+			assert.Equal(t, strings.Contains(err.Error(), tc.expectedProblem), true)
+		})
+	}
+}
+
+func TestIPv6Endpoints(t *testing.T) {
+	listener, err := net.Listen("tcp", "[::1]:0")
+	if err != nil {
+		t.Skipf("IPv6 loopback unavailable: %v", err)
+	}
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.Listener.Close()
+	server.Listener = listener
+	server.Start()
+	defer server.Close()
+
+	// the spellings of the same address share a domain, whatever their port
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+	endpoints := Endpoints{
+		{Name: "health", Url: "http://[::1]:" + port + "/health"},
+		{Name: "ready", Url: "http://[0:0::1]:" + port + "/ready"},
+		{Name: "expanded", Url: "http://localhost:" + port + "/live", Hosts: []string{"::1"}},
+	}
+	expanded, err := endpoints.ExpandHosts()
+	assert.Equal(t, err, nil)
+	assert.Equal(t, expanded[2].Url, "http://[::1]:"+port+"/live")
+
+	targets, err := expanded.CreateNewTargets()
+	assert.Equal(t, err, nil)
+	assert.Equal(t, targets.Domains.Name, "::1")
+	assert.Equal(t, targets.Domains.Next, (*Domain)(nil))
+
+	for _, result := range targets.CheckEndpoints(1, DefaultMaxLatency) {
+		assert.Equal(t, result.Status, StatusUp)
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+)
+
+// Every endpoint checks with a client of its own transport rather than http.DefaultClient, so
+// neither the tuning options of an endpoint nor changes made to the default client leak into the
+// checks of other endpoints. Endpoints with identical options share a client, and its connections.
+
+// ProxyDirect is the proxy of endpoints connecting directly to their target, ignoring the proxy
+// of the environment (HTTP_PROXY, HTTPS_PROXY and NO_PROXY).
+const ProxyDirect string = "direct"
+
+// ClientOptions are the options tuning the HTTP client of an endpoint. The zero value is a client
+// with the settings of http.DefaultTransport.
+type ClientOptions struct {
+	// MaxIdleConns is the maximum number of idle connections kept per host, and MaxConns the
+	// maximum number of connections per host, unlimited when zero.
+	MaxIdleConns int
+	MaxConns     int
+
+	DisableKeepAlives bool
+
+	// DisableRedirects returns redirect responses rather than following them, and MaxRedirects
+	// is the maximum number of redirects followed otherwise, see checkRedirect.
+	DisableRedirects bool
+	MaxRedirects     int
+
+	// Proxy is the URL of the HTTP proxy requests are sent through, ProxyDirect to connect
+	// directly, or empty to use the proxy of the environment.
+	Proxy string
+}
+
+// http_clients caches the tuned HTTP clients, by base client and options, so connections are
+// reused across checks.
+var http_clients = struct {
+	sync.Mutex
+	clients map[httpClientKey]*http.Client
+}{
+	clients: map[httpClientKey]*http.Client{},
+}
+
+// httpClientKey identifies a tuned HTTP client.
+type httpClientKey struct {
+	base    *http.Client
+	options ClientOptions
+}
+
+// HTTPClient returns an HTTP client tuned with options, with a copy of the transport of base, or
+// of http.DefaultTransport when base is nil. Bases must be long-lived, since the clients are
+// cached by base.
+func HTTPClient(base *http.Client, options ClientOptions) (*http.Client, error) {
+	http_clients.Lock()
+	defer http_clients.Unlock()
+
+	key := httpClientKey{base: base, options: options}
+	if client, ok := http_clients.clients[key]; ok {
+		return client, nil
+	}
+
+	var transport *http.Transport
+	if base == nil {
+		transport = http.DefaultTransport.(*http.Transport).Clone()
+	} else {
+		transport = base.Transport.(*http.Transport).Clone()
+	}
+	if err := options.apply(transport); err != nil {
+		return nil, err
+	}
+
+	client := &http.Client{Transport: transport, CheckRedirect: options.checkRedirect()}
+	http_clients.clients[key] = client
+	return client, nil
+}
+
+// apply is a method for ClientOptions that tunes transport with the options.
+func (options ClientOptions) apply(transport *http.Transport) error {
+	if options.MaxIdleConns > 0 {
+		transport.MaxIdleConnsPerHost = options.MaxIdleConns
+	}
+	if options.MaxConns > 0 {
+		transport.MaxConnsPerHost = options.MaxConns
+	}
+	transport.DisableKeepAlives = options.DisableKeepAlives
+
+	switch options.Proxy {
+	case "":
+	case ProxyDirect:
+		transport.Proxy = nil
+	default:
+		proxy, err := parseProxy(options.Proxy)
+		if err != nil {
+			return err
+		}
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+	return nil
+}
+
+// parseProxy parses the URL of an HTTP proxy.
+func parseProxy(proxy string) (*url.URL, error) {
+	parsed, err := url.Parse(proxy)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy %q: %v", proxy, err)
+	}
+	if (parsed.Scheme != "http" && parsed.Scheme != "https" && parsed.Scheme != "socks5") || parsed.Host == "" {
+		return nil, fmt.Errorf("invalid proxy %q, expected an http://, https:// or socks5:// URL, or %q", proxy, ProxyDirect)
+	}
+	return parsed, nil
+}
+
+// clientOptions returns the options tuning the endpoint's HTTP client.
+func (endpoint *Endpoint) clientOptions() ClientOptions {
+	return ClientOptions{
+		MaxIdleConns:      endpoint.MaxIdleConns,
+		MaxConns:          endpoint.MaxConns,
+		DisableKeepAlives: endpoint.DisableKeepAlives,
+		DisableRedirects:  !endpoint.followsRedirects(),
+		MaxRedirects:      endpoint.MaxRedirects,
+		Proxy:             endpoint.Proxy,
+	}
+}
+
+// validateClientOptions rejects negative connection limits, invalid proxies, and proxies of
+// endpoints whose connections must reach their target directly.
+func (endpoint *Endpoint) validateClientOptions() error {
+	if endpoint.MaxIdleConns < 0 || endpoint.MaxConns < 0 {
+		return errors.New("max_idle_conns and max_conns must be positive")
+	}
+	if endpoint.Proxy == "" || endpoint.Proxy == ProxyDirect {
+		return nil
+	}
+	if _, err := parseProxy(endpoint.Proxy); err != nil {
+		return err
+	}
+	if endpoint.DualStack || endpoint.ProxyProtocol != "" {
+		return errors.New("proxy can't be combined with dual_stack or proxy_protocol, which connect to the target directly")
+	}
+	return nil
+}
+
+// tuneClient returns base tuned with the endpoint's client options, which are validated by
+// ApplySettings.
+func (endpoint *Endpoint) tuneClient(base *http.Client) (*http.Client, error) {
+	return HTTPClient(base, endpoint.clientOptions())
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-playground/assert/v2"
+)
+
+func TestHTTPClient(t *testing.T) {
+	options := ClientOptions{MaxIdleConns: 4, MaxConns: 8, DisableKeepAlives: true, Proxy: ProxyDirect}
+	client, err := HTTPClient(nil, options)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, client == http.DefaultClient, false)
+
+	transport := client.Transport.(*http.Transport)
+	assert.Equal(t, transport.MaxIdleConnsPerHost, 4)
+	assert.Equal(t, transport.MaxConnsPerHost, 8)
+	assert.Equal(t, transport.DisableKeepAlives, true)
+	assert.Equal(t, transport.Proxy == nil, true)
+
+	// clients are shared by endpoints with the same options only
+	same, _ := HTTPClient(nil, options)
+	assert.Equal(t, same == client, true)
+	other, _ := HTTPClient(nil, ClientOptions{})
+	assert.Equal(t, other == client, false)
+	assert.Equal(t, other.Transport == http.DefaultTransport, false)
+
+	// the transport of the base client is tuned
+	base := ExpectContinueClient(3 * time.Second)
+	tuned, _ := HTTPClient(base, options)
+	assert.Equal(t, tuned.Transport.(*http.Transport).ExpectContinueTimeout, 3*time.Second)
+	assert.Equal(t, base.Transport.(*http.Transport).DisableKeepAlives, false)
+
+	_, err = HTTPClient(nil, ClientOptions{Proxy: "ftp://proxy.fetch.com"})
+	assert.NotEqual(t, err, nil)
+}
+
+func TestGetEndpointHealthClientOptions(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Host == "fetch.invalid":
+			// proxied requests carry the host of their target
+			w.WriteHeader(http.StatusOK)
+		case r.URL.Path == "/redirect":
+			http.Redirect(w, r, "/healthy", http.StatusFound)
+		case r.URL.Path == "/healthy":
+			w.WriteHeader(http.StatusOK)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	follow_redirects := false
+
+	cases := []struct {
+		name               string
+		endpoint           Endpoint
+		expectedStatus     string
+		expectedStatusCode int
+	}{
+		{
+			name:               "Redirect Followed",
+			endpoint:           Endpoint{Name: "redirect", Url: server.URL + "/redirect"},
+			expectedStatus:     StatusUp,
+			expectedStatusCode: http.StatusOK,
+		},
+		{
+			name:               "Redirect Not Followed",
+			endpoint:           Endpoint{Name: "redirect", Url: server.URL + "/redirect", FollowRedirects: &follow_redirects},
+			expectedStatus:     StatusDown,
+			expectedStatusCode: http.StatusFound,
+		},
+		{
+			name:               "Proxy",
+			endpoint:           Endpoint{Name: "proxied", Url: "http://fetch.invalid/", Proxy: server.URL},
+			expectedStatus:     StatusUp,
+			expectedStatusCode: http.StatusOK,
+		},
+		{
+			name:               "Keep Alives Disabled",
+			endpoint:           Endpoint{Name: "healthy", Url: server.URL + "/healthy", DisableKeepAlives: true},
+			expectedStatus:     StatusUp,
+			expectedStatusCode: http.StatusOK,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			result := tc.endpoint.GetEndpointHealth(5 * time.Second)
+			assert.Equal(t, result.Status, tc.expectedStatus)
+			assert.Equal(t, result.StatusCode, tc.expectedStatusCode)
+		})
+	}
+}
+
+func TestFamilyClientOptions(t *testing.T) {
+	client := familyClient("fetch.com", net.ParseIP("127.0.0.1"), ClientOptions{DisableRedirects: true, DisableKeepAlives: true})
+	assert.NotEqual(t, client.CheckRedirect, nil)
+	assert.Equal(t, client.Transport.(*http.Transport).DisableKeepAlives, true)
+	assert.Equal(t, client.Transport.(*http.Transport).Proxy == nil, true)
+}
+
+func TestValidateClientOptions(t *testing.T) {
+	cases := []struct {
+		name         string
+		endpoint     Endpoint
+		expectedFail bool
+	}{
+		{name: "No Options", endpoint: Endpoint{}},
+		{name: "Connection Limits", endpoint: Endpoint{MaxIdleConns: 4, MaxConns: 8}},
+		{name: "HTTP Proxy", endpoint: Endpoint{Proxy: "http://proxy.fetch.com:3128"}},
+		{name: "SOCKS Proxy", endpoint: Endpoint{Proxy: "socks5://127.0.0.1:1080"}},
+		{name: "Direct", endpoint: Endpoint{Proxy: ProxyDirect, DualStack: true}},
+		{name: "Negative Limit", endpoint: Endpoint{MaxConns: -1}, expectedFail: true},
+		{name: "Proxy Without Scheme", endpoint: Endpoint{Proxy: "proxy.fetch.com:3128"}, expectedFail: true},
+		{name: "Proxy With Dual Stack", endpoint: Endpoint{Proxy: "http://proxy.fetch.com:3128", DualStack: true}, expectedFail: true},
+		{name: "Proxy With Proxy Protocol", endpoint: Endpoint{Proxy: "http://proxy.fetch.com:3128", ProxyProtocol: ProxyProtocolV1}, expectedFail: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.endpoint.validateClientOptions()
+			if tc.expectedFail {
+				assert.NotEqual(t, err, nil)
+			} else {
+				assert.Equal(t, err, nil)
+			}
+		})
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// Integrations (the metrics server, the Parquet and SQLite histories, sinks and notifiers) that
+// fail to initialize, e.g. because of a bad webhook URL or an unreachable database, don't prevent
+// the endpoints from being checked: the failure is logged as a warning and the integration is
+// initialized again periodically until it succeeds. With strict_integrations, any failure refuses
+// to start instead. Unknown sink and notifier types are always refused, as no retry fixes them.
+
+// IntegrationRetryInterval is the minimum time between two attempts to initialize an integration
+// that failed to.
+const IntegrationRetryInterval time.Duration = time.Minute
+
+// OpenIntegrations is a method for HealthCheckTargets that starts the metrics server, the Parquet
+// exporter, the SQLite history, the sinks and the notifiers of its settings. Under
+// StrictIntegrations, any failure closes the sinks and notifiers opened so far and returns an
+// error. Otherwise, only unknown sink and notifier types are errors, and the other integrations
+// are retried in the background.
+func (target *HealthCheckTargets) OpenIntegrations() error {
+	config := target.Settings
+	strict := config.StrictIntegrations
+
+	if config.Listen != "" {
+		target.Metrics = NewMetrics()
+		if _, err := target.Serve(config.Listen); err != nil {
+			if strict {
+				return err
+			}
+			log.Printf("WARNING: %v, retrying every %s", err, IntegrationRetryInterval)
+			go target.retryServe(config.Listen)
+		}
+	}
+
+	if config.ParquetDir != "" {
+		exporter, err := NewParquetExporter(config.ParquetDir)
+		if err != nil {
+			if strict {
+				return err
+			}
+			// the partitions are created on every write, so the directory is retried by flush
+			log.Printf("WARNING: %v, retrying on every export", err)
+			exporter = &ParquetExporter{dir: config.ParquetDir}
+		}
+		target.History = exporter
+	}
+
+	if config.SQLiteFile != "" {
+		history, err := NewSQLiteHistory(config.SQLiteFile)
+		if err != nil {
+			if strict {
+				return err
+			}
+			// the database is opened again by Observe until it succeeds
+			log.Printf("WARNING: %v, retrying on every cycle", err)
+			history = &SQLiteHistory{path: config.SQLiteFile}
+		}
+		target.SQLite = history
+	}
+
+	if err := target.OpenSinks(config.Sinks); err != nil {
+		return err
+	}
+
+	if err := target.OpenNotifiers(config.Notifiers); err != nil {
+		target.CloseSinks()
+		return err
+	}
+	return nil
+}
+
+// retryServe starts the metrics server on listen, trying again every IntegrationRetryInterval
+// until it succeeds.
+func (target *HealthCheckTargets) retryServe(listen string) {
+	for {
+		time.Sleep(IntegrationRetryInterval)
+		if _, err := target.Serve(listen); err == nil {
+			return
+		}
+	}
+}
+
+// retryInit initializes an integration with init, at most every IntegrationRetryInterval, until
+// it succeeds. The error of the last attempt is returned while it doesn't.
+type retryInit struct {
+	mu         sync.Mutex
+	name       string
+	init       func() error
+	last_err   error
+	retried_at time.Time
+	done       bool
+	now        func() time.Time
+}
+
+// newRetryInit returns a retryInit of the named integration, whose first attempt failed with err.
+func newRetryInit(name string, err error, init func() error) *retryInit {
+	log.Printf("WARNING: %v, retrying every %s", err, IntegrationRetryInterval)
+	return &retryInit{name: name, init: init, last_err: err, retried_at: time.Now(), now: time.Now}
+}
+
+// ready is a method for retryInit that reports whether the integration is initialized, trying
+// again when the last attempt is older than IntegrationRetryInterval.
+func (retry *retryInit) ready() error {
+	retry.mu.Lock()
+	defer retry.mu.Unlock()
+
+	if retry.done {
+		return nil
+	}
+	if retry.now().Sub(retry.retried_at) >= IntegrationRetryInterval {
+		retry.retried_at = retry.now()
+		retry.last_err = retry.init()
+		if retry.last_err == nil {
+			retry.done = true
+			log.Printf("Initialized %s after retrying", retry.name)
+			return nil
+		}
+	}
+	return fmt.Errorf("%s isn't initialized: %v", retry.name, retry.last_err)
+}
+
+// deferredSink is a Sink whose initialization failed and is retried on writes. Events written
+// before it succeeds fail, so they are dropped and counted by the circuit breaker of the sink.
+type deferredSink struct {
+	retry *retryInit
+	sink  Sink
+}
+
+// newDeferredSink wraps the sink of config, whose factory failed with err, in a BatchSink retrying
+// the factory.
+func newDeferredSink(config SinkConfig, factory SinkFactory, err error) *BatchSink {
+	deferred := &deferredSink{}
+	deferred.retry = newRetryInit(config.Type+" sink", err, func() error {
+		sink, err := factory(config)
+		if err != nil {
+			return err
+		}
+		deferred.sink = sink
+		return nil
+	})
+	return NewBatchSink(config.Type, deferred, config)
+}
+
+// Write writes events to the sink once it is initialized.
+func (deferred *deferredSink) Write(events []Event) error {
+	if err := deferred.retry.ready(); err != nil {
+		return err
+	}
+	return deferred.sink.Write(events)
+}
+
+// Close closes the sink if it was initialized.
+func (deferred *deferredSink) Close() error {
+	if deferred.sink == nil {
+		return nil
+	}
+	return deferred.sink.Close()
+}
+
+// deferredNotifier is a Notifier whose initialization failed and is retried on calls. Calls made
+// before it succeeds fail, so they are retried by the OutageNotifier on the next cycle.
+type deferredNotifier struct {
+	retry    *retryInit
+	notifier Notifier
+}
+
+// newDeferredNotifier wraps the notifier of config, whose factory failed with err, in an
+// OutageNotifier retrying the factory.
+func newDeferredNotifier(config NotifierConfig, factory NotifierFactory, err error) *OutageNotifier {
+	deferred := &deferredNotifier{}
+	deferred.retry = newRetryInit(config.Type+" notifier", err, func() error {
+		notifier, err := factory(config)
+		if err != nil {
+			return err
+		}
+		deferred.notifier = notifier
+		return nil
+	})
+	return newOutageNotifier(config.Type, deferred, config)
+}
+
+// Open opens an issue once the notifier is initialized.
+func (deferred *deferredNotifier) Open(outage Outage) (string, error) {
+	if err := deferred.retry.ready(); err != nil {
+		return "", err
+	}
+	return deferred.notifier.Open(outage)
+}
+
+// Comment comments on an issue once the notifier is initialized.
+func (deferred *deferredNotifier) Comment(ref string, text string) error {
+	if err := deferred.retry.ready(); err != nil {
+		return err
+	}
+	return deferred.notifier.Comment(ref, text)
+}
+
+// Close resolves an issue once the notifier is initialized.
+func (deferred *deferredNotifier) Close(ref string) error {
+	if err := deferred.retry.ready(); err != nil {
+		return err
+	}
+	return deferred.notifier.Close(ref)
+}
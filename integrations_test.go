@@ -0,0 +1,120 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-playground/assert/v2"
+)
+
+func TestOpenIntegrations(t *testing.T) {
+	// an address already in use fails the metrics server
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Equal(t, err, nil)
+	defer listener.Close()
+
+	cases := []struct {
+		name         string
+		settings     Settings
+		sinks        int
+		notifier     string
+		expectedFail bool
+	}{
+		{name: "No Integrations", settings: Settings{}},
+		{name: "Bad Webhook Url", settings: Settings{Sinks: []SinkConfig{{Type: "webhook", Url: "not a url"}}}, sinks: 1},
+		{name: "Strict Bad Webhook Url", settings: Settings{Sinks: []SinkConfig{{Type: "webhook", Url: "not a url"}}, StrictIntegrations: true}, expectedFail: true},
+		{name: "Unknown Sink Type", settings: Settings{Sinks: []SinkConfig{{Type: "foo"}}}, expectedFail: true},
+		{name: "Bad Notifier", settings: Settings{Notifiers: []NotifierConfig{{Type: "github", TokenEnv: "CHECKHEALTH_TEST_UNSET"}}}, notifier: "github"},
+		{name: "Strict Bad Notifier", settings: Settings{Notifiers: []NotifierConfig{{Type: "github", TokenEnv: "CHECKHEALTH_TEST_UNSET"}}, StrictIntegrations: true}, notifier: "github", expectedFail: true},
+		{name: "Unknown Notifier Type", settings: Settings{Notifiers: []NotifierConfig{{Type: "foo"}}}, expectedFail: true},
+		{name: "Address In Use", settings: Settings{Listen: listener.Addr().String()}},
+		{name: "Strict Address In Use", settings: Settings{Listen: listener.Addr().String(), StrictIntegrations: true}, expectedFail: true},
+		{name: "Unwritable Parquet Dir", settings: Settings{ParquetDir: filepath.Join("/dev/null", "history")}},
+		{name: "Strict Unwritable Parquet Dir", settings: Settings{ParquetDir: filepath.Join("/dev/null", "history"), StrictIntegrations: true}, expectedFail: true},
+		{name: "Unwritable SQLite File", settings: Settings{SQLiteFile: filepath.Join("/dev/null", "history.db")}},
+		{name: "Strict Unwritable SQLite File", settings: Settings{SQLiteFile: filepath.Join("/dev/null", "history.db"), StrictIntegrations: true}, expectedFail: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			// every notifier type can be excluded with a build tag
+			if tc.notifier != "" && !featureEnabled(FeatureNotifier, tc.notifier) {
+				t.Skipf("the %s notifier isn't compiled into the binary", tc.notifier)
+			}
+			target := &HealthCheckTargets{Settings: tc.settings}
+			err := target.OpenIntegrations()
+			defer target.CloseNotifiers()
+			defer target.CloseSinks()
+			if tc.expectedFail {
+				assert.NotEqual(t, err, nil)
+				return
+			}
+			assert.Equal(t, err, nil)
+			assert.Equal(t, len(target.Sinks), tc.sinks)
+			assert.Equal(t, len(target.Notifiers), len(tc.settings.Notifiers))
+		})
+	}
+}
+
+func TestDeferredSink(t *testing.T) {
+	recording := &recordingSink{}
+	attempts := 0
+	factory := func(config SinkConfig) (Sink, error) {
+		attempts++
+		if attempts < 2 {
+			return nil, errors.New("database unreachable")
+		}
+		return recording, nil
+	}
+
+	batch_sink := newDeferredSink(SinkConfig{Type: "database"}, factory, errors.New("database unreachable"))
+	deferred := batch_sink.sink.(*deferredSink)
+	now := time.Now()
+	deferred.retry.now = func() time.Time { return now }
+
+	// the factory isn't retried before the retry interval
+	assert.NotEqual(t, deferred.Write(testEvents(1)), nil)
+	assert.Equal(t, attempts, 0)
+
+	// failed retries are retried after another interval
+	now = now.Add(IntegrationRetryInterval)
+	assert.NotEqual(t, deferred.Write(testEvents(1)), nil)
+	assert.Equal(t, attempts, 1)
+	assert.NotEqual(t, deferred.Write(testEvents(1)), nil)
+	assert.Equal(t, attempts, 1)
+
+	now = now.Add(IntegrationRetryInterval)
+	assert.Equal(t, deferred.Write(testEvents(2)), nil)
+	assert.Equal(t, deferred.Write(testEvents(1)), nil)
+	assert.Equal(t, attempts, 2)
+	assert.Equal(t, recording.batchSizes(), []int{2, 1})
+
+	assert.Equal(t, batch_sink.Close(), nil)
+	assert.Equal(t, recording.closed, true)
+}
+
+func TestDeferredNotifier(t *testing.T) {
+	recording := &recordingNotifier{}
+	factory := func(config NotifierConfig) (Notifier, error) {
+		return recording, nil
+	}
+
+	outage_notifier := newDeferredNotifier(NotifierConfig{Type: "tracker"}, factory, errors.New("tracker unreachable"))
+	defer outage_notifier.Close()
+	deferred := outage_notifier.notifier.(*deferredNotifier)
+	now := time.Now()
+	deferred.retry.now = func() time.Time { return now }
+
+	_, err := deferred.Open(Outage{Endpoint: "index"})
+	assert.NotEqual(t, err, nil)
+	assert.NotEqual(t, deferred.Comment("#", "still down"), nil)
+
+	now = now.Add(IntegrationRetryInterval)
+	ref, err := deferred.Open(Outage{Endpoint: "index"})
+	assert.Equal(t, err, nil)
+	assert.Equal(t, deferred.Close(ref), nil)
+	assert.Equal(t, recording.Calls(), []string{"open index #", "close #"})
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// JSONAssertion is a compiled expect_json assertion comparing a value of a JSON response body,
+// selected by a path, to a JSON value:
+//
+//	$.status == "ok"
+//	$.replicas >= 2
+//	$.checks[0]["db.primary"].healthy != false
+//
+// Paths start with $, the root of the document, followed by .name or ["name"] for the members of
+// objects and [index] for the elements of arrays, from 0. == and != compare any JSON value, and
+// <, <=, > and >= compare numbers. A path that isn't found in the body fails the assertion.
+type JSONAssertion struct {
+	expression string
+	path_text  string
+	path       []jsonPathSegment
+	operator   string
+	value      interface{}
+}
+
+// jsonPathSegment is a member name, or the index of an array element when is_index is set.
+type jsonPathSegment struct {
+	name     string
+	index    int
+	is_index bool
+}
+
+// CompileJSONAssertion parses an expect_json assertion into a JSONAssertion. An error describing
+// the problem is returned if the assertion is invalid.
+func CompileJSONAssertion(expression string) (*JSONAssertion, error) {
+	trimmed := strings.TrimSpace(expression)
+	path, rest, err := parseJSONPath(trimmed)
+	if err != nil {
+		return nil, err
+	}
+	path_text := trimmed[:len(trimmed)-len(rest)]
+
+	rest = strings.TrimSpace(rest)
+	operator := ""
+	for _, candidate := range []string{"==", "!=", "<=", ">=", "<", ">"} {
+		if strings.HasPrefix(rest, candidate) {
+			operator = candidate
+			break
+		}
+	}
+	if operator == "" {
+		return nil, fmt.Errorf("expected ==, !=, <, <=, > or >= after the path, found %q", rest)
+	}
+
+	var value interface{}
+	raw_value := strings.TrimSpace(rest[len(operator):])
+	if err := json.Unmarshal([]byte(raw_value), &value); err != nil {
+		return nil, fmt.Errorf("expected a JSON value after %s, such as \"ok\", 2 or true, found %q", operator, raw_value)
+	}
+	if _, is_number := value.(float64); !is_number && operator != "==" && operator != "!=" {
+		return nil, fmt.Errorf("operator %s can only compare numbers, found %s", operator, raw_value)
+	}
+
+	return &JSONAssertion{
+		expression: expression,
+		path_text:  path_text,
+		path:       path,
+		operator:   operator,
+		value:      value,
+	}, nil
+}
+
+// parseJSONPath parses the path at the start of expression, returning its segments and the rest
+// of the expression.
+func parseJSONPath(expression string) ([]jsonPathSegment, string, error) {
+	if !strings.HasPrefix(expression, "$") {
+		return nil, "", errors.New("the path must start with $")
+	}
+
+	var path []jsonPathSegment
+	i := 1
+	for i < len(expression) {
+		switch expression[i] {
+		case '.':
+			end := i + 1
+			for end < len(expression) && isJSONNameByte(expression[end]) {
+				end++
+			}
+			if end == i+1 {
+				return nil, "", fmt.Errorf("expected a member name at position %d", i+1)
+			}
+			path = append(path, jsonPathSegment{name: expression[i+1 : end]})
+			i = end
+		case '[':
+			end := strings.IndexByte(expression[i:], ']')
+			if end < 0 {
+				return nil, "", fmt.Errorf("unterminated [ at position %d", i)
+			}
+			selector := strings.TrimSpace(expression[i+1 : i+end])
+			if strings.HasPrefix(selector, "\"") {
+				name, err := strconv.Unquote(selector)
+				if err != nil {
+					return nil, "", fmt.Errorf("invalid member name %s at position %d", selector, i+1)
+				}
+				path = append(path, jsonPathSegment{name: name})
+			} else {
+				index, err := strconv.Atoi(selector)
+				if err != nil || index < 0 {
+					return nil, "", fmt.Errorf("expected an array index or a quoted member name at position %d, found %q", i+1, selector)
+				}
+				path = append(path, jsonPathSegment{index: index, is_index: true})
+			}
+			i += end + 1
+		default:
+			return path, expression[i:], nil
+		}
+	}
+	return path, expression[i:], nil
+}
+
+// isJSONNameByte reports whether b can be part of a member name following a dot.
+func isJSONNameByte(b byte) bool {
+	return b == '_' || b == '-' || (b >= '0' && b <= '9') || (b >= 'a' && b <= 'z') || (b >= 'A' && b <= 'Z')
+}
+
+// String returns the source expression of the assertion.
+func (assertion *JSONAssertion) String() string {
+	return assertion.expression
+}
+
+// Check returns an error describing why the decoded JSON document doesn't satisfy the assertion,
+// or nil if it does.
+func (assertion *JSONAssertion) Check(document interface{}) error {
+	value, found := document, true
+	for _, segment := range assertion.path {
+		if value, found = segment.lookup(value); !found {
+			return fmt.Errorf("response JSON doesn't satisfy %s: %s not found", assertion.expression, assertion.path_text)
+		}
+	}
+
+	satisfied := false
+	switch assertion.operator {
+	case "==":
+		satisfied = reflect.DeepEqual(value, assertion.value)
+	case "!=":
+		satisfied = !reflect.DeepEqual(value, assertion.value)
+	default:
+		number, is_number := value.(float64)
+		expected := assertion.value.(float64)
+		satisfied = is_number && compareFloats(number, assertion.operator, expected)
+	}
+	if !satisfied {
+		actual, _ := json.Marshal(value)
+		return fmt.Errorf("response JSON doesn't satisfy %s: %s is %s", assertion.expression, assertion.path_text, actual)
+	}
+	return nil
+}
+
+// lookup returns the member or element of value selected by the segment, and whether it exists.
+func (segment jsonPathSegment) lookup(value interface{}) (interface{}, bool) {
+	if segment.is_index {
+		elements, ok := value.([]interface{})
+		if !ok || segment.index >= len(elements) {
+			return nil, false
+		}
+		return elements[segment.index], true
+	}
+	members, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, false
+	}
+	member, found := members[segment.name]
+	return member, found
+}
+
+// compareFloats applies a numeric comparison operator.
+func compareFloats(value float64, operator string, expected float64) bool {
+	switch operator {
+	case "<":
+		return value < expected
+	case "<=":
+		return value <= expected
+	case ">":
+		return value > expected
+	default:
+		return value >= expected
+	}
+}
+
+// CheckJSON decodes body as JSON and returns an error describing the first assertion it doesn't
+// satisfy, or nil if it satisfies all of them. A body that isn't valid JSON fails the assertions.
+func CheckJSON(body []byte, assertions []*JSONAssertion) error {
+	var document interface{}
+	if err := json.Unmarshal(body, &document); err != nil {
+		return fmt.Errorf("response body isn't valid JSON: %v", err)
+	}
+	for _, assertion := range assertions {
+		if err := assertion.Check(document); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// jsonAssertions returns the endpoint's compiled expect_json assertions, compiling ExpectJSON when
+// the endpoint wasn't created by CreateNewTargets.
+func (endpoint *Endpoint) jsonAssertions() ([]*JSONAssertion, error) {
+	if endpoint.JSONAssertions != nil || len(endpoint.ExpectJSON) == 0 {
+		return endpoint.JSONAssertions, nil
+	}
+	return compileJSONAssertions(endpoint.ExpectJSON)
+}
+
+// compileJSONAssertions compiles every expect_json assertion, returning an error naming the first
+// invalid one.
+func compileJSONAssertions(expressions []string) ([]*JSONAssertion, error) {
+	assertions := make([]*JSONAssertion, 0, len(expressions))
+	for _, expression := range expressions {
+		assertion, err := CompileJSONAssertion(expression)
+		if err != nil {
+			return nil, fmt.Errorf("%q: %v", expression, err)
+		}
+		assertions = append(assertions, assertion)
+	}
+	return assertions, nil
+}
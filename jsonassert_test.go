@@ -0,0 +1,123 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-playground/assert/v2"
+)
+
+func TestCompileJSONAssertion(t *testing.T) {
+	cases := []struct {
+		name         string
+		expression   string
+		expectedFail bool
+	}{
+		{name: "String", expression: `$.status == "ok"`},
+		{name: "Number", expression: `$.replicas >= 2`},
+		{name: "Without Spaces", expression: `$.replicas>=2`},
+		{name: "Quoted Member And Index", expression: `$.checks[0]["db.primary"].healthy != false`},
+		{name: "Root", expression: `$ != null`},
+		{name: "Object", expression: `$.version == {"major": 2}`},
+		{name: "Missing Root", expression: `status == "ok"`, expectedFail: true},
+		{name: "Missing Operator", expression: `$.status`, expectedFail: true},
+		{name: "Unquoted String", expression: `$.status == ok`, expectedFail: true},
+		{name: "Ordered String", expression: `$.status > "ok"`, expectedFail: true},
+		{name: "Negative Index", expression: `$.checks[-1] == true`, expectedFail: true},
+		{name: "Unterminated Bracket", expression: `$.checks[0 == true`, expectedFail: true},
+		{name: "Empty Member", expression: `$. == true`, expectedFail: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := CompileJSONAssertion(tc.expression)
+			if tc.expectedFail {
+				assert.NotEqual(t, err, nil)
+			} else {
+				assert.Equal(t, err, nil)
+			}
+		})
+	}
+}
+
+func TestCheckJSON(t *testing.T) {
+	body := []byte(`{"status": "ok", "replicas": 3, "version": {"major": 2}, "checks": [{"db.primary": {"healthy": true}}], "error": null}`)
+
+	cases := []struct {
+		name          string
+		expression    string
+		body          []byte
+		expectedError string
+	}{
+		{name: "String Equal", expression: `$.status == "ok"`},
+		{name: "String Not Equal", expression: `$.status == "degraded"`, expectedError: `$.status is "ok"`},
+		{name: "Number Above", expression: `$.replicas >= 2`},
+		{name: "Number Below", expression: `$.replicas > 3`, expectedError: `$.replicas is 3`},
+		{name: "Number Equal", expression: `$.replicas == 3.0`},
+		{name: "Nested Member", expression: `$.checks[0]["db.primary"].healthy == true`},
+		{name: "Object", expression: `$.version == {"major": 2}`},
+		{name: "Null", expression: `$.error == null`},
+		{name: "Missing Member", expression: `$.uptime >= 1`, expectedError: "$.uptime not found"},
+		{name: "Index Out Of Range", expression: `$.checks[1] != null`, expectedError: "$.checks[1] not found"},
+		{name: "Not A Number", expression: `$.status >= 1`, expectedError: `$.status is "ok"`},
+		{name: "Invalid JSON", expression: `$.status == "ok"`, body: []byte("<html>ok</html>"), expectedError: "isn't valid JSON"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assertion, err := CompileJSONAssertion(tc.expression)
+			assert.Equal(t, err, nil)
+			if tc.body == nil {
+				tc.body = body
+			}
+			err = CheckJSON(tc.body, []*JSONAssertion{assertion})
+			if tc.expectedError == "" {
+				assert.Equal(t, err, nil)
+				return
+			}
+			assert.NotEqual(t, err, nil)
+			assert.Equal(t, strings.Contains(err.Error(), tc.expectedError), true)
+		})
+	}
+}
+
+func TestGetEndpointHealthExpectJSON(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"status": "degraded", "replicas": 1}`))
+	}))
+	defer server.Close()
+
+	cases := []struct {
+		name              string
+		expectJSON        []string
+		expectedStatus    string
+		expectedErrorKind string
+	}{
+		{name: "Satisfied", expectJSON: []string{`$.status != "down"`, `$.replicas >= 1`}, expectedStatus: StatusUp},
+		{name: "Status In Payload", expectJSON: []string{`$.status == "ok"`}, expectedStatus: StatusDown, expectedErrorKind: ErrorKindBody},
+		{name: "Too Few Replicas", expectJSON: []string{`$.replicas >= 2`}, expectedStatus: StatusDown, expectedErrorKind: ErrorKindBody},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			endpoints := Endpoints{{Name: "orders api", Url: server.URL, ExpectJSON: tc.expectJSON, PreferHead: true}}
+			targets, err := endpoints.CreateNewTargets()
+			assert.Equal(t, err, nil)
+
+			// the body is read, so HEAD isn't used
+			result := (*targets.Endpoints)[0].GetEndpointHealth(2 * time.Second)
+			assert.Equal(t, result.Method, http.MethodGet)
+			assert.Equal(t, result.Status, tc.expectedStatus)
+			assert.Equal(t, result.ErrorKind, tc.expectedErrorKind)
+		})
+	}
+
+	// invalid assertions are rejected when the targets are created
+	endpoints := Endpoints{{Name: "orders api", Url: server.URL, ExpectJSON: []string{`$.status = "ok"`}}}
+	_, err := endpoints.CreateNewTargets()
+	assert.NotEqual(t, err, nil)
+}
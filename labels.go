@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// The labels of an endpoint are free-form key-value pairs, such as its team, environment or tier,
+// carried through to the check_result, state_change and endpoint_failures events, the endpoint
+// metrics, the outage issues and the status API, so downstream systems can route and filter on
+// them. Label names are Prometheus label names, so they can be exported as-is.
+
+// labelNamePattern matches the valid label names of an endpoint.
+const labelNamePattern string = `^[a-zA-Z_][a-zA-Z0-9_]*$`
+
+var labelName = regexp.MustCompile(labelNamePattern)
+
+// reservedLabels are the names of the labels of the endpoint metrics, which endpoint labels can't
+// override.
+var reservedLabels = []string{"endpoint", "url", "state", "kind", "le", "phase", "component"}
+
+// validateLabels rejects label names that aren't valid Prometheus label names, that start with
+// the reserved "__" prefix, or that are already used by the endpoint metrics.
+func (endpoint *Endpoint) validateLabels() error {
+	for _, name := range sortedLabelNames(endpoint.Labels) {
+		switch {
+		case !labelName.MatchString(name):
+			return fmt.Errorf("invalid label name %q, expected letters, digits and underscores", name)
+		case strings.HasPrefix(name, "__"):
+			return fmt.Errorf("label name %q is reserved, names can't start with __", name)
+		case containsString(reservedLabels, name):
+			return fmt.Errorf("label name %q is reserved, names can't be %s", name, strings.Join(reservedLabels, ", "))
+		}
+	}
+	return nil
+}
+
+// sortedLabelNames returns the names of the labels in alphabetical order.
+func sortedLabelNames(labels map[string]string) []string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// endpointLabels returns the endpoint and url label pairs of the metrics of an endpoint, followed
+// by its labels in alphabetical order and by the extra label pairs.
+func endpointLabels(name string, url string, labels map[string]string, extra ...string) []string {
+	pairs := []string{"endpoint", name, "url", url}
+	for _, label := range sortedLabelNames(labels) {
+		pairs = append(pairs, label, labels[label])
+	}
+	return append(pairs, extra...)
+}
+
+// formatLabels formats the labels in alphabetical order, e.g. "env=prod, team=payments".
+func formatLabels(labels map[string]string) string {
+	pairs := make([]string, 0, len(labels))
+	for _, name := range sortedLabelNames(labels) {
+		pairs = append(pairs, name+"="+labels[name])
+	}
+	return strings.Join(pairs, ", ")
+}
+
+// parseLabelSelector parses the label=value selectors of the endpoints API, e.g. "team=payments".
+func parseLabelSelector(selectors []string) (map[string]string, error) {
+	selector := map[string]string{}
+	for _, pair := range selectors {
+		i := strings.IndexByte(pair, '=')
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid label selector %q, expected name=value", pair)
+		}
+		selector[pair[:i]] = pair[i+1:]
+	}
+	return selector, nil
+}
+
+// matchLabels reports whether the labels have every label of the selector with the same value.
+func matchLabels(labels map[string]string, selector map[string]string) bool {
+	for name, value := range selector {
+		if actual, ok := labels[name]; !ok || actual != value {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-playground/assert/v2"
+)
+
+func TestValidateLabels(t *testing.T) {
+	cases := []struct {
+		name         string
+		labels       map[string]string
+		expectedFail bool
+	}{
+		{name: "Without Labels"},
+		{name: "Labels", labels: map[string]string{"team": "payments", "env": "prod", "tier_1": "", "_internal": "yes"}},
+		{name: "Dash", labels: map[string]string{"cost-center": "42"}, expectedFail: true},
+		{name: "Leading Digit", labels: map[string]string{"1tier": "gold"}, expectedFail: true},
+		{name: "Empty Name", labels: map[string]string{"": "prod"}, expectedFail: true},
+		{name: "Reserved Prefix", labels: map[string]string{"__name__": "up"}, expectedFail: true},
+		{name: "Metric Label", labels: map[string]string{"url": "https://example.com/"}, expectedFail: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			endpoint := Endpoint{Name: "index", Url: "https://example.com/", Labels: tc.labels}
+			assert.Equal(t, endpoint.validateLabels() != nil, tc.expectedFail)
+		})
+	}
+}
+
+func TestEndpointLabels(t *testing.T) {
+	labels := map[string]string{"team": "payments", "env": "prod"}
+	endpoints := Endpoints{
+		{Name: "checkout", Url: "https://example.com/checkout", DownAfter: 1, Labels: labels},
+		{Name: "index", Url: "https://example.com/"},
+	}
+	targets, err := endpoints.CreateNewTargets()
+	assert.Equal(t, err, nil)
+
+	at := time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+	results := []CheckResult{
+		{Endpoint: "checkout", Url: "https://example.com/checkout", Status: StatusDown, ErrorKind: ErrorKindTimeout, StartedAt: at, FinishedAt: at},
+		{Endpoint: "index", Url: "https://example.com/", Status: StatusUp, StartedAt: at, FinishedAt: at},
+	}
+	transitions := targets.RecordResults(results)
+
+	// events of labelled endpoints carry their labels
+	var output bytes.Buffer
+	assert.Equal(t, WriteEvents(&output, targets.StateEvents(transitions)[:1]), nil)
+	assert.Equal(t, WriteEvents(&output, targets.CheckEvents(results, targets.Endpoints, at)), nil)
+	assert.Equal(t, WriteEvents(&output, targets.FailureEvents(at)), nil)
+	assert.Equal(t, output.String(), `{"schema_version":"1.18","type":"state_change","timestamp":"2023-06-01T12:00:00Z",`+
+		`"state":{"endpoint":"checkout","url":"https://example.com/checkout","from":"UNKNOWN","to":"DOWN","changed_at":"2023-06-01T12:00:00Z","previous_duration_ms":0,"labels":{"env":"prod","team":"payments"}}}`+"\n"+
+		`{"schema_version":"1.18","type":"check_result","timestamp":"2023-06-01T12:00:00Z",`+
+		`"check":{"endpoint":"checkout","url":"https://example.com/checkout","domain":"example.com","status":"down","latency_ms":0,"started_at":"2023-06-01T12:00:00Z","error_kind":"timeout","labels":{"env":"prod","team":"payments"}}}`+"\n"+
+		`{"schema_version":"1.18","type":"check_result","timestamp":"2023-06-01T12:00:00Z",`+
+		`"check":{"endpoint":"index","url":"https://example.com/","domain":"example.com","status":"up","latency_ms":0,"started_at":"2023-06-01T12:00:00Z"}}`+"\n"+
+		`{"schema_version":"1.18","type":"endpoint_failures","timestamp":"2023-06-01T12:00:00Z",`+
+		`"failures":{"endpoint":"checkout","url":"https://example.com/checkout","reasons":{"timeout":1},"labels":{"env":"prod","team":"payments"}}}`+"\n")
+
+	// the endpoints API serves the labels, and selects the endpoints having all the labels
+	cases := []struct {
+		name              string
+		query             string
+		expectedCode      int
+		expectedEndpoints []string
+	}{
+		{name: "Every Endpoint", expectedCode: http.StatusOK, expectedEndpoints: []string{"checkout", "index"}},
+		{name: "Label", query: "?label=team=payments", expectedCode: http.StatusOK, expectedEndpoints: []string{"checkout"}},
+		{name: "Labels", query: "?label=team=payments&label=env=prod", expectedCode: http.StatusOK, expectedEndpoints: []string{"checkout"}},
+		{name: "Other Value", query: "?label=team=payments&label=env=staging", expectedCode: http.StatusOK, expectedEndpoints: []string{}},
+		{name: "Empty Value", query: "?label=team=", expectedCode: http.StatusOK, expectedEndpoints: []string{}},
+		{name: "Invalid Selector", query: "?label=team", expectedCode: http.StatusBadRequest},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			targets.APIHandler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/v1/endpoints"+tc.query, nil))
+			assert.Equal(t, recorder.Code, tc.expectedCode)
+			if tc.expectedCode != http.StatusOK {
+				return
+			}
+
+			var statuses []EndpointStatus
+			assert.Equal(t, json.Unmarshal(recorder.Body.Bytes(), &statuses), nil)
+			names := []string{}
+			for _, status := range statuses {
+				names = append(names, status.Endpoint)
+				if status.Endpoint == "checkout" {
+					assert.Equal(t, status.Labels, labels)
+				}
+			}
+			assert.Equal(t, names, tc.expectedEndpoints)
+		})
+	}
+}
+
+func TestApplySettingsRejectsInvalidLabels(t *testing.T) {
+	config := Config{Endpoints: Endpoints{{Name: "index", Url: "https://example.com/", Labels: map[string]string{"le": "0.5"}}}}
+	assert.NotEqual(t, config.ApplySettings(), nil)
+}
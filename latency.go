@@ -0,0 +1,280 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultAutoLatencyWarmup is the number of successful checks an endpoint in auto_latency mode
+// learns its baseline latency from before its latency is judged.
+const DefaultAutoLatencyWarmup int = 20
+
+// AutoLatencyDegradedFactor and AutoLatencyDownFactor are the multiples of the baseline latency
+// above which a successful check of an endpoint in auto_latency mode is degraded or down.
+const (
+	AutoLatencyDegradedFactor float64 = 3
+	AutoLatencyDownFactor     float64 = 10
+)
+
+// LatencySamples is the number of recent check latencies kept per domain to compute its latency
+// percentiles.
+const LatencySamples int = 1000
+
+// MaxLatencyWindowSamples bounds the number of timestamped latencies kept per domain for its
+// latency_windows, dropping the oldest beyond it.
+const MaxLatencyWindowSamples int = 100000
+
+// ErrorKindLatency classifies checks whose response was slower than the endpoint's learned
+// latency thresholds.
+const ErrorKindLatency string = "latency"
+
+// LatencyBaseline learns the usual latency of an endpoint from its first successful checks, and
+// judges later checks against thresholds relative to it. It is safe for concurrent use.
+type LatencyBaseline struct {
+	mu       sync.Mutex
+	warmup   int
+	samples  []time.Duration
+	baseline time.Duration
+}
+
+// NewLatencyBaseline creates a LatencyBaseline learning from warmup successful checks. Zero or
+// negative values select DefaultAutoLatencyWarmup.
+func NewLatencyBaseline(warmup int) *LatencyBaseline {
+	if warmup <= 0 {
+		warmup = DefaultAutoLatencyWarmup
+	}
+	return &LatencyBaseline{warmup: warmup}
+}
+
+// Baseline returns the learned baseline latency, the median latency of the warm-up checks. It
+// reports false while the baseline is still being learned.
+func (baseline *LatencyBaseline) Baseline() (time.Duration, bool) {
+	baseline.mu.Lock()
+	defer baseline.mu.Unlock()
+
+	return baseline.baseline, baseline.baseline > 0
+}
+
+// Judge is a method for LatencyBaseline that applies the latency thresholds to a successful
+// result. During the warm-up, the latency is learned and the result is left unchanged. Afterwards,
+// results slower than AutoLatencyDownFactor times the baseline are marked down, and results slower
+// than AutoLatencyDegradedFactor times the baseline degraded. Other results are left unchanged.
+//
+// Returns immediately if the baseline pointer passed is nil.
+func (baseline *LatencyBaseline) Judge(result *CheckResult) {
+	if baseline == nil || result.Status != StatusUp || result.Latency <= 0 {
+		return
+	}
+
+	baseline.mu.Lock()
+	defer baseline.mu.Unlock()
+
+	if baseline.baseline == 0 {
+		baseline.samples = append(baseline.samples, result.Latency)
+		if len(baseline.samples) >= baseline.warmup {
+			sort.Slice(baseline.samples, func(i, j int) bool { return baseline.samples[i] < baseline.samples[j] })
+			baseline.baseline = baseline.samples[len(baseline.samples)/2]
+			baseline.samples = nil
+		}
+		return
+	}
+
+	down := time.Duration(float64(baseline.baseline) * AutoLatencyDownFactor)
+	degraded := time.Duration(float64(baseline.baseline) * AutoLatencyDegradedFactor)
+	switch {
+	case result.Latency > down:
+		result.fail(StatusDown, ErrorKindLatency, fmt.Errorf("latency %s is above %s, %gx the baseline of %s", result.Latency, down, AutoLatencyDownFactor, baseline.baseline))
+	case result.Latency > degraded:
+		result.fail(StatusDegraded, ErrorKindLatency, fmt.Errorf("latency %s is above %s, %gx the baseline of %s", result.Latency, degraded, AutoLatencyDegradedFactor, baseline.baseline))
+	}
+}
+
+// LatencyStats keeps the latencies of the last LatencySamples checks of a domain in a ring buffer,
+// so its latency percentiles reflect recent checks with bounded memory. The latencies of the
+// checks within the longest latency window are also kept with their time, see
+// RecordWindowLatency. It is guarded by domain_stats.
+type LatencyStats struct {
+	samples []time.Duration
+	next    int
+	timed   []timedLatency
+}
+
+// timedLatency is the latency of a check finished at a given time.
+type timedLatency struct {
+	at      time.Time
+	latency time.Duration
+}
+
+// LatencySummary is the distribution of the latencies kept by a LatencyStats.
+type LatencySummary struct {
+	Count int
+	P50   time.Duration
+	P95   time.Duration
+	P99   time.Duration
+	Max   time.Duration
+}
+
+// RecordLatency is a method for a domain to record the latency of a check of one of its endpoints,
+// replacing the oldest latency once LatencySamples latencies are kept.
+//
+// Returns immediately if the domain pointer passed is nil.
+func (domain *Domain) RecordLatency(latency time.Duration) {
+	if domain == nil {
+		return
+	}
+
+	domain_stats.Lock()
+	defer domain_stats.Unlock()
+
+	if domain.Latency == nil {
+		domain.Latency = &LatencyStats{}
+	}
+	stats := domain.Latency
+	if len(stats.samples) < LatencySamples {
+		stats.samples = append(stats.samples, latency)
+		return
+	}
+	stats.samples[stats.next] = latency
+	stats.next = (stats.next + 1) % LatencySamples
+}
+
+// RecordWindowLatency is a method for a domain to record the latency of a check of one of its
+// endpoints finished at the provided time, for its latency windows. Latencies older than the
+// longest of the windows are dropped, and at most MaxLatencyWindowSamples latencies are kept.
+//
+// Returns immediately if the domain pointer passed is nil or no window is provided.
+func (domain *Domain) RecordWindowLatency(at time.Time, latency time.Duration, windows []time.Duration) {
+	if domain == nil || len(windows) == 0 {
+		return
+	}
+
+	domain_stats.Lock()
+	defer domain_stats.Unlock()
+
+	if domain.Latency == nil {
+		domain.Latency = &LatencyStats{}
+	}
+	stats := domain.Latency
+	stats.timed = append(stats.timed, timedLatency{at: at, latency: latency})
+
+	longest := windows[0]
+	for _, window := range windows {
+		if window > longest {
+			longest = window
+		}
+	}
+	drop := 0
+	if excess := len(stats.timed) - MaxLatencyWindowSamples; excess > 0 {
+		drop = excess
+	}
+	for drop < len(stats.timed) && at.Sub(stats.timed[drop].at) > longest {
+		drop++
+	}
+	if drop > 0 {
+		stats.timed = append(stats.timed[:0], stats.timed[drop:]...)
+	}
+}
+
+// LatencyWindowSummary is the distribution of the latencies of a domain's checks finished within
+// a window before now.
+type LatencyWindowSummary struct {
+	Window time.Duration
+	LatencySummary
+}
+
+// LatencyWindowSummaries is a method for a domain that returns the distribution of its latencies
+// within each of the windows, in order. Windows without any check are skipped.
+func (domain *Domain) LatencyWindowSummaries(now time.Time, windows []time.Duration) []LatencyWindowSummary {
+	domain_stats.Lock()
+	defer domain_stats.Unlock()
+
+	return domain.Latency.WindowSummaries(now, windows)
+}
+
+// WindowSummaries returns the percentiles and maximum of the latencies within each of the windows
+// before now, in order. Windows without any latency are skipped.
+func (stats *LatencyStats) WindowSummaries(now time.Time, windows []time.Duration) []LatencyWindowSummary {
+	if stats == nil {
+		return nil
+	}
+
+	var summaries []LatencyWindowSummary
+	for _, window := range windows {
+		var latencies []time.Duration
+		for _, sample := range stats.timed {
+			if now.Sub(sample.at) <= window {
+				latencies = append(latencies, sample.latency)
+			}
+		}
+		if len(latencies) > 0 {
+			summaries = append(summaries, LatencyWindowSummary{Window: window, LatencySummary: summarizeLatencies(latencies)})
+		}
+	}
+	return summaries
+}
+
+// LatencySummary is a method for a domain that returns the distribution of its recent latencies.
+func (domain *Domain) LatencySummary() LatencySummary {
+	domain_stats.Lock()
+	defer domain_stats.Unlock()
+
+	return domain.Latency.Summary()
+}
+
+// Summary returns the percentiles and maximum of the latencies kept, using the nearest-rank
+// method. The summary is zero if no latency was recorded.
+func (stats *LatencyStats) Summary() LatencySummary {
+	if stats == nil || len(stats.samples) == 0 {
+		return LatencySummary{}
+	}
+	return summarizeLatencies(append([]time.Duration(nil), stats.samples...))
+}
+
+// summarizeLatencies returns the percentiles and maximum of a non-empty list of latencies, which
+// it sorts in place.
+func summarizeLatencies(sorted []time.Duration) LatencySummary {
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	percentile := func(p int) time.Duration {
+		rank := (p*len(sorted) + 99) / 100
+		if rank < 1 {
+			rank = 1
+		}
+		return sorted[rank-1]
+	}
+	return LatencySummary{
+		Count: len(sorted),
+		P50:   percentile(50),
+		P95:   percentile(95),
+		P99:   percentile(99),
+		Max:   sorted[len(sorted)-1],
+	}
+}
+
+// String formats the summary for the console, e.g. "p50 120ms, p95 310ms, p99 480ms, max 502ms".
+func (summary LatencySummary) String() string {
+	return fmt.Sprintf("p50 %s, p95 %s, p99 %s, max %s", roundLatency(summary.P50), roundLatency(summary.P95), roundLatency(summary.P99), roundLatency(summary.Max))
+}
+
+// FormatLatencyWindow formats a latency window without its zero units, e.g. "5m" or "1h30m".
+func FormatLatencyWindow(window time.Duration) string {
+	formatted := window.String()
+	if strings.HasSuffix(formatted, "m0s") {
+		formatted = strings.TrimSuffix(formatted, "0s")
+	}
+	if strings.HasSuffix(formatted, "h0m") {
+		formatted = strings.TrimSuffix(formatted, "0m")
+	}
+	return formatted
+}
+
+// roundLatency rounds a latency to the millisecond, or to the microsecond below a millisecond.
+func roundLatency(latency time.Duration) time.Duration {
+	if latency < time.Millisecond {
+		return latency.Round(time.Microsecond)
+	}
+	return latency.Round(time.Millisecond)
+}
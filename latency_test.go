@@ -0,0 +1,189 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-playground/assert/v2"
+)
+
+func TestLatencyBaselineJudge(t *testing.T) {
+	cases := []struct {
+		name           string
+		warmup         []time.Duration
+		latency        time.Duration
+		status         string
+		expectedStatus string
+		expectedKind   string
+	}{
+		{
+			name:           "Learning During Warm-Up",
+			warmup:         []time.Duration{10 * time.Millisecond},
+			latency:        time.Second,
+			status:         StatusUp,
+			expectedStatus: StatusUp,
+		},
+		{
+			name:           "Within Baseline",
+			warmup:         []time.Duration{10 * time.Millisecond, 20 * time.Millisecond, 500 * time.Millisecond},
+			latency:        50 * time.Millisecond,
+			status:         StatusUp,
+			expectedStatus: StatusUp,
+		},
+		{
+			name:           "Degraded Above 3x",
+			warmup:         []time.Duration{10 * time.Millisecond, 20 * time.Millisecond, 500 * time.Millisecond},
+			latency:        100 * time.Millisecond,
+			status:         StatusUp,
+			expectedStatus: StatusDegraded,
+			expectedKind:   ErrorKindLatency,
+		},
+		{
+			name:           "Down Above 10x",
+			warmup:         []time.Duration{10 * time.Millisecond, 20 * time.Millisecond, 500 * time.Millisecond},
+			latency:        300 * time.Millisecond,
+			status:         StatusUp,
+			expectedStatus: StatusDown,
+			expectedKind:   ErrorKindLatency,
+		},
+		{
+			name:           "Failed Checks Left Unchanged",
+			warmup:         []time.Duration{10 * time.Millisecond, 20 * time.Millisecond, 500 * time.Millisecond},
+			latency:        300 * time.Millisecond,
+			status:         StatusDown,
+			expectedStatus: StatusDown,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			baseline := NewLatencyBaseline(3)
+			for _, latency := range tc.warmup {
+				result := CheckResult{Status: StatusUp, Latency: latency}
+				baseline.Judge(&result)
+				assert.Equal(t, result.Status, StatusUp)
+			}
+
+			result := CheckResult{Status: tc.status, Latency: tc.latency}
+			baseline.Judge(&result)
+			assert.Equal(t, result.Status, tc.expectedStatus)
+			assert.Equal(t, result.ErrorKind, tc.expectedKind)
+		})
+	}
+}
+
+func TestLatencyBaseline(t *testing.T) {
+	var nil_baseline *LatencyBaseline
+	result := CheckResult{Status: StatusUp, Latency: time.Second}
+	nil_baseline.Judge(&result)
+	assert.Equal(t, result.Status, StatusUp)
+
+	baseline := NewLatencyBaseline(0)
+	for i := 1; i < DefaultAutoLatencyWarmup; i++ {
+		baseline.Judge(&CheckResult{Status: StatusUp, Latency: time.Duration(i) * time.Millisecond})
+	}
+	_, ok := baseline.Baseline()
+	assert.Equal(t, ok, false)
+
+	baseline.Judge(&CheckResult{Status: StatusUp, Latency: 20 * time.Millisecond})
+	learned, ok := baseline.Baseline()
+	assert.Equal(t, ok, true)
+	assert.Equal(t, learned, 11*time.Millisecond)
+}
+
+func TestDomainLatencySummary(t *testing.T) {
+	domain := &Domain{Name: "example.com"}
+	assert.Equal(t, domain.LatencySummary(), LatencySummary{})
+
+	for i := 1; i <= 100; i++ {
+		domain.RecordLatency(time.Duration(i) * time.Millisecond)
+	}
+	assert.Equal(t, domain.LatencySummary(), LatencySummary{
+		Count: 100,
+		P50:   50 * time.Millisecond,
+		P95:   95 * time.Millisecond,
+		P99:   99 * time.Millisecond,
+		Max:   100 * time.Millisecond,
+	})
+
+	// once full, the oldest latencies are replaced
+	for i := 0; i < LatencySamples; i++ {
+		domain.RecordLatency(time.Millisecond)
+	}
+	domain.RecordLatency(2 * time.Second)
+	summary := domain.LatencySummary()
+	assert.Equal(t, summary.Count, LatencySamples)
+	assert.Equal(t, summary.P99, time.Millisecond)
+	assert.Equal(t, summary.Max, 2*time.Second)
+	assert.Equal(t, summary.String(), "p50 1ms, p95 1ms, p99 1ms, max 2s")
+}
+
+func TestRecordResultLatency(t *testing.T) {
+	domain := &Domain{Name: "example.com"}
+	domain.RecordResult(CheckResult{Status: StatusUp, Latency: 120 * time.Millisecond})
+	domain.RecordResult(CheckResult{Status: StatusDown, Latency: 500 * time.Millisecond})
+
+	// unknown checks and checks without a latency aren't recorded
+	domain.RecordResult(CheckResult{Status: StatusUnknown, Latency: time.Second})
+	domain.RecordResult(CheckResult{Status: StatusDown})
+
+	summary := domain.LatencySummary()
+	assert.Equal(t, summary.Count, 2)
+	assert.Equal(t, summary.P50, 120*time.Millisecond)
+	assert.Equal(t, summary.Max, 500*time.Millisecond)
+}
+
+func TestDomainLatencyWindowSummaries(t *testing.T) {
+	domain := &Domain{Name: "example.com"}
+	windows := []time.Duration{5 * time.Minute, time.Hour}
+	now := time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+	assert.Equal(t, len(domain.LatencyWindowSummaries(now, windows)), 0)
+
+	// a slow check 30 minutes ago only counts in the hour window
+	domain.RecordWindowLatency(now.Add(-2*time.Hour), 5*time.Second, windows)
+	domain.RecordWindowLatency(now.Add(-30*time.Minute), 2*time.Second, windows)
+	for i := 1; i <= 100; i++ {
+		domain.RecordWindowLatency(now.Add(-time.Minute), time.Duration(i)*time.Millisecond, windows)
+	}
+
+	summaries := domain.LatencyWindowSummaries(now, windows)
+	assert.Equal(t, len(summaries), 2)
+	assert.Equal(t, summaries[0].Window, 5*time.Minute)
+	assert.Equal(t, summaries[0].LatencySummary, LatencySummary{
+		Count: 100,
+		P50:   50 * time.Millisecond,
+		P95:   95 * time.Millisecond,
+		P99:   99 * time.Millisecond,
+		Max:   100 * time.Millisecond,
+	})
+	assert.Equal(t, summaries[1].Count, 101)
+	assert.Equal(t, summaries[1].Max, 2*time.Second)
+
+	// latencies older than the longest window are dropped
+	assert.Equal(t, len(domain.Latency.timed), 101)
+
+	// without windows, nothing is kept
+	other := &Domain{Name: "fetch.com"}
+	other.RecordWindowLatency(now, time.Second, nil)
+	assert.Equal(t, other.Latency, (*LatencyStats)(nil))
+}
+
+func TestFormatLatencyWindow(t *testing.T) {
+	cases := []struct {
+		window   time.Duration
+		expected string
+	}{
+		{window: 30 * time.Second, expected: "30s"},
+		{window: 5 * time.Minute, expected: "5m"},
+		{window: 90 * time.Second, expected: "1m30s"},
+		{window: time.Hour, expected: "1h"},
+		{window: 24 * time.Hour, expected: "24h"},
+		{window: 90 * time.Minute, expected: "1h30m"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.expected, func(t *testing.T) {
+			assert.Equal(t, FormatLatencyWindow(tc.window), tc.expected)
+		})
+	}
+}
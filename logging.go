@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// The diagnostics of the program, such as warnings, failures and the per-check debug logs, are
+// written to stderr with a level, as text or as JSON lines with log_format, and those below
+// log_level are dropped. The console output of the checks (-output) is still printed to stdout.
+// Messages logged with the log package are leveled by their prefix, see messageLevel.
+
+// Log levels, from the most to the least verbose
+const (
+	LogLevelDebug string = "debug"
+	LogLevelInfo  string = "info"
+	LogLevelWarn  string = "warn"
+	LogLevelError string = "error"
+)
+
+// Log formats
+const (
+	LogFormatText string = "text"
+	LogFormatJSON string = "json"
+)
+
+// DefaultLogLevel is the log level of the program when log_level isn't set.
+const DefaultLogLevel string = LogLevelInfo
+
+// logLevels are the log levels, from the most to the least verbose.
+var logLevels = []string{LogLevelDebug, LogLevelInfo, LogLevelWarn, LogLevelError}
+
+// ValidateLogging returns an error if the log level or format isn't supported. Empty values select
+// the defaults.
+func ValidateLogging(level string, format string) error {
+	if level != "" && logLevelRank(level) < 0 {
+		return fmt.Errorf("unsupported log level %q, expected %q, %q, %q or %q", level, LogLevelDebug, LogLevelInfo, LogLevelWarn, LogLevelError)
+	}
+	switch format {
+	case "", LogFormatText, LogFormatJSON:
+	default:
+		return fmt.Errorf("unsupported log format %q, expected %q or %q", format, LogFormatText, LogFormatJSON)
+	}
+	return nil
+}
+
+// logLevelRank returns the index of level in logLevels, -1 when it isn't a log level.
+func logLevelRank(level string) int {
+	for i, candidate := range logLevels {
+		if candidate == level {
+			return i
+		}
+	}
+	return -1
+}
+
+// messageLevel returns the level of a message logged with the log package and the message without
+// its level prefix: "ERROR: " and messages reporting a failure ("Failed to ...") are errors,
+// "WARNING: " warnings, "DEBUG: " debug messages and the others informational.
+func messageLevel(message string) (string, string) {
+	switch {
+	case strings.HasPrefix(message, "ERROR: "):
+		return LogLevelError, strings.TrimPrefix(message, "ERROR: ")
+	case strings.HasPrefix(message, "WARNING: "):
+		return LogLevelWarn, strings.TrimPrefix(message, "WARNING: ")
+	case strings.HasPrefix(message, "DEBUG: "):
+		return LogLevelDebug, strings.TrimPrefix(message, "DEBUG: ")
+	case strings.HasPrefix(message, "Failed to "):
+		return LogLevelError, message
+	}
+	return LogLevelInfo, message
+}
+
+// LogChecks is a method for HealthCheckTargets that logs the request and response details of the
+// results of a cycle at the debug level, one message per check, when debug messages are enabled.
+func (target *HealthCheckTargets) LogChecks(results []CheckResult) {
+	if !debugEnabled() {
+		return
+	}
+	for _, result := range results {
+		logDebug("check finished", checkAttributes(result)...)
+	}
+}
+
+// checkAttributes returns the details of a check as alternating keys and values, omitting the
+// empty ones.
+func checkAttributes(result CheckResult) []interface{} {
+	attributes := []interface{}{"endpoint", result.Endpoint, "url", result.Url}
+	if result.Method != "" {
+		attributes = append(attributes, "method", result.Method)
+	}
+	attributes = append(attributes, "status", result.Status)
+	if result.StatusCode != 0 {
+		attributes = append(attributes, "status_code", result.StatusCode)
+	}
+	attributes = append(attributes, "latency_ms", latencyMilliseconds(result.Latency))
+	if result.Timing != nil {
+		for _, phase := range result.Timing.phases() {
+			if phase.duration != 0 {
+				attributes = append(attributes, phase.name+"_ms", latencyMilliseconds(phase.duration))
+			}
+		}
+		if result.Timing.Reused {
+			attributes = append(attributes, "reused_conn", true)
+		}
+	}
+	if result.RemoteIP != "" {
+		attributes = append(attributes, "remote_ip", result.RemoteIP)
+	}
+	if result.BytesSent != 0 || result.BytesReceived != 0 {
+		attributes = append(attributes, "bytes_sent", result.BytesSent, "bytes_received", result.BytesReceived)
+	}
+	if result.Retries != 0 {
+		attributes = append(attributes, "retries", result.Retries)
+	}
+	if len(result.Redirects) != 0 {
+		attributes = append(attributes, "redirects", len(result.Redirects))
+	}
+	if result.RedirectTarget != "" {
+		attributes = append(attributes, "redirect_target", result.RedirectTarget)
+	}
+	if result.ErrorKind != "" {
+		attributes = append(attributes, "error_kind", result.ErrorKind)
+	}
+	if result.Error != "" {
+		attributes = append(attributes, "error", result.Error)
+	}
+	return attributes
+}
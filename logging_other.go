@@ -0,0 +1,75 @@
+//go:build !go1.21
+// +build !go1.21
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// log_threshold is the rank of the least verbose log level written, see logLevelRank.
+var log_threshold = logLevelRank(DefaultLogLevel)
+
+// ConfigureLogging routes the messages of the log package to w, dropping the messages below level,
+// leveled by their prefix, see messageLevel. The json format needs log/slog, from Go 1.21.
+func ConfigureLogging(w io.Writer, level string, format string) error {
+	if err := ValidateLogging(level, format); err != nil {
+		return err
+	}
+	if format == LogFormatJSON {
+		return errors.New("the json log format needs checkhealth built with Go 1.21 or later")
+	}
+	if level == "" {
+		level = DefaultLogLevel
+	}
+
+	log_threshold = logLevelRank(level)
+	log.SetFlags(0)
+	log.SetOutput(&levelWriter{w: w})
+	return nil
+}
+
+// levelWriter writes the messages of the log package at or above log_threshold to w, one per
+// Write, with a timestamp.
+type levelWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (writer *levelWriter) Write(p []byte) (int, error) {
+	level, _ := messageLevel(string(p))
+	if logLevelRank(level) < log_threshold {
+		return len(p), nil
+	}
+	writer.mu.Lock()
+	defer writer.mu.Unlock()
+	_, err := io.WriteString(writer.w, time.Now().Format("2006/01/02 15:04:05 ")+string(p))
+	return len(p), err
+}
+
+// debugEnabled returns whether debug messages are logged.
+func debugEnabled() bool {
+	return log_threshold == logLevelRank(LogLevelDebug)
+}
+
+// logDebug logs a debug message with attributes, as alternating keys and values written as
+// key=value.
+func logDebug(message string, attributes ...interface{}) {
+	var line strings.Builder
+	line.WriteString("DEBUG: " + message)
+	for i := 0; i+1 < len(attributes); i += 2 {
+		value := fmt.Sprint(attributes[i+1])
+		if strings.ContainsAny(value, " =\"") {
+			value = strconv.Quote(value)
+		}
+		fmt.Fprintf(&line, " %v=%s", attributes[i], value)
+	}
+	log.Print(line.String())
+}
@@ -0,0 +1,68 @@
+//go:build go1.21
+// +build go1.21
+
+package main
+
+import (
+	"context"
+	"io"
+	"log"
+	"log/slog"
+	"strings"
+)
+
+// ConfigureLogging makes a slog logger writing to w in format, dropping the messages below level,
+// the default logger, and routes the messages of the log package through it, leveled by their
+// prefix, see messageLevel.
+func ConfigureLogging(w io.Writer, level string, format string) error {
+	if err := ValidateLogging(level, format); err != nil {
+		return err
+	}
+	options := &slog.HandlerOptions{Level: slogLevel(level)}
+	var handler slog.Handler
+	if format == LogFormatJSON {
+		handler = slog.NewJSONHandler(w, options)
+	} else {
+		handler = slog.NewTextHandler(w, options)
+	}
+
+	logger := slog.New(handler)
+	slog.SetDefault(logger)
+	log.SetFlags(0)
+	log.SetOutput(slogWriter{logger})
+	return nil
+}
+
+// slogWriter logs the messages of the log package, one per Write, with a slog logger.
+type slogWriter struct {
+	logger *slog.Logger
+}
+
+func (writer slogWriter) Write(p []byte) (int, error) {
+	level, message := messageLevel(strings.TrimRight(string(p), "\n"))
+	writer.logger.Log(context.Background(), slogLevel(level), message)
+	return len(p), nil
+}
+
+// slogLevel returns the slog level of a log level, info when it is empty.
+func slogLevel(level string) slog.Level {
+	switch level {
+	case LogLevelDebug:
+		return slog.LevelDebug
+	case LogLevelWarn:
+		return slog.LevelWarn
+	case LogLevelError:
+		return slog.LevelError
+	}
+	return slog.LevelInfo
+}
+
+// debugEnabled returns whether debug messages are logged.
+func debugEnabled() bool {
+	return slog.Default().Enabled(context.Background(), slog.LevelDebug)
+}
+
+// logDebug logs a debug message with attributes, as alternating keys and values.
+func logDebug(message string, attributes ...interface{}) {
+	slog.Debug(message, attributes...)
+}
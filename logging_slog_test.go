@@ -0,0 +1,58 @@
+//go:build go1.21
+// +build go1.21
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"log/slog"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-playground/assert/v2"
+)
+
+func TestConfigureLogging(t *testing.T) {
+	previous := slog.Default()
+	defer func() {
+		slog.SetDefault(previous)
+		log.SetOutput(os.Stderr)
+		log.SetFlags(log.LstdFlags)
+	}()
+
+	var output bytes.Buffer
+	err := ConfigureLogging(&output, LogLevelWarn, LogFormatJSON)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, debugEnabled(), false)
+
+	// messages below the level are dropped and the others are leveled by their prefix
+	log.Printf("Reloaded the configuration")
+	log.Printf("WARNING: changes to %s require a restart and are ignored\n", "listen")
+	log.Printf("Failed to write results: %v", "timeout")
+
+	var records []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(output.String()), "\n") {
+		var record map[string]interface{}
+		assert.Equal(t, json.Unmarshal([]byte(line), &record), nil)
+		delete(record, "time")
+		records = append(records, record)
+	}
+	assert.Equal(t, records, []map[string]interface{}{
+		{"level": "WARN", "msg": "changes to listen require a restart and are ignored"},
+		{"level": "ERROR", "msg": "Failed to write results: timeout"},
+	})
+
+	// checks are logged with their details at the debug level
+	output.Reset()
+	err = ConfigureLogging(&output, LogLevelDebug, LogFormatText)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, debugEnabled(), true)
+
+	targets := &HealthCheckTargets{}
+	targets.LogChecks([]CheckResult{{Endpoint: "index", Url: "https://fetch.com/", Method: "GET", Status: StatusUp, StatusCode: 200, Latency: 35 * time.Millisecond}})
+	assert.Equal(t, strings.Contains(output.String(), `level=DEBUG msg="check finished" endpoint=index url=https://fetch.com/ method=GET status=up status_code=200 latency_ms=35`), true)
+}
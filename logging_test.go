@@ -0,0 +1,73 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-playground/assert/v2"
+)
+
+func TestValidateLogging(t *testing.T) {
+	cases := []struct {
+		name   string
+		level  string
+		format string
+		valid  bool
+	}{
+		{name: "defaults", valid: true},
+		{name: "debug json", level: LogLevelDebug, format: LogFormatJSON, valid: true},
+		{name: "warn text", level: LogLevelWarn, format: LogFormatText, valid: true},
+		{name: "unknown level", level: "verbose", format: LogFormatText},
+		{name: "unknown format", level: LogLevelInfo, format: "logfmt"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ValidateLogging(tc.level, tc.format)
+			assert.Equal(t, err == nil, tc.valid)
+		})
+	}
+}
+
+func TestMessageLevel(t *testing.T) {
+	cases := []struct {
+		message string
+		level   string
+		trimmed string
+	}{
+		{message: "ERROR: invalid configuration", level: LogLevelError, trimmed: "invalid configuration"},
+		{message: "WARNING: changes to listen require a restart", level: LogLevelWarn, trimmed: "changes to listen require a restart"},
+		{message: "DEBUG: check finished", level: LogLevelDebug, trimmed: "check finished"},
+		{message: "Failed to write results: timeout", level: LogLevelError, trimmed: "Failed to write results: timeout"},
+		{message: "Reloaded the configuration", level: LogLevelInfo, trimmed: "Reloaded the configuration"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.message, func(t *testing.T) {
+			level, trimmed := messageLevel(tc.message)
+			assert.Equal(t, level, tc.level)
+			assert.Equal(t, trimmed, tc.trimmed)
+		})
+	}
+}
+
+func TestCheckAttributes(t *testing.T) {
+	up := CheckResult{Endpoint: "index", Url: "https://fetch.com/", Method: "GET", Status: StatusUp, StatusCode: 200, Latency: 35 * time.Millisecond, BytesSent: 80, BytesReceived: 512}
+	assert.Equal(t, checkAttributes(up), []interface{}{
+		"endpoint", "index", "url", "https://fetch.com/", "method", "GET", "status", StatusUp, "status_code", 200,
+		"latency_ms", float64(35), "bytes_sent", int64(80), "bytes_received", int64(512),
+	})
+
+	down := CheckResult{Endpoint: "index", Url: "https://fetch.com/", Status: StatusDown, ErrorKind: "timeout", Error: "context deadline exceeded", Retries: 2, err: errors.New("timeout")}
+	assert.Equal(t, checkAttributes(down), []interface{}{
+		"endpoint", "index", "url", "https://fetch.com/", "status", StatusDown, "latency_ms", float64(0),
+		"retries", 2, "error_kind", "timeout", "error", "context deadline exceeded",
+	})
+
+	reused := CheckResult{Endpoint: "index", Url: "https://fetch.com/", Status: StatusUp, Latency: 35 * time.Millisecond, Timing: &CheckTiming{FirstByte: 30 * time.Millisecond, Reused: true}}
+	assert.Equal(t, checkAttributes(reused), []interface{}{
+		"endpoint", "index", "url", "https://fetch.com/", "status", StatusUp, "latency_ms", float64(35),
+		"first_byte_ms", float64(30), "reused_conn", true,
+	})
+}
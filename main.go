@@ -1,49 +1,604 @@
 /*
-CheckHealth validates if HTTP endpoints are healthy every 15 seconds.
+CheckHealth validates if HTTP endpoints are healthy every 15 seconds (or a configured interval).
 
 DESCRIPTION:
 
 	CheckHealth is a simple CLI program that takes a defined endpoint configuration file as an
 	input and uses it to run HTTP client requests every 15 second. An endpoint is then labeled
 	as UP if the endpoint returns a status code between 200 and 299 and the response latency is
-	less than 500ms. Otherwise, the node is labeled as down.
+	less than 500ms. Otherwise, the node is labeled as down. Both the interval and the latency
+	threshold can be configured.
 
 	Using the endpoint status, cumulative domain availability is printed to the console every 15
 	seconds over the process lifetime. A domain is the fully qualified domain name (FQDN) of an
-	endpoint, where it's possible to have multiple endpoints. Also note, cumulative availability
-	data does not persist across executions of the program.
+	endpoint, or its group when set, where it's possible to have multiple endpoints. Cumulative
+	availability data
+	persists across executions of the program only when a state file is configured. Each
+	domain's availability is followed by the p50, p95 and p99 percentiles and the maximum of
+	the latencies of its last 1000 checks, and by its availability over the calendar periods of
+	availability_periods, such as today and this month.
 
 USAGE:
 
-	(MacOS/Linux) ./checkhealth file
-	(Windows)     checkhealth.exe file
+	(MacOS/Linux) ./checkhealth [-output format] [-interval duration] [-max-latency duration]
+	              [-listen address] [-env names] [-state-file file] [-format format]
+	              [-skip-invalid] [-report file] [-log-level level]
+	              [-log-format format] [-once] [-duration duration] file
+	(Windows)     checkhealth.exe [-output format] [-interval duration] [-max-latency duration]
+	              [-listen address] [-env names] [-state-file file] [-format format]
+	              [-skip-invalid] [-report file] [-log-level level]
+	              [-log-format format] [-once] [-duration duration] file
+
+	(MacOS/Linux) ./checkhealth demo [-addr address] [-config file]
+	(Windows)     checkhealth.exe demo [-addr address] [-config file]
+
+	(MacOS/Linux) ./checkhealth version [-json]
+	(Windows)     checkhealth.exe version [-json]
+
+	(MacOS/Linux) ./checkhealth verify -key public_key [file ...]
+	(Windows)     checkhealth.exe verify -key public_key [file ...]
+
+	(MacOS/Linux) ./checkhealth schema
+	(Windows)     checkhealth.exe schema
+
+	(MacOS/Linux) ./checkhealth check-config [flags] file
+	(Windows)     checkhealth.exe check-config [flags] file
+
+	(MacOS/Linux) ./checkhealth init [-template name] [-force] [-list] [file]
+	(Windows)     checkhealth.exe init [-template name] [-force] [-list] [file]
 
 REQUIRED ARGUMENT:
 
 	file
-		file should be the relative or absolute path to an endpoint yaml configuration file.
+		file should be the relative or absolute path to an endpoint configuration file in YAML,
+		JSON or TOML.
+
+OPTIONAL FLAGS:
+
+	-output format
+		The console output format, either "text" (default), "json" or "junit". The json format
+		prints one event per line following a versioned schema, where every event has a
+		"schema_version" field. See ResultSchemaVersion for the compatibility rules. The junit
+		format prints nothing while running, and the JUnit XML report of the run when the
+		program exits, after -once or -duration or when it is terminated, so CI systems can
+		render the health of the endpoints.
+
+	-once
+		Checks the endpoints a single time and exits, after writing the report of the run, with
+		status 1 when an endpoint was DOWN, so CI jobs can gate on the health of the endpoints,
+		e.g. with -output junit. A failed check marks its endpoint DOWN, whatever down_after.
+
+	-duration duration
+		Checks the endpoints every interval for the duration, such as 5m, and exits like -once,
+		with status 1 when an endpoint reached down_after consecutive failed checks. The cycle
+		in progress when the duration elapses is completed first.
+
+	-interval duration
+		The time between the start of two check cycles, such as "30s" or "1m". Defaults to 15s.
+
+	-max-latency duration
+		The latency above which an endpoint is labeled as down, such as "250ms". Defaults to
+		500ms and can't exceed the interval.
+
+	-listen address
+		Starts an HTTP server on the address, such as ":9100", publishing Prometheus metrics on
+		/metrics, the recent errors of the endpoints as JSON on /errors, the endpoints skipped
+		by -skip-invalid on /skipped, a read-only REST API on /api/v1/domains,
+		/api/v1/endpoints, /api/v1/endpoints/{name}/history, /api/v1/heatmap,
+		/api/v1/canaries and /api/v1/integrations, the liveness and readiness of the check
+		loop, with the circuit breakers of the sinks and notifiers, on /healthz and /readyz,
+		and a live dashboard of the domains and endpoints on /. See METRICS.
+
+	-env names
+		The environments to check, separated by commas, when the configuration file defines
+		environments. All environments are checked by default.
+
+	-state-file file
+		Saves the cumulative domain statistics to the file after every cycle, and restores them
+		on startup, so availability survives restarts.
+
+	-format format
+		The format of the configuration file, either "yaml", "json" or "toml". Detected from the
+		extension of the file by default: ".json" and ".toml" files, and YAML otherwise.
+
+	-skip-invalid
+		Skips the invalid endpoints of the configuration with a warning, instead of refusing
+		to start, like the skip_invalid_endpoints setting. Settings must still be valid.
+
+	-next-config file
+		A pending configuration file, loaded and validated with the same flags on startup and
+		swapped to on SIGUSR2, see RELOAD. The program refuses to start if it is invalid.
+
+	-report file
+		Writes a report of the run to the file when the program is terminated, summarizing the
+		checks, availability and outages of every endpoint, like the report_file setting.
+
+	-log-level level
+		The least severe level of the messages logged to stderr, "debug", "info" (default),
+		"warn" or "error", like the log_level setting. The debug level logs the request and
+		response details of every check.
+
+	-log-format format
+		The format of the messages logged to stderr, "text" (default) or "json" for JSON
+		lines, like the log_format setting.
+
+RELOAD:
+
+	On SIGHUP, the configuration file is read again with the same flags and applied before the
+	next check cycle, without restarting the process. Endpoints that are still configured, with
+	the same name and url, keep their state and recent errors, and domains that are still
+	configured keep their cumulative availability. Removed endpoints are dropped and added ones
+	start from zero. Changes to interval, align, concurrency, listen, state_file, parquet_dir,
+	sqlite_file, signing_key, sinks and notifiers require a restart and are ignored with a
+	warning. An invalid configuration is logged and the current one is kept:
+
+		$ kill -HUP $(pidof checkhealth)
+
+	With -next-config, the pending configuration is loaded and validated on startup, and on
+	every SIGHUP, and swapped to on SIGUSR2 (not available on Windows), applied before the next
+	check cycle like a reload. No file is read by the swap, so it can't fail or delay a cycle.
+	The pending file then replaces the configuration file for later reloads:
+
+		$ checkhealth -next-config green.yaml blue.yaml
+		$ kill -USR2 $(pidof checkhealth)
+
+	The endpoints added, removed and changed, and the settings changed, are logged and emitted
+	as a config_change event. With config_backup_dir, the replaced configuration file is
+	archived first.
+
+DEMO:
+
+	The demo subcommand starts a local target server with endpoints that are healthy, slow,
+	flaky, failing, redirecting and redirecting in a loop. A matching sample configuration is
+	printed to the console (and written to file when -config is provided), so every behavior can
+	be exercised without external targets:
+
+		$ ./checkhealth demo -config demo.yaml
+		$ ./checkhealth demo.yaml
+
+VERSION:
+
+	The version subcommand prints the version, commit, build date, Go version and the check
+	types, sinks and subcommands compiled into the binary. With -json, the same information is
+	printed as a JSON object for automation.
+
+VERIFY:
+
+	When signing_key is configured, every exported event carries an ed25519 signature. The
+	verify subcommand checks the events written by the json output mode or the file sink
+	against the matching public key and fails if any event was tampered with:
+
+		$ ./checkhealth verify -key public.pem results.jsonl
+
+METRICS:
+
+	With -listen (or the listen setting), per-endpoint and per-domain metrics are published on
+	/metrics in the Prometheus text exposition format:
+		checkhealth_endpoint_up, checkhealth_endpoint_state
+			Gauges of whether the last check succeeded and of the endpoint state.
+		checkhealth_endpoint_abandoned
+			A gauge of whether the checks of the endpoint are paused by abandon_after.
+		checkhealth_endpoint_checks_total, checkhealth_endpoint_failures_total
+			Counters of the checks and of the failed checks by error kind.
+		checkhealth_endpoint_retries_total
+			A counter of the retries of failed checks within their cycle.
+		checkhealth_endpoint_redirects_total, checkhealth_endpoint_redirect_seconds_total
+			Counters of the redirects followed by the checks and of the time spent on them.
+		checkhealth_endpoint_latency_seconds
+			A histogram of the check latencies.
+		checkhealth_endpoint_phase_seconds
+			A gauge of the dns, connect, tls and first_byte phases of the last HTTP check,
+			see LATENCY BREAKDOWN.
+		checkhealth_endpoint_schedule_fidelity_ratio, checkhealth_endpoint_checks_delayed_total,
+		checkhealth_endpoint_checks_skipped_total
+			The ratio of the scheduled checks made on time, and counters of the checks whose
+			cycle started over 10% of the interval late, that finished after the interval or
+			weren't made, because a cycle overran its interval, the endpoint waited for a worker,
+			was backing off or its domain exceeded its bandwidth cap.
+			Endpoints whose last 3 checks were delayed or skipped are logged as starved.
+		checkhealth_domain_availability_ratio
+			The cumulative domain availability, between 0 and 1.
+		checkhealth_domain_period_availability_ratio
+			The domain availability within the current availability_periods, between 0 and 1.
+		checkhealth_domain_checks_total, checkhealth_domain_up_checks_total,
+		checkhealth_domain_unknown_checks_total
+			Counters of the checks of the domain's endpoints.
+		checkhealth_component_up
+			A gauge of whether each component reported by a health+json response passes.
+		checkhealth_domain_sent_bytes_total, checkhealth_domain_received_bytes_total
+			Counters of the approximate bytes transferred by the checks of the domain.
+		checkhealth_endpoints_skipped
+			A gauge of the invalid endpoints skipped by -skip-invalid, listed on /skipped.
+		checkhealth_integration_breaker_state, checkhealth_integration_consecutive_failures,
+		checkhealth_integration_rejected_calls
+			Gauges of the circuit breaker state of every sink and notifier, of its consecutive
+			failed calls and of the calls rejected since it opened, also served on /healthz,
+			/readyz and /api/v1/integrations.
+
+	The labels of an endpoint are added to its metrics after endpoint and url, see LABELS.
+
+LABELS:
+
+	The labels of an endpoint are free-form key-value pairs, such as its team, env or tier,
+	carried through to its check_result, state_change and endpoint_failures events, its
+	metrics, the issues opened by notifiers and its state on /api/v1/endpoints, so downstream
+	systems can route and filter on them. /api/v1/endpoints?label=team=payments only serves
+	the endpoints with the label, and repeated label parameters select those with all of them.
+
+COMPONENT HEALTH:
+
+	Responses with the application/health+json content type are parsed, and the status of
+	every component listed in their checks is kept with the endpoint state and published on
+	/metrics. A "fail" status marks the endpoint down and a "warn" status degraded, naming the
+	components that aren't passing.
+
+SCHEMA:
+
+	The schema subcommand prints a JSON Schema of the configuration file, generated from the
+	configuration types compiled into the binary, so generated configurations can be validated
+	by infrastructure-as-code pipelines before they are deployed:
+
+		$ ./checkhealth schema > config_schema.json
+
+CHECK CONFIG:
+
+	The check-config subcommand accepts the flags and file of the program, validates the
+	configuration and prints the resolved endpoints, domains and effective settings (method,
+	interval, timeout) without checking any endpoint. It exits with an error when the
+	configuration is invalid, so configuration changes can be linted in CI before deploy:
+
+		$ ./checkhealth check-config -interval 30s config.yaml
+
+INIT:
+
+	The init subcommand writes a default configuration file to start from, embedded in the
+	binary, to file or to the console. The "basic" template is written by default, and the
+	"service" template configures a long-lived service with metrics, a state file and a file
+	sink. -list lists the templates, and -force overwrites an existing file:
+
+		$ ./checkhealth init -template service config.yaml
+
+BUILD TAGS:
+
+	Optional integrations can be excluded at build time to produce a slimmer binary. The
+	features present in a binary are listed by the version subcommand.
+		nobucket
+			Excludes the s3 and gcs sinks.
+		nodemo
+			Excludes the demo subcommand and its target server.
+		noemail
+			Excludes the email notifier.
+		nogithub
+			Excludes the github notifier.
+		nogrpc
+			Excludes the grpc check type.
+		noinflux
+			Excludes the influx sink.
+		nojira
+			Excludes the jira notifier.
+		noparquet
+			Excludes the parquet_dir history export and the parquet format of the s3 and gcs
+			sinks.
+		nosqlite
+			Excludes the sqlite_file history export.
+		nossh
+			Excludes the ssh and sftp check types.
+		notoml
+			Excludes the toml configuration format.
 
 CONFIGURATION FILE:
 
-	The configuration file defines a list of endpoints to query in YAML. It has the following
-	schema:
+	The configuration file defines a list of endpoints to query in YAML. Files larger than 4 MiB,
+	nested deeper than 32 levels or expanding to more than 1048576 values are rejected. Before
+	starting, every problem of the file is reported with its line: unknown or duplicate fields,
+	missing names and urls, invalid urls and methods, and duplicate names. JSON and TOML files
+	follow the same schema, where a TOML file declares its endpoints as [[endpoints]] tables and
+	its problems are reported without lines. It has the following schema:
 		name (string, required)
-			A free-text description of the endpoint.
+			A free-text description of the endpoint. Names must be unique.
+
+		url (string, required unless path or baseline_url and canary_url are set)
+			The URL of the HTTP endpoint, an absolute http:// or https:// URL. IPv6 literals
+			must be enclosed in brackets, e.g. http://[::1]:8080/health.
+
+		group (string, optional)
+			The name of the domain the endpoint is aggregated into, instead of the host of its
+			URL, so "fetch.com" and "www.fetch.com", or the regions of a service, are reported
+			as one domain.
+
+		hosts (list, optional)
+			Expands the entry into one endpoint per host, with the host of the URL replaced
+			and the host appended to the name. Hosts without a port keep the port of the URL, and
+			bare IPv6 addresses, e.g. 2001:db8::1, are enclosed in brackets.
+
+		path (string, optional)
+			A path relative to the base URL of the environments, used instead of url. The
+			entry is expanded into one endpoint per environment, with the environment
+			appended to the name.
 
-		url (string, required)
-			The URL of the HTTP endpoint. It is assumed to be valid.
+		environments (list, optional)
+			The environments a path applies to. Defaults to every environment.
+
+		baseline_url, canary_url (string, optional)
+			The URLs of the baseline and the canary of a progressive rollout, used instead of
+			url. The entry is expanded into a baseline and a canary endpoint, with the variant
+			appended to the name, and every cycle the availability and latency of the recent
+			checks of the canary are compared with those of the baseline. See CANARY
+			COMPARISON.
 
 		method (string, optional)
-			The HTTP method to use. If not provided, the GET method is used. It is assumed a
-			valid method is provided.
+			The HTTP method to use, in upper case for the standard methods. If not provided,
+			the GET method is used.
 
 		headers (dictionary, optional)
 			The HTTP headers to add or modify the default HTTP client request. It is assumed
 			that these are valid.
 
+		auth (mapping, optional)
+			The credentials sent in the Authorization header of HTTP and gRPC endpoints,
+			instead of a hand-crafted header.
+				type (string, required)
+					"basic" for HTTP basic authentication, or "bearer" for a token.
+				username (string, required for basic)
+					The user of basic authentication.
+				password, password_env, password_file (string)
+					The password of basic authentication, set inline, or read from an
+					environment variable or a file when the configuration is loaded.
+				token, token_env, token_file (string)
+					The bearer token, set inline, or read from an environment variable
+					or a file when the configuration is loaded.
+
 		body (string, optional)
-			A JSON-encoded string to be sent in the request. If not provided, no body is sent
-			in the request.
+			A string to be sent in the request, e.g. JSON or XML, with its type set by a
+			content-type header. If not provided, no body is sent in the request.
+
+		body_file (string, optional)
+			The path of a file streamed as the request body on every check, instead of body.
+			It is not loaded into memory, so it can be used for large or binary uploads. The
+			content type is inferred from the extension of the file unless a content-type
+			header is set.
+
+		success_when (string, optional)
+			An expression deciding whether a check succeeded, replacing the default status
+			code check for complex endpoints. Comparisons of the status, the latency, a
+			header["Name"] or the body are combined with and, or, not and parentheses:
+				status == 200 and latency < 300ms and body contains "ok"
+			status and latency support ==, !=, <, <=, > and >=. header and body support ==,
+			!=, contains and matches (a regular expression) with double quoted strings.
+
+		degraded_when (string, optional)
+			An expression in the success_when syntax marking successful checks degraded,
+			still counted as available, e.g. header["Warning"] != "" or latency > 1s. HTTP
+			endpoints only.
+
+		prefer_head (boolean, optional)
+			Check the endpoint with HEAD instead of GET to reduce bandwidth, unless the body
+			is asserted on. Targets rejecting HEAD (405 or 501) are checked with GET again
+			within the same check, and with GET only from then on.
+
+		expect_body_contains (string, optional)
+			A string the response body must contain, so error pages served with a 200 status
+			mark the endpoint down.
+
+		expect_body_regex (string, optional)
+			A regular expression the response body must match.
+
+		expect_json (list of strings, optional)
+			Assertions the JSON response body must all satisfy, for APIs embedding their
+			status in a 200 response, e.g. $.status == "ok" or $.replicas >= 2. Paths start
+			with $ followed by .name, ["name"] or [index]. == and != compare any JSON value,
+			and <, <=, > and >= numbers. A missing path fails the assertion.
+
+		type (string, optional)
+			"http" checks the endpoint with an HTTP request (default). "grpc" calls the
+			grpc.health.v1.Health/Check RPC of the gRPC server at url (https:// for TLS,
+			http:// for plaintext), and the endpoint is only up when the service is SERVING.
+			"ssh" connects to the ssh://user@host[:port] url with key authentication and runs
+			ssh_command, and the endpoint is only up when it exits with status 0. Its output is
+			evaluated as the body by success_when and the body assertions, and its exit status
+			as the status. "ftp" and "sftp" log in to the ftp://[user@]host[:port] or
+			sftp://user@host[:port] url, SFTP with the SSH options of "ssh". "dns" looks up the
+			record_type records of the dns://name url, which are evaluated as the body by the
+			body assertions, one per line. "raw-tcp" connects to the tcp://host:port url, sends
+			send or send_hex, and reads the response until it starts with expect_prefix or
+			expect_prefix_hex and satisfies the body assertions, within the timeout.
+
+		grpc_service (string, optional)
+			The service checked by a gRPC endpoint. Defaults to the overall server health.
+
+		tls_ca_file, tls_server_name, tls_insecure_skip_verify (optional)
+			The PEM file of the certificate authorities trusted, the name verified in the
+			server certificate, and whether verification is skipped, for HTTPS and gRPC
+			endpoints, e.g. internal endpoints with self-signed certificates. HTTPS endpoints
+			send the name as SNI, so servers can be checked by IP address before a DNS
+			cutover. Skipping verification is logged as a warning.
+
+		tls_client_cert, tls_client_key (string, optional)
+			The PEM files of the client certificate and key presented by HTTPS and gRPC
+			endpoints to servers requiring mutual TLS. They are read again when they change,
+			so rotated certificates are picked up without a restart.
+
+		tls_accept_names (list, optional)
+			Names the server certificate may be valid for instead of the name verified, for
+			HTTPS and gRPC endpoints with a known hostname mismatch. The rest of the
+			verification still applies, and every certificate accepted this way is logged
+			as a warning.
+
+		ssh_command, ssh_key_file (string, required for SSH endpoints)
+			The command run by an SSH endpoint, and the private key it authenticates with.
+
+		ssh_passphrase_env, ssh_known_hosts, ssh_insecure_ignore_host_key (optional)
+			The environment variable holding the passphrase of the key, the known hosts file
+			verifying the host key (defaults to ~/.ssh/known_hosts), and whether the host key
+			isn't verified, for SSH and SFTP endpoints.
+
+		password_env (string, optional)
+			The environment variable holding the password of an FTP endpoint. FTP endpoints
+			without a user log in anonymously.
+
+		list_directory, stat_file (string, optional)
+			A directory listed and a file stat'ed by an FTP or SFTP endpoint after logging in.
+			The names listed are evaluated as the body by the body assertions.
+
+		record_type (string, optional)
+			The records looked up by a DNS endpoint: A (default), AAAA, CNAME, TXT, MX, NS or
+			CAA.
+
+		expect_records ([]string, optional)
+			Records a DNS endpoint must return, e.g. "10 mx1.example.com" for MX records.
+			Names are compared case-insensitively and without their trailing dot.
+
+		expect_records_ordered (boolean, optional)
+			Whether expect_records must be returned in the same order, e.g. by MX preference.
+
+		send, send_hex (string, optional)
+			The bytes sent by a raw TCP endpoint once connected, as a string or in
+			hexadecimal, e.g. "0d 0a". Nothing is sent by default, e.g. to read a banner.
+
+		expect_prefix, expect_prefix_hex (string, optional)
+			The bytes the response of a raw TCP endpoint must start with, as a string or in
+			hexadecimal.
+
+		runbook (string, optional)
+			A link to the endpoint's runbook, included in issues opened by notifiers.
+
+		owner (string, optional)
+			The team, email address or Slack channel owning the endpoint, included in issues
+			opened by notifiers. Outage emails are sent to an owner that is an email address,
+			or to the recipients of the owner in the email notifier's owners.
+
+		labels (mapping, optional)
+			Free-form labels of the endpoint, e.g. team: payments, see LABELS. Names are
+			letters, digits and underscores, and can't start with __ nor be endpoint, url,
+			state, kind, le, phase or component.
+
+		down_after (integer, optional)
+			The number of consecutive failed checks after which the endpoint is DOWN. The
+			first failed check marks it DEGRADED. Defaults to 3.
+
+		error_history (integer, optional)
+			The number of recent errors kept for the endpoint and served on /errors when
+			-listen is provided. Defaults to 10, and a negative value disables it.
+
+		abandon_after (duration, optional)
+			How long the endpoint must stay DOWN before it is abandoned: its checks are
+			paused and recorded as unknown, its open issues are commented on and it doesn't
+			fail the run report, until the configuration is reloaded. Disabled by default.
+
+		alert_status_change (boolean, optional)
+			Reports every change of the status code of the endpoint's responses between two
+			checks, even within the success range, e.g. 200 to 204, and of where its redirects
+			point to, which often signals an unintended deploy or routing change. Checks
+			without a response are ignored. Changes are printed like state changes and emitted
+			as status_change events.
+
+		dns_failure (string, optional)
+			How DNS resolution failures are handled: "down" marks the endpoint down (default),
+			"retry" retries once with dns_resolver, "unknown" excludes the check from
+			availability. The "retry" policy can't be combined with proxy_protocol or the tls_
+			options, as the retry uses a client of its own, and the global "retry" policy
+			leaves these endpoints, and those setting netns or vrf, on "down".
+
+		dns_resolver (string, optional)
+			The secondary DNS server (host:port) used by the "retry" policy, and the server
+			queried by DNS endpoints.
+
+		netns (string, optional)
+			On Linux, the network namespace the endpoint is checked from, by name (as
+			created by "ip netns add") or path. Host names are resolved outside of it.
+
+		vrf (string, optional)
+			On Linux, the VRF device the endpoint's connections are bound to.
+
+		proxy_protocol (string, optional)
+			Sends a PROXY protocol header, "v1" (text) or "v2" (binary), at the start of the
+			connections of an HTTP or raw TCP endpoint, for targets behind load balancers
+			requiring it. Can't be combined with dual_stack, netns or vrf.
+
+		max_idle_conns, max_conns (integer, optional)
+			The maximum number of idle connections kept, and of connections opened, per host
+			by the endpoint's HTTP client. Defaults to 2 idle connections and no limit.
+
+		disable_keep_alives (boolean, optional)
+			Opens a new connection for every check.
+
+		follow_redirects (boolean, optional)
+			Whether redirects are followed (default). When false, redirect responses are
+			checked themselves, and mark the endpoint down unless success_when accepts them.
+
+		max_redirects (integer, optional)
+			The maximum number of redirects followed, 10 by default. Checks redirected more
+			times are down with the redirect error kind.
+
+		max_redirect_latency (duration, optional)
+			The budget of the time spent on the redirects followed by a check. Checks whose
+			redirects take longer are degraded with the redirect error kind, and max_latency
+			only applies to the final response.
+
+		proxy (string, optional)
+			The URL of the HTTP (or socks5://) proxy the endpoint's requests are sent through,
+			or "direct" to ignore the proxy of the environment (HTTP_PROXY, HTTPS_PROXY and
+			NO_PROXY), which is used by default. Every endpoint has an HTTP client of its own,
+			so these options don't affect other endpoints.
+
+		rate_limited (string, optional)
+			How rate-limited (429) responses are handled: "down" marks the endpoint down
+			(default), "degraded" counts it as available but marks it DEGRADED, "unknown"
+			excludes the check from availability and skips checks until the delay of the
+			Retry-After header has passed (1m without one, at most 1h).
+
+		dual_stack (boolean, optional)
+			When the host has both IPv4 and IPv6 addresses, check each address family
+			separately and report per-family availability. The endpoint is only up when every
+			family is up. Redirects to another host connect to the addresses of that host.
+
+		fallback_url (string, optional)
+			The failover target of the endpoint, checked right after a check of url is down,
+			with the same request and assertions and its own timeout, and reported with
+			its own availability. The endpoint stays down whatever the fallback's result.
+
+		max_body_size (integer, optional)
+			The maximum decompressed size of the response body in bytes. Larger responses,
+			such as decompression bombs, mark the endpoint down and are logged as a distinct
+			failure. Defaults to 10485760 (10MiB).
+
+		body_read_limit (integer, optional)
+			Stops reading the response body after that many decompressed bytes, without
+			failing the check, so the rest of large responses isn't downloaded. The body
+			assertions only see the bytes read.
+
+		timeout, max_latency (duration, optional)
+			The time after which a check of the endpoint is cancelled and marked down, and
+			the latency above which a successful check is marked degraded, so a slow but
+			working endpoint isn't killed mid-request. Both default to the max_latency
+			setting. max_latency must not exceed timeout, nor timeout the interval.
+
+		retries (integer, optional)
+			The number of times a check failing with a connection error, a timeout or a 502,
+			503 or 504 response is retried within the same cycle before the failure is
+			recorded, up to 10. Retries share the timeout of the check.
+				retry_delay (duration, optional)
+					The delay before the first retry, doubled before every next one, unless
+					the response has a Retry-After header. Defaults to 500ms.
+
+		auto_latency (boolean, optional)
+			Learn the endpoint's baseline latency, the median of its first successful checks,
+			and mark later checks slower than 3x the baseline degraded and slower than 10x
+			down. The timeout still applies.
+				auto_latency_warmup (integer, optional)
+					The number of successful checks the baseline is learned from. Defaults
+					to 20.
+
+		expect_continue (boolean, optional)
+			Sends "Expect: 100-continue" so the body is only sent once the server (or proxy)
+			has accepted the request headers.
+
+		expect_continue_timeout (duration, optional)
+			How long to wait for "100 Continue" before sending the body anyway. Defaults to 1s.
+
+		expect_interim (integer, optional)
+			An interim (1xx) status code, e.g. 100, that must be received before the final
+			response for the endpoint to be considered up.
 
 	Example:
 		- name: fetch.com some post endpoint
@@ -54,6 +609,306 @@ CONFIGURATION FILE:
 		    user-agent: fetch-synthetic-monitor
 		  body: '{"foo":"bar"}'
 
+	The list of endpoints can also be provided under the "endpoints" key of a mapping, next to
+	the following optional settings:
+		output (string, optional)
+			The console output format, either "text" (default), "json" or "junit". The
+			-output flag takes precedence.
+
+		interval, max_latency (duration, optional)
+			The time between the start of two check cycles and the latency above which an
+			endpoint is labeled as down, such as "30s" and "250ms". Default to 15s and 500ms.
+			The -interval and -max-latency flags take precedence. Endpoints can set their
+			own timeout and max_latency.
+
+		listen (string, optional)
+			The address of the HTTP server publishing Prometheus metrics. The -listen flag
+			takes precedence.
+
+		environments (mapping, optional)
+			The base URLs of the environments, by name, that endpoints with a path are
+			checked in.
+				env (string, optional)
+					The environments to check, separated by commas. All environments by
+					default. The -env flag takes precedence.
+
+		state_file (string, optional)
+			The file the domain statistics are saved to after every cycle and restored from
+			on startup. The -state-file flag takes precedence.
+
+		report_file (string, optional)
+			The file a report of the run is written to when the program is terminated, with
+			the checks, availability and outages of every endpoint since it started. The
+			-report flag takes precedence.
+				report_format (string, optional)
+					"json" or "junit" (JUnit XML, where endpoints that were DOWN fail).
+					Defaults to "junit" for files ending with .xml, "json" otherwise.
+
+		log_level (string, optional)
+			The least severe level of the messages logged to stderr, "debug", "info",
+			"warn" or "error". Defaults to "info". The -log-level flag takes precedence.
+
+		log_format (string, optional)
+			"text" or "json" (JSON lines). Defaults to "text". The -log-format flag takes
+			precedence.
+
+		bandwidth_caps (mapping, optional)
+			The maximum bytes the checks of a domain's endpoints may transfer per
+			bandwidth_window, by domain. The bytes transferred are approximate.
+				bandwidth_window (duration, optional)
+					The period the caps apply to. Defaults to 24h.
+				bandwidth_exceeded (string, optional)
+					What happens to the endpoints of a domain over its cap until the window
+					resets: "head" checks them with HEAD (default), "reduce" only checks
+					them every 4 cycles and records the skipped checks as unknown.
+
+		config_backup_dir (string, optional)
+			The directory the configuration file is archived to when a reload (SIGHUP)
+			replaces it with a different one. The last 20 archives are kept.
+
+		parquet_dir (string, optional)
+			The directory the result of every check is exported to, as Parquet files in
+			date=YYYY-MM-DD partitions for DuckDB, Spark or Athena. Results are written at
+			least every hour, when the day changes and on exit.
+
+		sqlite_file (string, optional)
+			The SQLite database the result of every check is appended to at the end of each
+			cycle, in the checks table, to compute the availability over any window with SQL.
+			Created if it doesn't exist. Rows can be deleted, the freed pages aren't reused. On
+			Windows, the database isn't locked against readers while a cycle is written.
+
+		skip_invalid_endpoints (boolean, optional)
+			Skips the endpoints with invalid options, logging a warning for each of them,
+			instead of refusing the configuration. Every invalid endpoint is reported either
+			way.
+
+		strict_integrations (boolean, optional)
+			Refuses to start when the metrics server, the parquet_dir or sqlite_file history,
+			a sink or a notifier fails to start. By default, the failure is logged as a warning and the
+			integration is started again every minute, so the endpoints are still checked.
+
+		latency_windows (list of durations, optional)
+			The periods, such as 5m and 1h, over which the p50, p95 and p99 latencies of
+			every domain are also computed, printed after its availability, reported in the
+			domain_availability events and published on /metrics.
+
+		availability_periods (list of strings, optional)
+			The calendar periods, "day", "week" (starting on Monday) or "month", over which
+			the availability of every domain is also computed, as SLAs are stated, printed
+			after its availability with the availability of the previous period, reported
+			in the domain_availability events and published on /metrics. The periods are
+			saved to the state file.
+				availability_timezone (string, optional)
+					The IANA time zone the periods start at midnight in, such as
+					"America/New_York". Defaults to UTC.
+
+		dns_failure, dns_resolver, netns, vrf, rate_limited, max_body_size, body_read_limit,
+		prefer_head, auto_latency, auto_latency_warmup, down_after, error_history,
+		abandon_after, alert_status_change (optional)
+			The defaults for endpoints that don't set their own. prefer_head only applies to
+			HTTP endpoints checked with GET, and netns and vrf to HTTP endpoints without
+			dual_stack, proxy_protocol or the retry DNS failure policy.
+
+		concurrency (integer or string, optional)
+			The number of endpoints checked concurrently. Endpoints are checked in series by
+			default. With "auto", the number of workers is adjusted after every cycle so
+			checks finish within half of the interval, and each adjustment is logged.
+				concurrency_min, concurrency_max (integer, optional)
+					The bounds of the auto mode. Default to 1 and 64.
+
+		check_types (mapping, optional)
+			Options by type of check, e.g. http, grpc or ssh. With check_types, the endpoints
+			of every type are checked in a pool of workers of their own, so slow checks of
+			one type can't starve the checks of the others.
+				concurrency (integer, optional)
+					The workers of the pool of the type. Defaults to the concurrency.
+				timeout, max_latency (duration, optional)
+					The defaults for the endpoints of the type that don't set their own.
+
+		align (boolean, optional)
+			Starts every cycle on a wall-clock boundary that is a multiple of the interval
+			(:00, :15, :30 and :45 seconds), so results of multiple instances are comparable
+			when aggregated. Cycles overrunning a boundary skip to the next one.
+
+		signing_key (string, optional)
+			The path of a PEM encoded ed25519 private key. Exported events are signed with it
+			so availability reports can be verified as untampered with the verify
+			subcommand.
+
+		sinks (list, optional)
+			Destinations events are written to in addition to the console. Events are
+			written asynchronously in batches, so a slow sink never delays the checks.
+				type (string, required)
+					The sink type. "file" appends JSON events to a file, "webhook"
+					posts them to a URL as a JSON array, "influx" writes them as
+					InfluxDB line protocol to the InfluxDB write API or to a file, and
+					"s3" and "gcs" upload snapshots of the availability of the domains
+					to a bucket.
+				path (string)
+					The file path used by the file and influx sinks.
+				url (string)
+					The URL the webhook sink posts events to, the InfluxDB write API
+					URL of the influx sink, with its org and bucket, or the endpoint of
+					an S3 compatible service for the s3 sink, e.g. MinIO.
+				secret_env (string, optional)
+					The environment variable holding the secret the webhook sink
+					signs events with, in the Checkhealth-Signature header, or the
+					secret key of the s3 and gcs sinks. Defaults to
+					AWS_SECRET_ACCESS_KEY and GCS_SECRET_ACCESS_KEY.
+				token_env (string, optional)
+					The environment variable holding the InfluxDB API token, or the
+					session token of the s3 sink. Defaults to AWS_SESSION_TOKEN for
+					the s3 sink.
+				bucket (string)
+					The bucket the s3 and gcs sinks upload snapshots to.
+				key (string, optional)
+					The key template of the snapshots, with the {year}, {month},
+					{day}, {hour}, {minute}, {timestamp} and {format} placeholders.
+					Defaults to
+					checkhealth/{year}/{month}/{day}/availability-{timestamp}.{format}.
+				region (string, optional)
+					The region of the bucket. Defaults to us-east-1 for s3 and auto
+					for gcs.
+				format (string, optional)
+					The snapshot format, "json", "csv" or "parquet". Defaults to json.
+				upload_interval (duration, optional)
+					Time between two snapshots. Defaults to 15m.
+				access_key_env (string, optional)
+					The environment variable holding the access key of the s3 and gcs
+					sinks. Defaults to AWS_ACCESS_KEY_ID and GCS_ACCESS_KEY_ID.
+				results (boolean, optional)
+					Also writes a check_result event for every check.
+				batch_size (integer, optional)
+					Events per write. Defaults to 100.
+				flush_interval (duration, optional)
+					Maximum time events wait before being written. Defaults to 10s.
+				queue_size (integer, optional)
+					Events buffered while the sink is busy, after which new events are
+					dropped. Defaults to 10000.
+				circuit_breaker (mapping, optional)
+					failure_threshold consecutive failed writes (default 5) open the
+					breaker, dropping batches without contacting the sink until
+					cooldown (default 1m) has elapsed.
+
+		alert_dampening (duration, optional)
+			The default dampening of the notifiers. Disabled by default.
+
+		notifiers (list, optional)
+			Issue trackers in which an issue is opened when an endpoint stays DOWN for
+			longer than after, and commented on and closed once it is UP again, or email
+			recipients notified of the outage and its recovery.
+				type (string, required)
+					The notifier type, "github", "jira" or "email".
+				after (duration, optional)
+					How long an endpoint must be DOWN. Defaults to 5m.
+				dampening (duration, optional)
+					How long to wait, once an endpoint has been DOWN for after, for other
+					endpoints to go DOWN, such as during a whole-domain outage, so they
+					are all listed in a single issue closed once they are all UP again.
+					Defaults to alert_dampening.
+				url (string)
+					The API base URL. Defaults to https://api.github.com for github. For
+					email, the SMTP server as smtp://host[:port] (STARTTLS when offered,
+					port 587 by default) or smtps://host[:port] (TLS, port 465).
+				token_env (string, optional)
+					The environment variable holding the API token, or the SMTP password.
+					Defaults to GITHUB_TOKEN, JIRA_API_TOKEN or SMTP_PASSWORD.
+				repository (string)
+					The github repository, as owner/name.
+				project, issue_type, user, close_transition (string)
+					The jira project key, the issue type (default Bug), the user for
+					basic authentication (bearer authentication when not set) and the
+					transition resolving tickets (default Done).
+				labels (list, optional)
+					Labels added to the issues.
+				from, to (string and list)
+					The sender and recipients of the email notifier. Its user, when set,
+					authenticates with the password of token_env.
+				owners (mapping, optional)
+					The recipients of the outage emails of each endpoint owner, instead of
+					to.
+				require_tls, tls_insecure_skip_verify (boolean, optional)
+					Whether email isn't sent without STARTTLS, and whether the certificate
+					of the SMTP server isn't verified.
+				circuit_breaker (mapping, optional)
+					As for sinks.
+
+		derived_metrics (list, optional)
+			Metrics aggregated every cycle over the checks of a set of endpoints, emitted to
+			the sinks as derived_metric events. Unknown checks are ignored.
+				name (string, required)
+					The name of the metric.
+				aggregate (string, required)
+					"down_ratio" (between 0 and 1) or "down_count" of the checks that were
+					down, or "max_latency" or "mean_latency" of the checks, in
+					milliseconds.
+				endpoints, owner, domain (string, optional)
+					A regular expression matched against the endpoint names, and the
+					owner and domain of the endpoints aggregated. Every endpoint by
+					default.
+
+	Example:
+		output: json
+		sinks:
+		  - type: file
+		    path: results.jsonl
+		    flush_interval: 30s
+		endpoints:
+		  - name: fetch.com index page
+		    url: https://fetch.com/
+
+ENDPOINT STATES:
+
+	Each endpoint is tracked as a state machine starting UNKNOWN. A successful check moves it to
+	UP, a failed check to DEGRADED and down_after consecutive failed checks to DOWN. Transitions
+	are printed with how long the endpoint was in its previous state, e.g.
+
+		fetch.com index page is DOWN, was DEGRADED for 30s
+
+	and emitted as state_change events in the json output and sinks. Endpoints with
+	alert_status_change also report the changes of their responses, e.g.
+
+		fetch.com index page status code changed from 200 to 204
+
+	emitted as status_change events. Endpoints DOWN for their abandon_after are abandoned: their
+	checks are paused, which is printed, e.g.
+
+		fetch.com legacy page is abandoned, DOWN for 168h0m0s, its checks are paused
+
+	and emitted as endpoint_abandoned events. Reloading the configuration resumes them.
+
+FAILURE REASONS:
+
+	Failed checks are counted per endpoint by reason: the error kind (timeout, dns, tls,
+	connection, body, ...), "connection refused" for refused connections, or the status code of
+	non-2xx responses, e.g. "status 503". The counts are printed after the availability lines,
+	from the most to the least frequent reason, e.g.
+
+		fetch.com careers page failed 5 times: timeout 3, status 503 2
+
+	and emitted as endpoint_failures events in the json output and sinks.
+
+CANARY COMPARISON:
+
+	An endpoint with a baseline_url and a canary_url is expanded into a baseline and a canary
+	endpoint, e.g. "checkout (baseline)" and "checkout (canary)". Once both were checked, the
+	availability and the p50 and p95 latencies of the recent checks of the canary are compared
+	with those of the baseline every cycle, after the failure reasons, e.g.
+
+		checkout canary vs baseline: availability 95% vs 100% (-5), p50 130ms vs 120ms (+10ms), p95 310ms vs 250ms (+60ms)
+
+	and emitted as canary_comparison events in the json output and sinks, with the deltas of the
+	canary over the baseline, and served on /api/v1/canaries.
+
+LATENCY BREAKDOWN:
+
+	The latency of the last request of every HTTP check is broken down into the DNS lookup, the
+	TCP connection, the TLS handshake and the time to the first byte of the response, counted
+	from the request of a connection, so a slow network can be told apart from a slow
+	application. Requests reusing a connection only have a time to first byte. The breakdown is
+	logged with every check at the debug level, served as the timing of the endpoint on
+	/api/v1/endpoints and published as checkhealth_endpoint_phase_seconds.
+
 EXIT STATUS:
 
 	CheckHealth will exit early with a non-zero exit if any configuration steps fail.
@@ -64,13 +919,16 @@ EXAMPLE USAGE:
 
 	Console Output:
 		fetch.com has 0% availability percentage
+		fetch.com has latency p50 502ms, p95 503ms, p99 503ms, max 503ms
 		www.fetchrewards.com has 100% availability percentage
+		www.fetchrewards.com has latency p50 120ms, p95 310ms, p99 480ms, max 502ms
 */
 package main
 
 import (
 	"bytes"
 	"context"
+	"flag"
 	"fmt"
 	"io"
 	"log"
@@ -78,23 +936,226 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"os/signal"
+	"regexp"
+	"strings"
+	"syscall"
 	"time"
-
-	"gopkg.in/yaml.v2"
 )
 
 // Endpoint is an object containing information needed to create an HTTP request. It also contains
 // a pointer to a Domain object that can used for recording endpoint availability.
 type Endpoint struct {
-	Name    string            `yaml:"name"`
-	Url     string            `yaml:"url"`
+	Name string `yaml:"name"`
+
+	// Type selects how the endpoint is checked: with an HTTP request (default), with the gRPC
+	// health checking protocol for the GRPCService, or by running a command over SSH. The TLS
+	// options apply to gRPC and HTTPS endpoints, see TLSClient.
+	Type                  string   `yaml:"type,omitempty"`
+	GRPCService           string   `yaml:"grpc_service,omitempty"`
+	TLSCAFile             string   `yaml:"tls_ca_file,omitempty"`
+	TLSServerName         string   `yaml:"tls_server_name,omitempty"`
+	TLSAcceptNames        []string `yaml:"tls_accept_names,omitempty"`
+	TLSInsecureSkipVerify bool     `yaml:"tls_insecure_skip_verify,omitempty"`
+	TLSClientCert         string   `yaml:"tls_client_cert,omitempty"`
+	TLSClientKey          string   `yaml:"tls_client_key,omitempty"`
+
+	// SSHCommand is the command run by SSH endpoints, authenticated with the private key in
+	// SSHKeyFile, decrypted with the passphrase held by the SSHPassphraseEnv environment variable.
+	// Host keys are verified against SSHKnownHosts unless SSHInsecureIgnoreHostKey is set.
+	SSHCommand               string `yaml:"ssh_command,omitempty"`
+	SSHKeyFile               string `yaml:"ssh_key_file,omitempty"`
+	SSHPassphraseEnv         string `yaml:"ssh_passphrase_env,omitempty"`
+	SSHKnownHosts            string `yaml:"ssh_known_hosts,omitempty"`
+	SSHInsecureIgnoreHostKey bool   `yaml:"ssh_insecure_ignore_host_key,omitempty"`
+
+	// PasswordEnv is the environment variable holding the password of FTP endpoints. ListDirectory
+	// and StatFile are the directory listed and the file stat'ed by FTP and SFTP endpoints after
+	// logging in.
+	PasswordEnv   string `yaml:"password_env,omitempty"`
+	ListDirectory string `yaml:"list_directory,omitempty"`
+	StatFile      string `yaml:"stat_file,omitempty"`
+
+	// RecordType is the record type looked up by DNS endpoints, which must include ExpectRecords,
+	// in the same order when ExpectRecordsOrdered is set.
+	RecordType           string   `yaml:"record_type,omitempty"`
+	ExpectRecords        []string `yaml:"expect_records,omitempty"`
+	ExpectRecordsOrdered bool     `yaml:"expect_records_ordered,omitempty"`
+
+	// Send is sent by raw TCP endpoints once connected, or SendHex decoded from hexadecimal, and
+	// their response must start with ExpectPrefix, or ExpectPrefixHex decoded from hexadecimal.
+	Send            string `yaml:"send,omitempty"`
+	SendHex         string `yaml:"send_hex,omitempty"`
+	ExpectPrefix    string `yaml:"expect_prefix,omitempty"`
+	ExpectPrefixHex string `yaml:"expect_prefix_hex,omitempty"`
+
+	// Group is the name of the domain the endpoint is aggregated into, overriding the host of its
+	// URL, see GetGroupPointer.
+	Group string `yaml:"group,omitempty"`
+
+	Url     string            `yaml:"url,omitempty"`
+	Hosts   []string          `yaml:"hosts,omitempty"`
 	Method  string            `yaml:"method,omitempty"`
 	Headers map[string]string `yaml:"headers,omitempty"`
 	Body    string            `yaml:"body,omitempty"`
 
-	Domain *Domain
+	// Auth sends basic authentication or a bearer token in the Authorization header of the
+	// requests of HTTP and gRPC endpoints, see EndpointAuth.
+	Auth *EndpointAuth `yaml:"auth,omitempty"`
+
+	// BodyFile is the path of a file streamed as the request body on every check, for bodies too
+	// large or inconvenient to inline in the configuration.
+	BodyFile string `yaml:"body_file,omitempty"`
+
+	Path         string   `yaml:"path,omitempty"`
+	Environments []string `yaml:"environments,omitempty"`
+
+	// FallbackUrl is checked right after a failed check of Url, so the failover target is
+	// verified while the primary is down. Its result is reported in the Fallback of the result.
+	FallbackUrl string `yaml:"fallback_url,omitempty"`
+
+	// BaselineUrl and CanaryUrl replace Url to compare a canary deployment with its baseline, see
+	// ExpandCanaries. Canary is the name of the endpoint they were set on, and Variant whether the
+	// expanded endpoint checks the baseline or the canary.
+	BaselineUrl string `yaml:"baseline_url,omitempty"`
+	CanaryUrl   string `yaml:"canary_url,omitempty"`
+	Canary      string `yaml:"-"`
+	Variant     string `yaml:"-"`
+
+	// BodySource generates a fresh request body stream for every check. It is only available when
+	// endpoints are configured from Go code and takes precedence over BodyFile and Body.
+	BodySource BodySource `yaml:"-"`
+
+	DNSFailure  string `yaml:"dns_failure,omitempty"`
+	DNSResolver string `yaml:"dns_resolver,omitempty"`
+	DualStack   bool   `yaml:"dual_stack,omitempty"`
+
+	// Netns is the network namespace, by name or path, and VRF the VRF device the endpoint's
+	// connections are opened in, on Linux.
+	Netns string `yaml:"netns,omitempty"`
+	VRF   string `yaml:"vrf,omitempty"`
+
+	// ProxyProtocol is the version of the PROXY protocol header sent at the start of the
+	// endpoint's connections, for targets behind load balancers requiring it.
+	ProxyProtocol string `yaml:"proxy_protocol,omitempty"`
+
+	// The options tuning the endpoint's HTTP client, see ClientOptions.
+	MaxIdleConns      int    `yaml:"max_idle_conns,omitempty"`
+	MaxConns          int    `yaml:"max_conns,omitempty"`
+	DisableKeepAlives bool   `yaml:"disable_keep_alives,omitempty"`
+	Proxy             string `yaml:"proxy,omitempty"`
+
+	// FollowRedirects disables following redirects when false, and MaxRedirects is the maximum
+	// number of redirects followed otherwise, see checkRedirect. MaxRedirectLatency is the budget
+	// of the time spent on redirects, see judgeRedirects.
+	FollowRedirects    *bool         `yaml:"follow_redirects,omitempty"`
+	MaxRedirects       int           `yaml:"max_redirects,omitempty"`
+	MaxRedirectLatency time.Duration `yaml:"max_redirect_latency,omitempty"`
+
+	// RateLimited is the policy for 429 responses, and RateLimitedUntil the time until which
+	// checks are skipped after a rate-limited response under the unknown policy.
+	RateLimited      string    `yaml:"rate_limited,omitempty"`
+	RateLimitedUntil time.Time `yaml:"-"`
+
+	MaxBodySize int64 `yaml:"max_body_size,omitempty"`
+
+	// BodyReadLimit stops reading response bodies after that many decompressed bytes, so the rest
+	// of large responses isn't downloaded. Unlike MaxBodySize, longer bodies aren't a failure.
+	BodyReadLimit int64 `yaml:"body_read_limit,omitempty"`
+
+	// Timeout is the time after which a check of the endpoint is cancelled and down, and
+	// MaxLatency the latency above which a successful check is degraded. Both default to the
+	// max_latency setting, see checkTimeout.
+	Timeout    time.Duration `yaml:"timeout,omitempty"`
+	MaxLatency time.Duration `yaml:"max_latency,omitempty"`
+
+	// Retries is the number of times a check failing for a transient reason is retried within its
+	// cycle, waiting RetryDelay before the first retry and twice as long before every next one.
+	Retries    int           `yaml:"retries,omitempty"`
+	RetryDelay time.Duration `yaml:"retry_delay,omitempty"`
+
+	// PreferHead checks the endpoint with HEAD instead of GET when nothing is read from the
+	// response body, until the endpoint rejects HEAD and HeadRejected is set.
+	PreferHead   bool `yaml:"prefer_head,omitempty"`
+	HeadRejected bool `yaml:"-"`
+
+	// BandwidthHead and BandwidthSkip are set by ApplyBandwidthCaps while the bandwidth cap of the
+	// endpoint's domain is exceeded, to check the endpoint with HEAD or to skip its check.
+	BandwidthHead    bool `yaml:"-"`
+	BandwidthSkip    bool `yaml:"-"`
+	bandwidth_cycles int  `yaml:"-"`
+
+	// AutoLatency judges the latency of successful checks against a Baseline learned from the
+	// first AutoLatencyWarmup successful checks, see LatencyBaseline.
+	AutoLatency       bool             `yaml:"auto_latency,omitempty"`
+	AutoLatencyWarmup int              `yaml:"auto_latency_warmup,omitempty"`
+	Baseline          *LatencyBaseline `yaml:"-"`
+
+	ExpectContinue        bool          `yaml:"expect_continue,omitempty"`
+	ExpectContinueTimeout time.Duration `yaml:"expect_continue_timeout,omitempty"`
+	ExpectInterim         int           `yaml:"expect_interim,omitempty"`
+
+	// SuccessWhen is a Predicate expression replacing the default status code check. It is
+	// compiled into Predicate by CreateNewTargets.
+	SuccessWhen string     `yaml:"success_when,omitempty"`
+	Predicate   *Predicate `yaml:"-"`
+
+	// DegradedWhen is a Predicate expression marking successful checks degraded, such as slow
+	// or warning responses. It is compiled into DegradedPredicate by CreateNewTargets.
+	DegradedWhen      string     `yaml:"degraded_when,omitempty"`
+	DegradedPredicate *Predicate `yaml:"-"`
+
+	// ExpectBodyContains and ExpectBodyRegex are asserted on the body of successful responses, so
+	// error pages served with a 200 status mark the endpoint down. ExpectBodyRegex is compiled
+	// into BodyRegex by CreateNewTargets.
+	ExpectBodyContains string         `yaml:"expect_body_contains,omitempty"`
+	ExpectBodyRegex    string         `yaml:"expect_body_regex,omitempty"`
+	BodyRegex          *regexp.Regexp `yaml:"-"`
+
+	// ExpectJSON are assertions on the values of JSON response bodies, such as $.status == "ok",
+	// which must all be satisfied, see JSONAssertion. They are compiled into JSONAssertions by
+	// CreateNewTargets.
+	ExpectJSON     []string         `yaml:"expect_json,omitempty"`
+	JSONAssertions []*JSONAssertion `yaml:"-"`
+
+	// Template is the request precompiled by CreateNewTargets, cloned for every check.
+	Template *RequestTemplate `yaml:"-"`
+
+	// DownAfter is the number of consecutive failed checks after which the endpoint's State
+	// moves from DEGRADED to DOWN, and ErrorHistory the number of recent errors it keeps.
+	DownAfter    int            `yaml:"down_after,omitempty"`
+	ErrorHistory int            `yaml:"error_history,omitempty"`
+	State        *EndpointState `yaml:"-"`
+
+	// AbandonAfter is how long the endpoint must stay DOWN before its checks are paused, see
+	// AbandonEndpoints. Endpoints are never abandoned when zero.
+	AbandonAfter time.Duration `yaml:"abandon_after,omitempty"`
+
+	// Schedule counts the checks of the endpoint that were made on time, delayed or skipped.
+	Schedule *ScheduleStats `yaml:"-"`
+
+	// AlertStatusChange reports every change of the status code or redirect target of the
+	// endpoint's responses between two checks, see StatusChanges.
+	AlertStatusChange bool `yaml:"alert_status_change,omitempty"`
+
+	// Runbook is a link to the endpoint's runbook, included in outage issues.
+	Runbook string `yaml:"runbook,omitempty"`
+
+	// Owner is the team, email address or Slack channel owning the endpoint, included in outage
+	// issues and routing its outage emails.
+	Owner string `yaml:"owner,omitempty"`
+
+	// Labels are free-form key-value pairs, such as the team, env or tier of the endpoint, carried
+	// through to its events, metrics, outage issues and status, see validateLabels.
+	Labels map[string]string `yaml:"labels,omitempty"`
+
+	Domain *Domain `yaml:"-"`
 }
 
+// BodySource is a function returning a new stream for a request body. The stream is closed once
+// the request has been sent.
+type BodySource func() (io.ReadCloser, error)
+
 // Endpoints is a slice of the Endpoint object used to unmarshal endpoint configuration from a
 // provided YAML file.
 type Endpoints []Endpoint
@@ -105,16 +1166,258 @@ type Domain struct {
 	Name          string
 	UpCount       int
 	TotalRequests int
-	Next          *Domain
+	UnknownCount  int
+
+	// DegradedCount is the number of degraded checks, also counted in UpCount.
+	DegradedCount int
+	Families      map[string]*FamilyStats
+
+	// Fallback keeps the statistics of the fallback checks of the domain's endpoints.
+	Fallback *FallbackStats
+
+	// Latency keeps the latencies of the recent checks of the domain's endpoints.
+	Latency *LatencyStats
+
+	// Periods keeps the statistics of the current calendar period of each of the
+	// availability_periods, by period, see UpdatePeriodStats.
+	Periods map[string]*PeriodStats
+
+	// BytesSent and BytesReceived are the approximate bytes transferred by the checks of the
+	// domain's endpoints, see ApplyBandwidthCaps.
+	BytesSent          int64
+	BytesReceived      int64
+	window_start       time.Time
+	window_base        int64
+	bandwidth_exceeded bool
+
+	Next *Domain
 }
 
 // HealthCheckTargets is the primary object for performing healthchecks. It contains a pointer to
-// the head of a linked list for both the Domain and a pointer to the Endpoints object.
+// the head of a linked list for both the Domain and a pointer to the Endpoints object, along with
+// the Settings controlling how results are reported, the Sinks events are written to and the
+// Metrics published when the listen setting is provided.
 type HealthCheckTargets struct {
 	Domains   *Domain
 	Endpoints *Endpoints
+	Settings  Settings
+	Sinks     []*BatchSink
+	Notifiers []*OutageNotifier
+	Signer    *EventSigner
+	Metrics   *Metrics
+
+	// History exports the results of every check when parquet_dir is set.
+	History *ParquetExporter
+
+	// SQLite appends the results of every check to a database when sqlite_file is set.
+	SQLite *SQLiteHistory
+
+	// Reloads receives the configurations reloaded while running, see WatchReloads.
+	Reloads <-chan Config
+
+	// Source is the configuration file the targets were created from, archived when a reload
+	// replaces it, see AuditReload.
+	Source ConfigSource
+
+	// Skipped are the invalid endpoints of the configuration that aren't checked, see
+	// SkippedEndpoint.
+	Skipped []SkippedEndpoint
+
+	// Loop tracks the cycles of RunCheckHealth for /healthz and /readyz.
+	Loop *CheckLoop
+
+	// Run records the results and outages of the run for the report written with report_file.
+	Run *RunRecorder
+
+	// MaxCycles bounds the number of cycles of RunCheckHealth, 1 with -once. Unbounded when zero.
+	MaxCycles int
+
+	// Heatmap accumulates the latencies of the endpoints by hour of the week for /api/v1/heatmap.
+	Heatmap *LatencyHeatmap
+}
+
+// Config is the program configuration returned by GetConfig. It contains the endpoints to check
+// and the settings provided in the configuration file or on the command line.
+//
+// The configuration file is either a plain list of endpoints or a mapping containing the settings
+// and an endpoints list.
+type Config struct {
+	Settings  `yaml:",inline"`
+	Endpoints Endpoints `yaml:"endpoints"`
+
+	// Source is the configuration file the Config was loaded from by LoadConfig.
+	Source ConfigSource `yaml:"-"`
+
+	// Skipped are the invalid endpoints removed from Endpoints under SkipInvalidEndpoints.
+	Skipped []SkippedEndpoint `yaml:"-"`
+
+	// NextConfig is the pending configuration file set with -next-config, preloaded by
+	// LoadNextConfig and swapped to at runtime, see WatchReloads. args are the command line
+	// arguments the Config was loaded from, and next_args those loading NextConfig.
+	NextConfig string   `yaml:"-"`
+	args       []string `yaml:"-"`
+	next_args  []string `yaml:"-"`
+
+	// Once and Duration bound the run to a single cycle, or to the cycles started within Duration,
+	// set with -once and -duration. The program then exits with status 1 when the run failed, see
+	// RunReport.
+	Once     bool          `yaml:"-"`
+	Duration time.Duration `yaml:"-"`
+}
+
+// Settings holds the program-wide options controlling how endpoints are checked and reported.
+type Settings struct {
+	// Output is the console output format, either OutputText, OutputJSON or OutputJUnit.
+	Output string `yaml:"output,omitempty"`
+
+	// Interval is the time between the start of two check cycles and MaxLatency the latency above
+	// which an endpoint is considered down. They default to DefaultCheckInterval and
+	// DefaultMaxLatency.
+	Interval   time.Duration `yaml:"interval,omitempty"`
+	MaxLatency time.Duration `yaml:"max_latency,omitempty"`
+
+	// Sinks are the destinations events are written to in addition to the console.
+	Sinks []SinkConfig `yaml:"sinks,omitempty"`
+
+	// Notifiers open issues in issue trackers for sustained outages.
+	Notifiers []NotifierConfig `yaml:"notifiers,omitempty"`
+
+	// DNSFailure and DNSResolver are the defaults for endpoints that don't set their own DNS
+	// failure policy or secondary resolver.
+	DNSFailure  string `yaml:"dns_failure,omitempty"`
+	DNSResolver string `yaml:"dns_resolver,omitempty"`
+
+	// Netns and VRF are the default network namespace and VRF device for endpoints that don't set
+	// their own.
+	Netns string `yaml:"netns,omitempty"`
+	VRF   string `yaml:"vrf,omitempty"`
+
+	// RateLimited is the default policy for 429 responses of endpoints that don't set their own.
+	RateLimited string `yaml:"rate_limited,omitempty"`
+
+	// MaxBodySize is the default maximum decompressed response body size, in bytes, for endpoints
+	// that don't set their own.
+	MaxBodySize int64 `yaml:"max_body_size,omitempty"`
+
+	// PreferHead checks every HTTP endpoint using GET with HEAD, like its own prefer_head, and
+	// BodyReadLimit is the default body_read_limit for endpoints that don't set their own.
+	PreferHead    bool  `yaml:"prefer_head,omitempty"`
+	BodyReadLimit int64 `yaml:"body_read_limit,omitempty"`
+
+	// AutoLatency enables the auto_latency mode of every endpoint, learning its baseline from
+	// AutoLatencyWarmup successful checks for endpoints that don't set their own.
+	AutoLatency       bool `yaml:"auto_latency,omitempty"`
+	AutoLatencyWarmup int  `yaml:"auto_latency_warmup,omitempty"`
+
+	// Concurrency is the number of workers checking endpoints concurrently, or ConcurrencyAuto to
+	// tune it between ConcurrencyMin and ConcurrencyMax. Endpoints are checked in series when empty.
+	Concurrency    string `yaml:"concurrency,omitempty"`
+	ConcurrencyMin int    `yaml:"concurrency_min,omitempty"`
+	ConcurrencyMax int    `yaml:"concurrency_max,omitempty"`
+
+	// Align starts cycles on wall-clock boundaries that are multiples of the interval, so results
+	// of multiple instances are comparable.
+	Align bool `yaml:"align,omitempty"`
+
+	// CheckTypes are the options of each type of endpoint check, by type, isolating the checks of
+	// every type in a pool of workers of their own, see CheckTypeSettings.
+	CheckTypes map[string]CheckTypeSettings `yaml:"check_types,omitempty"`
+
+	// SigningKey is the path of an ed25519 private key used to sign exported events.
+	SigningKey string `yaml:"signing_key,omitempty"`
+
+	// DownAfter is the default number of consecutive failed checks after which endpoints that
+	// don't set their own are DOWN.
+	DownAfter int `yaml:"down_after,omitempty"`
+
+	// ErrorHistory is the default number of recent errors kept per endpoint for endpoints that
+	// don't set their own.
+	ErrorHistory int `yaml:"error_history,omitempty"`
+
+	// AbandonAfter is the default abandon_after of the endpoints that don't set their own.
+	AbandonAfter time.Duration `yaml:"abandon_after,omitempty"`
+
+	// AlertStatusChange enables the alert_status_change of every endpoint.
+	AlertStatusChange bool `yaml:"alert_status_change,omitempty"`
+
+	// AlertDampening is the default dampening window of the notifiers, coalescing the outages of
+	// the endpoints going DOWN together into a single issue, see OutageNotifier.
+	AlertDampening time.Duration `yaml:"alert_dampening,omitempty"`
+
+	// Listen is the address of the HTTP server publishing Prometheus metrics on /metrics. The
+	// server isn't started when empty.
+	Listen string `yaml:"listen,omitempty"`
+
+	// Environments are the base URLs of the environments, by name, that endpoints declaring a
+	// path are expanded into. Env selects the environments to check, separated by commas, or all
+	// of them when empty.
+	Environments map[string]string `yaml:"environments,omitempty"`
+	Env          string            `yaml:"env,omitempty"`
+
+	// BandwidthCaps are the maximum bytes, by domain, the checks of a domain's endpoints may
+	// transfer per BandwidthWindow, after which BandwidthExceeded is applied to them.
+	BandwidthCaps     map[string]int64 `yaml:"bandwidth_caps,omitempty"`
+	BandwidthWindow   time.Duration    `yaml:"bandwidth_window,omitempty"`
+	BandwidthExceeded string           `yaml:"bandwidth_exceeded,omitempty"`
+
+	// StateFile is the path of the file the domain statistics are saved to after every cycle and
+	// restored from on startup, so cumulative availability survives restarts.
+	StateFile string `yaml:"state_file,omitempty"`
+
+	// ReportFile is the path of the file the report of the run is written to on termination, in
+	// ReportFormat, see RunReport.
+	ReportFile   string `yaml:"report_file,omitempty"`
+	ReportFormat string `yaml:"report_format,omitempty"`
+
+	// LogLevel is the least severe level of the messages logged, and LogFormat their format, text
+	// or JSON lines, see ConfigureLogging.
+	LogLevel  string `yaml:"log_level,omitempty"`
+	LogFormat string `yaml:"log_format,omitempty"`
+
+	// DerivedMetrics are aggregated over the results of their endpoints every cycle and emitted
+	// to the sinks.
+	DerivedMetrics []DerivedMetricConfig `yaml:"derived_metrics,omitempty"`
+
+	// LatencyWindows are the periods, such as 5m and 1h, over which the latency percentiles of
+	// every domain are computed in addition to its last LatencySamples checks.
+	LatencyWindows []time.Duration `yaml:"latency_windows,omitempty"`
+
+	// AvailabilityPeriods are the calendar periods, such as day or month, over which the
+	// availability of every domain is reported in addition to the lifetime of the process, delimited
+	// in the AvailabilityTimezone, UTC by default.
+	AvailabilityPeriods  []string `yaml:"availability_periods,omitempty"`
+	AvailabilityTimezone string   `yaml:"availability_timezone,omitempty"`
+
+	// ConfigBackupDir is the directory the configuration file replaced by a reload is archived
+	// to, see AuditReload.
+	ConfigBackupDir string `yaml:"config_backup_dir,omitempty"`
+
+	// ParquetDir is the directory the check history is exported to, see ParquetExporter.
+	ParquetDir string `yaml:"parquet_dir,omitempty"`
+
+	// SQLiteFile is the SQLite database the check history is appended to, see SQLiteHistory.
+	SQLiteFile string `yaml:"sqlite_file,omitempty"`
+
+	// SkipInvalidEndpoints skips the endpoints with invalid options with a warning, instead of
+	// refusing the whole configuration, see validateEndpoints.
+	SkipInvalidEndpoints bool `yaml:"skip_invalid_endpoints,omitempty"`
+
+	// StrictIntegrations refuses to start when the metrics server, the Parquet or SQLite history, a
+	// sink or a notifier fails to initialize, instead of retrying it in the background, see
+	// OpenIntegrations.
+	StrictIntegrations bool `yaml:"strict_integrations,omitempty"`
 }
 
+// OutputText, OutputJSON and OutputJUnit are the supported console output formats. OutputText
+// prints a human readable availability line per domain. OutputJSON prints one versioned JSON event
+// per line, see ResultSchemaVersion. OutputJUnit prints nothing while running, and the JUnit XML
+// report of the run when the program is terminated, see LogRunReport.
+const (
+	OutputText  string = "text"
+	OutputJSON  string = "json"
+	OutputJUnit string = "junit"
+)
+
 // EndpointUp and EndpointDown are boolean aliases used to with UpdateDomainStats to update whether
 // an endpoint in a domain is up or down.
 const (
@@ -125,13 +1428,83 @@ const (
 // Usage provides help text if an error is encountered while running GetConfig. Upon failure, the
 // usage text will be displayed along with the error.
 const Usage string = `
-USAGE: (MacOS/Linux) checkhealth file
-       (Windows)     checkhealth.exe file
+USAGE: (MacOS/Linux) checkhealth [-output format] [-interval duration] [-max-latency duration]
+                     [-listen address] [-env names] [-state-file file] [-format format]
+                     [-skip-invalid] [-report file] [-log-level level]
+                     [-log-format format] [-once] [-duration duration] file
+       (Windows)     checkhealth.exe [-output format] [-interval duration] [-max-latency duration]
+                     [-listen address] [-env names] [-state-file file] [-format format]
+                     [-skip-invalid] [-report file] [-log-level level]
+                     [-log-format format] [-once] [-duration duration] file
+
+       (MacOS/Linux) checkhealth demo [-addr address] [-config file]
+       (Windows)     checkhealth.exe demo [-addr address] [-config file]
+
+       (MacOS/Linux) checkhealth version [-json]
+       (Windows)     checkhealth.exe version [-json]
+
+       (MacOS/Linux) checkhealth verify -key public_key [file ...]
+       (Windows)     checkhealth.exe verify -key public_key [file ...]
+
+       (MacOS/Linux) checkhealth schema
+       (Windows)     checkhealth.exe schema
+
+       (MacOS/Linux) checkhealth check-config [flags] file
+       (Windows)     checkhealth.exe check-config [flags] file
+
+       (MacOS/Linux) checkhealth init [-template name] [-force] [-list] [file]
+       (Windows)     checkhealth.exe init [-template name] [-force] [-list] [file]
 
 REQUIRED ARGUMENT:
 
 	file
-		file should be the relative or absolute path to an endpoint yaml configuration file.
+		file should be the relative or absolute path to an endpoint configuration file in YAML,
+		JSON or TOML.
+
+OPTIONAL FLAGS:
+
+	-output format
+		The console output format, either "text" (default), "json" or "junit".
+
+	-once
+		Checks the endpoints once and exits, with status 1 when an endpoint check failed.
+
+	-duration duration
+		Checks the endpoints for the duration and exits like -once.
+
+	-interval duration
+		The time between the start of two check cycles. Defaults to 15s.
+
+	-max-latency duration
+		The latency above which an endpoint is labeled as down. Defaults to 500ms.
+
+	-listen address
+		Starts an HTTP server on the address publishing Prometheus metrics on /metrics and a
+		dashboard on /.
+
+	-env names
+		The environments to check, separated by commas. All environments by default.
+
+	-state-file file
+		Saves the domain statistics to the file after every cycle and restores them on startup.
+
+	-format format
+		The format of the configuration file, "yaml", "json" or "toml". Detected by extension.
+
+	-skip-invalid
+		Skips the invalid endpoints of the configuration with a warning instead of failing.
+
+	-next-config file
+		A pending configuration file, validated on startup and swapped to on SIGUSR2.
+
+	-report file
+		Writes a report of the run to the file, as JSON or JUnit XML, on termination.
+
+	-log-level level
+		The level of the messages logged, "debug", "info", "warn" or "error". Defaults to info.
+
+	-log-format format
+		The format of the messages logged, "text" or "json". Defaults to text.
 `
 
 // UsageConfig provides help text for the format required for the configuration file. It is
@@ -139,25 +1512,318 @@ REQUIRED ARGUMENT:
 const UsageConfig string = `
 CONFIGURATION FILE:
 
-	The configuration file defines a list of endpoints to query in YAML. It has the following
-	schema:
+	The configuration file defines a list of endpoints to query in YAML. Files larger than 4 MiB,
+	nested deeper than 32 levels or expanding to more than 1048576 values are rejected. Before
+	starting, every problem of the file is reported with its line: unknown or duplicate fields,
+	missing names and urls, invalid urls and methods, and duplicate names. JSON and TOML files
+	follow the same schema, where a TOML file declares its endpoints as [[endpoints]] tables and
+	its problems are reported without lines. It has the following schema:
 		name (string, required)
-			A free-text description of the endpoint.
+			A free-text description of the endpoint. Names must be unique.
+
+		url (string, required unless path or baseline_url and canary_url are set)
+			The URL of the HTTP endpoint, an absolute http:// or https:// URL. IPv6 literals
+			must be enclosed in brackets, e.g. http://[::1]:8080/health.
+
+		group (string, optional)
+			The name of the domain the endpoint is aggregated into, instead of the host of its
+			URL, so "fetch.com" and "www.fetch.com", or the regions of a service, are reported
+			as one domain.
 
-		url (string, required)
-			The URL of the HTTP endpoint. It is assumed to be valid.
+		hosts (list, optional)
+			Expands the entry into one endpoint per host, with the host of the URL replaced
+			and the host appended to the name. Hosts without a port keep the port of the URL, and
+			bare IPv6 addresses, e.g. 2001:db8::1, are enclosed in brackets.
+
+		path (string, optional)
+			A path relative to the base URL of the environments, used instead of url. The
+			entry is expanded into one endpoint per environment, with the environment
+			appended to the name.
+
+		environments (list, optional)
+			The environments a path applies to. Defaults to every environment.
+
+		baseline_url, canary_url (string, optional)
+			The URLs of the baseline and the canary of a progressive rollout, used instead of
+			url. The entry is expanded into a baseline and a canary endpoint, with the variant
+			appended to the name, and every cycle the availability and latency of the recent
+			checks of the canary are compared with those of the baseline. See CANARY
+			COMPARISON.
 
 		method (string, optional)
-			The HTTP method to use. If not provided, the GET method is used. It is assumed a
-			valid method is provided.
+			The HTTP method to use, in upper case for the standard methods. If not provided,
+			the GET method is used.
 
 		headers (dictionary, optional)
 			The HTTP headers to add or modify the default HTTP client request. It is assumed
 			that these are valid.
 
+		auth (mapping, optional)
+			The credentials sent in the Authorization header of HTTP and gRPC endpoints,
+			instead of a hand-crafted header.
+				type (string, required)
+					"basic" for HTTP basic authentication, or "bearer" for a token.
+				username (string, required for basic)
+					The user of basic authentication.
+				password, password_env, password_file (string)
+					The password of basic authentication, set inline, or read from an
+					environment variable or a file when the configuration is loaded.
+				token, token_env, token_file (string)
+					The bearer token, set inline, or read from an environment variable
+					or a file when the configuration is loaded.
+
 		body (string, optional)
-			A JSON-encoded string to be sent in the request. If not provided, no body is sent
-			in the request.
+			A string to be sent in the request, e.g. JSON or XML, with its type set by a
+			content-type header. If not provided, no body is sent in the request.
+
+		body_file (string, optional)
+			The path of a file streamed as the request body on every check, instead of body.
+			It is not loaded into memory, so it can be used for large or binary uploads. The
+			content type is inferred from the extension of the file unless a content-type
+			header is set.
+
+		success_when (string, optional)
+			An expression deciding whether a check succeeded, replacing the default status
+			code check for complex endpoints. Comparisons of the status, the latency, a
+			header["Name"] or the body are combined with and, or, not and parentheses:
+				status == 200 and latency < 300ms and body contains "ok"
+			status and latency support ==, !=, <, <=, > and >=. header and body support ==,
+			!=, contains and matches (a regular expression) with double quoted strings.
+
+		degraded_when (string, optional)
+			An expression in the success_when syntax marking successful checks degraded,
+			still counted as available, e.g. header["Warning"] != "" or latency > 1s. HTTP
+			endpoints only.
+
+		prefer_head (boolean, optional)
+			Check the endpoint with HEAD instead of GET to reduce bandwidth, unless the body
+			is asserted on. Targets rejecting HEAD (405 or 501) are checked with GET again
+			within the same check, and with GET only from then on.
+
+		expect_body_contains (string, optional)
+			A string the response body must contain, so error pages served with a 200 status
+			mark the endpoint down.
+
+		expect_body_regex (string, optional)
+			A regular expression the response body must match.
+
+		expect_json (list of strings, optional)
+			Assertions the JSON response body must all satisfy, for APIs embedding their
+			status in a 200 response, e.g. $.status == "ok" or $.replicas >= 2. Paths start
+			with $ followed by .name, ["name"] or [index]. == and != compare any JSON value,
+			and <, <=, > and >= numbers. A missing path fails the assertion.
+
+		type (string, optional)
+			"http" checks the endpoint with an HTTP request (default). "grpc" calls the
+			grpc.health.v1.Health/Check RPC of the gRPC server at url (https:// for TLS,
+			http:// for plaintext), and the endpoint is only up when the service is SERVING.
+			"ssh" connects to the ssh://user@host[:port] url with key authentication and runs
+			ssh_command, and the endpoint is only up when it exits with status 0. Its output is
+			evaluated as the body by success_when and the body assertions, and its exit status
+			as the status. "ftp" and "sftp" log in to the ftp://[user@]host[:port] or
+			sftp://user@host[:port] url, SFTP with the SSH options of "ssh". "dns" looks up the
+			record_type records of the dns://name url, which are evaluated as the body by the
+			body assertions, one per line. "raw-tcp" connects to the tcp://host:port url, sends
+			send or send_hex, and reads the response until it starts with expect_prefix or
+			expect_prefix_hex and satisfies the body assertions, within the timeout.
+
+		grpc_service (string, optional)
+			The service checked by a gRPC endpoint. Defaults to the overall server health.
+
+		tls_ca_file, tls_server_name, tls_insecure_skip_verify (optional)
+			The PEM file of the certificate authorities trusted, the name verified in the
+			server certificate, and whether verification is skipped, for HTTPS and gRPC
+			endpoints, e.g. internal endpoints with self-signed certificates. HTTPS endpoints
+			send the name as SNI, so servers can be checked by IP address before a DNS
+			cutover. Skipping verification is logged as a warning.
+
+		tls_client_cert, tls_client_key (string, optional)
+			The PEM files of the client certificate and key presented by HTTPS and gRPC
+			endpoints to servers requiring mutual TLS. They are read again when they change,
+			so rotated certificates are picked up without a restart.
+
+		tls_accept_names (list, optional)
+			Names the server certificate may be valid for instead of the name verified, for
+			HTTPS and gRPC endpoints with a known hostname mismatch. The rest of the
+			verification still applies, and every certificate accepted this way is logged
+			as a warning.
+
+		ssh_command, ssh_key_file (string, required for SSH endpoints)
+			The command run by an SSH endpoint, and the private key it authenticates with.
+
+		ssh_passphrase_env, ssh_known_hosts, ssh_insecure_ignore_host_key (optional)
+			The environment variable holding the passphrase of the key, the known hosts file
+			verifying the host key (defaults to ~/.ssh/known_hosts), and whether the host key
+			isn't verified, for SSH and SFTP endpoints.
+
+		password_env (string, optional)
+			The environment variable holding the password of an FTP endpoint. FTP endpoints
+			without a user log in anonymously.
+
+		list_directory, stat_file (string, optional)
+			A directory listed and a file stat'ed by an FTP or SFTP endpoint after logging in.
+			The names listed are evaluated as the body by the body assertions.
+
+		record_type (string, optional)
+			The records looked up by a DNS endpoint: A (default), AAAA, CNAME, TXT, MX, NS or
+			CAA.
+
+		expect_records ([]string, optional)
+			Records a DNS endpoint must return, e.g. "10 mx1.example.com" for MX records.
+			Names are compared case-insensitively and without their trailing dot.
+
+		expect_records_ordered (boolean, optional)
+			Whether expect_records must be returned in the same order, e.g. by MX preference.
+
+		send, send_hex (string, optional)
+			The bytes sent by a raw TCP endpoint once connected, as a string or in
+			hexadecimal, e.g. "0d 0a". Nothing is sent by default, e.g. to read a banner.
+
+		expect_prefix, expect_prefix_hex (string, optional)
+			The bytes the response of a raw TCP endpoint must start with, as a string or in
+			hexadecimal.
+
+		runbook (string, optional)
+			A link to the endpoint's runbook, included in issues opened by notifiers.
+
+		owner (string, optional)
+			The team, email address or Slack channel owning the endpoint, included in issues
+			opened by notifiers. Outage emails are sent to an owner that is an email address,
+			or to the recipients of the owner in the email notifier's owners.
+
+		labels (mapping, optional)
+			Free-form labels of the endpoint, e.g. team: payments, carried through to its
+			events, metrics, outage issues and state on /api/v1/endpoints. Names are letters,
+			digits and underscores, and can't start with __ nor be endpoint, url, state,
+			kind, le, phase or component.
+
+		down_after (integer, optional)
+			The number of consecutive failed checks after which the endpoint is DOWN. The
+			first failed check marks it DEGRADED. Defaults to 3.
+
+		error_history (integer, optional)
+			The number of recent errors kept for the endpoint and served on /errors when
+			-listen is provided. Defaults to 10, and a negative value disables it.
+
+		abandon_after (duration, optional)
+			How long the endpoint must stay DOWN before it is abandoned: its checks are
+			paused and recorded as unknown, its open issues are commented on and it doesn't
+			fail the run report, until the configuration is reloaded. Disabled by default.
+
+		alert_status_change (boolean, optional)
+			Reports every change of the status code of the endpoint's responses between two
+			checks, even within the success range, e.g. 200 to 204, and of where its redirects
+			point to, which often signals an unintended deploy or routing change. Checks
+			without a response are ignored. Changes are printed like state changes and emitted
+			as status_change events.
+
+		dns_failure (string, optional)
+			How DNS resolution failures are handled: "down" marks the endpoint down (default),
+			"retry" retries once with dns_resolver, "unknown" excludes the check from
+			availability. The "retry" policy can't be combined with proxy_protocol or the tls_
+			options, as the retry uses a client of its own, and the global "retry" policy
+			leaves these endpoints, and those setting netns or vrf, on "down".
+
+		dns_resolver (string, optional)
+			The secondary DNS server (host:port) used by the "retry" policy, and the server
+			queried by DNS endpoints.
+
+		netns (string, optional)
+			On Linux, the network namespace the endpoint is checked from, by name (as
+			created by "ip netns add") or path. Host names are resolved outside of it.
+
+		vrf (string, optional)
+			On Linux, the VRF device the endpoint's connections are bound to.
+
+		proxy_protocol (string, optional)
+			Sends a PROXY protocol header, "v1" (text) or "v2" (binary), at the start of the
+			connections of an HTTP or raw TCP endpoint, for targets behind load balancers
+			requiring it. Can't be combined with dual_stack, netns or vrf.
+
+		max_idle_conns, max_conns (integer, optional)
+			The maximum number of idle connections kept, and of connections opened, per host
+			by the endpoint's HTTP client. Defaults to 2 idle connections and no limit.
+
+		disable_keep_alives (boolean, optional)
+			Opens a new connection for every check.
+
+		follow_redirects (boolean, optional)
+			Whether redirects are followed (default). When false, redirect responses are
+			checked themselves, and mark the endpoint down unless success_when accepts them.
+
+		max_redirects (integer, optional)
+			The maximum number of redirects followed, 10 by default. Checks redirected more
+			times are down with the redirect error kind.
+
+		max_redirect_latency (duration, optional)
+			The budget of the time spent on the redirects followed by a check. Checks whose
+			redirects take longer are degraded with the redirect error kind, and max_latency
+			only applies to the final response.
+
+		proxy (string, optional)
+			The URL of the HTTP (or socks5://) proxy the endpoint's requests are sent through,
+			or "direct" to ignore the proxy of the environment (HTTP_PROXY, HTTPS_PROXY and
+			NO_PROXY), which is used by default. Every endpoint has an HTTP client of its own,
+			so these options don't affect other endpoints.
+
+		rate_limited (string, optional)
+			How rate-limited (429) responses are handled: "down" marks the endpoint down
+			(default), "degraded" counts it as available but marks it DEGRADED, "unknown"
+			excludes the check from availability and skips checks until the delay of the
+			Retry-After header has passed (1m without one, at most 1h).
+
+		dual_stack (boolean, optional)
+			When the host has both IPv4 and IPv6 addresses, check each address family
+			separately and report per-family availability. The endpoint is only up when every
+			family is up. Redirects to another host connect to the addresses of that host.
+
+		fallback_url (string, optional)
+			The failover target of the endpoint, checked right after a check of url is down,
+			with the same request and assertions and its own timeout, and reported with
+			its own availability. The endpoint stays down whatever the fallback's result.
+
+		max_body_size (integer, optional)
+			The maximum decompressed size of the response body in bytes. Larger responses,
+			such as decompression bombs, mark the endpoint down and are logged as a distinct
+			failure. Defaults to 10485760 (10MiB).
+
+		body_read_limit (integer, optional)
+			Stops reading the response body after that many decompressed bytes, without
+			failing the check, so the rest of large responses isn't downloaded. The body
+			assertions only see the bytes read.
+
+		timeout, max_latency (duration, optional)
+			The time after which a check of the endpoint is cancelled and marked down, and
+			the latency above which a successful check is marked degraded, so a slow but
+			working endpoint isn't killed mid-request. Both default to the max_latency
+			setting. max_latency must not exceed timeout, nor timeout the interval.
+
+		retries (integer, optional)
+			The number of times a check failing with a connection error, a timeout or a 502,
+			503 or 504 response is retried within the same cycle before the failure is
+			recorded, up to 10. Retries share the timeout of the check.
+				retry_delay (duration, optional)
+					The delay before the first retry, doubled before every next one, unless
+					the response has a Retry-After header. Defaults to 500ms.
+
+		auto_latency (boolean, optional)
+			Learn the endpoint's baseline latency, the median of its first successful checks,
+			and mark later checks slower than 3x the baseline degraded and slower than 10x
+			down. The timeout still applies.
+				auto_latency_warmup (integer, optional)
+					The number of successful checks the baseline is learned from. Defaults
+					to 20.
+
+		expect_continue (boolean, optional)
+			Sends "Expect: 100-continue" so the body is only sent once the server (or proxy)
+			has accepted the request headers.
+
+		expect_continue_timeout (duration, optional)
+			How long to wait for "100 Continue" before sending the body anyway. Defaults to 1s.
+
+		expect_interim (integer, optional)
+			An interim (1xx) status code, e.g. 100, that must be received before the final
+			response for the endpoint to be considered up.
 
 	Example:
 		- name: fetch.com some post endpoint
@@ -167,45 +1833,679 @@ CONFIGURATION FILE:
 		    content-type: application/json
 		    user-agent: fetch-synthetic-monitor
 		  body: '{"foo":"bar"}'
+
+	The list of endpoints can also be provided under the "endpoints" key of a mapping, next to
+	the following optional settings:
+		output (string, optional)
+			The console output format, either "text" (default), "json" or "junit". The
+			-output flag takes precedence.
+
+		interval, max_latency (duration, optional)
+			The time between the start of two check cycles and the latency above which an
+			endpoint is labeled as down, such as "30s" and "250ms". Default to 15s and 500ms.
+			The -interval and -max-latency flags take precedence. Endpoints can set their
+			own timeout and max_latency.
+
+		listen (string, optional)
+			The address of the HTTP server publishing Prometheus metrics. The -listen flag
+			takes precedence.
+
+		environments (mapping, optional)
+			The base URLs of the environments, by name, that endpoints with a path are
+			checked in.
+				env (string, optional)
+					The environments to check, separated by commas. All environments by
+					default. The -env flag takes precedence.
+
+		state_file (string, optional)
+			The file the domain statistics are saved to after every cycle and restored from
+			on startup. The -state-file flag takes precedence.
+
+		report_file (string, optional)
+			The file a report of the run is written to when the program is terminated, with
+			the checks, availability and outages of every endpoint since it started. The
+			-report flag takes precedence.
+				report_format (string, optional)
+					"json" or "junit" (JUnit XML, where endpoints that were DOWN fail).
+					Defaults to "junit" for files ending with .xml, "json" otherwise.
+
+		log_level (string, optional)
+			The least severe level of the messages logged to stderr, "debug", "info",
+			"warn" or "error". Defaults to "info". The -log-level flag takes precedence.
+
+		log_format (string, optional)
+			"text" or "json" (JSON lines). Defaults to "text". The -log-format flag takes
+			precedence.
+
+		bandwidth_caps (mapping, optional)
+			The maximum bytes the checks of a domain's endpoints may transfer per
+			bandwidth_window, by domain. The bytes transferred are approximate.
+				bandwidth_window (duration, optional)
+					The period the caps apply to. Defaults to 24h.
+				bandwidth_exceeded (string, optional)
+					What happens to the endpoints of a domain over its cap until the window
+					resets: "head" checks them with HEAD (default), "reduce" only checks
+					them every 4 cycles and records the skipped checks as unknown.
+
+		config_backup_dir (string, optional)
+			The directory the configuration file is archived to when a reload (SIGHUP)
+			replaces it with a different one. The last 20 archives are kept.
+
+		parquet_dir (string, optional)
+			The directory the result of every check is exported to, as Parquet files in
+			date=YYYY-MM-DD partitions for DuckDB, Spark or Athena. Results are written at
+			least every hour, when the day changes and on exit.
+
+		sqlite_file (string, optional)
+			The SQLite database the result of every check is appended to at the end of each
+			cycle, in the checks table, to compute the availability over any window with SQL.
+			Created if it doesn't exist. Rows can be deleted, the freed pages aren't reused. On
+			Windows, the database isn't locked against readers while a cycle is written.
+
+		skip_invalid_endpoints (boolean, optional)
+			Skips the endpoints with invalid options, logging a warning for each of them,
+			instead of refusing the configuration. Every invalid endpoint is reported either
+			way.
+
+		strict_integrations (boolean, optional)
+			Refuses to start when the metrics server, the parquet_dir or sqlite_file history,
+			a sink or a notifier fails to start. By default, the failure is logged as a warning and the
+			integration is started again every minute, so the endpoints are still checked.
+
+		latency_windows (list of durations, optional)
+			The periods, such as 5m and 1h, over which the p50, p95 and p99 latencies of
+			every domain are also computed, printed after its availability, reported in the
+			domain_availability events and published on /metrics.
+
+		availability_periods (list of strings, optional)
+			The calendar periods, "day", "week" (starting on Monday) or "month", over which
+			the availability of every domain is also computed, as SLAs are stated, printed
+			after its availability with the availability of the previous period, reported
+			in the domain_availability events and published on /metrics. The periods are
+			saved to the state file.
+				availability_timezone (string, optional)
+					The IANA time zone the periods start at midnight in, such as
+					"America/New_York". Defaults to UTC.
+
+		dns_failure, dns_resolver, netns, vrf, rate_limited, max_body_size, body_read_limit,
+		prefer_head, auto_latency, auto_latency_warmup, down_after, error_history,
+		abandon_after, alert_status_change (optional)
+			The defaults for endpoints that don't set their own. prefer_head only applies to
+			HTTP endpoints checked with GET, and netns and vrf to HTTP endpoints without
+			dual_stack, proxy_protocol or the retry DNS failure policy.
+
+		concurrency (integer or string, optional)
+			The number of endpoints checked concurrently. Endpoints are checked in series by
+			default. With "auto", the number of workers is adjusted after every cycle so
+			checks finish within half of the interval, and each adjustment is logged.
+				concurrency_min, concurrency_max (integer, optional)
+					The bounds of the auto mode. Default to 1 and 64.
+
+		check_types (mapping, optional)
+			Options by type of check, e.g. http, grpc or ssh. With check_types, the endpoints
+			of every type are checked in a pool of workers of their own, so slow checks of
+			one type can't starve the checks of the others.
+				concurrency (integer, optional)
+					The workers of the pool of the type. Defaults to the concurrency.
+				timeout, max_latency (duration, optional)
+					The defaults for the endpoints of the type that don't set their own.
+
+		align (boolean, optional)
+			Starts every cycle on a wall-clock boundary that is a multiple of the interval
+			(:00, :15, :30 and :45 seconds), so results of multiple instances are comparable
+			when aggregated. Cycles overrunning a boundary skip to the next one.
+
+		signing_key (string, optional)
+			The path of a PEM encoded ed25519 private key. Exported events are signed with it
+			so availability reports can be verified as untampered with the verify
+			subcommand.
+
+		sinks (list, optional)
+			Destinations events are written to in addition to the console. Events are
+			written asynchronously in batches, so a slow sink never delays the checks.
+				type (string, required)
+					The sink type. "file" appends JSON events to a file, "webhook"
+					posts them to a URL as a JSON array, "influx" writes them as
+					InfluxDB line protocol to the InfluxDB write API or to a file, and
+					"s3" and "gcs" upload snapshots of the availability of the domains
+					to a bucket.
+				path (string)
+					The file path used by the file and influx sinks.
+				url (string)
+					The URL the webhook sink posts events to, the InfluxDB write API
+					URL of the influx sink, with its org and bucket, or the endpoint of
+					an S3 compatible service for the s3 sink, e.g. MinIO.
+				secret_env (string, optional)
+					The environment variable holding the secret the webhook sink
+					signs events with, in the Checkhealth-Signature header, or the
+					secret key of the s3 and gcs sinks. Defaults to
+					AWS_SECRET_ACCESS_KEY and GCS_SECRET_ACCESS_KEY.
+				token_env (string, optional)
+					The environment variable holding the InfluxDB API token, or the
+					session token of the s3 sink. Defaults to AWS_SESSION_TOKEN for
+					the s3 sink.
+				bucket (string)
+					The bucket the s3 and gcs sinks upload snapshots to.
+				key (string, optional)
+					The key template of the snapshots, with the {year}, {month},
+					{day}, {hour}, {minute}, {timestamp} and {format} placeholders.
+					Defaults to
+					checkhealth/{year}/{month}/{day}/availability-{timestamp}.{format}.
+				region (string, optional)
+					The region of the bucket. Defaults to us-east-1 for s3 and auto
+					for gcs.
+				format (string, optional)
+					The snapshot format, "json", "csv" or "parquet". Defaults to json.
+				upload_interval (duration, optional)
+					Time between two snapshots. Defaults to 15m.
+				access_key_env (string, optional)
+					The environment variable holding the access key of the s3 and gcs
+					sinks. Defaults to AWS_ACCESS_KEY_ID and GCS_ACCESS_KEY_ID.
+				results (boolean, optional)
+					Also writes a check_result event for every check.
+				batch_size (integer, optional)
+					Events per write. Defaults to 100.
+				flush_interval (duration, optional)
+					Maximum time events wait before being written. Defaults to 10s.
+				queue_size (integer, optional)
+					Events buffered while the sink is busy, after which new events are
+					dropped. Defaults to 10000.
+				circuit_breaker (mapping, optional)
+					failure_threshold consecutive failed writes (default 5) open the
+					breaker, dropping batches without contacting the sink until
+					cooldown (default 1m) has elapsed.
+
+		alert_dampening (duration, optional)
+			The default dampening of the notifiers. Disabled by default.
+
+		notifiers (list, optional)
+			Issue trackers in which an issue is opened when an endpoint stays DOWN for
+			longer than after, and commented on and closed once it is UP again, or email
+			recipients notified of the outage and its recovery.
+				type (string, required)
+					The notifier type, "github", "jira" or "email".
+				after (duration, optional)
+					How long an endpoint must be DOWN. Defaults to 5m.
+				dampening (duration, optional)
+					How long to wait, once an endpoint has been DOWN for after, for other
+					endpoints to go DOWN, such as during a whole-domain outage, so they
+					are all listed in a single issue closed once they are all UP again.
+					Defaults to alert_dampening.
+				url (string)
+					The API base URL. Defaults to https://api.github.com for github. For
+					email, the SMTP server as smtp://host[:port] (STARTTLS when offered,
+					port 587 by default) or smtps://host[:port] (TLS, port 465).
+				token_env (string, optional)
+					The environment variable holding the API token, or the SMTP password.
+					Defaults to GITHUB_TOKEN, JIRA_API_TOKEN or SMTP_PASSWORD.
+				repository (string)
+					The github repository, as owner/name.
+				project, issue_type, user, close_transition (string)
+					The jira project key, the issue type (default Bug), the user for
+					basic authentication (bearer authentication when not set) and the
+					transition resolving tickets (default Done).
+				labels (list, optional)
+					Labels added to the issues.
+				from, to (string and list)
+					The sender and recipients of the email notifier. Its user, when set,
+					authenticates with the password of token_env.
+				owners (mapping, optional)
+					The recipients of the outage emails of each endpoint owner, instead of
+					to.
+				require_tls, tls_insecure_skip_verify (boolean, optional)
+					Whether email isn't sent without STARTTLS, and whether the certificate
+					of the SMTP server isn't verified.
+				circuit_breaker (mapping, optional)
+					As for sinks.
+
+		derived_metrics (list, optional)
+			Metrics aggregated every cycle over the checks of a set of endpoints, emitted to
+			the sinks as derived_metric events. Unknown checks are ignored.
+				name (string, required)
+					The name of the metric.
+				aggregate (string, required)
+					"down_ratio" (between 0 and 1) or "down_count" of the checks that were
+					down, or "max_latency" or "mean_latency" of the checks, in
+					milliseconds.
+				endpoints, owner, domain (string, optional)
+					A regular expression matched against the endpoint names, and the
+					owner and domain of the endpoints aggregated. Every endpoint by
+					default.
+
+	Example:
+		output: json
+		sinks:
+		  - type: file
+		    path: results.jsonl
+		    flush_interval: 30s
+		endpoints:
+		  - name: fetch.com index page
+		    url: https://fetch.com/
 `
 
 // GetConfig checks for command line arguments passed when executing the program and validates that
 // a valid endpoint YAML configuration file was provided. If invalid, the function will return
 // early with an error containing usage details for the CheckHealth program.
 //
-// Note: It is assumed that the full configuration file is small enough to be safely loaded entirely
-// in memory.
-func GetConfig() (Endpoints, error) {
-	// read CLI arguments to get config file
-	if len(os.Args) != 2 {
+// Optional flags (e.g. -output) must be provided before the file argument.
+//
+// The configuration file is loaded entirely in memory and parsed with ParseConfig, which rejects
+// files larger than MaxConfigSize.
+func GetConfig() (Config, error) {
+	return LoadConfig(os.Args[1:])
+}
+
+// LoadConfig is GetConfig for the provided command line arguments, without the program name. It
+// is shared by the subcommands accepting the flags and file argument of the program.
+func LoadConfig(args []string) (Config, error) {
+	// read CLI flags and arguments to get settings and the config file
+	flags := flag.NewFlagSet("checkhealth", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	output := flags.String("output", "", "")
+	interval := flags.Duration("interval", 0, "")
+	max_latency := flags.Duration("max-latency", 0, "")
+	listen := flags.String("listen", "", "")
+	env := flags.String("env", "", "")
+	state_file := flags.String("state-file", "", "")
+	config_format := flags.String("format", "", "")
+	skip_invalid := flags.Bool("skip-invalid", false, "")
+	next_config := flags.String("next-config", "", "")
+	report := flags.String("report", "", "")
+	log_level := flags.String("log-level", "", "")
+	log_format := flags.String("log-format", "", "")
+	once := flags.Bool("once", false, "")
+	duration := flags.Duration("duration", 0, "")
+
+	if len(args) < 1 {
 		err := fmt.Errorf("checkhealth requires a single argument for file.\n%s", Usage)
-		return nil, err
+		return Config{}, err
+	}
+	if err := flags.Parse(args); err != nil {
+		err = fmt.Errorf("failed to parse flags: %v\n%s", err, Usage)
+		return Config{}, err
+	}
+	if flags.NArg() != 1 {
+		err := fmt.Errorf("checkhealth requires a single argument for file.\n%s", Usage)
+		return Config{}, err
 	}
 
 	// verify that the file exists
-	file := os.Args[1]
+	file := flags.Arg(0)
 	if _, err := os.Stat(file); err != nil {
 		err = fmt.Errorf("failed to stat file: %v\n%s", err, Usage)
-		return nil, err
+		return Config{}, err
 	}
 
 	// load entire config file into memory
-	loaded_config, err := os.ReadFile(file)
+	loaded_config, err := readConfigFile(file)
 	if err != nil {
 		err = fmt.Errorf("failed to read file: %v\n%s", err, Usage)
-		return nil, err
+		return Config{}, err
 	}
 
-	// unmarshal YAML into EndpointConfig
-	var endpoint_objects Endpoints
-	err = yaml.Unmarshal(loaded_config, &endpoint_objects)
+	// convert JSON and TOML files into the YAML they are equivalent to, keeping the original
+	source := loaded_config
+	format, err := LookupConfigFormat(file, *config_format)
 	if err != nil {
-		err = fmt.Errorf("failed to unmarshal config YAML: %v\n%s\n%s", err, Usage, UsageConfig)
-		return nil, err
+		err = fmt.Errorf("%v\n%s", err, Usage)
+		return Config{}, err
+	}
+	loaded_config, err = format.Convert(loaded_config)
+	if err != nil {
+		err = fmt.Errorf("failed to parse config %s: %v\n%s\n%s", strings.ToUpper(format.Name), err, Usage, UsageConfig)
+		return Config{}, err
+	}
+
+	// unmarshal YAML into Config
+	config, err := ParseConfig(loaded_config)
+	if err != nil {
+		err = fmt.Errorf("failed to unmarshal config %s: %v\n%s\n%s", strings.ToUpper(format.Name), err, Usage, UsageConfig)
+		return Config{}, err
+	}
+	config.Source = ConfigSource{Format: format.Name, Content: source}
+	config.args = args
+	config.Once, config.Duration = *once, *duration
+	if *skip_invalid {
+		config.SkipInvalidEndpoints = true
+	}
+
+	// the next configuration is loaded with the same flags, see LoadNextConfig
+	if *next_config != "" {
+		config.NextConfig = *next_config
+		flags.Visit(func(f *flag.Flag) {
+			if f.Name != "next-config" {
+				config.next_args = append(config.next_args, "-"+f.Name+"="+f.Value.String())
+			}
+		})
+		config.next_args = append(config.next_args, *next_config)
+	}
+
+	// report every problem of the configuration at once, with its line, unless only endpoints
+	// have problems and invalid endpoints are skipped
+	if err := ValidateConfig(loaded_config, config); err != nil {
+		if !format.KeepsLines {
+			err = withoutLines(err)
+		}
+		if config.SkipInvalidEndpoints {
+			err = config.skipProblems(err)
+		}
+		if err != nil {
+			err = fmt.Errorf("invalid configuration file %s:\n%v\n%s", file, err, UsageConfig)
+			return Config{}, err
+		}
+	}
+
+	// command line flags override the configuration file
+	flags.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "output":
+			config.Output = *output
+		case "interval":
+			config.Interval = *interval
+		case "max-latency":
+			config.MaxLatency = *max_latency
+		case "listen":
+			config.Listen = *listen
+		case "env":
+			config.Env = *env
+		case "state-file":
+			config.StateFile = *state_file
+		case "report":
+			config.ReportFile = *report
+		case "log-level":
+			config.LogLevel = *log_level
+		case "log-format":
+			config.LogFormat = *log_format
+		}
+	})
+	if config.Output == "" {
+		config.Output = OutputText
+	}
+	if config.Interval == 0 {
+		config.Interval = DefaultCheckInterval
+	}
+	if config.MaxLatency == 0 {
+		config.MaxLatency = DefaultMaxLatency
+	}
+
+	// verify that the timings are usable
+	if config.Interval < 0 || config.MaxLatency < 0 {
+		err := fmt.Errorf("interval and max latency must be positive\n%s", Usage)
+		return Config{}, err
+	}
+	if config.MaxLatency > config.Interval {
+		err := fmt.Errorf("max latency %v must not exceed the interval %v\n%s", config.MaxLatency, config.Interval, Usage)
+		return Config{}, err
+	}
+
+	// verify that the run is bounded at most once
+	if config.Duration < 0 {
+		err := fmt.Errorf("duration must be positive\n%s", Usage)
+		return Config{}, err
+	}
+	if config.Once && config.Duration > 0 {
+		err := fmt.Errorf("-once and -duration can't be combined\n%s", Usage)
+		return Config{}, err
+	}
+
+	// verify that the output format is supported
+	if config.Output != OutputText && config.Output != OutputJSON && config.Output != OutputJUnit {
+		err := fmt.Errorf("unsupported output format %q, expected %q, %q or %q\n%s", config.Output, OutputText, OutputJSON, OutputJUnit, Usage)
+		return Config{}, err
+	}
+
+	// apply the settings to every endpoint that doesn't override them
+	err = config.ApplySettings()
+	if err != nil {
+		err = fmt.Errorf("invalid configuration: %v\n%s", err, UsageConfig)
+		return Config{}, err
+	}
+
+	// a single cycle can't reach down_after consecutive failures, so a failed check marks the
+	// endpoint DOWN with -once
+	if config.Once {
+		for i := range config.Endpoints {
+			config.Endpoints[i].DownAfter = 1
+		}
+	}
+
+	// return Config
+	return config, nil
+}
+
+// ApplySettings is a method for Config that expands endpoints comparing a canary with its baseline
+// (see ExpandCanaries), endpoints declaring a path into the selected environments (see
+// ExpandEnvironments) and endpoints listing hosts (see ExpandHosts), copies the endpoint defaults
+// from the settings into every endpoint that doesn't set its own value, and validates the
+// resulting endpoint options, see validateEndpoints.
+func (config *Config) ApplySettings() error {
+	if _, err := NewConcurrencyTuner(config.Settings, config.CheckInterval()); err != nil {
+		return err
+	}
+
+	switch config.BandwidthExceeded {
+	case "", BandwidthExceededHead, BandwidthExceededReduce:
+	default:
+		return fmt.Errorf("unsupported bandwidth_exceeded %q, expected %q or %q", config.BandwidthExceeded, BandwidthExceededHead, BandwidthExceededReduce)
+	}
+	if config.BandwidthWindow < 0 {
+		return fmt.Errorf("bandwidth_window must not be negative, got %s", config.BandwidthWindow)
+	}
+	if config.AlertDampening < 0 {
+		return fmt.Errorf("alert_dampening must not be negative, got %s", config.AlertDampening)
+	}
+	switch config.ReportFormat {
+	case "", ReportJSON, ReportJUnit:
+	default:
+		return fmt.Errorf("unsupported report_format %q, expected %q or %q", config.ReportFormat, ReportJSON, ReportJUnit)
+	}
+	if err := ValidateLogging(config.LogLevel, config.LogFormat); err != nil {
+		return err
+	}
+	if err := ValidateDerivedMetrics(config.DerivedMetrics); err != nil {
+		return err
+	}
+	if err := ValidateCheckTypes(config.CheckTypes); err != nil {
+		return err
+	}
+	for _, window := range config.LatencyWindows {
+		if window <= 0 {
+			return fmt.Errorf("latency_windows must be positive, got %s", window)
+		}
+	}
+	if err := ValidateAvailabilityPeriods(config.AvailabilityPeriods, config.AvailabilityTimezone); err != nil {
+		return err
+	}
+	if config.ParquetDir != "" && !featureEnabled(FeatureExport, "parquet") {
+		return fmt.Errorf("parquet_dir isn't supported by the binary, which was built with the noparquet tag")
+	}
+	if config.SQLiteFile != "" && !featureEnabled(FeatureExport, "sqlite") {
+		return fmt.Errorf("sqlite_file isn't supported by the binary, which was built with the nosqlite tag")
+	}
+	if (config.Netns != "" || config.VRF != "") && config.DNSFailure == DNSFailureRetry {
+		return fmt.Errorf("netns and vrf can't be combined with the %q dns_failure policy", DNSFailureRetry)
+	}
+
+	endpoints, err := config.Endpoints.ExpandCanaries()
+	if err != nil {
+		return err
+	}
+	endpoints, err = endpoints.ExpandEnvironments(config.Environments, config.SelectedEnvironments())
+	if err != nil {
+		return err
+	}
+	endpoints, err = endpoints.ExpandHosts()
+	if err != nil {
+		return err
+	}
+	config.Endpoints = endpoints
+
+	for i := range config.Endpoints {
+		endpoint := &config.Endpoints[i]
+
+		// the retry DNS failure policy only reaches the endpoints it can retry, outside of a network
+		// namespace or VRF, the others keeping the down policy
+		retry := endpoint.acceptsDNSRetry() && endpoint.Netns == "" && endpoint.VRF == ""
+		if endpoint.DNSFailure == "" && (config.DNSFailure != DNSFailureRetry || retry) {
+			endpoint.DNSFailure = config.DNSFailure
+		}
+		if endpoint.DNSResolver == "" {
+			endpoint.DNSResolver = config.DNSResolver
+		}
+		if endpoint.RateLimited == "" {
+			endpoint.RateLimited = config.RateLimited
+		}
+		// the network namespace and VRF only reach the endpoints that can be checked from them
+		if endpoint.acceptsNetworkDefaults() {
+			if endpoint.Netns == "" {
+				endpoint.Netns = config.Netns
+			}
+			if endpoint.VRF == "" {
+				endpoint.VRF = config.VRF
+			}
+		}
+		if endpoint.MaxBodySize == 0 {
+			endpoint.MaxBodySize = config.MaxBodySize
+		}
+		if endpoint.BodyReadLimit == 0 {
+			endpoint.BodyReadLimit = config.BodyReadLimit
+		}
+		// HEAD can only replace GET
+		if config.PreferHead && endpoint.checkType() == EndpointTypeHTTP && (endpoint.Method == "" || endpoint.Method == http.MethodGet) {
+			endpoint.PreferHead = true
+		}
+		if config.AutoLatency {
+			endpoint.AutoLatency = true
+		}
+		if endpoint.AutoLatencyWarmup == 0 {
+			endpoint.AutoLatencyWarmup = config.AutoLatencyWarmup
+		}
+		if endpoint.DownAfter == 0 {
+			endpoint.DownAfter = config.DownAfter
+		}
+		if endpoint.ErrorHistory == 0 {
+			endpoint.ErrorHistory = config.ErrorHistory
+		}
+		if endpoint.AbandonAfter == 0 {
+			endpoint.AbandonAfter = config.AbandonAfter
+		}
+		if config.AlertStatusChange {
+			endpoint.AlertStatusChange = true
+		}
+		if check_type, ok := config.CheckTypes[endpoint.checkType()]; ok {
+			if endpoint.Timeout == 0 {
+				endpoint.Timeout = check_type.Timeout
+			}
+			// a default above the endpoint's own timeout would refuse it
+			if endpoint.MaxLatency == 0 && check_type.MaxLatency <= endpoint.checkTimeout(config.MaxCheckLatency()) {
+				endpoint.MaxLatency = check_type.MaxLatency
+			}
+		}
+
 	}
 
-	// return EndpointConfig
-	return endpoint_objects, nil
+	return config.validateEndpoints()
+}
+
+// validateEndpoint is a method for Config that validates the options of an endpoint the settings
+// were applied to, and that its request template and expressions compile, see Endpoint.compile.
+func (config *Config) validateEndpoint(endpoint *Endpoint) error {
+	switch endpoint.DNSFailure {
+	case "", DNSFailureDown, DNSFailureUnknown:
+	case DNSFailureRetry:
+		if endpoint.DNSResolver == "" {
+			return fmt.Errorf("endpoint %q uses the %q DNS failure policy without a dns_resolver", endpoint.Name, DNSFailureRetry)
+		}
+		// the retry resolves the host with a client of its own, without the endpoint's transport
+		if !endpoint.acceptsDNSRetry() {
+			return fmt.Errorf("endpoint %q uses the %q DNS failure policy, which can't be combined with proxy_protocol or the tls_ options", endpoint.Name, DNSFailureRetry)
+		}
+	default:
+		return fmt.Errorf("endpoint %q has unsupported dns_failure %q, expected %q, %q or %q", endpoint.Name, endpoint.DNSFailure, DNSFailureDown, DNSFailureRetry, DNSFailureUnknown)
+	}
+
+	if endpoint.Netns != "" || endpoint.VRF != "" {
+		if endpoint.DualStack || endpoint.DNSFailure == DNSFailureRetry {
+			return fmt.Errorf("endpoint %q sets netns or vrf, which can't be combined with dual_stack or the %q DNS failure policy", endpoint.Name, DNSFailureRetry)
+		}
+		if _, err := NetworkClient(endpoint.Netns, endpoint.VRF, endpoint.ExpectContinueTimeout); err != nil {
+			return fmt.Errorf("endpoint %q: %v", endpoint.Name, err)
+		}
+	}
+
+	if endpoint.Type != "" && endpoint.Type != EndpointTypeHTTP {
+		check_type, err := LookupCheckType(endpoint.Type)
+		if err != nil {
+			return fmt.Errorf("endpoint %q: %v", endpoint.Name, err)
+		}
+		if endpoint.DualStack || endpoint.Netns != "" || endpoint.VRF != "" || endpoint.Body != "" || endpoint.BodyFile != "" || endpoint.PreferHead {
+			return fmt.Errorf("endpoint %q is a %s endpoint, which can't be combined with dual_stack, netns, vrf, body, body_file or prefer_head", endpoint.Name, endpoint.Type)
+		}
+		if err := check_type.Validate(endpoint); err != nil {
+			return fmt.Errorf("endpoint %q: %v", endpoint.Name, err)
+		}
+	}
+
+	if err := endpoint.validateTimeouts(config.MaxCheckLatency(), config.CheckInterval()); err != nil {
+		return fmt.Errorf("endpoint %q: %v", endpoint.Name, err)
+	}
+	if err := endpoint.validateRetries(); err != nil {
+		return fmt.Errorf("endpoint %q: %v", endpoint.Name, err)
+	}
+	if err := endpoint.validateTLS(); err != nil {
+		return fmt.Errorf("endpoint %q: %v", endpoint.Name, err)
+	}
+	if err := endpoint.validateClientOptions(); err != nil {
+		return fmt.Errorf("endpoint %q: %v", endpoint.Name, err)
+	}
+	if err := endpoint.validateRedirects(); err != nil {
+		return fmt.Errorf("endpoint %q: %v", endpoint.Name, err)
+	}
+	if err := endpoint.validateAuth(); err != nil {
+		return fmt.Errorf("endpoint %q: %v", endpoint.Name, err)
+	}
+	if err := endpoint.validateBodyFile(); err != nil {
+		return fmt.Errorf("endpoint %q: %v", endpoint.Name, err)
+	}
+	if err := endpoint.validateLabels(); err != nil {
+		return fmt.Errorf("endpoint %q: %v", endpoint.Name, err)
+	}
+
+	if endpoint.PreferHead && endpoint.Method != "" && endpoint.Method != http.MethodGet {
+		return fmt.Errorf("endpoint %q sets prefer_head with method %s, but HEAD can only replace GET", endpoint.Name, endpoint.Method)
+	}
+	if endpoint.BodyReadLimit < 0 {
+		return fmt.Errorf("endpoint %q has a negative body_read_limit", endpoint.Name)
+	}
+	if endpoint.AbandonAfter < 0 {
+		return fmt.Errorf("endpoint %q has a negative abandon_after", endpoint.Name)
+	}
+
+	switch endpoint.RateLimited {
+	case "", RateLimitedDown, RateLimitedDegraded, RateLimitedUnknown:
+	default:
+		return fmt.Errorf("endpoint %q has unsupported rate_limited %q, expected %q, %q or %q", endpoint.Name, endpoint.RateLimited, RateLimitedDown, RateLimitedDegraded, RateLimitedUnknown)
+	}
+
+	if endpoint.DegradedWhen != "" && endpoint.Type != "" && endpoint.Type != EndpointTypeHTTP {
+		return fmt.Errorf("endpoint %q sets degraded_when, which is only supported by %s endpoints", endpoint.Name, EndpointTypeHTTP)
+	}
+
+	if endpoint.ProxyProtocol != "" {
+		if endpoint.ProxyProtocol != ProxyProtocolV1 && endpoint.ProxyProtocol != ProxyProtocolV2 {
+			return fmt.Errorf("endpoint %q has unsupported proxy_protocol %q, expected %q or %q", endpoint.Name, endpoint.ProxyProtocol, ProxyProtocolV1, ProxyProtocolV2)
+		}
+		if endpoint.Type != "" && endpoint.Type != EndpointTypeHTTP && endpoint.Type != EndpointTypeRawTCP {
+			return fmt.Errorf("endpoint %q sets proxy_protocol, which is only supported by %s and %s endpoints", endpoint.Name, EndpointTypeHTTP, EndpointTypeRawTCP)
+		}
+		if endpoint.DualStack || endpoint.Netns != "" || endpoint.VRF != "" {
+			return fmt.Errorf("endpoint %q sets proxy_protocol, which can't be combined with dual_stack, netns or vrf", endpoint.Name)
+		}
+	}
+
+	// compile a copy, the endpoint is compiled by CreateNewTargets
+	compiled := *endpoint
+	return compiled.compile()
 }
 
 // UpdateDomainStats is a method for a domain to update availability statistics.
@@ -220,6 +2520,9 @@ func (domain *Domain) UpdateDomainStats(is_up bool) {
 		return
 	}
 
+	domain_stats.Lock()
+	defer domain_stats.Unlock()
+
 	if is_up {
 		domain.UpCount += 1
 	}
@@ -227,6 +2530,17 @@ func (domain *Domain) UpdateDomainStats(is_up bool) {
 	domain.TotalRequests += 1
 }
 
+// Availability is a method for a domain that computes its cumulative availability as a percentage,
+// rounded to the nearest whole number. If no requests have been run for a domain, it reports 0%
+// availability.
+func (domain *Domain) Availability() int {
+	if domain.TotalRequests == 0 {
+		return 0
+	}
+
+	return int(math.Round(100 * float64(domain.UpCount) / float64(domain.TotalRequests)))
+}
+
 // CreateRequest is an Endpoint method that wraps around http.Request to create a new HTTP request.
 //
 // The function takes a single argument for the context. It returns a pointer to an HTTP request
@@ -234,15 +2548,44 @@ func (domain *Domain) UpdateDomainStats(is_up bool) {
 //
 // If an endpoint doesn't have a method, it defaults to the GET method.
 // If an endpoint's body isn't provided, nil is passed when creating the new request.
+// If an endpoint has a body source or body file, the body is streamed from it instead of being
+// loaded into memory. Bodies from a generator are sent with chunked transfer encoding.
 // If an endpoint has headers, they will be added and override any default header values.
+// If an endpoint has a body file and no Content-Type header, the content type is inferred from
+// the extension of the file.
+// If an endpoint has auth, its credentials are sent in the Authorization header.
+//
+// When the endpoint has a precompiled Template, the request is cloned from it instead of parsing
+// the URL and building the headers again.
 //
 // Note: Headers are assumed to be single valued.
 func (endpoint *Endpoint) CreateRequest(ctx context.Context) (*http.Request, error) {
-	// body to io.Reader interface
-	var body_reader io.Reader = nil
+	template := endpoint.Template
+	if template == nil {
+		var err error
+		template, err = endpoint.CompileRequest()
+		if err != nil {
+			return nil, err
+		}
+	}
 
-	if endpoint.Body != "" {
-		body_reader = bytes.NewReader([]byte(endpoint.Body))
+	return template.NewRequest(ctx)
+}
+
+// RequestTemplate is an endpoint's request with its URL parsed and headers built once, from which
+// a request is cloned for every check. This keeps per-cycle allocations low for large
+// configurations.
+type RequestTemplate struct {
+	prototype *http.Request
+	open_body func() (io.ReadCloser, int64, error)
+}
+
+// CompileRequest is an Endpoint method that creates the endpoint's RequestTemplate, following the
+// rules of CreateRequest. An error is returned if the request is invalid.
+func (endpoint *Endpoint) CompileRequest() (*RequestTemplate, error) {
+	open_body, err := endpoint.bodyOpener()
+	if err != nil {
+		return nil, err
 	}
 
 	// set method based on endpoint method. Do not modify endpoint.Method
@@ -251,93 +2594,483 @@ func (endpoint *Endpoint) CreateRequest(ctx context.Context) (*http.Request, err
 		method = "GET"
 	}
 
-	// creates the HTTP request
-	request, err := http.NewRequestWithContext(ctx, method, endpoint.Url, body_reader)
+	// creates the HTTP request, the body is attached to each clone
+	prototype, err := http.NewRequestWithContext(context.Background(), method, endpoint.Url, nil)
 	if err != nil {
 		return nil, err
 	}
 
+	// ask the server to confirm before the body is sent
+	if endpoint.ExpectContinue && open_body != nil {
+		prototype.Header.Set("Expect", "100-continue")
+	}
+
 	// Add any required headers
 	for field, value := range endpoint.Headers {
-		request.Header.Set(field, value)
+		prototype.Header.Set(field, value)
+	}
+
+	// describe a body file by its extension, unless a header sets the content type
+	if content_type := endpoint.bodyFileContentType(); content_type != "" && prototype.Header.Get("Content-Type") == "" {
+		prototype.Header.Set("Content-Type", content_type)
+	}
+
+	// resolve the credentials once, like the rest of the template
+	if endpoint.Auth != nil {
+		authorization, err := endpoint.Auth.Authorization()
+		if err != nil {
+			return nil, err
+		}
+		prototype.Header.Set("Authorization", authorization)
+	}
+
+	return &RequestTemplate{
+		prototype: prototype,
+		open_body: open_body,
+	}, nil
+}
+
+// NewRequest is a RequestTemplate method that clones the template into a new request with the
+// provided context, opening a new stream of the body if the request has one.
+func (template *RequestTemplate) NewRequest(ctx context.Context) (*http.Request, error) {
+	request := template.prototype.Clone(ctx)
+	if template.open_body == nil {
+		return request, nil
+	}
+
+	body, length, err := template.open_body()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open request body: %v", err)
+	}
+
+	// streamed bodies can be reopened for redirects and retries
+	request.Body = body
+	request.ContentLength = length
+	request.GetBody = func() (io.ReadCloser, error) {
+		body, _, err := template.open_body()
+		return body, err
 	}
 
 	return request, nil
 }
 
+// bodyOpener returns a function opening a new stream of the endpoint's request body along with
+// its length, where -1 means unknown. Nil is returned when the endpoint has no body. An error is
+// returned if more than one body is configured.
+func (endpoint *Endpoint) bodyOpener() (func() (io.ReadCloser, int64, error), error) {
+	configured := 0
+	for _, is_set := range []bool{endpoint.Body != "", endpoint.BodyFile != "", endpoint.BodySource != nil} {
+		if is_set {
+			configured++
+		}
+	}
+	if configured > 1 {
+		return nil, fmt.Errorf("only one of body, body_file or a body source can be set")
+	}
+
+	switch {
+	case endpoint.BodySource != nil:
+		return func() (io.ReadCloser, int64, error) {
+			body, err := endpoint.BodySource()
+			return body, -1, err
+		}, nil
+	case endpoint.BodyFile != "":
+		return func() (io.ReadCloser, int64, error) {
+			file, err := os.Open(endpoint.BodyFile)
+			if err != nil {
+				return nil, 0, err
+			}
+			info, err := file.Stat()
+			if err != nil {
+				file.Close()
+				return nil, 0, err
+			}
+			return file, info.Size(), nil
+		}, nil
+	case endpoint.Body != "":
+		return func() (io.ReadCloser, int64, error) {
+			return io.NopCloser(bytes.NewReader([]byte(endpoint.Body))), int64(len(endpoint.Body)), nil
+		}, nil
+	default:
+		return nil, nil
+	}
+}
+
 // GetEndpointHealth is a method that has a provided HTTP client run an endpoint's request and
 // determine the endpoint's health. If an error is encountered while performing the request or if
 // the status code of the server response is not between 200 and 299, the endpoint is considered
 // "down". Otherwise, it will be considered up.
 //
-// Context is used to cause response times longer than max_latency to trigger a timeout timeout and
-// to cancel the request, resulting in the endpoint getting marked as "down".
+// Context is used to cause response times longer than the endpoint's timeout, max_latency unless
+// it sets its own, to trigger a timeout and to cancel the request, resulting in the endpoint
+// getting marked as "down". Successful responses slower than the endpoint's own max_latency, below
+// its timeout, are marked "degraded", see judgeLatency.
+//
+// DNS resolution failures are handled according to the endpoint's DNSFailure policy: the endpoint
+// is marked down, the request is retried with the secondary DNSResolver, or the check is recorded
+// as unknown and excluded from the domain's availability.
 //
-// The status of the endpoint is fed to the endpoint's associated domain through UpdateDomainStats,
-// which is used to keep track of the health of the domain.
-func (endpoint *Endpoint) GetEndpointHealth(max_latency time.Duration) {
-	ctx, cancel := context.WithTimeout(context.Background(), max_latency)
+// When the endpoint has DualStack enabled and its host has both IPv4 and IPv6 addresses, each
+// address family is checked separately, see GetDualStackHealth.
+//
+// In auto_latency mode, successful checks slower than the thresholds derived from the endpoint's
+// learned Baseline are marked degraded or down.
+//
+// Rate-limited (429) responses are handled according to the endpoint's RateLimited policy. Under
+// the unknown policy, the endpoint isn't requested again until the delay of the response's
+// Retry-After header has passed, and its checks are recorded as unknown in the meantime.
+//
+// When the endpoint is down and has a FallbackUrl, the fallback is checked right away with its own
+// timeout and its result is returned in the result's Fallback, see checkFallback.
+//
+// Endpoints of other types, such as gRPC endpoints, are checked by their registered CheckType
+// instead, see RegisterCheckType.
+//
+// The result of the check is returned without modifying the endpoint's domain. The scheduler feeds
+// it to the domain through RecordResult, which is used to keep track of the health of the domain.
+func (endpoint *Endpoint) GetEndpointHealth(max_latency time.Duration) CheckResult {
+	return endpoint.GetEndpointHealthContext(context.Background(), max_latency)
+}
+
+// GetEndpointHealthContext is like GetEndpointHealth, the check also being canceled when parent
+// is done.
+func (endpoint *Endpoint) GetEndpointHealthContext(parent context.Context, max_latency time.Duration) CheckResult {
+	ctx, cancel := context.WithTimeout(parent, endpoint.checkTimeout(max_latency))
 	defer cancel()
 
-	// forcing creating request to be fatal as it's a configuration issue
-	// this should be validated in CreateNewTargets()
+	started_at := time.Now()
+
+	var result CheckResult
+	switch {
+	case endpoint.BandwidthSkip:
+		result.fail(StatusUnknown, ErrorKindBandwidth, fmt.Errorf("skipped, the bandwidth cap of the domain is exceeded"))
+		result.skipped = true
+	case endpoint.backingOff(started_at):
+		result.fail(StatusUnknown, ErrorKindRateLimited, fmt.Errorf("backing off after a rate-limited response until %s", endpoint.RateLimitedUntil.Format(time.RFC3339)))
+		result.skipped = true
+	case !endpoint.abandonedAt().IsZero():
+		result.fail(StatusUnknown, ErrorKindAbandoned, fmt.Errorf("paused since %s, the endpoint was abandoned after being DOWN for abandon_after", endpoint.abandonedAt().Format(time.RFC3339)))
+		result.skipped = true
+	case endpoint.Type != "" && endpoint.Type != EndpointTypeHTTP:
+		result = endpoint.checkWithRetries(ctx, endpoint.runTypedCheck)
+	case endpoint.DualStack:
+		result = endpoint.checkWithRetries(ctx, endpoint.GetDualStackHealth)
+	default:
+		result = endpoint.checkWithRetries(ctx, endpoint.runClientCheck)
+	}
+
+	result.Endpoint = endpoint.Name
+	result.Url = endpoint.Url
+	result.StartedAt = started_at
+	result.FinishedAt = time.Now()
+
+	if result.backoff > 0 {
+		endpoint.RateLimitedUntil = result.FinishedAt.Add(result.backoff)
+	}
+
+	if result.head_rejected && !endpoint.HeadRejected {
+		log.Printf("%s rejected HEAD, checking it with %s from now on", endpoint.Name, result.Method)
+		endpoint.HeadRejected = true
+	}
+
+	// slow responses are degraded above the endpoint's own max_latency, and judged against its
+	// learned baseline in auto_latency mode. Redirects have a budget of their own with
+	// max_redirect_latency
+	endpoint.judgeRedirects(&result)
+	endpoint.judgeLatency(&result, max_latency)
+	endpoint.Baseline.Judge(&result)
+
+	// oversized bodies are reported distinctly from regular failures
+	if result.ErrorKind == ErrorKindBodyTooLarge {
+		log.Printf("WARNING: %s response body exceeded %d decompressed bytes, marking it down: possible decompression bomb", endpoint.Name, endpoint.maxBodySize())
+	}
+
+	// verify the failover target while the primary is down
+	endpoint.checkFallback(&result, max_latency)
+
+	return result
+}
+
+// runTypedCheck checks an endpoint whose type isn't HTTP with its registered CheckType. Endpoints
+// of types not compiled into the binary are down, though ApplySettings rejects them beforehand.
+func (endpoint *Endpoint) runTypedCheck(ctx context.Context) CheckResult {
+	check_type, err := LookupCheckType(endpoint.Type)
+	if err != nil {
+		var result CheckResult
+		result.fail(StatusDown, ErrorKindConnection, err)
+		return result
+	}
+	return check_type.Check(endpoint, ctx)
+}
+
+// client returns the HTTP client used to check the endpoint. The default client is shared by all
+// endpoints that don't need transport options of their own.
+func (endpoint *Endpoint) client() (*http.Client, error) {
+	var base *http.Client
+	switch {
+	case endpoint.Netns != "" || endpoint.VRF != "":
+		client, err := NetworkClient(endpoint.Netns, endpoint.VRF, endpoint.ExpectContinueTimeout)
+		if err != nil {
+			return nil, err
+		}
+		base = client
+	case endpoint.ProxyProtocol != "":
+		base = ProxyProtocolClient(endpoint.ProxyProtocol, endpoint.ExpectContinueTimeout)
+	case endpoint.hasTLSOptions():
+		client, err := TLSClient(endpoint.tlsOptions())
+		if err != nil {
+			return nil, err
+		}
+		base = client
+	case endpoint.ExpectContinueTimeout > 0:
+		base = ExpectContinueClient(endpoint.ExpectContinueTimeout)
+	}
+	return endpoint.tuneClient(base)
+}
+
+// runClientCheck checks the endpoint with its client, see runCheck. The endpoint is down when its
+// client can't be created, such as when its CA file or network namespace can't be opened anymore.
+func (endpoint *Endpoint) runClientCheck(ctx context.Context) CheckResult {
+	client, err := endpoint.client()
+	if err != nil {
+		var result CheckResult
+		result.fail(StatusDown, ErrorKindConnection, fmt.Errorf("failed to create HTTP client: %w", err))
+		return result
+	}
+	return endpoint.runCheck(ctx, client)
+}
+
+// runCheck performs the endpoint's request with client and returns its result, applying the
+// endpoint's DNS failure policy, success predicate, body assertions, interim response assertion
+// and rate limit policy, the status reported by health+json responses, and its degraded
+// predicate. The result of a
+// failed check carries the error explaining why the endpoint is down, ErrBodyTooLarge identifying
+// responses exceeding the maximum body size.
+func (endpoint *Endpoint) runCheck(ctx context.Context, client *http.Client) CheckResult {
+	result := CheckResult{Status: StatusUp}
+
+	// record interim (1xx) responses when the endpoint asserts on them
+	var interim *InterimResponses
+	if endpoint.ExpectInterim != 0 {
+		ctx, interim = WithInterimTrace(ctx)
+	}
+	ctx = withRemoteIP(ctx, &result)
+	ctx = withRedirectTrace(ctx, &result)
+	ctx, timing := withTimingTrace(ctx)
+
+	// the configuration is validated in CreateNewTargets(), but a body file or source can still
+	// fail to open at runtime, which only fails this check
 	request, err := endpoint.CreateRequest(ctx)
 	if err != nil {
-		log.Fatalf("ERROR: Failed to create HTTP Request: %v", err)
+		result.fail(StatusDown, ErrorKindConnection, err)
+		return result
 	}
 
-	response, err := http.DefaultClient.Do(request)
+	// the predicates and regex are validated by ApplySettings, but endpoints checked without it
+	// fail rather than exit
+	predicate, err := endpoint.predicate()
 	if err != nil {
-		endpoint.Domain.UpdateDomainStats(EndpointDown)
-		return
+		result.fail(StatusDown, ErrorKindPredicate, fmt.Errorf("failed to compile success_when: %w", err))
+		return result
+	}
+
+	degraded, err := endpoint.degradedPredicate()
+	if err != nil {
+		result.fail(StatusDown, ErrorKindPredicate, fmt.Errorf("failed to compile degraded_when: %w", err))
+		return result
+	}
+
+	body_regex, err := endpoint.bodyRegex()
+	if err != nil {
+		result.fail(StatusDown, ErrorKindBody, fmt.Errorf("failed to compile expect_body_regex: %w", err))
+		return result
+	}
+
+	// HEAD saves bandwidth when nothing is read from the response body
+	use_head := endpoint.useHead(predicate, degraded)
+	if use_head {
+		request.Method = http.MethodHead
+	}
+
+	start := time.Now()
+	response, err := client.Do(request)
+	if err != nil && IsDNSError(err) {
+		switch endpoint.DNSFailure {
+		case DNSFailureUnknown:
+			result.Latency = time.Since(start)
+			result.Timing = timing.Timing()
+			result.fail(StatusUnknown, ErrorKindDNS, err)
+			return result
+		case DNSFailureRetry:
+			// the original request may have consumed its body, so build a new one
+			request, err = endpoint.CreateRequest(ctx)
+			if err != nil {
+				result.fail(StatusDown, ErrorKindConnection, err)
+				return result
+			}
+			if use_head {
+				request.Method = http.MethodHead
+			}
+			client, err = endpoint.tuneClient(ResolverClient(endpoint.DNSResolver))
+			if err != nil {
+				result.fail(StatusDown, ErrorKindConnection, fmt.Errorf("failed to create HTTP client: %w", err))
+				return result
+			}
+			result.Redirects = nil
+			start = time.Now()
+			response, err = client.Do(request)
+		}
+	}
+	if err == nil && use_head && RejectsHead(response.StatusCode) {
+		// targets rejecting HEAD are checked with GET, which is used for them from then on
+		response.Body.Close()
+		result.BytesSent += requestSize(request)
+		result.BytesReceived += responseHeaderSize(response)
+		result.head_rejected = true
+		request, err = endpoint.CreateRequest(ctx)
+		if err != nil {
+			result.fail(StatusDown, ErrorKindConnection, err)
+			return result
+		}
+		result.Redirects = nil
+		start = time.Now()
+		response, err = client.Do(request)
+	}
+	result.Method = request.Method
+	result.BytesSent += requestSize(request)
+	result.Timing = timing.Timing()
+	if err != nil {
+		result.Latency = time.Since(start)
+		result.fail(StatusDown, ErrorKind(err), err)
+		return result
 	}
 	defer response.Body.Close()
+	result.BytesReceived += responseHeaderSize(response)
+	response.Body = countingReader{ReadCloser: response.Body, count: &result.BytesReceived}
+	result.StatusCode = response.StatusCode
+	result.RedirectTarget = redirectTarget(response)
+	if response.StatusCode == http.StatusTooManyRequests || response.StatusCode == http.StatusServiceUnavailable {
+		result.retry_after, result.retry_after_ok = ParseRetryAfter(response.Header.Get("Retry-After"), time.Now())
+	}
 
-	if response.StatusCode < 200 || response.StatusCode >= 300 {
-		endpoint.Domain.UpdateDomainStats(EndpointDown)
+	// added to ensure that the connection closes properly, reading at most the max body size
+	// the body is only kept when the success predicate or the body assertions compare it, or when
+	// it reports the health of the target's components
+	keep_body := (predicate != nil && predicate.NeedsBody()) || (degraded != nil && degraded.NeedsBody()) || endpoint.expectsBody() || IsHealthJSON(response.Header)
+	var body []byte
+	var body_err error
+	if endpoint.BodyReadLimit > 0 && endpoint.BodyReadLimit <= endpoint.maxBodySize() {
+		// stop at the read limit, the rest of the body isn't downloaded
+		body, body_err = ReadResponseBodyPrefix(response, endpoint.BodyReadLimit, keep_body)
+	} else {
+		body, body_err = ReadResponseBody(response, endpoint.maxBodySize(), keep_body)
+	}
+	result.Latency = time.Since(start)
+	if body_err == ErrBodyTooLarge {
+		result.fail(StatusDown, ErrorKindBodyTooLarge, body_err)
+		return result
+	}
+	if body_err != nil {
+		log.Printf("Failed to read response body: %v", body_err)
+	}
 
-		// added to ensure that the connection closes properly
-		_, err = io.ReadAll(response.Body)
+	// targets following the health+json convention report the status of their components
+	health_status := ""
+	if IsHealthJSON(response.Header) && body_err == nil {
+		status, components, err := ParseHealthJSON(body)
 		if err != nil {
-			log.Printf("Failed to read response body: %v", err)
+			log.Printf("WARNING: %s: %v", endpoint.Name, err)
 		}
-		return
+		health_status, result.Components = status, components
 	}
 
-	// added to ensure that the connection closes properly
-	_, err = io.ReadAll(response.Body)
-	if err != nil {
-		log.Printf("Failed to read response body: %v", err)
+	signals := PredicateSignals{
+		Status:  response.StatusCode,
+		Latency: result.Latency,
+		Header:  response.Header,
+		Body:    body,
+	}
+	if predicate != nil {
+		if !predicate.Evaluate(signals) {
+			result.fail(StatusDown, ErrorKindPredicate, fmt.Errorf("success_when %q was not met", predicate))
+			endpoint.rateLimited(&result)
+			return result
+		}
+	} else if response.StatusCode < 200 || response.StatusCode >= 300 {
+		result.fail(StatusDown, ErrorKindStatus, fmt.Errorf("unexpected status code %d", response.StatusCode))
+		endpoint.rateLimited(&result)
+		return result
+	}
+
+	// a successful status may still come with an error page
+	if err := endpoint.checkBody(body, body_regex); err != nil {
+		result.fail(StatusDown, ErrorKindBody, err)
+		return result
+	}
+
+	// the expected interim response must have been received before the final response
+	if interim != nil && !interim.Received(endpoint.ExpectInterim) {
+		result.fail(StatusDown, ErrorKindInterim, fmt.Errorf("interim response %d was not received", endpoint.ExpectInterim))
+		return result
 	}
 
-	endpoint.Domain.UpdateDomainStats(EndpointUp)
+	result.applyHealthStatus(health_status)
+
+	// a successful response may still meet the warning condition
+	result.judgeWarning(degraded, signals)
+	return result
+}
+
+// predicate returns the endpoint's compiled success predicate, compiling SuccessWhen when the
+// endpoint wasn't created by CreateNewTargets. A nil predicate selects the default status code
+// check.
+func (endpoint *Endpoint) predicate() (*Predicate, error) {
+	if endpoint.Predicate != nil || endpoint.SuccessWhen == "" {
+		return endpoint.Predicate, nil
+	}
+	return CompilePredicate(endpoint.SuccessWhen)
+}
+
+// maxBodySize returns the maximum decompressed response body size for the endpoint.
+func (endpoint *Endpoint) maxBodySize() int64 {
+	if endpoint.MaxBodySize <= 0 {
+		return DefaultMaxBodySize
+	}
+	return endpoint.MaxBodySize
 }
 
 // CreateNewTargets is a function that takes an endpoint configuration object and returns a new
 // HealthCheckTargets object that contains a domains linked list and a pointer to the endpoints.
 //
-// Any failures to generate a domain or endpoint object will considered critical and result in the
-// method exiting early with an error.
+// Endpoints are compiled concurrently, and an InvalidEndpoints listing every invalid endpoint is
+// returned when any of them fails to compile. Any failures to generate a domain will considered
+// critical and result in the method exiting early with an error.
 func (endpoints *Endpoints) CreateNewTargets() (HealthCheckTargets, error) {
 	// creates a new HealthCheckTarget Object
 	var target HealthCheckTargets = HealthCheckTargets{
 		Domains:   nil,
 		Endpoints: endpoints,
+		Loop:      &CheckLoop{},
+		Run:       &RunRecorder{},
+		Heatmap:   &LatencyHeatmap{},
+	}
+
+	// compile the endpoints concurrently, reporting every invalid endpoint
+	if err := forEachEndpoint(*endpoints, (*Endpoint).compile); err != nil {
+		return HealthCheckTargets{}, err
 	}
 
 	// create endpoints for each configuration object
 	for i := 0; i < len(*endpoints); i++ {
-		// validate successful creation of HTTP requests
-		_, err := (*endpoints)[i].CreateRequest(
-			context.Background(),
-		)
-		if err != nil {
-			err = fmt.Errorf("failed to create new HTTP request: %v", err)
-			return HealthCheckTargets{}, err
+		var err error
+
+		// get pointer to domain associated with endpoint, or to its group.
+		var domain_pointer *Domain
+		if (*endpoints)[i].Group != "" {
+			domain_pointer, err = target.GetGroupPointer((*endpoints)[i].Group)
+		} else {
+			domain_pointer, err = target.GetDomainPointer((*endpoints)[i].Url)
 		}
-
-		// get pointer to domain associated with endpoint.
-		domain_pointer, err := target.GetDomainPointer((*endpoints)[i].Url)
 		if err != nil {
 			err = fmt.Errorf("failed to get domain: %v", err)
 			return HealthCheckTargets{}, err
@@ -345,11 +3078,76 @@ func (endpoints *Endpoints) CreateNewTargets() (HealthCheckTargets, error) {
 
 		// create the new endpoint
 		(*endpoints)[i].Domain = domain_pointer
+		(*endpoints)[i].State = NewEndpointState((*endpoints)[i].DownAfter, (*endpoints)[i].ErrorHistory)
+		(*endpoints)[i].Schedule = NewScheduleStats()
+		if (*endpoints)[i].AutoLatency {
+			(*endpoints)[i].Baseline = NewLatencyBaseline((*endpoints)[i].AutoLatencyWarmup)
+		}
 	}
 
 	return target, nil
 }
 
+// compile is a method for Endpoint that precompiles its request template, success and degraded
+// predicates and body regular expression, so they are validated once and reused by every check.
+func (endpoint *Endpoint) compile() error {
+	// precompile the request template, validated once
+	template, err := endpoint.CompileRequest()
+	if err != nil {
+		return fmt.Errorf("failed to create new HTTP request for endpoint %q: %v", endpoint.Name, err)
+	}
+
+	// validate successful creation of HTTP requests
+	request, err := template.NewRequest(context.Background())
+	if err != nil {
+		return fmt.Errorf("failed to create new HTTP request for endpoint %q: %v", endpoint.Name, err)
+	}
+	endpoint.Template = template
+
+	// release streamed bodies opened for validation
+	if request.Body != nil {
+		request.Body.Close()
+	}
+
+	// compile the success predicate once, rejecting invalid expressions
+	if endpoint.SuccessWhen != "" {
+		predicate, err := CompilePredicate(endpoint.SuccessWhen)
+		if err != nil {
+			return fmt.Errorf("invalid success_when for endpoint %q: %v", endpoint.Name, err)
+		}
+		endpoint.Predicate = predicate
+	}
+
+	// compile the degraded predicate once, rejecting invalid expressions
+	if endpoint.DegradedWhen != "" {
+		predicate, err := CompilePredicate(endpoint.DegradedWhen)
+		if err != nil {
+			return fmt.Errorf("invalid degraded_when for endpoint %q: %v", endpoint.Name, err)
+		}
+		endpoint.DegradedPredicate = predicate
+	}
+
+	// compile the body regular expression once, rejecting invalid expressions
+	if endpoint.ExpectBodyRegex != "" {
+		body_regex, err := regexp.Compile(endpoint.ExpectBodyRegex)
+		if err != nil {
+			return fmt.Errorf("invalid expect_body_regex for endpoint %q: %v", endpoint.Name, err)
+		}
+		endpoint.BodyRegex = body_regex
+	}
+
+	// compile the JSON assertions once, rejecting invalid assertions
+	if len(endpoint.ExpectJSON) > 0 {
+		assertions, err := compileJSONAssertions(endpoint.ExpectJSON)
+		if err != nil {
+			return fmt.Errorf("invalid expect_json for endpoint %q: %v", endpoint.Name, err)
+		}
+		endpoint.JSONAssertions = assertions
+	}
+
+	return nil
+}
+
 // GetDomainPointer is a method for HealthCheckTargets that returns a pointer to a domain for a
 // provided URL. GetDomainPointer will create a new domain and add it to the end of
 // HealthCheckTargets' linked list if it doesn't already exist.
@@ -358,7 +3156,9 @@ func (endpoints *Endpoints) CreateNewTargets() (HealthCheckTargets, error) {
 // GetDomainPointer will fail and an error will be returned.
 //
 // Note: a domain is the fully qualified domain name (FQDN) of the provided URL. So "www.google.com" and
-// "google.com" would resolve as separate domains.
+// "google.com" would resolve as separate domains, unless their endpoints share a group, see
+// GetGroupPointer. Ports are ignored, and IP addresses, including IPv6 literals, are named in their
+// canonical form, see hostDomain.
 func (target *HealthCheckTargets) GetDomainPointer(raw_url string) (*Domain, error) {
 	// return with an error if target is a null pointer
 	if target == nil {
@@ -374,15 +3174,32 @@ func (target *HealthCheckTargets) GetDomainPointer(raw_url string) (*Domain, err
 	if err != nil {
 		return nil, err
 	}
-	domain_name := current_url.Hostname()
+	return target.namedDomain(hostDomain(current_url)), nil
+}
 
+// GetGroupPointer is a method for HealthCheckTargets that returns a pointer to the domain of the
+// endpoints of a group, which replaces the FQDN of their URLs as the name of the domain they are
+// aggregated into. Like GetDomainPointer, the domain is created if it doesn't already exist.
+func (target *HealthCheckTargets) GetGroupPointer(group string) (*Domain, error) {
+	if target == nil {
+		return nil, fmt.Errorf("failed to create domain pointer, *HealthCheckTargets is nil")
+	}
+	if strings.TrimSpace(group) == "" {
+		return nil, fmt.Errorf("failed to create domain pointer, provided group was blank")
+	}
+	return target.namedDomain(group), nil
+}
+
+// namedDomain returns the domain named domain_name, added to the end of HealthCheckTargets' linked
+// list if it doesn't already exist.
+func (target *HealthCheckTargets) namedDomain(domain_name string) *Domain {
 	var current_domain *Domain = target.Domains
 	var previous_domain *Domain = nil
 
 	// handle case where domain already exists
 	for current_domain != nil {
 		if domain_name == current_domain.Name {
-			return current_domain, nil
+			return current_domain
 		}
 
 		previous_domain = current_domain
@@ -403,36 +3220,116 @@ func (target *HealthCheckTargets) GetDomainPointer(raw_url string) (*Domain, err
 		previous_domain.Next = new_domain
 	}
 
-	return new_domain, nil
+	return new_domain
 }
 
 // RunCheckHealth is a method for HealthCheckTargets that will run until the process is terminated.
-// Every 15 seconds RunCheckHealth will execute client request to the endpoints defined in the
-// HealthCheckTargets' Endpoints slice. Requests are executed in series. Once all endpoint health
-// checks are complete, a call to LogDomainHealth() is made to log the output.
-func (target *HealthCheckTargets) RunCheckHealth() {
-	throttle := time.Tick(15 * time.Second)
+// Every interval RunCheckHealth will execute client request to the endpoints defined in the
+// HealthCheckTargets' Endpoints slice. Requests are executed in series, unless the concurrency
+// setting selects a number of concurrent workers or tunes it automatically. Once all endpoint
+// health checks are complete, a call to LogDomainHealth() (or LogDomainHealthJSON() for JSON
+// output) is made to log the output. Configurations received on Reloads are applied before the
+// next cycle.
+//
+// The interval is 15 seconds by default, and the cycles start on wall-clock boundaries (:00, :15,
+// :30 and :45) when the align setting is enabled. They are scheduled on clock, SystemClock outside
+// of tests, see Clock. RunCheckHealth returns once ctx is done, completing a cycle in progress
+// first.
+func (target *HealthCheckTargets) RunCheckHealth(ctx context.Context, clock Clock) {
+	interval := target.Settings.CheckInterval()
+	tuner, err := NewConcurrencyTuner(target.Settings, interval)
+	if err != nil {
+		log.Fatalf("ERROR: %v\n", err)
+	}
+
+	timer := newCycleTimer(clock, interval, target.Settings.Align)
+	defer timer.Stop()
+	target.Loop.Start(clock, interval)
+	defer target.Loop.Stop()
+	target.Run.Start(clock.Now())
+	scheduled, ok := timer.Start(ctx.Done())
+	cycles := 0
+
+	for ok && ctx.Err() == nil {
+		// apply a configuration reloaded on SIGHUP between two cycles
+		select {
+		case config := <-target.Reloads:
+			target.ApplyReload(config)
+		default:
+		}
 
-	for {
-		for _, endpoint := range *target.Endpoints {
-			// get the status of the endpoint and update domains counts
-			// defines max latency as 500ms
-			endpoint.GetEndpointHealth(500 * time.Millisecond)
+		// get the status of the endpoints and update domains counts
+		start := clock.Now()
+		target.Loop.CycleStarted(start)
+		target.ApplyBandwidthCaps(start)
+		results := target.CheckEndpoints(tuner.Workers(), target.Settings.MaxCheckLatency())
+		transitions := target.RecordResults(results)
+		target.Run.Observe(results, target.Endpoints, transitions)
+		target.Heatmap.Observe(results, target.Settings.AvailabilityLocation())
+		target.LogChecks(results)
+		status_changes := target.StatusChanges(results)
+		target.RecordSchedule(results, scheduled, start, interval)
+		target.Metrics.Observe(results, target.Endpoints)
+		target.History.Observe(results, target.Endpoints)
+		target.SQLite.Observe(results, target.Endpoints)
+		target.SaveState()
+		tuner.Observe(clock.Now().Sub(start), len(*target.Endpoints))
+
+		// pause the checks of the endpoints DOWN for longer than their abandon_after, before the
+		// notifiers are told about them
+		abandonments := target.AbandonEndpoints(clock.Now())
+
+		// let the notifiers open or resolve issues for sustained outages
+		target.NotifyOutages(clock.Now())
+
+		// call logger to log output in the configured format, state changes first, except with the
+		// junit output, which only prints the report of the run on termination
+		if target.Settings.Output != OutputJUnit {
+			target.LogStateChanges(transitions)
+			target.LogStatusChanges(status_changes)
+			target.LogAbandonments(abandonments)
+			if target.Settings.Output == OutputJSON {
+				target.LogDomainHealthJSON()
+			} else {
+				target.LogDomainHealth()
+			}
+			target.LogFailureReasons()
+			target.LogCanaryComparisons()
 		}
 
-		// call logger to log output
-		target.LogDomainHealth()
+		// queue the check results, state and status changes, abandoned endpoints, domain
+		// availability, failure reasons, canary comparisons and derived metrics for the sinks,
+		// which flush asynchronously
+		target.EmitResults(results, target.Endpoints, clock.Now())
+		target.EmitEvents(target.StateEvents(transitions))
+		target.EmitEvents(target.StatusChangeEvents(status_changes))
+		target.EmitEvents(target.AbandonEvents(abandonments))
+		target.EmitEvents(target.DomainEvents(clock.Now()))
+		target.EmitEvents(target.FailureEvents(clock.Now()))
+		target.EmitEvents(target.CanaryEvents(clock.Now()))
+		target.EmitEvents(target.DerivedEvents(results, clock.Now()))
+		target.Loop.CycleFinished(clock.Now())
+
+		// stop once the cycles of a bounded run are complete
+		cycles++
+		if target.MaxCycles > 0 && cycles >= target.MaxCycles {
+			return
+		}
 
-		// Trigger new checks every 15 seconds
-		<-throttle
+		// Trigger new checks every interval, on wall-clock boundaries when aligned
+		scheduled, ok = timer.Wait(ctx.Done())
 	}
 }
 
 // LogDomainHealth is a method for HealthCheckTargets that iterates through the Domains linked list.
 // It computes the cumulative domain availability of each domain over the lifetime of the process,
-// rounding to the nearest whole number. Each domain's availability is printed to the console.
+// rounding to the nearest whole number. Each domain's availability is printed to the console,
+// followed by the percentiles of its recent latencies and of its latencies within each of the
+// latency_windows, and by its availability within the current and previous availability_periods.
 func (target *HealthCheckTargets) LogDomainHealth() {
 	domain := target.Domains
+	now := time.Now()
+	location := target.Settings.AvailabilityLocation()
 
 	for domain != nil {
 		// An empty domains should not exist. If they do, don't report on them.
@@ -441,33 +3338,134 @@ func (target *HealthCheckTargets) LogDomainHealth() {
 			continue
 		}
 
-		// If no requests have been run for a domain, report 0% availability.
-		var availability int = 0
+		fmt.Printf("%s has %d%% availability percentage\n", domain.Name, domain.Availability())
+
+		// report degraded checks separately from failed checks, when there are any
+		if domain.DegradedCount > 0 {
+			fmt.Printf("%s has %d degraded and %d failed checks\n", domain.Name, domain.DegradedCount, domain.FailedCount())
+		}
+
+		// report the latency distribution of the recent checks
+		if summary := domain.LatencySummary(); summary.Count > 0 {
+			fmt.Printf("%s has latency %s\n", domain.Name, summary)
+		}
+		for _, summary := range domain.LatencyWindowSummaries(now, target.Settings.LatencyWindows) {
+			fmt.Printf("%s has latency %s over %s\n", domain.Name, summary.LatencySummary, FormatLatencyWindow(summary.Window))
+		}
+
+		// report the availability of the current and previous calendar periods
+		for _, summary := range domain.PeriodSummaries(now, target.Settings.AvailabilityPeriods, location) {
+			if summary.TotalRequests > 0 {
+				fmt.Printf("%s has %d%% availability percentage %s\n", domain.Name, summary.Availability(), summary.CurrentLabel())
+			}
+			if summary.Previous != nil {
+				fmt.Printf("%s had %d%% availability percentage %s\n", domain.Name, summary.Previous.Availability(), summary.PreviousLabel())
+			}
+		}
 
-		if domain.TotalRequests != 0 {
-			availability = int(math.Round(100 * float64(domain.UpCount) / float64(domain.TotalRequests)))
+		// report per address family results of dual-stack endpoints
+		for _, family := range domain.FamilyNames() {
+			stats := domain.Families[family]
+			fmt.Printf("%s (%s) has %d%% availability percentage\n", domain.Name, family, stats.Availability())
 		}
 
-		fmt.Printf("%s has %d%% availability percentage\n", domain.Name, availability)
+		// report the results of the fallback checks made while endpoints were down
+		if domain.Fallback != nil {
+			fmt.Printf("%s (fallback) has %d%% availability percentage\n", domain.Name, domain.Fallback.Availability())
+		}
 
 		domain = domain.Next
 	}
 }
 
-// Main entry point when the program is executed directly. It will run GetConfig to get the
-// endpoint configuration from a provided file. Then, it'll create HealthCheckTargets object based
-// on the configuration and use RunCheckHealth until the program is exited by terminating the
-// program.
+// Main entry point when the program is executed directly. Subcommands (e.g. demo, version) are
+// dispatched first. Otherwise, it will run GetConfig to get the endpoint configuration from a
+// provided file. Then, it'll create HealthCheckTargets object based on the configuration and use
+// RunCheckHealth until the program is exited by terminating the program.
 func main() {
-	endpoint_config, err := GetConfig()
+	// dispatch registered subcommands before treating the argument as a configuration file
+	if len(os.Args) > 1 {
+		if command, ok := LookupCommand(os.Args[1]); ok {
+			if err := command.Run(os.Args[2:]); err != nil {
+				log.Fatalf("ERROR: %v\n", err)
+			}
+			return
+		}
+	}
+
+	config, err := GetConfig()
 	if err != nil {
 		log.Fatalf("ERROR: %v\n", err)
 	}
+	if err := ConfigureLogging(os.Stderr, config.LogLevel, config.LogFormat); err != nil {
+		log.Fatalf("ERROR: %v\n", err)
+	}
 
-	targets, err := endpoint_config.CreateNewTargets()
+	targets, err := config.Endpoints.CreateNewTargets()
 	if err != nil {
 		log.Fatalf("ERROR: %v\n", err)
 	}
+	targets.Settings = config.Settings
+	targets.Source = config.Source
+	targets.Skipped = config.Skipped
+	targets.LoadState()
 
-	targets.RunCheckHealth()
+	if config.SigningKey != "" {
+		targets.Signer, err = LoadEventSigner(config.SigningKey)
+		if err != nil {
+			log.Fatalf("ERROR: %v\n", err)
+		}
+	}
+
+	// the metrics server, check history, sinks and notifiers are retried in the background when
+	// they fail to start, unless strict_integrations is set
+	err = targets.OpenIntegrations()
+	if err != nil {
+		log.Fatalf("ERROR: %v\n", err)
+	}
+
+	// stop checking when the program is terminated, once the cycle in progress is complete. A
+	// second signal terminates the program at once.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	// bound the run to a single cycle with -once, or to the cycles started within -duration
+	run_ctx := ctx
+	if config.Once {
+		targets.MaxCycles = 1
+	}
+	if config.Duration > 0 {
+		var cancel context.CancelFunc
+		run_ctx, cancel = context.WithTimeout(ctx, config.Duration)
+		defer cancel()
+	}
+
+	// preload the pending configuration swapped to on SIGUSR2
+	next, err := LoadNextConfig(config)
+	if err != nil {
+		log.Fatalf("ERROR: %v\n", err)
+	}
+
+	// reload the configuration file on SIGHUP
+	targets.Reloads = WatchReloads(config.args, next)
+
+	targets.RunCheckHealth(run_ctx, SystemClock)
+
+	// flush the sinks, notifiers and check history, and save the state and the run report, before
+	// exiting, printing the report with the junit output
+	targets.SaveState()
+	targets.SaveReport()
+	targets.LogRunReport()
+	targets.History.Close()
+	targets.SQLite.Close()
+	targets.CloseNotifiers()
+	targets.CloseSinks()
+
+	// let CI jobs gate on the outcome of a bounded run
+	if (config.Once || config.Duration > 0) && !targets.Run.Report(time.Now(), nil).Passed {
+		os.Exit(1)
+	}
 }
@@ -1,12 +1,14 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
@@ -15,10 +17,16 @@ import (
 
 func TestGetConfig(t *testing.T) {
 	cases := []struct {
-		name           string
-		args           []string
-		expectedFail   bool
-		expectedConfig Endpoints
+		name               string
+		args               []string
+		expectedFail       bool
+		expectedConfig     Endpoints
+		expectedOutput     string
+		expectedInterval   time.Duration
+		expectedMaxLatency time.Duration
+		expectedListen     string
+		expectedStateFile  string
+		expectedReportFile string
 	}{
 		{
 			name:         "No Arguments Provided",
@@ -41,9 +49,81 @@ func TestGetConfig(t *testing.T) {
 			expectedFail: true,
 		},
 		{
-			name:         "General Case",
-			args:         []string{"CheckHealth", "config.yaml"},
-			expectedFail: false,
+			name:         "Unsupported Output Format",
+			args:         []string{"CheckHealth", "-output", "xml", "config.yaml"},
+			expectedFail: true,
+		},
+		{
+			name:         "Invalid Interval",
+			args:         []string{"CheckHealth", "-interval", "fast", "config.yaml"},
+			expectedFail: true,
+		},
+		{
+			name:         "Negative Max Latency",
+			args:         []string{"CheckHealth", "-max-latency", "-1s", "config.yaml"},
+			expectedFail: true,
+		},
+		{
+			name:         "Max Latency Exceeds Interval",
+			args:         []string{"CheckHealth", "-interval", "1s", "-max-latency", "2s", "config.yaml"},
+			expectedFail: true,
+		},
+		{
+			name:         "Undefined Environment",
+			args:         []string{"CheckHealth", "-env", "staging", "config.yaml"},
+			expectedFail: true,
+		},
+		{
+			name:         "Unknown Flag",
+			args:         []string{"CheckHealth", "-foo", "config.yaml"},
+			expectedFail: true,
+		},
+		{
+			name:               "JSON Output",
+			args:               []string{"CheckHealth", "-output", "json", "-interval", "1m", "-max-latency", "250ms", "-listen", ":9100", "-state-file", "state.json", "-report", "report.xml", "config.yaml"},
+			expectedFail:       false,
+			expectedOutput:     OutputJSON,
+			expectedInterval:   time.Minute,
+			expectedMaxLatency: 250 * time.Millisecond,
+			expectedListen:     ":9100",
+			expectedStateFile:  "state.json",
+			expectedReportFile: "report.xml",
+			expectedConfig: Endpoints{
+				{
+					Name:    "fetch.com index page",
+					Url:     "https://fetch.com/",
+					Method:  "GET",
+					Headers: map[string]string{"user-agent": "fetch-synthetic-monitor"},
+				},
+				{
+					Name:    "fetch.com careers page",
+					Url:     "https://fetch.com/careers",
+					Method:  "GET",
+					Headers: map[string]string{"user-agent": "fetch-synthetic-monitor"},
+				},
+				{
+					Name:   "fetch.com some post endpoint",
+					Url:    "https://fetch.com/some/post/endpoint",
+					Method: "POST",
+					Headers: map[string]string{
+						"content-type": "application/json",
+						"user-agent":   "fetch-synthetic-monitor",
+					},
+					Body: `{"foo":"bar"}`,
+				},
+				{
+					Name: "www.fetchrewards.com index page",
+					Url:  "https://www.fetchrewards.com/",
+				},
+			},
+		},
+		{
+			name:               "General Case",
+			args:               []string{"CheckHealth", "config.yaml"},
+			expectedFail:       false,
+			expectedOutput:     OutputText,
+			expectedInterval:   DefaultCheckInterval,
+			expectedMaxLatency: DefaultMaxLatency,
 			expectedConfig: Endpoints{
 				{
 					Name:    "fetch.com index page",
@@ -90,7 +170,13 @@ func TestGetConfig(t *testing.T) {
 			}
 
 			// validate expected output
-			assert.Equal(t, config, tc.expectedConfig)
+			assert.Equal(t, config.Endpoints, tc.expectedConfig)
+			assert.Equal(t, config.Settings.Output, tc.expectedOutput)
+			assert.Equal(t, config.Settings.Interval, tc.expectedInterval)
+			assert.Equal(t, config.Settings.MaxLatency, tc.expectedMaxLatency)
+			assert.Equal(t, config.Settings.Listen, tc.expectedListen)
+			assert.Equal(t, config.Settings.StateFile, tc.expectedStateFile)
+			assert.Equal(t, config.Settings.ReportFile, tc.expectedReportFile)
 
 			// swap os.Args back in place
 			os.Args = actualArgs
@@ -170,6 +256,188 @@ func TestCreateRequest(t *testing.T) {
 	}
 }
 
+func TestCreateRequestStreamedBody(t *testing.T) {
+	body_file := t.TempDir() + "/payload.json"
+	err := os.WriteFile(body_file, []byte(`{"foo":"bar"}`), 0644)
+	assert.Equal(t, err, nil)
+
+	generated := 0
+	source := func() (io.ReadCloser, error) {
+		generated++
+		return io.NopCloser(strings.NewReader(`{"generated":true}`)), nil
+	}
+
+	cases := []struct {
+		name                  string
+		endpoint              Endpoint
+		expectedFail          bool
+		expectedBody          string
+		expectedContentLength int64
+	}{
+		{
+			name: "Body File",
+			endpoint: Endpoint{
+				Url:      "http://example.com/",
+				Method:   "POST",
+				BodyFile: body_file,
+			},
+			expectedBody:          `{"foo":"bar"}`,
+			expectedContentLength: 13,
+		},
+		{
+			name: "Body Source",
+			endpoint: Endpoint{
+				Url:        "http://example.com/",
+				Method:     "POST",
+				BodySource: source,
+			},
+			expectedBody:          `{"generated":true}`,
+			expectedContentLength: -1,
+		},
+		{
+			name: "Missing Body File",
+			endpoint: Endpoint{
+				Url:      "http://example.com/",
+				BodyFile: body_file + ".missing",
+			},
+			expectedFail: true,
+		},
+		{
+			name: "Body And Body File",
+			endpoint: Endpoint{
+				Url:      "http://example.com/",
+				Body:     `{"foo":"bar"}`,
+				BodyFile: body_file,
+			},
+			expectedFail: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			request, err := tc.endpoint.CreateRequest(context.Background())
+			if tc.expectedFail {
+				assert.NotEqual(t, err, nil)
+				return
+			}
+			assert.Equal(t, err, nil)
+			assert.Equal(t, request.ContentLength, tc.expectedContentLength)
+
+			// the body can be read, and reopened for redirects and retries
+			for i := 0; i < 2; i++ {
+				content, err := io.ReadAll(request.Body)
+				assert.Equal(t, err, nil)
+				assert.Equal(t, string(content), tc.expectedBody)
+				assert.Equal(t, request.Body.Close(), nil)
+
+				request.Body, err = request.GetBody()
+				assert.Equal(t, err, nil)
+			}
+		})
+	}
+
+	// the generator is called for every new stream
+	assert.Equal(t, generated, 3)
+}
+
+func TestRequestTemplate(t *testing.T) {
+	endpoint := Endpoint{
+		Url:     "http://example.com/path?query=1",
+		Method:  "POST",
+		Headers: map[string]string{"user-agent": "fetch-synthetic-monitor"},
+		Body:    `{"foo":"bar"}`,
+	}
+
+	template, err := endpoint.CompileRequest()
+	assert.Equal(t, err, nil)
+	endpoint.Template = template
+
+	first, err := endpoint.CreateRequest(context.Background())
+	assert.Equal(t, err, nil)
+
+	// modifying a request must not leak into the template or later requests
+	first.Header.Set("User-Agent", "modified")
+	first.URL.Path = "/modified"
+
+	second, err := endpoint.CreateRequest(context.Background())
+	assert.Equal(t, err, nil)
+	assert.Equal(t, second.Method, "POST")
+	assert.Equal(t, second.URL.String(), "http://example.com/path?query=1")
+	assert.Equal(t, second.Header.Get("User-Agent"), "fetch-synthetic-monitor")
+	assert.Equal(t, second.ContentLength, int64(13))
+
+	// every request gets its own body stream
+	first_body, err := io.ReadAll(first.Body)
+	assert.Equal(t, err, nil)
+	second_body, err := io.ReadAll(second.Body)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, string(first_body), `{"foo":"bar"}`)
+	assert.Equal(t, string(second_body), `{"foo":"bar"}`)
+}
+
+func BenchmarkCreateRequest(b *testing.B) {
+	endpoint := Endpoint{
+		Url:     "https://fetch.com/some/post/endpoint",
+		Method:  "POST",
+		Headers: map[string]string{"content-type": "application/json", "user-agent": "fetch-synthetic-monitor"},
+		Body:    `{"foo":"bar"}`,
+	}
+
+	b.Run("Uncompiled", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := endpoint.CreateRequest(context.Background()); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("Template", func(b *testing.B) {
+		template, err := endpoint.CompileRequest()
+		if err != nil {
+			b.Fatal(err)
+		}
+		compiled := endpoint
+		compiled.Template = template
+
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := compiled.CreateRequest(context.Background()); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func TestGetEndpointHealthBodyFile(t *testing.T) {
+	body_file := t.TempDir() + "/payload.bin"
+	payload := bytes.Repeat([]byte("checkhealth"), 100000)
+	err := os.WriteFile(body_file, payload, 0644)
+	assert.Equal(t, err, nil)
+
+	mock_server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		content, err := io.ReadAll(r.Body)
+		if err != nil || !bytes.Equal(content, payload) {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer mock_server.Close()
+
+	endpoint := Endpoint{
+		Name:     "Upload Test",
+		Url:      mock_server.URL,
+		Method:   "PUT",
+		BodyFile: body_file,
+		Domain:   &Domain{Name: "127.0.0.1"},
+	}
+
+	// the file is streamed again on every check
+	endpoint.Domain.RecordResult(endpoint.GetEndpointHealth(2 * time.Second))
+	endpoint.Domain.RecordResult(endpoint.GetEndpointHealth(2 * time.Second))
+	assert.Equal(t, endpoint.Domain.UpCount, 2)
+	assert.Equal(t, endpoint.Domain.TotalRequests, 2)
+}
+
 func TestCreateNewTargets(t *testing.T) {
 	tc := struct {
 		name                   string
@@ -342,6 +610,30 @@ func TestGetDomainPointer(t *testing.T) {
 	}
 }
 
+func TestGetGroupPointer(t *testing.T) {
+	endpoints := Endpoints{
+		{Name: "fetch.com index page", Url: "https://fetch.com/", Group: "fetch"},
+		{Name: "www.fetch.com index page", Url: "https://www.fetch.com/", Group: "fetch"},
+		{Name: "fetch.com careers page", Url: "https://fetch.com/careers"},
+	}
+	targets, err := endpoints.CreateNewTargets()
+	assert.Equal(t, err, nil)
+
+	// the grouped endpoints share a domain named after their group
+	assert.Equal(t, targets.Domains.Name, "fetch")
+	assert.Equal(t, targets.Domains.Next.Name, "fetch.com")
+	assert.Equal(t, targets.Domains.Next.Next, nil)
+	assert.Equal(t, endpoints[0].Domain == endpoints[1].Domain, true)
+	assert.Equal(t, endpoints[2].Domain.Name, "fetch.com")
+
+	// blank groups are rejected
+	_, err = targets.GetGroupPointer(" ")
+	assert.NotEqual(t, err, nil)
+	var nil_target *HealthCheckTargets
+	_, err = nil_target.GetGroupPointer("fetch")
+	assert.NotEqual(t, err, nil)
+}
+
 func TestUpdateDomainStats(t *testing.T) {
 	cases := []struct {
 		name          string
@@ -452,25 +744,39 @@ func TestGetEndpointHealth(t *testing.T) {
 		},
 	}
 
-	// make multiple requests and validate domain counts
-	endpoint.GetEndpointHealth(500 * time.Millisecond)
+	// make multiple requests and validate results and domain counts
+	result := endpoint.GetEndpointHealth(500 * time.Millisecond)
+	assert.Equal(t, result.Status, StatusUp)
+	assert.Equal(t, result.StatusCode, http.StatusOK)
+	assert.Equal(t, result.Endpoint, "Mock Test")
+	assert.Equal(t, result.RemoteIP, domain_name)
+	assert.Equal(t, result.FinishedAt.Before(result.StartedAt), false)
+
+	// checks don't modify the domain until their result is recorded
+	assert.Equal(t, endpoint.Domain.TotalRequests, 0)
+	endpoint.Domain.RecordResult(result)
 	assert.Equal(t, endpoint.Domain.UpCount, 1)
 	assert.Equal(t, endpoint.Domain.TotalRequests, 1)
 
-	endpoint.GetEndpointHealth(500 * time.Millisecond)
+	endpoint.Domain.RecordResult(endpoint.GetEndpointHealth(500 * time.Millisecond))
 	assert.Equal(t, endpoint.Domain.UpCount, 2)
 	assert.Equal(t, endpoint.Domain.TotalRequests, 2)
 
 	delay = true
-	endpoint.GetEndpointHealth(500 * time.Millisecond)
+	result = endpoint.GetEndpointHealth(500 * time.Millisecond)
+	assert.Equal(t, result.Status, StatusDown)
+	assert.Equal(t, result.ErrorKind, ErrorKindTimeout)
+	endpoint.Domain.RecordResult(result)
 	assert.Equal(t, endpoint.Domain.UpCount, 2)
 	assert.Equal(t, endpoint.Domain.TotalRequests, 3)
 
-	endpoint.GetEndpointHealth(600 * time.Millisecond)
+	endpoint.Domain.RecordResult(endpoint.GetEndpointHealth(600 * time.Millisecond))
 	assert.Equal(t, endpoint.Domain.UpCount, 2)
 	assert.Equal(t, endpoint.Domain.TotalRequests, 4)
 
-	endpoint.GetEndpointHealth(610 * time.Millisecond)
+	result = endpoint.GetEndpointHealth(610 * time.Millisecond)
+	assert.Equal(t, result.Latency >= 600*time.Millisecond, true)
+	endpoint.Domain.RecordResult(result)
 	assert.Equal(t, endpoint.Domain.UpCount, 3)
 	assert.Equal(t, endpoint.Domain.TotalRequests, 5)
 }
@@ -535,6 +841,21 @@ func ExampleHealthCheckTargets_LogDomainHealth_multipleDomains() {
 	// localhost has 67% availability percentage
 }
 
+func ExampleHealthCheckTargets_LogDomainHealth_latency() {
+	domain := &Domain{Name: "example.com", UpCount: 2, TotalRequests: 2}
+	domain.RecordLatency(120 * time.Millisecond)
+	domain.RecordLatency(480500 * time.Microsecond)
+	var target *HealthCheckTargets = &HealthCheckTargets{
+		Domains:   domain,
+		Endpoints: nil,
+	}
+
+	target.LogDomainHealth()
+	// Output:
+	// example.com has 100% availability percentage
+	// example.com has latency p50 120ms, p95 481ms, p99 481ms, max 481ms
+}
+
 func ExampleHealthCheckTargets_LogDomainHealth_zeroTotalRequests() {
 	var target *HealthCheckTargets = &HealthCheckTargets{
 		Domains: &Domain{
@@ -550,3 +871,25 @@ func ExampleHealthCheckTargets_LogDomainHealth_zeroTotalRequests() {
 	// Output:
 	// example.com has 0% availability percentage
 }
+
+func ExampleHealthCheckTargets_LogDomainHealth_dualStack() {
+	var target *HealthCheckTargets = &HealthCheckTargets{
+		Domains: &Domain{
+			Name:          "example.com",
+			UpCount:       1,
+			TotalRequests: 2,
+			Families: map[string]*FamilyStats{
+				FamilyIPv6: {UpCount: 1, TotalRequests: 2},
+				FamilyIPv4: {UpCount: 2, TotalRequests: 2},
+			},
+			Next: nil,
+		},
+		Endpoints: nil,
+	}
+
+	target.LogDomainHealth()
+	// Output:
+	// example.com has 50% availability percentage
+	// example.com (ipv4) has 100% availability percentage
+	// example.com (ipv6) has 50% availability percentage
+}
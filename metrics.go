@@ -0,0 +1,451 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MetricsContentType is the content type of the Prometheus text exposition format served on
+// /metrics.
+const MetricsContentType string = "text/plain; version=0.0.4; charset=utf-8"
+
+// DefaultLatencyBuckets are the upper bounds, in seconds, of the endpoint latency histogram
+// buckets.
+var DefaultLatencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Metrics accumulates the per-endpoint counters and latency histograms published on /metrics.
+// Gauges derived from the endpoint states and domain statistics are read when metrics are
+// written, so they are never stale.
+type Metrics struct {
+	mutex     sync.Mutex
+	buckets   []float64
+	endpoints map[string]*endpointMetrics
+}
+
+// endpointMetrics are the counters and latency histogram of a single endpoint.
+type endpointMetrics struct {
+	name     string
+	url      string
+	up       float64
+	checked  bool
+	checks   uint64
+	retries  uint64
+	failures map[string]uint64
+	buckets  []uint64
+	count    uint64
+	sum      float64
+
+	// redirects and redirect_seconds are the redirects followed by the checks and the time spent
+	// on them.
+	redirects        uint64
+	redirect_seconds float64
+
+	// endpoint_labels are the labels of the endpoint, added to its metrics.
+	endpoint_labels map[string]string
+}
+
+// NewMetrics returns an empty Metrics using DefaultLatencyBuckets.
+func NewMetrics() *Metrics {
+	return &Metrics{
+		buckets:   DefaultLatencyBuckets,
+		endpoints: map[string]*endpointMetrics{},
+	}
+}
+
+// Observe is a method for Metrics that records the results of a check cycle of the endpoints, in
+// the same order, whose labels are added to their metrics. Degraded results count as up, since
+// they count as available. Unknown results count as checks, but don't change whether the endpoint
+// is up. Nil metrics are ignored.
+func (metrics *Metrics) Observe(results []CheckResult, endpoints *Endpoints) {
+	if metrics == nil {
+		return
+	}
+
+	metrics.mutex.Lock()
+	defer metrics.mutex.Unlock()
+
+	for i, result := range results {
+		key := result.Endpoint + "\x00" + result.Url
+		endpoint, ok := metrics.endpoints[key]
+		if !ok {
+			endpoint = &endpointMetrics{
+				name:     result.Endpoint,
+				url:      result.Url,
+				failures: map[string]uint64{},
+				buckets:  make([]uint64, len(metrics.buckets)),
+			}
+			metrics.endpoints[key] = endpoint
+		}
+		if endpoints != nil && i < len(*endpoints) {
+			endpoint.endpoint_labels = (*endpoints)[i].Labels
+		}
+
+		endpoint.checks++
+		endpoint.retries += uint64(result.Retries)
+		endpoint.redirects += uint64(len(result.Redirects))
+		endpoint.redirect_seconds += result.RedirectLatency().Seconds()
+		switch result.Status {
+		case StatusUp, StatusDegraded:
+			endpoint.up, endpoint.checked = 1, true
+		case StatusDown:
+			endpoint.up, endpoint.checked = 0, true
+			endpoint.failures[result.ErrorKind]++
+		}
+
+		if result.Latency > 0 {
+			seconds := result.Latency.Seconds()
+			for i, bound := range metrics.buckets {
+				if seconds <= bound {
+					endpoint.buckets[i]++
+				}
+			}
+			endpoint.count++
+			endpoint.sum += seconds
+		}
+	}
+}
+
+// Forget is a method for Metrics that drops the metrics of an endpoint that is no longer checked.
+// Nil metrics are ignored.
+func (metrics *Metrics) Forget(name string, url string) {
+	if metrics == nil {
+		return
+	}
+
+	metrics.mutex.Lock()
+	defer metrics.mutex.Unlock()
+	delete(metrics.endpoints, name+"\x00"+url)
+}
+
+// sortedEndpoints returns the endpoint metrics ordered by name and URL, so the output is stable.
+func (metrics *Metrics) sortedEndpoints() []*endpointMetrics {
+	endpoints := make([]*endpointMetrics, 0, len(metrics.endpoints))
+	for _, endpoint := range metrics.endpoints {
+		endpoints = append(endpoints, endpoint)
+	}
+	sort.Slice(endpoints, func(i, j int) bool {
+		if endpoints[i].name != endpoints[j].name {
+			return endpoints[i].name < endpoints[j].name
+		}
+		return endpoints[i].url < endpoints[j].url
+	})
+	return endpoints
+}
+
+// WriteMetrics is a method for HealthCheckTargets that writes the endpoint and domain metrics to w
+// in the Prometheus text exposition format.
+func (target *HealthCheckTargets) WriteMetrics(w io.Writer) error {
+	var builder strings.Builder
+
+	if metrics := target.Metrics; metrics != nil {
+		metrics.mutex.Lock()
+		endpoints := metrics.sortedEndpoints()
+
+		writeMetricHeader(&builder, "checkhealth_endpoint_up", "gauge", "Whether the last check of the endpoint succeeded.")
+		for _, endpoint := range endpoints {
+			if endpoint.checked {
+				writeMetric(&builder, "checkhealth_endpoint_up", endpoint.labels(), endpoint.up)
+			}
+		}
+
+		writeMetricHeader(&builder, "checkhealth_endpoint_checks_total", "counter", "The number of checks of the endpoint.")
+		for _, endpoint := range endpoints {
+			writeMetric(&builder, "checkhealth_endpoint_checks_total", endpoint.labels(), float64(endpoint.checks))
+		}
+
+		writeMetricHeader(&builder, "checkhealth_endpoint_retries_total", "counter", "The number of retries of failed checks of the endpoint within their cycle.")
+		for _, endpoint := range endpoints {
+			writeMetric(&builder, "checkhealth_endpoint_retries_total", endpoint.labels(), float64(endpoint.retries))
+		}
+
+		writeMetricHeader(&builder, "checkhealth_endpoint_redirects_total", "counter", "The number of redirects followed by the checks of the endpoint.")
+		for _, endpoint := range endpoints {
+			writeMetric(&builder, "checkhealth_endpoint_redirects_total", endpoint.labels(), float64(endpoint.redirects))
+		}
+
+		writeMetricHeader(&builder, "checkhealth_endpoint_redirect_seconds_total", "counter", "The time spent on the redirects followed by the checks of the endpoint.")
+		for _, endpoint := range endpoints {
+			writeMetric(&builder, "checkhealth_endpoint_redirect_seconds_total", endpoint.labels(), endpoint.redirect_seconds)
+		}
+
+		writeMetricHeader(&builder, "checkhealth_endpoint_failures_total", "counter", "The number of failed checks of the endpoint by error kind.")
+		for _, endpoint := range endpoints {
+			kinds := make([]string, 0, len(endpoint.failures))
+			for kind := range endpoint.failures {
+				kinds = append(kinds, kind)
+			}
+			sort.Strings(kinds)
+			for _, kind := range kinds {
+				labels := append(endpoint.labels(), "kind", kind)
+				writeMetric(&builder, "checkhealth_endpoint_failures_total", labels, float64(endpoint.failures[kind]))
+			}
+		}
+
+		writeMetricHeader(&builder, "checkhealth_endpoint_latency_seconds", "histogram", "The latency of the endpoint checks.")
+		for _, endpoint := range endpoints {
+			for i, bound := range metrics.buckets {
+				labels := append(endpoint.labels(), "le", strconv.FormatFloat(bound, 'g', -1, 64))
+				writeMetric(&builder, "checkhealth_endpoint_latency_seconds_bucket", labels, float64(endpoint.buckets[i]))
+			}
+			writeMetric(&builder, "checkhealth_endpoint_latency_seconds_bucket", append(endpoint.labels(), "le", "+Inf"), float64(endpoint.count))
+			writeMetric(&builder, "checkhealth_endpoint_latency_seconds_sum", endpoint.labels(), endpoint.sum)
+			writeMetric(&builder, "checkhealth_endpoint_latency_seconds_count", endpoint.labels(), float64(endpoint.count))
+		}
+		metrics.mutex.Unlock()
+	}
+
+	writeMetricHeader(&builder, "checkhealth_endpoint_state", "gauge", "The state of the endpoint, set to 1 for the current state.")
+	for _, status := range target.EndpointStates() {
+		for _, state := range []string{StateUnknown, StateUp, StateDegraded, StateDown} {
+			value := 0.0
+			if status.State == state {
+				value = 1
+			}
+			labels := endpointLabels(status.Endpoint, status.Url, status.Labels, "state", state)
+			writeMetric(&builder, "checkhealth_endpoint_state", labels, value)
+		}
+	}
+	writeMetricHeader(&builder, "checkhealth_endpoint_abandoned", "gauge", "Whether the checks of the endpoint are paused after it stayed DOWN for its abandon_after.")
+	for _, status := range target.EndpointStates() {
+		value := 0.0
+		if status.AbandonedAt != nil {
+			value = 1
+		}
+		writeMetric(&builder, "checkhealth_endpoint_abandoned", endpointLabels(status.Endpoint, status.Url, status.Labels), value)
+	}
+	writeMetricHeader(&builder, "checkhealth_endpoint_phase_seconds", "gauge", "The time spent in each phase of the last HTTP check of the endpoint: dns, connect, tls and first_byte.")
+	for _, status := range target.EndpointStates() {
+		if status.Timing == nil {
+			continue
+		}
+		phases := []struct {
+			name string
+			ms   float64
+		}{{"dns", status.Timing.DNSMs}, {"connect", status.Timing.ConnectMs}, {"tls", status.Timing.TLSMs}, {"first_byte", status.Timing.FirstByteMs}}
+		for _, phase := range phases {
+			writeMetric(&builder, "checkhealth_endpoint_phase_seconds", endpointLabels(status.Endpoint, status.Url, status.Labels, "phase", phase.name), phase.ms/1000)
+		}
+	}
+
+	scheduled := []EndpointStatus{}
+	for _, status := range target.EndpointStates() {
+		if status.Schedule != nil {
+			scheduled = append(scheduled, status)
+		}
+	}
+	writeMetricHeader(&builder, "checkhealth_endpoint_schedule_fidelity_ratio", "gauge", "The ratio of the scheduled checks of the endpoint made on time, between 0 and 1.")
+	for _, status := range scheduled {
+		labels := endpointLabels(status.Endpoint, status.Url, status.Labels)
+		writeMetric(&builder, "checkhealth_endpoint_schedule_fidelity_ratio", labels, status.Schedule.Fidelity)
+	}
+	writeMetricHeader(&builder, "checkhealth_endpoint_checks_delayed_total", "counter", "The number of checks of the endpoint that were made late.")
+	for _, status := range scheduled {
+		labels := endpointLabels(status.Endpoint, status.Url, status.Labels)
+		writeMetric(&builder, "checkhealth_endpoint_checks_delayed_total", labels, float64(status.Schedule.Delayed))
+	}
+	writeMetricHeader(&builder, "checkhealth_endpoint_checks_skipped_total", "counter", "The number of scheduled checks of the endpoint that weren't made.")
+	for _, status := range scheduled {
+		labels := endpointLabels(status.Endpoint, status.Url, status.Labels)
+		writeMetric(&builder, "checkhealth_endpoint_checks_skipped_total", labels, float64(status.Schedule.Skipped))
+	}
+
+	writeMetricHeader(&builder, "checkhealth_component_up", "gauge", "Whether a component reported by the endpoint's health+json response is passing or warning.")
+	for _, status := range target.EndpointStates() {
+		for _, component := range status.Components {
+			value := 0.0
+			if component.Status == HealthPass || component.Status == HealthWarn {
+				value = 1
+			}
+			labels := endpointLabels(status.Endpoint, status.Url, status.Labels, "component", component.Name)
+			writeMetric(&builder, "checkhealth_component_up", labels, value)
+		}
+	}
+
+	domain_stats.Lock()
+	writeMetricHeader(&builder, "checkhealth_domain_availability_ratio", "gauge", "The cumulative availability of the domain, between 0 and 1.")
+	for domain := target.Domains; domain != nil; domain = domain.Next {
+		if domain.Name != "" && domain.TotalRequests > 0 {
+			ratio := float64(domain.UpCount) / float64(domain.TotalRequests)
+			writeMetric(&builder, "checkhealth_domain_availability_ratio", []string{"domain", domain.Name}, ratio)
+		}
+	}
+	writeMetricHeader(&builder, "checkhealth_domain_checks_total", "counter", "The number of checks of the domain's endpoints with a known result.")
+	for domain := target.Domains; domain != nil; domain = domain.Next {
+		if domain.Name != "" {
+			writeMetric(&builder, "checkhealth_domain_checks_total", []string{"domain", domain.Name}, float64(domain.TotalRequests))
+		}
+	}
+	writeMetricHeader(&builder, "checkhealth_domain_up_checks_total", "counter", "The number of successful checks of the domain's endpoints.")
+	for domain := target.Domains; domain != nil; domain = domain.Next {
+		if domain.Name != "" {
+			writeMetric(&builder, "checkhealth_domain_up_checks_total", []string{"domain", domain.Name}, float64(domain.UpCount))
+		}
+	}
+	writeMetricHeader(&builder, "checkhealth_domain_unknown_checks_total", "counter", "The number of checks of the domain's endpoints with an unknown result.")
+	for domain := target.Domains; domain != nil; domain = domain.Next {
+		if domain.Name != "" {
+			writeMetric(&builder, "checkhealth_domain_unknown_checks_total", []string{"domain", domain.Name}, float64(domain.UnknownCount))
+		}
+	}
+	writeMetricHeader(&builder, "checkhealth_domain_degraded_checks_total", "counter", "The number of degraded checks of the domain's endpoints, also counted as successful.")
+	for domain := target.Domains; domain != nil; domain = domain.Next {
+		if domain.Name != "" {
+			writeMetric(&builder, "checkhealth_domain_degraded_checks_total", []string{"domain", domain.Name}, float64(domain.DegradedCount))
+		}
+	}
+	writeMetricHeader(&builder, "checkhealth_domain_sent_bytes_total", "counter", "The approximate bytes sent by the checks of the domain's endpoints.")
+	for domain := target.Domains; domain != nil; domain = domain.Next {
+		if domain.Name != "" {
+			writeMetric(&builder, "checkhealth_domain_sent_bytes_total", []string{"domain", domain.Name}, float64(domain.BytesSent))
+		}
+	}
+	writeMetricHeader(&builder, "checkhealth_domain_received_bytes_total", "counter", "The approximate bytes received by the checks of the domain's endpoints.")
+	for domain := target.Domains; domain != nil; domain = domain.Next {
+		if domain.Name != "" {
+			writeMetric(&builder, "checkhealth_domain_received_bytes_total", []string{"domain", domain.Name}, float64(domain.BytesReceived))
+		}
+	}
+	if windows := target.Settings.LatencyWindows; len(windows) > 0 {
+		now := time.Now()
+		writeMetricHeader(&builder, "checkhealth_domain_latency_seconds", "gauge", "The latency percentiles of the checks of the domain's endpoints within the window.")
+		for domain := target.Domains; domain != nil; domain = domain.Next {
+			if domain.Name == "" {
+				continue
+			}
+			for _, summary := range domain.Latency.WindowSummaries(now, windows) {
+				window := FormatLatencyWindow(summary.Window)
+				for _, quantile := range []struct {
+					name    string
+					latency time.Duration
+				}{{"0.5", summary.P50}, {"0.95", summary.P95}, {"0.99", summary.P99}, {"1", summary.Max}} {
+					labels := []string{"domain", domain.Name, "window", window, "quantile", quantile.name}
+					writeMetric(&builder, "checkhealth_domain_latency_seconds", labels, quantile.latency.Seconds())
+				}
+			}
+		}
+	}
+	if periods := target.Settings.AvailabilityPeriods; len(periods) > 0 {
+		now, location := time.Now(), target.Settings.AvailabilityLocation()
+		writeMetricHeader(&builder, "checkhealth_domain_period_availability_ratio", "gauge", "The availability of the domain within the current calendar period, between 0 and 1.")
+		for domain := target.Domains; domain != nil; domain = domain.Next {
+			if domain.Name == "" {
+				continue
+			}
+			for _, summary := range summarizePeriods(domain.Periods, now, periods, location) {
+				if summary.TotalRequests > 0 {
+					ratio := float64(summary.UpCount) / float64(summary.TotalRequests)
+					writeMetric(&builder, "checkhealth_domain_period_availability_ratio", []string{"domain", domain.Name, "period", summary.Period}, ratio)
+				}
+			}
+		}
+	}
+	writeMetricHeader(&builder, "checkhealth_endpoints_skipped", "gauge", "The number of invalid endpoints of the configuration that aren't checked.")
+	writeMetric(&builder, "checkhealth_endpoints_skipped", nil, float64(len(target.Skipped)))
+	domain_stats.Unlock()
+
+	integrations := target.IntegrationHealth()
+	writeMetricHeader(&builder, "checkhealth_integration_breaker_state", "gauge", "The state of the circuit breaker of the sink or notifier, set to 1 for the current state.")
+	for _, status := range integrations {
+		for _, state := range []string{BreakerClosed, BreakerHalfOpen, BreakerOpen} {
+			value := 0.0
+			if status.State == state {
+				value = 1
+			}
+			writeMetric(&builder, "checkhealth_integration_breaker_state", []string{"integration", status.Name, "state", state}, value)
+		}
+	}
+	writeMetricHeader(&builder, "checkhealth_integration_consecutive_failures", "gauge", "The number of consecutive failed calls to the sink or notifier.")
+	for _, status := range integrations {
+		writeMetric(&builder, "checkhealth_integration_consecutive_failures", []string{"integration", status.Name}, float64(status.ConsecutiveFailures))
+	}
+	writeMetricHeader(&builder, "checkhealth_integration_rejected_calls", "gauge", "The number of calls to the sink or notifier rejected by its open circuit breaker since it opened.")
+	for _, status := range integrations {
+		writeMetric(&builder, "checkhealth_integration_rejected_calls", []string{"integration", status.Name}, float64(status.Rejected))
+	}
+
+	_, err := io.WriteString(w, builder.String())
+	return err
+}
+
+// labels returns the endpoint and url label pairs of an endpoint, followed by its labels.
+func (endpoint *endpointMetrics) labels() []string {
+	return endpointLabels(endpoint.name, endpoint.url, endpoint.endpoint_labels)
+}
+
+// writeMetricHeader writes the HELP and TYPE lines of a metric.
+func writeMetricHeader(builder *strings.Builder, name string, kind string, help string) {
+	fmt.Fprintf(builder, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// writeMetric writes a sample of a metric, where labels alternate between names and values.
+func writeMetric(builder *strings.Builder, name string, labels []string, value float64) {
+	builder.WriteString(name)
+	if len(labels) > 0 {
+		builder.WriteByte('{')
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i > 0 {
+				builder.WriteByte(',')
+			}
+			fmt.Fprintf(builder, "%s=\"%s\"", labels[i], escapeLabelValue(labels[i+1]))
+		}
+		builder.WriteByte('}')
+	}
+	fmt.Fprintf(builder, " %s\n", strconv.FormatFloat(value, 'g', -1, 64))
+}
+
+// escapeLabelValue escapes backslashes, double quotes and line feeds in a label value.
+func escapeLabelValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+// MetricsHandler is a method for HealthCheckTargets that returns an http.Handler serving the
+// metrics in the Prometheus text exposition format.
+func (target *HealthCheckTargets) MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", MetricsContentType)
+		if err := target.WriteMetrics(w); err != nil {
+			log.Printf("Failed to write metrics: %v", err)
+		}
+	})
+}
+
+// Serve is a method for HealthCheckTargets that starts an HTTP server publishing /metrics, the
+// recent errors of the endpoints on /errors, the REST API under /api/v1/, the liveness and
+// readiness of the check loop on /healthz and /readyz, and the dashboard on / on the listen address
+// in the background. An error is returned if the address can't be listened on.
+func (target *HealthCheckTargets) Serve(listen string) (*http.Server, error) {
+	listener, err := net.Listen("tcp", listen)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %v", listen, err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", target.MetricsHandler())
+	mux.Handle("/errors", target.ErrorsHandler())
+	mux.Handle("/skipped", target.SkippedHandler())
+	mux.Handle(APIPrefix, target.APIHandler())
+	mux.Handle("/healthz", target.HealthzHandler())
+	mux.Handle("/readyz", target.ReadyzHandler())
+	mux.Handle("/", target.DashboardHandler())
+	server := &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			log.Printf("Metrics server stopped: %v", err)
+		}
+	}()
+
+	log.Printf("Serving metrics on http://%s/metrics and the dashboard on http://%s/", listener.Addr(), listener.Addr())
+	return server, nil
+}
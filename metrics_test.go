@@ -0,0 +1,200 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-playground/assert/v2"
+)
+
+func TestWriteMetrics(t *testing.T) {
+	endpoints := Endpoints{
+		{Name: "index", Url: "https://example.com/"},
+		{Name: "api \"v1\"", Url: "https://example.com/api"},
+	}
+	targets, err := endpoints.CreateNewTargets()
+	assert.Equal(t, err, nil)
+	targets.Metrics = NewMetrics()
+	targets.Settings.LatencyWindows = []time.Duration{5 * time.Minute}
+	targets.Settings.AvailabilityPeriods = []string{AvailabilityPeriodMonth}
+
+	results := []CheckResult{
+		{Endpoint: "index", Url: "https://example.com/", Status: StatusUp, Latency: 40 * time.Millisecond, FinishedAt: time.Now(), Timing: &CheckTiming{TLS: 12 * time.Millisecond, FirstByte: 38 * time.Millisecond}},
+		{Endpoint: "api \"v1\"", Url: "https://example.com/api", Status: StatusDown, ErrorKind: ErrorKindTimeout, Latency: 2 * time.Second, FinishedAt: time.Now()},
+	}
+	targets.RecordResults(results)
+	targets.Metrics.Observe(results, targets.Endpoints)
+	targets.Metrics.Observe([]CheckResult{{Endpoint: "index", Url: "https://example.com/", Status: StatusUnknown}}, targets.Endpoints)
+
+	var output strings.Builder
+	assert.Equal(t, targets.WriteMetrics(&output), nil)
+	metrics := output.String()
+
+	cases := []struct {
+		name     string
+		expected string
+	}{
+		{
+			name:     "Endpoint Up",
+			expected: `checkhealth_endpoint_up{endpoint="index",url="https://example.com/"} 1`,
+		},
+		{
+			name:     "Escaped Endpoint Down",
+			expected: `checkhealth_endpoint_up{endpoint="api \"v1\"",url="https://example.com/api"} 0`,
+		},
+		{
+			name:     "Unknown Results Counted As Checks",
+			expected: `checkhealth_endpoint_checks_total{endpoint="index",url="https://example.com/"} 2`,
+		},
+		{
+			name:     "Failures By Kind",
+			expected: `checkhealth_endpoint_failures_total{endpoint="api \"v1\"",url="https://example.com/api",kind="timeout"} 1`,
+		},
+		{
+			name:     "Latency Bucket",
+			expected: `checkhealth_endpoint_latency_seconds_bucket{endpoint="index",url="https://example.com/",le="0.05"} 1`,
+		},
+		{
+			name:     "Latency Bucket Below Observation",
+			expected: `checkhealth_endpoint_latency_seconds_bucket{endpoint="api \"v1\"",url="https://example.com/api",le="1"} 0`,
+		},
+		{
+			name:     "Latency Count",
+			expected: `checkhealth_endpoint_latency_seconds_count{endpoint="api \"v1\"",url="https://example.com/api"} 1`,
+		},
+		{
+			name:     "Phase",
+			expected: `checkhealth_endpoint_phase_seconds{endpoint="index",url="https://example.com/",phase="tls"} 0.012`,
+		},
+		{
+			name:     "Endpoint State",
+			expected: `checkhealth_endpoint_state{endpoint="api \"v1\"",url="https://example.com/api",state="DEGRADED"} 1`,
+		},
+		{
+			name:     "Domain Availability",
+			expected: `checkhealth_domain_availability_ratio{domain="example.com"} 0.5`,
+		},
+		{
+			name:     "Domain Checks",
+			expected: `checkhealth_domain_checks_total{domain="example.com"} 2`,
+		},
+		{
+			name:     "Domain Latency Window Median",
+			expected: `checkhealth_domain_latency_seconds{domain="example.com",window="5m",quantile="0.5"} 0.04`,
+		},
+		{
+			name:     "Domain Latency Window Max",
+			expected: `checkhealth_domain_latency_seconds{domain="example.com",window="5m",quantile="1"} 2`,
+		},
+		{
+			name:     "Domain Period Availability",
+			expected: `checkhealth_domain_period_availability_ratio{domain="example.com",period="month"} 0.5`,
+		},
+		{
+			name:     "Histogram Type",
+			expected: "# TYPE checkhealth_endpoint_latency_seconds histogram",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, strings.Contains(metrics, tc.expected+"\n"), true)
+		})
+	}
+}
+
+func TestWriteMetricsLabels(t *testing.T) {
+	endpoints := Endpoints{
+		{Name: "index", Url: "https://example.com/", Labels: map[string]string{"team": "web", "env": "prod"}},
+		{Name: "api", Url: "https://example.com/api"},
+	}
+	targets, err := endpoints.CreateNewTargets()
+	assert.Equal(t, err, nil)
+	targets.Metrics = NewMetrics()
+
+	results := []CheckResult{
+		{Endpoint: "index", Url: "https://example.com/", Status: StatusDown, ErrorKind: ErrorKindTimeout, Latency: time.Second, FinishedAt: time.Now()},
+		{Endpoint: "api", Url: "https://example.com/api", Status: StatusUp, Latency: 40 * time.Millisecond, FinishedAt: time.Now()},
+	}
+	targets.RecordResults(results)
+	targets.Metrics.Observe(results, targets.Endpoints)
+
+	var output strings.Builder
+	assert.Equal(t, targets.WriteMetrics(&output), nil)
+	metrics := output.String()
+
+	// labels follow the endpoint and url, in alphabetical order, before the labels of the metric
+	for _, expected := range []string{
+		`checkhealth_endpoint_up{endpoint="index",url="https://example.com/",env="prod",team="web"} 0`,
+		`checkhealth_endpoint_failures_total{endpoint="index",url="https://example.com/",env="prod",team="web",kind="timeout"} 1`,
+		`checkhealth_endpoint_latency_seconds_bucket{endpoint="index",url="https://example.com/",env="prod",team="web",le="+Inf"} 1`,
+		`checkhealth_endpoint_state{endpoint="index",url="https://example.com/",env="prod",team="web",state="DEGRADED"} 1`,
+		`checkhealth_endpoint_abandoned{endpoint="index",url="https://example.com/",env="prod",team="web"} 0`,
+		`checkhealth_endpoint_up{endpoint="api",url="https://example.com/api"} 1`,
+	} {
+		assert.Equal(t, strings.Contains(metrics, expected+"\n"), true)
+	}
+}
+
+func TestWriteMetricsWithoutMetrics(t *testing.T) {
+	endpoints := Endpoints{{Name: "index", Url: "https://example.com/"}}
+	targets, err := endpoints.CreateNewTargets()
+	assert.Equal(t, err, nil)
+
+	var output strings.Builder
+	assert.Equal(t, targets.WriteMetrics(&output), nil)
+	assert.Equal(t, strings.Contains(output.String(), `state="UNKNOWN"} 1`), true)
+	assert.Equal(t, strings.Contains(output.String(), "checkhealth_endpoint_up{"), false)
+
+	// observing without metrics is a no-op
+	targets.Metrics.Observe([]CheckResult{{Endpoint: "index", Status: StatusUp}}, nil)
+}
+
+func TestMetricsHandler(t *testing.T) {
+	endpoints := Endpoints{{Name: "index", Url: "https://example.com/"}}
+	targets, err := endpoints.CreateNewTargets()
+	assert.Equal(t, err, nil)
+	targets.Metrics = NewMetrics()
+
+	recorder := httptest.NewRecorder()
+	targets.MetricsHandler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	assert.Equal(t, recorder.Code, http.StatusOK)
+	assert.Equal(t, recorder.Header().Get("Content-Type"), MetricsContentType)
+	assert.Equal(t, strings.Contains(recorder.Body.String(), "# TYPE checkhealth_domain_checks_total counter"), true)
+}
+
+func TestServe(t *testing.T) {
+	endpoints := Endpoints{{Name: "index", Url: "https://example.com/"}}
+	targets, err := endpoints.CreateNewTargets()
+	assert.Equal(t, err, nil)
+	targets.Metrics = NewMetrics()
+
+	_, err = targets.Serve("256.0.0.1:0")
+	assert.NotEqual(t, err, nil)
+
+	server, err := targets.Serve("127.0.0.1:0")
+	assert.Equal(t, err, nil)
+	defer server.Close()
+
+	// the listener address is only known to the server, so connect through a test listener
+	listener := httptest.NewServer(server.Handler)
+	defer listener.Close()
+
+	response, err := http.Get(listener.URL + "/metrics")
+	assert.Equal(t, err, nil)
+	defer response.Body.Close()
+	body, err := io.ReadAll(response.Body)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, response.StatusCode, http.StatusOK)
+	assert.Equal(t, strings.Contains(string(body), "checkhealth_endpoint_state"), true)
+
+	response, err = http.Get(listener.URL + "/unknown")
+	assert.Equal(t, err, nil)
+	response.Body.Close()
+	assert.Equal(t, response.StatusCode, http.StatusNotFound)
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// NetnsDir is the directory holding the named network namespaces created by "ip netns add".
+const NetnsDir string = "/var/run/netns"
+
+// dialFunc is the signature of the function used by an HTTP transport to open connections.
+type dialFunc func(ctx context.Context, network string, address string) (net.Conn, error)
+
+// network_clients caches the HTTP clients bound to a network namespace or VRF device, by
+// namespace, device and 100-continue timeout, so connections are reused across checks.
+var network_clients = struct {
+	sync.Mutex
+	clients map[string]*http.Client
+}{
+	clients: map[string]*http.Client{},
+}
+
+// acceptsNetworkDefaults reports whether the netns and vrf of the settings apply to the endpoint:
+// HTTP endpoints that aren't dual-stack, don't send the PROXY protocol and don't use the retry DNS
+// failure policy, which can't be checked from a namespace or device, see validateEndpoint.
+func (endpoint *Endpoint) acceptsNetworkDefaults() bool {
+	return endpoint.checkType() == EndpointTypeHTTP && !endpoint.DualStack && endpoint.ProxyProtocol == "" && endpoint.DNSFailure != DNSFailureRetry
+}
+
+// NetworkClient returns an HTTP client whose connections are opened in the network namespace
+// netns and bound to the VRF (or any other network) device vrf, when they are set. It waits up to
+// expect_continue_timeout for a "100 Continue" response when it is positive. An error is returned
+// if the namespace doesn't exist, or when namespaces and devices aren't supported on this platform.
+func NetworkClient(netns string, vrf string, expect_continue_timeout time.Duration) (*http.Client, error) {
+	network_clients.Lock()
+	defer network_clients.Unlock()
+
+	key := fmt.Sprintf("%s\x00%s\x00%s", netns, vrf, expect_continue_timeout)
+	if client, ok := network_clients.clients[key]; ok {
+		return client, nil
+	}
+
+	dial, err := networkDialer(netns, vrf)
+	if err != nil {
+		return nil, err
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dial
+	if expect_continue_timeout > 0 {
+		transport.ExpectContinueTimeout = expect_continue_timeout
+	}
+
+	client := &http.Client{Transport: transport}
+	network_clients.clients[key] = client
+	return client, nil
+}
+
+// netnsPath returns the path of a network namespace, either a path such as /proc/1234/ns/net or
+// the name of a namespace in NetnsDir.
+func netnsPath(netns string) string {
+	if strings.Contains(netns, "/") {
+		return netns
+	}
+	return NetnsDir + "/" + netns
+}
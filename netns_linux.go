@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"runtime"
+	"syscall"
+	"time"
+)
+
+// networkDialer returns a dial function opening connections in the network namespace netns and
+// bound to the device vrf, when they are set.
+//
+// Sockets keep the namespace they were created in, so the dialing thread enters the namespace
+// only while the connection is opened. Host names are still resolved in the namespace of the
+// checker.
+func networkDialer(netns string, vrf string) (dialFunc, error) {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+
+	if vrf != "" {
+		dialer.Control = func(network string, address string, conn syscall.RawConn) error {
+			var bind_err error
+			err := conn.Control(func(fd uintptr) {
+				bind_err = syscall.SetsockoptString(int(fd), syscall.SOL_SOCKET, syscall.SO_BINDTODEVICE, vrf)
+			})
+			if err != nil {
+				return err
+			}
+			if bind_err != nil {
+				return fmt.Errorf("failed to bind to device %s: %v", vrf, bind_err)
+			}
+			return nil
+		}
+	}
+
+	if netns == "" {
+		return dialer.DialContext, nil
+	}
+
+	path := netnsPath(netns)
+	if _, err := os.Stat(path); err != nil {
+		return nil, fmt.Errorf("failed to find network namespace %s: %v", netns, err)
+	}
+
+	return func(ctx context.Context, network string, address string) (net.Conn, error) {
+		return dialInNamespace(ctx, dialer, path, network, address)
+	}, nil
+}
+
+// dialInNamespace opens a connection with dialer from within the network namespace at path, and
+// moves the dialing thread back to its original namespace afterwards. A thread that can't be moved
+// back stays locked, so it is discarded once the dialing goroutine exits.
+func dialInNamespace(ctx context.Context, dialer *net.Dialer, path string, network string, address string) (net.Conn, error) {
+	runtime.LockOSThread()
+
+	origin, err := os.Open(fmt.Sprintf("/proc/self/task/%d/ns/net", syscall.Gettid()))
+	if err != nil {
+		runtime.UnlockOSThread()
+		return nil, fmt.Errorf("failed to open the current network namespace: %v", err)
+	}
+	defer origin.Close()
+
+	namespace, err := os.Open(path)
+	if err != nil {
+		runtime.UnlockOSThread()
+		return nil, fmt.Errorf("failed to open network namespace %s: %v", path, err)
+	}
+	defer namespace.Close()
+
+	if err := setns(namespace.Fd()); err != nil {
+		runtime.UnlockOSThread()
+		return nil, fmt.Errorf("failed to enter network namespace %s: %v", path, err)
+	}
+
+	conn, dial_err := dialer.DialContext(ctx, network, address)
+
+	if err := setns(origin.Fd()); err != nil {
+		log.Printf("WARNING: failed to leave network namespace %s, discarding the thread: %v", path, err)
+		return conn, dial_err
+	}
+	runtime.UnlockOSThread()
+
+	return conn, dial_err
+}
+
+// setns moves the calling thread into the network namespace referred to by fd.
+func setns(fd uintptr) error {
+	if _, _, errno := syscall.RawSyscall(setns_syscall, fd, syscall.CLONE_NEWNET, 0); errno != 0 {
+		return errno
+	}
+	return nil
+}
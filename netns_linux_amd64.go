@@ -0,0 +1,5 @@
+package main
+
+// setns_syscall is the number of the setns system call, which the syscall package doesn't define
+// for amd64.
+const setns_syscall uintptr = 308
@@ -0,0 +1,9 @@
+//go:build linux && !amd64 && !386
+// +build linux,!amd64,!386
+
+package main
+
+import "syscall"
+
+// setns_syscall is the number of the setns system call.
+const setns_syscall uintptr = syscall.SYS_SETNS
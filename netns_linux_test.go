@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/go-playground/assert/v2"
+)
+
+func TestDialInNamespace(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Equal(t, err, nil)
+	defer listener.Close()
+
+	// entering the current namespace checks the namespace switch without extra namespaces
+	current, err := os.Open("/proc/self/ns/net")
+	assert.Equal(t, err, nil)
+	if err := setns(current.Fd()); err == syscall.EPERM {
+		current.Close()
+		t.Skip("entering a network namespace requires CAP_SYS_ADMIN")
+	}
+	current.Close()
+
+	dial, err := networkDialer("/proc/self/ns/net", "")
+	assert.Equal(t, err, nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	conn, err := dial(ctx, "tcp", listener.Addr().String())
+	assert.Equal(t, err, nil)
+	conn.Close()
+}
+
+func TestApplySettingsDNSRetryNetns(t *testing.T) {
+	config := Config{
+		Settings:  Settings{DNSFailure: DNSFailureRetry, DNSResolver: "8.8.8.8:53"},
+		Endpoints: Endpoints{{Name: "example", Url: "https://example.com/", Netns: "/proc/self/ns/net"}},
+	}
+
+	// the global retry policy doesn't reach the endpoints checked from a namespace
+	assert.Equal(t, config.ApplySettings(), nil)
+	assert.Equal(t, config.Endpoints[0].DNSFailure, "")
+}
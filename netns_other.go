@@ -0,0 +1,24 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+import (
+	"errors"
+	"net"
+	"time"
+)
+
+// networkDialer returns an error when a network namespace or VRF device is set, since they are
+// only supported on Linux.
+func networkDialer(netns string, vrf string) (dialFunc, error) {
+	if netns != "" || vrf != "" {
+		return nil, errors.New("network namespaces and VRF devices are only supported on Linux")
+	}
+
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+	return dialer.DialContext, nil
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/go-playground/assert/v2"
+)
+
+func TestNetworkClient(t *testing.T) {
+	client, err := NetworkClient("", "", 0)
+	assert.Equal(t, err, nil)
+
+	cached, err := NetworkClient("", "", 0)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, client == cached, true)
+
+	_, err = NetworkClient("checkhealth-nonexistent", "", 0)
+	assert.NotEqual(t, err, nil)
+}
+
+func TestNetnsPath(t *testing.T) {
+	assert.Equal(t, netnsPath("blue"), "/var/run/netns/blue")
+	assert.Equal(t, netnsPath("/proc/1/ns/net"), "/proc/1/ns/net")
+}
+
+func TestApplySettingsNetwork(t *testing.T) {
+	cases := []struct {
+		name          string
+		config        Config
+		expectedFail  bool
+		expectedNetns string
+	}{
+		{
+			name: "No Namespace",
+			config: Config{
+				Endpoints: Endpoints{{Name: "example", Url: "https://example.com/"}},
+			},
+		},
+		{
+			name: "Missing Namespace",
+			config: Config{
+				Settings:  Settings{Netns: "checkhealth-nonexistent"},
+				Endpoints: Endpoints{{Name: "example", Url: "https://example.com/"}},
+			},
+			expectedFail: true,
+		},
+		{
+			name: "Dual Stack",
+			config: Config{
+				Endpoints: Endpoints{{Name: "example", Url: "https://example.com/", VRF: "vrf-blue", DualStack: true}},
+			},
+			expectedFail: true,
+		},
+		{
+			// the namespace isn't looked up, as no endpoint can be checked from it
+			name: "Global Namespace With Other Endpoints",
+			config: Config{
+				Settings: Settings{Netns: "checkhealth-nonexistent", VRF: "vrf-blue"},
+				Endpoints: Endpoints{
+					{Name: "smtp", Url: "tcp://example.com:25", Type: EndpointTypeRawTCP},
+					{Name: "dual stack", Url: "https://example.com/", DualStack: true},
+					{Name: "proxy protocol", Url: "https://example.com/", ProxyProtocol: ProxyProtocolV1},
+					{Name: "dns retry", Url: "https://example.com/", DNSFailure: DNSFailureRetry, DNSResolver: "1.1.1.1:53"},
+				},
+			},
+		},
+		{
+			name: "Global Namespace With DNS Retry",
+			config: Config{
+				Settings:  Settings{VRF: "vrf-blue", DNSFailure: DNSFailureRetry, DNSResolver: "1.1.1.1:53"},
+				Endpoints: Endpoints{{Name: "example", Url: "https://example.com/"}},
+			},
+			expectedFail: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.config.ApplySettings()
+			if tc.expectedFail {
+				assert.NotEqual(t, err, nil)
+				return
+			}
+
+			assert.Equal(t, err, nil)
+			for _, endpoint := range tc.config.Endpoints {
+				assert.Equal(t, endpoint.Netns, tc.expectedNetns)
+				assert.Equal(t, endpoint.VRF, "")
+			}
+		})
+	}
+}
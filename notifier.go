@@ -0,0 +1,551 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultNotifyAfter is how long an endpoint must stay DOWN before a notifier opens an issue, when
+// the notifier's configuration doesn't set after.
+const DefaultNotifyAfter time.Duration = 5 * time.Minute
+
+// notifierTimeout bounds each request a notifier makes to its issue tracker.
+const notifierTimeout time.Duration = 10 * time.Second
+
+// Notifier opens and resolves issues in an issue tracker, such as GitHub or Jira, for sustained
+// outages. Notifiers are always wrapped in an OutageNotifier, which decides when to call them.
+type Notifier interface {
+	// Open creates an issue for the outage and returns a reference to it, e.g. an issue number.
+	Open(outage Outage) (string, error)
+
+	// Comment adds a comment to the referenced issue.
+	Comment(ref string, text string) error
+
+	// Close resolves the referenced issue.
+	Close(ref string) error
+}
+
+// NotifierConfig is the configuration of a single entry in the notifiers section of the
+// configuration file. Type selects the notifier implementation, the remaining fields are used by
+// the implementations that need them.
+type NotifierConfig struct {
+	Type  string        `yaml:"type"`
+	After time.Duration `yaml:"after,omitempty"`
+
+	// Dampening is how long the notifier waits, once an endpoint has been DOWN for After, for other
+	// endpoints to be DOWN as well, coalescing them into a single issue. Defaults to the
+	// alert_dampening setting, and disabled when zero.
+	Dampening time.Duration `yaml:"dampening,omitempty"`
+
+	// Url is the API base URL of the issue tracker and TokenEnv the environment variable holding
+	// its API token, so tokens aren't stored in the configuration file.
+	Url      string `yaml:"url,omitempty"`
+	TokenEnv string `yaml:"token_env,omitempty"`
+
+	Repository      string   `yaml:"repository,omitempty"`
+	Project         string   `yaml:"project,omitempty"`
+	IssueType       string   `yaml:"issue_type,omitempty"`
+	User            string   `yaml:"user,omitempty"`
+	CloseTransition string   `yaml:"close_transition,omitempty"`
+	Labels          []string `yaml:"labels,omitempty"`
+
+	// From and To are the sender and recipients of the email notifier, whose SMTP connection
+	// fails instead of being sent in plaintext when RequireTLS is set. Owners routes the outages
+	// of endpoints to the recipients of their owner instead.
+	From                  string              `yaml:"from,omitempty"`
+	To                    []string            `yaml:"to,omitempty"`
+	Owners                map[string][]string `yaml:"owners,omitempty"`
+	RequireTLS            bool                `yaml:"require_tls,omitempty"`
+	TLSInsecureSkipVerify bool                `yaml:"tls_insecure_skip_verify,omitempty"`
+
+	CircuitBreaker BreakerConfig `yaml:"circuit_breaker,omitempty"`
+}
+
+// NotifierFactory creates a Notifier from its configuration.
+type NotifierFactory func(config NotifierConfig) (Notifier, error)
+
+// notifier_factories holds the notifier implementations compiled into the binary, by type.
+var notifier_factories = struct {
+	sync.Mutex
+	factories map[string]NotifierFactory
+}{
+	factories: map[string]NotifierFactory{},
+}
+
+// RegisterNotifier makes a notifier type available to the notifiers configuration section and
+// records it as a feature. It is intended to be called from init functions.
+func RegisterNotifier(notifier_type string, factory NotifierFactory) {
+	RegisterFeature(FeatureNotifier, notifier_type)
+
+	notifier_factories.Lock()
+	defer notifier_factories.Unlock()
+	notifier_factories.factories[notifier_type] = factory
+}
+
+// Outage describes an endpoint that stayed DOWN, as reported in issues.
+type Outage struct {
+	Endpoint  string
+	Url       string
+	Since     time.Time
+	ErrorKind string
+	LastError string
+	Runbook   string
+	Owner     string
+	Labels    map[string]string
+
+	// Availability is the percentage of the last Checks conclusive checks of the endpoint that
+	// were up, see EndpointStatus.RecentAvailability.
+	Availability int
+	Checks       int
+
+	// AbandonedAt is when the checks of the endpoint were paused after it stayed DOWN for its
+	// abandon_after, zero while it is checked.
+	AbandonedAt time.Time
+
+	// Affected are the outages coalesced into this one by the dampening of a notifier, when
+	// several endpoints went DOWN together, such as all the endpoints of a domain. The other
+	// fields are then those of the first of them, except Owner, which is only set when they all
+	// share it.
+	Affected []Outage
+}
+
+// Title returns the issue title for the outage.
+func (outage Outage) Title() string {
+	switch others := len(outage.Affected) - 1; {
+	case others == 1:
+		return fmt.Sprintf("%s and 1 other endpoint are down", outage.Affected[0].Endpoint)
+	case others > 1:
+		return fmt.Sprintf("%s and %d other endpoints are down", outage.Affected[0].Endpoint, others)
+	}
+	return fmt.Sprintf("%s is down", outage.Endpoint)
+}
+
+// Description returns the issue description for the outage, with its details and runbook link, or
+// those of every affected endpoint of a coalesced outage.
+func (outage Outage) Description() string {
+	var description strings.Builder
+	if len(outage.Affected) > 1 {
+		fmt.Fprintf(&description, "checkhealth detected a sustained outage of %d endpoints.\n", len(outage.Affected))
+		for _, affected := range outage.Affected {
+			fmt.Fprintf(&description, "\n%s\n", affected.Endpoint)
+			affected.writeDetails(&description)
+		}
+		return description.String()
+	}
+
+	fmt.Fprintf(&description, "checkhealth detected a sustained outage of %s.\n\n", outage.Endpoint)
+	outage.writeDetails(&description)
+	return description.String()
+}
+
+// writeDetails writes the details of the outage of an endpoint as a list.
+func (outage Outage) writeDetails(description *strings.Builder) {
+	fmt.Fprintf(description, "- URL: %s\n", outage.Url)
+	fmt.Fprintf(description, "- Down since: %s\n", outage.Since.UTC().Format(time.RFC3339))
+	if outage.ErrorKind != "" {
+		fmt.Fprintf(description, "- Error kind: %s\n", outage.ErrorKind)
+	}
+	if outage.LastError != "" {
+		fmt.Fprintf(description, "- Last error: %s\n", outage.LastError)
+	}
+	if outage.Checks > 0 {
+		fmt.Fprintf(description, "- Recent availability: %d%% of the last %d checks\n", outage.Availability, outage.Checks)
+	}
+	if !outage.AbandonedAt.IsZero() {
+		fmt.Fprintf(description, "- Abandoned: checks paused since %s\n", outage.AbandonedAt.UTC().Format(time.RFC3339))
+	}
+	if outage.Owner != "" {
+		fmt.Fprintf(description, "- Owner: %s\n", outage.Owner)
+	}
+	if len(outage.Labels) > 0 {
+		fmt.Fprintf(description, "- Labels: %s\n", formatLabels(outage.Labels))
+	}
+	if outage.Runbook != "" {
+		fmt.Fprintf(description, "- Runbook: %s\n", outage.Runbook)
+	}
+}
+
+// OutageNotifier opens an issue with a Notifier when an endpoint stays DOWN for longer than its
+// after duration, and comments on and closes the issue once the endpoint is UP again.
+//
+// With a dampening window, the endpoints that stay DOWN for longer than after within the window
+// following the first of them, such as all the endpoints of a domain during a whole-domain outage,
+// are coalesced into a single issue listing them, instead of an issue per endpoint. The issue is
+// closed once all of them are UP again.
+//
+// When an endpoint with an open issue is abandoned (see AbandonEndpoints), the notifier comments on
+// the issue, which stays open until the endpoint is resumed and UP again.
+//
+// Endpoint states are processed asynchronously, so a slow issue tracker never delays the check
+// loop, and calls to the tracker go through a CircuitBreaker. Only the latest states are kept
+// while the tracker is busy. Open issues are tracked in memory, so they are not resolved across
+// restarts of the program.
+type OutageNotifier struct {
+	name     string
+	notifier Notifier
+	breaker  *CircuitBreaker
+	after    time.Duration
+	issues   map[string]string
+
+	// abandoned are the endpoints whose abandonment was notified, by the key of issues.
+	abandoned map[string]bool
+
+	// dampening is the dampening window, and dampening_since when the window of the endpoints
+	// waiting for an issue started, zero when none is waiting.
+	dampening       time.Duration
+	dampening_since time.Time
+
+	pending chan outageSnapshot
+	done    chan struct{}
+	mu      sync.Mutex
+	closed  bool
+}
+
+// outageSnapshot is the state of every endpoint at the end of a cycle.
+type outageSnapshot struct {
+	statuses []EndpointStatus
+	at       time.Time
+}
+
+// NewOutageNotifier creates the notifier described by config, wrapped in an OutageNotifier. An
+// error is returned if the notifier type isn't compiled into the binary or the notifier fails to
+// initialize.
+func NewOutageNotifier(config NotifierConfig) (*OutageNotifier, error) {
+	factory, err := lookupNotifier(config.Type)
+	if err != nil {
+		return nil, err
+	}
+
+	notifier, err := factory(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s notifier: %v", config.Type, err)
+	}
+
+	return newOutageNotifier(config.Type, notifier, config), nil
+}
+
+// lookupNotifier returns the factory of a notifier type. An error is returned if the notifier type
+// isn't compiled into the binary.
+func lookupNotifier(notifier_type string) (NotifierFactory, error) {
+	notifier_factories.Lock()
+	factory, ok := notifier_factories.factories[notifier_type]
+	notifier_factories.Unlock()
+
+	if !ok {
+		known := registeredFeatures(FeatureNotifier)
+		sort.Strings(known)
+		return nil, fmt.Errorf("unknown notifier type %q, expected one of %v", notifier_type, known)
+	}
+	return factory, nil
+}
+
+// newOutageNotifier wraps notifier in an OutageNotifier and starts its processing goroutine.
+func newOutageNotifier(name string, notifier Notifier, config NotifierConfig) *OutageNotifier {
+	if config.After <= 0 {
+		config.After = DefaultNotifyAfter
+	}
+
+	outage_notifier := &OutageNotifier{
+		name:      name,
+		notifier:  notifier,
+		breaker:   NewCircuitBreaker(name+" notifier", config.CircuitBreaker),
+		after:     config.After,
+		issues:    map[string]string{},
+		abandoned: map[string]bool{},
+		dampening: config.Dampening,
+		pending:   make(chan outageSnapshot, 1),
+		done:      make(chan struct{}),
+	}
+	go outage_notifier.run()
+
+	return outage_notifier
+}
+
+// Notify queues the endpoint states observed at the provided time, replacing states that weren't
+// processed yet. Notifying a closed OutageNotifier does nothing.
+func (outage_notifier *OutageNotifier) Notify(statuses []EndpointStatus, at time.Time) {
+	outage_notifier.mu.Lock()
+	defer outage_notifier.mu.Unlock()
+
+	if outage_notifier.closed {
+		return
+	}
+
+	// drop the unprocessed snapshot, the latest states supersede it
+	select {
+	case <-outage_notifier.pending:
+	default:
+	}
+	outage_notifier.pending <- outageSnapshot{statuses: statuses, at: at}
+}
+
+// Close processes the queued states and stops the OutageNotifier.
+func (outage_notifier *OutageNotifier) Close() {
+	outage_notifier.mu.Lock()
+	if outage_notifier.closed {
+		outage_notifier.mu.Unlock()
+		return
+	}
+	outage_notifier.closed = true
+	close(outage_notifier.pending)
+	outage_notifier.mu.Unlock()
+
+	<-outage_notifier.done
+}
+
+// run processes queued states until the OutageNotifier is closed.
+func (outage_notifier *OutageNotifier) run() {
+	defer close(outage_notifier.done)
+
+	for snapshot := range outage_notifier.pending {
+		outage_notifier.process(snapshot)
+	}
+}
+
+// process opens issues for endpoints DOWN for longer than the after duration, comments on the
+// issues of abandoned endpoints and resolves the issues of endpoints that are UP again.
+func (outage_notifier *OutageNotifier) process(snapshot outageSnapshot) {
+	var waiting []EndpointStatus
+	for _, status := range snapshot.statuses {
+		key := status.Endpoint + " " + status.Url
+		ref, open := outage_notifier.issues[key]
+		if status.AbandonedAt == nil {
+			delete(outage_notifier.abandoned, key)
+		}
+
+		switch {
+		case !open && status.State == StateDown && snapshot.at.Sub(status.Since) >= outage_notifier.after:
+			waiting = append(waiting, status)
+
+		case open && status.AbandonedAt != nil && !outage_notifier.abandoned[key]:
+			text := fmt.Sprintf("%s was abandoned at %s after being down since %s, its checks are paused until the configuration is reloaded.",
+				status.Endpoint, status.AbandonedAt.UTC().Format(time.RFC3339), status.Since.UTC().Format(time.RFC3339))
+			err := outage_notifier.breaker.Call(func() error {
+				return outage_notifier.notifier.Comment(ref, text)
+			})
+			if err != nil {
+				outage_notifier.logFailure("comment on issue "+ref, err)
+				continue
+			}
+			log.Printf("Commented on %s issue %s, %s was abandoned", outage_notifier.name, ref, status.Endpoint)
+			outage_notifier.abandoned[key] = true
+
+		case open && status.State == StateUp:
+			// issues coalescing several endpoints stay open until the last of them recovers
+			if outage_notifier.shared(key, ref) {
+				log.Printf("%s recovered, %s issue %s stays open for the other endpoints", status.Endpoint, outage_notifier.name, ref)
+				delete(outage_notifier.issues, key)
+				continue
+			}
+
+			text := fmt.Sprintf("%s recovered at %s and is up again.", status.Endpoint, status.Since.UTC().Format(time.RFC3339))
+			err := outage_notifier.breaker.Call(func() error {
+				if err := outage_notifier.notifier.Comment(ref, text); err != nil {
+					return err
+				}
+				return outage_notifier.notifier.Close(ref)
+			})
+			if err != nil {
+				outage_notifier.logFailure("resolve issue "+ref, err)
+				continue
+			}
+			log.Printf("Closed %s issue %s, %s recovered", outage_notifier.name, ref, status.Endpoint)
+			delete(outage_notifier.issues, key)
+		}
+	}
+
+	if outage_notifier.dampening <= 0 {
+		for _, status := range waiting {
+			outage_notifier.open([]EndpointStatus{status})
+		}
+		return
+	}
+
+	// wait for the window to end, starting over when the waiting endpoints recovered meanwhile
+	if len(waiting) == 0 {
+		outage_notifier.dampening_since = time.Time{}
+		return
+	}
+	if outage_notifier.dampening_since.IsZero() {
+		outage_notifier.dampening_since = snapshot.at
+	}
+	if snapshot.at.Sub(outage_notifier.dampening_since) < outage_notifier.dampening {
+		return
+	}
+	if outage_notifier.open(waiting) {
+		outage_notifier.dampening_since = time.Time{}
+	}
+}
+
+// open opens an issue for the outage of the endpoints, coalesced into a single outage when there
+// are several of them. It returns false if the issue couldn't be opened.
+func (outage_notifier *OutageNotifier) open(statuses []EndpointStatus) bool {
+	var outage Outage
+	for i, status := range statuses {
+		affected := Outage{
+			Endpoint:  status.Endpoint,
+			Url:       status.Url,
+			Since:     status.Since,
+			ErrorKind: status.ErrorKind,
+			LastError: status.LastError,
+			Runbook:   status.Runbook,
+			Owner:     status.Owner,
+			Labels:    status.Labels,
+
+			Availability: status.RecentAvailability,
+			Checks:       status.RecentCheckCount,
+		}
+		if status.AbandonedAt != nil {
+			affected.AbandonedAt = *status.AbandonedAt
+		}
+		if i == 0 {
+			outage = affected
+		} else if affected.Owner != outage.Owner {
+			outage.Owner = ""
+		}
+		if len(statuses) > 1 {
+			outage.Affected = append(outage.Affected, affected)
+		}
+	}
+
+	description := outage.Endpoint
+	if len(statuses) > 1 {
+		description = fmt.Sprintf("%d endpoints", len(statuses))
+	}
+
+	var ref string
+	err := outage_notifier.breaker.Call(func() error {
+		var err error
+		ref, err = outage_notifier.notifier.Open(outage)
+		return err
+	})
+	if err != nil {
+		outage_notifier.logFailure("open an issue for "+description, err)
+		return false
+	}
+	log.Printf("Opened %s issue %s for %s, down since %s", outage_notifier.name, ref, description, outage.Since.UTC().Format(time.RFC3339))
+	for _, status := range statuses {
+		outage_notifier.issues[status.Endpoint+" "+status.Url] = ref
+		if status.AbandonedAt != nil {
+			outage_notifier.abandoned[status.Endpoint+" "+status.Url] = true
+		}
+	}
+	return true
+}
+
+// shared returns whether the issue ref of the endpoint key is also open for other endpoints.
+func (outage_notifier *OutageNotifier) shared(key string, ref string) bool {
+	for other, other_ref := range outage_notifier.issues {
+		if other != key && other_ref == ref {
+			return true
+		}
+	}
+	return false
+}
+
+// logFailure logs a failed call to the issue tracker, unless the breaker rejected it.
+func (outage_notifier *OutageNotifier) logFailure(action string, err error) {
+	if err != ErrCircuitOpen {
+		log.Printf("Failed to %s with %s notifier: %v", action, outage_notifier.name, err)
+	}
+}
+
+// OpenNotifiers is a method for HealthCheckTargets that creates a notifier for each entry in the
+// notifiers configuration. Any failure closes the notifiers opened so far and returns an error,
+// except failures to initialize a notifier without StrictIntegrations, which are retried, see
+// deferredNotifier.
+func (target *HealthCheckTargets) OpenNotifiers(configs []NotifierConfig) error {
+	for _, config := range configs {
+		if config.Dampening == 0 {
+			config.Dampening = target.Settings.AlertDampening
+		}
+		factory, err := lookupNotifier(config.Type)
+		if err != nil {
+			target.CloseNotifiers()
+			return err
+		}
+		notifier, err := NewOutageNotifier(config)
+		if err != nil && !target.Settings.StrictIntegrations {
+			notifier, err = newDeferredNotifier(config, factory, err), nil
+		}
+		if err != nil {
+			target.CloseNotifiers()
+			return err
+		}
+		target.Notifiers = append(target.Notifiers, notifier)
+	}
+	return nil
+}
+
+// NotifyOutages is a method for HealthCheckTargets that passes the current endpoint states to
+// every configured notifier.
+func (target *HealthCheckTargets) NotifyOutages(at time.Time) {
+	if len(target.Notifiers) == 0 {
+		return
+	}
+
+	statuses := target.EndpointStates()
+	for _, notifier := range target.Notifiers {
+		notifier.Notify(statuses, at)
+	}
+}
+
+// CloseNotifiers is a method for HealthCheckTargets that stops every configured notifier.
+func (target *HealthCheckTargets) CloseNotifiers() {
+	for _, notifier := range target.Notifiers {
+		notifier.Close()
+	}
+	target.Notifiers = nil
+}
+
+// doJSON sends a request with a JSON encoded payload (if any) to an issue tracker API and decodes
+// the JSON response into out (if not nil). authorize adds the tracker's credentials to the request.
+// An error is returned for responses with a non-2xx status code.
+func doJSON(client *http.Client, method string, url string, authorize func(*http.Request), payload interface{}, out interface{}) error {
+	var body io.Reader
+	if payload != nil {
+		encoded, err := json.Marshal(payload)
+		if err != nil {
+			return fmt.Errorf("failed to encode request: %v", err)
+		}
+		body = bytes.NewReader(encoded)
+	}
+
+	request, err := http.NewRequest(method, url, body)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Accept", "application/json")
+	if payload != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+	authorize(request)
+
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		message, _ := io.ReadAll(io.LimitReader(response.Body, 512))
+		return fmt.Errorf("%s %s returned status %d: %s", method, url, response.StatusCode, strings.TrimSpace(string(message)))
+	}
+
+	if out == nil {
+		_, err = io.Copy(io.Discard, response.Body)
+		return err
+	}
+	if err := json.NewDecoder(response.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,288 @@
+//go:build !noemail
+// +build !noemail
+
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultSMTPPort, DefaultSMTPSPort and DefaultEmailPasswordEnv are used when an email notifier's
+// url doesn't set a port or its configuration doesn't set token_env.
+const (
+	DefaultSMTPPort         string = "587"
+	DefaultSMTPSPort        string = "465"
+	DefaultEmailPasswordEnv string = "SMTP_PASSWORD"
+)
+
+// EmailNotifier is a Notifier that emails outages and their recoveries through an SMTP server, for
+// teams without an issue tracker or a paging service. Recoveries are sent as replies to the outage
+// email, so mail clients thread them together.
+//
+// Outages are sent to the endpoint's owner when it is an email address, to the recipients of the
+// owner in owners, or else to the default recipients.
+type EmailNotifier struct {
+	address  string
+	host     string
+	implicit bool
+	tls      *tls.Config
+	require  bool
+	user     string
+	password string
+	from     string
+	to       []string
+	owners   map[string][]string
+
+	// threads holds the outage emails by message id, so recoveries reply to them.
+	mu      sync.Mutex
+	threads map[string]emailThread
+}
+
+// emailThread is an outage email, which recoveries reply to.
+type emailThread struct {
+	subject string
+	to      []string
+}
+
+// NewEmailNotifier creates an EmailNotifier sending from config.From to config.To, or the
+// config.Owners recipients of the endpoint's owner, through the SMTP server of config.Url. smtps://
+// URLs connect with TLS, and smtp:// URLs upgrade the connection with STARTTLS when the server
+// supports it, or fail without it when config.RequireTLS is set.
+// Credentials are sent with PLAIN authentication, as config.User with the password in the
+// config.TokenEnv environment variable, and only over TLS or to a local server.
+func NewEmailNotifier(config NotifierConfig) (Notifier, error) {
+	server, err := url.Parse(config.Url)
+	if err != nil || (server.Scheme != "smtp" && server.Scheme != "smtps") || server.Hostname() == "" {
+		return nil, fmt.Errorf("email notifier requires a url of the form smtp://host[:port] or smtps://host[:port]")
+	}
+	if _, err := mail.ParseAddress(config.From); err != nil {
+		return nil, fmt.Errorf("email notifier requires a valid from address: %v", err)
+	}
+	if len(config.To) == 0 && len(config.Owners) == 0 {
+		return nil, fmt.Errorf("email notifier requires to or owners addresses")
+	}
+	for _, recipient := range config.To {
+		if _, err := mail.ParseAddress(recipient); err != nil {
+			return nil, fmt.Errorf("invalid to address %q: %v", recipient, err)
+		}
+	}
+	for owner, recipients := range config.Owners {
+		for _, recipient := range recipients {
+			if _, err := mail.ParseAddress(recipient); err != nil {
+				return nil, fmt.Errorf("invalid address %q of owner %q: %v", recipient, owner, err)
+			}
+		}
+	}
+
+	notifier := &EmailNotifier{
+		host:     server.Hostname(),
+		implicit: server.Scheme == "smtps",
+		require:  config.RequireTLS || server.Scheme == "smtps",
+		user:     config.User,
+		from:     config.From,
+		to:       config.To,
+		owners:   config.Owners,
+		threads:  map[string]emailThread{},
+	}
+	notifier.tls = &tls.Config{ServerName: notifier.host, InsecureSkipVerify: config.TLSInsecureSkipVerify}
+
+	port := server.Port()
+	if port == "" {
+		port = DefaultSMTPPort
+		if notifier.implicit {
+			port = DefaultSMTPSPort
+		}
+	}
+	notifier.address = net.JoinHostPort(notifier.host, port)
+
+	if config.User != "" {
+		token_env := config.TokenEnv
+		if token_env == "" {
+			token_env = DefaultEmailPasswordEnv
+		}
+		notifier.password = os.Getenv(token_env)
+		if notifier.password == "" {
+			return nil, fmt.Errorf("environment variable %s is not set", token_env)
+		}
+	}
+	return notifier, nil
+}
+
+// Open emails the outage and returns the message id of the email.
+func (notifier *EmailNotifier) Open(outage Outage) (string, error) {
+	thread := emailThread{
+		subject: "[checkhealth] " + outage.Title(),
+		to:      notifier.recipients(outage.Owner),
+	}
+	if len(thread.to) == 0 {
+		return "", fmt.Errorf("no recipients for owner %q, set to or owners", outage.Owner)
+	}
+
+	message_id, err := notifier.send(thread, "", outage.Description())
+	if err != nil {
+		return "", err
+	}
+
+	notifier.mu.Lock()
+	notifier.threads[message_id] = thread
+	notifier.mu.Unlock()
+	return message_id, nil
+}
+
+// Comment emails text as a reply to the outage email with the provided message id.
+func (notifier *EmailNotifier) Comment(ref string, text string) error {
+	notifier.mu.Lock()
+	thread, ok := notifier.threads[ref]
+	notifier.mu.Unlock()
+	if !ok {
+		thread = emailThread{subject: "[checkhealth] outage update", to: notifier.to}
+	}
+
+	thread.subject = "Re: " + thread.subject
+	_, err := notifier.send(thread, ref, text+"\n")
+	return err
+}
+
+// Close forgets the outage email with the provided message id. The recovery was already emailed by
+// Comment, so nothing is sent.
+func (notifier *EmailNotifier) Close(ref string) error {
+	notifier.mu.Lock()
+	defer notifier.mu.Unlock()
+	delete(notifier.threads, ref)
+	return nil
+}
+
+// recipients returns the recipients of the outages of endpoints owned by owner.
+func (notifier *EmailNotifier) recipients(owner string) []string {
+	if recipients, ok := notifier.owners[owner]; ok && owner != "" {
+		return recipients
+	}
+	if address, err := mail.ParseAddress(owner); err == nil {
+		return []string{address.String()}
+	}
+	return notifier.to
+}
+
+// send emails a plain text message with body to the recipients and subject of thread, as a reply
+// to the message id in_reply_to if not empty, and returns the message id of the email.
+func (notifier *EmailNotifier) send(thread emailThread, in_reply_to string, body string) (string, error) {
+	message_id, err := notifier.newMessageID()
+	if err != nil {
+		return "", err
+	}
+
+	var message bytes.Buffer
+	fmt.Fprintf(&message, "From: %s\r\n", notifier.from)
+	fmt.Fprintf(&message, "To: %s\r\n", strings.Join(thread.to, ", "))
+	fmt.Fprintf(&message, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", thread.subject))
+	fmt.Fprintf(&message, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&message, "Message-ID: %s\r\n", message_id)
+	if in_reply_to != "" {
+		fmt.Fprintf(&message, "In-Reply-To: %s\r\n", in_reply_to)
+		fmt.Fprintf(&message, "References: %s\r\n", in_reply_to)
+	}
+	message.WriteString("MIME-Version: 1.0\r\n")
+	message.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	message.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+
+	if err := notifier.deliver(thread.to, message.Bytes()); err != nil {
+		return "", err
+	}
+	return message_id, nil
+}
+
+// deliver sends message to the recipients to through the SMTP server, within notifierTimeout.
+func (notifier *EmailNotifier) deliver(to []string, message []byte) error {
+	dialer := &net.Dialer{Timeout: notifierTimeout}
+	var conn net.Conn
+	var err error
+	if notifier.implicit {
+		conn, err = tls.DialWithDialer(dialer, "tcp", notifier.address, notifier.tls)
+	} else {
+		conn, err = dialer.Dial("tcp", notifier.address)
+	}
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(notifierTimeout))
+
+	client, err := smtp.NewClient(conn, notifier.host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if !notifier.implicit {
+		if ok, _ := client.Extension("STARTTLS"); ok {
+			if err := client.StartTLS(notifier.tls); err != nil {
+				return fmt.Errorf("failed to start TLS: %v", err)
+			}
+		} else if notifier.require {
+			return errors.New("SMTP server doesn't support STARTTLS and require_tls is set")
+		}
+	}
+
+	if notifier.user != "" {
+		if err := client.Auth(smtp.PlainAuth("", notifier.user, notifier.password, notifier.host)); err != nil {
+			return fmt.Errorf("failed to authenticate: %v", err)
+		}
+	}
+
+	sender, _ := mail.ParseAddress(notifier.from)
+	if err := client.Mail(sender.Address); err != nil {
+		return err
+	}
+	for _, recipient := range to {
+		address, _ := mail.ParseAddress(recipient)
+		if err := client.Rcpt(address.Address); err != nil {
+			return err
+		}
+	}
+
+	writer, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := writer.Write(message); err != nil {
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// newMessageID returns a unique message id in the domain of the sender.
+func (notifier *EmailNotifier) newMessageID() (string, error) {
+	var random [16]byte
+	if _, err := rand.Read(random[:]); err != nil {
+		return "", err
+	}
+
+	domain := notifier.host
+	if sender, err := mail.ParseAddress(notifier.from); err == nil {
+		if i := strings.LastIndex(sender.Address, "@"); i >= 0 {
+			domain = sender.Address[i+1:]
+		}
+	}
+	return fmt.Sprintf("<%s.checkhealth@%s>", hex.EncodeToString(random[:]), domain), nil
+}
+
+func init() {
+	RegisterNotifier("email", NewEmailNotifier)
+}
@@ -0,0 +1,331 @@
+//go:build !noemail
+// +build !noemail
+
+package main
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"math/big"
+	"net"
+	"net/textproto"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-playground/assert/v2"
+)
+
+// smtpTestServer is a minimal SMTP server recording the messages it receives, offering STARTTLS
+// when starttls is set, and accepting the credentials "monitor" and "secret".
+type smtpTestServer struct {
+	address  string
+	starttls bool
+	config   *tls.Config
+
+	mu         sync.Mutex
+	messages   []string
+	recipients []string
+	logins     []string
+}
+
+func newSMTPTestServer(t *testing.T, starttls bool) *smtpTestServer {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Equal(t, err, nil)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	certificate, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.Equal(t, err, nil)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Equal(t, err, nil)
+	t.Cleanup(func() { listener.Close() })
+
+	server := &smtpTestServer{
+		address:  listener.Addr().String(),
+		starttls: starttls,
+		config:   &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{certificate}, PrivateKey: key}}},
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.serve(conn)
+		}
+	}()
+	return server
+}
+
+func (server *smtpTestServer) serve(conn net.Conn) {
+	defer func() { conn.Close() }()
+	control := textproto.NewConn(conn)
+	control.PrintfLine("220 localhost ready")
+
+	secure := false
+	for {
+		line, err := control.ReadLine()
+		if err != nil {
+			return
+		}
+		verb := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+
+		switch verb {
+		case "EHLO":
+			if server.starttls && !secure {
+				control.PrintfLine("250-localhost")
+				control.PrintfLine("250 STARTTLS")
+			} else {
+				control.PrintfLine("250-localhost")
+				control.PrintfLine("250 AUTH PLAIN")
+			}
+		case "STARTTLS":
+			control.PrintfLine("220 ready to start TLS")
+			tls_conn := tls.Server(conn, server.config)
+			if tls_conn.Handshake() != nil {
+				return
+			}
+			conn, secure = tls_conn, true
+			control = textproto.NewConn(conn)
+		case "AUTH":
+			credentials, _ := base64.StdEncoding.DecodeString(strings.TrimPrefix(line, "AUTH PLAIN "))
+			server.mu.Lock()
+			server.logins = append(server.logins, strings.TrimPrefix(string(credentials), "\x00"))
+			server.mu.Unlock()
+			if string(credentials) == "\x00monitor\x00secret" {
+				control.PrintfLine("235 authenticated")
+			} else {
+				control.PrintfLine("535 authentication failed")
+			}
+		case "MAIL":
+			control.PrintfLine("250 ok")
+		case "RCPT":
+			server.mu.Lock()
+			server.recipients = append(server.recipients, strings.TrimPrefix(line, "RCPT TO:"))
+			server.mu.Unlock()
+			control.PrintfLine("250 ok")
+		case "DATA":
+			control.PrintfLine("354 end with .")
+			message, err := control.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			server.mu.Lock()
+			server.messages = append(server.messages, string(message))
+			server.mu.Unlock()
+			control.PrintfLine("250 queued")
+		case "QUIT":
+			control.PrintfLine("221 bye")
+			return
+		default:
+			control.PrintfLine("502 command not implemented")
+		}
+	}
+}
+
+func (server *smtpTestServer) Messages() []string {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	return append([]string{}, server.messages...)
+}
+
+// mailHeader returns the value of a header of message.
+func mailHeader(message string, name string) string {
+	reader := textproto.NewReader(bufio.NewReader(strings.NewReader(message)))
+	headers, _ := reader.ReadMIMEHeader()
+	return headers.Get(name)
+}
+
+func TestEmailNotifier(t *testing.T) {
+	server := newSMTPTestServer(t, false)
+	notifier, err := NewEmailNotifier(NotifierConfig{
+		Url:  "smtp://" + server.address,
+		From: "checkhealth <monitor@example.com>",
+		To:   []string{"ops@example.com", "Oncall <oncall@example.com>"},
+	})
+	assert.Equal(t, err, nil)
+
+	ref, err := notifier.Open(Outage{
+		Endpoint:     "index",
+		Url:          "https://fetch.com/",
+		Since:        time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC),
+		ErrorKind:    ErrorKindStatus,
+		LastError:    "unexpected status code 503",
+		Availability: 97,
+		Checks:       100,
+	})
+	assert.Equal(t, err, nil)
+	assert.Equal(t, strings.HasSuffix(ref, ".checkhealth@example.com>"), true)
+	assert.Equal(t, notifier.Comment(ref, "index recovered at 2023-06-01T12:20:00Z and is up again."), nil)
+	assert.Equal(t, notifier.Close(ref), nil)
+
+	messages := server.Messages()
+	assert.Equal(t, len(messages), 2)
+	assert.Equal(t, server.recipients, []string{"<ops@example.com>", "<oncall@example.com>", "<ops@example.com>", "<oncall@example.com>"})
+
+	assert.Equal(t, mailHeader(messages[0], "Subject"), "[checkhealth] index is down")
+	assert.Equal(t, mailHeader(messages[0], "Message-Id"), ref)
+	assert.Equal(t, strings.Contains(messages[0], "- Last error: unexpected status code 503\n"), true)
+	assert.Equal(t, strings.Contains(messages[0], "- Recent availability: 97% of the last 100 checks\n"), true)
+
+	assert.Equal(t, mailHeader(messages[1], "Subject"), "Re: [checkhealth] index is down")
+	assert.Equal(t, mailHeader(messages[1], "In-Reply-To"), ref)
+	assert.Equal(t, strings.Contains(messages[1], "index recovered at"), true)
+}
+
+func TestEmailNotifierOwners(t *testing.T) {
+	cases := []struct {
+		name               string
+		owner              string
+		to                 []string
+		expectedRecipients []string
+		expectedFail       bool
+	}{
+		{
+			name:               "Owner Recipients",
+			owner:              "payments",
+			to:                 []string{"ops@example.com"},
+			expectedRecipients: []string{"<payments@example.com>", "<finance@example.com>"},
+		},
+		{
+			name:               "Owner Email Address",
+			owner:              "DBA <dba@example.com>",
+			to:                 []string{"ops@example.com"},
+			expectedRecipients: []string{"<dba@example.com>"},
+		},
+		{
+			name:               "Unrouted Owner",
+			owner:              "#infra",
+			to:                 []string{"ops@example.com"},
+			expectedRecipients: []string{"<ops@example.com>"},
+		},
+		{
+			name:         "No Recipients",
+			owner:        "#infra",
+			expectedFail: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := newSMTPTestServer(t, false)
+			notifier, err := NewEmailNotifier(NotifierConfig{
+				Url:    "smtp://" + server.address,
+				From:   "monitor@example.com",
+				To:     tc.to,
+				Owners: map[string][]string{"payments": {"payments@example.com", "finance@example.com"}},
+			})
+			assert.Equal(t, err, nil)
+
+			ref, err := notifier.Open(Outage{Endpoint: "checkout", Url: "https://fetch.com/checkout", Since: time.Now(), Owner: tc.owner})
+			assert.Equal(t, err != nil, tc.expectedFail)
+			if tc.expectedFail {
+				return
+			}
+			assert.Equal(t, notifier.Comment(ref, "checkout recovered."), nil)
+
+			// the recovery is sent to the recipients of the outage
+			messages := server.Messages()
+			assert.Equal(t, len(messages), 2)
+			assert.Equal(t, strings.Contains(messages[0], "- Owner: "+tc.owner+"\n"), true)
+			server.mu.Lock()
+			defer server.mu.Unlock()
+			assert.Equal(t, server.recipients, append(append([]string{}, tc.expectedRecipients...), tc.expectedRecipients...))
+		})
+	}
+}
+
+func TestEmailNotifierTLS(t *testing.T) {
+	os.Setenv("CHECKHEALTH_TEST_SMTP_PASSWORD", "secret")
+	defer os.Unsetenv("CHECKHEALTH_TEST_SMTP_PASSWORD")
+
+	cases := []struct {
+		name          string
+		starttls      bool
+		config        NotifierConfig
+		expectedLogin bool
+		expectedFail  bool
+	}{
+		{
+			name:          "STARTTLS With Authentication",
+			starttls:      true,
+			config:        NotifierConfig{User: "monitor", TokenEnv: "CHECKHEALTH_TEST_SMTP_PASSWORD", TLSInsecureSkipVerify: true},
+			expectedLogin: true,
+		},
+		{
+			name:         "Untrusted Certificate",
+			starttls:     true,
+			config:       NotifierConfig{},
+			expectedFail: true,
+		},
+		{
+			name:         "TLS Required",
+			config:       NotifierConfig{RequireTLS: true},
+			expectedFail: true,
+		},
+		{
+			name:          "Plaintext Authentication To Local Server",
+			config:        NotifierConfig{User: "monitor", TokenEnv: "CHECKHEALTH_TEST_SMTP_PASSWORD"},
+			expectedLogin: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := newSMTPTestServer(t, tc.starttls)
+			tc.config.Url = "smtp://" + server.address
+			tc.config.From = "monitor@example.com"
+			tc.config.To = []string{"ops@example.com"}
+			notifier, err := NewEmailNotifier(tc.config)
+			assert.Equal(t, err, nil)
+
+			_, err = notifier.Open(Outage{Endpoint: "index", Url: "https://fetch.com/", Since: time.Now()})
+			assert.Equal(t, err != nil, tc.expectedFail)
+			if !tc.expectedFail {
+				assert.Equal(t, len(server.Messages()), 1)
+			}
+			if tc.expectedLogin {
+				assert.Equal(t, server.logins, []string{"monitor\x00secret"})
+			}
+		})
+	}
+}
+
+func TestNewEmailNotifier(t *testing.T) {
+	os.Unsetenv(DefaultEmailPasswordEnv)
+
+	cases := []struct {
+		name         string
+		config       NotifierConfig
+		expectedFail bool
+	}{
+		{name: "Valid", config: NotifierConfig{Url: "smtps://smtp.example.com", From: "monitor@example.com", To: []string{"ops@example.com"}}},
+		{name: "Wrong Scheme", config: NotifierConfig{Url: "https://smtp.example.com", From: "monitor@example.com", To: []string{"ops@example.com"}}, expectedFail: true},
+		{name: "Missing From", config: NotifierConfig{Url: "smtp://smtp.example.com", To: []string{"ops@example.com"}}, expectedFail: true},
+		{name: "Missing To", config: NotifierConfig{Url: "smtp://smtp.example.com", From: "monitor@example.com"}, expectedFail: true},
+		{name: "Owners Only", config: NotifierConfig{Url: "smtp://smtp.example.com", From: "monitor@example.com", Owners: map[string][]string{"payments": {"payments@example.com"}}}},
+		{name: "Invalid Owner Address", config: NotifierConfig{Url: "smtp://smtp.example.com", From: "monitor@example.com", Owners: map[string][]string{"payments": {"payments"}}}, expectedFail: true},
+		{name: "Invalid To", config: NotifierConfig{Url: "smtp://smtp.example.com", From: "monitor@example.com", To: []string{"ops"}}, expectedFail: true},
+		{name: "Missing Password", config: NotifierConfig{Url: "smtp://smtp.example.com", From: "monitor@example.com", To: []string{"ops@example.com"}, User: "monitor"}, expectedFail: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := NewEmailNotifier(tc.config)
+			assert.Equal(t, err != nil, tc.expectedFail)
+		})
+	}
+}
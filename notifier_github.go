@@ -0,0 +1,105 @@
+//go:build !nogithub
+// +build !nogithub
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// DefaultGitHubURL and DefaultGitHubTokenEnv are used when a github notifier's configuration
+// doesn't set url or token_env.
+const (
+	DefaultGitHubURL      string = "https://api.github.com"
+	DefaultGitHubTokenEnv string = "GITHUB_TOKEN"
+)
+
+// GitHubNotifier is a Notifier that opens issues in a GitHub repository.
+type GitHubNotifier struct {
+	api_url    string
+	repository string
+	token      string
+	labels     []string
+	client     *http.Client
+}
+
+// NewGitHubNotifier creates a GitHubNotifier for config.Repository ("owner/name"), authenticated
+// with the token in the config.TokenEnv environment variable.
+func NewGitHubNotifier(config NotifierConfig) (Notifier, error) {
+	if strings.Count(config.Repository, "/") != 1 {
+		return nil, fmt.Errorf("github notifier requires a repository of the form owner/name")
+	}
+
+	token_env := config.TokenEnv
+	if token_env == "" {
+		token_env = DefaultGitHubTokenEnv
+	}
+	token := os.Getenv(token_env)
+	if token == "" {
+		return nil, fmt.Errorf("environment variable %s is not set", token_env)
+	}
+
+	api_url := config.Url
+	if api_url == "" {
+		api_url = DefaultGitHubURL
+	}
+
+	return &GitHubNotifier{
+		api_url:    strings.TrimSuffix(api_url, "/"),
+		repository: config.Repository,
+		token:      token,
+		labels:     config.Labels,
+		client:     &http.Client{Timeout: notifierTimeout},
+	}, nil
+}
+
+// Open creates an issue for the outage and returns its number.
+func (notifier *GitHubNotifier) Open(outage Outage) (string, error) {
+	payload := map[string]interface{}{
+		"title": outage.Title(),
+		"body":  outage.Description(),
+	}
+	if len(notifier.labels) > 0 {
+		payload["labels"] = notifier.labels
+	}
+
+	var issue struct {
+		Number int `json:"number"`
+	}
+	err := doJSON(notifier.client, http.MethodPost, notifier.issuesURL(), notifier.authorize, payload, &issue)
+	if err != nil {
+		return "", err
+	}
+	return strconv.Itoa(issue.Number), nil
+}
+
+// Comment adds a comment to the issue with the provided number.
+func (notifier *GitHubNotifier) Comment(ref string, text string) error {
+	payload := map[string]string{"body": text}
+	return doJSON(notifier.client, http.MethodPost, notifier.issuesURL()+"/"+ref+"/comments", notifier.authorize, payload, nil)
+}
+
+// Close closes the issue with the provided number as completed.
+func (notifier *GitHubNotifier) Close(ref string) error {
+	payload := map[string]string{"state": "closed", "state_reason": "completed"}
+	return doJSON(notifier.client, http.MethodPatch, notifier.issuesURL()+"/"+ref, notifier.authorize, payload, nil)
+}
+
+// issuesURL returns the URL of the repository's issues.
+func (notifier *GitHubNotifier) issuesURL() string {
+	return notifier.api_url + "/repos/" + notifier.repository + "/issues"
+}
+
+// authorize adds the token and API version headers to a request.
+func (notifier *GitHubNotifier) authorize(request *http.Request) {
+	request.Header.Set("Authorization", "Bearer "+notifier.token)
+	request.Header.Set("Accept", "application/vnd.github+json")
+}
+
+func init() {
+	RegisterNotifier("github", NewGitHubNotifier)
+}
@@ -0,0 +1,96 @@
+//go:build !nogithub
+// +build !nogithub
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/go-playground/assert/v2"
+)
+
+func TestGitHubNotifier(t *testing.T) {
+	var requests []string
+	var created map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, r.Header.Get("Authorization"), "Bearer secret")
+		requests = append(requests, r.Method+" "+r.URL.Path)
+
+		switch r.URL.Path {
+		case "/repos/fetch/status/issues":
+			json.NewDecoder(r.Body).Decode(&created)
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"number": 42}`))
+		case "/repos/fetch/status/issues/42/comments":
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{}`))
+		case "/repos/fetch/status/issues/42":
+			w.Write([]byte(`{}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	os.Setenv("CHECKHEALTH_TEST_GITHUB_TOKEN", "secret")
+	defer os.Unsetenv("CHECKHEALTH_TEST_GITHUB_TOKEN")
+	notifier, err := NewGitHubNotifier(NotifierConfig{
+		Url:        server.URL,
+		TokenEnv:   "CHECKHEALTH_TEST_GITHUB_TOKEN",
+		Repository: "fetch/status",
+		Labels:     []string{"outage"},
+	})
+	assert.Equal(t, err, nil)
+
+	ref, err := notifier.Open(Outage{Endpoint: "index", Url: "https://fetch.com/", Since: time.Now()})
+	assert.Equal(t, err, nil)
+	assert.Equal(t, ref, "42")
+	assert.Equal(t, created["title"], "index is down")
+	assert.Equal(t, created["labels"], []interface{}{"outage"})
+
+	assert.Equal(t, notifier.Comment(ref, "recovered"), nil)
+	assert.Equal(t, notifier.Close(ref), nil)
+	assert.Equal(t, requests, []string{
+		"POST /repos/fetch/status/issues",
+		"POST /repos/fetch/status/issues/42/comments",
+		"PATCH /repos/fetch/status/issues/42",
+	})
+
+	// API errors are returned
+	assert.NotEqual(t, notifier.Comment("7", "missing"), nil)
+}
+
+func TestNewGitHubNotifierErrors(t *testing.T) {
+	os.Setenv("CHECKHEALTH_TEST_GITHUB_TOKEN", "secret")
+	defer os.Unsetenv("CHECKHEALTH_TEST_GITHUB_TOKEN")
+
+	cases := []struct {
+		name   string
+		config NotifierConfig
+	}{
+		{
+			name:   "Missing Repository",
+			config: NotifierConfig{TokenEnv: "CHECKHEALTH_TEST_GITHUB_TOKEN"},
+		},
+		{
+			name:   "Missing Token",
+			config: NotifierConfig{TokenEnv: "CHECKHEALTH_TEST_UNSET_TOKEN", Repository: "fetch/status"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := NewGitHubNotifier(tc.config)
+			assert.NotEqual(t, err, nil)
+		})
+	}
+}
+
+func TestGitHubNotifierRegistered(t *testing.T) {
+	assert.Equal(t, hasFeature(EnabledFeatures().Notifiers, "github"), true)
+}
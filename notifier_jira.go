@@ -0,0 +1,141 @@
+//go:build !nojira
+// +build !nojira
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// DefaultJiraTokenEnv, DefaultJiraIssueType and DefaultJiraCloseTransition are used when a jira
+// notifier's configuration doesn't set token_env, issue_type or close_transition.
+const (
+	DefaultJiraTokenEnv        string = "JIRA_API_TOKEN"
+	DefaultJiraIssueType       string = "Bug"
+	DefaultJiraCloseTransition string = "Done"
+)
+
+// JiraNotifier is a Notifier that opens tickets in a Jira project and resolves them through a
+// workflow transition.
+type JiraNotifier struct {
+	base_url         string
+	project          string
+	issue_type       string
+	user             string
+	token            string
+	close_transition string
+	labels           []string
+	client           *http.Client
+}
+
+// NewJiraNotifier creates a JiraNotifier for the config.Project of the Jira instance at config.Url.
+// Requests use basic authentication with config.User and the token in the config.TokenEnv
+// environment variable, or bearer authentication with the token (a personal access token) when no
+// user is set.
+func NewJiraNotifier(config NotifierConfig) (Notifier, error) {
+	if config.Url == "" {
+		return nil, fmt.Errorf("jira notifier requires a url")
+	}
+	if config.Project == "" {
+		return nil, fmt.Errorf("jira notifier requires a project")
+	}
+
+	token_env := config.TokenEnv
+	if token_env == "" {
+		token_env = DefaultJiraTokenEnv
+	}
+	token := os.Getenv(token_env)
+	if token == "" {
+		return nil, fmt.Errorf("environment variable %s is not set", token_env)
+	}
+
+	notifier := &JiraNotifier{
+		base_url:         strings.TrimSuffix(config.Url, "/"),
+		project:          config.Project,
+		issue_type:       config.IssueType,
+		user:             config.User,
+		token:            token,
+		close_transition: config.CloseTransition,
+		labels:           config.Labels,
+		client:           &http.Client{Timeout: notifierTimeout},
+	}
+	if notifier.issue_type == "" {
+		notifier.issue_type = DefaultJiraIssueType
+	}
+	if notifier.close_transition == "" {
+		notifier.close_transition = DefaultJiraCloseTransition
+	}
+	return notifier, nil
+}
+
+// Open creates a ticket for the outage and returns its key, e.g. OPS-42.
+func (notifier *JiraNotifier) Open(outage Outage) (string, error) {
+	fields := map[string]interface{}{
+		"project":     map[string]string{"key": notifier.project},
+		"summary":     outage.Title(),
+		"description": outage.Description(),
+		"issuetype":   map[string]string{"name": notifier.issue_type},
+	}
+	if len(notifier.labels) > 0 {
+		fields["labels"] = notifier.labels
+	}
+
+	var issue struct {
+		Key string `json:"key"`
+	}
+	err := doJSON(notifier.client, http.MethodPost, notifier.base_url+"/rest/api/2/issue", notifier.authorize, map[string]interface{}{"fields": fields}, &issue)
+	if err != nil {
+		return "", err
+	}
+	return issue.Key, nil
+}
+
+// Comment adds a comment to the ticket with the provided key.
+func (notifier *JiraNotifier) Comment(ref string, text string) error {
+	payload := map[string]string{"body": text}
+	return doJSON(notifier.client, http.MethodPost, notifier.issueURL(ref)+"/comment", notifier.authorize, payload, nil)
+}
+
+// Close moves the ticket with the provided key through the close transition of its workflow.
+func (notifier *JiraNotifier) Close(ref string) error {
+	var available struct {
+		Transitions []struct {
+			ID   string `json:"id"`
+			Name string `json:"name"`
+		} `json:"transitions"`
+	}
+	err := doJSON(notifier.client, http.MethodGet, notifier.issueURL(ref)+"/transitions", notifier.authorize, nil, &available)
+	if err != nil {
+		return err
+	}
+
+	for _, transition := range available.Transitions {
+		if strings.EqualFold(transition.Name, notifier.close_transition) {
+			payload := map[string]interface{}{"transition": map[string]string{"id": transition.ID}}
+			return doJSON(notifier.client, http.MethodPost, notifier.issueURL(ref)+"/transitions", notifier.authorize, payload, nil)
+		}
+	}
+	return fmt.Errorf("ticket %s has no %q transition", ref, notifier.close_transition)
+}
+
+// issueURL returns the API URL of the ticket with the provided key.
+func (notifier *JiraNotifier) issueURL(ref string) string {
+	return notifier.base_url + "/rest/api/2/issue/" + url.PathEscape(ref)
+}
+
+// authorize adds the credentials to a request.
+func (notifier *JiraNotifier) authorize(request *http.Request) {
+	if notifier.user == "" {
+		request.Header.Set("Authorization", "Bearer "+notifier.token)
+		return
+	}
+	request.SetBasicAuth(notifier.user, notifier.token)
+}
+
+func init() {
+	RegisterNotifier("jira", NewJiraNotifier)
+}
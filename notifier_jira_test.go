@@ -0,0 +1,95 @@
+//go:build !nojira
+// +build !nojira
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/go-playground/assert/v2"
+)
+
+func TestJiraNotifier(t *testing.T) {
+	var requests []string
+	var created map[string]map[string]interface{}
+	var transition map[string]map[string]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, token, ok := r.BasicAuth()
+		assert.Equal(t, ok, true)
+		assert.Equal(t, user, "monitor@example.com")
+		assert.Equal(t, token, "secret")
+		requests = append(requests, r.Method+" "+r.URL.Path)
+
+		switch r.Method + " " + r.URL.Path {
+		case "POST /rest/api/2/issue":
+			json.NewDecoder(r.Body).Decode(&created)
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"id": "10001", "key": "OPS-42"}`))
+		case "POST /rest/api/2/issue/OPS-42/comment":
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{}`))
+		case "GET /rest/api/2/issue/OPS-42/transitions":
+			w.Write([]byte(`{"transitions": [{"id": "11", "name": "In Progress"}, {"id": "31", "name": "Done"}]}`))
+		case "POST /rest/api/2/issue/OPS-42/transitions":
+			json.NewDecoder(r.Body).Decode(&transition)
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	os.Setenv("CHECKHEALTH_TEST_JIRA_TOKEN", "secret")
+	defer os.Unsetenv("CHECKHEALTH_TEST_JIRA_TOKEN")
+	notifier, err := NewJiraNotifier(NotifierConfig{
+		Url:      server.URL,
+		TokenEnv: "CHECKHEALTH_TEST_JIRA_TOKEN",
+		Project:  "OPS",
+		User:     "monitor@example.com",
+	})
+	assert.Equal(t, err, nil)
+
+	ref, err := notifier.Open(Outage{Endpoint: "index", Url: "https://fetch.com/", Since: time.Now()})
+	assert.Equal(t, err, nil)
+	assert.Equal(t, ref, "OPS-42")
+	assert.Equal(t, created["fields"]["summary"], "index is down")
+	assert.Equal(t, created["fields"]["issuetype"], map[string]interface{}{"name": DefaultJiraIssueType})
+
+	assert.Equal(t, notifier.Comment(ref, "recovered"), nil)
+	assert.Equal(t, notifier.Close(ref), nil)
+	assert.Equal(t, transition["transition"]["id"], "31")
+	assert.Equal(t, requests, []string{
+		"POST /rest/api/2/issue",
+		"POST /rest/api/2/issue/OPS-42/comment",
+		"GET /rest/api/2/issue/OPS-42/transitions",
+		"POST /rest/api/2/issue/OPS-42/transitions",
+	})
+}
+
+func TestJiraNotifierMissingTransition(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, r.Header.Get("Authorization"), "Bearer secret")
+		w.Write([]byte(`{"transitions": [{"id": "11", "name": "In Progress"}]}`))
+	}))
+	defer server.Close()
+
+	os.Setenv("CHECKHEALTH_TEST_JIRA_TOKEN", "secret")
+	defer os.Unsetenv("CHECKHEALTH_TEST_JIRA_TOKEN")
+	notifier, err := NewJiraNotifier(NotifierConfig{
+		Url:             server.URL,
+		TokenEnv:        "CHECKHEALTH_TEST_JIRA_TOKEN",
+		Project:         "OPS",
+		CloseTransition: "Resolved",
+	})
+	assert.Equal(t, err, nil)
+	assert.NotEqual(t, notifier.Close("OPS-42"), nil)
+}
+
+func TestJiraNotifierRegistered(t *testing.T) {
+	assert.Equal(t, hasFeature(EnabledFeatures().Notifiers, "jira"), true)
+}
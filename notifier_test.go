@@ -0,0 +1,231 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-playground/assert/v2"
+)
+
+// recordingNotifier is a Notifier recording its calls, failing them while fail is set.
+type recordingNotifier struct {
+	mu     sync.Mutex
+	calls  []string
+	opened int
+	fail   bool
+}
+
+func (notifier *recordingNotifier) Open(outage Outage) (string, error) {
+	notifier.mu.Lock()
+	defer notifier.mu.Unlock()
+	if notifier.fail {
+		return "", errors.New("tracker unavailable")
+	}
+	notifier.opened++
+	ref := strings.Repeat("#", notifier.opened)
+	notifier.calls = append(notifier.calls, "open "+outage.Endpoint+" "+ref)
+	return ref, nil
+}
+
+func (notifier *recordingNotifier) Comment(ref string, text string) error {
+	notifier.mu.Lock()
+	defer notifier.mu.Unlock()
+	notifier.calls = append(notifier.calls, "comment "+ref)
+	return nil
+}
+
+func (notifier *recordingNotifier) Close(ref string) error {
+	notifier.mu.Lock()
+	defer notifier.mu.Unlock()
+	notifier.calls = append(notifier.calls, "close "+ref)
+	return nil
+}
+
+func (notifier *recordingNotifier) Calls() []string {
+	notifier.mu.Lock()
+	defer notifier.mu.Unlock()
+	return append([]string{}, notifier.calls...)
+}
+
+func TestOutageNotifierProcess(t *testing.T) {
+	base := time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+	notifier := &recordingNotifier{}
+	outage_notifier := newOutageNotifier("test", notifier, NotifierConfig{After: 5 * time.Minute})
+	defer outage_notifier.Close()
+
+	down := EndpointStatus{Endpoint: "index", Url: "https://fetch.com/", State: StateDown, Since: base}
+	up := EndpointStatus{Endpoint: "index", Url: "https://fetch.com/", State: StateUp, Since: base.Add(20 * time.Minute)}
+
+	// not down for long enough
+	outage_notifier.process(outageSnapshot{statuses: []EndpointStatus{down}, at: base.Add(4 * time.Minute)})
+	assert.Equal(t, len(notifier.Calls()), 0)
+
+	// sustained outage opens a single issue
+	outage_notifier.process(outageSnapshot{statuses: []EndpointStatus{down}, at: base.Add(5 * time.Minute)})
+	outage_notifier.process(outageSnapshot{statuses: []EndpointStatus{down}, at: base.Add(10 * time.Minute)})
+	assert.Equal(t, notifier.Calls(), []string{"open index #"})
+
+	// recovery comments on and closes the issue
+	outage_notifier.process(outageSnapshot{statuses: []EndpointStatus{up}, at: base.Add(20 * time.Minute)})
+	assert.Equal(t, notifier.Calls(), []string{"open index #", "comment #", "close #"})
+
+	// a new outage opens a new issue
+	down.Since = base.Add(30 * time.Minute)
+	outage_notifier.process(outageSnapshot{statuses: []EndpointStatus{down}, at: base.Add(40 * time.Minute)})
+	assert.Equal(t, notifier.Calls(), []string{"open index #", "comment #", "close #", "open index ##"})
+}
+
+func TestOutageNotifierAbandoned(t *testing.T) {
+	base := time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+	notifier := &recordingNotifier{}
+	outage_notifier := newOutageNotifier("test", notifier, NotifierConfig{After: 5 * time.Minute})
+	defer outage_notifier.Close()
+
+	abandoned_at := base.Add(time.Hour)
+	down := EndpointStatus{Endpoint: "index", Url: "https://fetch.com/", State: StateDown, Since: base}
+	abandoned := down
+	abandoned.AbandonedAt = &abandoned_at
+
+	// the abandonment is commented on the open issue once
+	outage_notifier.process(outageSnapshot{statuses: []EndpointStatus{down}, at: base.Add(5 * time.Minute)})
+	outage_notifier.process(outageSnapshot{statuses: []EndpointStatus{abandoned}, at: abandoned_at})
+	outage_notifier.process(outageSnapshot{statuses: []EndpointStatus{abandoned}, at: abandoned_at.Add(time.Minute)})
+	assert.Equal(t, notifier.Calls(), []string{"open index #", "comment #"})
+
+	// once resumed, the endpoint is commented on again when it is abandoned again
+	outage_notifier.process(outageSnapshot{statuses: []EndpointStatus{down}, at: abandoned_at.Add(2 * time.Minute)})
+	outage_notifier.process(outageSnapshot{statuses: []EndpointStatus{abandoned}, at: abandoned_at.Add(3 * time.Minute)})
+	assert.Equal(t, notifier.Calls(), []string{"open index #", "comment #", "comment #"})
+
+	// the issue of an endpoint abandoned before it was opened describes the abandonment
+	outage := Outage{Endpoint: "index", Url: "https://fetch.com/", Since: base, AbandonedAt: abandoned_at}
+	assert.Equal(t, outage.Description(), "checkhealth detected a sustained outage of index.\n\n"+
+		"- URL: https://fetch.com/\n"+
+		"- Down since: 2023-06-01T12:00:00Z\n"+
+		"- Abandoned: checks paused since 2023-06-01T13:00:00Z\n")
+}
+
+func TestOutageNotifierRetriesFailedOpen(t *testing.T) {
+	base := time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+	notifier := &recordingNotifier{fail: true}
+	outage_notifier := newOutageNotifier("test", notifier, NotifierConfig{After: time.Minute})
+	defer outage_notifier.Close()
+
+	down := EndpointStatus{Endpoint: "index", State: StateDown, Since: base}
+	outage_notifier.process(outageSnapshot{statuses: []EndpointStatus{down}, at: base.Add(time.Minute)})
+	assert.Equal(t, len(notifier.Calls()), 0)
+
+	notifier.mu.Lock()
+	notifier.fail = false
+	notifier.mu.Unlock()
+
+	outage_notifier.process(outageSnapshot{statuses: []EndpointStatus{down}, at: base.Add(2 * time.Minute)})
+	assert.Equal(t, notifier.Calls(), []string{"open index #"})
+	assert.Equal(t, outage_notifier.breaker.Status().ConsecutiveFailures, 0)
+}
+
+func TestOutageNotifierDampening(t *testing.T) {
+	base := time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+	notifier := &recordingNotifier{}
+	outage_notifier := newOutageNotifier("test", notifier, NotifierConfig{After: time.Minute, Dampening: 2 * time.Minute})
+	defer outage_notifier.Close()
+
+	index := EndpointStatus{Endpoint: "index", Url: "https://fetch.com/", State: StateDown, Since: base}
+	careers := EndpointStatus{Endpoint: "careers", Url: "https://fetch.com/careers", State: StateUp, Since: base}
+	login := EndpointStatus{Endpoint: "login", Url: "https://fetch.com/login", State: StateDown, Since: base}
+
+	// a flapping endpoint recovering within the window doesn't open an issue
+	outage_notifier.process(outageSnapshot{statuses: []EndpointStatus{index, careers}, at: base.Add(time.Minute)})
+	index.State = StateUp
+	outage_notifier.process(outageSnapshot{statuses: []EndpointStatus{index, careers}, at: base.Add(2 * time.Minute)})
+	index.State = StateDown
+	outage_notifier.process(outageSnapshot{statuses: []EndpointStatus{index, careers}, at: base.Add(3 * time.Minute)})
+	assert.Equal(t, len(notifier.Calls()), 0)
+
+	// the endpoints going down within the window are coalesced into a single issue
+	careers.State, careers.Since = StateDown, base.Add(3*time.Minute)
+	outage_notifier.process(outageSnapshot{statuses: []EndpointStatus{index, careers, login}, at: base.Add(4 * time.Minute)})
+	assert.Equal(t, len(notifier.Calls()), 0)
+	outage_notifier.process(outageSnapshot{statuses: []EndpointStatus{index, careers, login}, at: base.Add(5 * time.Minute)})
+	assert.Equal(t, notifier.Calls(), []string{"open index #"})
+	assert.Equal(t, len(outage_notifier.issues), 3)
+
+	// the issue is closed once the last of them recovers
+	index.State, careers.State = StateUp, StateUp
+	outage_notifier.process(outageSnapshot{statuses: []EndpointStatus{index, careers, login}, at: base.Add(10 * time.Minute)})
+	assert.Equal(t, notifier.Calls(), []string{"open index #"})
+	login.State = StateUp
+	outage_notifier.process(outageSnapshot{statuses: []EndpointStatus{index, careers, login}, at: base.Add(11 * time.Minute)})
+	assert.Equal(t, notifier.Calls(), []string{"open index #", "comment #", "close #"})
+
+	// a single endpoint down after the window has an issue of its own
+	login.State, login.Since = StateDown, base.Add(20*time.Minute)
+	outage_notifier.process(outageSnapshot{statuses: []EndpointStatus{index, careers, login}, at: base.Add(21 * time.Minute)})
+	outage_notifier.process(outageSnapshot{statuses: []EndpointStatus{index, careers, login}, at: base.Add(23 * time.Minute)})
+	assert.Equal(t, notifier.Calls(), []string{"open index #", "comment #", "close #", "open login ##"})
+}
+
+func TestOutageNotifierNotify(t *testing.T) {
+	notifier := &recordingNotifier{}
+	outage_notifier := newOutageNotifier("test", notifier, NotifierConfig{After: time.Minute})
+
+	since := time.Now().Add(-time.Hour)
+	outage_notifier.Notify([]EndpointStatus{{Endpoint: "index", State: StateDown, Since: since}}, time.Now())
+
+	// closing processes the queued states
+	outage_notifier.Close()
+	assert.Equal(t, notifier.Calls(), []string{"open index #"})
+
+	// notifying a closed notifier is ignored
+	outage_notifier.Notify([]EndpointStatus{{Endpoint: "careers", State: StateDown, Since: since}}, time.Now())
+	assert.Equal(t, notifier.Calls(), []string{"open index #"})
+}
+
+func TestOutageDescription(t *testing.T) {
+	outage := Outage{
+		Endpoint:  "index",
+		Url:       "https://fetch.com/",
+		Since:     time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC),
+		ErrorKind: ErrorKindTimeout,
+		LastError: "context deadline exceeded",
+		Runbook:   "https://wiki.example.com/runbooks/index",
+		Labels:    map[string]string{"team": "web", "env": "prod"},
+	}
+
+	assert.Equal(t, outage.Title(), "index is down")
+	assert.Equal(t, outage.Description(), "checkhealth detected a sustained outage of index.\n\n"+
+		"- URL: https://fetch.com/\n"+
+		"- Down since: 2023-06-01T12:00:00Z\n"+
+		"- Error kind: timeout\n"+
+		"- Last error: context deadline exceeded\n"+
+		"- Labels: env=prod, team=web\n"+
+		"- Runbook: https://wiki.example.com/runbooks/index\n")
+}
+
+func TestCoalescedOutageDescription(t *testing.T) {
+	since := time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+	index := Outage{Endpoint: "index", Url: "https://fetch.com/", Since: since, ErrorKind: ErrorKindTimeout, Owner: "web"}
+	careers := Outage{Endpoint: "careers", Url: "https://fetch.com/careers", Since: since.Add(time.Minute), Owner: "web"}
+	outage := index
+	outage.Affected = []Outage{index, careers}
+
+	assert.Equal(t, outage.Title(), "index and 1 other endpoint are down")
+	assert.Equal(t, outage.Description(), "checkhealth detected a sustained outage of 2 endpoints.\n\n"+
+		"index\n"+
+		"- URL: https://fetch.com/\n"+
+		"- Down since: 2023-06-01T12:00:00Z\n"+
+		"- Error kind: timeout\n"+
+		"- Owner: web\n"+
+		"\ncareers\n"+
+		"- URL: https://fetch.com/careers\n"+
+		"- Down since: 2023-06-01T12:01:00Z\n"+
+		"- Owner: web\n")
+}
+
+func TestNewOutageNotifierUnknownType(t *testing.T) {
+	_, err := NewOutageNotifier(NotifierConfig{Type: "pager"})
+	assert.NotEqual(t, err, nil)
+}
@@ -0,0 +1,343 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"time"
+)
+
+// ResultSchemaVersion is the version of the JSON schema followed by every event emitted by the JSON
+// output mode. It has the form MAJOR.MINOR and is included in each event as "schema_version".
+//
+// Compatibility rules:
+//   - A MINOR bump only adds: new optional fields on existing events or new event types. Consumers
+//     must ignore fields and event types they don't recognize.
+//   - A MAJOR bump is required to remove or rename a field, change a field's type or meaning, or
+//     remove an event type. Consumers should reject events with a MAJOR version they don't know.
+//
+// The schema is published as a JSON Schema document in ResultJSONSchema.
+const ResultSchemaVersion string = "1.18"
+
+// ResultJSONSchema is the JSON Schema document describing the events emitted by the JSON output
+// mode for the current ResultSchemaVersion.
+//
+//go:embed result_schema.json
+var ResultJSONSchema string
+
+// EventDomainAvailability is the event type reporting a domain's cumulative availability. It is
+// emitted for every domain at the end of each check cycle.
+const EventDomainAvailability string = "domain_availability"
+
+// Event is a single versioned record emitted by the JSON output mode. Type determines which of the
+// optional payload fields is populated.
+type Event struct {
+	SchemaVersion string    `json:"schema_version"`
+	Type          string    `json:"type"`
+	Timestamp     time.Time `json:"timestamp"`
+
+	Domain   *DomainEvent   `json:"domain,omitempty"`
+	State    *StateEvent    `json:"state,omitempty"`
+	Failures *FailuresEvent `json:"failures,omitempty"`
+	Derived  *DerivedEvent  `json:"derived,omitempty"`
+
+	ConfigChange *ConfigChangeEvent `json:"config_change,omitempty"`
+	StatusChange *StatusChangeEvent `json:"status_change,omitempty"`
+	Check        *CheckEvent        `json:"check,omitempty"`
+	Abandoned    *AbandonedEvent    `json:"abandoned,omitempty"`
+	Canary       *CanaryEvent       `json:"canary,omitempty"`
+
+	// Signature is the base64 ed25519 signature of the event when a signing key is configured. It
+	// must remain the last field, see EventSigner.
+	Signature string `json:"signature,omitempty"`
+}
+
+// DomainEvent is the payload of an EventDomainAvailability event.
+type DomainEvent struct {
+	Name          string `json:"name"`
+	Availability  int    `json:"availability"`
+	UpCount       int    `json:"up_count"`
+	TotalRequests int    `json:"total_requests"`
+	UnknownCount  int    `json:"unknown_count"`
+
+	// DegradedCount is the number of degraded checks, also counted in UpCount.
+	DegradedCount int `json:"degraded_count,omitempty"`
+
+	// BytesSent and BytesReceived are the approximate bytes transferred by the checks of the
+	// domain's endpoints.
+	BytesSent     int64 `json:"bytes_sent,omitempty"`
+	BytesReceived int64 `json:"bytes_received,omitempty"`
+
+	Families map[string]FamilyEvent `json:"families,omitempty"`
+
+	// Fallback is the availability of the fallback checks of the domain's endpoints, made while
+	// they were down.
+	Fallback *FallbackEvent `json:"fallback,omitempty"`
+
+	// Latency is the distribution of the latencies of the recent checks of the domain's endpoints.
+	Latency *LatencyEvent `json:"latency,omitempty"`
+
+	// Periods are the availability of the domain within the current calendar period of each of the
+	// availability_periods.
+	Periods []PeriodEvent `json:"periods,omitempty"`
+}
+
+// PeriodEvent is the availability of a domain within a calendar period, such as the current day,
+// and within the previous one when it is known.
+type PeriodEvent struct {
+	Period        string    `json:"period"`
+	Start         time.Time `json:"start"`
+	Availability  int       `json:"availability"`
+	UpCount       int       `json:"up_count"`
+	TotalRequests int       `json:"total_requests"`
+
+	// Previous is the final availability of the previous period, when it ended while the domain
+	// was checked.
+	Previous *PreviousPeriodEvent `json:"previous,omitempty"`
+}
+
+// PreviousPeriodEvent is the final availability of a domain within the calendar period that ended
+// at End.
+type PreviousPeriodEvent struct {
+	Start         time.Time `json:"start"`
+	End           time.Time `json:"end"`
+	Availability  int       `json:"availability"`
+	UpCount       int       `json:"up_count"`
+	TotalRequests int       `json:"total_requests"`
+}
+
+// LatencyEvent is the distribution of the recent latencies of a domain, in milliseconds.
+type LatencyEvent struct {
+	Samples int     `json:"samples"`
+	P50Ms   float64 `json:"p50_ms"`
+	P95Ms   float64 `json:"p95_ms"`
+	P99Ms   float64 `json:"p99_ms"`
+	MaxMs   float64 `json:"max_ms"`
+
+	// Windows are the distributions of the latencies within each of the latency_windows.
+	Windows []LatencyWindowEvent `json:"windows,omitempty"`
+}
+
+// LatencyWindowEvent is the distribution of the latencies of a domain within a latency window, in
+// milliseconds.
+type LatencyWindowEvent struct {
+	Window  string  `json:"window"`
+	Samples int     `json:"samples"`
+	P50Ms   float64 `json:"p50_ms"`
+	P95Ms   float64 `json:"p95_ms"`
+	P99Ms   float64 `json:"p99_ms"`
+	MaxMs   float64 `json:"max_ms"`
+}
+
+// FamilyEvent is the availability of a domain for a single address family, reported for domains
+// with dual-stack endpoints.
+type FamilyEvent struct {
+	Availability  int `json:"availability"`
+	UpCount       int `json:"up_count"`
+	TotalRequests int `json:"total_requests"`
+}
+
+// FallbackEvent is the availability of the fallback checks of a domain's endpoints, reported for
+// domains with endpoints that have a fallback_url and were down.
+type FallbackEvent struct {
+	Availability  int `json:"availability"`
+	UpCount       int `json:"up_count"`
+	TotalRequests int `json:"total_requests"`
+}
+
+// StateEvent is the payload of an EventStateChange event.
+type StateEvent struct {
+	Endpoint  string    `json:"endpoint"`
+	Url       string    `json:"url"`
+	From      string    `json:"from"`
+	To        string    `json:"to"`
+	ChangedAt time.Time `json:"changed_at"`
+
+	// PreviousDurationMs is how long the endpoint was in the state it left, in milliseconds.
+	PreviousDurationMs int64 `json:"previous_duration_ms"`
+
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// EventCheckResult is the event type reporting the result of a single check. It is only emitted to
+// the sinks with results set, for every check of every cycle.
+const EventCheckResult string = "check_result"
+
+// CheckEvent is the payload of an EventCheckResult event.
+type CheckEvent struct {
+	Endpoint   string    `json:"endpoint"`
+	Url        string    `json:"url"`
+	Domain     string    `json:"domain,omitempty"`
+	Status     string    `json:"status"`
+	StatusCode int       `json:"status_code,omitempty"`
+	LatencyMs  float64   `json:"latency_ms"`
+	StartedAt  time.Time `json:"started_at"`
+	ErrorKind  string    `json:"error_kind,omitempty"`
+	Error      string    `json:"error,omitempty"`
+
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// NewEvent returns an Event of the provided type stamped with the current ResultSchemaVersion.
+func NewEvent(event_type string, timestamp time.Time) Event {
+	return Event{
+		SchemaVersion: ResultSchemaVersion,
+		Type:          event_type,
+		Timestamp:     timestamp.UTC(),
+	}
+}
+
+// DomainEvents is a method for HealthCheckTargets that returns an EventDomainAvailability event for
+// each domain in the Domains linked list, stamped with the provided timestamp and signed when a
+// signer is configured. Domains without a name are skipped, matching LogDomainHealth.
+func (target *HealthCheckTargets) DomainEvents(timestamp time.Time) []Event {
+	var events []Event
+	location := target.Settings.AvailabilityLocation()
+
+	for domain := target.Domains; domain != nil; domain = domain.Next {
+		if domain.Name == "" {
+			continue
+		}
+
+		event := NewEvent(EventDomainAvailability, timestamp)
+		event.Domain = target.domainEvent(domain, timestamp, location)
+		events = append(events, event)
+	}
+
+	if err := target.Signer.Sign(events); err != nil {
+		log.Printf("Failed to sign events: %v", err)
+	}
+	return events
+}
+
+// CheckEvents is a method for HealthCheckTargets that returns an EventCheckResult event for each
+// result of a cycle of the endpoints, in the same order, stamped with the provided timestamp and
+// signed when a signer is configured.
+func (target *HealthCheckTargets) CheckEvents(results []CheckResult, endpoints *Endpoints, timestamp time.Time) []Event {
+	var events []Event
+	for i, result := range results {
+		event := NewEvent(EventCheckResult, timestamp)
+		event.Check = &CheckEvent{
+			Endpoint:   result.Endpoint,
+			Url:        result.Url,
+			Status:     result.Status,
+			StatusCode: result.StatusCode,
+			LatencyMs:  latencyMilliseconds(result.Latency),
+			StartedAt:  result.StartedAt.UTC(),
+			ErrorKind:  result.ErrorKind,
+			Error:      result.Error,
+		}
+		if endpoints != nil && i < len(*endpoints) {
+			if (*endpoints)[i].Domain != nil {
+				event.Check.Domain = (*endpoints)[i].Domain.Name
+			}
+			event.Check.Labels = (*endpoints)[i].Labels
+		}
+		events = append(events, event)
+	}
+
+	if err := target.Signer.Sign(events); err != nil {
+		log.Printf("Failed to sign events: %v", err)
+	}
+	return events
+}
+
+// domainEvent is a method for HealthCheckTargets that returns the payload of the
+// EventDomainAvailability event of a domain at timestamp, with its calendar periods delimited in
+// location.
+func (target *HealthCheckTargets) domainEvent(domain *Domain, timestamp time.Time, location *time.Location) *DomainEvent {
+	payload := &DomainEvent{
+		Name:          domain.Name,
+		Availability:  domain.Availability(),
+		UpCount:       domain.UpCount,
+		TotalRequests: domain.TotalRequests,
+		UnknownCount:  domain.UnknownCount,
+		DegradedCount: domain.DegradedCount,
+		BytesSent:     domain.BytesSent,
+		BytesReceived: domain.BytesReceived,
+	}
+	if summary := domain.LatencySummary(); summary.Count > 0 {
+		payload.Latency = &LatencyEvent{
+			Samples: summary.Count,
+			P50Ms:   latencyMilliseconds(summary.P50),
+			P95Ms:   latencyMilliseconds(summary.P95),
+			P99Ms:   latencyMilliseconds(summary.P99),
+			MaxMs:   latencyMilliseconds(summary.Max),
+		}
+		for _, window := range domain.LatencyWindowSummaries(timestamp, target.Settings.LatencyWindows) {
+			payload.Latency.Windows = append(payload.Latency.Windows, LatencyWindowEvent{
+				Window:  FormatLatencyWindow(window.Window),
+				Samples: window.Count,
+				P50Ms:   latencyMilliseconds(window.P50),
+				P95Ms:   latencyMilliseconds(window.P95),
+				P99Ms:   latencyMilliseconds(window.P99),
+				MaxMs:   latencyMilliseconds(window.Max),
+			})
+		}
+	}
+	for _, summary := range domain.PeriodSummaries(timestamp, target.Settings.AvailabilityPeriods, location) {
+		period := PeriodEvent{
+			Period:        summary.Period,
+			Start:         summary.Start.UTC(),
+			Availability:  summary.Availability(),
+			UpCount:       summary.UpCount,
+			TotalRequests: summary.TotalRequests,
+		}
+		if previous := summary.Previous; previous != nil {
+			period.Previous = &PreviousPeriodEvent{
+				Start:         previous.Start.UTC(),
+				End:           summary.Start.UTC(),
+				Availability:  previous.Availability(),
+				UpCount:       previous.UpCount,
+				TotalRequests: previous.TotalRequests,
+			}
+		}
+		payload.Periods = append(payload.Periods, period)
+	}
+	for _, family := range domain.FamilyNames() {
+		if payload.Families == nil {
+			payload.Families = map[string]FamilyEvent{}
+		}
+		stats := domain.Families[family]
+		payload.Families[family] = FamilyEvent{
+			Availability:  stats.Availability(),
+			UpCount:       stats.UpCount,
+			TotalRequests: stats.TotalRequests,
+		}
+	}
+	if domain.Fallback != nil {
+		payload.Fallback = &FallbackEvent{
+			Availability:  domain.Fallback.Availability(),
+			UpCount:       domain.Fallback.UpCount,
+			TotalRequests: domain.Fallback.TotalRequests,
+		}
+	}
+	return payload
+}
+
+// latencyMilliseconds converts a latency to milliseconds, with microsecond precision.
+func latencyMilliseconds(latency time.Duration) float64 {
+	return float64(latency.Microseconds()) / 1000
+}
+
+// WriteEvents encodes each event as a single line of JSON to w.
+func WriteEvents(w io.Writer, events []Event) error {
+	encoder := json.NewEncoder(w)
+	for _, event := range events {
+		if err := encoder.Encode(event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LogDomainHealthJSON is a method for HealthCheckTargets that prints the cumulative availability of
+// each domain to the console as EventDomainAvailability events, one JSON object per line.
+func (target *HealthCheckTargets) LogDomainHealthJSON() {
+	err := WriteEvents(os.Stdout, target.DomainEvents(time.Now()))
+	if err != nil {
+		log.Printf("Failed to write JSON output: %v", err)
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-playground/assert/v2"
+)
+
+func TestDomainEvents(t *testing.T) {
+	timestamp := time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	windowed := &Domain{Name: "example.com", UpCount: 1, TotalRequests: 1}
+	windows := []time.Duration{5 * time.Minute}
+	windowed.RecordLatency(100 * time.Millisecond)
+	windowed.RecordWindowLatency(timestamp.Add(-time.Minute), 100*time.Millisecond, windows)
+
+	cases := []struct {
+		name           string
+		target         *HealthCheckTargets
+		expectedEvents []Event
+	}{
+		{
+			name:           "No Domains",
+			target:         &HealthCheckTargets{},
+			expectedEvents: nil,
+		},
+		{
+			name: "Empty Domain Is Skipped",
+			target: &HealthCheckTargets{
+				Domains: &Domain{},
+			},
+			expectedEvents: nil,
+		},
+		{
+			name: "Multiple Domains",
+			target: &HealthCheckTargets{
+				Domains: &Domain{
+					Name:          "example.com",
+					UpCount:       1,
+					TotalRequests: 2,
+					Next: &Domain{
+						Name:          "localhost",
+						UpCount:       2,
+						TotalRequests: 3,
+					},
+				},
+			},
+			expectedEvents: []Event{
+				{
+					SchemaVersion: ResultSchemaVersion,
+					Type:          EventDomainAvailability,
+					Timestamp:     timestamp,
+					Domain: &DomainEvent{
+						Name:          "example.com",
+						Availability:  50,
+						UpCount:       1,
+						TotalRequests: 2,
+					},
+				},
+				{
+					SchemaVersion: ResultSchemaVersion,
+					Type:          EventDomainAvailability,
+					Timestamp:     timestamp,
+					Domain: &DomainEvent{
+						Name:          "localhost",
+						Availability:  67,
+						UpCount:       2,
+						TotalRequests: 3,
+					},
+				},
+			},
+		},
+		{
+			name: "Latency Windows",
+			target: &HealthCheckTargets{
+				Domains:  windowed,
+				Settings: Settings{LatencyWindows: windows},
+			},
+			expectedEvents: []Event{
+				{
+					SchemaVersion: ResultSchemaVersion,
+					Type:          EventDomainAvailability,
+					Timestamp:     timestamp,
+					Domain: &DomainEvent{
+						Name:          "example.com",
+						Availability:  100,
+						UpCount:       1,
+						TotalRequests: 1,
+						Latency: &LatencyEvent{
+							Samples: 1,
+							P50Ms:   100,
+							P95Ms:   100,
+							P99Ms:   100,
+							MaxMs:   100,
+							Windows: []LatencyWindowEvent{
+								{Window: "5m", Samples: 1, P50Ms: 100, P95Ms: 100, P99Ms: 100, MaxMs: 100},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.target.DomainEvents(timestamp), tc.expectedEvents)
+		})
+	}
+}
+
+func TestWriteEvents(t *testing.T) {
+	timestamp := time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+	target := &HealthCheckTargets{
+		Domains: &Domain{
+			Name:          "example.com",
+			UpCount:       1,
+			TotalRequests: 2,
+		},
+	}
+
+	var output bytes.Buffer
+	err := WriteEvents(&output, target.DomainEvents(timestamp))
+	assert.Equal(t, err, nil)
+
+	expected := `{"schema_version":"1.18","type":"domain_availability","timestamp":"2023-06-01T12:00:00Z",` +
+		`"domain":{"name":"example.com","availability":50,"up_count":1,"total_requests":2,"unknown_count":0}}` + "\n"
+	assert.Equal(t, output.String(), expected)
+}
+
+// TestResultJSONSchema guards against drift between the Go event types and the published JSON
+// Schema document.
+func TestResultJSONSchema(t *testing.T) {
+	var schema map[string]interface{}
+	err := json.Unmarshal([]byte(ResultJSONSchema), &schema)
+	assert.Equal(t, err, nil)
+
+	// the schema must accept the current schema version
+	properties := schema["properties"].(map[string]interface{})
+	version := properties["schema_version"].(map[string]interface{})
+	matched, err := regexp.MatchString(version["pattern"].(string), ResultSchemaVersion)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, matched, true)
+
+	// every JSON field of the event types must be described by the schema
+	assertSchemaProperties(t, reflect.TypeOf(Event{}), properties)
+}
+
+func assertSchemaProperties(t *testing.T, event_type reflect.Type, properties map[string]interface{}) {
+	t.Helper()
+
+	for i := 0; i < event_type.NumField(); i++ {
+		field := event_type.Field(i)
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+
+		property, ok := properties[name].(map[string]interface{})
+		if !ok {
+			t.Errorf("field %s.%s (%q) is missing from the JSON schema", event_type.Name(), field.Name, name)
+			continue
+		}
+
+		// recurse into nested payloads
+		nested := field.Type
+		if nested.Kind() == reflect.Ptr {
+			nested = nested.Elem()
+		}
+		if nested.Kind() == reflect.Struct && nested != reflect.TypeOf(time.Time{}) {
+			assertSchemaProperties(t, nested, property["properties"].(map[string]interface{}))
+		}
+	}
+}
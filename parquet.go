@@ -0,0 +1,371 @@
+//go:build !noparquet
+// +build !noparquet
+
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+// A minimal Parquet writer, enough to export flat tables readable by DuckDB, Spark or Athena
+// without pulling in a Parquet library. Each file holds a single row group, with one GZIP
+// compressed data page per column, PLAIN encoded values and RLE encoded definition levels for
+// optional columns. The file metadata is serialized with the Thrift compact protocol, see
+// https://github.com/apache/parquet-format.
+
+// parquetMagic starts and ends every Parquet file.
+const parquetMagic string = "PAR1"
+
+// Physical types of Parquet columns.
+const (
+	parquetInt32     int32 = 1
+	parquetInt64     int32 = 2
+	parquetDouble    int32 = 5
+	parquetByteArray int32 = 6
+)
+
+// Converted types annotating the physical type of Parquet columns. parquetNoConversion leaves the
+// physical type as is.
+const (
+	parquetNoConversion    int32 = -1
+	parquetUTF8            int32 = 0
+	parquetTimestampMillis int32 = 9
+)
+
+// Parquet repetition types, encodings, compression codecs and page types.
+const (
+	parquetRequired    int32 = 0
+	parquetOptional    int32 = 1
+	parquetPlain       int32 = 0
+	parquetRLE         int32 = 3
+	parquetGzip        int32 = 2
+	parquetDataPage    int32 = 0
+	parquetFileVersion int32 = 1
+)
+
+// parquetColumn is a column of a Parquet table. Values are int32, int64, float64 or string
+// according to the physical type, and nil for the nulls of optional columns.
+type parquetColumn struct {
+	name      string
+	kind      int32
+	converted int32
+	optional  bool
+	values    []interface{}
+}
+
+// writeParquet writes the columns as a Parquet file to w. Every column must hold the same number
+// of values.
+func writeParquet(w io.Writer, columns []parquetColumn) error {
+	rows := 0
+	if len(columns) > 0 {
+		rows = len(columns[0].values)
+	}
+
+	var file bytes.Buffer
+	file.WriteString(parquetMagic)
+
+	chunks := make([]parquetChunk, 0, len(columns))
+	var total_size int64
+	for _, column := range columns {
+		if len(column.values) != rows {
+			return fmt.Errorf("column %s has %d values, expected %d", column.name, len(column.values), rows)
+		}
+		page, err := column.encodePage()
+		if err != nil {
+			return fmt.Errorf("failed to encode column %s: %v", column.name, err)
+		}
+		compressed, err := gzipBytes(page)
+		if err != nil {
+			return fmt.Errorf("failed to compress column %s: %v", column.name, err)
+		}
+
+		header := newThriftWriter()
+		header.i32(1, parquetDataPage)
+		header.i32(2, int32(len(page)))
+		header.i32(3, int32(len(compressed)))
+		header.beginStruct(5)
+		header.i32(1, int32(rows))
+		header.i32(2, parquetPlain)
+		header.i32(3, parquetRLE)
+		header.i32(4, parquetRLE)
+		header.endStruct()
+		header_bytes := header.finish()
+
+		chunk := parquetChunk{
+			column:            column,
+			offset:            int64(file.Len()),
+			uncompressed_size: int64(len(header_bytes) + len(page)),
+			compressed_size:   int64(len(header_bytes) + len(compressed)),
+		}
+		chunks = append(chunks, chunk)
+		total_size += chunk.uncompressed_size
+		file.Write(header_bytes)
+		file.Write(compressed)
+	}
+
+	metadata := encodeParquetMetadata(chunks, int64(rows), total_size)
+	file.Write(metadata)
+	binary.Write(&file, binary.LittleEndian, uint32(len(metadata)))
+	file.WriteString(parquetMagic)
+
+	_, err := w.Write(file.Bytes())
+	return err
+}
+
+// parquetChunk locates the column chunk of a column in a Parquet file.
+type parquetChunk struct {
+	column            parquetColumn
+	offset            int64
+	uncompressed_size int64
+	compressed_size   int64
+}
+
+// encodeParquetMetadata returns the FileMetaData of a Parquet file holding a single row group made
+// of chunks.
+func encodeParquetMetadata(chunks []parquetChunk, rows int64, total_size int64) []byte {
+	metadata := newThriftWriter()
+	metadata.i32(1, parquetFileVersion)
+
+	// the schema is a flat root element followed by the columns
+	metadata.beginList(2, thriftStruct, len(chunks)+1)
+	metadata.beginElement()
+	metadata.binary(4, "schema")
+	metadata.i32(5, int32(len(chunks)))
+	metadata.endStruct()
+	for _, chunk := range chunks {
+		metadata.beginElement()
+		metadata.i32(1, chunk.column.kind)
+		if chunk.column.optional {
+			metadata.i32(3, parquetOptional)
+		} else {
+			metadata.i32(3, parquetRequired)
+		}
+		metadata.binary(4, chunk.column.name)
+		if chunk.column.converted != parquetNoConversion {
+			metadata.i32(6, chunk.column.converted)
+		}
+		metadata.endStruct()
+	}
+
+	metadata.i64(3, rows)
+
+	metadata.beginList(4, thriftStruct, 1)
+	metadata.beginElement()
+	metadata.beginList(1, thriftStruct, len(chunks))
+	for _, chunk := range chunks {
+		metadata.beginElement()
+		metadata.i64(2, chunk.offset)
+		metadata.beginStruct(3)
+		metadata.i32(1, chunk.column.kind)
+		metadata.beginList(2, thriftI32, 2)
+		metadata.listI32(parquetPlain)
+		metadata.listI32(parquetRLE)
+		metadata.beginList(3, thriftBinary, 1)
+		metadata.listBinary(chunk.column.name)
+		metadata.i32(4, parquetGzip)
+		metadata.i64(5, rows)
+		metadata.i64(6, chunk.uncompressed_size)
+		metadata.i64(7, chunk.compressed_size)
+		metadata.i64(9, chunk.offset)
+		metadata.endStruct()
+		metadata.endStruct()
+	}
+	metadata.i64(2, total_size)
+	metadata.i64(3, rows)
+	metadata.endStruct()
+
+	metadata.binary(6, "checkhealth")
+	return metadata.finish()
+}
+
+// encodePage returns the uncompressed data page of the column: the definition levels of optional
+// columns, followed by the PLAIN encoded values that aren't null.
+func (column parquetColumn) encodePage() ([]byte, error) {
+	var page bytes.Buffer
+	if column.optional {
+		levels := encodeDefinitionLevels(column.values)
+		binary.Write(&page, binary.LittleEndian, uint32(len(levels)))
+		page.Write(levels)
+	}
+
+	for _, value := range column.values {
+		if value == nil {
+			continue
+		}
+		switch column.kind {
+		case parquetInt32:
+			number, ok := value.(int32)
+			if !ok {
+				return nil, fmt.Errorf("expected int32, got %T", value)
+			}
+			binary.Write(&page, binary.LittleEndian, number)
+		case parquetInt64:
+			number, ok := value.(int64)
+			if !ok {
+				return nil, fmt.Errorf("expected int64, got %T", value)
+			}
+			binary.Write(&page, binary.LittleEndian, number)
+		case parquetDouble:
+			number, ok := value.(float64)
+			if !ok {
+				return nil, fmt.Errorf("expected float64, got %T", value)
+			}
+			binary.Write(&page, binary.LittleEndian, math.Float64bits(number))
+		case parquetByteArray:
+			text, ok := value.(string)
+			if !ok {
+				return nil, fmt.Errorf("expected string, got %T", value)
+			}
+			binary.Write(&page, binary.LittleEndian, uint32(len(text)))
+			page.WriteString(text)
+		default:
+			return nil, fmt.Errorf("unsupported physical type %d", column.kind)
+		}
+	}
+	return page.Bytes(), nil
+}
+
+// encodeDefinitionLevels encodes whether each value is defined, with the RLE runs of the RLE and
+// bit-packing hybrid encoding at a bit width of 1.
+func encodeDefinitionLevels(values []interface{}) []byte {
+	var levels bytes.Buffer
+	for start := 0; start < len(values); {
+		defined := values[start] != nil
+		end := start + 1
+		for end < len(values) && (values[end] != nil) == defined {
+			end++
+		}
+		writeUvarint(&levels, uint64(end-start)<<1)
+		if defined {
+			levels.WriteByte(1)
+		} else {
+			levels.WriteByte(0)
+		}
+		start = end
+	}
+	return levels.Bytes()
+}
+
+// gzipBytes compresses data with gzip.
+func gzipBytes(data []byte) ([]byte, error) {
+	var compressed bytes.Buffer
+	writer := gzip.NewWriter(&compressed)
+	if _, err := writer.Write(data); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return compressed.Bytes(), nil
+}
+
+// writeUvarint writes an unsigned LEB128 varint.
+func writeUvarint(buffer *bytes.Buffer, value uint64) {
+	var encoded [binary.MaxVarintLen64]byte
+	buffer.Write(encoded[:binary.PutUvarint(encoded[:], value)])
+}
+
+// Types of the Thrift compact protocol.
+const (
+	thriftI32    byte = 5
+	thriftI64    byte = 6
+	thriftBinary byte = 8
+	thriftList   byte = 9
+	thriftStruct byte = 12
+)
+
+// thriftWriter serializes structs with the Thrift compact protocol. Fields must be written in
+// increasing order of their ids within each struct.
+type thriftWriter struct {
+	buffer bytes.Buffer
+
+	// last_ids holds the id of the last field written in each of the nested structs.
+	last_ids []int16
+}
+
+// newThriftWriter returns a thriftWriter for a top-level struct.
+func newThriftWriter() *thriftWriter {
+	return &thriftWriter{last_ids: []int16{0}}
+}
+
+// field writes the header of a field, with its id as a delta from the previous field's when
+// possible.
+func (writer *thriftWriter) field(id int16, kind byte) {
+	last := &writer.last_ids[len(writer.last_ids)-1]
+	if delta := id - *last; delta > 0 && delta <= 15 {
+		writer.buffer.WriteByte(byte(delta)<<4 | kind)
+	} else {
+		writer.buffer.WriteByte(kind)
+		writeUvarint(&writer.buffer, uint64(uint16((id<<1)^(id>>15))))
+	}
+	*last = id
+}
+
+// i32 writes an i32 field, also used for enums.
+func (writer *thriftWriter) i32(id int16, value int32) {
+	writer.field(id, thriftI32)
+	writer.listI32(value)
+}
+
+// i64 writes an i64 field.
+func (writer *thriftWriter) i64(id int16, value int64) {
+	writer.field(id, thriftI64)
+	writeUvarint(&writer.buffer, uint64((value<<1)^(value>>63)))
+}
+
+// binary writes a binary or string field.
+func (writer *thriftWriter) binary(id int16, value string) {
+	writer.field(id, thriftBinary)
+	writer.listBinary(value)
+}
+
+// beginStruct starts a struct field, ended by endStruct.
+func (writer *thriftWriter) beginStruct(id int16) {
+	writer.field(id, thriftStruct)
+	writer.last_ids = append(writer.last_ids, 0)
+}
+
+// endStruct ends the current struct or struct list element.
+func (writer *thriftWriter) endStruct() {
+	writer.buffer.WriteByte(0)
+	writer.last_ids = writer.last_ids[:len(writer.last_ids)-1]
+}
+
+// beginList starts a list field of size elements of the provided type, each written with
+// listI32, listBinary, or beginElement and endStruct.
+func (writer *thriftWriter) beginList(id int16, kind byte, size int) {
+	writer.field(id, thriftList)
+	if size < 15 {
+		writer.buffer.WriteByte(byte(size)<<4 | kind)
+		return
+	}
+	writer.buffer.WriteByte(0xf0 | kind)
+	writeUvarint(&writer.buffer, uint64(size))
+}
+
+// beginElement starts a struct element of a list.
+func (writer *thriftWriter) beginElement() {
+	writer.last_ids = append(writer.last_ids, 0)
+}
+
+// listI32 writes an i32 list element.
+func (writer *thriftWriter) listI32(value int32) {
+	writeUvarint(&writer.buffer, uint64(uint32((value<<1)^(value>>31))))
+}
+
+// listBinary writes a binary or string list element.
+func (writer *thriftWriter) listBinary(value string) {
+	writeUvarint(&writer.buffer, uint64(len(value)))
+	writer.buffer.WriteString(value)
+}
+
+// finish ends the top-level struct and returns its serialization.
+func (writer *thriftWriter) finish() []byte {
+	writer.buffer.WriteByte(0)
+	return writer.buffer.Bytes()
+}
@@ -0,0 +1,37 @@
+//go:build noparquet
+// +build noparquet
+
+package main
+
+import (
+	"errors"
+	"io"
+	"time"
+)
+
+// Binaries built with the noparquet tag don't write Parquet files: the parquet_dir setting and the
+// parquet format of the bucket sinks are refused, see ApplySettings and NewBucketSink.
+
+// errParquetDisabled is returned when a Parquet file would be written.
+var errParquetDisabled = errors.New("parquet isn't compiled into the binary, which was built with the noparquet tag")
+
+// ParquetExporter exports nothing, as NewParquetExporter always fails.
+type ParquetExporter struct {
+	dir string
+}
+
+// NewParquetExporter fails, as Parquet isn't compiled into the binary.
+func NewParquetExporter(dir string) (*ParquetExporter, error) {
+	return nil, errParquetDisabled
+}
+
+// Observe is a method for ParquetExporter that does nothing.
+func (exporter *ParquetExporter) Observe(results []CheckResult, endpoints *Endpoints) {}
+
+// Close is a method for ParquetExporter that does nothing.
+func (exporter *ParquetExporter) Close() {}
+
+// writeSnapshotParquet fails, as Parquet isn't compiled into the binary.
+func writeSnapshotParquet(w io.Writer, domains []*DomainEvent, at time.Time) error {
+	return errParquetDisabled
+}
@@ -0,0 +1,194 @@
+//go:build !noparquet
+// +build !noparquet
+
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"io"
+	"math"
+	"testing"
+
+	"github.com/go-playground/assert/v2"
+)
+
+// thriftReader decodes the Thrift compact protocol into maps of field ids to int64, string,
+// []interface{} and nested map values, to check the metadata written by thriftWriter.
+type thriftReader struct {
+	data []byte
+	pos  int
+}
+
+func (reader *thriftReader) uvarint() uint64 {
+	value, read := binary.Uvarint(reader.data[reader.pos:])
+	reader.pos += read
+	return value
+}
+
+func (reader *thriftReader) value(kind byte) interface{} {
+	switch kind {
+	case thriftI32, thriftI64, 4:
+		value := reader.uvarint()
+		return int64(value>>1) ^ -int64(value&1)
+	case thriftBinary:
+		length := int(reader.uvarint())
+		value := string(reader.data[reader.pos : reader.pos+length])
+		reader.pos += length
+		return value
+	case thriftList:
+		header := reader.data[reader.pos]
+		reader.pos++
+		size := int(header >> 4)
+		if size == 15 {
+			size = int(reader.uvarint())
+		}
+		elements := make([]interface{}, size)
+		for i := range elements {
+			elements[i] = reader.value(header & 0x0f)
+		}
+		return elements
+	case thriftStruct:
+		return reader.structure()
+	}
+	panic("unsupported thrift type")
+}
+
+func (reader *thriftReader) structure() map[int16]interface{} {
+	fields := map[int16]interface{}{}
+	var last int16
+	for {
+		header := reader.data[reader.pos]
+		reader.pos++
+		if header == 0 {
+			return fields
+		}
+		id := last + int16(header>>4)
+		if header>>4 == 0 {
+			value := reader.uvarint()
+			id = int16(int64(value>>1) ^ -int64(value&1))
+		}
+		fields[id] = reader.value(header & 0x0f)
+		last = id
+	}
+}
+
+// readParquetColumn decodes the values of the column chunk of a Parquet file, nil for nulls.
+func readParquetColumn(t *testing.T, file []byte, chunk map[int16]interface{}, optional bool, rows int) []interface{} {
+	t.Helper()
+	metadata := chunk[3].(map[int16]interface{})
+	reader := &thriftReader{data: file, pos: int(metadata[9].(int64))}
+	header := reader.structure()
+	assert.Equal(t, header[1], int64(parquetDataPage))
+
+	compressed := file[reader.pos : reader.pos+int(header[3].(int64))]
+	decompressor, err := gzip.NewReader(bytes.NewReader(compressed))
+	assert.Equal(t, err, nil)
+	page, err := io.ReadAll(decompressor)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, int64(len(page)), header[2].(int64))
+
+	// definition levels, made of RLE runs
+	defined := make([]bool, rows)
+	for i := range defined {
+		defined[i] = true
+	}
+	if optional {
+		length := int(binary.LittleEndian.Uint32(page))
+		levels := &thriftReader{data: page[4 : 4+length]}
+		for row := 0; levels.pos < len(levels.data); {
+			run := int(levels.uvarint() >> 1)
+			level := levels.data[levels.pos]
+			levels.pos++
+			for i := 0; i < run; i++ {
+				defined[row] = level == 1
+				row++
+			}
+		}
+		page = page[4+length:]
+	}
+
+	values := make([]interface{}, rows)
+	for i := range values {
+		if !defined[i] {
+			continue
+		}
+		switch metadata[1].(int64) {
+		case int64(parquetInt32):
+			values[i] = int32(binary.LittleEndian.Uint32(page))
+			page = page[4:]
+		case int64(parquetInt64):
+			values[i] = int64(binary.LittleEndian.Uint64(page))
+			page = page[8:]
+		case int64(parquetDouble):
+			values[i] = math.Float64frombits(binary.LittleEndian.Uint64(page))
+			page = page[8:]
+		case int64(parquetByteArray):
+			length := int(binary.LittleEndian.Uint32(page))
+			values[i] = string(page[4 : 4+length])
+			page = page[4+length:]
+		}
+	}
+	assert.Equal(t, len(page), 0)
+	return values
+}
+
+func TestWriteParquet(t *testing.T) {
+	columns := []parquetColumn{
+		{name: "at", kind: parquetInt64, converted: parquetTimestampMillis, values: []interface{}{int64(1685620800000), int64(1685620815000), int64(1685620830000)}},
+		{name: "name", kind: parquetByteArray, converted: parquetUTF8, values: []interface{}{"index", "careers", "index"}},
+		{name: "code", kind: parquetInt32, converted: parquetNoConversion, optional: true, values: []interface{}{int32(200), nil, nil}},
+		{name: "latency", kind: parquetDouble, converted: parquetNoConversion, values: []interface{}{12.5, 0.0, 3.25}},
+	}
+	var file bytes.Buffer
+	err := writeParquet(&file, columns)
+	assert.Equal(t, err, nil)
+
+	// the file starts and ends with the magic number, after the length of its metadata
+	data := file.Bytes()
+	assert.Equal(t, string(data[:4]), parquetMagic)
+	assert.Equal(t, string(data[len(data)-4:]), parquetMagic)
+	length := int(binary.LittleEndian.Uint32(data[len(data)-8:]))
+	reader := &thriftReader{data: data[len(data)-8-length : len(data)-8]}
+	metadata := reader.structure()
+	assert.Equal(t, reader.pos, length)
+	assert.Equal(t, metadata[3], int64(3))
+
+	schema := metadata[2].([]interface{})
+	assert.Equal(t, len(schema), 5)
+	assert.Equal(t, schema[0].(map[int16]interface{})[5], int64(4))
+	assert.Equal(t, schema[1].(map[int16]interface{})[6], int64(parquetTimestampMillis))
+	assert.Equal(t, schema[3].(map[int16]interface{})[3], int64(parquetOptional))
+
+	row_group := metadata[4].([]interface{})[0].(map[int16]interface{})
+	assert.Equal(t, row_group[3], int64(3))
+	chunks := row_group[1].([]interface{})
+	for i, column := range columns {
+		chunk := chunks[i].(map[int16]interface{})
+		assert.Equal(t, chunk[3].(map[int16]interface{})[3], []interface{}{column.name})
+		assert.Equal(t, readParquetColumn(t, data, chunk, column.optional, 3), column.values)
+	}
+
+	// columns of different lengths are rejected
+	columns[1].values = columns[1].values[:2]
+	assert.NotEqual(t, writeParquet(&file, columns), nil)
+}
+
+func TestThriftWriter(t *testing.T) {
+	writer := newThriftWriter()
+	writer.i32(1, -3)
+	writer.beginList(2, thriftBinary, 20)
+	for i := 0; i < 20; i++ {
+		writer.listBinary("x")
+	}
+	writer.beginStruct(40)
+	writer.i64(1, 1<<40)
+	writer.endStruct()
+
+	reader := &thriftReader{data: writer.finish()}
+	fields := reader.structure()
+	assert.Equal(t, fields[1], int64(-3))
+	assert.Equal(t, len(fields[2].([]interface{})), 20)
+	assert.Equal(t, fields[40], map[int16]interface{}{1: int64(1 << 40)})
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// AvailabilityPeriodDay, AvailabilityPeriodWeek and AvailabilityPeriodMonth are the calendar
+// periods the availability of every domain can be reported over, in addition to the lifetime of
+// the process, see availability_periods. Weeks start on Monday, following ISO 8601.
+const (
+	AvailabilityPeriodDay   string = "day"
+	AvailabilityPeriodWeek  string = "week"
+	AvailabilityPeriodMonth string = "month"
+)
+
+// PeriodStats keeps the availability statistics of the checks of a domain's endpoints within the
+// calendar period starting at Start. Previous is the final statistics of the period right before,
+// once it ended while the domain was checked.
+type PeriodStats struct {
+	Start         time.Time
+	UpCount       int
+	TotalRequests int
+	Previous      *PeriodStats
+}
+
+// Availability computes the availability of the checks within the period as a percentage, the
+// same way as Domain.Availability.
+func (stats *PeriodStats) Availability() int {
+	domain := Domain{UpCount: stats.UpCount, TotalRequests: stats.TotalRequests}
+	return domain.Availability()
+}
+
+// ValidateAvailabilityPeriods returns an error when a period isn't a supported calendar period or
+// is listed twice, or when the timezone isn't a known IANA time zone name.
+func ValidateAvailabilityPeriods(periods []string, timezone string) error {
+	seen := map[string]bool{}
+	for _, period := range periods {
+		switch period {
+		case AvailabilityPeriodDay, AvailabilityPeriodWeek, AvailabilityPeriodMonth:
+		default:
+			return fmt.Errorf("unsupported availability_periods %q, expected %q, %q or %q", period, AvailabilityPeriodDay, AvailabilityPeriodWeek, AvailabilityPeriodMonth)
+		}
+		if seen[period] {
+			return fmt.Errorf("availability_periods lists %q twice", period)
+		}
+		seen[period] = true
+	}
+
+	if _, err := time.LoadLocation(timezone); err != nil {
+		return fmt.Errorf("invalid availability_timezone %q: %v", timezone, err)
+	}
+	return nil
+}
+
+// AvailabilityLocation is a method for Settings that returns the time zone of the
+// availability_timezone setting the calendar periods are delimited in, or UTC when it isn't set or
+// invalid.
+func (settings Settings) AvailabilityLocation() *time.Location {
+	location, err := time.LoadLocation(settings.AvailabilityTimezone)
+	if err != nil {
+		return time.UTC
+	}
+	return location
+}
+
+// PeriodStart returns the start of the calendar period containing at, midnight of its first day in
+// location.
+func PeriodStart(period string, at time.Time, location *time.Location) time.Time {
+	local := at.In(location)
+	year, month, day := local.Date()
+
+	switch period {
+	case AvailabilityPeriodWeek:
+		// days since Monday
+		day -= (int(local.Weekday()) + 6) % 7
+	case AvailabilityPeriodMonth:
+		day = 1
+	}
+	return time.Date(year, month, day, 0, 0, 0, 0, location)
+}
+
+// nextPeriodStart returns the start of the calendar period following the one starting at start.
+func nextPeriodStart(period string, start time.Time) time.Time {
+	switch period {
+	case AvailabilityPeriodWeek:
+		return start.AddDate(0, 0, 7)
+	case AvailabilityPeriodMonth:
+		return start.AddDate(0, 1, 0)
+	default:
+		return start.AddDate(0, 0, 1)
+	}
+}
+
+// UpdatePeriodStats is a method for a domain to update the availability statistics of the
+// calendar periods containing at, following UpdateDomainStats. When a period has ended, its final
+// statistics are kept as the Previous of the new one, unless periods without any check passed in
+// between.
+//
+// Returns immediately if the domain pointer passed is nil or no period is provided.
+func (domain *Domain) UpdatePeriodStats(at time.Time, is_up bool, periods []string, location *time.Location) {
+	if domain == nil || len(periods) == 0 {
+		return
+	}
+
+	domain_stats.Lock()
+	defer domain_stats.Unlock()
+
+	if domain.Periods == nil {
+		domain.Periods = map[string]*PeriodStats{}
+	}
+	for _, period := range periods {
+		start := PeriodStart(period, at, location)
+		stats := domain.Periods[period]
+		if stats == nil || start.After(stats.Start) {
+			next := &PeriodStats{Start: start}
+			if stats != nil && nextPeriodStart(period, stats.Start).Equal(start) {
+				next.Previous = &PeriodStats{Start: stats.Start, UpCount: stats.UpCount, TotalRequests: stats.TotalRequests}
+			}
+			stats = next
+			domain.Periods[period] = stats
+		}
+
+		if is_up {
+			stats.UpCount += 1
+		}
+		stats.TotalRequests += 1
+	}
+}
+
+// PeriodSummary is the availability of a domain within the current calendar period, and within the
+// previous one when it is known.
+type PeriodSummary struct {
+	Period string
+	PeriodStats
+}
+
+// PeriodSummaries is a method for a domain that returns its statistics for each of the periods, in
+// order, as of now, see summarizePeriods.
+func (domain *Domain) PeriodSummaries(now time.Time, periods []string, location *time.Location) []PeriodSummary {
+	domain_stats.Lock()
+	defer domain_stats.Unlock()
+
+	return summarizePeriods(domain.Periods, now, periods, location)
+}
+
+// summarizePeriods returns the statistics of each of the periods, in order, as of now. A period
+// that ended since the last check is reported as the previous period of an empty one. Periods
+// without any check are skipped. The statistics must be guarded by domain_stats.
+func summarizePeriods(period_stats map[string]*PeriodStats, now time.Time, periods []string, location *time.Location) []PeriodSummary {
+	var summaries []PeriodSummary
+	for _, period := range periods {
+		stats := period_stats[period]
+		if stats == nil {
+			continue
+		}
+
+		summary := PeriodSummary{Period: period, PeriodStats: *stats}
+		if start := PeriodStart(period, now, location); start.After(stats.Start) {
+			summary.PeriodStats = PeriodStats{Start: start}
+			if nextPeriodStart(period, stats.Start).Equal(start) {
+				summary.Previous = &PeriodStats{Start: stats.Start, UpCount: stats.UpCount, TotalRequests: stats.TotalRequests}
+			}
+		}
+		if summary.TotalRequests == 0 && summary.Previous == nil {
+			continue
+		}
+		summaries = append(summaries, summary)
+	}
+	return summaries
+}
+
+// CurrentLabel names the current calendar period of a summary in the console output, e.g. "today"
+// or "this month".
+func (summary PeriodSummary) CurrentLabel() string {
+	if summary.Period == AvailabilityPeriodDay {
+		return "today"
+	}
+	return "this " + summary.Period
+}
+
+// PreviousLabel names the previous calendar period of a summary in the console output, e.g.
+// "yesterday" or "last month".
+func (summary PeriodSummary) PreviousLabel() string {
+	if summary.Period == AvailabilityPeriodDay {
+		return "yesterday"
+	}
+	return "last " + summary.Period
+}
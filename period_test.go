@@ -0,0 +1,108 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-playground/assert/v2"
+)
+
+func TestPeriodStart(t *testing.T) {
+	new_york, err := time.LoadLocation("America/New_York")
+	assert.Equal(t, err, nil)
+
+	// Thursday, June 1st 2023, 02:30 UTC is still May 31st in New York
+	at := time.Date(2023, 6, 1, 2, 30, 0, 0, time.UTC)
+
+	cases := []struct {
+		name     string
+		period   string
+		location *time.Location
+		expected time.Time
+	}{
+		{name: "Day", period: AvailabilityPeriodDay, location: time.UTC, expected: time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC)},
+		{name: "Week Starts On Monday", period: AvailabilityPeriodWeek, location: time.UTC, expected: time.Date(2023, 5, 29, 0, 0, 0, 0, time.UTC)},
+		{name: "Month", period: AvailabilityPeriodMonth, location: time.UTC, expected: time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC)},
+		{name: "Day In Timezone", period: AvailabilityPeriodDay, location: new_york, expected: time.Date(2023, 5, 31, 0, 0, 0, 0, new_york)},
+		{name: "Month In Timezone", period: AvailabilityPeriodMonth, location: new_york, expected: time.Date(2023, 5, 1, 0, 0, 0, 0, new_york)},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, PeriodStart(tc.period, at, tc.location).Equal(tc.expected), true)
+		})
+	}
+
+	// a Sunday belongs to the week started the Monday before
+	sunday := time.Date(2023, 6, 4, 23, 0, 0, 0, time.UTC)
+	assert.Equal(t, PeriodStart(AvailabilityPeriodWeek, sunday, time.UTC), time.Date(2023, 5, 29, 0, 0, 0, 0, time.UTC))
+}
+
+func TestDomainUpdatePeriodStats(t *testing.T) {
+	domain := &Domain{Name: "example.com"}
+	periods := []string{AvailabilityPeriodDay, AvailabilityPeriodMonth}
+	day := time.Date(2023, 5, 31, 12, 0, 0, 0, time.UTC)
+
+	domain.UpdatePeriodStats(day, true, periods, time.UTC)
+	domain.UpdatePeriodStats(day, false, periods, time.UTC)
+	summaries := domain.PeriodSummaries(day, periods, time.UTC)
+	assert.Equal(t, len(summaries), 2)
+	assert.Equal(t, summaries[0].Period, AvailabilityPeriodDay)
+	assert.Equal(t, summaries[0].Availability(), 50)
+	assert.Equal(t, summaries[0].Previous == nil, true)
+
+	// the next day starts a new day and month, keeping the previous ones
+	next_day := day.Add(24 * time.Hour)
+	domain.UpdatePeriodStats(next_day, true, periods, time.UTC)
+	summaries = domain.PeriodSummaries(next_day, periods, time.UTC)
+	assert.Equal(t, summaries[0].Start, time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC))
+	assert.Equal(t, summaries[0].Availability(), 100)
+	assert.Equal(t, *summaries[0].Previous, PeriodStats{Start: time.Date(2023, 5, 31, 0, 0, 0, 0, time.UTC), UpCount: 1, TotalRequests: 2})
+	assert.Equal(t, summaries[1].TotalRequests, 1)
+	assert.Equal(t, summaries[1].Previous.TotalRequests, 2)
+
+	// a day that ended since the last check is reported as the previous one
+	summaries = domain.PeriodSummaries(next_day.Add(24*time.Hour), periods, time.UTC)
+	assert.Equal(t, summaries[0].TotalRequests, 0)
+	assert.Equal(t, summaries[0].Previous.TotalRequests, 1)
+
+	// a day without any check isn't the previous one
+	domain.UpdatePeriodStats(next_day.Add(48*time.Hour), false, periods, time.UTC)
+	summaries = domain.PeriodSummaries(next_day.Add(48*time.Hour), periods, time.UTC)
+	assert.Equal(t, summaries[0].Availability(), 0)
+	assert.Equal(t, summaries[0].Previous == nil, true)
+	assert.Equal(t, summaries[1].TotalRequests, 2)
+
+	// without periods, nothing is kept
+	other := &Domain{Name: "fetch.com"}
+	other.UpdatePeriodStats(day, true, nil, time.UTC)
+	assert.Equal(t, other.Periods == nil, true)
+}
+
+func TestValidateAvailabilityPeriods(t *testing.T) {
+	cases := []struct {
+		name     string
+		periods  []string
+		timezone string
+		expected string
+	}{
+		{name: "Valid", periods: []string{"day", "week", "month"}, timezone: "Europe/Paris"},
+		{name: "Default Timezone", periods: []string{"month"}},
+		{name: "Unknown Period", periods: []string{"year"}, expected: `unsupported availability_periods "year"`},
+		{name: "Duplicate Period", periods: []string{"day", "day"}, expected: `lists "day" twice`},
+		{name: "Unknown Timezone", periods: []string{"day"}, timezone: "Mars/Olympus", expected: `invalid availability_timezone "Mars/Olympus"`},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ValidateAvailabilityPeriods(tc.periods, tc.timezone)
+			if tc.expected == "" {
+				assert.Equal(t, err, nil)
+				return
+			}
+			assert.NotEqual(t, err, nil)
+			assert.Equal(t, strings.Contains(err.Error(), tc.expected), true)
+		})
+	}
+}
@@ -0,0 +1,409 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Predicate is a compiled success_when expression deciding whether a check succeeded from the
+// signals of its response. Expressions combine comparisons with and, or and not (or &&, || and !)
+// and parentheses:
+//
+//	status >= 200 and status < 300 and latency < 300ms
+//	header["Content-Type"] contains "json" and not (body matches "\"status\": *\"fail")
+//
+// The signals that can be compared are:
+//
+//	status          the response status code, compared with ==, !=, <, <=, > or >= to a number
+//	latency         the time to receive the full response, compared to a duration such as 250ms
+//	header["Name"]  a response header, compared with ==, !=, contains or matches to a string
+//	body            the response body, compared with ==, !=, contains or matches to a string
+//
+// Strings are double quoted, and matches takes a regular expression.
+type Predicate struct {
+	expression string
+	root       predicateNode
+	needs_body bool
+}
+
+// PredicateSignals are the signals of a response that a Predicate is evaluated against.
+type PredicateSignals struct {
+	Status  int
+	Latency time.Duration
+	Header  http.Header
+	Body    []byte
+}
+
+// CompilePredicate parses a success_when expression into a Predicate. An error describing the
+// position of the problem is returned if the expression is invalid.
+func CompilePredicate(expression string) (*Predicate, error) {
+	tokens, err := tokenizePredicate(expression)
+	if err != nil {
+		return nil, err
+	}
+
+	parser := &predicateParser{tokens: tokens}
+	root, err := parser.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if token := parser.peek(); token.kind != tokenEnd {
+		return nil, fmt.Errorf("unexpected %q at position %d", token.text, token.position)
+	}
+
+	return &Predicate{
+		expression: expression,
+		root:       root,
+		needs_body: parser.needs_body,
+	}, nil
+}
+
+// String returns the source expression of the predicate.
+func (predicate *Predicate) String() string {
+	return predicate.expression
+}
+
+// NeedsBody reports whether the predicate compares the response body, which must then be kept when
+// reading the response.
+func (predicate *Predicate) NeedsBody() bool {
+	return predicate.needs_body
+}
+
+// Evaluate reports whether signals satisfy the predicate.
+func (predicate *Predicate) Evaluate(signals PredicateSignals) bool {
+	return predicate.root.evaluate(&signals)
+}
+
+// predicateNode is a node of a compiled predicate expression.
+type predicateNode interface {
+	evaluate(signals *PredicateSignals) bool
+}
+
+type andNode struct {
+	left, right predicateNode
+}
+
+func (node andNode) evaluate(signals *PredicateSignals) bool {
+	return node.left.evaluate(signals) && node.right.evaluate(signals)
+}
+
+type orNode struct {
+	left, right predicateNode
+}
+
+func (node orNode) evaluate(signals *PredicateSignals) bool {
+	return node.left.evaluate(signals) || node.right.evaluate(signals)
+}
+
+type notNode struct {
+	operand predicateNode
+}
+
+func (node notNode) evaluate(signals *PredicateSignals) bool {
+	return !node.operand.evaluate(signals)
+}
+
+// comparisonNode compares a signal to a value. Numbers and durations are stored in number, as
+// durations are compared in nanoseconds.
+type comparisonNode struct {
+	signal   string
+	header   string
+	operator string
+	number   int64
+	text     string
+	pattern  *regexp.Regexp
+}
+
+func (node comparisonNode) evaluate(signals *PredicateSignals) bool {
+	switch node.signal {
+	case "status":
+		return compareNumbers(int64(signals.Status), node.operator, node.number)
+	case "latency":
+		return compareNumbers(int64(signals.Latency), node.operator, node.number)
+	case "header":
+		return node.compareText(signals.Header.Get(node.header))
+	default:
+		return node.compareText(string(signals.Body))
+	}
+}
+
+// compareText applies the node's string operator to value.
+func (node comparisonNode) compareText(value string) bool {
+	switch node.operator {
+	case "==":
+		return value == node.text
+	case "!=":
+		return value != node.text
+	case "contains":
+		return strings.Contains(value, node.text)
+	default:
+		return node.pattern.MatchString(value)
+	}
+}
+
+// compareNumbers applies a numeric comparison operator.
+func compareNumbers(value int64, operator string, expected int64) bool {
+	switch operator {
+	case "==":
+		return value == expected
+	case "!=":
+		return value != expected
+	case "<":
+		return value < expected
+	case "<=":
+		return value <= expected
+	case ">":
+		return value > expected
+	default:
+		return value >= expected
+	}
+}
+
+// tokenEnd, tokenWord, tokenString and tokenSymbol are the kinds of predicate tokens.
+const (
+	tokenEnd = iota
+	tokenWord
+	tokenString
+	tokenSymbol
+)
+
+type predicateToken struct {
+	kind     int
+	text     string
+	position int
+}
+
+// tokenizePredicate splits an expression into words (identifiers, keywords, numbers and
+// durations), double quoted strings and symbols.
+func tokenizePredicate(expression string) ([]predicateToken, error) {
+	var tokens []predicateToken
+	runes := []rune(expression)
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '"':
+			end := i + 1
+			for ; end < len(runes) && runes[end] != '"'; end++ {
+				if runes[end] == '\\' {
+					end++
+				}
+			}
+			if end >= len(runes) {
+				return nil, fmt.Errorf("unterminated string at position %d", i)
+			}
+			text, err := strconv.Unquote(string(runes[i : end+1]))
+			if err != nil {
+				return nil, fmt.Errorf("invalid string at position %d: %v", i, err)
+			}
+			tokens = append(tokens, predicateToken{kind: tokenString, text: text, position: i})
+			i = end + 1
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_':
+			end := i
+			for end < len(runes) && (unicode.IsLetter(runes[end]) || unicode.IsDigit(runes[end]) || runes[end] == '_' || runes[end] == '.') {
+				end++
+			}
+			tokens = append(tokens, predicateToken{kind: tokenWord, text: string(runes[i:end]), position: i})
+			i = end
+		default:
+			symbol := string(r)
+			if i+1 < len(runes) {
+				switch two := string(runes[i : i+2]); two {
+				case "==", "!=", "<=", ">=", "&&", "||":
+					symbol = two
+				}
+			}
+			switch symbol {
+			case "(", ")", "[", "]", "!", "<", ">", "==", "!=", "<=", ">=", "&&", "||":
+			default:
+				return nil, fmt.Errorf("unexpected %q at position %d", symbol, i)
+			}
+			tokens = append(tokens, predicateToken{kind: tokenSymbol, text: symbol, position: i})
+			i += len([]rune(symbol))
+		}
+	}
+
+	return append(tokens, predicateToken{kind: tokenEnd, text: "end of expression", position: len(runes)}), nil
+}
+
+// predicateParser is a recursive descent parser over predicate tokens, where not binds tighter
+// than and, which binds tighter than or.
+type predicateParser struct {
+	tokens     []predicateToken
+	position   int
+	needs_body bool
+}
+
+func (parser *predicateParser) peek() predicateToken {
+	return parser.tokens[parser.position]
+}
+
+func (parser *predicateParser) next() predicateToken {
+	token := parser.tokens[parser.position]
+	if token.kind != tokenEnd {
+		parser.position++
+	}
+	return token
+}
+
+// accept consumes the next token if it is one of the provided words or symbols.
+func (parser *predicateParser) accept(texts ...string) bool {
+	token := parser.peek()
+	if token.kind != tokenWord && token.kind != tokenSymbol {
+		return false
+	}
+	for _, text := range texts {
+		if token.text == text {
+			parser.position++
+			return true
+		}
+	}
+	return false
+}
+
+// expect consumes the next token, returning an error if it isn't the provided symbol.
+func (parser *predicateParser) expect(symbol string) error {
+	token := parser.next()
+	if token.kind != tokenSymbol || token.text != symbol {
+		return fmt.Errorf("expected %q at position %d, found %q", symbol, token.position, token.text)
+	}
+	return nil
+}
+
+func (parser *predicateParser) parseOr() (predicateNode, error) {
+	left, err := parser.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for parser.accept("or", "||") {
+		right, err := parser.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orNode{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (parser *predicateParser) parseAnd() (predicateNode, error) {
+	left, err := parser.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for parser.accept("and", "&&") {
+		right, err := parser.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = andNode{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (parser *predicateParser) parseNot() (predicateNode, error) {
+	if parser.accept("not", "!") {
+		operand, err := parser.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{operand: operand}, nil
+	}
+
+	if parser.accept("(") {
+		node, err := parser.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if err := parser.expect(")"); err != nil {
+			return nil, err
+		}
+		return node, nil
+	}
+
+	return parser.parseComparison()
+}
+
+// parseComparison parses a single signal comparison, validating that the operator and value suit
+// the signal.
+func (parser *predicateParser) parseComparison() (predicateNode, error) {
+	token := parser.next()
+	if token.kind != tokenWord {
+		return nil, fmt.Errorf("expected a signal at position %d, found %q", token.position, token.text)
+	}
+
+	node := comparisonNode{signal: token.text}
+	switch node.signal {
+	case "status", "latency":
+	case "body":
+		parser.needs_body = true
+	case "header":
+		if err := parser.expect("["); err != nil {
+			return nil, err
+		}
+		name := parser.next()
+		if name.kind != tokenString {
+			return nil, fmt.Errorf("expected a quoted header name at position %d, found %q", name.position, name.text)
+		}
+		if err := parser.expect("]"); err != nil {
+			return nil, err
+		}
+		node.header = name.text
+	default:
+		return nil, fmt.Errorf("unknown signal %q at position %d, expected status, latency, header or body", token.text, token.position)
+	}
+
+	operator := parser.next()
+	node.operator = operator.text
+	value := parser.next()
+
+	numeric := node.signal == "status" || node.signal == "latency"
+	switch operator.text {
+	case "==", "!=":
+	case "<", "<=", ">", ">=":
+		if !numeric {
+			return nil, fmt.Errorf("operator %q at position %d can't be applied to %s", operator.text, operator.position, node.signal)
+		}
+	case "contains", "matches":
+		if numeric {
+			return nil, fmt.Errorf("operator %q at position %d can't be applied to %s", operator.text, operator.position, node.signal)
+		}
+	default:
+		return nil, fmt.Errorf("expected an operator at position %d, found %q", operator.position, operator.text)
+	}
+
+	switch node.signal {
+	case "status":
+		number, err := strconv.ParseInt(value.text, 10, 64)
+		if value.kind != tokenWord || err != nil {
+			return nil, fmt.Errorf("expected a status code at position %d, found %q", value.position, value.text)
+		}
+		node.number = number
+	case "latency":
+		duration, err := time.ParseDuration(value.text)
+		if value.kind != tokenWord || err != nil {
+			return nil, fmt.Errorf("expected a duration such as 300ms at position %d, found %q", value.position, value.text)
+		}
+		node.number = int64(duration)
+	default:
+		if value.kind != tokenString {
+			return nil, fmt.Errorf("expected a quoted string at position %d, found %q", value.position, value.text)
+		}
+		node.text = value.text
+		if node.operator == "matches" {
+			pattern, err := regexp.Compile(value.text)
+			if err != nil {
+				return nil, fmt.Errorf("invalid regular expression at position %d: %v", value.position, err)
+			}
+			node.pattern = pattern
+		}
+	}
+
+	return node, nil
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-playground/assert/v2"
+)
+
+func TestPredicateEvaluate(t *testing.T) {
+	signals := PredicateSignals{
+		Status:  200,
+		Latency: 120 * time.Millisecond,
+		Header:  http.Header{"Content-Type": {"application/json"}},
+		Body:    []byte(`{"status": "ok"}`),
+	}
+
+	cases := []struct {
+		name       string
+		expression string
+		expected   bool
+	}{
+		{name: "Status Equal", expression: "status == 200", expected: true},
+		{name: "Status Range", expression: "status >= 200 and status < 300", expected: true},
+		{name: "Status Mismatch", expression: "status != 200", expected: false},
+		{name: "Latency Within", expression: "latency < 300ms", expected: true},
+		{name: "Latency Over", expression: "latency <= 100ms", expected: false},
+		{name: "Header Contains", expression: `header["content-type"] contains "json"`, expected: true},
+		{name: "Missing Header", expression: `header["X-Missing"] == ""`, expected: true},
+		{name: "Body Matches", expression: `body matches "\"status\": *\"ok\""`, expected: true},
+		{name: "Body Equal", expression: `body == "ok"`, expected: false},
+		{name: "Not", expression: `not body contains "error"`, expected: true},
+		{name: "Symbols", expression: `!(status == 500) && (latency > 1s || status == 200)`, expected: true},
+		{name: "And Binds Tighter Than Or", expression: "status == 500 and latency > 1s or status == 200", expected: true},
+		{name: "Parentheses", expression: "status == 500 and (latency > 1s or status == 200)", expected: false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			predicate, err := CompilePredicate(tc.expression)
+			assert.Equal(t, err, nil)
+			assert.Equal(t, predicate.Evaluate(signals), tc.expected)
+		})
+	}
+}
+
+func TestCompilePredicateErrors(t *testing.T) {
+	cases := []struct {
+		name       string
+		expression string
+	}{
+		{name: "Empty", expression: ""},
+		{name: "Unknown Signal", expression: "code == 200"},
+		{name: "Missing Value", expression: "status =="},
+		{name: "String Status", expression: `status == "200"`},
+		{name: "Invalid Duration", expression: "latency < 300"},
+		{name: "Ordering Body", expression: `body < "a"`},
+		{name: "Contains Status", expression: "status contains 2"},
+		{name: "Unquoted Header Name", expression: "header[Content-Type] == \"json\""},
+		{name: "Invalid Regular Expression", expression: `body matches "("`},
+		{name: "Unbalanced Parentheses", expression: "(status == 200"},
+		{name: "Trailing Tokens", expression: "status == 200 200"},
+		{name: "Unterminated String", expression: `body contains "ok`},
+		{name: "Unexpected Symbol", expression: "status = 200"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := CompilePredicate(tc.expression)
+			assert.NotEqual(t, err, nil)
+		})
+	}
+}
+
+func TestPredicateNeedsBody(t *testing.T) {
+	predicate, err := CompilePredicate("status == 200")
+	assert.Equal(t, err, nil)
+	assert.Equal(t, predicate.NeedsBody(), false)
+
+	predicate, err = CompilePredicate(`status == 200 or body contains "ok"`)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, predicate.NeedsBody(), true)
+}
+
+func TestGetEndpointHealthSuccessWhen(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte(`{"status": "maintenance"}`))
+	}))
+	defer server.Close()
+
+	cases := []struct {
+		name            string
+		successWhen     string
+		expectedUpCount int
+	}{
+		{
+			name:            "Default Status Check",
+			expectedUpCount: 0,
+		},
+		{
+			name:            "Maintenance Is Up",
+			successWhen:     `status == 503 and body contains "maintenance"`,
+			expectedUpCount: 1,
+		},
+		{
+			name:            "Predicate Not Met",
+			successWhen:     `status == 503 and body contains "ok"`,
+			expectedUpCount: 0,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			endpoints := Endpoints{{Name: "maintenance", Url: server.URL, SuccessWhen: tc.successWhen}}
+			targets, err := endpoints.CreateNewTargets()
+			assert.Equal(t, err, nil)
+
+			endpoints[0].Domain.RecordResult(endpoints[0].GetEndpointHealth(time.Second))
+			assert.Equal(t, targets.Domains.UpCount, tc.expectedUpCount)
+			assert.Equal(t, targets.Domains.TotalRequests, 1)
+		})
+	}
+}
+
+func TestCreateNewTargetsInvalidSuccessWhen(t *testing.T) {
+	endpoints := Endpoints{{Name: "invalid", Url: "https://example.com/", SuccessWhen: "status =="}}
+	_, err := endpoints.CreateNewTargets()
+	assert.NotEqual(t, err, nil)
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"fmt"
+)
+
+// CheckOptions are the options of a one-shot pass of CheckAll over a set of endpoints.
+type CheckOptions struct {
+	// Settings are applied to the endpoints like the settings of a configuration file, such as
+	// max_latency, check_types or the endpoint defaults. Settings only used by the scheduler, such
+	// as interval or listen, are ignored.
+	Settings Settings
+
+	// Concurrency is the number of endpoints checked concurrently. Defaults to every endpoint at
+	// once, up to DefaultConcurrencyMax.
+	Concurrency int
+}
+
+// CheckAll checks every endpoint once, concurrently, and returns their results in the order of the
+// endpoints, without the scheduler: no state is kept between two calls, and nothing is exported or
+// published. The warnings of the checks, such as an endpoint rejecting HEAD, an oversized body or
+// a certificate only valid for a name in tls_accept_names, are still logged with the log package,
+// as by the scheduler. A check never exits the program, its endpoint being down with the error
+// instead, e.g. when its CA file can't be read anymore.
+//
+// CheckHealth is a single main package, which other modules can't import: CheckAll reuses the
+// checking engine for one-shot probes within this module only, such as tests and subcommands.
+//
+// The endpoints are validated as in a configuration file first, an error being returned when any
+// of them is invalid. When ctx is done before the pass completes, the endpoints not checked yet
+// are skipped and reported as unknown, and the results are returned along with the context's
+// error.
+func CheckAll(ctx context.Context, endpoints Endpoints, options CheckOptions) ([]CheckResult, error) {
+	if options.Concurrency < 0 {
+		return nil, fmt.Errorf("concurrency must not be negative, got %d", options.Concurrency)
+	}
+
+	// the endpoints are modified by the settings, leave the caller's untouched
+	config := Config{Settings: options.Settings, Endpoints: append(Endpoints(nil), endpoints...)}
+	if err := config.ApplySettings(); err != nil {
+		return nil, err
+	}
+	targets, err := config.Endpoints.CreateNewTargets()
+	if err != nil {
+		return nil, err
+	}
+	targets.Settings = config.Settings
+
+	workers := options.Concurrency
+	if workers == 0 {
+		workers = len(config.Endpoints)
+		if workers > DefaultConcurrencyMax {
+			workers = DefaultConcurrencyMax
+		}
+	}
+
+	results := targets.checkEndpoints(ctx, workers, config.MaxCheckLatency())
+	return results, ctx.Err()
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-playground/assert/v2"
+)
+
+func TestCheckAll(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/slow":
+			time.Sleep(100 * time.Millisecond)
+		case "/error":
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	endpoints := Endpoints{
+		{Name: "index", Url: server.URL + "/"},
+		{Name: "error", Url: server.URL + "/error"},
+		{Name: "slow", Url: server.URL + "/slow"},
+	}
+
+	cases := []struct {
+		name     string
+		options  CheckOptions
+		expected []string
+	}{
+		{name: "Defaults", expected: []string{StatusUp, StatusDown, StatusUp}},
+		{name: "In Series", options: CheckOptions{Concurrency: 1}, expected: []string{StatusUp, StatusDown, StatusUp}},
+		{name: "Settings", options: CheckOptions{Settings: Settings{MaxLatency: 50 * time.Millisecond}}, expected: []string{StatusUp, StatusDown, StatusDown}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			results, err := CheckAll(context.Background(), endpoints, tc.options)
+			assert.Equal(t, err, nil)
+			assert.Equal(t, len(results), len(tc.expected))
+			for i, status := range tc.expected {
+				assert.Equal(t, results[i].Endpoint, endpoints[i].Name)
+				assert.Equal(t, results[i].Status, status)
+			}
+		})
+	}
+
+	// invalid endpoints are rejected before any check
+	_, err := CheckAll(context.Background(), Endpoints{{Name: "invalid", Url: "://"}}, CheckOptions{})
+	assert.NotEqual(t, err, nil)
+	_, err = CheckAll(context.Background(), endpoints, CheckOptions{Concurrency: -1})
+	assert.NotEqual(t, err, nil)
+
+	// endpoints not checked once the context is done are skipped
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	results, err := CheckAll(ctx, endpoints, CheckOptions{Concurrency: 1})
+	assert.Equal(t, err, context.Canceled)
+	assert.Equal(t, len(results), 3)
+	for _, result := range results {
+		assert.Equal(t, result.Status, StatusUnknown)
+	}
+}
+
+func TestRunClientCheckInvalidEndpoint(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	// endpoints checked without ApplySettings are down rather than exiting the program
+	cases := []struct {
+		name     string
+		endpoint Endpoint
+		expected string
+	}{
+		{name: "Invalid Success When", endpoint: Endpoint{Url: server.URL, SuccessWhen: "status =="}, expected: ErrorKindPredicate},
+		{name: "Invalid Body Regex", endpoint: Endpoint{Url: server.URL, ExpectBodyRegex: "("}, expected: ErrorKindBody},
+		{name: "Missing CA File", endpoint: Endpoint{Url: server.URL, TLSCAFile: "/nonexistent/ca.pem"}, expected: ErrorKindConnection},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			result := tc.endpoint.runClientCheck(context.Background())
+			assert.Equal(t, result.Status, StatusDown)
+			assert.Equal(t, result.ErrorKind, tc.expected)
+			assert.NotEqual(t, result.Error, "")
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Endpoints with proxy_protocol send a PROXY protocol header at the start of every connection, so
+// targets behind load balancers requiring the PROXY protocol can be checked directly. The header
+// announces the local and remote addresses of the connection as the client and the server.
+
+// ProxyProtocolV1 and ProxyProtocolV2 are the versions of the PROXY protocol header sent by
+// endpoints: the human-readable version 1 or the binary version 2.
+const (
+	ProxyProtocolV1 string = "v1"
+	ProxyProtocolV2 string = "v2"
+)
+
+// proxyProtocolV2Signature starts every version 2 header.
+var proxyProtocolV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// ProxyProtocolHeader returns the PROXY protocol header of the provided version for a TCP
+// connection from source to destination. Addresses that aren't TCP addresses of the same family
+// are announced as unknown, in which case the receiver uses the real addresses of the connection.
+func ProxyProtocolHeader(version string, source net.Addr, destination net.Addr) ([]byte, error) {
+	source_tcp, source_ok := source.(*net.TCPAddr)
+	destination_tcp, destination_ok := destination.(*net.TCPAddr)
+	family := ""
+	if source_ok && destination_ok {
+		switch {
+		case source_tcp.IP.To4() != nil && destination_tcp.IP.To4() != nil:
+			family = "TCP4"
+		case source_tcp.IP.To4() == nil && destination_tcp.IP.To4() == nil:
+			family = "TCP6"
+		}
+	}
+
+	switch version {
+	case ProxyProtocolV1:
+		if family == "" {
+			return []byte("PROXY UNKNOWN\r\n"), nil
+		}
+		return []byte(fmt.Sprintf("PROXY %s %s %s %d %d\r\n", family, source_tcp.IP, destination_tcp.IP, source_tcp.Port, destination_tcp.Port)), nil
+	case ProxyProtocolV2:
+		var header bytes.Buffer
+		header.Write(proxyProtocolV2Signature)
+		// version 2, PROXY command
+		header.WriteByte(0x21)
+
+		var addresses bytes.Buffer
+		switch family {
+		case "TCP4":
+			header.WriteByte(0x11)
+			addresses.Write(source_tcp.IP.To4())
+			addresses.Write(destination_tcp.IP.To4())
+		case "TCP6":
+			header.WriteByte(0x21)
+			addresses.Write(source_tcp.IP.To16())
+			addresses.Write(destination_tcp.IP.To16())
+		default:
+			header.WriteByte(0x00)
+		}
+		if family != "" {
+			binary.Write(&addresses, binary.BigEndian, uint16(source_tcp.Port))
+			binary.Write(&addresses, binary.BigEndian, uint16(destination_tcp.Port))
+		}
+		binary.Write(&header, binary.BigEndian, uint16(addresses.Len()))
+		header.Write(addresses.Bytes())
+		return header.Bytes(), nil
+	default:
+		return nil, fmt.Errorf("unsupported proxy_protocol %q, expected %q or %q", version, ProxyProtocolV1, ProxyProtocolV2)
+	}
+}
+
+// WriteProxyProtocolHeader writes the PROXY protocol header of the provided version for conn to
+// conn. It must be called before anything else is written to the connection.
+func WriteProxyProtocolHeader(conn net.Conn, version string) error {
+	header, err := ProxyProtocolHeader(version, conn.LocalAddr(), conn.RemoteAddr())
+	if err != nil {
+		return err
+	}
+	if _, err := conn.Write(header); err != nil {
+		return fmt.Errorf("failed to send the PROXY protocol header: %w", err)
+	}
+	return nil
+}
+
+// proxy_protocol_clients caches the HTTP clients sending a PROXY protocol header, by version and
+// Expect: 100-continue timeout, so connections are reused across checks.
+var proxy_protocol_clients = struct {
+	sync.Mutex
+	clients map[string]*http.Client
+}{
+	clients: map[string]*http.Client{},
+}
+
+// ProxyProtocolClient returns an HTTP client that sends a PROXY protocol header of the provided
+// version at the start of every connection, before the TLS handshake of https:// URLs.
+func ProxyProtocolClient(version string, expect_continue_timeout time.Duration) *http.Client {
+	proxy_protocol_clients.Lock()
+	defer proxy_protocol_clients.Unlock()
+
+	key := fmt.Sprintf("%s\x00%s", version, expect_continue_timeout)
+	if client, ok := proxy_protocol_clients.clients[key]; ok {
+		return client
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// the header must reach the target, not an HTTP proxy
+	transport.Proxy = nil
+	transport.DialContext = func(ctx context.Context, network string, address string) (net.Conn, error) {
+		var dialer net.Dialer
+		conn, err := dialer.DialContext(ctx, network, address)
+		if err != nil {
+			return nil, err
+		}
+		if err := WriteProxyProtocolHeader(conn, version); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return conn, nil
+	}
+	if expect_continue_timeout > 0 {
+		transport.ExpectContinueTimeout = expect_continue_timeout
+	}
+
+	client := &http.Client{Transport: transport}
+	proxy_protocol_clients.clients[key] = client
+	return client
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-playground/assert/v2"
+)
+
+func TestProxyProtocolHeader(t *testing.T) {
+	ipv4_source := &net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 51000}
+	ipv4_destination := &net.TCPAddr{IP: net.ParseIP("198.51.100.2"), Port: 443}
+	ipv6_source := &net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 51000}
+	ipv6_destination := &net.TCPAddr{IP: net.ParseIP("2001:db8::2"), Port: 80}
+
+	cases := []struct {
+		name         string
+		version      string
+		source       net.Addr
+		destination  net.Addr
+		expected     string
+		expectedFail bool
+	}{
+		{
+			name:        "Version 1 IPv4",
+			version:     ProxyProtocolV1,
+			source:      ipv4_source,
+			destination: ipv4_destination,
+			expected:    "PROXY TCP4 192.0.2.1 198.51.100.2 51000 443\r\n",
+		},
+		{
+			name:        "Version 1 IPv6",
+			version:     ProxyProtocolV1,
+			source:      ipv6_source,
+			destination: ipv6_destination,
+			expected:    "PROXY TCP6 2001:db8::1 2001:db8::2 51000 80\r\n",
+		},
+		{
+			name:        "Version 1 Mixed Families",
+			version:     ProxyProtocolV1,
+			source:      ipv4_source,
+			destination: ipv6_destination,
+			expected:    "PROXY UNKNOWN\r\n",
+		},
+		{
+			name:        "Version 2 IPv4",
+			version:     ProxyProtocolV2,
+			source:      ipv4_source,
+			destination: ipv4_destination,
+			expected: "\r\n\r\n\x00\r\nQUIT\n\x21\x11\x00\x0c" +
+				"\xc0\x00\x02\x01\xc6\x33\x64\x02\xc7\x38\x01\xbb",
+		},
+		{
+			name:        "Version 2 Unknown Addresses",
+			version:     ProxyProtocolV2,
+			source:      &net.UnixAddr{Name: "/tmp/checkhealth.sock"},
+			destination: ipv4_destination,
+			expected:    "\r\n\r\n\x00\r\nQUIT\n\x21\x00\x00\x00",
+		},
+		{
+			name:         "Unsupported Version",
+			version:      "v3",
+			source:       ipv4_source,
+			destination:  ipv4_destination,
+			expectedFail: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			header, err := ProxyProtocolHeader(tc.version, tc.source, tc.destination)
+			assert.Equal(t, err != nil, tc.expectedFail)
+			assert.Equal(t, string(header), tc.expected)
+		})
+	}
+
+	// IPv6 addresses are sent in full in version 2 headers
+	header, err := ProxyProtocolHeader(ProxyProtocolV2, ipv6_source, ipv6_destination)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, len(header), 16+36)
+	assert.Equal(t, header[13], byte(0x21))
+}
+
+// proxyProtocolListener is a listener requiring a version 1 PROXY protocol header at the start of
+// every connection, closing the connections without one.
+type proxyProtocolListener struct {
+	net.Listener
+	headers chan string
+}
+
+func (listener proxyProtocolListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := listener.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		reader := bufio.NewReader(conn)
+		header, err := reader.ReadString('\n')
+		if err != nil || !strings.HasPrefix(header, "PROXY ") {
+			conn.Close()
+			continue
+		}
+		listener.headers <- header
+		return bufferedConn{Conn: conn, reader: reader}, nil
+	}
+}
+
+// bufferedConn is a connection whose first bytes were read into reader.
+type bufferedConn struct {
+	net.Conn
+	reader io.Reader
+}
+
+func (conn bufferedConn) Read(p []byte) (int, error) {
+	return conn.reader.Read(p)
+}
+
+func TestProxyProtocolChecks(t *testing.T) {
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Equal(t, err, nil)
+	listener := proxyProtocolListener{Listener: inner, headers: make(chan string, 10)}
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})}
+	go server.Serve(listener)
+	defer server.Close()
+	url := "http://" + inner.Addr().String() + "/"
+
+	// the target only answers connections starting with a header
+	endpoint := Endpoint{Name: "index", Url: url}
+	result := endpoint.GetEndpointHealth(200 * time.Millisecond)
+	assert.Equal(t, result.Status, StatusDown)
+
+	endpoint.ProxyProtocol = ProxyProtocolV1
+	result = endpoint.GetEndpointHealth(time.Second)
+	assert.Equal(t, result.Status, StatusUp)
+	assert.Equal(t, strings.HasPrefix(<-listener.headers, "PROXY TCP4 127.0.0.1 127.0.0.1 "), true)
+
+	// raw TCP endpoints send the header before their own bytes
+	raw := Endpoint{
+		Name:          "raw",
+		Url:           "tcp://" + inner.Addr().String(),
+		Type:          EndpointTypeRawTCP,
+		ProxyProtocol: ProxyProtocolV1,
+		Send:          "GET / HTTP/1.0\r\n\r\n",
+		ExpectPrefix:  "HTTP/1.0 204",
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	result = raw.runRawTCPCheck(ctx)
+	assert.Equal(t, result.Status, StatusUp)
+	assert.Equal(t, strings.HasPrefix(<-listener.headers, "PROXY TCP4 "), true)
+}
+
+func TestProxyProtocolSettings(t *testing.T) {
+	cases := []struct {
+		name         string
+		endpoint     Endpoint
+		expectedFail bool
+	}{
+		{name: "HTTP", endpoint: Endpoint{Name: "index", Url: "https://fetch.com/", ProxyProtocol: ProxyProtocolV2}},
+		{name: "Raw TCP", endpoint: Endpoint{Name: "raw", Url: "tcp://fetch.com:25", Type: EndpointTypeRawTCP, ProxyProtocol: ProxyProtocolV1}},
+		{name: "Unsupported Version", endpoint: Endpoint{Name: "index", Url: "https://fetch.com/", ProxyProtocol: "v3"}, expectedFail: true},
+		{name: "Unsupported Type", endpoint: Endpoint{Name: "records", Url: "dns://fetch.com", Type: EndpointTypeDNS, ProxyProtocol: ProxyProtocolV2}, expectedFail: true},
+		{name: "Dual Stack", endpoint: Endpoint{Name: "index", Url: "https://fetch.com/", DualStack: true, ProxyProtocol: ProxyProtocolV2}, expectedFail: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			config := Config{Endpoints: Endpoints{tc.endpoint}}
+			err := config.ApplySettings()
+			assert.Equal(t, err != nil, tc.expectedFail)
+		})
+	}
+}
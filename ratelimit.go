@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RateLimitedDown, RateLimitedDegraded and RateLimitedUnknown are the policies for handling
+// rate-limited (429 Too Many Requests) responses of an endpoint:
+//
+//	down      the endpoint is marked down, like any other unexpected status code (default)
+//	degraded  the endpoint is marked degraded: it counts as available for the domain, but its
+//	          state moves to DEGRADED
+//	unknown   the check is recorded as unknown and excluded from availability, and the endpoint
+//	          isn't checked again until the delay of the Retry-After header has passed
+const (
+	RateLimitedDown     string = "down"
+	RateLimitedDegraded string = "degraded"
+	RateLimitedUnknown  string = "unknown"
+)
+
+// DefaultRateLimitBackoff is how long checks of an endpoint under the unknown policy are skipped
+// after a 429 response without a valid Retry-After header. MaxRateLimitBackoff bounds the delay
+// requested by Retry-After, so a misbehaving target can't stop its checks indefinitely.
+const (
+	DefaultRateLimitBackoff time.Duration = time.Minute
+	MaxRateLimitBackoff     time.Duration = time.Hour
+)
+
+// ParseRetryAfter parses the value of a Retry-After header, either a number of seconds or an HTTP
+// date, into the delay from now. It reports false when the value is missing or invalid. Dates in
+// the past result in a zero delay.
+func ParseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		if seconds > int64(MaxRateLimitBackoff/time.Second) {
+			return MaxRateLimitBackoff, true
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	at, err := http.ParseTime(value)
+	if err != nil {
+		return 0, false
+	}
+	if delay := at.Sub(now); delay > 0 {
+		return delay, true
+	}
+	return 0, true
+}
+
+// rateLimited applies the endpoint's RateLimited policy to a result that failed with a 429
+// response. Results of other responses, and results under the down policy, are left unchanged.
+func (endpoint *Endpoint) rateLimited(result *CheckResult) {
+	if result.StatusCode != http.StatusTooManyRequests || result.Status != StatusDown {
+		return
+	}
+
+	switch endpoint.RateLimited {
+	case RateLimitedDegraded:
+		result.fail(StatusDegraded, ErrorKindRateLimited, fmt.Errorf("rate limited with status code %d", result.StatusCode))
+	case RateLimitedUnknown:
+		delay := DefaultRateLimitBackoff
+		if result.retry_after_ok {
+			delay = result.retry_after
+		}
+		if delay > MaxRateLimitBackoff {
+			delay = MaxRateLimitBackoff
+		}
+		result.backoff = delay
+		result.fail(StatusUnknown, ErrorKindRateLimited, fmt.Errorf("rate limited with status code %d, backing off for %s", result.StatusCode, delay))
+	}
+}
+
+// RetryDelay returns how long to wait before retrying a failed check: the delay requested by the
+// Retry-After header of a 429 or 503 response, so recovering targets aren't retried before they
+// asked to be, or else fallback. It reports false when the retry wouldn't start before deadline,
+// so retries never exceed the check's budget. A zero deadline doesn't bound the delay.
+func (result CheckResult) RetryDelay(fallback time.Duration, now time.Time, deadline time.Time) (time.Duration, bool) {
+	delay := fallback
+	if result.retry_after_ok {
+		delay = result.retry_after
+	}
+	if !deadline.IsZero() && !now.Add(delay).Before(deadline) {
+		return delay, false
+	}
+	return delay, true
+}
+
+// backingOff reports whether checks of the endpoint are skipped at the provided time, after a
+// rate-limited response under the unknown policy.
+func (endpoint *Endpoint) backingOff(now time.Time) bool {
+	return now.Before(endpoint.RateLimitedUntil)
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-playground/assert/v2"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		name          string
+		value         string
+		expectedDelay time.Duration
+		expectedOk    bool
+	}{
+		{
+			name:       "Missing",
+			value:      "",
+			expectedOk: false,
+		},
+		{
+			name:          "Seconds",
+			value:         "120",
+			expectedDelay: 2 * time.Minute,
+			expectedOk:    true,
+		},
+		{
+			name:          "Seconds Above Maximum",
+			value:         "86400",
+			expectedDelay: MaxRateLimitBackoff,
+			expectedOk:    true,
+		},
+		{
+			name:       "Negative Seconds",
+			value:      "-1",
+			expectedOk: false,
+		},
+		{
+			name:          "HTTP Date",
+			value:         "Thu, 01 Jun 2023 12:00:30 GMT",
+			expectedDelay: 30 * time.Second,
+			expectedOk:    true,
+		},
+		{
+			name:          "HTTP Date In The Past",
+			value:         "Thu, 01 Jun 2023 11:00:00 GMT",
+			expectedDelay: 0,
+			expectedOk:    true,
+		},
+		{
+			name:       "Invalid",
+			value:      "soon",
+			expectedOk: false,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			delay, ok := ParseRetryAfter(tc.value, now)
+			assert.Equal(t, ok, tc.expectedOk)
+			assert.Equal(t, delay, tc.expectedDelay)
+		})
+	}
+}
+
+func TestGetEndpointHealthRateLimited(t *testing.T) {
+	requests := 0
+	mock_server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Retry-After", "60")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer mock_server.Close()
+
+	cases := []struct {
+		name             string
+		rateLimited      string
+		expectedStatus   string
+		expectedKind     string
+		expectedUp       int
+		expectedTotal    int
+		expectedUnknown  int
+		expectedRequests int
+	}{
+		{
+			name:             "Default Policy Marks Down",
+			rateLimited:      "",
+			expectedStatus:   StatusDown,
+			expectedKind:     ErrorKindStatus,
+			expectedUp:       0,
+			expectedTotal:    2,
+			expectedRequests: 2,
+		},
+		{
+			name:             "Degraded Policy",
+			rateLimited:      RateLimitedDegraded,
+			expectedStatus:   StatusDegraded,
+			expectedKind:     ErrorKindRateLimited,
+			expectedUp:       2,
+			expectedTotal:    2,
+			expectedRequests: 2,
+		},
+		{
+			name:             "Unknown Policy Backs Off",
+			rateLimited:      RateLimitedUnknown,
+			expectedStatus:   StatusUnknown,
+			expectedKind:     ErrorKindRateLimited,
+			expectedUnknown:  2,
+			expectedRequests: 1,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			requests = 0
+			endpoint := Endpoint{
+				Name:        "Rate Limit Test",
+				Url:         mock_server.URL,
+				RateLimited: tc.rateLimited,
+				Domain:      &Domain{Name: "example.com"},
+			}
+
+			var result CheckResult
+			for i := 0; i < 2; i++ {
+				result = endpoint.GetEndpointHealth(2 * time.Second)
+				endpoint.Domain.RecordResult(result)
+			}
+
+			assert.Equal(t, result.Status, tc.expectedStatus)
+			assert.Equal(t, result.ErrorKind, tc.expectedKind)
+			assert.Equal(t, endpoint.Domain.UpCount, tc.expectedUp)
+			assert.Equal(t, endpoint.Domain.TotalRequests, tc.expectedTotal)
+			assert.Equal(t, endpoint.Domain.UnknownCount, tc.expectedUnknown)
+			assert.Equal(t, requests, tc.expectedRequests)
+		})
+	}
+}
+
+func TestApplySettingsRateLimited(t *testing.T) {
+	cases := []struct {
+		name           string
+		config         Config
+		expectedFail   bool
+		expectedPolicy string
+	}{
+		{
+			name: "Endpoint Inherits Settings",
+			config: Config{
+				Settings:  Settings{RateLimited: RateLimitedUnknown},
+				Endpoints: Endpoints{{Name: "example"}},
+			},
+			expectedPolicy: RateLimitedUnknown,
+		},
+		{
+			name: "Endpoint Overrides Settings",
+			config: Config{
+				Settings:  Settings{RateLimited: RateLimitedUnknown},
+				Endpoints: Endpoints{{Name: "example", RateLimited: RateLimitedDegraded}},
+			},
+			expectedPolicy: RateLimitedDegraded,
+		},
+		{
+			name: "Unsupported Policy",
+			config: Config{
+				Endpoints: Endpoints{{Name: "example", RateLimited: "ignore"}},
+			},
+			expectedFail: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.config.ApplySettings()
+			if tc.expectedFail {
+				assert.NotEqual(t, err, nil)
+				return
+			}
+
+			assert.Equal(t, err, nil)
+			assert.Equal(t, tc.config.Endpoints[0].RateLimited, tc.expectedPolicy)
+		})
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	now := time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		name          string
+		statusCode    int
+		retryAfter    string
+		deadline      time.Time
+		expectedDelay time.Duration
+		expectedOk    bool
+	}{
+		{
+			name:          "Fixed Backoff Without Header",
+			statusCode:    http.StatusBadGateway,
+			expectedDelay: 100 * time.Millisecond,
+			expectedOk:    true,
+		},
+		{
+			name:          "Service Unavailable Retry After",
+			statusCode:    http.StatusServiceUnavailable,
+			retryAfter:    "2",
+			expectedDelay: 2 * time.Second,
+			expectedOk:    true,
+		},
+		{
+			name:          "Too Many Requests Retry After",
+			statusCode:    http.StatusTooManyRequests,
+			retryAfter:    "0",
+			expectedDelay: 0,
+			expectedOk:    true,
+		},
+		{
+			name:          "Ignored For Other Status Codes",
+			statusCode:    http.StatusInternalServerError,
+			retryAfter:    "2",
+			expectedDelay: 100 * time.Millisecond,
+			expectedOk:    true,
+		},
+		{
+			name:          "Beyond Check Budget",
+			statusCode:    http.StatusServiceUnavailable,
+			retryAfter:    "2",
+			deadline:      now.Add(time.Second),
+			expectedDelay: 2 * time.Second,
+			expectedOk:    false,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			mock_server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tc.retryAfter != "" {
+					w.Header().Set("Retry-After", tc.retryAfter)
+				}
+				w.WriteHeader(tc.statusCode)
+			}))
+			defer mock_server.Close()
+
+			endpoint := Endpoint{Name: "Retry Test", Url: mock_server.URL}
+			result := endpoint.GetEndpointHealth(2 * time.Second)
+
+			delay, ok := result.RetryDelay(100*time.Millisecond, now, tc.deadline)
+			assert.Equal(t, delay, tc.expectedDelay)
+			assert.Equal(t, ok, tc.expectedOk)
+		})
+	}
+}
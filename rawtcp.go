@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Raw TCP endpoints connect to the host and port of their tcp://host:port URL, send the bytes of
+// send or send_hex, and read the response until it starts with expect_prefix or expect_prefix_hex
+// and satisfies the body assertions, covering proprietary protocols and banners without a checker
+// of their own. Without any expectation, the endpoint is up once connected and the bytes are sent.
+
+// EndpointTypeRawTCP is the type of generic send and expect TCP endpoint checks.
+const EndpointTypeRawTCP string = "raw-tcp"
+
+// ErrorKindResponse classifies raw TCP checks whose response didn't start with the expected
+// prefix.
+const ErrorKindResponse string = "response"
+
+// validateRawTCP rejects raw TCP endpoints whose URL isn't of the form tcp://host:port, which set
+// both the string and hexadecimal form of the bytes sent or expected, or which set a success
+// predicate.
+func (endpoint *Endpoint) validateRawTCP() error {
+	if endpoint.SuccessWhen != "" {
+		return errors.New("success_when isn't supported by raw-tcp endpoints")
+	}
+	if _, err := endpoint.rawTCPAddress(); err != nil {
+		return err
+	}
+	if endpoint.Send != "" && endpoint.SendHex != "" {
+		return errors.New("send and send_hex can't be combined")
+	}
+	if endpoint.ExpectPrefix != "" && endpoint.ExpectPrefixHex != "" {
+		return errors.New("expect_prefix and expect_prefix_hex can't be combined")
+	}
+	if _, err := decodeHexBytes(endpoint.SendHex); err != nil {
+		return fmt.Errorf("invalid send_hex: %v", err)
+	}
+	if _, err := decodeHexBytes(endpoint.ExpectPrefixHex); err != nil {
+		return fmt.Errorf("invalid expect_prefix_hex: %v", err)
+	}
+	return nil
+}
+
+// rawTCPAddress returns the address the raw TCP endpoint connects to.
+func (endpoint *Endpoint) rawTCPAddress() (string, error) {
+	target, err := url.Parse(endpoint.Url)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse url: %v", err)
+	}
+	if target.Scheme != "tcp" || target.Hostname() == "" || target.Port() == "" {
+		return "", fmt.Errorf("url %q of a raw-tcp endpoint must be of the form tcp://host:port", endpoint.Url)
+	}
+	return net.JoinHostPort(target.Hostname(), target.Port()), nil
+}
+
+// decodeHexBytes decodes hexadecimal bytes, which may be separated by whitespace for readability,
+// e.g. "0d 0a".
+func decodeHexBytes(value string) ([]byte, error) {
+	return hex.DecodeString(strings.Join(strings.Fields(value), ""))
+}
+
+// rawTCPPayloads returns the bytes the raw TCP endpoint sends and the prefix its response must
+// start with, either of which may be empty.
+func (endpoint *Endpoint) rawTCPPayloads() ([]byte, []byte) {
+	send := []byte(endpoint.Send)
+	if endpoint.SendHex != "" {
+		send, _ = decodeHexBytes(endpoint.SendHex)
+	}
+	prefix := []byte(endpoint.ExpectPrefix)
+	if endpoint.ExpectPrefixHex != "" {
+		prefix, _ = decodeHexBytes(endpoint.ExpectPrefixHex)
+	}
+	return send, prefix
+}
+
+// runRawTCPCheck connects to the raw TCP endpoint, sends its bytes and reads its response until it
+// satisfies the expectations, the server closes the connection, max_body_size bytes are read or the
+// deadline of ctx passes, and returns its result.
+func (endpoint *Endpoint) runRawTCPCheck(ctx context.Context) CheckResult {
+	result := CheckResult{Status: StatusUp}
+
+	address, err := endpoint.rawTCPAddress()
+	if err != nil {
+		result.fail(StatusDown, ErrorKindConnection, err)
+		return result
+	}
+	send, prefix := endpoint.rawTCPPayloads()
+
+	body_regex, err := endpoint.bodyRegex()
+	if err != nil {
+		result.fail(StatusDown, ErrorKindBody, fmt.Errorf("failed to compile expect_body_regex: %w", err))
+		return result
+	}
+
+	start := time.Now()
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		result.Latency = time.Since(start)
+		result.fail(StatusDown, ErrorKind(err), err)
+		return result
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	if host, _, err := net.SplitHostPort(conn.RemoteAddr().String()); err == nil {
+		result.RemoteIP = host
+	}
+
+	if endpoint.ProxyProtocol != "" {
+		if err := WriteProxyProtocolHeader(conn, endpoint.ProxyProtocol); err != nil {
+			result.Latency = time.Since(start)
+			result.fail(StatusDown, ErrorKind(err), err)
+			return result
+		}
+	}
+
+	if len(send) > 0 {
+		written, err := conn.Write(send)
+		result.BytesSent = int64(written)
+		if err != nil {
+			result.Latency = time.Since(start)
+			result.fail(StatusDown, ErrorKind(err), fmt.Errorf("failed to send: %w", err))
+			return result
+		}
+	}
+
+	if len(prefix) == 0 && !endpoint.expectsBody() {
+		result.Latency = time.Since(start)
+		return result
+	}
+
+	response, err := endpoint.readRawTCPResponse(conn, prefix, body_regex)
+	result.Latency = time.Since(start)
+	result.BytesReceived = int64(len(response))
+	matches_prefix := bytes.HasPrefix(response, prefix)
+	switch body_err := endpoint.checkBody(response, body_regex); {
+	case !matches_prefix && !bytes.HasPrefix(prefix, response):
+		result.fail(StatusDown, ErrorKindResponse, fmt.Errorf("response %q doesn't start with %q", truncateResponse(response, len(prefix)), prefix))
+	case err != nil && (!matches_prefix || body_err != nil):
+		// the read timed out or failed before the expected response was received
+		result.fail(StatusDown, ErrorKind(err), fmt.Errorf("no expected response after %d bytes: %w", len(response), err))
+	case !matches_prefix:
+		result.fail(StatusDown, ErrorKindResponse, fmt.Errorf("response %q ended before %q", response, prefix))
+	case body_err != nil:
+		result.fail(StatusDown, ErrorKindBody, body_err)
+	}
+
+	return result
+}
+
+// readRawTCPResponse reads the response of a raw TCP endpoint until it starts with prefix and
+// satisfies the body assertions, or until it can't, up to max_body_size bytes. The error ending
+// the read is returned with the bytes read, nil when the response was conclusive.
+func (endpoint *Endpoint) readRawTCPResponse(conn net.Conn, prefix []byte, body_regex *regexp.Regexp) ([]byte, error) {
+	limit := endpoint.maxBodySize()
+	var response []byte
+	buffer := make([]byte, 4096)
+	for int64(len(response)) < limit {
+		read, err := conn.Read(buffer)
+		if int64(len(response)+read) > limit {
+			read = int(limit - int64(len(response)))
+		}
+		response = append(response, buffer[:read]...)
+
+		// stop as soon as the prefix is mismatched, or once every expectation is satisfied
+		compared := len(response)
+		if compared > len(prefix) {
+			compared = len(prefix)
+		}
+		if !bytes.Equal(response[:compared], prefix[:compared]) {
+			return response, nil
+		}
+		if len(response) >= len(prefix) && endpoint.checkBody(response, body_regex) == nil {
+			return response, nil
+		}
+
+		if errors.Is(err, io.EOF) {
+			return response, nil
+		}
+		if err != nil {
+			return response, err
+		}
+	}
+	return response, nil
+}
+
+// truncateResponse returns the start of a response reported in an error: its first 64 bytes, or
+// its first length bytes when length is larger.
+func truncateResponse(response []byte, length int) []byte {
+	if length < 64 {
+		length = 64
+	}
+	if len(response) > length {
+		return response[:length]
+	}
+	return response
+}
+
+func init() {
+	RegisterCheckType(EndpointTypeRawTCP, CheckType{
+		Validate: (*Endpoint).validateRawTCP,
+		Check:    (*Endpoint).runRawTCPCheck,
+	})
+}
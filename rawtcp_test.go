@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/go-playground/assert/v2"
+)
+
+// serveRawTCPTest is a minimal line-based server greeting clients with a banner, answering "PING"
+// with "PONG" and staying silent otherwise.
+func serveRawTCPTest(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Equal(t, err, nil)
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				conn.Write([]byte("220 test ready\r\n"))
+				reader := bufio.NewReader(conn)
+				for {
+					line, err := reader.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if line == "PING\r\n" {
+						conn.Write([]byte("PONG\r\n"))
+					}
+				}
+			}()
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func TestValidateRawTCP(t *testing.T) {
+	cases := []struct {
+		name         string
+		endpoint     Endpoint
+		expectedFail bool
+	}{
+		{name: "Valid", endpoint: Endpoint{Url: "tcp://mx1.example.com:25", SendHex: "0d 0a", ExpectPrefix: "220"}},
+		{name: "Missing Port", endpoint: Endpoint{Url: "tcp://mx1.example.com"}, expectedFail: true},
+		{name: "Other Scheme", endpoint: Endpoint{Url: "udp://mx1.example.com:25"}, expectedFail: true},
+		{name: "Send Twice", endpoint: Endpoint{Url: "tcp://mx1.example.com:25", Send: "a", SendHex: "61"}, expectedFail: true},
+		{name: "Expect Prefix Twice", endpoint: Endpoint{Url: "tcp://mx1.example.com:25", ExpectPrefix: "a", ExpectPrefixHex: "61"}, expectedFail: true},
+		{name: "Invalid Hex", endpoint: Endpoint{Url: "tcp://mx1.example.com:25", ExpectPrefixHex: "0g"}, expectedFail: true},
+		{name: "Success Predicate", endpoint: Endpoint{Url: "tcp://mx1.example.com:25", SuccessWhen: "status == 0"}, expectedFail: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.endpoint.validateRawTCP()
+			assert.Equal(t, err != nil, tc.expectedFail)
+		})
+	}
+}
+
+func TestRunRawTCPCheck(t *testing.T) {
+	url := "tcp://" + serveRawTCPTest(t)
+
+	cases := []struct {
+		name              string
+		endpoint          Endpoint
+		expectedStatus    string
+		expectedErrorKind string
+	}{
+		{
+			name:           "Banner",
+			endpoint:       Endpoint{Url: url, ExpectPrefix: "220 "},
+			expectedStatus: StatusUp,
+		},
+		{
+			name:           "Send And Expect Hex",
+			endpoint:       Endpoint{Url: url, Send: "PING\r\n", ExpectBodyRegex: "(?m)^PONG\r$", ExpectPrefixHex: "32 32 30"},
+			expectedStatus: StatusUp,
+		},
+		{
+			name:           "Connect Only",
+			endpoint:       Endpoint{Url: url},
+			expectedStatus: StatusUp,
+		},
+		{
+			name:              "Wrong Prefix",
+			endpoint:          Endpoint{Url: url, ExpectPrefix: "+OK"},
+			expectedStatus:    StatusDown,
+			expectedErrorKind: ErrorKindResponse,
+		},
+		{
+			name:              "No Expected Response",
+			endpoint:          Endpoint{Url: url, Send: "HELO\r\n", ExpectBodyContains: "250"},
+			expectedStatus:    StatusDown,
+			expectedErrorKind: ErrorKindTimeout,
+		},
+		{
+			name:              "Connection Refused",
+			endpoint:          Endpoint{Url: "tcp://127.0.0.1:1", ExpectPrefix: "220"},
+			expectedStatus:    StatusDown,
+			expectedErrorKind: ErrorKindConnection,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+			defer cancel()
+
+			result := tc.endpoint.runRawTCPCheck(ctx)
+			assert.Equal(t, result.Status, tc.expectedStatus)
+			assert.Equal(t, result.ErrorKind, tc.expectedErrorKind)
+		})
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// Redirects are followed by default, up to DefaultMaxRedirects, so a health URL redirecting to a
+// healthy page is up. Endpoints that must not redirect set follow_redirects to false, so the
+// redirect response itself is checked, and endpoints may lower the limit with max_redirects.
+//
+// The time spent on every redirect followed is recorded in the Redirects of the check result, so
+// slow redirect chains are visible. Endpoints setting max_redirect_latency budget their redirects
+// separately: checks whose redirects take longer are degraded, and max_latency only applies to the
+// final response.
+
+// DefaultMaxRedirects is the maximum number of redirects followed by the checks of endpoints that
+// don't set their own, the limit of http.Client.
+const DefaultMaxRedirects int = 10
+
+// ErrorKindRedirect classifies checks failing because their request was redirected more than the
+// maximum number of redirects of their endpoint.
+const ErrorKindRedirect string = "redirect"
+
+// ErrTooManyRedirects is returned by checks redirected more than the maximum number of redirects
+// of their endpoint.
+var ErrTooManyRedirects = errors.New("too many redirects")
+
+// checkRedirect is a method for ClientOptions that returns the redirect policy of the clients
+// tuned with the options: redirect responses are returned when redirects are disabled, and
+// ErrTooManyRedirects after MaxRedirects redirects, or DefaultMaxRedirects when unset.
+func (options ClientOptions) checkRedirect() func(request *http.Request, via []*http.Request) error {
+	if options.DisableRedirects {
+		return func(request *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		}
+	}
+
+	max_redirects := options.MaxRedirects
+	if max_redirects <= 0 {
+		max_redirects = DefaultMaxRedirects
+	}
+	return func(request *http.Request, via []*http.Request) error {
+		recordRedirect(request, via)
+		if len(via) > max_redirects {
+			return fmt.Errorf("stopped after %d redirects: %w", max_redirects, ErrTooManyRedirects)
+		}
+		return nil
+	}
+}
+
+// RedirectHop is a redirect response followed by a check: the URL requested, the redirect status
+// code and the time from the start of the request to the redirect response.
+type RedirectHop struct {
+	Url        string        `json:"url"`
+	StatusCode int           `json:"status_code"`
+	Latency    time.Duration `json:"latency"`
+}
+
+// redirectTrace records the redirects followed by the requests of a check into result, see
+// withRedirectTrace.
+type redirectTrace struct {
+	mu        sync.Mutex
+	result    *CheckResult
+	hop_start time.Time
+}
+
+type redirectTraceKey struct{}
+
+// withRedirectTrace returns a context recording the redirects followed by a request into the
+// Redirects of result. Every hop starts when its connection is requested, and ends when the
+// redirect policy of the client is called with the redirect response.
+func withRedirectTrace(ctx context.Context, result *CheckResult) context.Context {
+	trace := &redirectTrace{result: result}
+	ctx = context.WithValue(ctx, redirectTraceKey{}, trace)
+	return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GetConn: func(string) {
+			trace.mu.Lock()
+			trace.hop_start = time.Now()
+			trace.mu.Unlock()
+		},
+	})
+}
+
+// recordRedirect records the redirect response that led to request in the trace of its context,
+// if any.
+func recordRedirect(request *http.Request, via []*http.Request) {
+	trace, ok := request.Context().Value(redirectTraceKey{}).(*redirectTrace)
+	if !ok || len(via) == 0 {
+		return
+	}
+	hop := RedirectHop{Url: via[len(via)-1].URL.String()}
+	if request.Response != nil {
+		hop.StatusCode = request.Response.StatusCode
+	}
+
+	trace.mu.Lock()
+	defer trace.mu.Unlock()
+	if !trace.hop_start.IsZero() {
+		hop.Latency = time.Since(trace.hop_start)
+	}
+	trace.result.Redirects = append(trace.result.Redirects, hop)
+}
+
+// RedirectLatency is a method for CheckResult that returns the time spent on the redirects
+// followed by the check.
+func (result *CheckResult) RedirectLatency() time.Duration {
+	var latency time.Duration
+	for _, hop := range result.Redirects {
+		latency += hop.Latency
+	}
+	return latency
+}
+
+// judgeRedirects is a method for Endpoint that marks a successful check degraded when its
+// redirects took longer than the endpoint's max_redirect_latency.
+func (endpoint *Endpoint) judgeRedirects(result *CheckResult) {
+	if endpoint.MaxRedirectLatency <= 0 || result.Status != StatusUp {
+		return
+	}
+	if latency := result.RedirectLatency(); latency > endpoint.MaxRedirectLatency {
+		result.fail(StatusDegraded, ErrorKindRedirect, fmt.Errorf("%d redirects took %s, above the max redirect latency of %s", len(result.Redirects), latency, endpoint.MaxRedirectLatency))
+	}
+}
+
+// followsRedirects reports whether the endpoint's checks follow redirects, which they do unless
+// follow_redirects is false.
+func (endpoint *Endpoint) followsRedirects() bool {
+	return endpoint.FollowRedirects == nil || *endpoint.FollowRedirects
+}
+
+// validateRedirects rejects negative maximum numbers of redirects and redirect latencies, and
+// either of them on endpoints that don't follow redirects.
+func (endpoint *Endpoint) validateRedirects() error {
+	if endpoint.MaxRedirects < 0 {
+		return errors.New("max_redirects must be positive")
+	}
+	if endpoint.MaxRedirectLatency < 0 {
+		return errors.New("max_redirect_latency must be positive")
+	}
+	if (endpoint.MaxRedirects > 0 || endpoint.MaxRedirectLatency > 0) && !endpoint.followsRedirects() {
+		return errors.New("max_redirects and max_redirect_latency can't be combined with follow_redirects: false")
+	}
+	return nil
+}
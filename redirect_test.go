@@ -0,0 +1,165 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-playground/assert/v2"
+)
+
+func TestGetEndpointHealthRedirects(t *testing.T) {
+	// /hops/N redirects N times before reaching a healthy page
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hops, _ := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/hops/"))
+		if hops == 0 {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		http.Redirect(w, r, "/hops/"+strconv.Itoa(hops-1), http.StatusFound)
+	}))
+	defer server.Close()
+	follow, no_follow := true, false
+
+	cases := []struct {
+		name               string
+		path               string
+		followRedirects    *bool
+		maxRedirects       int
+		successWhen        string
+		expectedStatus     string
+		expectedStatusCode int
+		expectedErrorKind  string
+	}{
+		{name: "Redirects Followed By Default", path: "/hops/3", expectedStatus: StatusUp, expectedStatusCode: http.StatusOK},
+		{name: "Redirects Followed", path: "/hops/3", followRedirects: &follow, expectedStatus: StatusUp, expectedStatusCode: http.StatusOK},
+		{name: "Redirect Not Followed", path: "/hops/1", followRedirects: &no_follow, expectedStatus: StatusDown, expectedStatusCode: http.StatusFound, expectedErrorKind: ErrorKindStatus},
+		{name: "Expected Redirect", path: "/hops/1", followRedirects: &no_follow, successWhen: "status == 302", expectedStatus: StatusUp, expectedStatusCode: http.StatusFound},
+		{name: "Within Max Redirects", path: "/hops/2", maxRedirects: 2, expectedStatus: StatusUp, expectedStatusCode: http.StatusOK},
+		{name: "Too Many Redirects", path: "/hops/3", maxRedirects: 2, expectedStatus: StatusDown, expectedErrorKind: ErrorKindRedirect},
+		{name: "Default Max Redirects", path: "/hops/11", expectedStatus: StatusDown, expectedErrorKind: ErrorKindRedirect},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			endpoints := Endpoints{{
+				Name:            "redirect",
+				Url:             server.URL + tc.path,
+				FollowRedirects: tc.followRedirects,
+				MaxRedirects:    tc.maxRedirects,
+				SuccessWhen:     tc.successWhen,
+			}}
+			_, err := endpoints.CreateNewTargets()
+			assert.Equal(t, err, nil)
+
+			result := endpoints[0].GetEndpointHealth(5 * time.Second)
+			assert.Equal(t, result.Status, tc.expectedStatus)
+			assert.Equal(t, result.ErrorKind, tc.expectedErrorKind)
+			if tc.expectedStatusCode != 0 {
+				assert.Equal(t, result.StatusCode, tc.expectedStatusCode)
+			}
+		})
+	}
+}
+
+func TestValidateRedirects(t *testing.T) {
+	no_follow := false
+
+	cases := []struct {
+		name         string
+		endpoint     Endpoint
+		expectedFail bool
+	}{
+		{name: "Defaults", endpoint: Endpoint{}},
+		{name: "Max Redirects", endpoint: Endpoint{MaxRedirects: 3}},
+		{name: "Redirects Not Followed", endpoint: Endpoint{FollowRedirects: &no_follow}},
+		{name: "Negative Max Redirects", endpoint: Endpoint{MaxRedirects: -1}, expectedFail: true},
+		{name: "Max Redirects Not Followed", endpoint: Endpoint{MaxRedirects: 3, FollowRedirects: &no_follow}, expectedFail: true},
+		{name: "Max Redirect Latency", endpoint: Endpoint{MaxRedirectLatency: time.Second}},
+		{name: "Negative Max Redirect Latency", endpoint: Endpoint{MaxRedirectLatency: -time.Second}, expectedFail: true},
+		{name: "Max Redirect Latency Not Followed", endpoint: Endpoint{MaxRedirectLatency: time.Second, FollowRedirects: &no_follow}, expectedFail: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.endpoint.validateRedirects()
+			if tc.expectedFail {
+				assert.NotEqual(t, err, nil)
+			} else {
+				assert.Equal(t, err, nil)
+			}
+		})
+	}
+}
+
+func TestGetEndpointHealthRedirectLatency(t *testing.T) {
+	// /slow redirects slowly to /fast, which responds right away
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/slow":
+			time.Sleep(100 * time.Millisecond)
+			http.Redirect(w, r, "/fast", http.StatusMovedPermanently)
+		case "/fast":
+			http.Redirect(w, r, "/health", http.StatusFound)
+		default:
+			w.WriteHeader(http.StatusOK)
+		}
+	}))
+	defer server.Close()
+
+	cases := []struct {
+		name               string
+		maxLatency         time.Duration
+		maxRedirectLatency time.Duration
+		expectedStatus     string
+		expectedErrorKind  string
+	}{
+		{name: "No Budgets", expectedStatus: StatusUp},
+		{name: "Slow Chain Over Max Latency", maxLatency: 50 * time.Millisecond, expectedStatus: StatusDegraded, expectedErrorKind: ErrorKindLatency},
+		{name: "Redirects Budgeted Separately", maxLatency: 50 * time.Millisecond, maxRedirectLatency: time.Second, expectedStatus: StatusUp},
+		{name: "Redirects Over Budget", maxRedirectLatency: 50 * time.Millisecond, expectedStatus: StatusDegraded, expectedErrorKind: ErrorKindRedirect},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			endpoint := Endpoint{
+				Name:               "login",
+				Url:                server.URL + "/slow",
+				Timeout:            2 * time.Second,
+				MaxLatency:         tc.maxLatency,
+				MaxRedirectLatency: tc.maxRedirectLatency,
+			}
+			result := endpoint.GetEndpointHealth(5 * time.Second)
+			assert.Equal(t, result.Status, tc.expectedStatus)
+			assert.Equal(t, result.ErrorKind, tc.expectedErrorKind)
+
+			// every hop is recorded with its status and latency
+			assert.Equal(t, len(result.Redirects), 2)
+			assert.Equal(t, result.Redirects[0].Url, server.URL+"/slow")
+			assert.Equal(t, result.Redirects[0].StatusCode, http.StatusMovedPermanently)
+			assert.Equal(t, result.Redirects[0].Latency >= 100*time.Millisecond, true)
+			assert.Equal(t, result.Redirects[1].Url, server.URL+"/fast")
+			assert.Equal(t, result.Redirects[1].StatusCode, http.StatusFound)
+			assert.Equal(t, result.RedirectLatency() <= result.Latency, true)
+		})
+	}
+}
+
+func TestMetricsRedirects(t *testing.T) {
+	targets := &HealthCheckTargets{Metrics: NewMetrics()}
+	targets.Metrics.Observe([]CheckResult{{
+		Endpoint:  "login",
+		Url:       "https://fetch.com/login",
+		Status:    StatusUp,
+		Latency:   time.Second,
+		Redirects: []RedirectHop{{Url: "https://fetch.com/login", StatusCode: 302, Latency: 250 * time.Millisecond}, {Url: "https://sso.fetch.com/", StatusCode: 302, Latency: 500 * time.Millisecond}},
+	}}, nil)
+
+	var output strings.Builder
+	assert.Equal(t, targets.WriteMetrics(&output), nil)
+	assert.Equal(t, strings.Contains(output.String(), `checkhealth_endpoint_redirects_total{endpoint="login",url="https://fetch.com/login"} 2`), true)
+	assert.Equal(t, strings.Contains(output.String(), `checkhealth_endpoint_redirect_seconds_total{endpoint="login",url="https://fetch.com/login"} 0.75`), true)
+}
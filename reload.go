@@ -0,0 +1,257 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"reflect"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// restartSettings returns the names of the settings that differ between current and reloaded and
+// only take effect when the process starts: the check cycle timing, the metrics listener, the
+// state file, the parquet directory, the SQLite database, the signing key, the sinks and the
+// notifiers, along with their alert dampening, and the logging.
+func restartSettings(current Settings, reloaded Settings) []string {
+	var names []string
+	if current.CheckInterval() != reloaded.CheckInterval() {
+		names = append(names, "interval")
+	}
+	if current.Align != reloaded.Align {
+		names = append(names, "align")
+	}
+	if current.Concurrency != reloaded.Concurrency || current.ConcurrencyMin != reloaded.ConcurrencyMin || current.ConcurrencyMax != reloaded.ConcurrencyMax {
+		names = append(names, "concurrency")
+	}
+	if current.Listen != reloaded.Listen {
+		names = append(names, "listen")
+	}
+	if current.StateFile != reloaded.StateFile {
+		names = append(names, "state_file")
+	}
+	if current.ParquetDir != reloaded.ParquetDir {
+		names = append(names, "parquet_dir")
+	}
+	if current.SQLiteFile != reloaded.SQLiteFile {
+		names = append(names, "sqlite_file")
+	}
+	if current.SigningKey != reloaded.SigningKey {
+		names = append(names, "signing_key")
+	}
+	if !reflect.DeepEqual(current.Sinks, reloaded.Sinks) {
+		names = append(names, "sinks")
+	}
+	if !reflect.DeepEqual(current.Notifiers, reloaded.Notifiers) {
+		names = append(names, "notifiers")
+	}
+	if current.AlertDampening != reloaded.AlertDampening {
+		names = append(names, "alert_dampening")
+	}
+	if current.LogLevel != reloaded.LogLevel {
+		names = append(names, "log_level")
+	}
+	if current.LogFormat != reloaded.LogFormat {
+		names = append(names, "log_format")
+	}
+	return names
+}
+
+// Reload is a method for HealthCheckTargets that replaces the checked endpoints and the settings
+// with those of a new configuration, without restarting the process. Endpoints that are still
+// configured, with the same name and URL, keep their state, recent errors and latency baseline,
+// and domains that are still configured keep their statistics. Abandoned endpoints are resumed, see
+// AbandonEndpoints. Removed endpoints are dropped from the metrics.
+//
+// Settings that only take effect at startup (see restartSettings) keep their current value, and a
+// warning is logged when they changed. If the new endpoints can't be created, an error is returned
+// and the current configuration is kept. Otherwise, Reload returns the number of endpoints added
+// and removed.
+func (target *HealthCheckTargets) Reload(config Config) (int, int, error) {
+	settings := config.Settings
+	if names := restartSettings(target.Settings, settings); len(names) > 0 {
+		log.Printf("WARNING: changes to %s require a restart and are ignored", strings.Join(names, ", "))
+	}
+	settings.Interval, settings.Align = target.Settings.Interval, target.Settings.Align
+	settings.Concurrency, settings.ConcurrencyMin, settings.ConcurrencyMax = target.Settings.Concurrency, target.Settings.ConcurrencyMin, target.Settings.ConcurrencyMax
+	settings.Listen, settings.StateFile, settings.SigningKey = target.Settings.Listen, target.Settings.StateFile, target.Settings.SigningKey
+	settings.ParquetDir, settings.SQLiteFile = target.Settings.ParquetDir, target.Settings.SQLiteFile
+	settings.Sinks, settings.Notifiers, settings.AlertDampening = target.Settings.Sinks, target.Settings.Notifiers, target.Settings.AlertDampening
+	settings.LogLevel, settings.LogFormat = target.Settings.LogLevel, target.Settings.LogFormat
+	if settings.MaxCheckLatency() > settings.CheckInterval() {
+		return 0, 0, fmt.Errorf("max latency %v must not exceed the interval %v", settings.MaxCheckLatency(), settings.CheckInterval())
+	}
+
+	reloaded, err := config.Endpoints.CreateNewTargets()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// carry the runtime state of the endpoints that are still configured over
+	current := map[string]*Endpoint{}
+	if target.Endpoints != nil {
+		for i := range *target.Endpoints {
+			endpoint := &(*target.Endpoints)[i]
+			current[endpoint.Name+"\x00"+endpoint.Url] = endpoint
+		}
+	}
+	added := 0
+	for i := range *reloaded.Endpoints {
+		endpoint := &(*reloaded.Endpoints)[i]
+		key := endpoint.Name + "\x00" + endpoint.Url
+		previous, ok := current[key]
+		if !ok {
+			added++
+			continue
+		}
+		delete(current, key)
+
+		previous.State.SetThresholds(endpoint.DownAfter, endpoint.ErrorHistory)
+		endpoint.State = previous.State
+		endpoint.Schedule = previous.Schedule
+		if endpoint.AutoLatency && previous.Baseline != nil {
+			endpoint.Baseline = previous.Baseline
+		}
+		endpoint.RateLimitedUntil = previous.RateLimitedUntil
+		endpoint.HeadRejected = previous.HeadRejected
+
+		// reloading resumes the checks of abandoned endpoints
+		if endpoint.State != nil && endpoint.State.Resume(time.Now()) {
+			log.Printf("Resumed the checks of abandoned endpoint %s", endpoint.Name)
+		}
+	}
+	for _, endpoint := range current {
+		target.Metrics.Forget(endpoint.Name, endpoint.Url)
+	}
+
+	domain_stats.Lock()
+	defer domain_stats.Unlock()
+
+	// carry the statistics of the domains that are still configured over
+	domains := map[string]*Domain{}
+	for domain := target.Domains; domain != nil; domain = domain.Next {
+		domains[domain.Name] = domain
+	}
+	for domain := reloaded.Domains; domain != nil; domain = domain.Next {
+		if previous, ok := domains[domain.Name]; ok {
+			next := domain.Next
+			*domain = *previous
+			domain.Next = next
+		}
+	}
+
+	target.Endpoints = reloaded.Endpoints
+	target.Domains = reloaded.Domains
+	target.Settings = settings
+	target.Source = config.Source
+	target.Skipped = config.Skipped
+	return added, len(current), nil
+}
+
+// ApplyReload is a method for HealthCheckTargets that reloads a new configuration between check
+// cycles, logging the number of endpoints added and removed and auditing the changes (see
+// AuditReload), or the error that kept the current configuration.
+func (target *HealthCheckTargets) ApplyReload(config Config) {
+	previous := target.currentConfig()
+	added, removed, err := target.Reload(config)
+	if err != nil {
+		log.Printf("Failed to reload the configuration, keeping the current one: %v", err)
+		return
+	}
+	log.Printf("Reloaded the configuration: %d endpoints added, %d removed", added, removed)
+	target.AuditReload(previous, time.Now())
+}
+
+// WatchReloads reads the configuration again with LoadConfig from args every time the process
+// receives SIGHUP, along with the pending configuration set with -next-config, and returns a
+// channel of the configurations read, applied by RunCheckHealth before the next check cycle.
+// Configurations that fail to load are logged and not sent.
+//
+// On SwapSignal, the pending configuration next, preloaded and validated beforehand, is sent
+// without reading any file, and replaces args for later reloads.
+func WatchReloads(args []string, next *Config) <-chan Config {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	if SwapSignal != nil {
+		signal.Notify(signals, SwapSignal)
+	}
+
+	reloads := make(chan Config, 1)
+	watcher := &reloadWatcher{args: args, next: next}
+	go func() {
+		for received := range signals {
+			var config Config
+			var ok bool
+			if received == syscall.SIGHUP {
+				config, ok = watcher.reload()
+			} else {
+				config, ok = watcher.swap()
+			}
+			if !ok {
+				continue
+			}
+
+			// a newer configuration replaces one not applied yet
+			select {
+			case <-reloads:
+			default:
+			}
+			reloads <- config
+		}
+	}()
+	return reloads
+}
+
+// reloadWatcher holds the command line arguments of the current configuration file and the
+// preloaded pending configuration of WatchReloads.
+type reloadWatcher struct {
+	args []string
+	next *Config
+}
+
+// reload reads the configuration file again, and preloads the pending configuration it sets. A
+// pending configuration that fails to load is logged and can't be swapped to until a reload
+// succeeds. It returns false if the configuration file fails to load.
+func (watcher *reloadWatcher) reload() (Config, bool) {
+	config, err := LoadConfig(watcher.args)
+	if err != nil {
+		// without the usage appended for the command line
+		log.Printf("Failed to reload the configuration, keeping the current one: %s", strings.SplitN(err.Error(), "\n\n", 2)[0])
+		return Config{}, false
+	}
+
+	watcher.next, err = LoadNextConfig(config)
+	if err != nil {
+		log.Printf("WARNING: %s", strings.SplitN(err.Error(), "\n\n", 2)[0])
+	}
+	return config, true
+}
+
+// swap returns the preloaded pending configuration, which becomes the configuration file read by
+// later reloads. It returns false if there's no pending configuration.
+func (watcher *reloadWatcher) swap() (Config, bool) {
+	if watcher.next == nil {
+		log.Printf("WARNING: no next configuration to swap to, it must be set with -next-config and valid")
+		return Config{}, false
+	}
+
+	config := *watcher.next
+	log.Printf("Swapping to the next configuration %s", config.args[len(config.args)-1])
+	watcher.args, watcher.next = config.args, nil
+	return config, true
+}
+
+// LoadNextConfig loads the pending configuration file set with -next-config on the command line
+// config was loaded from, with the same flags. Nil is returned without a pending configuration.
+func LoadNextConfig(config Config) (*Config, error) {
+	if config.NextConfig == "" {
+		return nil, nil
+	}
+	next, err := LoadConfig(config.next_args)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load the next configuration %s: %v", config.NextConfig, err)
+	}
+	return &next, nil
+}
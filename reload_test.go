@@ -0,0 +1,190 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-playground/assert/v2"
+)
+
+func TestReload(t *testing.T) {
+	endpoints := Endpoints{
+		{Name: "index", Url: "https://fetch.com/"},
+		{Name: "careers", Url: "https://fetch.com/careers"},
+		{Name: "api", Url: "https://api.fetch.com/"},
+	}
+	targets, err := endpoints.CreateNewTargets()
+	assert.Equal(t, err, nil)
+	targets.Settings = Settings{Output: OutputText, Interval: 15 * time.Second}
+	targets.Metrics = NewMetrics()
+
+	finished_at := time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+	results := []CheckResult{
+		{Endpoint: "index", Url: "https://fetch.com/", Status: StatusUp, FinishedAt: finished_at},
+		{Endpoint: "careers", Url: "https://fetch.com/careers", Status: StatusDown, ErrorKind: ErrorKindTimeout, FinishedAt: finished_at},
+		{Endpoint: "api", Url: "https://api.fetch.com/", Status: StatusUp, FinishedAt: finished_at},
+	}
+	targets.RecordResults(results)
+	targets.Metrics.Observe(results, targets.Endpoints)
+
+	// careers is removed, the index page moves to its own domain and a status page is added
+	config := Config{
+		Settings: Settings{Output: OutputJSON, Interval: time.Minute},
+		Endpoints: Endpoints{
+			{Name: "careers", Url: "https://careers.fetch.com/"},
+			{Name: "index", Url: "https://fetch.com/", DownAfter: 1},
+			{Name: "api", Url: "https://api.fetch.com/"},
+		},
+	}
+	added, removed, err := targets.Reload(config)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, added, 1)
+	assert.Equal(t, removed, 1)
+
+	// settings applied at startup are kept
+	assert.Equal(t, targets.Settings.Output, OutputJSON)
+	assert.Equal(t, targets.Settings.Interval, 15*time.Second)
+
+	statuses := targets.EndpointStates()
+	assert.Equal(t, len(statuses), 3)
+	assert.Equal(t, statuses[0].State, StateUnknown)
+	assert.Equal(t, statuses[1].State, StateUp)
+	assert.Equal(t, statuses[1].RecentCheckCount, 1)
+	assert.Equal(t, statuses[2].State, StateUp)
+
+	// the statistics of the domains still configured are kept
+	index := (*targets.Endpoints)[1].Domain
+	assert.Equal(t, index.Name, "fetch.com")
+	assert.Equal(t, index.TotalRequests, 2)
+	assert.Equal(t, index.UpCount, 1)
+	assert.Equal(t, (*targets.Endpoints)[0].Domain.TotalRequests, 0)
+	assert.Equal(t, (*targets.Endpoints)[2].Domain.UpCount, 1)
+
+	// the new down_after of the index page applies to its kept state
+	transitions := targets.RecordResults([]CheckResult{
+		{Endpoint: "careers", Url: "https://careers.fetch.com/", Status: StatusUp, FinishedAt: finished_at},
+		{Endpoint: "index", Url: "https://fetch.com/", Status: StatusDown, ErrorKind: ErrorKindStatus, StatusCode: 503, FinishedAt: finished_at},
+		{Endpoint: "api", Url: "https://api.fetch.com/", Status: StatusUp, FinishedAt: finished_at},
+	})
+	assert.Equal(t, len(transitions), 2)
+	assert.Equal(t, transitions[1].To, StateDown)
+
+	// removed endpoints are dropped from the metrics
+	var output strings.Builder
+	assert.Equal(t, targets.WriteMetrics(&output), nil)
+	assert.Equal(t, strings.Contains(output.String(), `endpoint="careers",url="https://fetch.com/careers"`), false)
+	assert.Equal(t, strings.Contains(output.String(), `checkhealth_endpoint_checks_total{endpoint="index",url="https://fetch.com/"} 1`), true)
+}
+
+func TestReloadInvalid(t *testing.T) {
+	endpoints := Endpoints{{Name: "index", Url: "https://fetch.com/"}}
+	targets, err := endpoints.CreateNewTargets()
+	assert.Equal(t, err, nil)
+	targets.Settings = Settings{Interval: time.Second}
+
+	cases := []struct {
+		name   string
+		config Config
+	}{
+		{
+			name:   "Invalid Predicate",
+			config: Config{Endpoints: Endpoints{{Name: "index", Url: "https://fetch.com/", SuccessWhen: "status =="}}},
+		},
+		{
+			name:   "Max Latency Above Interval",
+			config: Config{Settings: Settings{MaxLatency: 2 * time.Second}, Endpoints: Endpoints{{Name: "index", Url: "https://fetch.com/"}}},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, _, err := targets.Reload(tc.config)
+			assert.NotEqual(t, err, nil)
+
+			// the current configuration is kept
+			assert.Equal(t, targets.Endpoints, &endpoints)
+			assert.Equal(t, targets.Settings.MaxLatency, time.Duration(0))
+		})
+	}
+}
+
+func TestRestartSettings(t *testing.T) {
+	current := Settings{Interval: 15 * time.Second, Listen: ":9100"}
+	reloaded := Settings{Listen: ":9200", Output: OutputJSON, Sinks: []SinkConfig{{Type: "file"}}, AlertDampening: time.Minute, LogLevel: LogLevelDebug}
+	assert.Equal(t, restartSettings(current, reloaded), []string{"listen", "sinks", "alert_dampening", "log_level"})
+	assert.Equal(t, len(restartSettings(current, current)), 0)
+}
+
+func TestNextConfig(t *testing.T) {
+	dir := t.TempDir()
+	blue := filepath.Join(dir, "blue.yaml")
+	assert.Equal(t, os.WriteFile(blue, []byte("- name: index\n  url: https://fetch.com/\n"), 0o644), nil)
+	green := filepath.Join(dir, "green.yaml")
+	assert.Equal(t, os.WriteFile(green, []byte("- name: index\n  url: https://fetch.com/\n- name: careers\n  url: https://fetch.com/careers\n"), 0o644), nil)
+	invalid := filepath.Join(dir, "invalid.yaml")
+	assert.Equal(t, os.WriteFile(invalid, []byte("- name: index\n"), 0o644), nil)
+
+	// the next configuration is loaded with the same flags
+	config, err := LoadConfig([]string{"-interval", "30s", "-next-config", green, blue})
+	assert.Equal(t, err, nil)
+	assert.Equal(t, config.NextConfig, green)
+	next, err := LoadNextConfig(config)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, len(next.Endpoints), 2)
+	assert.Equal(t, next.Interval, 30*time.Second)
+	assert.Equal(t, next.NextConfig, "")
+
+	// an invalid next configuration is refused
+	config, err = LoadConfig([]string{"-next-config", invalid, blue})
+	assert.Equal(t, err, nil)
+	_, err = LoadNextConfig(config)
+	assert.NotEqual(t, err, nil)
+
+	// without -next-config there's nothing to preload
+	config, err = LoadConfig([]string{blue})
+	assert.Equal(t, err, nil)
+	next, err = LoadNextConfig(config)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, next, (*Config)(nil))
+}
+
+func TestReloadWatcherSwap(t *testing.T) {
+	dir := t.TempDir()
+	blue := filepath.Join(dir, "blue.yaml")
+	assert.Equal(t, os.WriteFile(blue, []byte("- name: index\n  url: https://fetch.com/\n"), 0o644), nil)
+	green := filepath.Join(dir, "green.yaml")
+	assert.Equal(t, os.WriteFile(green, []byte("- name: careers\n  url: https://fetch.com/careers\n"), 0o644), nil)
+
+	args := []string{"-next-config", green, blue}
+	config, err := LoadConfig(args)
+	assert.Equal(t, err, nil)
+	next, err := LoadNextConfig(config)
+	assert.Equal(t, err, nil)
+	watcher := &reloadWatcher{args: args, next: next}
+
+	// the swap doesn't read the file, so changes after the preload aren't picked up
+	assert.Equal(t, os.WriteFile(green, []byte("- name: status\n  url: https://status.fetch.com/\n"), 0o644), nil)
+	swapped, ok := watcher.swap()
+	assert.Equal(t, ok, true)
+	assert.Equal(t, swapped.Endpoints[0].Name, "careers")
+
+	// there's nothing left to swap to, and reloads read the next configuration file
+	_, ok = watcher.swap()
+	assert.Equal(t, ok, false)
+	reloaded, ok := watcher.reload()
+	assert.Equal(t, ok, true)
+	assert.Equal(t, reloaded.Endpoints[0].Name, "status")
+	assert.Equal(t, watcher.next, (*Config)(nil))
+
+	// an invalid next configuration can't be swapped to until it loads
+	watcher = &reloadWatcher{args: args}
+	assert.Equal(t, os.WriteFile(green, []byte("- name: status\n"), 0o644), nil)
+	reloaded, ok = watcher.reload()
+	assert.Equal(t, ok, true)
+	assert.Equal(t, reloaded.Endpoints[0].Name, "index")
+	_, ok = watcher.swap()
+	assert.Equal(t, ok, false)
+}
@@ -0,0 +1,458 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// With report_file, a report of the run is written when the program is terminated, summarizing the
+// checks, the availability and the outages of every endpoint since it started, so CI systems and
+// batch jobs can archive and display the outcome of a run. The report is JSON (see RunReport), or
+// JUnit XML, where every endpoint is a test case failing when it was DOWN during the run. With the
+// junit output, the JUnit XML report is printed to the console on exit instead. Runs bounded with
+// -once or -duration exit with status 1 when the run didn't pass.
+
+// ReportJSON and ReportJUnit are the supported formats of the run report. The format defaults to
+// ReportJUnit for report files ending with .xml, and to ReportJSON otherwise.
+const (
+	ReportJSON  string = "json"
+	ReportJUnit string = "junit"
+)
+
+// RunRecorder records the results and outages of every endpoint over a run of RunCheckHealth, for
+// the run report. It is safe for concurrent use, so the report can be written while a cycle is
+// recorded.
+type RunRecorder struct {
+	mu         sync.Mutex
+	started_at time.Time
+	cycles     int
+
+	// endpoints are the endpoints checked during the run, in the order they were first checked, so
+	// endpoints removed by a reload are still reported.
+	endpoints []*endpointRun
+	index     map[string]*endpointRun
+}
+
+// endpointRun is the record of an endpoint over a run.
+type endpointRun struct {
+	report    EndpointReport
+	latencies int
+}
+
+// RunReport is the report of a run, written to report_file on termination.
+type RunReport struct {
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	DurationMs float64   `json:"duration_ms"`
+	Cycles     int       `json:"cycles"`
+
+	// Passed is whether no endpoint was DOWN during the run, except the abandoned endpoints.
+	Passed bool `json:"passed"`
+
+	Endpoints []EndpointReport `json:"endpoints"`
+
+	// Domains are the availability of the domains at the end of the run, like in
+	// domain_availability events.
+	Domains []*DomainEvent `json:"domains"`
+}
+
+// EndpointReport is the record of an endpoint over a run.
+type EndpointReport struct {
+	Endpoint string `json:"endpoint"`
+	Url      string `json:"url"`
+	Domain   string `json:"domain,omitempty"`
+
+	// State is the state of the endpoint at the end of the run.
+	State string `json:"state"`
+
+	// Abandoned is whether the checks of the endpoint were paused at the end of the run, after it
+	// stayed DOWN for its abandon_after. Abandoned endpoints don't fail the run.
+	Abandoned bool `json:"abandoned,omitempty"`
+
+	Checks        int `json:"checks"`
+	UpCount       int `json:"up_count"`
+	DegradedCount int `json:"degraded_count"`
+	DownCount     int `json:"down_count"`
+	UnknownCount  int `json:"unknown_count"`
+
+	// Availability is the percentage of the conclusive checks of the run that were up or degraded.
+	Availability int `json:"availability"`
+
+	// AvgLatencyMs is the average latency of the checks with a latency.
+	AvgLatencyMs float64 `json:"avg_latency_ms,omitempty"`
+
+	Outages []OutageReport `json:"outages,omitempty"`
+
+	// total_latency is the sum of the latencies of the checks.
+	total_latency time.Duration
+}
+
+// OutageReport is a period during which an endpoint was DOWN.
+type OutageReport struct {
+	Start time.Time `json:"start"`
+
+	// End is when the endpoint left the DOWN state, null when it was still DOWN at the end of the
+	// run, the duration running up to the end of the run.
+	End        *time.Time `json:"end"`
+	DurationMs float64    `json:"duration_ms"`
+
+	// StatusCode, LatencyMs and Error are the status code, latency and error of the check the
+	// endpoint went DOWN with.
+	StatusCode int     `json:"status_code,omitempty"`
+	LatencyMs  float64 `json:"latency_ms,omitempty"`
+	Error      string  `json:"error,omitempty"`
+}
+
+// Start records that the run started at the provided time. Nil recorders are ignored, as are the
+// following methods.
+func (recorder *RunRecorder) Start(at time.Time) {
+	if recorder == nil {
+		return
+	}
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+
+	if recorder.started_at.IsZero() {
+		recorder.started_at = at
+	}
+}
+
+// Observe records the results of a cycle of the endpoints, in the same order, and the state
+// transitions they caused.
+func (recorder *RunRecorder) Observe(results []CheckResult, endpoints *Endpoints, transitions []StateTransition) {
+	if recorder == nil {
+		return
+	}
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+
+	if recorder.index == nil {
+		recorder.index = map[string]*endpointRun{}
+	}
+	recorder.cycles++
+
+	last := map[string]CheckResult{}
+	for i, result := range results {
+		key := result.Endpoint + "\x00" + result.Url
+		run, ok := recorder.index[key]
+		if !ok {
+			run = &endpointRun{report: EndpointReport{Endpoint: result.Endpoint, Url: result.Url, State: StateUnknown}}
+			recorder.index[key] = run
+			recorder.endpoints = append(recorder.endpoints, run)
+		}
+		if endpoints != nil && i < len(*endpoints) && (*endpoints)[i].Domain != nil {
+			run.report.Domain = (*endpoints)[i].Domain.Name
+		}
+
+		report := &run.report
+		report.Checks++
+		report.Abandoned = result.ErrorKind == ErrorKindAbandoned
+		switch result.Status {
+		case StatusUp:
+			report.UpCount++
+		case StatusDegraded:
+			report.DegradedCount++
+		case StatusDown:
+			report.DownCount++
+		default:
+			report.UnknownCount++
+		}
+		if result.Latency > 0 {
+			report.total_latency += result.Latency
+			run.latencies++
+		}
+		last[key] = result
+	}
+
+	for _, transition := range transitions {
+		run, ok := recorder.index[transition.Endpoint+"\x00"+transition.Url]
+		if !ok {
+			continue
+		}
+		report := &run.report
+		report.State = transition.To
+
+		// close the outage in progress, and open one when the endpoint goes DOWN
+		if count := len(report.Outages); count > 0 && report.Outages[count-1].End == nil {
+			end := transition.At
+			report.Outages[count-1].End = &end
+			report.Outages[count-1].DurationMs = latencyMilliseconds(end.Sub(report.Outages[count-1].Start))
+		}
+		if transition.To == StateDown {
+			result := last[transition.Endpoint+"\x00"+transition.Url]
+			report.Outages = append(report.Outages, OutageReport{
+				Start:      transition.At,
+				StatusCode: result.StatusCode,
+				LatencyMs:  latencyMilliseconds(result.Latency),
+				Error:      result.Error,
+			})
+		}
+	}
+}
+
+// Report returns the report of the run finished at the provided time, along with the domains.
+func (recorder *RunRecorder) Report(finished_at time.Time, domains []*DomainEvent) RunReport {
+	report := RunReport{FinishedAt: finished_at, Passed: true, Endpoints: []EndpointReport{}, Domains: domains}
+	if recorder == nil {
+		report.StartedAt = finished_at
+		return report
+	}
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+
+	report.StartedAt = recorder.started_at
+	if report.StartedAt.IsZero() {
+		report.StartedAt = finished_at
+	}
+	report.DurationMs = latencyMilliseconds(finished_at.Sub(report.StartedAt))
+	report.Cycles = recorder.cycles
+
+	for _, run := range recorder.endpoints {
+		endpoint := run.report
+		if conclusive := endpoint.UpCount + endpoint.DegradedCount + endpoint.DownCount; conclusive > 0 {
+			endpoint.Availability = int(math.Round(100 * float64(endpoint.UpCount+endpoint.DegradedCount) / float64(conclusive)))
+		}
+		if run.latencies > 0 {
+			endpoint.AvgLatencyMs = latencyMilliseconds(endpoint.total_latency / time.Duration(run.latencies))
+		}
+
+		// the outage in progress runs up to the end of the run
+		endpoint.Outages = append([]OutageReport(nil), endpoint.Outages...)
+		if count := len(endpoint.Outages); count > 0 && endpoint.Outages[count-1].End == nil {
+			endpoint.Outages[count-1].DurationMs = latencyMilliseconds(finished_at.Sub(endpoint.Outages[count-1].Start))
+		}
+		if len(endpoint.Outages) > 0 && !endpoint.Abandoned {
+			report.Passed = false
+		}
+		report.Endpoints = append(report.Endpoints, endpoint)
+	}
+	return report
+}
+
+// reportFormat returns the format of the report written to path, format if set.
+func reportFormat(path string, format string) string {
+	if format != "" {
+		return format
+	}
+	if strings.EqualFold(filepath.Ext(path), ".xml") {
+		return ReportJUnit
+	}
+	return ReportJSON
+}
+
+// SaveReport is a method for HealthCheckTargets that writes the report of the run to report_file,
+// if set, logging failures.
+func (target *HealthCheckTargets) SaveReport() {
+	path := target.Settings.ReportFile
+	if path == "" {
+		return
+	}
+
+	now := time.Now()
+	report := target.Run.Report(now, target.DomainStatuses(now))
+	if err := WriteRunReport(path, reportFormat(path, target.Settings.ReportFormat), report); err != nil {
+		log.Printf("Failed to write the report to %s: %v", path, err)
+	}
+}
+
+// LogRunReport is a method for HealthCheckTargets that prints the JUnit XML report of the run to
+// the console with the junit output, so CI systems can render the health of the endpoints in their
+// test reports, e.g. from checkhealth -output junit -once config.yaml > health.xml.
+func (target *HealthCheckTargets) LogRunReport() {
+	if target.Settings.Output != OutputJUnit {
+		return
+	}
+
+	now := time.Now()
+	content, err := encodeRunReport(ReportJUnit, target.Run.Report(now, target.DomainStatuses(now)))
+	if err != nil {
+		log.Printf("Failed to write JUnit output: %v", err)
+		return
+	}
+	if _, err := os.Stdout.Write(append(content, '\n')); err != nil {
+		log.Printf("Failed to write JUnit output: %v", err)
+	}
+}
+
+// encodeRunReport returns the report in the format.
+func encodeRunReport(format string, report RunReport) ([]byte, error) {
+	switch format {
+	case ReportJSON:
+		content, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode report: %v", err)
+		}
+		return content, nil
+	case ReportJUnit:
+		content, err := xml.MarshalIndent(junitReport(report), "", "  ")
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode report: %v", err)
+		}
+		return append([]byte(xml.Header), content...), nil
+	}
+	return nil, fmt.Errorf("unsupported report format %q, expected %q or %q", format, ReportJSON, ReportJUnit)
+}
+
+// WriteRunReport atomically writes the report to path in the format, by writing it to a temporary
+// file in the same directory and renaming it, so archivers never see a partial report.
+func WriteRunReport(path string, format string, report RunReport) error {
+	content, err := encodeRunReport(format, report)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create report: %v", err)
+	}
+	defer os.Remove(file.Name())
+
+	if _, err := file.Write(append(content, '\n')); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write report: %v", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to close report: %v", err)
+	}
+	if err := os.Chmod(file.Name(), 0o644); err != nil {
+		return fmt.Errorf("failed to write report: %v", err)
+	}
+	if err := os.Rename(file.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace report: %v", err)
+	}
+	return nil
+}
+
+// junitTestSuites is the root of a JUnit XML report, with a test suite per domain.
+type junitTestSuites struct {
+	XMLName   xml.Name         `xml:"testsuites"`
+	Name      string           `xml:"name,attr"`
+	Tests     int              `xml:"tests,attr"`
+	Failures  int              `xml:"failures,attr"`
+	Skipped   int              `xml:"skipped,attr"`
+	Time      string           `xml:"time,attr"`
+	Timestamp string           `xml:"timestamp,attr"`
+	Suites    []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Skipped   int             `xml:"skipped,attr"`
+	Time      string          `xml:"time,attr"`
+	Timestamp string          `xml:"timestamp,attr"`
+	Cases     []junitTestCase `xml:"testcase"`
+}
+
+// junitTestCase is an endpoint, whose time is the total latency of its checks.
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Skipped   *junitMessage `xml:"skipped,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr,omitempty"`
+	Text    string `xml:",chardata"`
+}
+
+// junitReport returns the JUnit XML report of a run, with a test suite per domain in the order of
+// their endpoints. Endpoints fail when they were DOWN during the run, and are skipped when none of
+// their checks was conclusive or when they were abandoned.
+func junitReport(report RunReport) junitTestSuites {
+	timestamp := report.StartedAt.UTC().Format("2006-01-02T15:04:05")
+	suites := junitTestSuites{
+		Name:      "checkhealth",
+		Time:      junitSeconds(report.DurationMs),
+		Timestamp: timestamp,
+	}
+
+	index := map[string]int{}
+	for _, endpoint := range report.Endpoints {
+		domain := endpoint.Domain
+		if domain == "" {
+			domain = endpoint.Endpoint
+		}
+		i, ok := index[domain]
+		if !ok {
+			i = len(suites.Suites)
+			index[domain] = i
+			suites.Suites = append(suites.Suites, junitTestSuite{Name: domain, Time: junitSeconds(report.DurationMs), Timestamp: timestamp})
+		}
+		suite := &suites.Suites[i]
+
+		test_case := junitTestCase{
+			Name:      endpoint.Endpoint,
+			ClassName: domain,
+			Time:      junitSeconds(latencyMilliseconds(endpoint.total_latency)),
+			SystemOut: fmt.Sprintf("%s: %d checks, %d up, %d degraded, %d down, %d unknown, %d%% availability, %s average latency, %s at the end of the run",
+				endpoint.Url, endpoint.Checks, endpoint.UpCount, endpoint.DegradedCount, endpoint.DownCount, endpoint.UnknownCount, endpoint.Availability,
+				time.Duration(endpoint.AvgLatencyMs*float64(time.Millisecond)).Round(time.Millisecond), endpoint.State),
+		}
+		switch {
+		case endpoint.Abandoned:
+			test_case.Skipped = &junitMessage{Message: "abandoned, its checks are paused"}
+			suite.Skipped++
+			suites.Skipped++
+		case len(endpoint.Outages) > 0:
+			var outages []string
+			for _, outage := range endpoint.Outages {
+				line := fmt.Sprintf("DOWN from %s", outage.Start.UTC().Format(time.RFC3339))
+				if outage.End != nil {
+					line += fmt.Sprintf(" to %s", outage.End.UTC().Format(time.RFC3339))
+				} else {
+					line += " until the end of the run"
+				}
+				details := []string{time.Duration(outage.DurationMs * float64(time.Millisecond)).Round(time.Second).String()}
+				if outage.StatusCode != 0 {
+					details = append(details, fmt.Sprintf("status %d", outage.StatusCode))
+				}
+				if outage.LatencyMs > 0 {
+					details = append(details, fmt.Sprintf("latency %s", time.Duration(outage.LatencyMs*float64(time.Millisecond)).Round(time.Millisecond)))
+				}
+				line += " (" + strings.Join(details, ", ") + ")"
+				if outage.Error != "" {
+					line += ": " + outage.Error
+				}
+				outages = append(outages, line)
+			}
+			message := fmt.Sprintf("%d outages, %d%% availability", len(endpoint.Outages), endpoint.Availability)
+			if len(endpoint.Outages) == 1 {
+				message = fmt.Sprintf("1 outage, %d%% availability", endpoint.Availability)
+			}
+			test_case.Failure = &junitMessage{
+				Message: message,
+				Type:    "outage",
+				Text:    strings.Join(outages, "\n"),
+			}
+			suite.Failures++
+			suites.Failures++
+		case endpoint.UpCount+endpoint.DegradedCount+endpoint.DownCount == 0:
+			test_case.Skipped = &junitMessage{Message: "no conclusive check"}
+			suite.Skipped++
+			suites.Skipped++
+		}
+		suite.Tests++
+		suites.Tests++
+		suite.Cases = append(suite.Cases, test_case)
+	}
+	return suites
+}
+
+// junitSeconds formats milliseconds as the seconds of JUnit XML times.
+func junitSeconds(milliseconds float64) string {
+	return fmt.Sprintf("%.3f", milliseconds/1000)
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-playground/assert/v2"
+)
+
+func TestRunRecorder(t *testing.T) {
+	endpoints := Endpoints{
+		{Name: "index", Url: "https://fetch.com/"},
+		{Name: "careers", Url: "https://fetch.com/careers", Group: "fetch"},
+	}
+	_, err := endpoints.CreateNewTargets()
+	assert.Equal(t, err, nil)
+
+	start := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	recorder := &RunRecorder{}
+	recorder.Start(start)
+	recorder.Observe([]CheckResult{
+		{Endpoint: "index", Url: "https://fetch.com/", Status: StatusUp, Latency: 100 * time.Millisecond},
+		{Endpoint: "careers", Url: "https://fetch.com/careers", Status: StatusDown, StatusCode: 503, Latency: 300 * time.Millisecond, Error: "unexpected status code 503"},
+	}, &endpoints, []StateTransition{
+		{Endpoint: "index", Url: "https://fetch.com/", From: StateUnknown, To: StateUp, At: start},
+		{Endpoint: "careers", Url: "https://fetch.com/careers", From: StateUnknown, To: StateDown, At: start},
+	})
+	recorder.Observe([]CheckResult{
+		{Endpoint: "index", Url: "https://fetch.com/", Status: StatusDegraded, Latency: 200 * time.Millisecond},
+		{Endpoint: "careers", Url: "https://fetch.com/careers", Status: StatusUp, Latency: 100 * time.Millisecond},
+	}, &endpoints, []StateTransition{
+		{Endpoint: "index", Url: "https://fetch.com/", From: StateUp, To: StateDegraded, At: start.Add(time.Minute)},
+		{Endpoint: "careers", Url: "https://fetch.com/careers", From: StateDown, To: StateUp, At: start.Add(time.Minute)},
+	})
+	recorder.Observe([]CheckResult{
+		{Endpoint: "index", Url: "https://fetch.com/", Status: StatusUnknown},
+		{Endpoint: "careers", Url: "https://fetch.com/careers", Status: StatusDown, Error: "connection refused"},
+	}, &endpoints, []StateTransition{
+		{Endpoint: "careers", Url: "https://fetch.com/careers", From: StateUp, To: StateDown, At: start.Add(2 * time.Minute)},
+	})
+
+	report := recorder.Report(start.Add(5*time.Minute), nil)
+	assert.Equal(t, report.StartedAt, start)
+	assert.Equal(t, report.DurationMs, 300000.0)
+	assert.Equal(t, report.Cycles, 3)
+	assert.Equal(t, report.Passed, false)
+	assert.Equal(t, len(report.Endpoints), 2)
+
+	index := report.Endpoints[0]
+	assert.Equal(t, index.Domain, "fetch.com")
+	assert.Equal(t, index.State, StateDegraded)
+	assert.Equal(t, []int{index.Checks, index.UpCount, index.DegradedCount, index.DownCount, index.UnknownCount}, []int{3, 1, 1, 0, 1})
+	assert.Equal(t, index.Availability, 100)
+	assert.Equal(t, index.AvgLatencyMs, 150.0)
+	assert.Equal(t, len(index.Outages), 0)
+
+	// the last outage is still in progress at the end of the run
+	careers := report.Endpoints[1]
+	assert.Equal(t, careers.Domain, "fetch")
+	assert.Equal(t, careers.State, StateDown)
+	assert.Equal(t, careers.Availability, 33)
+	assert.Equal(t, len(careers.Outages), 2)
+	assert.Equal(t, *careers.Outages[0].End, start.Add(time.Minute))
+	assert.Equal(t, careers.Outages[0].DurationMs, 60000.0)
+	assert.Equal(t, careers.Outages[0].Error, "unexpected status code 503")
+	assert.Equal(t, careers.Outages[0].StatusCode, 503)
+	assert.Equal(t, careers.Outages[0].LatencyMs, 300.0)
+	assert.Equal(t, careers.Outages[1].End, (*time.Time)(nil))
+	assert.Equal(t, careers.Outages[1].DurationMs, 180000.0)
+	assert.Equal(t, careers.Outages[1].Error, "connection refused")
+
+	// abandoned endpoints don't fail the run and are skipped in JUnit XML
+	recorder.Observe([]CheckResult{
+		{Endpoint: "index", Url: "https://fetch.com/", Status: StatusUp},
+		{Endpoint: "careers", Url: "https://fetch.com/careers", Status: StatusUnknown, ErrorKind: ErrorKindAbandoned},
+	}, &endpoints, nil)
+	report = recorder.Report(start.Add(6*time.Minute), nil)
+	assert.Equal(t, report.Passed, true)
+	assert.Equal(t, report.Endpoints[1].Abandoned, true)
+	junit := junitReport(report)
+	assert.Equal(t, []int{junit.Failures, junit.Skipped}, []int{0, 1})
+	assert.Equal(t, junit.Suites[1].Cases[0].Skipped, &junitMessage{Message: "abandoned, its checks are paused"})
+
+	// nil recorders report an empty run
+	var disabled *RunRecorder
+	disabled.Start(start)
+	disabled.Observe([]CheckResult{{Endpoint: "index"}}, &endpoints, nil)
+	empty := disabled.Report(start, nil)
+	assert.Equal(t, empty.Passed, true)
+	assert.Equal(t, len(empty.Endpoints), 0)
+}
+
+func TestWriteRunReport(t *testing.T) {
+	start := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	end := start.Add(time.Minute)
+	report := RunReport{
+		StartedAt:  start,
+		FinishedAt: start.Add(10 * time.Minute),
+		DurationMs: 600000,
+		Cycles:     40,
+		Endpoints: []EndpointReport{
+			{Endpoint: "index", Url: "https://fetch.com/", Domain: "fetch.com", State: StateUp, Checks: 40, UpCount: 40, Availability: 100, AvgLatencyMs: 100, total_latency: 4 * time.Second},
+			{Endpoint: "careers", Url: "https://fetch.com/careers", Domain: "fetch.com", State: StateUp, Checks: 40, UpCount: 36, DownCount: 4, Availability: 90, Outages: []OutageReport{
+				{Start: start, End: &end, DurationMs: 60000, StatusCode: 503, LatencyMs: 35.2, Error: "unexpected status code 503"},
+			}},
+			{Endpoint: "dns", Url: "dns://fetch.com", Domain: "dns", State: StateUnknown, Checks: 40, UnknownCount: 40},
+		},
+	}
+	dir := t.TempDir()
+
+	// JSON reports decode to the same report
+	path := filepath.Join(dir, "report.json")
+	assert.Equal(t, WriteRunReport(path, ReportJSON, report), nil)
+	content, err := os.ReadFile(path)
+	assert.Equal(t, err, nil)
+	var decoded RunReport
+	assert.Equal(t, json.Unmarshal(content, &decoded), nil)
+	assert.Equal(t, decoded.Cycles, 40)
+	assert.Equal(t, decoded.Endpoints[1].Outages[0].End.Equal(end), true)
+	assert.Equal(t, decoded.Endpoints[1].Outages[0].Error, "unexpected status code 503")
+
+	// JUnit reports have a test suite per domain, failing the endpoints that were DOWN
+	path = filepath.Join(dir, "report.xml")
+	assert.Equal(t, WriteRunReport(path, ReportJUnit, report), nil)
+	content, err = os.ReadFile(path)
+	assert.Equal(t, err, nil)
+	var suites junitTestSuites
+	assert.Equal(t, xml.Unmarshal(content, &suites), nil)
+	assert.Equal(t, []int{suites.Tests, suites.Failures, suites.Skipped}, []int{3, 1, 1})
+	assert.Equal(t, len(suites.Suites), 2)
+	assert.Equal(t, suites.Suites[0].Name, "fetch.com")
+	assert.Equal(t, suites.Suites[0].Cases[0].Time, "4.000")
+	assert.Equal(t, suites.Suites[0].Cases[0].Failure, (*junitMessage)(nil))
+	assert.Equal(t, suites.Suites[0].Cases[1].Failure.Message, "1 outage, 90% availability")
+	assert.Equal(t, suites.Suites[0].Cases[1].Failure.Text, "DOWN from 2024-06-01T12:00:00Z to 2024-06-01T12:01:00Z (1m0s, status 503, latency 35ms): unexpected status code 503")
+	assert.Equal(t, suites.Suites[0].Cases[0].SystemOut,
+		"https://fetch.com/: 40 checks, 40 up, 0 degraded, 0 down, 0 unknown, 100% availability, 100ms average latency, UP at the end of the run")
+	assert.Equal(t, suites.Suites[1].Cases[0].Skipped.Message, "no conclusive check")
+
+	// no temporary files are left behind
+	temporary, _ := filepath.Glob(filepath.Join(dir, "*.tmp"))
+	assert.Equal(t, len(temporary), 0)
+
+	assert.NotEqual(t, WriteRunReport(filepath.Join(dir, "report.txt"), "text", report), nil)
+	assert.NotEqual(t, WriteRunReport(filepath.Join(dir, "missing", "report.json"), ReportJSON, report), nil)
+}
+
+func TestReportFormat(t *testing.T) {
+	cases := []struct {
+		name     string
+		path     string
+		format   string
+		expected string
+	}{
+		{name: "JSON By Default", path: "report.json", expected: ReportJSON},
+		{name: "No Extension", path: "report", expected: ReportJSON},
+		{name: "JUnit For XML", path: "report.XML", expected: ReportJUnit},
+		{name: "Explicit Format", path: "report.xml", format: ReportJSON, expected: ReportJSON},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, reportFormat(tc.path, tc.format), tc.expected)
+		})
+	}
+}
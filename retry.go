@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Endpoints with retries retry their failed checks within the same cycle before recording a
+// failure, so a transient connection reset on a flaky network doesn't count against their
+// availability. Only transient failures are retried: connection errors, timeouts and 502, 503 and
+// 504 responses. The first retry waits retry_delay, or the delay of the Retry-After header of the
+// response, and every following retry waits twice as long as the previous one. Retries share the
+// timeout of the check, so a retry that wouldn't start before it passes isn't made.
+
+// DefaultRetryDelay is the delay before the first retry of endpoints that don't set retry_delay.
+const DefaultRetryDelay time.Duration = 500 * time.Millisecond
+
+// MaxRetries is the maximum number of retries of a check.
+const MaxRetries int = 10
+
+// validateRetries rejects negative retries and retry delays, and more than MaxRetries retries.
+func (endpoint *Endpoint) validateRetries() error {
+	if endpoint.Retries < 0 || endpoint.RetryDelay < 0 {
+		return errors.New("retries and retry_delay must be positive")
+	}
+	if endpoint.Retries > MaxRetries {
+		return fmt.Errorf("retries must not exceed %d", MaxRetries)
+	}
+	return nil
+}
+
+// retryDelay returns the delay before the first retry of the endpoint's checks.
+func (endpoint *Endpoint) retryDelay() time.Duration {
+	if endpoint.RetryDelay > 0 {
+		return endpoint.RetryDelay
+	}
+	return DefaultRetryDelay
+}
+
+// transient reports whether the result failed for a reason that may not persist, and is worth
+// retrying within the cycle.
+func (result CheckResult) transient() bool {
+	if result.Status != StatusDown {
+		return false
+	}
+	switch result.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return result.ErrorKind == ErrorKindConnection || result.ErrorKind == ErrorKindTimeout
+}
+
+// checkWithRetries checks the endpoint with attempt, retrying transient failures up to the
+// endpoint's retries with an exponential backoff, as long as the retries start before the deadline
+// of ctx. The result of the last attempt is returned with the number of retries made, and with the
+// bytes transferred by every attempt.
+func (endpoint *Endpoint) checkWithRetries(ctx context.Context, attempt func(context.Context) CheckResult) CheckResult {
+	result := attempt(ctx)
+	deadline, _ := ctx.Deadline()
+	delay := endpoint.retryDelay()
+
+	for retry := 1; retry <= endpoint.Retries && result.transient(); retry++ {
+		wait, ok := result.RetryDelay(delay, time.Now(), deadline)
+		if !ok {
+			break
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return result
+		case <-timer.C:
+		}
+
+		previous := result
+		result = attempt(ctx)
+		result.Retries = retry
+		result.BytesSent += previous.BytesSent
+		result.BytesReceived += previous.BytesReceived
+		result.head_rejected = result.head_rejected || previous.head_rejected
+		delay *= 2
+	}
+	return result
+}
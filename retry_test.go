@@ -0,0 +1,134 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-playground/assert/v2"
+)
+
+// flakyServer serves its first failures requests with a reset connection on /reset or the
+// provided status code on other paths, and succeeds afterwards.
+func flakyServer(t *testing.T, failures int, status int) *httptest.Server {
+	var mu sync.Mutex
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests++
+		failing := requests <= failures
+		mu.Unlock()
+
+		switch {
+		case !failing:
+			w.WriteHeader(http.StatusOK)
+		case r.URL.Path == "/reset":
+			conn, _, err := w.(http.Hijacker).Hijack()
+			assert.Equal(t, err, nil)
+			conn.Close()
+		default:
+			w.WriteHeader(status)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestGetEndpointHealthRetries(t *testing.T) {
+	cases := []struct {
+		name            string
+		path            string
+		failures        int
+		status          int
+		retries         int
+		retryDelay      time.Duration
+		expectedStatus  string
+		expectedRetries int
+	}{
+		{
+			name:           "No Retries",
+			path:           "/reset",
+			failures:       1,
+			expectedStatus: StatusDown,
+		},
+		{
+			name:            "Connection Reset Retried",
+			path:            "/reset",
+			failures:        2,
+			retries:         2,
+			expectedStatus:  StatusUp,
+			expectedRetries: 2,
+		},
+		{
+			name:            "Retries Exhausted",
+			path:            "/reset",
+			failures:        3,
+			retries:         2,
+			expectedStatus:  StatusDown,
+			expectedRetries: 2,
+		},
+		{
+			name:            "Service Unavailable Retried",
+			failures:        1,
+			status:          http.StatusServiceUnavailable,
+			retries:         1,
+			expectedStatus:  StatusUp,
+			expectedRetries: 1,
+		},
+		{
+			name:           "Server Error Not Retried",
+			failures:       1,
+			status:         http.StatusInternalServerError,
+			retries:        1,
+			expectedStatus: StatusDown,
+		},
+		{
+			name:           "Retry Beyond The Timeout",
+			path:           "/reset",
+			failures:       1,
+			retries:        1,
+			retryDelay:     time.Second,
+			expectedStatus: StatusDown,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := flakyServer(t, tc.failures, tc.status)
+			retry_delay := tc.retryDelay
+			if retry_delay == 0 {
+				retry_delay = time.Millisecond
+			}
+			endpoints := Endpoints{{Name: "flaky", Url: server.URL + tc.path, Retries: tc.retries, RetryDelay: retry_delay}}
+			_, err := endpoints.CreateNewTargets()
+			assert.Equal(t, err, nil)
+
+			result := endpoints[0].GetEndpointHealth(500 * time.Millisecond)
+			assert.Equal(t, result.Status, tc.expectedStatus)
+			assert.Equal(t, result.Retries, tc.expectedRetries)
+		})
+	}
+}
+
+func TestRetriesSettings(t *testing.T) {
+	cases := []struct {
+		name         string
+		endpoint     Endpoint
+		expectedFail bool
+	}{
+		{name: "Retries", endpoint: Endpoint{Name: "index", Url: "https://fetch.com/", Retries: 3, RetryDelay: time.Second}},
+		{name: "Negative Retries", endpoint: Endpoint{Name: "index", Url: "https://fetch.com/", Retries: -1}, expectedFail: true},
+		{name: "Negative Delay", endpoint: Endpoint{Name: "index", Url: "https://fetch.com/", Retries: 1, RetryDelay: -time.Second}, expectedFail: true},
+		{name: "Too Many Retries", endpoint: Endpoint{Name: "index", Url: "https://fetch.com/", Retries: MaxRetries + 1}, expectedFail: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			config := Config{Endpoints: Endpoints{tc.endpoint}}
+			err := config.ApplySettings()
+			assert.Equal(t, err != nil, tc.expectedFail)
+		})
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// The scheduler keeps track of how faithfully every endpoint is checked on schedule. A check is
+// scheduled every cycle, on time when its cycle starts within ScheduleToleranceRatio of the
+// interval after it was due and the check finishes before the next cycle is due, wherever the
+// endpoint comes in the cycle. It is delayed when the cycle starts later, because the previous one
+// overran its interval, or when the check finishes after the interval, because the endpoint waited
+// for a worker, and skipped when it wasn't made at all, because a whole cycle was missed, the
+// endpoint was backing off after a rate-limited response or the bandwidth cap of its domain was
+// exceeded. The schedule fidelity of the endpoint is the ratio of its scheduled checks that were
+// made on time.
+
+// ScheduleToleranceRatio is the fraction of the interval a cycle may start after it was due and
+// its checks still count as on time.
+const ScheduleToleranceRatio float64 = 0.1
+
+// StarvationChecks is the number of consecutive delayed or skipped checks after which an endpoint
+// is reported as starved.
+const StarvationChecks int = 3
+
+// ScheduleStats counts the scheduled checks of an endpoint that were on time, delayed or skipped.
+type ScheduleStats struct {
+	mu sync.Mutex
+
+	scheduled int
+	on_time   int
+	delayed   int
+	skipped   int
+
+	// last_scheduled is the time the previous cycle was due, to count the cycles missed since.
+	last_scheduled time.Time
+
+	// consecutive_missed counts the delayed or skipped checks since the last one on time.
+	consecutive_missed int
+	starved            bool
+}
+
+// ScheduleSummary is a point in time report of the ScheduleStats of an endpoint.
+type ScheduleSummary struct {
+	Scheduled int `json:"scheduled"`
+	OnTime    int `json:"on_time"`
+	Delayed   int `json:"delayed"`
+	Skipped   int `json:"skipped"`
+
+	// Fidelity is the ratio of the scheduled checks made on time, between 0 and 1.
+	Fidelity float64 `json:"fidelity"`
+
+	// Starved is set while the last StarvationChecks checks or more were delayed or skipped.
+	Starved bool `json:"starved,omitempty"`
+}
+
+// NewScheduleStats creates empty ScheduleStats.
+func NewScheduleStats() *ScheduleStats {
+	return &ScheduleStats{}
+}
+
+// Record accounts for the check of the cycle due at scheduled and started at started, whose result
+// is provided, along with the cycles missed since the previous one. It returns whether the endpoint
+// became starved or stopped being starved.
+func (stats *ScheduleStats) Record(result CheckResult, scheduled time.Time, started time.Time, interval time.Duration) bool {
+	stats.mu.Lock()
+	defer stats.mu.Unlock()
+
+	// cycles missed entirely since the previous one count as skipped checks
+	if !stats.last_scheduled.IsZero() && interval > 0 && scheduled.After(stats.last_scheduled) {
+		missed := int((scheduled.Sub(stats.last_scheduled)+interval/2)/interval) - 1
+		if missed > 0 {
+			stats.scheduled += missed
+			stats.skipped += missed
+			stats.consecutive_missed += missed
+		}
+	}
+	stats.last_scheduled = scheduled
+
+	stats.scheduled++
+	tolerance := time.Duration(float64(interval) * ScheduleToleranceRatio)
+	switch {
+	case result.skipped:
+		stats.skipped++
+		stats.consecutive_missed++
+	case started.Sub(scheduled) > tolerance || result.FinishedAt.Sub(scheduled) > interval:
+		stats.delayed++
+		stats.consecutive_missed++
+	default:
+		stats.on_time++
+		stats.consecutive_missed = 0
+	}
+
+	starved := stats.consecutive_missed >= StarvationChecks
+	changed := starved != stats.starved
+	stats.starved = starved
+	return changed
+}
+
+// Summary returns the ScheduleSummary of the stats, which are empty when stats is nil.
+func (stats *ScheduleStats) Summary() ScheduleSummary {
+	if stats == nil {
+		return ScheduleSummary{}
+	}
+	stats.mu.Lock()
+	defer stats.mu.Unlock()
+
+	summary := ScheduleSummary{
+		Scheduled: stats.scheduled,
+		OnTime:    stats.on_time,
+		Delayed:   stats.delayed,
+		Skipped:   stats.skipped,
+		Starved:   stats.starved,
+	}
+	if stats.scheduled > 0 {
+		summary.Fidelity = float64(stats.on_time) / float64(stats.scheduled)
+	}
+	return summary
+}
+
+// RecordSchedule is a method for HealthCheckTargets that accounts for the results of the cycle due
+// at scheduled and started at started in the ScheduleStats of their endpoints, logging the
+// endpoints that become starved or recover.
+func (target *HealthCheckTargets) RecordSchedule(results []CheckResult, scheduled time.Time, started time.Time, interval time.Duration) {
+	for i, result := range results {
+		if i >= len(*target.Endpoints) {
+			break
+		}
+		// abandoned endpoints aren't scheduled anymore
+		if result.ErrorKind == ErrorKindAbandoned {
+			continue
+		}
+		endpoint := &(*target.Endpoints)[i]
+		if endpoint.Schedule == nil || !endpoint.Schedule.Record(result, scheduled, started, interval) {
+			continue
+		}
+
+		summary := endpoint.Schedule.Summary()
+		if summary.Starved {
+			log.Printf("WARNING: %s is starved, its last %d checks were delayed or skipped, schedule fidelity %.0f%%", endpoint.Name, StarvationChecks, summary.Fidelity*100)
+		} else {
+			log.Printf("%s is checked on schedule again", endpoint.Name)
+		}
+	}
+}
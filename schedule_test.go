@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-playground/assert/v2"
+)
+
+func TestScheduleStatsRecord(t *testing.T) {
+	interval := 10 * time.Second
+	base := time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		name            string
+		scheduled       time.Duration
+		started         time.Duration
+		finished        time.Duration
+		skipped         bool
+		expectedSummary ScheduleSummary
+		expectedChanged bool
+	}{
+		{
+			name:            "On Time",
+			scheduled:       0,
+			started:         500 * time.Millisecond,
+			finished:        time.Second,
+			expectedSummary: ScheduleSummary{Scheduled: 1, OnTime: 1, Fidelity: 1},
+		},
+		{
+			name:            "Delayed By An Overrun",
+			scheduled:       10 * time.Second,
+			started:         14 * time.Second,
+			finished:        15 * time.Second,
+			expectedSummary: ScheduleSummary{Scheduled: 2, OnTime: 1, Delayed: 1, Fidelity: 0.5},
+		},
+		{
+			name:            "Backing Off",
+			scheduled:       20 * time.Second,
+			started:         20 * time.Second,
+			finished:        20 * time.Second,
+			skipped:         true,
+			expectedSummary: ScheduleSummary{Scheduled: 3, OnTime: 1, Delayed: 1, Skipped: 1, Fidelity: 1.0 / 3},
+		},
+		{
+			name:            "Missed Cycle",
+			scheduled:       40 * time.Second,
+			started:         40 * time.Second,
+			finished:        41 * time.Second,
+			expectedSummary: ScheduleSummary{Scheduled: 5, OnTime: 2, Delayed: 1, Skipped: 2, Fidelity: 0.4},
+		},
+		{
+			name:            "Waited For A Worker",
+			scheduled:       50 * time.Second,
+			started:         50 * time.Second,
+			finished:        61 * time.Second,
+			expectedSummary: ScheduleSummary{Scheduled: 6, OnTime: 2, Delayed: 2, Skipped: 2, Fidelity: 1.0 / 3},
+		},
+	}
+
+	stats := NewScheduleStats()
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			// the check is the only one of its cycle
+			result := CheckResult{StartedAt: base.Add(tc.started), FinishedAt: base.Add(tc.finished), skipped: tc.skipped}
+			changed := stats.Record(result, base.Add(tc.scheduled), base.Add(tc.started), interval)
+			assert.Equal(t, changed, tc.expectedChanged)
+			assert.Equal(t, stats.Summary(), tc.expectedSummary)
+		})
+	}
+}
+
+func TestScheduleStarvation(t *testing.T) {
+	interval := 10 * time.Second
+	base := time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+	stats := NewScheduleStats()
+
+	// every cycle starts late, the endpoint is starved after StarvationChecks of them
+	for i := 0; i < StarvationChecks; i++ {
+		scheduled := base.Add(time.Duration(i) * interval)
+		started := scheduled.Add(5 * time.Second)
+		changed := stats.Record(CheckResult{StartedAt: started, FinishedAt: started}, scheduled, started, interval)
+		assert.Equal(t, changed, i == StarvationChecks-1)
+	}
+	assert.Equal(t, stats.Summary().Starved, true)
+
+	// a check on time ends the starvation
+	scheduled := base.Add(time.Duration(StarvationChecks) * interval)
+	assert.Equal(t, stats.Record(CheckResult{StartedAt: scheduled, FinishedAt: scheduled}, scheduled, scheduled, interval), true)
+	assert.Equal(t, stats.Summary().Starved, false)
+
+	// stats of endpoints that were never scheduled are empty
+	var empty *ScheduleStats
+	assert.Equal(t, empty.Summary(), ScheduleSummary{})
+}
+
+func TestRecordSchedule(t *testing.T) {
+	endpoints := Endpoints{
+		{Name: "index", Url: "https://fetch.com/"},
+		{Name: "careers", Url: "https://fetch.com/careers"},
+	}
+	targets, err := endpoints.CreateNewTargets()
+	assert.Equal(t, err, nil)
+
+	interval := 10 * time.Second
+	scheduled := time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+	// careers waited for a worker past the interval
+	targets.RecordSchedule([]CheckResult{
+		{Endpoint: "index", StartedAt: scheduled, FinishedAt: scheduled.Add(time.Second)},
+		{Endpoint: "careers", StartedAt: scheduled.Add(9 * time.Second), FinishedAt: scheduled.Add(11 * time.Second)},
+	}, scheduled, scheduled, interval)
+
+	states := targets.EndpointStates()
+	assert.Equal(t, *states[0].Schedule, ScheduleSummary{Scheduled: 1, OnTime: 1, Fidelity: 1})
+	assert.Equal(t, *states[1].Schedule, ScheduleSummary{Scheduled: 1, Delayed: 1})
+
+	var output strings.Builder
+	targets.WriteMetrics(&output)
+	metrics := output.String()
+	assert.Equal(t, strings.Contains(metrics, `checkhealth_endpoint_schedule_fidelity_ratio{endpoint="index",url="https://fetch.com/"} 1`+"\n"), true)
+	assert.Equal(t, strings.Contains(metrics, `checkhealth_endpoint_checks_delayed_total{endpoint="careers",url="https://fetch.com/careers"} 1`+"\n"), true)
+}
+
+func TestRecordScheduleSerialCycle(t *testing.T) {
+	var endpoints Endpoints
+	for i := 0; i < 5; i++ {
+		endpoints = append(endpoints, Endpoint{Name: fmt.Sprintf("page %d", i), Url: fmt.Sprintf("https://fetch.com/%d", i)})
+	}
+	targets, err := endpoints.CreateNewTargets()
+	assert.Equal(t, err, nil)
+
+	var output bytes.Buffer
+	log.SetOutput(&output)
+	defer log.SetOutput(os.Stderr)
+
+	// the endpoints are checked in series, 2 seconds each, the last ones starting well into the
+	// cycle, which still finishes within the interval
+	interval := 15 * time.Second
+	base := time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+	for cycle := 0; cycle < 2*StarvationChecks; cycle++ {
+		scheduled := base.Add(time.Duration(cycle) * interval)
+		started := scheduled.Add(100 * time.Millisecond)
+		results := make([]CheckResult, len(endpoints))
+		for i := range results {
+			results[i] = CheckResult{Endpoint: endpoints[i].Name, StartedAt: started.Add(time.Duration(i) * 2 * time.Second)}
+			results[i].FinishedAt = results[i].StartedAt.Add(2 * time.Second)
+		}
+		targets.RecordSchedule(results, scheduled, started, interval)
+	}
+
+	assert.Equal(t, strings.Contains(output.String(), "starved"), false)
+	for _, state := range targets.EndpointStates() {
+		assert.Equal(t, *state.Schedule, ScheduleSummary{Scheduled: 2 * StarvationChecks, OnTime: 2 * StarvationChecks, Fidelity: 1})
+	}
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// StalledCycles is the number of intervals without any cycle starting or finishing after which the
+// check loop is considered stalled, e.g. because a check hangs, failing /healthz.
+const StalledCycles int = 3
+
+// LoopStarting, LoopRunning, LoopStalled and LoopStopped are the states of the check loop reported
+// on /healthz and /readyz.
+const (
+	LoopStarting string = "starting"
+	LoopRunning  string = "running"
+	LoopStalled  string = "stalled"
+	LoopStopped  string = "stopped"
+)
+
+// CheckLoop tracks the cycles of RunCheckHealth, so CheckHealth itself can be monitored, e.g. as a
+// Kubernetes pod, through /healthz and /readyz. It is safe for concurrent use.
+type CheckLoop struct {
+	mu             sync.Mutex
+	clock          Clock
+	interval       time.Duration
+	running        bool
+	stopped        bool
+	cycles         int
+	cycle_started  time.Time
+	cycle_finished time.Time
+}
+
+// LoopStatus is a point in time report of the check loop, as served on /healthz and /readyz.
+type LoopStatus struct {
+	Status string `json:"status"`
+
+	// Ready is whether a cycle completed and the loop isn't stalled.
+	Ready bool `json:"ready"`
+
+	// Cycles is the number of completed cycles.
+	Cycles              int        `json:"cycles"`
+	LastCycleStarted    *time.Time `json:"last_cycle_started,omitempty"`
+	LastCycleFinished   *time.Time `json:"last_cycle_finished,omitempty"`
+	LastCycleDurationMs float64    `json:"last_cycle_duration_ms,omitempty"`
+
+	// Integrations are the circuit breakers of the sinks and notifiers, see IntegrationHealth.
+	Integrations []BreakerStatus `json:"integrations,omitempty"`
+}
+
+// Start records that the check loop started checking every interval on clock. Nil loops are
+// ignored, as are the following methods.
+func (loop *CheckLoop) Start(clock Clock, interval time.Duration) {
+	if loop == nil {
+		return
+	}
+	loop.mu.Lock()
+	defer loop.mu.Unlock()
+
+	loop.clock, loop.interval = clock, interval
+	loop.running, loop.stopped = true, false
+}
+
+// CycleStarted records that a cycle started at the provided time.
+func (loop *CheckLoop) CycleStarted(at time.Time) {
+	if loop == nil {
+		return
+	}
+	loop.mu.Lock()
+	defer loop.mu.Unlock()
+
+	loop.cycle_started = at
+}
+
+// CycleFinished records that the cycle in progress completed at the provided time.
+func (loop *CheckLoop) CycleFinished(at time.Time) {
+	if loop == nil {
+		return
+	}
+	loop.mu.Lock()
+	defer loop.mu.Unlock()
+
+	loop.cycles++
+	loop.cycle_finished = at
+}
+
+// Stop records that the check loop returned.
+func (loop *CheckLoop) Stop() {
+	if loop == nil {
+		return
+	}
+	loop.mu.Lock()
+	defer loop.mu.Unlock()
+
+	loop.running, loop.stopped = false, true
+}
+
+// Status returns a report of the check loop. The loop is stalled when neither a cycle started nor
+// one finished for StalledCycles intervals, and ready once a cycle completed unless it is stalled
+// or stopped.
+func (loop *CheckLoop) Status() LoopStatus {
+	if loop == nil {
+		return LoopStatus{Status: LoopStarting}
+	}
+	loop.mu.Lock()
+	defer loop.mu.Unlock()
+
+	status := LoopStatus{Status: LoopStarting, Cycles: loop.cycles}
+	if !loop.cycle_started.IsZero() {
+		cycle_started := loop.cycle_started
+		status.LastCycleStarted = &cycle_started
+	}
+	if !loop.cycle_finished.IsZero() {
+		cycle_finished := loop.cycle_finished
+		status.LastCycleFinished = &cycle_finished
+	}
+	if loop.cycles > 0 && !loop.cycle_finished.Before(loop.cycle_started) {
+		status.LastCycleDurationMs = latencyMilliseconds(loop.cycle_finished.Sub(loop.cycle_started))
+	}
+
+	switch {
+	case loop.stopped:
+		status.Status = LoopStopped
+	case loop.running:
+		last_activity := loop.cycle_started
+		if loop.cycle_finished.After(last_activity) {
+			last_activity = loop.cycle_finished
+		}
+		status.Status = LoopRunning
+		if !last_activity.IsZero() && loop.clock.Now().Sub(last_activity) > time.Duration(StalledCycles)*loop.interval {
+			status.Status = LoopStalled
+		}
+	}
+	status.Ready = status.Status == LoopRunning && loop.cycles > 0
+	return status
+}
+
+// HealthzHandler is a method for HealthCheckTargets that returns an http.Handler answering the
+// liveness probe of the check loop: 200 unless the loop is stalled or stopped, with the
+// LoopStatus as JSON. The circuit breakers of the integrations are reported, but open breakers
+// don't fail the probe, as the endpoints are still checked.
+func (target *HealthCheckTargets) HealthzHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		status := target.Loop.Status()
+		status.Integrations = target.IntegrationHealth()
+		code := http.StatusOK
+		if status.Status == LoopStalled || status.Status == LoopStopped {
+			code = http.StatusServiceUnavailable
+		}
+		writeLoopStatus(w, code, status)
+	})
+}
+
+// ReadyzHandler is a method for HealthCheckTargets that returns an http.Handler answering the
+// readiness probe of the check loop: 200 once a cycle completed and the loop is running, with the
+// LoopStatus as JSON, including the circuit breakers of the integrations like HealthzHandler.
+func (target *HealthCheckTargets) ReadyzHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		status := target.Loop.Status()
+		status.Integrations = target.IntegrationHealth()
+		code := http.StatusOK
+		if !status.Ready {
+			code = http.StatusServiceUnavailable
+		}
+		writeLoopStatus(w, code, status)
+	})
+}
+
+// writeLoopStatus writes the status of the check loop as JSON with the status code.
+func writeLoopStatus(w http.ResponseWriter, code int, status LoopStatus) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(status); err != nil {
+		log.Printf("Failed to write the check loop status: %v", err)
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-playground/assert/v2"
+)
+
+func TestCheckLoopStatus(t *testing.T) {
+	base := time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+	clock := newFakeClock(base)
+	loop := &CheckLoop{}
+
+	cases := []struct {
+		name          string
+		step          func()
+		expected      string
+		expectedReady bool
+	}{
+		{name: "Not Started", step: func() {}, expected: LoopStarting},
+		{name: "First Cycle In Progress", step: func() {
+			loop.Start(clock, 15*time.Second)
+			loop.CycleStarted(clock.Now())
+		}, expected: LoopRunning},
+		{name: "First Cycle Completed", step: func() {
+			clock.Advance(2 * time.Second)
+			loop.CycleFinished(clock.Now())
+		}, expected: LoopRunning, expectedReady: true},
+		{name: "Waiting For Next Cycle", step: func() {
+			clock.Advance(40 * time.Second)
+		}, expected: LoopRunning, expectedReady: true},
+		{name: "Stalled Cycle", step: func() {
+			loop.CycleStarted(clock.Now())
+			clock.Advance(46 * time.Second)
+		}, expected: LoopStalled},
+		{name: "Recovered", step: func() {
+			loop.CycleFinished(clock.Now())
+		}, expected: LoopRunning, expectedReady: true},
+		{name: "Stopped", step: loop.Stop, expected: LoopStopped},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.step()
+			status := loop.Status()
+			assert.Equal(t, status.Status, tc.expected)
+			assert.Equal(t, status.Ready, tc.expectedReady)
+			assert.Equal(t, status.LastCycleStarted == nil, tc.expected == LoopStarting)
+		})
+	}
+
+	status := loop.Status()
+	assert.Equal(t, status.Cycles, 2)
+	assert.Equal(t, status.LastCycleDurationMs, float64(46000))
+
+	// targets that aren't tracked are starting
+	var untracked *CheckLoop
+	assert.Equal(t, untracked.Status(), LoopStatus{Status: LoopStarting})
+}
+
+func TestHealthzReadyzHandlers(t *testing.T) {
+	endpoints := Endpoints{{Name: "index", Url: "https://example.com/"}}
+	targets, err := endpoints.CreateNewTargets()
+	assert.Equal(t, err, nil)
+	clock := newFakeClock(time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC))
+
+	probe := func(handler http.Handler) (int, LoopStatus) {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+		assert.Equal(t, recorder.Header().Get("Content-Type"), "application/json")
+		var status LoopStatus
+		assert.Equal(t, json.Unmarshal(recorder.Body.Bytes(), &status), nil)
+		return recorder.Code, status
+	}
+
+	// alive but not ready until a cycle completed
+	code, status := probe(targets.HealthzHandler())
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, status.Status, LoopStarting)
+	code, _ = probe(targets.ReadyzHandler())
+	assert.Equal(t, code, http.StatusServiceUnavailable)
+
+	targets.Loop.Start(clock, 15*time.Second)
+	targets.Loop.CycleStarted(clock.Now())
+	targets.Loop.CycleFinished(clock.Now())
+	code, _ = probe(targets.HealthzHandler())
+	assert.Equal(t, code, http.StatusOK)
+	code, status = probe(targets.ReadyzHandler())
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, status.Cycles, 1)
+
+	// a stalled loop is neither alive nor ready
+	clock.Advance(time.Minute)
+	code, status = probe(targets.HealthzHandler())
+	assert.Equal(t, code, http.StatusServiceUnavailable)
+	assert.Equal(t, status.Status, LoopStalled)
+	code, _ = probe(targets.ReadyzHandler())
+	assert.Equal(t, code, http.StatusServiceUnavailable)
+}
@@ -0,0 +1,362 @@
+//go:build !nossh
+// +build !nossh
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// SFTP endpoints log in to the server of their sftp://user@host[:port] URL with the SSH options of
+// SSH endpoints, and optionally list a directory or stat a file, within the latency budget of the
+// check. The names listed are evaluated as the body by the body assertions.
+
+// sftpVersion is the version of the SFTP protocol spoken by the checker, the one implemented by
+// OpenSSH.
+const sftpVersion uint32 = 3
+
+// SFTP packet types and status codes used by the checker.
+const (
+	sftpInit         byte = 1
+	sftpVersionReply byte = 2
+	sftpClose        byte = 4
+	sftpOpendir      byte = 11
+	sftpReaddir      byte = 12
+	sftpStat         byte = 17
+	sftpStatus       byte = 101
+	sftpHandle       byte = 102
+	sftpName         byte = 104
+	sftpAttrs        byte = 105
+
+	sftpStatusEOF uint32 = 1
+)
+
+// sftpMaxPacket bounds the size of the packets read from the server.
+const sftpMaxPacket uint32 = 256 * 1024
+
+// validateSFTP rejects SFTP endpoints which set a success predicate, or whose SSH options are
+// invalid.
+func (endpoint *Endpoint) validateSFTP() error {
+	if endpoint.SuccessWhen != "" {
+		return errors.New("success_when isn't supported by sftp endpoints")
+	}
+	_, _, err := endpoint.sshConfig()
+	return err
+}
+
+// runSFTPCheck logs in to the SFTP endpoint, stats its StatFile and lists its ListDirectory when
+// set, and returns its result. The whole session is bounded by the deadline of ctx.
+func (endpoint *Endpoint) runSFTPCheck(ctx context.Context) CheckResult {
+	result := CheckResult{Status: StatusUp}
+
+	address, config, err := endpoint.sshConfig()
+	if err != nil {
+		result.fail(StatusDown, ErrorKindConnection, err)
+		return result
+	}
+
+	body_regex, err := endpoint.bodyRegex()
+	if err != nil {
+		result.fail(StatusDown, ErrorKindBody, fmt.Errorf("failed to compile expect_body_regex: %w", err))
+		return result
+	}
+
+	start := time.Now()
+	client, err := dialSSH(ctx, address, config, &result)
+	if err != nil {
+		result.Latency = time.Since(start)
+		result.fail(StatusDown, sshErrorKind(ctx, err), err)
+		return result
+	}
+	defer client.Close()
+
+	listing, err := runSFTPSession(client, endpoint.StatFile, endpoint.ListDirectory, endpoint.maxBodySize())
+	result.Latency = time.Since(start)
+	if err != nil {
+		var reply_err ftpError
+		if errors.As(err, &reply_err) {
+			result.fail(StatusDown, reply_err.kind, err)
+		} else {
+			result.fail(StatusDown, sshErrorKind(ctx, err), err)
+		}
+		return result
+	}
+
+	if err := endpoint.checkBody(listing, body_regex); err != nil {
+		result.fail(StatusDown, ErrorKindBody, err)
+		return result
+	}
+
+	return result
+}
+
+// runSFTPSession starts the sftp subsystem in a new session of client, stats stat_file and lists
+// list_directory when set. It returns the names listed, one per line, up to limit bytes.
+func runSFTPSession(client *ssh.Client, stat_file string, list_directory string, limit int64) ([]byte, error) {
+	session, err := client.NewSession()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open SSH session: %v", err)
+	}
+	defer session.Close()
+
+	writer, err := session.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	reader, err := session.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := session.RequestSubsystem("sftp"); err != nil {
+		return nil, ftpError{kind: ErrorKindLogin, err: fmt.Errorf("failed to start the sftp subsystem: %v", err)}
+	}
+
+	conn := &sftpConn{writer: writer, reader: reader}
+	if err := conn.send(sftpInit, sftpUint32(sftpVersion)); err != nil {
+		return nil, err
+	}
+	if packet_type, _, err := conn.receive(); err != nil {
+		return nil, err
+	} else if packet_type != sftpVersionReply {
+		return nil, fmt.Errorf("unexpected SFTP packet %d, expected a version", packet_type)
+	}
+
+	if stat_file != "" {
+		if _, err := conn.request(sftpStat, sftpAttrs, sftpString(stat_file)); err != nil {
+			return nil, sftpFileError(fmt.Sprintf("failed to stat %s", stat_file), err)
+		}
+	}
+
+	var listing bytes.Buffer
+	if list_directory != "" {
+		handle, err := conn.request(sftpOpendir, sftpHandle, sftpString(list_directory))
+		if err != nil {
+			return nil, sftpFileError(fmt.Sprintf("failed to open %s", list_directory), err)
+		}
+		handle_value, _, err := sftpParseString(handle)
+		if err != nil {
+			return nil, err
+		}
+
+		for int64(listing.Len()) < limit {
+			names, err := conn.request(sftpReaddir, sftpName, sftpString(handle_value))
+			var status sftpStatusError
+			if errors.As(err, &status) && status.code == sftpStatusEOF {
+				break
+			}
+			if err != nil {
+				return nil, sftpFileError(fmt.Sprintf("failed to list %s", list_directory), err)
+			}
+			if err := sftpParseNames(names, &listing); err != nil {
+				return nil, err
+			}
+		}
+		conn.request(sftpClose, sftpStatus, sftpString(handle_value))
+	}
+
+	content := listing.Bytes()
+	if int64(len(content)) > limit {
+		content = content[:limit]
+	}
+	return content, nil
+}
+
+// sftpFileError wraps an error of a request on a file with message. Status responses of the server
+// are classified as ErrorKindFile, and connection errors are left to ErrorKind.
+func sftpFileError(message string, err error) error {
+	var status sftpStatusError
+	if errors.As(err, &status) {
+		return ftpError{kind: ErrorKindFile, err: fmt.Errorf("%s: %v", message, err)}
+	}
+	return fmt.Errorf("%s: %w", message, err)
+}
+
+// sftpConn exchanges SFTP packets over the standard input and output of the sftp subsystem.
+type sftpConn struct {
+	writer io.Writer
+	reader io.Reader
+	id     uint32
+}
+
+// sftpStatusError is a status response of the server, reporting a failed request.
+type sftpStatusError struct {
+	code    uint32
+	message string
+}
+
+func (err sftpStatusError) Error() string {
+	if err.message == "" {
+		return fmt.Sprintf("SFTP status %d", err.code)
+	}
+	return fmt.Sprintf("SFTP status %d: %s", err.code, err.message)
+}
+
+// send writes a packet of packet_type with payload.
+func (conn *sftpConn) send(packet_type byte, payload []byte) error {
+	packet := make([]byte, 5, 5+len(payload))
+	binary.BigEndian.PutUint32(packet, uint32(1+len(payload)))
+	packet[4] = packet_type
+	_, err := conn.writer.Write(append(packet, payload...))
+	return err
+}
+
+// receive reads a packet, returning its type and payload.
+func (conn *sftpConn) receive() (byte, []byte, error) {
+	var header [5]byte
+	if _, err := io.ReadFull(conn.reader, header[:]); err != nil {
+		return 0, nil, fmt.Errorf("failed to read SFTP packet: %w", err)
+	}
+	length := binary.BigEndian.Uint32(header[:4])
+	if length < 1 || length > sftpMaxPacket {
+		return 0, nil, fmt.Errorf("invalid SFTP packet length %d", length)
+	}
+	payload := make([]byte, length-1)
+	if _, err := io.ReadFull(conn.reader, payload); err != nil {
+		return 0, nil, fmt.Errorf("failed to read SFTP packet: %w", err)
+	}
+	return header[4], payload, nil
+}
+
+// request sends a request of packet_type with payload and returns the payload of its response,
+// after its request id. Status responses are returned as a sftpStatusError, unless a status is the
+// expected response type and reports success.
+func (conn *sftpConn) request(packet_type byte, response_type byte, payload []byte) ([]byte, error) {
+	conn.id++
+	if err := conn.send(packet_type, append(sftpUint32(conn.id), payload...)); err != nil {
+		return nil, err
+	}
+
+	received_type, response, err := conn.receive()
+	if err != nil {
+		return nil, err
+	}
+	if len(response) < 4 || binary.BigEndian.Uint32(response) != conn.id {
+		return nil, fmt.Errorf("unexpected SFTP response to request %d", conn.id)
+	}
+	response = response[4:]
+
+	if received_type == sftpStatus {
+		if len(response) < 4 {
+			return nil, errors.New("invalid SFTP status")
+		}
+		status := sftpStatusError{code: binary.BigEndian.Uint32(response)}
+		status.message, _, _ = sftpParseString(response[4:])
+		if status.code == 0 && response_type == sftpStatus {
+			return nil, nil
+		}
+		return nil, status
+	}
+	if received_type != response_type {
+		return nil, fmt.Errorf("unexpected SFTP packet %d, expected %d", received_type, response_type)
+	}
+	return response, nil
+}
+
+// sftpUint32 encodes value as an SFTP uint32.
+func sftpUint32(value uint32) []byte {
+	encoded := make([]byte, 4)
+	binary.BigEndian.PutUint32(encoded, value)
+	return encoded
+}
+
+// sftpString encodes value as an SFTP string.
+func sftpString(value string) []byte {
+	return append(sftpUint32(uint32(len(value))), value...)
+}
+
+// sftpParseString decodes an SFTP string from data, returning it and the rest of data.
+func sftpParseString(data []byte) (string, []byte, error) {
+	if len(data) < 4 {
+		return "", nil, errors.New("invalid SFTP string")
+	}
+	length := binary.BigEndian.Uint32(data)
+	if uint64(len(data)-4) < uint64(length) {
+		return "", nil, errors.New("invalid SFTP string")
+	}
+	return string(data[4 : 4+length]), data[4+length:], nil
+}
+
+// sftpParseNames writes the file names of a name response to listing, one per line, skipping the
+// . and .. entries.
+func sftpParseNames(data []byte, listing *bytes.Buffer) error {
+	if len(data) < 4 {
+		return errors.New("invalid SFTP name response")
+	}
+	count := binary.BigEndian.Uint32(data)
+	data = data[4:]
+
+	for i := uint32(0); i < count; i++ {
+		name, rest, err := sftpParseString(data)
+		if err != nil {
+			return err
+		}
+		// the long name isn't used
+		_, rest, err = sftpParseString(rest)
+		if err != nil {
+			return err
+		}
+		data, err = sftpSkipAttrs(rest)
+		if err != nil {
+			return err
+		}
+		if name != "." && name != ".." {
+			listing.WriteString(name)
+			listing.WriteByte('\n')
+		}
+	}
+	return nil
+}
+
+// sftpSkipAttrs returns the rest of data following the file attributes at its start.
+func sftpSkipAttrs(data []byte) ([]byte, error) {
+	if len(data) < 4 {
+		return nil, errors.New("invalid SFTP attributes")
+	}
+	flags := binary.BigEndian.Uint32(data)
+	data = data[4:]
+
+	// size, uid and gid, permissions, and access and modification times
+	size := 0
+	for _, field := range []struct {
+		flag uint32
+		size int
+	}{{0x1, 8}, {0x2, 8}, {0x4, 4}, {0x8, 8}} {
+		if flags&field.flag != 0 {
+			size += field.size
+		}
+	}
+	if len(data) < size {
+		return nil, errors.New("invalid SFTP attributes")
+	}
+	data = data[size:]
+
+	if flags&0x80000000 != 0 {
+		if len(data) < 4 {
+			return nil, errors.New("invalid SFTP attributes")
+		}
+		count := binary.BigEndian.Uint32(data)
+		data = data[4:]
+		for i := uint32(0); i < 2*count; i++ {
+			var err error
+			if _, data, err = sftpParseString(data); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return data, nil
+}
+
+func init() {
+	RegisterCheckType(EndpointTypeSFTP, CheckType{
+		Validate: (*Endpoint).validateSFTP,
+		Check:    (*Endpoint).runSFTPCheck,
+	})
+}
@@ -0,0 +1,124 @@
+//go:build !nossh
+// +build !nossh
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/go-playground/assert/v2"
+)
+
+// serveSFTPTest is a minimal SFTP server serving the file /data/report.csv in the directory /data.
+func serveSFTPTest(channel io.ReadWriter) {
+	conn := &sftpConn{writer: channel, reader: channel}
+	status := func(id []byte, code uint32, message string) {
+		conn.send(sftpStatus, append(append(append([]byte{}, id...), sftpUint32(code)...), append(sftpString(message), sftpString("")...)...))
+	}
+	listed := false
+
+	for {
+		packet_type, payload, err := conn.receive()
+		if err != nil {
+			return
+		}
+		if packet_type == sftpInit {
+			conn.send(sftpVersionReply, sftpUint32(sftpVersion))
+			continue
+		}
+		id := payload[:4]
+		argument, _, _ := sftpParseString(payload[4:])
+
+		switch {
+		case packet_type == sftpStat && (argument == "/data" || argument == "/data/report.csv"):
+			conn.send(sftpAttrs, append(append([]byte{}, id...), sftpUint32(0)...))
+		case packet_type == sftpOpendir && argument == "/data":
+			conn.send(sftpHandle, append(append([]byte{}, id...), sftpString("handle-1")...))
+		case packet_type == sftpReaddir && !listed:
+			listed = true
+			var names bytes.Buffer
+			names.Write(id)
+			names.Write(sftpUint32(3))
+			for _, name := range []string{".", "..", "report.csv"} {
+				names.Write(sftpString(name))
+				names.Write(sftpString("-rw-r--r-- 1 monitor monitor 42 " + name))
+				// size and extended attributes
+				names.Write(sftpUint32(0x80000001))
+				binary.Write(&names, binary.BigEndian, uint64(42))
+				names.Write(sftpUint32(1))
+				names.Write(sftpString("key"))
+				names.Write(sftpString("value"))
+			}
+			conn.send(sftpName, names.Bytes())
+		case packet_type == sftpReaddir:
+			status(id, sftpStatusEOF, "end of directory")
+		case packet_type == sftpClose:
+			status(id, 0, "")
+		default:
+			status(id, 2, "no such file")
+		}
+	}
+}
+
+func TestRunSFTPCheck(t *testing.T) {
+	server := newSSHTestServer(t)
+	url := "sftp://monitor@" + server.address
+
+	cases := []struct {
+		name              string
+		endpoint          Endpoint
+		expectedStatus    string
+		expectedErrorKind string
+	}{
+		{
+			name:           "Login",
+			endpoint:       Endpoint{Url: url},
+			expectedStatus: StatusUp,
+		},
+		{
+			name:           "Stat File",
+			endpoint:       Endpoint{Url: url, StatFile: "/data/report.csv"},
+			expectedStatus: StatusUp,
+		},
+		{
+			name:              "Missing File",
+			endpoint:          Endpoint{Url: url, StatFile: "/data/missing.csv"},
+			expectedStatus:    StatusDown,
+			expectedErrorKind: ErrorKindFile,
+		},
+		{
+			name:           "List Directory",
+			endpoint:       Endpoint{Url: url, ListDirectory: "/data", ExpectBodyRegex: "^report.csv\n$"},
+			expectedStatus: StatusUp,
+		},
+		{
+			name:              "Missing Directory",
+			endpoint:          Endpoint{Url: url, ListDirectory: "/private"},
+			expectedStatus:    StatusDown,
+			expectedErrorKind: ErrorKindFile,
+		},
+		{
+			name:              "Unknown User",
+			endpoint:          Endpoint{Url: "sftp://intruder@" + server.address},
+			expectedStatus:    StatusDown,
+			expectedErrorKind: ErrorKindConnection,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.endpoint.Name = tc.name
+			tc.endpoint.Type = EndpointTypeSFTP
+			tc.endpoint.SSHKeyFile = server.key_file
+			tc.endpoint.SSHKnownHosts = server.known_hosts
+
+			result := tc.endpoint.GetEndpointHealth(2 * time.Second)
+			assert.Equal(t, result.Status, tc.expectedStatus)
+			assert.Equal(t, result.ErrorKind, tc.expectedErrorKind)
+		})
+	}
+}
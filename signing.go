@@ -0,0 +1,228 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+// VerifyUsage provides help text for the verify subcommand.
+const VerifyUsage string = `
+USAGE: checkhealth verify -key public_key [file ...]
+
+	Verifies the ed25519 signatures of JSON events written by the json output mode or the file
+	sink when signing_key is configured. Events are read from the provided files, or from
+	standard input when no file is provided. The command fails if any event is unsigned or its
+	signature doesn't match.
+
+FLAGS:
+
+	-key public_key
+		The path of the PEM encoded ed25519 public key matching the signing key.
+`
+
+// ErrEventUnsigned is returned when verifying an event that doesn't carry a signature.
+var ErrEventUnsigned = errors.New("event is not signed")
+
+// ErrEventSignature is returned when an event's signature doesn't match its content or key.
+var ErrEventSignature = errors.New("event signature is invalid")
+
+// signature_marker precedes the signature of a signed event. Signature is the last field of an
+// Event, so a signed event line is its unsigned JSON encoding with the signature appended.
+var signature_marker = []byte(`,"signature":"`)
+
+// EventSigner signs events with an operator provided ed25519 key, so exported results used for
+// availability reports can be verified as untampered.
+//
+// The signature of an event covers its JSON encoding without the signature field, exactly as
+// written by WriteEvents, and is stored base64 encoded in the event's signature field.
+type EventSigner struct {
+	key ed25519.PrivateKey
+}
+
+// NewEventSigner creates an EventSigner from a PEM encoded PKCS #8 ed25519 private key, such as
+// one created with:
+//
+//	openssl genpkey -algorithm ed25519 -out signing.pem
+func NewEventSigner(key_pem []byte) (*EventSigner, error) {
+	block, _ := pem.Decode(key_pem)
+	if block == nil || block.Type != "PRIVATE KEY" {
+		return nil, fmt.Errorf("signing key is not a PEM encoded private key")
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse signing key: %v", err)
+	}
+	ed25519_key, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("signing key is a %T, expected an ed25519 key", key)
+	}
+
+	return &EventSigner{key: ed25519_key}, nil
+}
+
+// LoadEventSigner reads the signing key at path and creates an EventSigner from it.
+func LoadEventSigner(path string) (*EventSigner, error) {
+	key_pem, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read signing key: %v", err)
+	}
+	return NewEventSigner(key_pem)
+}
+
+// Sign sets the signature of each event. Returns immediately if the signer pointer is nil, so an
+// unconfigured signer leaves events unsigned.
+func (signer *EventSigner) Sign(events []Event) error {
+	if signer == nil {
+		return nil
+	}
+
+	for i := range events {
+		events[i].Signature = ""
+		payload, err := json.Marshal(events[i])
+		if err != nil {
+			return fmt.Errorf("failed to encode event for signing: %v", err)
+		}
+		events[i].Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(signer.key, payload))
+	}
+	return nil
+}
+
+// ParsePublicKey parses a PEM encoded PKIX ed25519 public key, such as one created from the
+// signing key with:
+//
+//	openssl pkey -in signing.pem -pubout -out public.pem
+func ParsePublicKey(key_pem []byte) (ed25519.PublicKey, error) {
+	block, _ := pem.Decode(key_pem)
+	if block == nil || block.Type != "PUBLIC KEY" {
+		return nil, fmt.Errorf("key is not a PEM encoded public key")
+	}
+
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse public key: %v", err)
+	}
+	ed25519_key, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("public key is a %T, expected an ed25519 key", key)
+	}
+	return ed25519_key, nil
+}
+
+// VerifyEventLine verifies the signature of a single line of JSON written by WriteEvents. The
+// signed payload is recovered from the line itself rather than by decoding the event, so events
+// with fields unknown to this version of the program are verified as well.
+func VerifyEventLine(key ed25519.PublicKey, line []byte) error {
+	line = bytes.TrimSpace(line)
+
+	index := bytes.LastIndex(line, signature_marker)
+	if index < 0 {
+		return ErrEventUnsigned
+	}
+
+	encoded := line[index+len(signature_marker):]
+	if !bytes.HasSuffix(encoded, []byte(`"}`)) {
+		return ErrEventSignature
+	}
+	signature, err := base64.StdEncoding.DecodeString(string(encoded[:len(encoded)-2]))
+	if err != nil {
+		return ErrEventSignature
+	}
+
+	payload := append(append([]byte{}, line[:index]...), '}')
+	if !ed25519.Verify(key, payload, signature) {
+		return ErrEventSignature
+	}
+	return nil
+}
+
+// VerifyEvents verifies every non-empty line of r, returning the number of verified events. The
+// first line failing verification is reported with name and its line number.
+func VerifyEvents(key ed25519.PublicKey, r io.Reader, name string) (int, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	verified := 0
+	line_number := 0
+	for scanner.Scan() {
+		line_number++
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		if err := VerifyEventLine(key, scanner.Bytes()); err != nil {
+			return verified, fmt.Errorf("%s:%d: %v", name, line_number, err)
+		}
+		verified++
+	}
+	if err := scanner.Err(); err != nil {
+		return verified, fmt.Errorf("failed to read %s: %v", name, err)
+	}
+	return verified, nil
+}
+
+// RunVerify is the entry point of the verify subcommand. It verifies the events in the files
+// provided in args, or in stdin when none is provided, and prints the number of verified events
+// to w.
+func RunVerify(args []string, stdin io.Reader, w io.Writer) error {
+	flags := flag.NewFlagSet("verify", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	key_path := flags.String("key", "", "")
+
+	if err := flags.Parse(args); err != nil {
+		return fmt.Errorf("failed to parse verify arguments: %v\n%s", err, VerifyUsage)
+	}
+	if *key_path == "" {
+		return fmt.Errorf("verify requires a public key.\n%s", VerifyUsage)
+	}
+
+	key_pem, err := os.ReadFile(*key_path)
+	if err != nil {
+		return fmt.Errorf("failed to read public key: %v", err)
+	}
+	key, err := ParsePublicKey(key_pem)
+	if err != nil {
+		return err
+	}
+
+	verified := 0
+	if flags.NArg() == 0 {
+		verified, err = VerifyEvents(key, stdin, "stdin")
+		if err != nil {
+			return err
+		}
+	}
+	for _, path := range flags.Args() {
+		file, err := os.Open(path)
+		if err != nil {
+			return fmt.Errorf("failed to open events: %v", err)
+		}
+		count, err := VerifyEvents(key, file, path)
+		file.Close()
+		verified += count
+		if err != nil {
+			return err
+		}
+	}
+
+	fmt.Fprintf(w, "%d events verified\n", verified)
+	return nil
+}
+
+func init() {
+	RegisterCommand(Command{
+		Name: "verify",
+		Run: func(args []string) error {
+			return RunVerify(args, os.Stdin, os.Stdout)
+		},
+	})
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-playground/assert/v2"
+)
+
+// newTestSigningKeys returns a signer and the PEM encoded public key of a fresh ed25519 key pair.
+func newTestSigningKeys(t *testing.T) (*EventSigner, []byte) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	private_der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		t.Fatalf("failed to marshal private key: %v", err)
+	}
+	signer, err := NewEventSigner(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: private_der}))
+	if err != nil {
+		t.Fatalf("failed to create signer: %v", err)
+	}
+
+	public_der, err := x509.MarshalPKIXPublicKey(public)
+	if err != nil {
+		t.Fatalf("failed to marshal public key: %v", err)
+	}
+	return signer, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: public_der})
+}
+
+func TestVerifyEventLine(t *testing.T) {
+	signer, public_pem := newTestSigningKeys(t)
+	public, err := ParsePublicKey(public_pem)
+	assert.Equal(t, err, nil)
+
+	_, other_pem := newTestSigningKeys(t)
+	other, err := ParsePublicKey(other_pem)
+	assert.Equal(t, err, nil)
+
+	events := []Event{NewEvent(EventDomainAvailability, time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC))}
+	events[0].Domain = &DomainEvent{Name: "fetch.com", Availability: 67, UpCount: 2, TotalRequests: 3}
+	assert.Equal(t, signer.Sign(events), nil)
+
+	var output bytes.Buffer
+	assert.Equal(t, WriteEvents(&output, events), nil)
+	signed := output.String()
+
+	var unsigned bytes.Buffer
+	events[0].Signature = ""
+	assert.Equal(t, WriteEvents(&unsigned, events), nil)
+
+	cases := []struct {
+		name          string
+		key           ed25519.PublicKey
+		line          string
+		expectedError error
+	}{
+		{
+			name: "Valid Signature",
+			key:  public,
+			line: signed,
+		},
+		{
+			name:          "Tampered Event",
+			key:           public,
+			line:          strings.Replace(signed, `"availability":67`, `"availability":99`, 1),
+			expectedError: ErrEventSignature,
+		},
+		{
+			name:          "Other Key",
+			key:           other,
+			line:          signed,
+			expectedError: ErrEventSignature,
+		},
+		{
+			name:          "Unsigned Event",
+			key:           public,
+			line:          unsigned.String(),
+			expectedError: ErrEventUnsigned,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, VerifyEventLine(tc.key, []byte(tc.line)), tc.expectedError)
+		})
+	}
+}
+
+func TestDomainEventsSigned(t *testing.T) {
+	signer, public_pem := newTestSigningKeys(t)
+	public, err := ParsePublicKey(public_pem)
+	assert.Equal(t, err, nil)
+
+	targets := HealthCheckTargets{
+		Domains: &Domain{Name: "fetch.com", UpCount: 1, TotalRequests: 1},
+		Signer:  signer,
+	}
+
+	var output bytes.Buffer
+	assert.Equal(t, WriteEvents(&output, targets.DomainEvents(time.Now())), nil)
+	assert.Equal(t, VerifyEventLine(public, output.Bytes()), nil)
+}
+
+func TestRunVerify(t *testing.T) {
+	signer, public_pem := newTestSigningKeys(t)
+	dir := t.TempDir()
+
+	key_path := filepath.Join(dir, "public.pem")
+	assert.Equal(t, os.WriteFile(key_path, public_pem, 0644), nil)
+
+	targets := HealthCheckTargets{
+		Domains: &Domain{Name: "fetch.com", UpCount: 1, TotalRequests: 2, Next: &Domain{Name: "www.fetchrewards.com"}},
+		Signer:  signer,
+	}
+	var events bytes.Buffer
+	assert.Equal(t, WriteEvents(&events, targets.DomainEvents(time.Now())), nil)
+
+	valid_path := filepath.Join(dir, "valid.jsonl")
+	assert.Equal(t, os.WriteFile(valid_path, events.Bytes(), 0644), nil)
+
+	tampered_path := filepath.Join(dir, "tampered.jsonl")
+	tampered := strings.Replace(events.String(), `"up_count":1`, `"up_count":2`, 1)
+	assert.Equal(t, os.WriteFile(tampered_path, []byte(tampered), 0644), nil)
+
+	cases := []struct {
+		name           string
+		args           []string
+		stdin          string
+		expectedOutput string
+		expectedError  string
+	}{
+		{
+			name:           "Valid File",
+			args:           []string{"-key", key_path, valid_path},
+			expectedOutput: "2 events verified\n",
+		},
+		{
+			name:           "Valid Stdin",
+			args:           []string{"-key", key_path},
+			stdin:          events.String(),
+			expectedOutput: "2 events verified\n",
+		},
+		{
+			name:          "Tampered File",
+			args:          []string{"-key", key_path, tampered_path},
+			expectedError: tampered_path + ":1: " + ErrEventSignature.Error(),
+		},
+		{
+			name:          "Missing Key",
+			args:          []string{valid_path},
+			expectedError: "verify requires a public key.",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var output bytes.Buffer
+			err := RunVerify(tc.args, strings.NewReader(tc.stdin), &output)
+			if tc.expectedError != "" {
+				assert.NotEqual(t, err, nil)
+				assert.Equal(t, strings.HasPrefix(err.Error(), tc.expectedError), true)
+				return
+			}
+			assert.Equal(t, err, nil)
+			assert.Equal(t, output.String(), tc.expectedOutput)
+		})
+	}
+}
+
+func TestNewEventSignerRejectsInvalidKeys(t *testing.T) {
+	_, err := NewEventSigner([]byte("not a key"))
+	assert.NotEqual(t, err, nil)
+
+	_, public_pem := newTestSigningKeys(t)
+	_, err = NewEventSigner(public_pem)
+	assert.NotEqual(t, err, nil)
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultSinkBatchSize, DefaultSinkFlushInterval and DefaultSinkQueueSize are used when a sink's
+// configuration doesn't set batch_size, flush_interval or queue_size.
+const (
+	DefaultSinkBatchSize     int           = 100
+	DefaultSinkFlushInterval time.Duration = 10 * time.Second
+	DefaultSinkQueueSize     int           = 10000
+)
+
+// Sink is a destination for the events produced by the check loop, such as a file, a metrics
+// store or a database. Sinks are always wrapped in a BatchSink, so Write receives events in
+// batches and is never called concurrently.
+type Sink interface {
+	// Write stores a batch of events. A returned error drops the batch.
+	Write(events []Event) error
+
+	// Close flushes and releases any resources held by the sink.
+	Close() error
+}
+
+// SinkConfig is the configuration of a single entry in the sinks section of the configuration
+// file. Type selects the sink implementation, the remaining fields are used by the implementations
+// that need them.
+type SinkConfig struct {
+	Type string `yaml:"type"`
+	Path string `yaml:"path,omitempty"`
+
+	// Url is the URL a webhook sink posts events to, signed with the secret held by the SecretEnv
+	// environment variable when it is set.
+	Url       string `yaml:"url,omitempty"`
+	SecretEnv string `yaml:"secret_env,omitempty"`
+
+	// TokenEnv is the environment variable holding the API token an influx sink authenticates
+	// with.
+	TokenEnv string `yaml:"token_env,omitempty"`
+
+	// Bucket is the bucket an s3 or gcs sink uploads availability snapshots to, every
+	// UploadInterval, as objects named after the Key template, in the json, csv or parquet Format.
+	// The access key and secret are held by the AccessKeyEnv and SecretEnv environment variables,
+	// and Url overrides the endpoint of the service, e.g. for MinIO.
+	Bucket         string        `yaml:"bucket,omitempty"`
+	Key            string        `yaml:"key,omitempty"`
+	Region         string        `yaml:"region,omitempty"`
+	Format         string        `yaml:"format,omitempty"`
+	UploadInterval time.Duration `yaml:"upload_interval,omitempty"`
+	AccessKeyEnv   string        `yaml:"access_key_env,omitempty"`
+
+	// Results also writes a check_result event for every check to the sink, in addition to the
+	// events of every cycle.
+	Results bool `yaml:"results,omitempty"`
+
+	BatchSize     int           `yaml:"batch_size,omitempty"`
+	FlushInterval time.Duration `yaml:"flush_interval,omitempty"`
+	QueueSize     int           `yaml:"queue_size,omitempty"`
+
+	CircuitBreaker BreakerConfig `yaml:"circuit_breaker,omitempty"`
+}
+
+// SinkFactory creates a Sink from its configuration.
+type SinkFactory func(config SinkConfig) (Sink, error)
+
+// sink_factories holds the sink implementations compiled into the binary, by type.
+var sink_factories = struct {
+	sync.Mutex
+	factories map[string]SinkFactory
+}{
+	factories: map[string]SinkFactory{},
+}
+
+// RegisterSink makes a sink type available to the sinks configuration section and records it as a
+// feature. It is intended to be called from init functions.
+func RegisterSink(sink_type string, factory SinkFactory) {
+	RegisterFeature(FeatureSink, sink_type)
+
+	sink_factories.Lock()
+	defer sink_factories.Unlock()
+	sink_factories.factories[sink_type] = factory
+}
+
+// NewSink creates the sink described by config, wrapped in a BatchSink. An error is returned if the
+// sink type isn't compiled into the binary or the sink fails to initialize.
+func NewSink(config SinkConfig) (*BatchSink, error) {
+	factory, err := lookupSink(config.Type)
+	if err != nil {
+		return nil, err
+	}
+
+	sink, err := factory(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s sink: %v", config.Type, err)
+	}
+
+	return NewBatchSink(config.Type, sink, config), nil
+}
+
+// lookupSink returns the factory of a sink type. An error is returned if the sink type isn't
+// compiled into the binary.
+func lookupSink(sink_type string) (SinkFactory, error) {
+	sink_factories.Lock()
+	factory, ok := sink_factories.factories[sink_type]
+	sink_factories.Unlock()
+
+	if !ok {
+		var known []string
+		for _, name := range registeredFeatures(FeatureSink) {
+			if name != "console" {
+				known = append(known, name)
+			}
+		}
+		sort.Strings(known)
+		return nil, fmt.Errorf("unknown sink type %q, expected one of %v", sink_type, known)
+	}
+	return factory, nil
+}
+
+// BatchSink buffers events for a Sink and writes them asynchronously in batches. A batch is flushed
+// once it reaches the batch size or when the flush interval elapses, whichever comes first.
+//
+// Emit never blocks: events are queued in a bounded queue and, when a slow sink lets the queue fill
+// up, new events are dropped and counted instead of delaying the check loop. Dropped events are
+// reported in the log on the next flush.
+//
+// Writes go through a CircuitBreaker. While the breaker is open, batches are dropped without
+// calling the sink, so a broken sink doesn't produce an error on every flush.
+type BatchSink struct {
+	name           string
+	sink           Sink
+	breaker        *CircuitBreaker
+	batch_size     int
+	flush_interval time.Duration
+	results        bool
+
+	queue   chan Event
+	done    chan struct{}
+	mu      sync.Mutex
+	dropped int
+	closed  bool
+}
+
+// NewBatchSink wraps sink in a BatchSink and starts its flushing goroutine. The batching and
+// circuit breaker options are read from config, where zero or negative values select the defaults.
+func NewBatchSink(name string, sink Sink, config SinkConfig) *BatchSink {
+	if config.BatchSize <= 0 {
+		config.BatchSize = DefaultSinkBatchSize
+	}
+	if config.FlushInterval <= 0 {
+		config.FlushInterval = DefaultSinkFlushInterval
+	}
+	if config.QueueSize <= 0 {
+		config.QueueSize = DefaultSinkQueueSize
+	}
+
+	batch_sink := &BatchSink{
+		name:           name,
+		sink:           sink,
+		breaker:        NewCircuitBreaker(name+" sink", config.CircuitBreaker),
+		batch_size:     config.BatchSize,
+		flush_interval: config.FlushInterval,
+		results:        config.Results,
+		queue:          make(chan Event, config.QueueSize),
+		done:           make(chan struct{}),
+	}
+	go batch_sink.run()
+
+	return batch_sink
+}
+
+// Name returns the sink type the BatchSink was created for.
+func (batch_sink *BatchSink) Name() string {
+	return batch_sink.name
+}
+
+// Emit queues events to be written by the sink. Events that don't fit in the queue are dropped.
+// Emitting to a closed BatchSink drops the events.
+func (batch_sink *BatchSink) Emit(events ...Event) {
+	batch_sink.mu.Lock()
+	defer batch_sink.mu.Unlock()
+
+	if batch_sink.closed {
+		batch_sink.dropped += len(events)
+		return
+	}
+
+	for _, event := range events {
+		select {
+		case batch_sink.queue <- event:
+		default:
+			batch_sink.dropped++
+		}
+	}
+}
+
+// Dropped returns the number of events dropped because the queue was full or the sink was closed.
+func (batch_sink *BatchSink) Dropped() int {
+	batch_sink.mu.Lock()
+	defer batch_sink.mu.Unlock()
+	return batch_sink.dropped
+}
+
+// Close flushes any queued events, waits for the last batch to be written and closes the sink.
+func (batch_sink *BatchSink) Close() error {
+	batch_sink.mu.Lock()
+	if batch_sink.closed {
+		batch_sink.mu.Unlock()
+		return nil
+	}
+	batch_sink.closed = true
+	close(batch_sink.queue)
+	batch_sink.mu.Unlock()
+
+	<-batch_sink.done
+	return batch_sink.sink.Close()
+}
+
+// run collects queued events into batches and flushes them until the queue is closed.
+func (batch_sink *BatchSink) run() {
+	defer close(batch_sink.done)
+
+	ticker := time.NewTicker(batch_sink.flush_interval)
+	defer ticker.Stop()
+
+	batch := make([]Event, 0, batch_sink.batch_size)
+	reported_drops := 0
+
+	flush := func() {
+		// report events dropped since the last flush
+		if dropped := batch_sink.Dropped(); dropped > reported_drops {
+			log.Printf("WARNING: %s sink is falling behind, dropped %d events", batch_sink.name, dropped-reported_drops)
+			reported_drops = dropped
+		}
+
+		if len(batch) == 0 {
+			return
+		}
+		err := batch_sink.breaker.Call(func() error {
+			return batch_sink.sink.Write(batch)
+		})
+		if err != nil && err != ErrCircuitOpen {
+			log.Printf("Failed to write %d events to %s sink: %v", len(batch), batch_sink.name, err)
+		}
+		batch = make([]Event, 0, batch_sink.batch_size)
+	}
+
+	for {
+		select {
+		case event, ok := <-batch_sink.queue:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, event)
+			if len(batch) >= batch_sink.batch_size {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// EmitEvents is a method for HealthCheckTargets that queues events on every configured sink.
+func (target *HealthCheckTargets) EmitEvents(events []Event) {
+	for _, sink := range target.Sinks {
+		sink.Emit(events...)
+	}
+}
+
+// EmitResults is a method for HealthCheckTargets that queues the check_result events of the results
+// of a cycle of the endpoints on the sinks with results set, see CheckEvents.
+func (target *HealthCheckTargets) EmitResults(results []CheckResult, endpoints *Endpoints, timestamp time.Time) {
+	var events []Event
+	for _, sink := range target.Sinks {
+		if !sink.results {
+			continue
+		}
+		if events == nil {
+			events = target.CheckEvents(results, endpoints, timestamp)
+		}
+		sink.Emit(events...)
+	}
+}
+
+// OpenSinks is a method for HealthCheckTargets that creates a sink for each entry in the sinks
+// configuration. Any failure closes the sinks opened so far and returns an error, except failures
+// to initialize a sink without StrictIntegrations, which are retried, see deferredSink.
+func (target *HealthCheckTargets) OpenSinks(configs []SinkConfig) error {
+	for _, config := range configs {
+		factory, err := lookupSink(config.Type)
+		if err != nil {
+			target.CloseSinks()
+			return err
+		}
+		sink, err := NewSink(config)
+		if err != nil && !target.Settings.StrictIntegrations {
+			sink, err = newDeferredSink(config, factory, err), nil
+		}
+		if err != nil {
+			target.CloseSinks()
+			return err
+		}
+		target.Sinks = append(target.Sinks, sink)
+	}
+	return nil
+}
+
+// CloseSinks is a method for HealthCheckTargets that flushes and closes every configured sink.
+func (target *HealthCheckTargets) CloseSinks() {
+	for _, sink := range target.Sinks {
+		if err := sink.Close(); err != nil {
+			log.Printf("Failed to close %s sink: %v", sink.Name(), err)
+		}
+	}
+	target.Sinks = nil
+}
@@ -0,0 +1,412 @@
+//go:build !nobucket
+// +build !nobucket
+
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The s3 and gcs sinks archive the availability of the domains in an object storage bucket: the
+// last domain_availability event of every domain is kept, and a snapshot of them is uploaded as a
+// new object every upload_interval and when the program exits, so teams archiving their
+// monitoring data in object storage don't need a collector. Uploads are signed with AWS Signature
+// Version 4, which Google Cloud Storage accepts with the HMAC keys of its XML API.
+
+// DefaultSnapshotInterval is the time between two snapshots of a bucket sink without
+// upload_interval.
+const DefaultSnapshotInterval time.Duration = 15 * time.Minute
+
+// DefaultSnapshotKey is the key template of the snapshots of a bucket sink without key, see
+// snapshotKey.
+const DefaultSnapshotKey string = "checkhealth/{year}/{month}/{day}/availability-{timestamp}.{format}"
+
+// Snapshot formats
+const (
+	SnapshotJSON    string = "json"
+	SnapshotCSV     string = "csv"
+	SnapshotParquet string = "parquet"
+)
+
+// bucketTimeout bounds each upload of a bucket sink.
+const bucketTimeout time.Duration = 30 * time.Second
+
+// BucketSink is a Sink uploading snapshots of the availability of the domains to an S3 or GCS
+// bucket, see DefaultSnapshotKey.
+type BucketSink struct {
+	endpoint string
+	region   string
+	bucket   string
+	key      string
+	format   string
+	interval time.Duration
+
+	access_key    string
+	secret_key    string
+	session_token string
+
+	client *http.Client
+	now    func() time.Time
+
+	// domains are the last domain_availability events of every domain, uploaded_at when the last
+	// snapshot was uploaded, or when the sink was created.
+	domains     map[string]*DomainEvent
+	uploaded_at time.Time
+}
+
+// bucketProvider holds the defaults of a bucket sink type.
+type bucketProvider struct {
+	endpoint       func(region string) string
+	region         string
+	access_key_env string
+	secret_env     string
+	token_env      string
+}
+
+// bucketProviders are the defaults of the s3 and gcs sinks.
+var bucketProviders = map[string]bucketProvider{
+	"s3": {
+		endpoint:       func(region string) string { return "https://s3." + region + ".amazonaws.com" },
+		region:         "us-east-1",
+		access_key_env: "AWS_ACCESS_KEY_ID",
+		secret_env:     "AWS_SECRET_ACCESS_KEY",
+		token_env:      "AWS_SESSION_TOKEN",
+	},
+	"gcs": {
+		endpoint:       func(string) string { return "https://storage.googleapis.com" },
+		region:         "auto",
+		access_key_env: "GCS_ACCESS_KEY_ID",
+		secret_env:     "GCS_SECRET_ACCESS_KEY",
+	},
+}
+
+// NewBucketSink creates a BucketSink uploading to config.Bucket of the S3 or GCS endpoint, or of
+// the S3 compatible service at config.Url, authenticated with the access key and secret held by
+// the config.AccessKeyEnv and config.SecretEnv environment variables.
+func NewBucketSink(config SinkConfig) (Sink, error) {
+	provider, ok := bucketProviders[config.Type]
+	if !ok {
+		return nil, fmt.Errorf("unknown bucket sink type %q", config.Type)
+	}
+	if config.Bucket == "" {
+		return nil, fmt.Errorf("%s sink requires a bucket", config.Type)
+	}
+
+	format := config.Format
+	switch format {
+	case "":
+		format = SnapshotJSON
+	case SnapshotJSON, SnapshotCSV:
+	case SnapshotParquet:
+		if !featureEnabled(FeatureExport, "parquet") {
+			return nil, fmt.Errorf("the %q format isn't compiled into the binary, which was built with the noparquet tag", format)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported format %q, expected %q, %q or %q", format, SnapshotJSON, SnapshotCSV, SnapshotParquet)
+	}
+
+	key := config.Key
+	if key == "" {
+		key = DefaultSnapshotKey
+	}
+	if sample := snapshotKey(key, format, time.Now()); strings.ContainsAny(sample, "{}") {
+		return nil, fmt.Errorf("key %q has an unknown placeholder, expected {year}, {month}, {day}, {hour}, {minute}, {timestamp} or {format}", key)
+	}
+
+	interval := config.UploadInterval
+	if interval < 0 {
+		return nil, fmt.Errorf("upload_interval must not be negative, got %s", interval)
+	}
+	if interval == 0 {
+		interval = DefaultSnapshotInterval
+	}
+
+	region := config.Region
+	if region == "" {
+		region = provider.region
+	}
+	endpoint := strings.TrimSuffix(config.Url, "/")
+	if endpoint == "" {
+		endpoint = provider.endpoint(region)
+	} else if target, err := url.Parse(endpoint); err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return nil, fmt.Errorf("%s sink requires an absolute http:// or https:// url", config.Type)
+	}
+
+	access_key_env, secret_env, token_env := config.AccessKeyEnv, config.SecretEnv, config.TokenEnv
+	if access_key_env == "" {
+		access_key_env = provider.access_key_env
+	}
+	if secret_env == "" {
+		secret_env = provider.secret_env
+	}
+	if token_env == "" {
+		token_env = provider.token_env
+	}
+	sink := &BucketSink{
+		endpoint:   endpoint,
+		region:     region,
+		bucket:     config.Bucket,
+		key:        key,
+		format:     format,
+		interval:   interval,
+		access_key: os.Getenv(access_key_env),
+		secret_key: os.Getenv(secret_env),
+		client:     &http.Client{Timeout: bucketTimeout},
+		now:        time.Now,
+		domains:    map[string]*DomainEvent{},
+	}
+	if sink.access_key == "" {
+		return nil, fmt.Errorf("environment variable %s is not set", access_key_env)
+	}
+	if sink.secret_key == "" {
+		return nil, fmt.Errorf("environment variable %s is not set", secret_env)
+	}
+	if token_env != "" {
+		sink.session_token = os.Getenv(token_env)
+	}
+	sink.uploaded_at = sink.now()
+	return sink, nil
+}
+
+// Write keeps the domain_availability events of the batch, and uploads a snapshot when the last
+// one is upload_interval old. A failed upload is retried on the next write.
+func (sink *BucketSink) Write(events []Event) error {
+	for _, event := range events {
+		if event.Type == EventDomainAvailability && event.Domain != nil {
+			sink.domains[event.Domain.Name] = event.Domain
+		}
+	}
+
+	if sink.now().Sub(sink.uploaded_at) < sink.interval {
+		return nil
+	}
+	return sink.upload()
+}
+
+// Close uploads a last snapshot and releases the idle connections of the bucket sink.
+func (sink *BucketSink) Close() error {
+	defer sink.client.CloseIdleConnections()
+	return sink.upload()
+}
+
+// upload uploads a snapshot of the domains, nothing when no domain was reported yet.
+func (sink *BucketSink) upload() error {
+	if len(sink.domains) == 0 {
+		return nil
+	}
+
+	at := sink.now()
+	body, content_type, err := sink.snapshot(at)
+	if err != nil {
+		return fmt.Errorf("failed to encode snapshot: %v", err)
+	}
+	key := snapshotKey(sink.key, sink.format, at)
+	if err := sink.put(key, body, content_type, at); err != nil {
+		return err
+	}
+	sink.uploaded_at = at
+	return nil
+}
+
+// put uploads body as the object key of the bucket, with a path-style URL.
+func (sink *BucketSink) put(key string, body []byte, content_type string, at time.Time) error {
+	object_url := sink.endpoint + s3Escape("/"+sink.bucket+"/"+key)
+	request, err := http.NewRequest(http.MethodPut, object_url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", content_type)
+	if sink.session_token != "" {
+		request.Header.Set("X-Amz-Security-Token", sink.session_token)
+	}
+	SignS3Request(request, body, sink.access_key, sink.secret_key, sink.region, at)
+
+	response, err := sink.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		message, _ := io.ReadAll(io.LimitReader(response.Body, 512))
+		return fmt.Errorf("PUT %s returned status %d: %s", object_url, response.StatusCode, strings.TrimSpace(string(message)))
+	}
+	_, err = io.Copy(io.Discard, response.Body)
+	return err
+}
+
+// BucketSnapshot is the JSON snapshot of a bucket sink: the last domain_availability payload of
+// every domain, ordered by name.
+type BucketSnapshot struct {
+	SchemaVersion string         `json:"schema_version"`
+	GeneratedAt   time.Time      `json:"generated_at"`
+	Domains       []*DomainEvent `json:"domains"`
+}
+
+// snapshot encodes the snapshot generated at in the format of the sink, and returns it with its
+// content type. The CSV and Parquet snapshots have a row per domain, with the generated_at,
+// domain, availability, up_count, total_requests, unknown_count and degraded_count columns, and
+// the latency_p50_ms, latency_p95_ms, latency_p99_ms and latency_max_ms of the domains with
+// latencies.
+func (sink *BucketSink) snapshot(at time.Time) ([]byte, string, error) {
+	names := make([]string, 0, len(sink.domains))
+	for name := range sink.domains {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	domains := make([]*DomainEvent, len(names))
+	for i, name := range names {
+		domains[i] = sink.domains[name]
+	}
+
+	var body bytes.Buffer
+	switch sink.format {
+	case SnapshotCSV:
+		writer := csv.NewWriter(&body)
+		writer.Write([]string{"generated_at", "domain", "availability", "up_count", "total_requests", "unknown_count", "degraded_count", "latency_p50_ms", "latency_p95_ms", "latency_p99_ms", "latency_max_ms"})
+		for _, domain := range domains {
+			record := []string{
+				at.UTC().Format(time.RFC3339), domain.Name, strconv.Itoa(domain.Availability), strconv.Itoa(domain.UpCount),
+				strconv.Itoa(domain.TotalRequests), strconv.Itoa(domain.UnknownCount), strconv.Itoa(domain.DegradedCount),
+				"", "", "", "",
+			}
+			if latency := domain.Latency; latency != nil && latency.Samples > 0 {
+				for i, ms := range []float64{latency.P50Ms, latency.P95Ms, latency.P99Ms, latency.MaxMs} {
+					record[7+i] = strconv.FormatFloat(ms, 'f', -1, 64)
+				}
+			}
+			writer.Write(record)
+		}
+		writer.Flush()
+		return body.Bytes(), "text/csv; charset=utf-8", writer.Error()
+
+	case SnapshotParquet:
+		err := writeSnapshotParquet(&body, domains, at)
+		return body.Bytes(), "application/vnd.apache.parquet", err
+	}
+
+	encoder := json.NewEncoder(&body)
+	encoder.SetIndent("", "  ")
+	err := encoder.Encode(BucketSnapshot{SchemaVersion: ResultSchemaVersion, GeneratedAt: at.UTC(), Domains: domains})
+	return body.Bytes(), "application/json", err
+}
+
+// snapshotKey returns the key of a snapshot uploaded at, replacing the placeholders of template
+// with the UTC date and time, e.g. {year}, {month}, {day}, {hour} and {minute}, the compact
+// {timestamp}, e.g. 20230601T120000Z, and the {format}, e.g. json.
+func snapshotKey(template string, format string, at time.Time) string {
+	at = at.UTC()
+	return strings.NewReplacer(
+		"{year}", at.Format("2006"),
+		"{month}", at.Format("01"),
+		"{day}", at.Format("02"),
+		"{hour}", at.Format("15"),
+		"{minute}", at.Format("04"),
+		"{timestamp}", at.Format("20060102T150405Z"),
+		"{format}", format,
+	).Replace(template)
+}
+
+// SignS3Request signs request with AWS Signature Version 4 for the s3 service of region, with the
+// access key and secret, at the provided time. The host and every header of the request are
+// signed, along with the SHA-256 of body, sent in X-Amz-Content-Sha256.
+func SignS3Request(request *http.Request, body []byte, access_key string, secret_key string, region string, at time.Time) {
+	at = at.UTC()
+	amz_date := at.Format("20060102T150405Z")
+	payload_hash := sha256.Sum256(body)
+	request.Header.Set("X-Amz-Date", amz_date)
+	request.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(payload_hash[:]))
+
+	host := request.Host
+	if host == "" {
+		host = request.URL.Host
+	}
+	headers := map[string]string{"host": host}
+	for name, values := range request.Header {
+		headers[strings.ToLower(name)] = strings.Join(strings.Fields(strings.Join(values, ",")), " ")
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonical_headers strings.Builder
+	for _, name := range names {
+		canonical_headers.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signed_headers := strings.Join(names, ";")
+
+	canonical_request := strings.Join([]string{
+		request.Method,
+		s3Escape(request.URL.Path),
+		canonicalQuery(request.URL.Query()),
+		canonical_headers.String(),
+		signed_headers,
+		hex.EncodeToString(payload_hash[:]),
+	}, "\n")
+	request_hash := sha256.Sum256([]byte(canonical_request))
+
+	scope := at.Format("20060102") + "/" + region + "/s3/aws4_request"
+	string_to_sign := "AWS4-HMAC-SHA256\n" + amz_date + "\n" + scope + "\n" + hex.EncodeToString(request_hash[:])
+
+	key := []byte("AWS4" + secret_key)
+	for _, part := range []string{at.Format("20060102"), region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, string_to_sign))
+
+	request.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+access_key+"/"+scope+", SignedHeaders="+signed_headers+", Signature="+signature)
+}
+
+// hmacSHA256 returns the HMAC-SHA256 of data keyed with key.
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// canonicalQuery returns the query parameters sorted by name and value, escaped like s3Escape.
+func canonicalQuery(query url.Values) string {
+	var parameters []string
+	for name, values := range query {
+		for _, value := range values {
+			parameters = append(parameters, s3Escape(name)+"="+strings.ReplaceAll(s3Escape(value), "/", "%2F"))
+		}
+	}
+	sort.Strings(parameters)
+	return strings.Join(parameters, "&")
+}
+
+// s3Escape percent-encodes every byte of path but the unreserved characters of RFC 3986 and the
+// slashes, as expected by Signature Version 4.
+func s3Escape(path string) string {
+	var escaped strings.Builder
+	for i := 0; i < len(path); i++ {
+		c := path[i]
+		if ('A' <= c && c <= 'Z') || ('a' <= c && c <= 'z') || ('0' <= c && c <= '9') || strings.IndexByte("-_.~/", c) >= 0 {
+			escaped.WriteByte(c)
+		} else {
+			fmt.Fprintf(&escaped, "%%%02X", c)
+		}
+	}
+	return escaped.String()
+}
+
+func init() {
+	RegisterSink("s3", NewBucketSink)
+	RegisterSink("gcs", NewBucketSink)
+}
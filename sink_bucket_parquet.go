@@ -0,0 +1,56 @@
+//go:build !nobucket && !noparquet
+// +build !nobucket,!noparquet
+
+package main
+
+import (
+	"io"
+	"time"
+)
+
+// writeSnapshotParquet writes the Parquet snapshot of the domains generated at, see
+// BucketSink.snapshot.
+func writeSnapshotParquet(w io.Writer, domains []*DomainEvent, at time.Time) error {
+	return writeParquet(w, snapshotColumns(domains, at))
+}
+
+// snapshotColumns returns the columns of the Parquet snapshot of the domains, see
+// BucketSink.snapshot. The latencies are null for the domains without latencies.
+func snapshotColumns(domains []*DomainEvent, at time.Time) []parquetColumn {
+	columns := []parquetColumn{
+		{name: "generated_at", kind: parquetInt64, converted: parquetTimestampMillis},
+		{name: "domain", kind: parquetByteArray, converted: parquetUTF8},
+		{name: "availability", kind: parquetInt32, converted: parquetNoConversion},
+		{name: "up_count", kind: parquetInt64, converted: parquetNoConversion},
+		{name: "total_requests", kind: parquetInt64, converted: parquetNoConversion},
+		{name: "unknown_count", kind: parquetInt64, converted: parquetNoConversion},
+		{name: "degraded_count", kind: parquetInt64, converted: parquetNoConversion},
+		{name: "latency_p50_ms", kind: parquetDouble, converted: parquetNoConversion, optional: true},
+		{name: "latency_p95_ms", kind: parquetDouble, converted: parquetNoConversion, optional: true},
+		{name: "latency_p99_ms", kind: parquetDouble, converted: parquetNoConversion, optional: true},
+		{name: "latency_max_ms", kind: parquetDouble, converted: parquetNoConversion, optional: true},
+	}
+	for i := range columns {
+		columns[i].values = make([]interface{}, 0, len(domains))
+	}
+
+	for _, domain := range domains {
+		values := []interface{}{
+			at.UnixNano() / int64(time.Millisecond),
+			domain.Name,
+			int32(domain.Availability),
+			int64(domain.UpCount),
+			int64(domain.TotalRequests),
+			int64(domain.UnknownCount),
+			int64(domain.DegradedCount),
+			nil, nil, nil, nil,
+		}
+		if latency := domain.Latency; latency != nil && latency.Samples > 0 {
+			values[7], values[8], values[9], values[10] = latency.P50Ms, latency.P95Ms, latency.P99Ms, latency.MaxMs
+		}
+		for i := range columns {
+			columns[i].values = append(columns[i].values, values[i])
+		}
+	}
+	return columns
+}
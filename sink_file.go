@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+)
+
+// FileSink is a Sink that appends events to a file as JSON lines, matching the JSON output mode.
+type FileSink struct {
+	file   *os.File
+	writer *bufio.Writer
+}
+
+// NewFileSink opens (or creates) the file at config.Path for appending events.
+func NewFileSink(config SinkConfig) (Sink, error) {
+	if config.Path == "" {
+		return nil, fmt.Errorf("file sink requires a path")
+	}
+
+	file, err := os.OpenFile(config.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FileSink{
+		file:   file,
+		writer: bufio.NewWriter(file),
+	}, nil
+}
+
+// Write appends the batch of events to the file and flushes it.
+func (sink *FileSink) Write(events []Event) error {
+	if err := WriteEvents(sink.writer, events); err != nil {
+		return err
+	}
+	return sink.writer.Flush()
+}
+
+// Close flushes any buffered output and closes the file.
+func (sink *FileSink) Close() error {
+	if err := sink.writer.Flush(); err != nil {
+		sink.file.Close()
+		return err
+	}
+	return sink.file.Close()
+}
+
+func init() {
+	RegisterSink("file", NewFileSink)
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-playground/assert/v2"
+)
+
+func TestFileSink(t *testing.T) {
+	path := t.TempDir() + "/results.jsonl"
+	timestamp := time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+	target := &HealthCheckTargets{
+		Domains: &Domain{
+			Name:          "example.com",
+			UpCount:       1,
+			TotalRequests: 2,
+		},
+	}
+
+	// write twice, reopening the file in between to validate that events are appended
+	for i := 0; i < 2; i++ {
+		sink, err := NewFileSink(SinkConfig{Type: "file", Path: path})
+		assert.Equal(t, err, nil)
+
+		err = sink.Write(target.DomainEvents(timestamp))
+		assert.Equal(t, err, nil)
+		assert.Equal(t, sink.Close(), nil)
+	}
+
+	content, err := os.ReadFile(path)
+	assert.Equal(t, err, nil)
+
+	line := `{"schema_version":"1.18","type":"domain_availability","timestamp":"2023-06-01T12:00:00Z",` +
+		`"domain":{"name":"example.com","availability":50,"up_count":1,"total_requests":2,"unknown_count":0}}`
+	assert.Equal(t, strings.Split(strings.TrimSpace(string(content)), "\n"), []string{line, line})
+}
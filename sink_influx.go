@@ -0,0 +1,284 @@
+//go:build !noinflux
+// +build !noinflux
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// influxTimeout bounds each request an influx sink makes to the InfluxDB write API.
+const influxTimeout time.Duration = 10 * time.Second
+
+// InfluxSink is a Sink that writes events as InfluxDB line protocol, to the HTTP write API of
+// InfluxDB or to a file, so teams on the TICK stack can graph availability without Prometheus.
+// Events are written as the following measurements, other events being skipped:
+//
+//   - checkhealth_check, for check_result events (see SinkConfig.Results), tagged with the
+//     endpoint, url, domain, status and error_kind, with the latency_ms, the status_code, the
+//     error and available, 1 for up or degraded checks and 0 for down checks, whose mean is the
+//     availability.
+//   - checkhealth_domain, for domain_availability events, tagged with the domain.
+//   - checkhealth_state, for state_change events, tagged with the endpoint, url, from and to.
+//   - checkhealth_failures, for endpoint_failures events, tagged with the endpoint, url and
+//     reason, with the count of failed checks.
+//   - checkhealth_derived, for derived_metric events, tagged with the name and aggregate.
+type InfluxSink struct {
+	url    string
+	token  string
+	client *http.Client
+	file   *os.File
+}
+
+// NewInfluxSink creates an InfluxSink posting to the InfluxDB write API at config.Url, such as
+// http://localhost:8086/api/v2/write?org=fetch&bucket=checkhealth, authenticated with the token
+// held by the config.TokenEnv environment variable when it is set, or appending to the file at
+// config.Path.
+func NewInfluxSink(config SinkConfig) (Sink, error) {
+	if (config.Url == "") == (config.Path == "") {
+		return nil, fmt.Errorf("influx sink requires either a url or a path")
+	}
+
+	if config.Path != "" {
+		file, err := os.OpenFile(config.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return nil, err
+		}
+		return &InfluxSink{file: file}, nil
+	}
+
+	target, err := url.Parse(config.Url)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return nil, fmt.Errorf("influx sink requires an absolute http:// or https:// url")
+	}
+	var token string
+	if config.TokenEnv != "" {
+		token = os.Getenv(config.TokenEnv)
+		if token == "" {
+			return nil, fmt.Errorf("environment variable %s is not set", config.TokenEnv)
+		}
+	}
+
+	return &InfluxSink{
+		url:    config.Url,
+		token:  token,
+		client: &http.Client{Timeout: influxTimeout},
+	}, nil
+}
+
+// Write writes the batch of events as line protocol. Responses other than 2xx fail the write.
+func (sink *InfluxSink) Write(events []Event) error {
+	var lines bytes.Buffer
+	for _, event := range events {
+		writeInfluxLines(&lines, event)
+	}
+	if lines.Len() == 0 {
+		return nil
+	}
+
+	if sink.file != nil {
+		_, err := sink.file.Write(lines.Bytes())
+		return err
+	}
+
+	request, err := http.NewRequest(http.MethodPost, sink.url, &lines)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if sink.token != "" {
+		request.Header.Set("Authorization", "Token "+sink.token)
+	}
+
+	response, err := sink.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		message, _ := io.ReadAll(io.LimitReader(response.Body, 512))
+		return fmt.Errorf("POST %s returned status %d: %s", sink.url, response.StatusCode, strings.TrimSpace(string(message)))
+	}
+	_, err = io.Copy(io.Discard, response.Body)
+	return err
+}
+
+// Close closes the file of the influx sink, or releases its idle connections.
+func (sink *InfluxSink) Close() error {
+	if sink.file != nil {
+		return sink.file.Close()
+	}
+	sink.client.CloseIdleConnections()
+	return nil
+}
+
+// influxPoint is a line of line protocol. Tags with an empty value are omitted, as InfluxDB
+// rejects them, and fields are either int64, float64 or string.
+type influxPoint struct {
+	measurement string
+	tags        [][2]string
+	fields      []influxField
+	at          time.Time
+}
+
+type influxField struct {
+	key   string
+	value interface{}
+}
+
+// writeInfluxLines writes the points of an event to lines, nothing for the events without a
+// measurement.
+func writeInfluxLines(lines *bytes.Buffer, event Event) {
+	for _, point := range influxPoints(event) {
+		point.writeTo(lines)
+	}
+}
+
+// influxPoints returns the points of an event, see InfluxSink.
+func influxPoints(event Event) []influxPoint {
+	switch {
+	case event.Type == EventCheckResult && event.Check != nil:
+		check := event.Check
+		point := influxPoint{
+			measurement: "checkhealth_check",
+			tags:        [][2]string{{"endpoint", check.Endpoint}, {"url", check.Url}, {"domain", check.Domain}, {"status", check.Status}, {"error_kind", check.ErrorKind}},
+			fields:      []influxField{{"latency_ms", check.LatencyMs}},
+			at:          check.StartedAt,
+		}
+		switch check.Status {
+		case StatusUp, StatusDegraded:
+			point.fields = append(point.fields, influxField{"available", int64(1)})
+		case StatusDown:
+			point.fields = append(point.fields, influxField{"available", int64(0)})
+		}
+		if check.StatusCode != 0 {
+			point.fields = append(point.fields, influxField{"status_code", int64(check.StatusCode)})
+		}
+		if check.Error != "" {
+			point.fields = append(point.fields, influxField{"error", check.Error})
+		}
+		return []influxPoint{point}
+
+	case event.Type == EventDomainAvailability && event.Domain != nil:
+		domain := event.Domain
+		point := influxPoint{
+			measurement: "checkhealth_domain",
+			tags:        [][2]string{{"domain", domain.Name}},
+			fields: []influxField{
+				{"availability", int64(domain.Availability)},
+				{"up_count", int64(domain.UpCount)},
+				{"total_requests", int64(domain.TotalRequests)},
+				{"unknown_count", int64(domain.UnknownCount)},
+				{"degraded_count", int64(domain.DegradedCount)},
+			},
+			at: event.Timestamp,
+		}
+		if latency := domain.Latency; latency != nil && latency.Samples > 0 {
+			point.fields = append(point.fields,
+				influxField{"latency_p50_ms", latency.P50Ms},
+				influxField{"latency_p95_ms", latency.P95Ms},
+				influxField{"latency_p99_ms", latency.P99Ms},
+				influxField{"latency_max_ms", latency.MaxMs},
+			)
+		}
+		return []influxPoint{point}
+
+	case event.Type == EventStateChange && event.State != nil:
+		state := event.State
+		return []influxPoint{{
+			measurement: "checkhealth_state",
+			tags:        [][2]string{{"endpoint", state.Endpoint}, {"url", state.Url}, {"from", state.From}, {"to", state.To}},
+			fields:      []influxField{{"previous_duration_ms", state.PreviousDurationMs}},
+			at:          state.ChangedAt,
+		}}
+
+	case event.Type == EventEndpointFailures && event.Failures != nil:
+		failures := event.Failures
+		reasons := make([]string, 0, len(failures.Reasons))
+		for reason := range failures.Reasons {
+			reasons = append(reasons, reason)
+		}
+		sort.Strings(reasons)
+
+		var points []influxPoint
+		for _, reason := range reasons {
+			points = append(points, influxPoint{
+				measurement: "checkhealth_failures",
+				tags:        [][2]string{{"endpoint", failures.Endpoint}, {"url", failures.Url}, {"reason", reason}},
+				fields:      []influxField{{"count", int64(failures.Reasons[reason])}},
+				at:          event.Timestamp,
+			})
+		}
+		return points
+
+	case event.Type == EventDerivedMetric && event.Derived != nil:
+		derived := event.Derived
+		return []influxPoint{{
+			measurement: "checkhealth_derived",
+			tags:        [][2]string{{"name", derived.Name}, {"aggregate", derived.Aggregate}},
+			fields:      []influxField{{"value", derived.Value}, {"endpoints", int64(derived.Endpoints)}},
+			at:          event.Timestamp,
+		}}
+	}
+	return nil
+}
+
+// writeTo writes the point as a line of line protocol, with a timestamp in nanoseconds.
+func (point influxPoint) writeTo(lines *bytes.Buffer) {
+	lines.WriteString(influxEscaper(",", " ").Replace(point.measurement))
+	for _, tag := range point.tags {
+		if tag[1] == "" {
+			continue
+		}
+		lines.WriteByte(',')
+		lines.WriteString(influxEscaper(",", "=", " ").Replace(tag[0]))
+		lines.WriteByte('=')
+		lines.WriteString(influxEscaper(",", "=", " ").Replace(tag[1]))
+	}
+
+	for i, field := range point.fields {
+		if i == 0 {
+			lines.WriteByte(' ')
+		} else {
+			lines.WriteByte(',')
+		}
+		lines.WriteString(influxEscaper(",", "=", " ").Replace(field.key))
+		lines.WriteByte('=')
+		switch value := field.value.(type) {
+		case int64:
+			lines.WriteString(strconv.FormatInt(value, 10) + "i")
+		case float64:
+			lines.WriteString(strconv.FormatFloat(value, 'f', -1, 64))
+		case string:
+			lines.WriteString(`"` + influxEscaper(`"`).Replace(value) + `"`)
+		}
+	}
+
+	lines.WriteByte(' ')
+	lines.WriteString(strconv.FormatInt(point.at.UnixNano(), 10))
+	lines.WriteByte('\n')
+}
+
+// influxEscaper returns a replacer escaping the characters with a backslash, as well as
+// backslashes, and replacing newlines, which line protocol doesn't support, with spaces.
+func influxEscaper(characters ...string) *strings.Replacer {
+	replacements := []string{`\`, `\\`, "\r\n", " ", "\n", " "}
+	for _, character := range characters {
+		replacements = append(replacements, character, `\`+character)
+	}
+	return strings.NewReplacer(replacements...)
+}
+
+func init() {
+	RegisterSink("influx", NewInfluxSink)
+}
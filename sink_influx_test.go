@@ -0,0 +1,198 @@
+//go:build !noinflux
+// +build !noinflux
+
+package main
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-playground/assert/v2"
+)
+
+func TestInfluxLines(t *testing.T) {
+	timestamp := time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+	started_at := timestamp.Add(-time.Second)
+
+	check := func(check CheckEvent) Event {
+		event := NewEvent(EventCheckResult, timestamp)
+		event.Check = &check
+		return event
+	}
+	domain := NewEvent(EventDomainAvailability, timestamp)
+	domain.Domain = &DomainEvent{Name: "fetch.com", Availability: 50, UpCount: 1, TotalRequests: 2}
+	latency := NewEvent(EventDomainAvailability, timestamp)
+	latency.Domain = &DomainEvent{Name: "fetch.com", Availability: 100, UpCount: 1, TotalRequests: 1,
+		Latency: &LatencyEvent{Samples: 1, P50Ms: 12.5, P95Ms: 12.5, P99Ms: 12.5, MaxMs: 12.5}}
+	state := NewEvent(EventStateChange, timestamp)
+	state.State = &StateEvent{Endpoint: "index", Url: "https://fetch.com/", From: StateUp, To: StateDown, ChangedAt: started_at, PreviousDurationMs: 60000}
+	failures := NewEvent(EventEndpointFailures, timestamp)
+	failures.Failures = &FailuresEvent{Endpoint: "index", Url: "https://fetch.com/", Reasons: map[string]int{"timeout": 2, "status 503": 1}}
+	derived := NewEvent(EventDerivedMetric, timestamp)
+	derived.Derived = &DerivedEvent{Name: "checkout", Aggregate: "min", Value: 99.5, Endpoints: 3}
+
+	cases := []struct {
+		name          string
+		event         Event
+		expectedLines []string
+	}{
+		{
+			name:          "Up Check",
+			event:         check(CheckEvent{Endpoint: "index", Url: "https://fetch.com/", Domain: "fetch.com", Status: StatusUp, StatusCode: 200, LatencyMs: 12.5, StartedAt: started_at}),
+			expectedLines: []string{`checkhealth_check,endpoint=index,url=https://fetch.com/,domain=fetch.com,status=up latency_ms=12.5,available=1i,status_code=200i 1685620799000000000`},
+		},
+		{
+			name: "Down Check",
+			event: check(CheckEvent{Endpoint: "index", Url: "https://fetch.com/", Status: StatusDown, StatusCode: 503, LatencyMs: 3, StartedAt: started_at,
+				ErrorKind: ErrorKindStatus, Error: "unexpected status 503"}),
+			expectedLines: []string{`checkhealth_check,endpoint=index,url=https://fetch.com/,status=down,error_kind=status latency_ms=3,available=0i,status_code=503i,error="unexpected status 503" 1685620799000000000`},
+		},
+		{
+			name:          "Unknown Check",
+			event:         check(CheckEvent{Endpoint: "index", Url: "https://fetch.com/", Status: StatusUnknown, StartedAt: started_at}),
+			expectedLines: []string{`checkhealth_check,endpoint=index,url=https://fetch.com/,status=unknown latency_ms=0 1685620799000000000`},
+		},
+		{
+			name: "Escaping",
+			event: check(CheckEvent{Endpoint: "sign in, eu=1", Url: "https://fetch.com/?a=b c", Status: StatusDown, LatencyMs: 1, StartedAt: started_at,
+				Error: "bad \"body\" \\ here\nand there"}),
+			expectedLines: []string{`checkhealth_check,endpoint=sign\ in\,\ eu\=1,url=https://fetch.com/?a\=b\ c,status=down latency_ms=1,available=0i,error="bad \"body\" \\ here and there" 1685620799000000000`},
+		},
+		{
+			name:          "Domain",
+			event:         domain,
+			expectedLines: []string{`checkhealth_domain,domain=fetch.com availability=50i,up_count=1i,total_requests=2i,unknown_count=0i,degraded_count=0i 1685620800000000000`},
+		},
+		{
+			name:          "Domain Latency",
+			event:         latency,
+			expectedLines: []string{`checkhealth_domain,domain=fetch.com availability=100i,up_count=1i,total_requests=1i,unknown_count=0i,degraded_count=0i,latency_p50_ms=12.5,latency_p95_ms=12.5,latency_p99_ms=12.5,latency_max_ms=12.5 1685620800000000000`},
+		},
+		{
+			name:          "State Change",
+			event:         state,
+			expectedLines: []string{`checkhealth_state,endpoint=index,url=https://fetch.com/,from=UP,to=DOWN previous_duration_ms=60000i 1685620799000000000`},
+		},
+		{
+			name:  "Failures",
+			event: failures,
+			expectedLines: []string{
+				`checkhealth_failures,endpoint=index,url=https://fetch.com/,reason=status\ 503 count=1i 1685620800000000000`,
+				`checkhealth_failures,endpoint=index,url=https://fetch.com/,reason=timeout count=2i 1685620800000000000`,
+			},
+		},
+		{
+			name:          "Derived Metric",
+			event:         derived,
+			expectedLines: []string{`checkhealth_derived,name=checkout,aggregate=min value=99.5,endpoints=3i 1685620800000000000`},
+		},
+		{
+			name:          "Skipped Event",
+			event:         NewEvent(EventConfigChange, timestamp),
+			expectedLines: []string{""},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var lines bytes.Buffer
+			writeInfluxLines(&lines, tc.event)
+			assert.Equal(t, strings.Split(strings.TrimSuffix(lines.String(), "\n"), "\n"), tc.expectedLines)
+		})
+	}
+}
+
+func TestInfluxSink(t *testing.T) {
+	timestamp := time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+	requests := make(chan *http.Request, 1)
+	bodies := make(chan []byte, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests <- r
+		bodies <- body
+		if r.URL.Path == "/fail" {
+			http.Error(w, `{"code":"unauthorized"}`, http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	os.Setenv("CHECKHEALTH_TEST_INFLUX_TOKEN", "influx_test")
+	defer os.Unsetenv("CHECKHEALTH_TEST_INFLUX_TOKEN")
+
+	target := &HealthCheckTargets{Domains: &Domain{Name: "fetch.com", UpCount: 1, TotalRequests: 2}}
+	line := "checkhealth_domain,domain=fetch.com availability=50i,up_count=1i,total_requests=2i,unknown_count=0i,degraded_count=0i 1685620800000000000\n"
+
+	sink, err := NewInfluxSink(SinkConfig{Type: "influx", Url: server.URL + "/api/v2/write?org=fetch&bucket=checkhealth", TokenEnv: "CHECKHEALTH_TEST_INFLUX_TOKEN"})
+	assert.Equal(t, err, nil)
+	defer sink.Close()
+	assert.Equal(t, sink.Write(target.DomainEvents(timestamp)), nil)
+
+	request, body := <-requests, <-bodies
+	assert.Equal(t, request.Method, http.MethodPost)
+	assert.Equal(t, request.URL.Query().Get("bucket"), "checkhealth")
+	assert.Equal(t, request.Header.Get("Content-Type"), "text/plain; charset=utf-8")
+	assert.Equal(t, request.Header.Get("Authorization"), "Token influx_test")
+	assert.Equal(t, string(body), line)
+
+	// batches without a point aren't written
+	assert.Equal(t, sink.Write([]Event{NewEvent(EventConfigChange, timestamp)}), nil)
+	assert.Equal(t, len(requests), 0)
+
+	// non-2xx responses fail the write, so the circuit breaker counts them
+	failing, err := NewInfluxSink(SinkConfig{Type: "influx", Url: server.URL + "/fail"})
+	assert.Equal(t, err, nil)
+	defer failing.Close()
+	assert.NotEqual(t, failing.Write(target.DomainEvents(timestamp)), nil)
+	request = <-requests
+	<-bodies
+	assert.Equal(t, request.Header.Get("Authorization"), "")
+
+	// files are appended to
+	path := t.TempDir() + "/checkhealth.lp"
+	for i := 0; i < 2; i++ {
+		file_sink, err := NewInfluxSink(SinkConfig{Type: "influx", Path: path})
+		assert.Equal(t, err, nil)
+		assert.Equal(t, file_sink.Write(target.DomainEvents(timestamp)), nil)
+		assert.Equal(t, file_sink.Close(), nil)
+	}
+	content, err := os.ReadFile(path)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, string(content), line+line)
+}
+
+func TestNewInfluxSink(t *testing.T) {
+	os.Setenv("CHECKHEALTH_TEST_INFLUX_TOKEN", "influx_test")
+	defer os.Unsetenv("CHECKHEALTH_TEST_INFLUX_TOKEN")
+
+	cases := []struct {
+		name         string
+		config       SinkConfig
+		expectedFail bool
+	}{
+		{name: "URL", config: SinkConfig{Type: "influx", Url: "http://localhost:8086/api/v2/write?org=fetch&bucket=checkhealth"}},
+		{name: "Token", config: SinkConfig{Type: "influx", Url: "https://influx.example.com/api/v2/write", TokenEnv: "CHECKHEALTH_TEST_INFLUX_TOKEN"}},
+		{name: "Path", config: SinkConfig{Type: "influx", Path: t.TempDir() + "/checkhealth.lp"}},
+		{name: "Missing URL And Path", config: SinkConfig{Type: "influx"}, expectedFail: true},
+		{name: "URL And Path", config: SinkConfig{Type: "influx", Url: "http://localhost:8086/api/v2/write", Path: t.TempDir() + "/checkhealth.lp"}, expectedFail: true},
+		{name: "Relative URL", config: SinkConfig{Type: "influx", Url: "/api/v2/write"}, expectedFail: true},
+		{name: "Unset Token", config: SinkConfig{Type: "influx", Url: "http://localhost:8086/api/v2/write", TokenEnv: "CHECKHEALTH_TEST_UNSET"}, expectedFail: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			sink, err := NewInfluxSink(tc.config)
+			assert.Equal(t, err != nil, tc.expectedFail)
+			if err == nil {
+				assert.Equal(t, sink.Close(), nil)
+			}
+		})
+	}
+}
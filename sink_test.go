@@ -0,0 +1,208 @@
+package main
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-playground/assert/v2"
+)
+
+// recordingSink is a Sink that records the batches it receives. When block is set, Write waits
+// until it is closed to simulate a slow sink.
+type recordingSink struct {
+	mu      sync.Mutex
+	batches [][]Event
+	closed  bool
+	block   chan struct{}
+	err     error
+}
+
+func (sink *recordingSink) Write(events []Event) error {
+	if sink.block != nil {
+		<-sink.block
+	}
+
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+	sink.batches = append(sink.batches, append([]Event{}, events...))
+	return sink.err
+}
+
+func (sink *recordingSink) Close() error {
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+	sink.closed = true
+	return nil
+}
+
+func (sink *recordingSink) batchSizes() []int {
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+
+	sizes := []int{}
+	for _, batch := range sink.batches {
+		sizes = append(sizes, len(batch))
+	}
+	return sizes
+}
+
+func testEvents(count int) []Event {
+	events := make([]Event, count)
+	for i := range events {
+		events[i] = NewEvent(EventDomainAvailability, time.Now())
+	}
+	return events
+}
+
+func TestBatchSinkFlushesOnBatchSize(t *testing.T) {
+	sink := &recordingSink{}
+	batch_sink := NewBatchSink("test", sink, SinkConfig{BatchSize: 2, FlushInterval: time.Hour, QueueSize: 10})
+
+	batch_sink.Emit(testEvents(5)...)
+	err := batch_sink.Close()
+	assert.Equal(t, err, nil)
+
+	// two full batches while running and the remainder on close
+	assert.Equal(t, sink.batchSizes(), []int{2, 2, 1})
+	assert.Equal(t, sink.closed, true)
+	assert.Equal(t, batch_sink.Dropped(), 0)
+}
+
+func TestBatchSinkFlushesOnInterval(t *testing.T) {
+	sink := &recordingSink{}
+	batch_sink := NewBatchSink("test", sink, SinkConfig{BatchSize: 100, FlushInterval: 10 * time.Millisecond, QueueSize: 10})
+	defer batch_sink.Close()
+
+	batch_sink.Emit(testEvents(3)...)
+
+	deadline := time.Now().Add(time.Second)
+	for len(sink.batchSizes()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	assert.Equal(t, sink.batchSizes(), []int{3})
+}
+
+func TestBatchSinkDropsWhenQueueIsFull(t *testing.T) {
+	sink := &recordingSink{block: make(chan struct{})}
+	batch_sink := NewBatchSink("test", sink, SinkConfig{BatchSize: 1, FlushInterval: time.Hour, QueueSize: 2})
+
+	// the first event is picked up and blocks in Write, the next two fill the queue
+	batch_sink.Emit(testEvents(1)...)
+	deadline := time.Now().Add(time.Second)
+	for len(batch_sink.queue) != 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	start := time.Now()
+	batch_sink.Emit(testEvents(5)...)
+	assert.Equal(t, time.Since(start) < 100*time.Millisecond, true)
+	assert.Equal(t, batch_sink.Dropped(), 3)
+
+	close(sink.block)
+	err := batch_sink.Close()
+	assert.Equal(t, err, nil)
+	assert.Equal(t, sink.batchSizes(), []int{1, 1, 1})
+
+	// emitting after close drops the events
+	batch_sink.Emit(testEvents(1)...)
+	assert.Equal(t, batch_sink.Dropped(), 4)
+}
+
+func TestBatchSinkWriteErrorDoesNotStopFlushing(t *testing.T) {
+	sink := &recordingSink{err: errors.New("write failed")}
+	batch_sink := NewBatchSink("test", sink, SinkConfig{BatchSize: 1, FlushInterval: time.Hour, QueueSize: 10})
+
+	batch_sink.Emit(testEvents(2)...)
+	err := batch_sink.Close()
+	assert.Equal(t, err, nil)
+	assert.Equal(t, sink.batchSizes(), []int{1, 1})
+}
+
+func TestBatchSinkCircuitBreaker(t *testing.T) {
+	sink := &recordingSink{err: errors.New("write failed")}
+	batch_sink := NewBatchSink("test", sink, SinkConfig{
+		BatchSize:      1,
+		FlushInterval:  time.Hour,
+		QueueSize:      10,
+		CircuitBreaker: BreakerConfig{FailureThreshold: 2, Cooldown: time.Hour},
+	})
+
+	// after two failures the breaker opens and the sink is no longer called
+	batch_sink.Emit(testEvents(4)...)
+	err := batch_sink.Close()
+	assert.Equal(t, err, nil)
+	assert.Equal(t, sink.batchSizes(), []int{1, 1})
+
+	status := batch_sink.breaker.Status()
+	assert.Equal(t, status.State, BreakerOpen)
+	assert.Equal(t, status.Rejected, 2)
+	assert.Equal(t, status.LastError, "write failed")
+
+	target := &HealthCheckTargets{Sinks: []*BatchSink{batch_sink}}
+	assert.Equal(t, target.IntegrationHealth(), []BreakerStatus{status})
+}
+
+func TestNewSink(t *testing.T) {
+	cases := []struct {
+		name         string
+		config       SinkConfig
+		expectedFail bool
+	}{
+		{
+			name:         "Unknown Sink Type",
+			config:       SinkConfig{Type: "foo"},
+			expectedFail: true,
+		},
+		{
+			name:         "File Sink Without Path",
+			config:       SinkConfig{Type: "file"},
+			expectedFail: true,
+		},
+		{
+			name:         "File Sink",
+			config:       SinkConfig{Type: "file", Path: t.TempDir() + "/results.jsonl"},
+			expectedFail: false,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			sink, err := NewSink(tc.config)
+			if tc.expectedFail {
+				assert.NotEqual(t, err, nil)
+				return
+			}
+
+			assert.Equal(t, err, nil)
+			assert.Equal(t, sink.Name(), tc.config.Type)
+			assert.Equal(t, sink.Close(), nil)
+		})
+	}
+}
+
+func TestEmitResults(t *testing.T) {
+	results_sink, events_sink := &recordingSink{}, &recordingSink{}
+	target := &HealthCheckTargets{Sinks: []*BatchSink{
+		NewBatchSink("results", results_sink, SinkConfig{BatchSize: 10, FlushInterval: time.Hour, QueueSize: 10, Results: true}),
+		NewBatchSink("events", events_sink, SinkConfig{BatchSize: 10, FlushInterval: time.Hour, QueueSize: 10}),
+	}}
+
+	timestamp := time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+	results := []CheckResult{
+		{Endpoint: "index", Url: "https://fetch.com/", Status: StatusUp, StatusCode: 200, Latency: 12 * time.Millisecond, StartedAt: timestamp},
+		{Endpoint: "careers", Url: "https://fetch.com/careers", Status: StatusDown, ErrorKind: ErrorKindTimeout, Error: "timed out", StartedAt: timestamp},
+	}
+	endpoints := &Endpoints{{Name: "index", Domain: &Domain{Name: "fetch.com"}}, {Name: "careers"}}
+	target.EmitResults(results, endpoints, timestamp)
+	target.CloseSinks()
+
+	assert.Equal(t, events_sink.batchSizes(), []int{})
+	assert.Equal(t, results_sink.batchSizes(), []int{2})
+	assert.Equal(t, results_sink.batches[0][0].Type, EventCheckResult)
+	assert.Equal(t, *results_sink.batches[0][0].Check, CheckEvent{Endpoint: "index", Url: "https://fetch.com/", Domain: "fetch.com",
+		Status: StatusUp, StatusCode: 200, LatencyMs: 12, StartedAt: timestamp})
+	assert.Equal(t, *results_sink.batches[0][1].Check, CheckEvent{Endpoint: "careers", Url: "https://fetch.com/careers",
+		Status: StatusDown, StartedAt: timestamp, ErrorKind: ErrorKindTimeout, Error: "timed out"})
+}
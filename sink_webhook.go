@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// WebhookSignatureHeader is the header carrying the signature of the events posted by a webhook
+// sink with a secret, of the form "t=<unix timestamp>,v1=<hex HMAC-SHA256>". The HMAC is computed
+// with the shared secret over the timestamp, a dot and the request body, so receivers can
+// authenticate the events and reject replayed requests by their timestamp.
+const WebhookSignatureHeader string = "Checkhealth-Signature"
+
+// DefaultWebhookTolerance is the maximum age of a signature accepted by VerifyWebhookSignature when
+// no tolerance is provided.
+const DefaultWebhookTolerance time.Duration = 5 * time.Minute
+
+// webhookTimeout bounds each request a webhook sink makes to its receiver.
+const webhookTimeout time.Duration = 10 * time.Second
+
+// ErrWebhookSignature is returned by VerifyWebhookSignature when a signature is missing, malformed,
+// expired or doesn't match the body.
+var ErrWebhookSignature = errors.New("invalid webhook signature")
+
+// WebhookSink is a Sink that posts every batch of events to a URL as a JSON array, signed with
+// HMAC-SHA256 when a secret is configured.
+type WebhookSink struct {
+	url    string
+	secret []byte
+	client *http.Client
+	now    func() time.Time
+}
+
+// NewWebhookSink creates a WebhookSink posting to config.Url, signing the requests with the secret
+// held by the config.SecretEnv environment variable when it is set.
+func NewWebhookSink(config SinkConfig) (Sink, error) {
+	target, err := url.Parse(config.Url)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return nil, fmt.Errorf("webhook sink requires an absolute http:// or https:// url")
+	}
+
+	var secret []byte
+	if config.SecretEnv != "" {
+		secret = []byte(os.Getenv(config.SecretEnv))
+		if len(secret) == 0 {
+			return nil, fmt.Errorf("environment variable %s is not set", config.SecretEnv)
+		}
+	}
+
+	return &WebhookSink{
+		url:    config.Url,
+		secret: secret,
+		client: &http.Client{Timeout: webhookTimeout},
+		now:    time.Now,
+	}, nil
+}
+
+// Write posts the batch of events to the webhook. Responses other than 2xx fail the write.
+func (sink *WebhookSink) Write(events []Event) error {
+	body, err := json.Marshal(events)
+	if err != nil {
+		return fmt.Errorf("failed to encode events: %v", err)
+	}
+
+	request, err := http.NewRequest(http.MethodPost, sink.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	if sink.secret != nil {
+		request.Header.Set(WebhookSignatureHeader, SignWebhook(sink.secret, body, sink.now()))
+	}
+
+	response, err := sink.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		message, _ := io.ReadAll(io.LimitReader(response.Body, 512))
+		return fmt.Errorf("POST %s returned status %d: %s", sink.url, response.StatusCode, strings.TrimSpace(string(message)))
+	}
+	_, err = io.Copy(io.Discard, response.Body)
+	return err
+}
+
+// Close releases the idle connections of the webhook sink.
+func (sink *WebhookSink) Close() error {
+	sink.client.CloseIdleConnections()
+	return nil
+}
+
+// SignWebhook returns the value of the WebhookSignatureHeader for a body posted at timestamp.
+func SignWebhook(secret []byte, body []byte, timestamp time.Time) string {
+	unix := strconv.FormatInt(timestamp.Unix(), 10)
+	return "t=" + unix + ",v1=" + hex.EncodeToString(webhookMAC(secret, unix, body))
+}
+
+// webhookMAC returns the HMAC-SHA256 of the signed payload of a webhook request.
+func webhookMAC(secret []byte, unix string, body []byte) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(unix))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return mac.Sum(nil)
+}
+
+// VerifyWebhookSignature checks the WebhookSignatureHeader of a request with body received at now,
+// for receivers written in Go. Signatures older than tolerance, DefaultWebhookTolerance when zero,
+// are rejected to prevent replays. Any of the v1 signatures of the header may match, so secrets
+// can be rotated.
+func VerifyWebhookSignature(secret []byte, body []byte, header string, tolerance time.Duration, now time.Time) error {
+	if tolerance <= 0 {
+		tolerance = DefaultWebhookTolerance
+	}
+
+	unix := ""
+	var signatures [][]byte
+	for _, field := range strings.Split(header, ",") {
+		key, value := field, ""
+		if i := strings.Index(field, "="); i >= 0 {
+			key, value = field[:i], field[i+1:]
+		}
+		switch strings.TrimSpace(key) {
+		case "t":
+			unix = value
+		case "v1":
+			if signature, err := hex.DecodeString(value); err == nil {
+				signatures = append(signatures, signature)
+			}
+		}
+	}
+
+	seconds, err := strconv.ParseInt(unix, 10, 64)
+	if err != nil || len(signatures) == 0 {
+		return fmt.Errorf("%w: expected t=<timestamp>,v1=<signature>", ErrWebhookSignature)
+	}
+	if age := now.Sub(time.Unix(seconds, 0)); age > tolerance || age < -tolerance {
+		return fmt.Errorf("%w: timestamp is %s away, beyond the tolerance of %s", ErrWebhookSignature, age.Round(time.Second), tolerance)
+	}
+
+	expected := webhookMAC(secret, unix, body)
+	for _, signature := range signatures {
+		if hmac.Equal(signature, expected) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: signature doesn't match the body", ErrWebhookSignature)
+}
+
+func init() {
+	RegisterSink("webhook", NewWebhookSink)
+}
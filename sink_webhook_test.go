@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/go-playground/assert/v2"
+)
+
+func TestWebhookSink(t *testing.T) {
+	timestamp := time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+	secret := []byte("whsec_test")
+	requests := make(chan *http.Request, 1)
+	bodies := make(chan []byte, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests <- r
+		bodies <- body
+		if r.URL.Path == "/fail" {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	os.Setenv("CHECKHEALTH_TEST_WEBHOOK_SECRET", string(secret))
+	defer os.Unsetenv("CHECKHEALTH_TEST_WEBHOOK_SECRET")
+
+	sink, err := NewWebhookSink(SinkConfig{Type: "webhook", Url: server.URL, SecretEnv: "CHECKHEALTH_TEST_WEBHOOK_SECRET"})
+	assert.Equal(t, err, nil)
+	sink.(*WebhookSink).now = func() time.Time { return timestamp }
+	defer sink.Close()
+
+	target := &HealthCheckTargets{Domains: &Domain{Name: "example.com", UpCount: 1, TotalRequests: 2}}
+	assert.Equal(t, sink.Write(target.DomainEvents(timestamp)), nil)
+
+	request, body := <-requests, <-bodies
+	assert.Equal(t, request.Header.Get("Content-Type"), "application/json")
+	var events []Event
+	assert.Equal(t, json.Unmarshal(body, &events), nil)
+	assert.Equal(t, len(events), 1)
+	assert.Equal(t, events[0].Domain.Name, "example.com")
+
+	signature := request.Header.Get(WebhookSignatureHeader)
+	assert.Equal(t, signature, SignWebhook(secret, body, timestamp))
+	assert.Equal(t, VerifyWebhookSignature(secret, body, signature, 0, timestamp.Add(time.Minute)), nil)
+
+	// non-2xx responses fail the write, so the circuit breaker counts them
+	failing, err := NewWebhookSink(SinkConfig{Type: "webhook", Url: server.URL + "/fail"})
+	assert.Equal(t, err, nil)
+	assert.NotEqual(t, failing.Write(target.DomainEvents(timestamp)), nil)
+	request = <-requests
+	<-bodies
+	assert.Equal(t, request.Header.Get(WebhookSignatureHeader), "")
+}
+
+func TestNewWebhookSink(t *testing.T) {
+	os.Setenv("CHECKHEALTH_TEST_WEBHOOK_SECRET", "whsec_test")
+	defer os.Unsetenv("CHECKHEALTH_TEST_WEBHOOK_SECRET")
+
+	cases := []struct {
+		name         string
+		config       SinkConfig
+		expectedFail bool
+	}{
+		{name: "Unsigned", config: SinkConfig{Type: "webhook", Url: "https://hooks.example.com/checkhealth"}},
+		{name: "Signed", config: SinkConfig{Type: "webhook", Url: "https://hooks.example.com/checkhealth", SecretEnv: "CHECKHEALTH_TEST_WEBHOOK_SECRET"}},
+		{name: "Missing URL", config: SinkConfig{Type: "webhook"}, expectedFail: true},
+		{name: "Relative URL", config: SinkConfig{Type: "webhook", Url: "/checkhealth"}, expectedFail: true},
+		{name: "Other Scheme", config: SinkConfig{Type: "webhook", Url: "ftp://hooks.example.com/"}, expectedFail: true},
+		{name: "Unset Secret", config: SinkConfig{Type: "webhook", Url: "https://hooks.example.com/", SecretEnv: "CHECKHEALTH_TEST_UNSET"}, expectedFail: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := NewWebhookSink(tc.config)
+			assert.Equal(t, err != nil, tc.expectedFail)
+		})
+	}
+}
+
+func TestVerifyWebhookSignature(t *testing.T) {
+	secret := []byte("whsec_test")
+	body := []byte(`[{"type":"domain_availability"}]`)
+	timestamp := time.Unix(1685620800, 0)
+	signature := SignWebhook(secret, body, timestamp)
+
+	cases := []struct {
+		name         string
+		body         []byte
+		header       string
+		now          time.Time
+		expectedFail bool
+	}{
+		{name: "Valid", body: body, header: signature, now: timestamp},
+		{name: "Rotated Secret", body: body, header: SignWebhook([]byte("old"), body, timestamp) + signature[len("t=1685620800"):], now: timestamp},
+		{name: "Within Tolerance", body: body, header: signature, now: timestamp.Add(4 * time.Minute)},
+		{name: "Expired", body: body, header: signature, now: timestamp.Add(6 * time.Minute), expectedFail: true},
+		{name: "Tampered Body", body: []byte(`[]`), header: signature, now: timestamp, expectedFail: true},
+		{name: "Wrong Secret", body: body, header: SignWebhook([]byte("other"), body, timestamp), now: timestamp, expectedFail: true},
+		{name: "Missing Timestamp", body: body, header: signature[len("t=1685620800,"):], now: timestamp, expectedFail: true},
+		{name: "Empty", body: body, header: "", now: timestamp, expectedFail: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := VerifyWebhookSignature(secret, tc.body, tc.header, 0, tc.now)
+			assert.Equal(t, err != nil, tc.expectedFail)
+		})
+	}
+}
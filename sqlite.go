@@ -0,0 +1,811 @@
+//go:build !nosqlite
+// +build !nosqlite
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"time"
+)
+
+// A minimal SQLite writer, enough to append rows to a single table of a database readable by the
+// sqlite3 shell or any SQLite library, without pulling in a SQLite driver and cgo. The rows are
+// only ever appended, with increasing rowids, so the table b-tree is never rebalanced: rows fill
+// the rightmost leaf page, and a full page is followed by a new one, splitting its parents up to
+// the root as needed. Every write is protected by a rollback journal, which SQLite itself rolls
+// back after a crash, and by the file locks of SQLite, so readers never see a partial write. See
+// https://www.sqlite.org/fileformat.html.
+//
+// The free pages left by deleted rows are never reused, new pages being always added at the end
+// of the file, so the freelist is kept as is until the database is vacuumed.
+
+// sqliteMagic starts every SQLite database.
+const sqliteMagic string = "SQLite format 3\x00"
+
+// sqlitePageSize is the size of the pages of the databases written. Databases with another page
+// size aren't supported.
+const sqlitePageSize int = 4096
+
+// sqliteMaxPayload is the largest record stored in a table leaf page without overflow pages,
+// which aren't supported.
+const sqliteMaxPayload int = sqlitePageSize - 35
+
+// sqliteVersion is the SQLite version number recorded as the last writer of the databases.
+const sqliteVersion uint32 = 3040000
+
+// sqliteTableRoot is the root page of the single table of the databases written, page 1 being the
+// root of the sqlite_schema table.
+const sqliteTableRoot uint32 = 2
+
+// Types of b-tree pages.
+const (
+	sqliteInteriorTable byte = 0x05
+	sqliteLeafTable     byte = 0x0d
+)
+
+// sqliteJournalMagic starts every rollback journal, whose header is padded to
+// sqliteJournalSector bytes.
+const (
+	sqliteJournalMagic  string = "\xd9\xd5\x05\xf9\x20\xa1\x63\xd7"
+	sqliteJournalSector int    = 512
+)
+
+// sqliteBusyTimeout is how long a write waits for the readers of the database to finish.
+const sqliteBusyTimeout time.Duration = 2 * time.Second
+
+// sqlitePage is a b-tree page of a database, page 1 starting with the database header.
+type sqlitePage struct {
+	number uint32
+	data   []byte
+}
+
+// newSQLitePage returns an empty b-tree page of the kind.
+func newSQLitePage(number uint32, kind byte) *sqlitePage {
+	page := &sqlitePage{number: number, data: make([]byte, sqlitePageSize)}
+	page.init(kind)
+	return page
+}
+
+// init empties the page as a b-tree page of the kind.
+func (page *sqlitePage) init(kind byte) {
+	header := page.data[page.offset():]
+	for i := range header {
+		header[i] = 0
+	}
+	header[0] = kind
+	binary.BigEndian.PutUint16(header[5:], uint16(sqlitePageSize))
+}
+
+// offset returns where the b-tree page header starts, after the database header on page 1.
+func (page *sqlitePage) offset() int {
+	if page.number == 1 {
+		return 100
+	}
+	return 0
+}
+
+func (page *sqlitePage) kind() byte {
+	return page.data[page.offset()]
+}
+
+func (page *sqlitePage) cellCount() int {
+	return int(binary.BigEndian.Uint16(page.data[page.offset()+3:]))
+}
+
+// contentStart returns the start of the cell content area, where a zero means 65536.
+func (page *sqlitePage) contentStart() int {
+	start := int(binary.BigEndian.Uint16(page.data[page.offset()+5:]))
+	if start == 0 {
+		return 65536
+	}
+	return start
+}
+
+// pointers returns the start of the cell pointer array, after the page header.
+func (page *sqlitePage) pointers() int {
+	if page.kind() == sqliteInteriorTable {
+		return page.offset() + 12
+	}
+	return page.offset() + 8
+}
+
+func (page *sqlitePage) rightPointer() uint32 {
+	return binary.BigEndian.Uint32(page.data[page.offset()+8:])
+}
+
+func (page *sqlitePage) setRightPointer(number uint32) {
+	binary.BigEndian.PutUint32(page.data[page.offset()+8:], number)
+}
+
+// cell returns the content of the cell at index, up to the end of the page.
+func (page *sqlitePage) cell(index int) []byte {
+	start := binary.BigEndian.Uint16(page.data[page.pointers()+2*index:])
+	return page.data[start:]
+}
+
+// append adds a cell after the last one, returning false if the page is full. Pages are never
+// freed into, so the free space is the gap between the pointers and the cell content.
+func (page *sqlitePage) append(cell []byte) bool {
+	count := page.cellCount()
+	end := page.pointers() + 2*count
+	if page.contentStart()-end < len(cell)+2 {
+		return false
+	}
+
+	start := page.contentStart() - len(cell)
+	copy(page.data[start:], cell)
+	binary.BigEndian.PutUint16(page.data[end:], uint16(start))
+	binary.BigEndian.PutUint16(page.data[page.offset()+3:], uint16(count+1))
+	binary.BigEndian.PutUint16(page.data[page.offset()+5:], uint16(start))
+	return true
+}
+
+// appendSQLiteVarint appends v as a SQLite variable-length integer, big-endian with 7 bits per
+// byte, the ninth byte carrying 8 bits.
+func appendSQLiteVarint(b []byte, v uint64) []byte {
+	if v > 1<<56-1 {
+		var buf [9]byte
+		buf[8] = byte(v)
+		v >>= 8
+		for i := 7; i >= 0; i-- {
+			buf[i] = byte(v&0x7f) | 0x80
+			v >>= 7
+		}
+		return append(b, buf[:]...)
+	}
+
+	var buf [8]byte
+	n := len(buf)
+	for {
+		n--
+		buf[n] = byte(v&0x7f) | 0x80
+		v >>= 7
+		if v == 0 {
+			break
+		}
+	}
+	buf[len(buf)-1] &= 0x7f
+	return append(b, buf[n:]...)
+}
+
+// readSQLiteVarint decodes the SQLite variable-length integer at the start of b, returning its
+// value and length, which is zero if b is truncated.
+func readSQLiteVarint(b []byte) (uint64, int) {
+	var v uint64
+	for i := 0; i < 8; i++ {
+		if i >= len(b) {
+			return 0, 0
+		}
+		v = v<<7 | uint64(b[i]&0x7f)
+		if b[i]&0x80 == 0 {
+			return v, i + 1
+		}
+	}
+	if len(b) < 9 {
+		return 0, 0
+	}
+	return v<<8 | uint64(b[8]), 9
+}
+
+// sqliteRecord encodes the values of a row in the SQLite record format. Values are nil, int64,
+// float64 or string, stored as NULL, INTEGER, REAL and TEXT.
+func sqliteRecord(values []interface{}) []byte {
+	var types, body []byte
+	for _, value := range values {
+		switch value := value.(type) {
+		case int64:
+			var size int
+			switch {
+			case value == 0:
+				types = append(types, 8)
+			case value == 1:
+				types = append(types, 9)
+			case value >= math.MinInt8 && value <= math.MaxInt8:
+				types, size = append(types, 1), 1
+			case value >= math.MinInt16 && value <= math.MaxInt16:
+				types, size = append(types, 2), 2
+			case value >= -1<<23 && value < 1<<23:
+				types, size = append(types, 3), 3
+			case value >= math.MinInt32 && value <= math.MaxInt32:
+				types, size = append(types, 4), 4
+			case value >= -1<<47 && value < 1<<47:
+				types, size = append(types, 5), 6
+			default:
+				types, size = append(types, 6), 8
+			}
+			var buf [8]byte
+			binary.BigEndian.PutUint64(buf[:], uint64(value))
+			body = append(body, buf[8-size:]...)
+		case float64:
+			types = append(types, 7)
+			var buf [8]byte
+			binary.BigEndian.PutUint64(buf[:], math.Float64bits(value))
+			body = append(body, buf[:]...)
+		case string:
+			types = appendSQLiteVarint(types, uint64(13+2*len(value)))
+			body = append(body, value...)
+		default:
+			types = append(types, 0)
+		}
+	}
+
+	// the header size counts its own varint
+	size := len(types) + 1
+	for len(appendSQLiteVarint(nil, uint64(size))) != size-len(types) {
+		size++
+	}
+	record := appendSQLiteVarint(make([]byte, 0, size+len(body)), uint64(size))
+	record = append(record, types...)
+	return append(record, body...)
+}
+
+// readSQLiteRecord decodes a record written by sqliteRecord.
+func readSQLiteRecord(record []byte) ([]interface{}, error) {
+	size, n := readSQLiteVarint(record)
+	if n == 0 || int(size) > len(record) {
+		return nil, fmt.Errorf("truncated record")
+	}
+
+	var values []interface{}
+	body := record[size:]
+	for header := record[n:size]; len(header) > 0; {
+		serial, n := readSQLiteVarint(header)
+		if n == 0 {
+			return nil, fmt.Errorf("truncated record header")
+		}
+		header = header[n:]
+
+		var length int
+		switch {
+		case serial == 0:
+			values = append(values, nil)
+			continue
+		case serial == 8 || serial == 9:
+			values = append(values, int64(serial-8))
+			continue
+		case serial >= 1 && serial <= 4:
+			length = int(serial)
+		case serial == 5:
+			length = 6
+		case serial == 6 || serial == 7:
+			length = 8
+		case serial >= 13 && serial%2 == 1:
+			length = int(serial-13) / 2
+		default:
+			return nil, fmt.Errorf("unsupported serial type %d", serial)
+		}
+		if length > len(body) {
+			return nil, fmt.Errorf("truncated record body")
+		}
+
+		field := body[:length]
+		body = body[length:]
+		switch {
+		case serial == 7:
+			values = append(values, math.Float64frombits(binary.BigEndian.Uint64(field)))
+		case serial >= 13:
+			values = append(values, string(field))
+		default:
+			// sign extend the big-endian integer
+			var v int64
+			if field[0]&0x80 != 0 {
+				v = -1
+			}
+			for _, b := range field {
+				v = v<<8 | int64(b)
+			}
+			values = append(values, v)
+		}
+	}
+	return values, nil
+}
+
+// sqliteDB is a database holding a single rowid table, rows being appended with Append.
+type sqliteDB struct {
+	file    *os.File
+	path    string
+	pages   uint32
+	counter uint32
+
+	// table and create_sql define the table, checked again when another connection changed the
+	// database since the last write.
+	table      string
+	create_sql string
+
+	// spine are the pages from the root of the table to its rightmost leaf, where rows are
+	// appended, and last_rowid the rowid of the last row.
+	spine      []uint32
+	last_rowid int64
+
+	// dirty are the pages modified by the write in progress, and originals the content of those
+	// that already existed, written to the rollback journal.
+	dirty     map[uint32]*sqlitePage
+	originals map[uint32][]byte
+}
+
+// openSQLite opens the database at path, created with the table defined by create_sql if it
+// doesn't exist or is empty. A hot journal left by an interrupted write is rolled back first. An
+// error is returned if the database isn't a single table database defined by create_sql.
+func openSQLite(path string, table string, create_sql string) (*sqliteDB, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %v", path, err)
+	}
+	db := &sqliteDB{file: file, path: path, table: table, create_sql: create_sql}
+	if err := db.open(table, create_sql); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// open loads the database, rolling back a hot journal and creating the table first as needed.
+func (db *sqliteDB) open(table string, create_sql string) error {
+	if err := lockSQLite(db.file); err != nil {
+		return fmt.Errorf("failed to lock %s: %v", db.path, err)
+	}
+	defer unlockSQLite(db.file)
+
+	if err := db.rollback(); err != nil {
+		return err
+	}
+
+	info, err := db.file.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %v", db.path, err)
+	}
+	if info.Size() == 0 {
+		return db.create(table, create_sql)
+	}
+	return db.load(table, create_sql)
+}
+
+// create writes an empty database defining the table, made of the sqlite_schema table on page 1
+// and the empty table on page 2.
+func (db *sqliteDB) create(table string, create_sql string) error {
+	schema := newSQLitePage(1, sqliteLeafTable)
+	header := schema.data
+	copy(header, sqliteMagic)
+	binary.BigEndian.PutUint16(header[16:], uint16(sqlitePageSize))
+	header[18], header[19] = 1, 1                   // legacy file format, with a rollback journal
+	header[21], header[22], header[23] = 64, 32, 32 // payload fractions, which must be these values
+	binary.BigEndian.PutUint32(header[40:], 1)      // schema cookie
+	binary.BigEndian.PutUint32(header[44:], 4)      // schema format
+	binary.BigEndian.PutUint32(header[56:], 1)      // UTF-8 text encoding
+
+	record := sqliteRecord([]interface{}{"table", table, table, int64(sqliteTableRoot), create_sql})
+	if !schema.append(sqliteCell(1, record)) {
+		return fmt.Errorf("table definition too large")
+	}
+
+	db.spine = []uint32{sqliteTableRoot}
+	db.last_rowid = 0
+	db.dirty = map[uint32]*sqlitePage{1: schema, sqliteTableRoot: newSQLitePage(sqliteTableRoot, sqliteLeafTable)}
+	db.originals = map[uint32][]byte{}
+	db.pages = 2
+	return db.commit()
+}
+
+// load reads the state of an existing database, checking it only holds the table. The freelist of
+// a database whose rows were deleted is left untouched, as its pages aren't reused.
+func (db *sqliteDB) load(table string, create_sql string) error {
+	schema, err := db.read(1)
+	if err != nil {
+		return err
+	}
+	header := schema.data
+	if string(header[:len(sqliteMagic)]) != sqliteMagic {
+		return fmt.Errorf("%s isn't a SQLite database", db.path)
+	}
+	if size := int(binary.BigEndian.Uint16(header[16:])); size != sqlitePageSize {
+		return fmt.Errorf("%s has pages of %d bytes, only %d is supported", db.path, size, sqlitePageSize)
+	}
+	db.counter = binary.BigEndian.Uint32(header[24:])
+	db.pages = binary.BigEndian.Uint32(header[28:])
+
+	// the schema must only define the table, as other tables and indexes wouldn't be updated
+	if schema.kind() != sqliteLeafTable || schema.cellCount() != 1 {
+		return fmt.Errorf("%s must only contain the %s table", db.path, table)
+	}
+	_, record, err := readSQLiteCell(schema.cell(0))
+	if err != nil {
+		return fmt.Errorf("failed to read the schema of %s: %v", db.path, err)
+	}
+	values, err := readSQLiteRecord(record)
+	if err != nil || len(values) != 5 || values[1] != table || values[3] != int64(sqliteTableRoot) {
+		return fmt.Errorf("%s must only contain the %s table", db.path, table)
+	}
+	if values[4] != create_sql {
+		return fmt.Errorf("the %s table of %s has another definition than %q", table, db.path, create_sql)
+	}
+
+	// follow the rightmost pointers down to the last leaf
+	db.spine = nil
+	for number := sqliteTableRoot; ; {
+		page, err := db.read(number)
+		if err != nil {
+			return err
+		}
+		db.spine = append(db.spine, number)
+
+		switch page.kind() {
+		case sqliteInteriorTable:
+			number = page.rightPointer()
+			if number <= 1 || number > db.pages || len(db.spine) > 20 {
+				return fmt.Errorf("%s is corrupt: invalid child page %d", db.path, number)
+			}
+		case sqliteLeafTable:
+			db.last_rowid = 0
+			if count := page.cellCount(); count > 0 {
+				rowid, _, err := readSQLiteCell(page.cell(count - 1))
+				if err != nil {
+					return fmt.Errorf("%s is corrupt: %v", db.path, err)
+				}
+				db.last_rowid = rowid
+			}
+			return nil
+		default:
+			return fmt.Errorf("%s is corrupt: unexpected page type %d", db.path, page.kind())
+		}
+	}
+}
+
+// read reads the page numbered number from the database.
+func (db *sqliteDB) read(number uint32) (*sqlitePage, error) {
+	page := &sqlitePage{number: number, data: make([]byte, sqlitePageSize)}
+	if _, err := db.file.ReadAt(page.data, int64(number-1)*int64(sqlitePageSize)); err != nil {
+		return nil, fmt.Errorf("failed to read page %d of %s: %v", number, db.path, err)
+	}
+	return page, nil
+}
+
+// page returns the page numbered number for modification by the write in progress.
+func (db *sqliteDB) page(number uint32) (*sqlitePage, error) {
+	if page, ok := db.dirty[number]; ok {
+		return page, nil
+	}
+	page, err := db.read(number)
+	if err != nil {
+		return nil, err
+	}
+	db.originals[number] = append([]byte(nil), page.data...)
+	db.dirty[number] = page
+	return page, nil
+}
+
+// allocate adds an empty page of the kind at the end of the database.
+func (db *sqliteDB) allocate(kind byte) *sqlitePage {
+	db.pages++
+	page := newSQLitePage(db.pages, kind)
+	db.dirty[page.number] = page
+	return page
+}
+
+// sqliteCell returns the table leaf cell of a record.
+func sqliteCell(rowid int64, record []byte) []byte {
+	cell := appendSQLiteVarint(nil, uint64(len(record)))
+	cell = appendSQLiteVarint(cell, uint64(rowid))
+	return append(cell, record...)
+}
+
+// readSQLiteCell decodes a table leaf cell, returning its rowid and record.
+func readSQLiteCell(cell []byte) (int64, []byte, error) {
+	size, n := readSQLiteVarint(cell)
+	rowid, m := readSQLiteVarint(cell[n:])
+	if n == 0 || m == 0 || n+m+int(size) > len(cell) {
+		return 0, nil, fmt.Errorf("truncated cell")
+	}
+	return int64(rowid), cell[n+m : n+m+int(size)], nil
+}
+
+// Append appends the records as new rows of the table, with the next rowids, in a single write.
+// The database is reloaded first if another connection changed it since the last write, e.g. to
+// delete rows. The database is left unchanged when an error is returned.
+func (db *sqliteDB) Append(records [][]byte) error {
+	if len(records) == 0 {
+		return nil
+	}
+
+	if err := lockSQLite(db.file); err != nil {
+		return fmt.Errorf("failed to lock %s: %v", db.path, err)
+	}
+	defer unlockSQLite(db.file)
+	if err := db.reload(); err != nil {
+		return err
+	}
+
+	pages, spine, last_rowid := db.pages, append([]uint32(nil), db.spine...), db.last_rowid
+	db.dirty, db.originals = map[uint32]*sqlitePage{}, map[uint32][]byte{}
+	err := db.append(records)
+	if err == nil {
+		err = db.commit()
+	}
+	if err != nil {
+		db.pages, db.spine, db.last_rowid = pages, spine, last_rowid
+	}
+	db.dirty, db.originals = nil, nil
+	return err
+}
+
+// reload reads the state of the database again if its change counter was incremented by another
+// connection since the last write, as the pages of the table may have been freed or moved.
+func (db *sqliteDB) reload() error {
+	schema, err := db.read(1)
+	if err != nil {
+		return err
+	}
+	if binary.BigEndian.Uint32(schema.data[24:]) == db.counter {
+		return nil
+	}
+	if err := db.load(db.table, db.create_sql); err != nil {
+		// load again on the next write
+		db.counter = 0
+		return err
+	}
+	return nil
+}
+
+// append adds the records to the pages of the write in progress.
+func (db *sqliteDB) append(records [][]byte) error {
+	for _, record := range records {
+		if len(record) > sqliteMaxPayload {
+			return fmt.Errorf("record of %d bytes exceeds the limit of %d bytes", len(record), sqliteMaxPayload)
+		}
+		cell := sqliteCell(db.last_rowid+1, record)
+
+		leaf, err := db.page(db.spine[len(db.spine)-1])
+		if err != nil {
+			return err
+		}
+		if !leaf.append(cell) {
+			next := db.allocate(sqliteLeafTable)
+			next.append(cell)
+			if err := db.split(0, db.last_rowid, next.number); err != nil {
+				return err
+			}
+		}
+		db.last_rowid++
+	}
+	return nil
+}
+
+// split makes right the new rightmost sibling of the full page of the spine at height, the leaf
+// being at height 0, key being the largest rowid of the full page. The full page is added to the
+// cells of its parent, which is split in turn when it is full too.
+func (db *sqliteDB) split(height int, key int64, right uint32) error {
+	if height == len(db.spine)-1 {
+		if err := db.deepen(); err != nil {
+			return err
+		}
+	}
+
+	index := len(db.spine) - 1 - height
+	parent, err := db.page(db.spine[index-1])
+	if err != nil {
+		return err
+	}
+	cell := make([]byte, 4, 13)
+	binary.BigEndian.PutUint32(cell, db.spine[index])
+	cell = appendSQLiteVarint(cell, uint64(key))
+	if parent.append(cell) {
+		parent.setRightPointer(right)
+	} else {
+		sibling := db.allocate(sqliteInteriorTable)
+		sibling.setRightPointer(right)
+		if err := db.split(height+1, key, sibling.number); err != nil {
+			return err
+		}
+	}
+
+	// the spine may have been deepened by the parents' split
+	db.spine[len(db.spine)-1-height] = right
+	return nil
+}
+
+// deepen moves the content of the root page, which keeps its number, to a new page, and makes the
+// root an interior page whose only child is the new page.
+func (db *sqliteDB) deepen() error {
+	root, err := db.page(db.spine[0])
+	if err != nil {
+		return err
+	}
+	child := db.allocate(root.kind())
+	copy(child.data, root.data)
+	root.init(sqliteInteriorTable)
+	root.setRightPointer(child.number)
+	db.spine = append([]uint32{db.spine[0], child.number}, db.spine[1:]...)
+	return nil
+}
+
+// commit writes the pages of the write in progress, saving the original content of the pages
+// modified to the rollback journal first. The caller holds the exclusive lock.
+func (db *sqliteDB) commit() error {
+	schema, err := db.page(1)
+	if err != nil {
+		return err
+	}
+	db.counter++
+	binary.BigEndian.PutUint32(schema.data[24:], db.counter)
+	binary.BigEndian.PutUint32(schema.data[28:], db.pages)
+	binary.BigEndian.PutUint32(schema.data[92:], db.counter)
+	binary.BigEndian.PutUint32(schema.data[96:], sqliteVersion)
+
+	if len(db.originals) > 0 {
+		if err := db.writeJournal(); err != nil {
+			return err
+		}
+	}
+
+	numbers := make([]uint32, 0, len(db.dirty))
+	for number := range db.dirty {
+		numbers = append(numbers, number)
+	}
+	sort.Slice(numbers, func(i, j int) bool { return numbers[i] < numbers[j] })
+	for _, number := range numbers {
+		if _, err := db.file.WriteAt(db.dirty[number].data, int64(number-1)*int64(sqlitePageSize)); err != nil {
+			db.rollback()
+			return fmt.Errorf("failed to write %s: %v", db.path, err)
+		}
+	}
+	if err := db.file.Sync(); err != nil {
+		db.rollback()
+		return fmt.Errorf("failed to write %s: %v", db.path, err)
+	}
+
+	if err := os.Remove(db.path + "-journal"); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove the journal of %s: %v", db.path, err)
+	}
+	return nil
+}
+
+// writeJournal writes the original content of the modified pages to the rollback journal, and the
+// size of the database before the write, which is restored if the write is interrupted.
+func (db *sqliteDB) writeJournal() error {
+	numbers := make([]uint32, 0, len(db.originals))
+	for number := range db.originals {
+		numbers = append(numbers, number)
+	}
+	sort.Slice(numbers, func(i, j int) bool { return numbers[i] < numbers[j] })
+
+	// the pages allocated by the write are past the original size
+	original_pages := db.pages - uint32(len(db.dirty)-len(db.originals))
+
+	nonce := uint32(time.Now().UnixNano())
+	var journal bytes.Buffer
+	header := make([]byte, sqliteJournalSector)
+	copy(header, sqliteJournalMagic)
+	binary.BigEndian.PutUint32(header[8:], uint32(len(numbers)))
+	binary.BigEndian.PutUint32(header[12:], nonce)
+	binary.BigEndian.PutUint32(header[16:], original_pages)
+	binary.BigEndian.PutUint32(header[20:], uint32(sqliteJournalSector))
+	binary.BigEndian.PutUint32(header[24:], uint32(sqlitePageSize))
+	journal.Write(header)
+	for _, number := range numbers {
+		data := db.originals[number]
+		binary.Write(&journal, binary.BigEndian, number)
+		journal.Write(data)
+		binary.Write(&journal, binary.BigEndian, sqliteJournalChecksum(nonce, data))
+	}
+
+	file, err := os.OpenFile(db.path+"-journal", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to write the journal of %s: %v", db.path, err)
+	}
+	if _, err := file.Write(journal.Bytes()); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write the journal of %s: %v", db.path, err)
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write the journal of %s: %v", db.path, err)
+	}
+	return file.Close()
+}
+
+// sqliteJournalChecksum returns the checksum of a page of the rollback journal, the sum of the
+// nonce and of every 200th byte of the page, starting from the end.
+func sqliteJournalChecksum(nonce uint32, data []byte) uint32 {
+	checksum := nonce
+	for i := len(data) - 200; i > 0; i -= 200 {
+		checksum += uint32(data[i])
+	}
+	return checksum
+}
+
+// rollback restores the pages saved to the rollback journal and the original size of the
+// database, if a journal was left by an interrupted write, and removes the journal. Pages whose
+// checksum doesn't match, which were being written to the journal, and the following ones are
+// ignored, as the database wasn't written yet.
+func (db *sqliteDB) rollback() error {
+	journal, err := os.ReadFile(db.path + "-journal")
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read the journal of %s: %v", db.path, err)
+	}
+
+	if len(journal) >= 28 && string(journal[:8]) == sqliteJournalMagic {
+		count := binary.BigEndian.Uint32(journal[8:])
+		nonce := binary.BigEndian.Uint32(journal[12:])
+		original_pages := binary.BigEndian.Uint32(journal[16:])
+		sector := int(binary.BigEndian.Uint32(journal[20:]))
+		page_size := int(binary.BigEndian.Uint32(journal[24:]))
+		if sector <= 0 || page_size != sqlitePageSize {
+			return fmt.Errorf("unsupported journal of %s", db.path)
+		}
+
+		records := journal[sector:]
+		for i := uint32(0); i < count && len(records) >= page_size+8; i++ {
+			number := binary.BigEndian.Uint32(records)
+			data := records[4 : 4+page_size]
+			if binary.BigEndian.Uint32(records[4+page_size:]) != sqliteJournalChecksum(nonce, data) {
+				break
+			}
+			if _, err := db.file.WriteAt(data, int64(number-1)*int64(page_size)); err != nil {
+				return fmt.Errorf("failed to roll back %s: %v", db.path, err)
+			}
+			records = records[page_size+8:]
+		}
+		if err := db.file.Truncate(int64(original_pages) * int64(page_size)); err != nil {
+			return fmt.Errorf("failed to roll back %s: %v", db.path, err)
+		}
+		if err := db.file.Sync(); err != nil {
+			return fmt.Errorf("failed to roll back %s: %v", db.path, err)
+		}
+	}
+	if err := os.Remove(db.path + "-journal"); err != nil {
+		return fmt.Errorf("failed to remove the journal of %s: %v", db.path, err)
+	}
+	return nil
+}
+
+// Close closes the database file.
+func (db *sqliteDB) Close() error {
+	return db.file.Close()
+}
+
+// rows reads every row of the table rooted at root, in rowid order, to read back a database.
+func (db *sqliteDB) rows(root uint32) ([][]interface{}, error) {
+	page, err := db.read(root)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows [][]interface{}
+	switch page.kind() {
+	case sqliteInteriorTable:
+		children := make([]uint32, 0, page.cellCount()+1)
+		for i := 0; i < page.cellCount(); i++ {
+			children = append(children, binary.BigEndian.Uint32(page.cell(i)))
+		}
+		for _, child := range append(children, page.rightPointer()) {
+			child_rows, err := db.rows(child)
+			if err != nil {
+				return nil, err
+			}
+			rows = append(rows, child_rows...)
+		}
+	case sqliteLeafTable:
+		for i := 0; i < page.cellCount(); i++ {
+			_, record, err := readSQLiteCell(page.cell(i))
+			if err != nil {
+				return nil, err
+			}
+			values, err := readSQLiteRecord(record)
+			if err != nil {
+				return nil, err
+			}
+			rows = append(rows, values)
+		}
+	default:
+		return nil, fmt.Errorf("unexpected page type %d", page.kind())
+	}
+	return rows, nil
+}
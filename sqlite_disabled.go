@@ -0,0 +1,28 @@
+//go:build nosqlite
+// +build nosqlite
+
+package main
+
+import "errors"
+
+// Binaries built with the nosqlite tag don't append the check history to a SQLite database: the
+// sqlite_file setting is refused, see ApplySettings.
+
+// errSQLiteDisabled is returned when a SQLite database would be opened.
+var errSQLiteDisabled = errors.New("sqlite isn't compiled into the binary, which was built with the nosqlite tag")
+
+// SQLiteHistory appends nothing, as NewSQLiteHistory always fails.
+type SQLiteHistory struct {
+	path string
+}
+
+// NewSQLiteHistory fails, as SQLite isn't compiled into the binary.
+func NewSQLiteHistory(path string) (*SQLiteHistory, error) {
+	return nil, errSQLiteDisabled
+}
+
+// Observe is a method for SQLiteHistory that does nothing.
+func (history *SQLiteHistory) Observe(results []CheckResult, endpoints *Endpoints) {}
+
+// Close is a method for SQLiteHistory that does nothing.
+func (history *SQLiteHistory) Close() {}
@@ -0,0 +1,63 @@
+//go:build (linux || darwin) && !nosqlite
+// +build linux darwin
+// +build !nosqlite
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"syscall"
+	"time"
+)
+
+// The byte ranges locked by SQLite, past the first gigabyte of the database: readers hold a read
+// lock on a byte of the shared range while reading, and writers take the reserved and pending
+// bytes, then a write lock on the whole shared range to wait for the readers to finish.
+const (
+	sqlitePendingByte  int64 = 0x40000000
+	sqliteReservedByte int64 = sqlitePendingByte + 1
+	sqliteSharedFirst  int64 = sqlitePendingByte + 2
+	sqliteSharedSize   int64 = 510
+)
+
+// lockSQLite takes the exclusive lock of SQLite on the database file, so readers never see a
+// partial write, waiting up to sqliteBusyTimeout for the readers to finish.
+func lockSQLite(file *os.File) error {
+	if err := flockSQLite(file, syscall.F_WRLCK, sqliteReservedByte, 1); err != nil {
+		return fmt.Errorf("database is locked by another writer: %v", err)
+	}
+	if err := flockSQLite(file, syscall.F_WRLCK, sqlitePendingByte, 1); err != nil {
+		unlockSQLite(file)
+		return fmt.Errorf("database is locked by another writer: %v", err)
+	}
+
+	deadline := time.Now().Add(sqliteBusyTimeout)
+	for {
+		err := flockSQLite(file, syscall.F_WRLCK, sqliteSharedFirst, sqliteSharedSize)
+		if err == nil {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			unlockSQLite(file)
+			return fmt.Errorf("database is busy: %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// unlockSQLite releases the locks taken by lockSQLite.
+func unlockSQLite(file *os.File) {
+	flockSQLite(file, syscall.F_UNLCK, sqlitePendingByte, 2+sqliteSharedSize)
+}
+
+// flockSQLite sets a POSIX advisory lock of the type on a byte range of the file, without waiting.
+func flockSQLite(file *os.File, lock_type int16, start int64, length int64) error {
+	return syscall.FcntlFlock(file.Fd(), syscall.F_SETLK, &syscall.Flock_t{
+		Type:   lock_type,
+		Whence: io.SeekStart,
+		Start:  start,
+		Len:    length,
+	})
+}
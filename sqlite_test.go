@@ -0,0 +1,242 @@
+//go:build !nosqlite
+// +build !nosqlite
+
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-playground/assert/v2"
+)
+
+func TestSQLiteVarint(t *testing.T) {
+	cases := []struct {
+		value  uint64
+		length int
+	}{
+		{value: 0, length: 1},
+		{value: 127, length: 1},
+		{value: 128, length: 2},
+		{value: 16383, length: 2},
+		{value: 16384, length: 3},
+		{value: 1<<56 - 1, length: 8},
+		{value: 1 << 56, length: 9},
+		{value: math.MaxUint64, length: 9},
+	}
+
+	for _, tc := range cases {
+		t.Run(fmt.Sprint(tc.value), func(t *testing.T) {
+			encoded := appendSQLiteVarint(nil, tc.value)
+			assert.Equal(t, len(encoded), tc.length)
+			value, n := readSQLiteVarint(encoded)
+			assert.Equal(t, value, tc.value)
+			assert.Equal(t, n, tc.length)
+		})
+	}
+
+	_, n := readSQLiteVarint([]byte{0x81})
+	assert.Equal(t, n, 0)
+}
+
+func TestSQLiteRecord(t *testing.T) {
+	values := []interface{}{
+		nil, int64(0), int64(1), int64(-1), int64(200), int64(-40000), int64(1 << 30), int64(-1 << 40), int64(math.MinInt64),
+		1.5, "", "héllo", strings.Repeat("x", 200),
+	}
+	record := sqliteRecord(values)
+	decoded, err := readSQLiteRecord(record)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, decoded, values)
+
+	_, err = readSQLiteRecord(record[:len(record)-1])
+	assert.NotEqual(t, err, nil)
+}
+
+func TestSQLiteAppend(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	const schema = "CREATE TABLE test (id INTEGER PRIMARY KEY, value TEXT)"
+	db, err := openSQLite(path, "test", schema)
+	assert.Equal(t, err, nil)
+
+	// enough rows to split the leaves, and the interior pages up to a root of 3 levels
+	text := strings.Repeat("v", 1000)
+	for batch := 0; batch < 4; batch++ {
+		records := make([][]byte, 0, 700)
+		for i := 0; i < 700; i++ {
+			records = append(records, sqliteRecord([]interface{}{nil, fmt.Sprintf("%d %s", batch*700+i, text)}))
+		}
+		assert.Equal(t, db.Append(records), nil)
+	}
+	assert.Equal(t, len(db.spine), 3)
+	db.Close()
+
+	// rows are appended after the existing ones once reopened
+	db, err = openSQLite(path, "test", schema)
+	assert.Equal(t, err, nil)
+	defer db.Close()
+	assert.Equal(t, db.last_rowid, int64(2800))
+	assert.Equal(t, db.Append([][]byte{sqliteRecord([]interface{}{nil, "last"})}), nil)
+
+	rows, err := db.rows(sqliteTableRoot)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, len(rows), 2801)
+	for i, row := range rows[:2800] {
+		assert.Equal(t, row[1], fmt.Sprintf("%d %s", i, text))
+	}
+	assert.Equal(t, rows[2800][1], "last")
+
+	// rows too large for a page are refused, leaving the database unchanged
+	assert.NotEqual(t, db.Append([][]byte{sqliteRecord([]interface{}{nil, strings.Repeat("x", sqlitePageSize)})}), nil)
+	assert.Equal(t, db.last_rowid, int64(2801))
+	_, err = os.Stat(path + "-journal")
+	assert.Equal(t, os.IsNotExist(err), true)
+}
+
+func TestSQLiteRollback(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	const schema = "CREATE TABLE test (id INTEGER PRIMARY KEY, value TEXT)"
+	db, err := openSQLite(path, "test", schema)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, db.Append([][]byte{sqliteRecord([]interface{}{nil, "committed"})}), nil)
+	before, err := os.ReadFile(path)
+	assert.Equal(t, err, nil)
+
+	// a write interrupted after the journal and some of the pages are written
+	db.dirty, db.originals = map[uint32]*sqlitePage{}, map[uint32][]byte{}
+	assert.Equal(t, db.append([][]byte{sqliteRecord([]interface{}{nil, strings.Repeat("x", 3000)}), sqliteRecord([]interface{}{nil, "lost"})}), nil)
+	assert.Equal(t, db.writeJournal(), nil)
+	for number, page := range db.dirty {
+		_, err := db.file.WriteAt(page.data, int64(number-1)*int64(sqlitePageSize))
+		assert.Equal(t, err, nil)
+	}
+	db.Close()
+
+	// the hot journal is rolled back when the database is opened again
+	db, err = openSQLite(path, "test", schema)
+	assert.Equal(t, err, nil)
+	defer db.Close()
+	after, err := os.ReadFile(path)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, after, before)
+	_, err = os.Stat(path + "-journal")
+	assert.Equal(t, os.IsNotExist(err), true)
+	assert.Equal(t, db.last_rowid, int64(1))
+}
+
+func TestSQLiteFreelist(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	const schema = "CREATE TABLE test (id INTEGER PRIMARY KEY, value TEXT)"
+	db, err := openSQLite(path, "test", schema)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, db.Append([][]byte{sqliteRecord([]interface{}{nil, "first"})}), nil)
+	db.Close()
+
+	// a freelist trunk page without leaves, as left by deleting rows with the sqlite3 shell
+	file, err := os.OpenFile(path, os.O_RDWR, 0)
+	assert.Equal(t, err, nil)
+	_, err = file.WriteAt(make([]byte, sqlitePageSize), 2*int64(sqlitePageSize))
+	assert.Equal(t, err, nil)
+	header := make([]byte, 8)
+	binary.BigEndian.PutUint32(header, 3)
+	_, err = file.WriteAt(header[:4], 28)
+	assert.Equal(t, err, nil)
+	binary.BigEndian.PutUint32(header[4:], 1)
+	_, err = file.WriteAt(header, 32)
+	assert.Equal(t, err, nil)
+	file.Close()
+
+	// rows are still appended, in new pages past the free ones, which are kept in the freelist
+	db, err = openSQLite(path, "test", schema)
+	assert.Equal(t, err, nil)
+	defer db.Close()
+	text := strings.Repeat("v", 1000)
+	records := make([][]byte, 0, 10)
+	for i := 0; i < 10; i++ {
+		records = append(records, sqliteRecord([]interface{}{nil, text}))
+	}
+	assert.Equal(t, db.Append(records), nil)
+	assert.Equal(t, db.pages > 3, true)
+
+	rows, err := db.rows(sqliteTableRoot)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, len(rows), 11)
+	schema_page, err := db.read(1)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, schema_page.data[32:40], header)
+}
+
+func TestSQLiteReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	const schema = "CREATE TABLE test (id INTEGER PRIMARY KEY, value TEXT)"
+	db, err := openSQLite(path, "test", schema)
+	assert.Equal(t, err, nil)
+	defer db.Close()
+	other, err := openSQLite(path, "test", schema)
+	assert.Equal(t, err, nil)
+	defer other.Close()
+
+	// each connection appends after the rows written by the other one
+	text := strings.Repeat("v", 1000)
+	for i := 0; i < 20; i++ {
+		writer := db
+		if i%2 == 1 {
+			writer = other
+		}
+		assert.Equal(t, writer.Append([][]byte{sqliteRecord([]interface{}{nil, fmt.Sprintf("%d %s", i, text)})}), nil)
+	}
+
+	rows, err := db.rows(sqliteTableRoot)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, len(rows), 20)
+	for i, row := range rows {
+		assert.Equal(t, row[0], nil)
+		assert.Equal(t, row[1], fmt.Sprintf("%d %s", i, text))
+	}
+	assert.Equal(t, db.last_rowid, int64(19))
+	assert.Equal(t, other.last_rowid, int64(20))
+}
+
+func TestOpenSQLite(t *testing.T) {
+	dir := t.TempDir()
+	const schema = "CREATE TABLE test (id INTEGER PRIMARY KEY, value TEXT)"
+	not_sqlite := filepath.Join(dir, "not_sqlite.db")
+	assert.Equal(t, os.WriteFile(not_sqlite, make([]byte, sqlitePageSize), 0o644), nil)
+	other_table := filepath.Join(dir, "other_table.db")
+	db, err := openSQLite(other_table, "other", "CREATE TABLE other (id INTEGER PRIMARY KEY)")
+	assert.Equal(t, err, nil)
+	db.Close()
+	other_schema := filepath.Join(dir, "other_schema.db")
+	db, err = openSQLite(other_schema, "test", "CREATE TABLE test (id INTEGER PRIMARY KEY)")
+	assert.Equal(t, err, nil)
+	db.Close()
+
+	cases := []struct {
+		name         string
+		path         string
+		expectedFail bool
+	}{
+		{name: "New Database", path: filepath.Join(dir, "new.db")},
+		{name: "Not SQLite", path: not_sqlite, expectedFail: true},
+		{name: "Other Table", path: other_table, expectedFail: true},
+		{name: "Other Schema", path: other_schema, expectedFail: true},
+		{name: "Missing Directory", path: filepath.Join(dir, "missing", "test.db"), expectedFail: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			db, err := openSQLite(tc.path, "test", schema)
+			if tc.expectedFail {
+				assert.NotEqual(t, err, nil)
+				return
+			}
+			assert.Equal(t, err, nil)
+			db.Close()
+		})
+	}
+}
@@ -0,0 +1,278 @@
+//go:build !nossh
+// +build !nossh
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// SSH endpoints connect to the host of their ssh://user@host:port URL with key authentication, run
+// their command, and are up when it exits with status 0, so host-level health such as disk usage
+// or running processes can be checked alongside HTTP endpoints. The command output is evaluated
+// like a response body by success_when and the body assertions, with the exit status as status.
+
+// DefaultSSHPort is the port SSH endpoints connect to when their URL doesn't have one.
+const DefaultSSHPort string = "22"
+
+// ErrorKindCommand classifies SSH checks whose command exited with a non-zero status.
+const ErrorKindCommand string = "command"
+
+// validateSSH rejects SSH endpoints without a user, host or command, or whose key or known hosts
+// can't be loaded.
+func (endpoint *Endpoint) validateSSH() error {
+	if endpoint.SSHCommand == "" {
+		return errors.New("ssh_command is required by SSH endpoints")
+	}
+	_, _, err := endpoint.sshConfig()
+	return err
+}
+
+// sshConfig returns the address and client configuration of the SSH or SFTP endpoint, whose URL
+// scheme is its type.
+func (endpoint *Endpoint) sshConfig() (string, *ssh.ClientConfig, error) {
+	target, err := url.Parse(endpoint.Url)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to parse url: %v", err)
+	}
+	if target.Scheme != endpoint.Type || target.User == nil || target.User.Username() == "" || target.Hostname() == "" {
+		return "", nil, fmt.Errorf("url %q of an %s endpoint must be of the form %s://user@host[:port]", endpoint.Url, endpoint.Type, endpoint.Type)
+	}
+	port := target.Port()
+	if port == "" {
+		port = DefaultSSHPort
+	}
+
+	if endpoint.SSHKeyFile == "" {
+		return "", nil, errors.New("ssh_key_file is required by SSH endpoints")
+	}
+	key, err := os.ReadFile(endpoint.SSHKeyFile)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to read ssh_key_file: %v", err)
+	}
+	var signer ssh.Signer
+	if endpoint.SSHPassphraseEnv != "" {
+		signer, err = ssh.ParsePrivateKeyWithPassphrase(key, []byte(os.Getenv(endpoint.SSHPassphraseEnv)))
+	} else {
+		signer, err = ssh.ParsePrivateKey(key)
+	}
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to parse ssh_key_file: %v", err)
+	}
+
+	host_key := ssh.InsecureIgnoreHostKey()
+	if !endpoint.SSHInsecureIgnoreHostKey {
+		known_hosts := endpoint.SSHKnownHosts
+		if known_hosts == "" {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return "", nil, fmt.Errorf("failed to locate known hosts: %v", err)
+			}
+			known_hosts = filepath.Join(home, ".ssh", "known_hosts")
+		}
+		host_key, err = knownhosts.New(known_hosts)
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to load known hosts: %v", err)
+		}
+	}
+
+	config := &ssh.ClientConfig{
+		User:            target.User.Username(),
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+		HostKeyCallback: host_key,
+	}
+	return net.JoinHostPort(target.Hostname(), port), config, nil
+}
+
+// runSSHCheck connects to the SSH endpoint, runs its command and returns its result. The
+// connection, authentication and command are bounded by the deadline of ctx. Without a success
+// predicate, the endpoint is up when the command exits with status 0.
+func (endpoint *Endpoint) runSSHCheck(ctx context.Context) CheckResult {
+	result := CheckResult{Status: StatusUp}
+
+	address, config, err := endpoint.sshConfig()
+	if err != nil {
+		result.fail(StatusDown, ErrorKindConnection, err)
+		return result
+	}
+
+	predicate, err := endpoint.predicate()
+	if err != nil {
+		result.fail(StatusDown, ErrorKindPredicate, fmt.Errorf("failed to compile success_when: %w", err))
+		return result
+	}
+
+	body_regex, err := endpoint.bodyRegex()
+	if err != nil {
+		result.fail(StatusDown, ErrorKindBody, fmt.Errorf("failed to compile expect_body_regex: %w", err))
+		return result
+	}
+
+	start := time.Now()
+	client, err := dialSSH(ctx, address, config, &result)
+	if err != nil {
+		result.Latency = time.Since(start)
+		result.fail(StatusDown, sshErrorKind(ctx, err), err)
+		return result
+	}
+	defer client.Close()
+
+	output := &limitedBuffer{limit: endpoint.maxBodySize()}
+	exit_status, err := runSSHCommand(client, endpoint.SSHCommand, output)
+	result.Latency = time.Since(start)
+	if err != nil {
+		result.fail(StatusDown, sshErrorKind(ctx, err), err)
+		return result
+	}
+
+	body := output.Bytes()
+	if predicate != nil {
+		signals := PredicateSignals{
+			Status:  exit_status,
+			Latency: result.Latency,
+			Body:    body,
+		}
+		if !predicate.Evaluate(signals) {
+			result.fail(StatusDown, ErrorKindPredicate, fmt.Errorf("success_when %q was not met", predicate))
+			return result
+		}
+	} else if exit_status != 0 {
+		result.fail(StatusDown, ErrorKindCommand, fmt.Errorf("command exited with status %d: %s", exit_status, firstLine(body)))
+		return result
+	}
+
+	if err := endpoint.checkBody(body, body_regex); err != nil {
+		result.fail(StatusDown, ErrorKindBody, err)
+		return result
+	}
+
+	return result
+}
+
+// dialSSH connects to address and authenticates with config, recording the remote address into
+// result. The connection is closed once ctx is done, interrupting the handshake or any session
+// still running, and when the returned client is closed.
+func dialSSH(ctx context.Context, address string, config *ssh.ClientConfig, result *CheckResult) (*ssh.Client, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	if host, _, err := net.SplitHostPort(conn.RemoteAddr().String()); err == nil {
+		result.RemoteIP = host
+	}
+
+	stop := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-stop:
+		}
+	}()
+
+	client_conn, channels, requests, err := ssh.NewClientConn(conn, address, config)
+	if err != nil {
+		close(stop)
+		conn.Close()
+		return nil, fmt.Errorf("failed to establish SSH connection: %v", err)
+	}
+	client := ssh.NewClient(client_conn, channels, requests)
+	go func() {
+		client.Wait()
+		close(stop)
+	}()
+	return client, nil
+}
+
+// sshErrorKind classifies an error of an SSH or SFTP check, which is a timeout when ctx is done.
+func sshErrorKind(ctx context.Context, err error) string {
+	if ctx.Err() != nil {
+		return ErrorKindTimeout
+	}
+	return ErrorKind(err)
+}
+
+// runSSHCommand runs command in a new session of client, writing its standard output and error to
+// output. It returns the exit status of the command, or an error if it couldn't be run or didn't
+// report one.
+func runSSHCommand(client *ssh.Client, command string, output *limitedBuffer) (int, error) {
+	session, err := client.NewSession()
+	if err != nil {
+		return 0, fmt.Errorf("failed to open SSH session: %v", err)
+	}
+	defer session.Close()
+
+	session.Stdout = output
+	session.Stderr = output
+	err = session.Run(command)
+
+	var exit_err *ssh.ExitError
+	if errors.As(err, &exit_err) {
+		return exit_err.ExitStatus(), nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to run command: %v", err)
+	}
+	return 0, nil
+}
+
+// limitedBuffer keeps the first limit bytes written to it, discarding the rest. It is safe for
+// concurrent use, as the standard output and error of a command are copied concurrently.
+type limitedBuffer struct {
+	mu     sync.Mutex
+	buffer bytes.Buffer
+	limit  int64
+}
+
+func (buffer *limitedBuffer) Write(p []byte) (int, error) {
+	buffer.mu.Lock()
+	defer buffer.mu.Unlock()
+
+	if remaining := buffer.limit - int64(buffer.buffer.Len()); remaining > 0 {
+		if int64(len(p)) > remaining {
+			buffer.buffer.Write(p[:remaining])
+		} else {
+			buffer.buffer.Write(p)
+		}
+	}
+	return len(p), nil
+}
+
+// Bytes returns the bytes kept by the buffer.
+func (buffer *limitedBuffer) Bytes() []byte {
+	buffer.mu.Lock()
+	defer buffer.mu.Unlock()
+
+	return buffer.buffer.Bytes()
+}
+
+// firstLine returns the first non-empty line of output, for error messages.
+func firstLine(output []byte) string {
+	for _, line := range strings.Split(string(output), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			return line
+		}
+	}
+	return "no output"
+}
+
+func init() {
+	RegisterCheckType(EndpointTypeSSH, CheckType{
+		Validate: (*Endpoint).validateSSH,
+		Check:    (*Endpoint).runSSHCheck,
+	})
+}
@@ -0,0 +1,264 @@
+//go:build !nossh
+// +build !nossh
+
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-playground/assert/v2"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// sshTestServer is an SSH server accepting the client key, running the commands "ok" (prints ok),
+// "fail" (prints an error and exits with status 3) and "hang" (never exits), and serving the sftp
+// subsystem with serveSFTPTest.
+type sshTestServer struct {
+	address     string
+	key_file    string
+	known_hosts string
+}
+
+func newSSHTestServer(t *testing.T) sshTestServer {
+	dir := t.TempDir()
+
+	_, host_private, err := ed25519.GenerateKey(rand.Reader)
+	assert.Equal(t, err, nil)
+	host_signer, err := ssh.NewSignerFromKey(host_private)
+	assert.Equal(t, err, nil)
+
+	client_public, client_private, err := ed25519.GenerateKey(rand.Reader)
+	assert.Equal(t, err, nil)
+	authorized, err := ssh.NewPublicKey(client_public)
+	assert.Equal(t, err, nil)
+	block, err := ssh.MarshalPrivateKey(client_private, "")
+	assert.Equal(t, err, nil)
+	key_file := filepath.Join(dir, "id_ed25519")
+	assert.Equal(t, os.WriteFile(key_file, pem.EncodeToMemory(block), 0o600), nil)
+
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if conn.User() == "monitor" && string(key.Marshal()) == string(authorized.Marshal()) {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("unauthorized key for %s", conn.User())
+		},
+	}
+	config.AddHostKey(host_signer)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Equal(t, err, nil)
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveSSHTestConn(conn, config)
+		}
+	}()
+
+	address := listener.Addr().String()
+	known_hosts := filepath.Join(dir, "known_hosts")
+	line := knownhosts.Line([]string{knownhosts.Normalize(address)}, host_signer.PublicKey())
+	assert.Equal(t, os.WriteFile(known_hosts, []byte(line+"\n"), 0o600), nil)
+
+	return sshTestServer{address: address, key_file: key_file, known_hosts: known_hosts}
+}
+
+func serveSSHTestConn(conn net.Conn, config *ssh.ServerConfig) {
+	defer conn.Close()
+	_, channels, requests, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(requests)
+
+	for new_channel := range channels {
+		channel, requests, err := new_channel.Accept()
+		if err != nil {
+			continue
+		}
+		go func() {
+			defer channel.Close()
+			for request := range requests {
+				if request.Type == "subsystem" {
+					var subsystem struct{ Name string }
+					ssh.Unmarshal(request.Payload, &subsystem)
+					request.Reply(subsystem.Name == "sftp", nil)
+					if subsystem.Name == "sftp" {
+						go ssh.DiscardRequests(requests)
+						serveSFTPTest(channel)
+						return
+					}
+					continue
+				}
+				if request.Type != "exec" {
+					request.Reply(false, nil)
+					continue
+				}
+				var exec struct{ Command string }
+				ssh.Unmarshal(request.Payload, &exec)
+				request.Reply(true, nil)
+
+				status := uint32(0)
+				switch exec.Command {
+				case "ok":
+					channel.Write([]byte("ok\n"))
+				case "fail":
+					channel.Stderr().Write([]byte("\ndisk full\n"))
+					status = 3
+				case "hang":
+					time.Sleep(time.Second)
+				}
+				channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{status}))
+				return
+			}
+		}()
+	}
+}
+
+func TestRunSSHCheck(t *testing.T) {
+	server := newSSHTestServer(t)
+	url := "ssh://monitor@" + server.address
+
+	other_hosts := filepath.Join(t.TempDir(), "known_hosts")
+	_, other_key, _ := ed25519.GenerateKey(rand.Reader)
+	other_signer, _ := ssh.NewSignerFromKey(other_key)
+	line := knownhosts.Line([]string{knownhosts.Normalize(server.address)}, other_signer.PublicKey())
+	assert.Equal(t, os.WriteFile(other_hosts, []byte(line+"\n"), 0o600), nil)
+
+	cases := []struct {
+		name              string
+		endpoint          Endpoint
+		expectedStatus    string
+		expectedErrorKind string
+		expectedError     string
+	}{
+		{
+			name:           "Command Succeeds",
+			endpoint:       Endpoint{Url: url, SSHCommand: "ok"},
+			expectedStatus: StatusUp,
+		},
+		{
+			name:              "Command Fails",
+			endpoint:          Endpoint{Url: url, SSHCommand: "fail"},
+			expectedStatus:    StatusDown,
+			expectedErrorKind: ErrorKindCommand,
+			expectedError:     "command exited with status 3: disk full",
+		},
+		{
+			name:           "Predicate On Exit Status",
+			endpoint:       Endpoint{Url: url, SSHCommand: "fail", SuccessWhen: "status == 3 and body contains \"disk\""},
+			expectedStatus: StatusUp,
+		},
+		{
+			name:              "Output Assertion",
+			endpoint:          Endpoint{Url: url, SSHCommand: "ok", ExpectBodyContains: "healthy"},
+			expectedStatus:    StatusDown,
+			expectedErrorKind: ErrorKindBody,
+		},
+		{
+			name:              "Timeout",
+			endpoint:          Endpoint{Url: url, SSHCommand: "hang"},
+			expectedStatus:    StatusDown,
+			expectedErrorKind: ErrorKindTimeout,
+		},
+		{
+			name:              "Unknown User",
+			endpoint:          Endpoint{Url: "ssh://intruder@" + server.address, SSHCommand: "ok"},
+			expectedStatus:    StatusDown,
+			expectedErrorKind: ErrorKindConnection,
+		},
+		{
+			name:              "Host Key Mismatch",
+			endpoint:          Endpoint{Url: url, SSHCommand: "ok", SSHKnownHosts: other_hosts},
+			expectedStatus:    StatusDown,
+			expectedErrorKind: ErrorKindConnection,
+		},
+		{
+			name:           "Host Key Ignored",
+			endpoint:       Endpoint{Url: url, SSHCommand: "ok", SSHKnownHosts: other_hosts, SSHInsecureIgnoreHostKey: true},
+			expectedStatus: StatusUp,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.endpoint.Name = tc.name
+			tc.endpoint.Type = EndpointTypeSSH
+			tc.endpoint.SSHKeyFile = server.key_file
+			if tc.endpoint.SSHKnownHosts == "" {
+				tc.endpoint.SSHKnownHosts = server.known_hosts
+			}
+
+			result := tc.endpoint.GetEndpointHealth(500 * time.Millisecond)
+			assert.Equal(t, result.Status, tc.expectedStatus)
+			assert.Equal(t, result.ErrorKind, tc.expectedErrorKind)
+			if tc.expectedError != "" {
+				assert.Equal(t, result.Error, tc.expectedError)
+			}
+		})
+	}
+}
+
+func TestApplySettingsSSH(t *testing.T) {
+	server := newSSHTestServer(t)
+
+	cases := []struct {
+		name          string
+		endpoint      Endpoint
+		expectedError string
+	}{
+		{
+			name:     "Valid",
+			endpoint: Endpoint{Url: "ssh://monitor@db-1.internal", SSHCommand: "df -h /", SSHKeyFile: server.key_file, SSHKnownHosts: server.known_hosts},
+		},
+		{
+			name:          "Missing Command",
+			endpoint:      Endpoint{Url: "ssh://monitor@db-1.internal", SSHKeyFile: server.key_file, SSHKnownHosts: server.known_hosts},
+			expectedError: "ssh_command is required",
+		},
+		{
+			name:          "Missing User",
+			endpoint:      Endpoint{Url: "ssh://db-1.internal", SSHCommand: "true", SSHKeyFile: server.key_file, SSHKnownHosts: server.known_hosts},
+			expectedError: "must be of the form",
+		},
+		{
+			name:          "Missing Key",
+			endpoint:      Endpoint{Url: "ssh://monitor@db-1.internal", SSHCommand: "true", SSHKnownHosts: server.known_hosts},
+			expectedError: "ssh_key_file is required",
+		},
+		{
+			name:          "Dual Stack",
+			endpoint:      Endpoint{Url: "ssh://monitor@db-1.internal", SSHCommand: "true", SSHKeyFile: server.key_file, DualStack: true},
+			expectedError: "can't be combined",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.endpoint.Name = "db"
+			tc.endpoint.Type = EndpointTypeSSH
+			config := Config{Endpoints: Endpoints{tc.endpoint}}
+			err := config.ApplySettings()
+			if tc.expectedError == "" {
+				assert.Equal(t, err, nil)
+			} else {
+				assert.NotEqual(t, err, nil)
+				assert.Equal(t, strings.Contains(err.Error(), tc.expectedError), true)
+			}
+		})
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Endpoints are validated and compiled concurrently on startup and on reload, so configurations
+// with many endpoints, or endpoints whose validation opens files or network namespaces, are
+// loaded quickly. Every invalid endpoint is reported at once rather than one per attempt to start.
+// With skip_invalid_endpoints (or -skip-invalid), invalid endpoints are skipped instead, so one
+// malformed endpoint doesn't block the monitoring of the others, and the skipped endpoints are
+// served on /skipped.
+
+// ValidationConcurrency is the maximum number of endpoints validated concurrently.
+const ValidationConcurrency int = 16
+
+// InvalidEndpoints lists the problems of every invalid endpoint of a configuration, in the order of
+// the endpoints.
+type InvalidEndpoints []error
+
+// Error returns the problems, one per line.
+func (problems InvalidEndpoints) Error() string {
+	lines := make([]string, len(problems))
+	for i, problem := range problems {
+		lines[i] = problem.Error()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// SkippedEndpoint is an invalid endpoint skipped under skip_invalid_endpoints, with the reasons
+// it is invalid, as served on /skipped.
+type SkippedEndpoint struct {
+	Endpoint string   `json:"endpoint"`
+	Url      string   `json:"url,omitempty"`
+	Reasons  []string `json:"reasons"`
+}
+
+// validateEndpoints is a method for Config that validates its endpoints concurrently, see
+// validateEndpoint. With SkipInvalidEndpoints, invalid endpoints are skipped, see skipEndpoints.
+// Otherwise, an InvalidEndpoints listing every invalid endpoint is returned.
+func (config *Config) validateEndpoints() error {
+	errs := validateConcurrently(config.Endpoints, config.validateEndpoint)
+	var problems InvalidEndpoints
+	reasons := map[int][]string{}
+	for i, err := range errs {
+		if err != nil {
+			problems = append(problems, err)
+			reasons[i] = []string{err.Error()}
+		}
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	if !config.SkipInvalidEndpoints {
+		return problems
+	}
+	if err := config.skipEndpoints(reasons); err != nil {
+		return fmt.Errorf("%v:\n%v", err, problems)
+	}
+	return nil
+}
+
+// skipProblems is a method for Config that skips the endpoints with problems found by
+// ValidateConfig, see skipEndpoints. err is returned as is when any of its problems isn't the
+// problem of an endpoint.
+func (config *Config) skipProblems(err error) error {
+	problems, ok := err.(ConfigErrors)
+	if !ok {
+		return err
+	}
+	reasons := map[int][]string{}
+	for _, problem := range problems {
+		if problem.Endpoint == 0 {
+			return err
+		}
+		reasons[problem.Endpoint-1] = append(reasons[problem.Endpoint-1], problem.String())
+	}
+	if skip_err := config.skipEndpoints(reasons); skip_err != nil {
+		return fmt.Errorf("%v:\n%v", skip_err, err)
+	}
+	return nil
+}
+
+// skipEndpoints is a method for Config that removes the endpoints at the indexes of reasons from
+// the configuration, logging a warning for each of them, and records them in Skipped. An error is
+// returned, and the configuration left unchanged, when none of its endpoints would be left.
+func (config *Config) skipEndpoints(reasons map[int][]string) error {
+	if len(reasons) >= len(config.Endpoints) && len(config.Endpoints) > 0 {
+		return fmt.Errorf("every endpoint is invalid")
+	}
+
+	valid := make(Endpoints, 0, len(config.Endpoints)-len(reasons))
+	for i, endpoint := range config.Endpoints {
+		if len(reasons[i]) == 0 {
+			valid = append(valid, endpoint)
+			continue
+		}
+		log.Printf("WARNING: skipping endpoint %q: %s", endpoint.Name, strings.Join(reasons[i], "; "))
+		config.Skipped = append(config.Skipped, SkippedEndpoint{Endpoint: endpoint.Name, Url: endpoint.Url, Reasons: reasons[i]})
+	}
+	config.Endpoints = valid
+	return nil
+}
+
+// SkippedHandler is a method for HealthCheckTargets that returns an http.Handler serving the
+// endpoints skipped because they are invalid as a JSON array.
+func (target *HealthCheckTargets) SkippedHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		domain_stats.Lock()
+		skipped := append([]SkippedEndpoint{}, target.Skipped...)
+		domain_stats.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(skipped); err != nil {
+			log.Printf("Failed to write skipped endpoints: %v", err)
+		}
+	})
+}
+
+// forEachEndpoint runs fn for every endpoint concurrently, and returns an InvalidEndpoints listing
+// its errors, or nil when it succeeded for every endpoint.
+func forEachEndpoint(endpoints Endpoints, fn func(*Endpoint) error) error {
+	var problems InvalidEndpoints
+	for _, err := range validateConcurrently(endpoints, fn) {
+		if err != nil {
+			problems = append(problems, err)
+		}
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	return problems
+}
+
+// validateConcurrently runs fn for every endpoint, at most ValidationConcurrency at a time, and
+// returns its error for each endpoint, by index.
+func validateConcurrently(endpoints Endpoints, fn func(*Endpoint) error) []error {
+	errs := make([]error, len(endpoints))
+	slots := make(chan struct{}, ValidationConcurrency)
+	var wait_group sync.WaitGroup
+
+	for i := range endpoints {
+		wait_group.Add(1)
+		slots <- struct{}{}
+		go func(i int) {
+			defer wait_group.Done()
+			defer func() { <-slots }()
+			errs[i] = fn(&endpoints[i])
+		}(i)
+	}
+	wait_group.Wait()
+	return errs
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-playground/assert/v2"
+)
+
+func TestApplySettingsReportsEveryInvalidEndpoint(t *testing.T) {
+	endpoints := Endpoints{
+		{Name: "index", Url: "https://fetch.com/"},
+		{Name: "careers", Url: "https://fetch.com/careers", SuccessWhen: "status =="},
+		{Name: "login", Url: "https://fetch.com/login", RateLimited: "sometimes"},
+		{Name: "search", Url: "https://fetch.com/search", ExpectBodyRegex: "("},
+	}
+
+	cases := []struct {
+		name              string
+		skip              bool
+		endpoints         Endpoints
+		expectedProblems  int
+		expectedEndpoints []string
+		expectedFail      bool
+	}{
+		{name: "Every Problem Reported", endpoints: endpoints, expectedProblems: 3, expectedFail: true},
+		{name: "Invalid Endpoints Skipped", skip: true, endpoints: endpoints, expectedEndpoints: []string{"index"}},
+		{name: "Every Endpoint Invalid", skip: true, endpoints: endpoints[1:], expectedFail: true},
+		{name: "Valid Endpoints", endpoints: endpoints[:1], expectedEndpoints: []string{"index"}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			config := Config{Endpoints: append(Endpoints{}, tc.endpoints...)}
+			config.SkipInvalidEndpoints = tc.skip
+			err := config.ApplySettings()
+			if tc.expectedFail {
+				assert.NotEqual(t, err, nil)
+				if tc.expectedProblems > 0 {
+					var problems InvalidEndpoints
+					assert.Equal(t, errors.As(err, &problems), true)
+					assert.Equal(t, len(problems), tc.expectedProblems)
+					assert.Equal(t, strings.Count(err.Error(), "\n"), tc.expectedProblems-1)
+					// problems are reported in the order of the endpoints
+					assert.Equal(t, strings.Contains(problems[0].Error(), "careers"), true)
+					assert.Equal(t, strings.Contains(problems[2].Error(), "search"), true)
+				}
+				return
+			}
+			assert.Equal(t, err, nil)
+
+			var names []string
+			for _, endpoint := range config.Endpoints {
+				names = append(names, endpoint.Name)
+			}
+			assert.Equal(t, names, tc.expectedEndpoints)
+		})
+	}
+}
+
+func TestCreateNewTargetsReportsEveryInvalidEndpoint(t *testing.T) {
+	endpoints := Endpoints{
+		{Name: "careers", Url: "https://fetch.com/careers", SuccessWhen: "status =="},
+		{Name: "index", Url: "https://fetch.com/"},
+		{Name: "search", Url: "https://fetch.com/search", DegradedWhen: "latency >"},
+	}
+	_, err := endpoints.CreateNewTargets()
+	var problems InvalidEndpoints
+	assert.Equal(t, errors.As(err, &problems), true)
+	assert.Equal(t, len(problems), 2)
+}
+
+func TestValidateConcurrently(t *testing.T) {
+	endpoints := make(Endpoints, 3*ValidationConcurrency)
+	for i := range endpoints {
+		endpoints[i].Name = strings.Repeat("x", i)
+	}
+
+	var mu sync.Mutex
+	running, max_running := 0, 0
+	errs := validateConcurrently(endpoints, func(endpoint *Endpoint) error {
+		mu.Lock()
+		running++
+		if running > max_running {
+			max_running = running
+		}
+		mu.Unlock()
+
+		time.Sleep(time.Millisecond)
+
+		mu.Lock()
+		running--
+		mu.Unlock()
+		if len(endpoint.Name)%2 == 1 {
+			return errors.New(endpoint.Name)
+		}
+		return nil
+	})
+
+	assert.Equal(t, len(errs), len(endpoints))
+	assert.Equal(t, max_running <= ValidationConcurrency, true)
+	for i, err := range errs {
+		assert.Equal(t, err != nil, i%2 == 1)
+	}
+}
+
+func TestLoadConfigSkipInvalid(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	assert.Equal(t, os.WriteFile(file, []byte(`
+- name: index
+  url: https://fetch.com/
+- name: careers
+  url: https://fetch.com/careers
+  timout: 1s
+- name: search
+  url: https://fetch.com/search
+  success_when: "status =="
+- name: login
+`), 0o600), nil)
+
+	// every problem refuses the configuration by default
+	_, err := LoadConfig([]string{file})
+	assert.NotEqual(t, err, nil)
+
+	config, err := LoadConfig([]string{"-skip-invalid", file})
+	assert.Equal(t, err, nil)
+	assert.Equal(t, len(config.Endpoints), 1)
+	assert.Equal(t, config.Endpoints[0].Name, "index")
+	assert.Equal(t, config.Skipped, []SkippedEndpoint{
+		{Endpoint: "careers", Url: "https://fetch.com/careers", Reasons: []string{"line 6: unknown endpoint field timout"}},
+		{Endpoint: "login", Reasons: []string{`line 10: endpoint "login": url is required unless path or baseline_url and canary_url are set`}},
+		{Endpoint: "search", Url: "https://fetch.com/search", Reasons: []string{`invalid success_when for endpoint "search": ` + compileError(t, "status ==")}},
+	})
+
+	// problems of the settings aren't skipped
+	assert.Equal(t, os.WriteFile(file, []byte(`
+intervall: 1m
+endpoints:
+  - name: index
+    url: https://fetch.com/
+`), 0o600), nil)
+	_, err = LoadConfig([]string{"-skip-invalid", file})
+	assert.NotEqual(t, err, nil)
+}
+
+func TestLoadConfigBoundedRun(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	assert.Equal(t, os.WriteFile(file, []byte("- name: index\n  url: https://fetch.com/\n"), 0o600), nil)
+
+	cases := []struct {
+		name             string
+		args             []string
+		expectedOnce     bool
+		expectedDuration time.Duration
+		expectedFail     bool
+	}{
+		{name: "Unbounded", args: []string{file}},
+		{name: "Once", args: []string{"-once", file}, expectedOnce: true},
+		{name: "Duration", args: []string{"-duration", "5m", file}, expectedDuration: 5 * time.Minute},
+		{name: "Negative Duration", args: []string{"-duration", "-5m", file}, expectedFail: true},
+		{name: "Once And Duration", args: []string{"-once", "-duration", "5m", file}, expectedFail: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			config, err := LoadConfig(tc.args)
+			assert.Equal(t, err != nil, tc.expectedFail)
+			assert.Equal(t, config.Once, tc.expectedOnce)
+			assert.Equal(t, config.Duration, tc.expectedDuration)
+			if err == nil {
+				// a failed check marks the endpoint DOWN in a single cycle
+				assert.Equal(t, config.Endpoints[0].DownAfter == 1, tc.expectedOnce)
+			}
+		})
+	}
+}
+
+// compileError returns the error compiling an invalid predicate expression.
+func compileError(t *testing.T, expression string) string {
+	_, err := CompilePredicate(expression)
+	assert.NotEqual(t, err, nil)
+	return err.Error()
+}
+
+func TestSkippedHandler(t *testing.T) {
+	targets := HealthCheckTargets{Skipped: []SkippedEndpoint{
+		{Endpoint: "careers", Url: "https://fetch.com/careers", Reasons: []string{"line 6: unknown endpoint field timout"}},
+	}}
+
+	recorder := httptest.NewRecorder()
+	targets.SkippedHandler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/skipped", nil))
+	assert.Equal(t, recorder.Code, http.StatusOK)
+	assert.Equal(t, recorder.Header().Get("Content-Type"), "application/json")
+
+	var skipped []SkippedEndpoint
+	assert.Equal(t, json.Unmarshal(recorder.Body.Bytes(), &skipped), nil)
+	assert.Equal(t, skipped, targets.Skipped)
+
+	var metrics strings.Builder
+	assert.Equal(t, targets.WriteMetrics(&metrics), nil)
+	assert.Equal(t, strings.Contains(metrics.String(), "\ncheckhealth_endpoints_skipped 1\n"), true)
+
+	// no endpoints skipped is an empty list
+	recorder = httptest.NewRecorder()
+	(&HealthCheckTargets{}).SkippedHandler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/skipped", nil))
+	assert.Equal(t, strings.TrimSpace(recorder.Body.String()), "[]")
+}
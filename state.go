@@ -0,0 +1,529 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// StateUnknown, StateUp, StateDegraded and StateDown are the states of an endpoint. An endpoint
+// starts UNKNOWN until its first conclusive check. A failed check moves an UP (or UNKNOWN) endpoint
+// to DEGRADED, and DownAfter consecutive failed checks move it to DOWN. A successful check moves
+// it back to UP. A degraded check moves it to DEGRADED without counting toward DOWN. Unknown check
+// results leave the state unchanged.
+const (
+	StateUnknown  string = "UNKNOWN"
+	StateUp       string = "UP"
+	StateDegraded string = "DEGRADED"
+	StateDown     string = "DOWN"
+)
+
+// DefaultDownAfter is the number of consecutive failed checks after which an endpoint is DOWN when
+// the endpoint doesn't set down_after.
+const DefaultDownAfter int = 3
+
+// DefaultErrorHistory is the number of recent errors kept per endpoint when the endpoint doesn't
+// set error_history.
+const DefaultErrorHistory int = 10
+
+// RecentChecks is the number of recent conclusive checks an endpoint's recent availability is
+// computed over.
+const RecentChecks int = 100
+
+// EventStateChange is the event type reporting an endpoint's transition between states. It is
+// emitted at the end of the cycle in which the transition happened.
+const EventStateChange string = "state_change"
+
+// EndpointState is the state machine tracking the health of a single endpoint across checks. It is
+// safe for concurrent use, so the state can be read while checks are recorded.
+type EndpointState struct {
+	mu                   sync.Mutex
+	down_after           int
+	state                string
+	since                time.Time
+	last_check           time.Time
+	consecutive_failures int
+	error_kind           string
+	last_error           string
+	error_history        int
+	recent_errors        []CheckError
+	recent_checks        []bool
+	recent_latencies     []time.Duration
+	history              []CheckRecord
+	failure_reasons      map[string]int
+	components           []ComponentStatus
+	last_response        responseSignature
+
+	// abandoned_at is when the checks of the endpoint were paused, see Abandon, and resumed_at
+	// when they were last resumed.
+	abandoned_at time.Time
+	resumed_at   time.Time
+
+	// last_timing is the latency breakdown of the last check with one, see CheckTiming.
+	last_timing *CheckTiming
+}
+
+// CheckError is a failed check kept in the rolling log of an endpoint's recent errors, so
+// operators can see the actual error messages rather than just a down percentage.
+type CheckError struct {
+	At         time.Time `json:"at"`
+	StatusCode int       `json:"status_code,omitempty"`
+	ErrorKind  string    `json:"error_kind,omitempty"`
+	Error      string    `json:"error"`
+
+	// Redirects are the redirects followed by the failed check, with the time spent on each.
+	Redirects []RedirectHop `json:"redirects,omitempty"`
+}
+
+// CheckRecord is a check kept in the history of an endpoint, as served on
+// /api/v1/endpoints/{name}/history.
+type CheckRecord struct {
+	At         time.Time `json:"at"`
+	Status     string    `json:"status"`
+	LatencyMs  float64   `json:"latency_ms"`
+	StatusCode int       `json:"status_code,omitempty"`
+	ErrorKind  string    `json:"error_kind,omitempty"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// StateTransition is a change of an endpoint's state.
+type StateTransition struct {
+	Endpoint string
+	Url      string
+	From     string
+	To       string
+
+	// Labels are the labels of the endpoint.
+	Labels map[string]string
+
+	// At is when the endpoint entered the new state and PreviousSince when it entered the
+	// previous one, which is zero for an endpoint leaving its initial UNKNOWN state.
+	At            time.Time
+	PreviousSince time.Time
+}
+
+// PreviousDuration returns how long the endpoint was in the state it left.
+func (transition StateTransition) PreviousDuration() time.Duration {
+	if transition.PreviousSince.IsZero() {
+		return 0
+	}
+	return transition.At.Sub(transition.PreviousSince)
+}
+
+// EndpointStatus is a point in time report of an endpoint's state, answering how long an endpoint
+// has been in its current state.
+type EndpointStatus struct {
+	Endpoint            string    `json:"endpoint"`
+	Url                 string    `json:"url"`
+	Domain              string    `json:"domain,omitempty"`
+	State               string    `json:"state"`
+	Since               time.Time `json:"since"`
+	LastCheck           time.Time `json:"last_check"`
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+
+	// ErrorKind and LastError describe the last failed check of an endpoint that isn't UP.
+	ErrorKind string `json:"error_kind,omitempty"`
+	LastError string `json:"last_error,omitempty"`
+
+	Runbook string            `json:"runbook,omitempty"`
+	Owner   string            `json:"owner,omitempty"`
+	Labels  map[string]string `json:"labels,omitempty"`
+
+	// RecentAvailability is the percentage of the last RecentCheckCount conclusive checks of the
+	// endpoint that were up or degraded, out of at most RecentChecks.
+	RecentAvailability int `json:"recent_availability"`
+	RecentCheckCount   int `json:"recent_check_count"`
+
+	// FailureReasons counts the failed checks of the endpoint by FailureReason.
+	FailureReasons map[string]int `json:"failure_reasons,omitempty"`
+
+	// RecentLatenciesMs are the latencies of the last checks of the endpoint with a latency, out of
+	// at most RecentChecks, oldest first, in milliseconds.
+	RecentLatenciesMs []float64 `json:"recent_latencies_ms,omitempty"`
+
+	// RecentErrors are the last failed checks of the endpoint, oldest first.
+	RecentErrors []CheckError `json:"recent_errors,omitempty"`
+
+	// Components are the component statuses reported by the last health+json response of the
+	// endpoint.
+	Components []ComponentStatus `json:"components,omitempty"`
+
+	// Schedule reports how many of the scheduled checks of the endpoint were made on time, once
+	// any was scheduled.
+	Schedule *ScheduleSummary `json:"schedule,omitempty"`
+
+	// AbandonedAt is when the checks of the endpoint were paused after it stayed DOWN for its
+	// abandon_after, null while it is checked.
+	AbandonedAt *time.Time `json:"abandoned_at,omitempty"`
+
+	// Timing is the latency breakdown of the last HTTP check of the endpoint that requested a
+	// connection.
+	Timing *TimingStatus `json:"timing,omitempty"`
+}
+
+// NewEndpointState creates an EndpointState in the UNKNOWN state, moving to DOWN after down_after
+// consecutive failures and keeping the last error_history errors. Zero or negative values of
+// down_after select DefaultDownAfter. A zero error_history selects DefaultErrorHistory, and a
+// negative one disables the log of recent errors.
+func NewEndpointState(down_after int, error_history int) *EndpointState {
+	if down_after <= 0 {
+		down_after = DefaultDownAfter
+	}
+	if error_history == 0 {
+		error_history = DefaultErrorHistory
+	}
+	return &EndpointState{
+		down_after:    down_after,
+		state:         StateUnknown,
+		error_history: error_history,
+	}
+}
+
+// SetThresholds changes the number of consecutive failures after which the state moves to DOWN
+// and the number of recent errors kept, with the defaults of NewEndpointState. A negative
+// error_history clears the log of recent errors.
+func (state *EndpointState) SetThresholds(down_after int, error_history int) {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	fresh := NewEndpointState(down_after, error_history)
+	state.down_after = fresh.down_after
+	state.error_history = fresh.error_history
+	if state.error_history < 0 {
+		state.recent_errors = nil
+	}
+}
+
+// Record updates the state machine with the result of a check finished at the provided time. The
+// transition is returned if the state changed.
+func (state *EndpointState) Record(result CheckResult, at time.Time) (StateTransition, bool) {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	state.last_check = at
+	if result.Components != nil {
+		state.components = result.Components
+	}
+	if result.Timing != nil {
+		state.last_timing = result.Timing
+	}
+
+	if result.Status != StatusUnknown && result.Latency > 0 {
+		state.recordLatency(result.Latency)
+	}
+	state.recordHistory(CheckRecord{
+		At:         at,
+		Status:     result.Status,
+		LatencyMs:  latencyMilliseconds(result.Latency),
+		StatusCode: result.StatusCode,
+		ErrorKind:  result.ErrorKind,
+		Error:      result.Error,
+	})
+
+	switch result.Status {
+	case StatusUp, StatusDegraded:
+		state.recordCheck(true)
+	case StatusDown:
+		state.recordCheck(false)
+		if state.failure_reasons == nil {
+			state.failure_reasons = map[string]int{}
+		}
+		state.failure_reasons[FailureReason(result)]++
+	}
+
+	next := state.state
+	switch result.Status {
+	case StatusUp:
+		state.consecutive_failures = 0
+		state.error_kind = ""
+		state.last_error = ""
+		next = StateUp
+	case StatusDegraded:
+		state.consecutive_failures = 0
+		state.error_kind = result.ErrorKind
+		state.last_error = result.Error
+		state.recordError(CheckError{
+			At:         at,
+			StatusCode: result.StatusCode,
+			ErrorKind:  result.ErrorKind,
+			Error:      result.Error,
+			Redirects:  result.Redirects,
+		})
+		next = StateDegraded
+	case StatusDown:
+		state.consecutive_failures++
+		state.error_kind = result.ErrorKind
+		state.last_error = result.Error
+		state.recordError(CheckError{
+			At:         at,
+			StatusCode: result.StatusCode,
+			ErrorKind:  result.ErrorKind,
+			Error:      result.Error,
+			Redirects:  result.Redirects,
+		})
+		if state.consecutive_failures >= state.down_after {
+			next = StateDown
+		} else if state.state != StateDown {
+			next = StateDegraded
+		}
+	}
+
+	if next == state.state {
+		return StateTransition{}, false
+	}
+
+	transition := StateTransition{
+		Endpoint:      result.Endpoint,
+		Url:           result.Url,
+		From:          state.state,
+		To:            next,
+		At:            at,
+		PreviousSince: state.since,
+	}
+	state.state = next
+	state.since = at
+	return transition, true
+}
+
+// recordError appends an error to the rolling log of recent errors, dropping the oldest one once
+// error_history errors are kept.
+func (state *EndpointState) recordError(check_error CheckError) {
+	if state.error_history <= 0 {
+		return
+	}
+	if len(state.recent_errors) >= state.error_history {
+		state.recent_errors = append(state.recent_errors[:0], state.recent_errors[len(state.recent_errors)-state.error_history+1:]...)
+	}
+	state.recent_errors = append(state.recent_errors, check_error)
+}
+
+// recordCheck appends the outcome of a conclusive check to the recent checks, dropping the oldest
+// one once RecentChecks checks are kept.
+func (state *EndpointState) recordCheck(up bool) {
+	if len(state.recent_checks) >= RecentChecks {
+		state.recent_checks = append(state.recent_checks[:0], state.recent_checks[len(state.recent_checks)-RecentChecks+1:]...)
+	}
+	state.recent_checks = append(state.recent_checks, up)
+}
+
+// recordLatency appends the latency of a check to the recent latencies, dropping the oldest one
+// once RecentChecks latencies are kept.
+func (state *EndpointState) recordLatency(latency time.Duration) {
+	if len(state.recent_latencies) >= RecentChecks {
+		state.recent_latencies = append(state.recent_latencies[:0], state.recent_latencies[len(state.recent_latencies)-RecentChecks+1:]...)
+	}
+	state.recent_latencies = append(state.recent_latencies, latency)
+}
+
+// recordHistory appends a check to the history, dropping the oldest one once RecentChecks checks
+// are kept.
+func (state *EndpointState) recordHistory(record CheckRecord) {
+	if len(state.history) >= RecentChecks {
+		state.history = append(state.history[:0], state.history[len(state.history)-RecentChecks+1:]...)
+	}
+	state.history = append(state.history, record)
+}
+
+// History returns the last RecentChecks checks of the endpoint, including unknown ones, oldest
+// first.
+func (state *EndpointState) History() []CheckRecord {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	return append([]CheckRecord{}, state.history...)
+}
+
+// recentAvailability returns the percentage of the recent checks that were up, rounded to the
+// nearest whole number, or 0 if there are none.
+func (state *EndpointState) recentAvailability() int {
+	if len(state.recent_checks) == 0 {
+		return 0
+	}
+	up := 0
+	for _, check_up := range state.recent_checks {
+		if check_up {
+			up++
+		}
+	}
+	return int(math.Round(100 * float64(up) / float64(len(state.recent_checks))))
+}
+
+// recentLatencies returns the recent latencies in milliseconds, or nil if there are none.
+func (state *EndpointState) recentLatencies() []float64 {
+	if len(state.recent_latencies) == 0 {
+		return nil
+	}
+	latencies := make([]float64, len(state.recent_latencies))
+	for i, latency := range state.recent_latencies {
+		latencies[i] = latencyMilliseconds(latency)
+	}
+	return latencies
+}
+
+// failureReasons returns a copy of the failure reasons, or nil if no check failed.
+func (state *EndpointState) failureReasons() map[string]int {
+	if len(state.failure_reasons) == 0 {
+		return nil
+	}
+	reasons := make(map[string]int, len(state.failure_reasons))
+	for reason, count := range state.failure_reasons {
+		reasons[reason] = count
+	}
+	return reasons
+}
+
+// Status returns a report of the endpoint's current state.
+func (state *EndpointState) Status() EndpointStatus {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	status := EndpointStatus{
+		State:               state.state,
+		Since:               state.since,
+		LastCheck:           state.last_check,
+		ConsecutiveFailures: state.consecutive_failures,
+		ErrorKind:           state.error_kind,
+		LastError:           state.last_error,
+		RecentAvailability:  state.recentAvailability(),
+		RecentCheckCount:    len(state.recent_checks),
+		FailureReasons:      state.failureReasons(),
+		RecentLatenciesMs:   state.recentLatencies(),
+		RecentErrors:        append([]CheckError(nil), state.recent_errors...),
+		Components:          append([]ComponentStatus(nil), state.components...),
+	}
+	if !state.abandoned_at.IsZero() {
+		abandoned_at := state.abandoned_at
+		status.AbandonedAt = &abandoned_at
+	}
+	if state.last_timing != nil {
+		status.Timing = state.last_timing.Status()
+	}
+	return status
+}
+
+// EndpointStates is a method for HealthCheckTargets that returns the state of every endpoint, in
+// the order of the configuration.
+func (target *HealthCheckTargets) EndpointStates() []EndpointStatus {
+	statuses := []EndpointStatus{}
+
+	// the endpoints are replaced when the configuration is reloaded
+	domain_stats.Lock()
+	endpoints := target.Endpoints
+	domain_stats.Unlock()
+	if endpoints == nil {
+		return statuses
+	}
+
+	for i := range *endpoints {
+		endpoint := &(*endpoints)[i]
+
+		status := EndpointStatus{State: StateUnknown}
+		if endpoint.State != nil {
+			status = endpoint.State.Status()
+		}
+		status.Endpoint = endpoint.Name
+		status.Url = endpoint.Url
+		if endpoint.Domain != nil {
+			status.Domain = endpoint.Domain.Name
+		}
+		status.Runbook = endpoint.Runbook
+		status.Owner = endpoint.Owner
+		status.Labels = endpoint.Labels
+		if schedule := endpoint.Schedule.Summary(); schedule.Scheduled > 0 {
+			status.Schedule = &schedule
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// EndpointErrors are the recent errors of an endpoint, as served on /errors.
+type EndpointErrors struct {
+	Endpoint     string       `json:"endpoint"`
+	Url          string       `json:"url"`
+	State        string       `json:"state"`
+	RecentErrors []CheckError `json:"recent_errors"`
+}
+
+// RecentErrors is a method for HealthCheckTargets that returns the recent errors of every endpoint
+// that has any, in the order of the configuration.
+func (target *HealthCheckTargets) RecentErrors() []EndpointErrors {
+	endpoint_errors := []EndpointErrors{}
+	for _, status := range target.EndpointStates() {
+		if len(status.RecentErrors) == 0 {
+			continue
+		}
+		endpoint_errors = append(endpoint_errors, EndpointErrors{
+			Endpoint:     status.Endpoint,
+			Url:          status.Url,
+			State:        status.State,
+			RecentErrors: status.RecentErrors,
+		})
+	}
+	return endpoint_errors
+}
+
+// ErrorsHandler is a method for HealthCheckTargets that returns an http.Handler serving the recent
+// errors of the endpoints as a JSON array.
+func (target *HealthCheckTargets) ErrorsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(target.RecentErrors()); err != nil {
+			log.Printf("Failed to write recent errors: %v", err)
+		}
+	})
+}
+
+// StateEvents is a method for HealthCheckTargets that returns an EventStateChange event for each
+// transition, signed when a signer is configured.
+func (target *HealthCheckTargets) StateEvents(transitions []StateTransition) []Event {
+	var events []Event
+	for _, transition := range transitions {
+		event := NewEvent(EventStateChange, transition.At)
+		event.State = &StateEvent{
+			Endpoint:           transition.Endpoint,
+			Url:                transition.Url,
+			From:               transition.From,
+			To:                 transition.To,
+			ChangedAt:          transition.At.UTC(),
+			PreviousDurationMs: transition.PreviousDuration().Milliseconds(),
+			Labels:             transition.Labels,
+		}
+		events = append(events, event)
+	}
+
+	if err := target.Signer.Sign(events); err != nil {
+		log.Printf("Failed to sign events: %v", err)
+	}
+	return events
+}
+
+// LogStateChanges is a method for HealthCheckTargets that prints each transition to the console in
+// the configured output format.
+func (target *HealthCheckTargets) LogStateChanges(transitions []StateTransition) {
+	if target.Settings.Output == OutputJSON {
+		if err := WriteEvents(os.Stdout, target.StateEvents(transitions)); err != nil {
+			log.Printf("Failed to write JSON output: %v", err)
+		}
+		return
+	}
+
+	for _, transition := range transitions {
+		fmt.Println(transition.String())
+	}
+}
+
+// String describes the transition for the text output.
+func (transition StateTransition) String() string {
+	if transition.PreviousSince.IsZero() {
+		return fmt.Sprintf("%s is %s", transition.Endpoint, transition.To)
+	}
+	return fmt.Sprintf("%s is %s, was %s for %v", transition.Endpoint, transition.To, transition.From, transition.PreviousDuration().Round(time.Second))
+}
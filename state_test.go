@@ -0,0 +1,293 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-playground/assert/v2"
+)
+
+func TestEndpointStateRecord(t *testing.T) {
+	base := time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		name                string
+		downAfter           int
+		statuses            []string
+		expectedStates      []string
+		expectedTransitions int
+	}{
+		{
+			name:                "Initial Success",
+			statuses:            []string{StatusUp, StatusUp},
+			expectedStates:      []string{StateUp, StateUp},
+			expectedTransitions: 1,
+		},
+		{
+			name:                "Degraded Then Down",
+			statuses:            []string{StatusUp, StatusDown, StatusDown, StatusDown, StatusDown},
+			expectedStates:      []string{StateUp, StateDegraded, StateDegraded, StateDown, StateDown},
+			expectedTransitions: 3,
+		},
+		{
+			name:                "Recovery",
+			downAfter:           2,
+			statuses:            []string{StatusDown, StatusDown, StatusUp},
+			expectedStates:      []string{StateDegraded, StateDown, StateUp},
+			expectedTransitions: 3,
+		},
+		{
+			name:                "Down After One Failure",
+			downAfter:           1,
+			statuses:            []string{StatusUp, StatusDown},
+			expectedStates:      []string{StateUp, StateDown},
+			expectedTransitions: 2,
+		},
+		{
+			name:                "Unknown Results Keep State",
+			statuses:            []string{StatusUnknown, StatusUp, StatusUnknown, StatusDown},
+			expectedStates:      []string{StateUnknown, StateUp, StateUp, StateDegraded},
+			expectedTransitions: 2,
+		},
+		{
+			name:                "Degraded Results Don't Count Toward Down",
+			downAfter:           2,
+			statuses:            []string{StatusDown, StatusDegraded, StatusDown, StatusDown},
+			expectedStates:      []string{StateDegraded, StateDegraded, StateDegraded, StateDown},
+			expectedTransitions: 2,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			state := NewEndpointState(tc.downAfter, 0)
+			transitions := 0
+
+			for i, status := range tc.statuses {
+				_, changed := state.Record(CheckResult{Status: status}, base.Add(time.Duration(i)*15*time.Second))
+				if changed {
+					transitions++
+				}
+				assert.Equal(t, state.Status().State, tc.expectedStates[i])
+			}
+			assert.Equal(t, transitions, tc.expectedTransitions)
+		})
+	}
+}
+
+func TestEndpointStateTransition(t *testing.T) {
+	base := time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+	state := NewEndpointState(2, 0)
+
+	transition, changed := state.Record(CheckResult{Endpoint: "index", Status: StatusUp}, base)
+	assert.Equal(t, changed, true)
+	assert.Equal(t, transition.From, StateUnknown)
+	assert.Equal(t, transition.PreviousDuration(), time.Duration(0))
+	assert.Equal(t, transition.String(), "index is UP")
+
+	state.Record(CheckResult{Endpoint: "index", Status: StatusDown}, base.Add(time.Minute))
+	transition, changed = state.Record(CheckResult{Endpoint: "index", Status: StatusDown}, base.Add(90*time.Second))
+	assert.Equal(t, changed, true)
+	assert.Equal(t, transition.From, StateDegraded)
+	assert.Equal(t, transition.To, StateDown)
+	assert.Equal(t, transition.PreviousDuration(), 30*time.Second)
+	assert.Equal(t, transition.String(), "index is DOWN, was DEGRADED for 30s")
+
+	// the status reports how long the endpoint has been down
+	status := state.Status()
+	assert.Equal(t, status.State, StateDown)
+	assert.Equal(t, status.Since, base.Add(90*time.Second))
+	assert.Equal(t, status.ConsecutiveFailures, 2)
+}
+
+func TestRecordResultsStateChanges(t *testing.T) {
+	endpoints := Endpoints{
+		{Name: "index", Url: "https://fetch.com/", DownAfter: 1},
+		{Name: "careers", Url: "https://fetch.com/careers"},
+	}
+	targets, err := endpoints.CreateNewTargets()
+	assert.Equal(t, err, nil)
+
+	finished_at := time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+	transitions := targets.RecordResults([]CheckResult{
+		{Endpoint: "index", Url: "https://fetch.com/", Status: StatusDown, FinishedAt: finished_at},
+		{Endpoint: "careers", Url: "https://fetch.com/careers", Status: StatusUnknown, FinishedAt: finished_at},
+	})
+	assert.Equal(t, len(transitions), 1)
+	assert.Equal(t, transitions[0].To, StateDown)
+
+	states := targets.EndpointStates()
+	assert.Equal(t, states, []EndpointStatus{
+		{
+			Endpoint:            "index",
+			Url:                 "https://fetch.com/",
+			Domain:              "fetch.com",
+			State:               StateDown,
+			Since:               finished_at,
+			LastCheck:           finished_at,
+			ConsecutiveFailures: 1,
+			RecentCheckCount:    1,
+			FailureReasons:      map[string]int{"other": 1},
+			RecentErrors:        []CheckError{{At: finished_at}},
+		},
+		{
+			Endpoint:  "careers",
+			Url:       "https://fetch.com/careers",
+			Domain:    "fetch.com",
+			State:     StateUnknown,
+			LastCheck: finished_at,
+		},
+	})
+
+	var output bytes.Buffer
+	assert.Equal(t, WriteEvents(&output, targets.StateEvents(transitions)), nil)
+	assert.Equal(t, output.String(), `{"schema_version":"1.18","type":"state_change","timestamp":"2023-06-01T12:00:00Z",`+
+		`"state":{"endpoint":"index","url":"https://fetch.com/","from":"UNKNOWN","to":"DOWN",`+
+		`"changed_at":"2023-06-01T12:00:00Z","previous_duration_ms":0}}`+"\n")
+}
+
+func TestEndpointStateRecentErrors(t *testing.T) {
+	base := time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		name           string
+		errorHistory   int
+		failures       int
+		expectedErrors []string
+	}{
+		{
+			name:           "Fewer Errors Than History",
+			errorHistory:   3,
+			failures:       2,
+			expectedErrors: []string{"failure 0", "failure 1"},
+		},
+		{
+			name:           "Oldest Errors Dropped",
+			errorHistory:   3,
+			failures:       5,
+			expectedErrors: []string{"failure 2", "failure 3", "failure 4"},
+		},
+		{
+			name:           "Default History",
+			failures:       DefaultErrorHistory + 1,
+			expectedErrors: nil,
+		},
+		{
+			name:           "Disabled",
+			errorHistory:   -1,
+			failures:       2,
+			expectedErrors: []string{},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			state := NewEndpointState(0, tc.errorHistory)
+			for i := 0; i < tc.failures; i++ {
+				result := CheckResult{Status: StatusDown, StatusCode: 503, ErrorKind: ErrorKindStatus, Error: fmt.Sprintf("failure %d", i)}
+				state.Record(result, base.Add(time.Duration(i)*time.Second))
+			}
+			// successful and unknown checks aren't errors
+			state.Record(CheckResult{Status: StatusUp}, base.Add(time.Hour))
+			state.Record(CheckResult{Status: StatusUnknown}, base.Add(time.Hour))
+
+			recent := state.Status().RecentErrors
+			if tc.expectedErrors == nil {
+				assert.Equal(t, len(recent), DefaultErrorHistory)
+				assert.Equal(t, recent[0].Error, "failure 1")
+				return
+			}
+
+			assert.Equal(t, len(recent), len(tc.expectedErrors))
+			for i, expected := range tc.expectedErrors {
+				assert.Equal(t, recent[i].Error, expected)
+				assert.Equal(t, recent[i].StatusCode, 503)
+				assert.Equal(t, recent[i].ErrorKind, ErrorKindStatus)
+			}
+		})
+	}
+}
+
+func TestEndpointStateRecentAvailability(t *testing.T) {
+	base := time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	state := NewEndpointState(0, 0)
+	assert.Equal(t, state.Status().RecentAvailability, 0)
+	assert.Equal(t, state.Status().RecentCheckCount, 0)
+
+	// degraded checks count as available and unknown checks aren't counted
+	state.Record(CheckResult{Status: StatusUp}, base)
+	state.Record(CheckResult{Status: StatusDegraded}, base.Add(time.Minute))
+	state.Record(CheckResult{Status: StatusDown}, base.Add(2*time.Minute))
+	state.Record(CheckResult{Status: StatusUnknown}, base.Add(3*time.Minute))
+	status := state.Status()
+	assert.Equal(t, status.RecentAvailability, 67)
+	assert.Equal(t, status.RecentCheckCount, 3)
+
+	// only the last RecentChecks checks are kept
+	for i := 0; i < RecentChecks; i++ {
+		state.Record(CheckResult{Status: StatusUp}, base.Add(time.Hour))
+	}
+	status = state.Status()
+	assert.Equal(t, status.RecentAvailability, 100)
+	assert.Equal(t, status.RecentCheckCount, RecentChecks)
+}
+
+func TestEndpointStateRecentLatencies(t *testing.T) {
+	base := time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	state := NewEndpointState(0, 0)
+	state.Record(CheckResult{Status: StatusUp, Latency: 120 * time.Millisecond}, base)
+	state.Record(CheckResult{Status: StatusDown, Latency: 1500 * time.Millisecond}, base.Add(time.Minute))
+	assert.Equal(t, state.Status().RecentLatenciesMs, []float64{120, 1500})
+
+	// only the last RecentChecks latencies are kept
+	for i := 0; i < RecentChecks; i++ {
+		state.Record(CheckResult{Status: StatusUp, Latency: time.Duration(i+1) * time.Millisecond}, base.Add(time.Hour))
+	}
+	latencies := state.Status().RecentLatenciesMs
+	assert.Equal(t, len(latencies), RecentChecks)
+	assert.Equal(t, latencies[0], float64(1))
+	assert.Equal(t, latencies[RecentChecks-1], float64(RecentChecks))
+
+	// unknown checks and checks without a latency aren't kept
+	state.Record(CheckResult{Status: StatusUnknown, Latency: time.Second}, base.Add(2*time.Hour))
+	state.Record(CheckResult{Status: StatusDown}, base.Add(2*time.Hour))
+	assert.Equal(t, state.Status().RecentLatenciesMs, latencies)
+}
+
+func TestErrorsHandler(t *testing.T) {
+	endpoints := Endpoints{
+		{Name: "index", Url: "https://example.com/"},
+		{Name: "careers", Url: "https://example.com/careers"},
+	}
+	targets, err := endpoints.CreateNewTargets()
+	assert.Equal(t, err, nil)
+
+	at := time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+	targets.RecordResults([]CheckResult{
+		{Endpoint: "index", Url: "https://example.com/", Status: StatusUp, FinishedAt: at},
+		{Endpoint: "careers", Url: "https://example.com/careers", Status: StatusDown, StatusCode: 503, ErrorKind: ErrorKindStatus, Error: "unexpected status code 503", FinishedAt: at},
+	})
+
+	recorder := httptest.NewRecorder()
+	targets.ErrorsHandler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/errors", nil))
+	assert.Equal(t, recorder.Code, http.StatusOK)
+	assert.Equal(t, recorder.Header().Get("Content-Type"), "application/json")
+
+	var endpoint_errors []EndpointErrors
+	assert.Equal(t, json.Unmarshal(recorder.Body.Bytes(), &endpoint_errors), nil)
+	assert.Equal(t, endpoint_errors, []EndpointErrors{{
+		Endpoint: "careers",
+		Url:      "https://example.com/careers",
+		State:    StateDegraded,
+		RecentErrors: []CheckError{
+			{At: at, StatusCode: 503, ErrorKind: ErrorKindStatus, Error: "unexpected status code 503"},
+		},
+	}})
+}
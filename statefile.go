@@ -0,0 +1,236 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// StateFileVersion is the version of the state file format written by SaveStateFile. State files
+// of another version are rejected by LoadStateFile.
+const StateFileVersion int = 1
+
+// StateSnapshot is the content of a state file: the cumulative statistics of every domain, and of
+// its current availability_periods, so availability survives restarts.
+type StateSnapshot struct {
+	Version int                       `json:"version"`
+	SavedAt time.Time                 `json:"saved_at"`
+	Domains map[string]DomainSnapshot `json:"domains"`
+}
+
+// DomainSnapshot is the cumulative statistics of a domain in a StateSnapshot.
+type DomainSnapshot struct {
+	UpCount       int                       `json:"up_count"`
+	TotalRequests int                       `json:"total_requests"`
+	UnknownCount  int                       `json:"unknown_count,omitempty"`
+	DegradedCount int                       `json:"degraded_count,omitempty"`
+	Families      map[string]FamilySnapshot `json:"families,omitempty"`
+	Fallback      *FallbackSnapshot         `json:"fallback,omitempty"`
+	Periods       map[string]PeriodSnapshot `json:"periods,omitempty"`
+}
+
+// FamilySnapshot is the cumulative statistics of an address family of a domain in a
+// StateSnapshot.
+type FamilySnapshot struct {
+	UpCount       int `json:"up_count"`
+	TotalRequests int `json:"total_requests"`
+}
+
+// FallbackSnapshot is the cumulative statistics of the fallback checks of a domain in a
+// StateSnapshot.
+type FallbackSnapshot struct {
+	UpCount       int `json:"up_count"`
+	TotalRequests int `json:"total_requests"`
+}
+
+// PeriodSnapshot is the statistics of the current calendar period of a domain in a StateSnapshot,
+// and of the previous one when it is known.
+type PeriodSnapshot struct {
+	Start         time.Time       `json:"start"`
+	UpCount       int             `json:"up_count"`
+	TotalRequests int             `json:"total_requests"`
+	Previous      *PeriodSnapshot `json:"previous,omitempty"`
+}
+
+// Snapshot is a method for HealthCheckTargets that returns the cumulative statistics of every
+// domain, stamped with the provided time. Domains without a name are skipped.
+func (target *HealthCheckTargets) Snapshot(at time.Time) StateSnapshot {
+	snapshot := StateSnapshot{
+		Version: StateFileVersion,
+		SavedAt: at.UTC(),
+		Domains: map[string]DomainSnapshot{},
+	}
+
+	domain_stats.Lock()
+	defer domain_stats.Unlock()
+
+	for domain := target.Domains; domain != nil; domain = domain.Next {
+		if domain.Name == "" {
+			continue
+		}
+
+		domain_snapshot := DomainSnapshot{
+			UpCount:       domain.UpCount,
+			TotalRequests: domain.TotalRequests,
+			UnknownCount:  domain.UnknownCount,
+			DegradedCount: domain.DegradedCount,
+		}
+		for family, stats := range domain.Families {
+			if domain_snapshot.Families == nil {
+				domain_snapshot.Families = map[string]FamilySnapshot{}
+			}
+			domain_snapshot.Families[family] = FamilySnapshot{UpCount: stats.UpCount, TotalRequests: stats.TotalRequests}
+		}
+		if domain.Fallback != nil {
+			domain_snapshot.Fallback = &FallbackSnapshot{UpCount: domain.Fallback.UpCount, TotalRequests: domain.Fallback.TotalRequests}
+		}
+		for period, stats := range domain.Periods {
+			if domain_snapshot.Periods == nil {
+				domain_snapshot.Periods = map[string]PeriodSnapshot{}
+			}
+			period_snapshot := PeriodSnapshot{Start: stats.Start.UTC(), UpCount: stats.UpCount, TotalRequests: stats.TotalRequests}
+			if previous := stats.Previous; previous != nil {
+				period_snapshot.Previous = &PeriodSnapshot{Start: previous.Start.UTC(), UpCount: previous.UpCount, TotalRequests: previous.TotalRequests}
+			}
+			domain_snapshot.Periods[period] = period_snapshot
+		}
+		snapshot.Domains[domain.Name] = domain_snapshot
+	}
+
+	return snapshot
+}
+
+// Restore is a method for HealthCheckTargets that loads the cumulative statistics of the domains
+// from a snapshot. Domains of the snapshot that are no longer configured are ignored, and domains
+// missing from the snapshot start from zero. It returns the number of domains restored.
+func (target *HealthCheckTargets) Restore(snapshot StateSnapshot) int {
+	domain_stats.Lock()
+	defer domain_stats.Unlock()
+
+	restored := 0
+	for domain := target.Domains; domain != nil; domain = domain.Next {
+		domain_snapshot, ok := snapshot.Domains[domain.Name]
+		if !ok || domain.Name == "" {
+			continue
+		}
+
+		domain.UpCount = domain_snapshot.UpCount
+		domain.TotalRequests = domain_snapshot.TotalRequests
+		domain.UnknownCount = domain_snapshot.UnknownCount
+		domain.DegradedCount = domain_snapshot.DegradedCount
+		domain.Families = nil
+		for family, stats := range domain_snapshot.Families {
+			if domain.Families == nil {
+				domain.Families = map[string]*FamilyStats{}
+			}
+			domain.Families[family] = &FamilyStats{UpCount: stats.UpCount, TotalRequests: stats.TotalRequests}
+		}
+		domain.Fallback = nil
+		if domain_snapshot.Fallback != nil {
+			domain.Fallback = &FallbackStats{UpCount: domain_snapshot.Fallback.UpCount, TotalRequests: domain_snapshot.Fallback.TotalRequests}
+		}
+		domain.Periods = nil
+		for period, stats := range domain_snapshot.Periods {
+			if domain.Periods == nil {
+				domain.Periods = map[string]*PeriodStats{}
+			}
+			domain.Periods[period] = &PeriodStats{Start: stats.Start, UpCount: stats.UpCount, TotalRequests: stats.TotalRequests}
+			if previous := stats.Previous; previous != nil {
+				domain.Periods[period].Previous = &PeriodStats{Start: previous.Start, UpCount: previous.UpCount, TotalRequests: previous.TotalRequests}
+			}
+		}
+		restored++
+	}
+
+	return restored
+}
+
+// SaveStateFile atomically writes the snapshot to path, by writing it to a temporary file in the
+// same directory and renaming it, so a crash never leaves a truncated state file.
+func SaveStateFile(path string, snapshot StateSnapshot) error {
+	content, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode state: %v", err)
+	}
+
+	file, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create state file: %v", err)
+	}
+	defer os.Remove(file.Name())
+
+	if _, err := file.Write(append(content, '\n')); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write state file: %v", err)
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to sync state file: %v", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to close state file: %v", err)
+	}
+
+	if err := os.Rename(file.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace state file: %v", err)
+	}
+	return nil
+}
+
+// LoadStateFile reads a snapshot written by SaveStateFile. The error satisfies os.IsNotExist when
+// the file doesn't exist yet.
+func LoadStateFile(path string) (StateSnapshot, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return StateSnapshot{}, err
+	}
+
+	var snapshot StateSnapshot
+	if err := json.Unmarshal(content, &snapshot); err != nil {
+		return StateSnapshot{}, fmt.Errorf("failed to decode state file %s: %v", path, err)
+	}
+	if snapshot.Version != StateFileVersion {
+		return StateSnapshot{}, fmt.Errorf("state file %s has unsupported version %d, expected %d", path, snapshot.Version, StateFileVersion)
+	}
+	return snapshot, nil
+}
+
+// LoadState is a method for HealthCheckTargets that restores the domain statistics from the
+// configured state file. A missing state file is expected on the first run. Other failures are
+// logged and the statistics start from zero, as availability reporting shouldn't stop because of
+// a damaged state file.
+func (target *HealthCheckTargets) LoadState() {
+	path := target.Settings.StateFile
+	if path == "" {
+		return
+	}
+
+	snapshot, err := LoadStateFile(path)
+	if os.IsNotExist(err) {
+		log.Printf("State file %s doesn't exist yet, starting from zero", path)
+		return
+	}
+	if err != nil {
+		log.Printf("WARNING: %v, starting from zero", err)
+		return
+	}
+
+	restored := target.Restore(snapshot)
+	log.Printf("Restored the statistics of %d domains from %s, saved at %s", restored, path, snapshot.SavedAt.Format(time.RFC3339))
+}
+
+// SaveState is a method for HealthCheckTargets that snapshots the domain statistics to the
+// configured state file. Failures are logged, and retried at the next save.
+func (target *HealthCheckTargets) SaveState() {
+	path := target.Settings.StateFile
+	if path == "" {
+		return
+	}
+
+	if err := SaveStateFile(path, target.Snapshot(time.Now())); err != nil {
+		log.Printf("Failed to save state to %s: %v", path, err)
+	}
+}
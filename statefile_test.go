@@ -0,0 +1,146 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-playground/assert/v2"
+)
+
+func TestStateFileRoundTrip(t *testing.T) {
+	endpoints := Endpoints{
+		{Name: "index", Url: "https://example.com/"},
+		{Name: "api", Url: "https://api.example.com/"},
+	}
+	targets, err := endpoints.CreateNewTargets()
+	assert.Equal(t, err, nil)
+
+	results := []CheckResult{{Status: StatusUp}, {Status: StatusDown}}
+	targets.RecordResults(results)
+	results = []CheckResult{{Status: StatusDown}, {Status: StatusUnknown}}
+	targets.RecordResults(results)
+	results = []CheckResult{{Status: StatusDegraded}, {Status: StatusUnknown}}
+	targets.RecordResults(results)
+	(*targets.Endpoints)[0].Domain.UpdateFamilyStats("ipv6", true)
+	(*targets.Endpoints)[0].Domain.UpdateFallbackStats(true)
+	(*targets.Endpoints)[0].Domain.UpdatePeriodStats(time.Date(2023, 6, 1, 11, 0, 0, 0, time.UTC), true, []string{AvailabilityPeriodMonth}, time.UTC)
+
+	saved_at := time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+	path := filepath.Join(t.TempDir(), "state.json")
+	assert.Equal(t, SaveStateFile(path, targets.Snapshot(saved_at)), nil)
+
+	// a restarted process starts from zero and restores the saved statistics
+	restarted, err := endpoints.CreateNewTargets()
+	assert.Equal(t, err, nil)
+
+	snapshot, err := LoadStateFile(path)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, snapshot.SavedAt, saved_at)
+	assert.Equal(t, restarted.Restore(snapshot), 2)
+
+	index := (*restarted.Endpoints)[0].Domain
+	assert.Equal(t, index.UpCount, 2)
+	assert.Equal(t, index.TotalRequests, 3)
+	assert.Equal(t, index.DegradedCount, 1)
+	assert.Equal(t, index.Families["ipv6"].UpCount, 1)
+	assert.Equal(t, *index.Fallback, FallbackStats{UpCount: 1, TotalRequests: 1})
+	assert.Equal(t, *index.Periods[AvailabilityPeriodMonth], PeriodStats{Start: time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC), UpCount: 1, TotalRequests: 1})
+
+	api := (*restarted.Endpoints)[1].Domain
+	assert.Equal(t, api.UpCount, 0)
+	assert.Equal(t, api.TotalRequests, 1)
+	assert.Equal(t, api.UnknownCount, 2)
+	assert.Equal(t, api.DegradedCount, 0)
+	assert.Equal(t, api.Fallback == nil, true)
+}
+
+func TestRestoreIgnoresUnknownDomains(t *testing.T) {
+	endpoints := Endpoints{{Name: "index", Url: "https://example.com/"}}
+	targets, err := endpoints.CreateNewTargets()
+	assert.Equal(t, err, nil)
+
+	snapshot := StateSnapshot{
+		Version: StateFileVersion,
+		Domains: map[string]DomainSnapshot{"removed.example.com": {UpCount: 5, TotalRequests: 5}},
+	}
+	assert.Equal(t, targets.Restore(snapshot), 0)
+	assert.Equal(t, targets.Domains.TotalRequests, 0)
+}
+
+func TestLoadStateFile(t *testing.T) {
+	directory := t.TempDir()
+
+	cases := []struct {
+		name         string
+		content      string
+		expectedFail bool
+	}{
+		{
+			name:    "Valid",
+			content: `{"version": 1, "saved_at": "2023-06-01T12:00:00Z", "domains": {"example.com": {"up_count": 1, "total_requests": 2}}}`,
+		},
+		{
+			name:         "Unsupported Version",
+			content:      `{"version": 2, "domains": {}}`,
+			expectedFail: true,
+		},
+		{
+			name:         "Truncated",
+			content:      `{"version": 1, "dom`,
+			expectedFail: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(directory, "state.json")
+			assert.Equal(t, os.WriteFile(path, []byte(tc.content), 0644), nil)
+
+			snapshot, err := LoadStateFile(path)
+			if tc.expectedFail {
+				assert.NotEqual(t, err, nil)
+				return
+			}
+
+			assert.Equal(t, err, nil)
+			assert.Equal(t, snapshot.Domains["example.com"].TotalRequests, 2)
+		})
+	}
+
+	_, err := LoadStateFile(filepath.Join(directory, "missing.json"))
+	assert.Equal(t, os.IsNotExist(err), true)
+}
+
+func TestSaveStateReplacesFile(t *testing.T) {
+	directory := t.TempDir()
+	path := filepath.Join(directory, "state.json")
+
+	endpoints := Endpoints{{Name: "index", Url: "https://example.com/"}}
+	targets, err := endpoints.CreateNewTargets()
+	assert.Equal(t, err, nil)
+	targets.Settings.StateFile = path
+
+	targets.RecordResults([]CheckResult{{Status: StatusUp}})
+	targets.SaveState()
+	targets.RecordResults([]CheckResult{{Status: StatusUp}})
+	targets.SaveState()
+
+	snapshot, err := LoadStateFile(path)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, snapshot.Domains["example.com"].TotalRequests, 2)
+
+	// no temporary files are left behind
+	entries, err := os.ReadDir(directory)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, len(entries), 1)
+
+	// a damaged state file is logged and the statistics start from zero
+	assert.Equal(t, os.WriteFile(path, []byte("garbage"), 0644), nil)
+	restarted, err := endpoints.CreateNewTargets()
+	assert.Equal(t, err, nil)
+	restarted.Settings.StateFile = path
+	restarted.LoadState()
+	assert.Equal(t, restarted.Domains.TotalRequests, 0)
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+)
+
+// Endpoints setting alert_status_change report a change of their response between two checks,
+// even when both are successful: a different status code, e.g. 200 to 204, or the same redirect
+// pointing elsewhere. Such changes often come from an unintended deploy or routing change, which
+// the state of the endpoint doesn't show. Checks without a response, such as timeouts and
+// connection failures, are ignored, so the response after an outage is compared to the one
+// before it.
+
+// EventStatusChange is the event type reporting a change of the response of an endpoint with
+// alert_status_change between two checks.
+const EventStatusChange string = "status_change"
+
+// StatusChangeEvent is the payload of an EventStatusChange event.
+type StatusChangeEvent struct {
+	Endpoint       string    `json:"endpoint"`
+	Url            string    `json:"url"`
+	FromStatusCode int       `json:"from_status_code"`
+	ToStatusCode   int       `json:"to_status_code"`
+	ChangedAt      time.Time `json:"changed_at"`
+
+	// FromRedirectTarget and ToRedirectTarget are where the endpoint redirected to before and
+	// after the change, see CheckResult.RedirectTarget.
+	FromRedirectTarget string `json:"from_redirect_target,omitempty"`
+	ToRedirectTarget   string `json:"to_redirect_target,omitempty"`
+}
+
+// StatusChange is a change of the response of an endpoint between two checks.
+type StatusChange struct {
+	Endpoint string
+	Url      string
+
+	FromStatusCode     int
+	ToStatusCode       int
+	FromRedirectTarget string
+	ToRedirectTarget   string
+
+	At time.Time
+}
+
+// responseSignature is what is compared between the responses of two checks.
+type responseSignature struct {
+	status_code     int
+	redirect_target string
+}
+
+// redirectTarget returns where the response redirected to: the Location of a redirect response
+// that wasn't followed, or the URL of the final response when redirects were followed. It is
+// empty for responses that weren't redirected.
+func redirectTarget(response *http.Response) string {
+	if response.StatusCode >= 300 && response.StatusCode < 400 {
+		return response.Header.Get("Location")
+	}
+	if response.Request != nil && response.Request.Response != nil {
+		return response.Request.URL.String()
+	}
+	return ""
+}
+
+// RecordResponse is a method for EndpointState that remembers the response of result, and returns
+// the response of the previous check with one and whether it differs. Results without a response
+// are ignored.
+func (state *EndpointState) RecordResponse(result CheckResult) (responseSignature, bool) {
+	if result.StatusCode == 0 {
+		return responseSignature{}, false
+	}
+
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	previous := state.last_response
+	state.last_response = responseSignature{status_code: result.StatusCode, redirect_target: result.RedirectTarget}
+	return previous, previous.status_code != 0 && previous != state.last_response
+}
+
+// statusChange returns the change of the endpoint's response from previous to the response of
+// result.
+func (endpoint *Endpoint) statusChange(previous responseSignature, result CheckResult) StatusChange {
+	return StatusChange{
+		Endpoint:           endpoint.Name,
+		Url:                endpoint.Url,
+		FromStatusCode:     previous.status_code,
+		ToStatusCode:       result.StatusCode,
+		FromRedirectTarget: previous.redirect_target,
+		ToRedirectTarget:   result.RedirectTarget,
+		At:                 result.FinishedAt,
+	}
+}
+
+// StatusChanges is a method for HealthCheckTargets that returns the changes of the responses of the
+// endpoints with alert_status_change in the results returned by CheckEndpoints, once they were
+// recorded by RecordResults.
+func (target *HealthCheckTargets) StatusChanges(results []CheckResult) []StatusChange {
+	var changes []StatusChange
+	for i, result := range results {
+		endpoint := &(*target.Endpoints)[i]
+		if !endpoint.AlertStatusChange || endpoint.State == nil {
+			continue
+		}
+		if previous, changed := endpoint.State.RecordResponse(result); changed {
+			changes = append(changes, endpoint.statusChange(previous, result))
+		}
+	}
+	return changes
+}
+
+// String describes the change for the text output.
+func (change StatusChange) String() string {
+	if change.FromStatusCode == change.ToStatusCode {
+		return fmt.Sprintf("%s redirect target changed from %q to %q", change.Endpoint, change.FromRedirectTarget, change.ToRedirectTarget)
+	}
+	description := fmt.Sprintf("%s status code changed from %d to %d", change.Endpoint, change.FromStatusCode, change.ToStatusCode)
+	if change.FromRedirectTarget != change.ToRedirectTarget {
+		description += fmt.Sprintf(", redirect target from %q to %q", change.FromRedirectTarget, change.ToRedirectTarget)
+	}
+	return description
+}
+
+// StatusChangeEvents is a method for HealthCheckTargets that returns an EventStatusChange event for
+// each change, signed when a signer is configured.
+func (target *HealthCheckTargets) StatusChangeEvents(changes []StatusChange) []Event {
+	var events []Event
+	for _, change := range changes {
+		event := NewEvent(EventStatusChange, change.At)
+		event.StatusChange = &StatusChangeEvent{
+			Endpoint:           change.Endpoint,
+			Url:                change.Url,
+			FromStatusCode:     change.FromStatusCode,
+			ToStatusCode:       change.ToStatusCode,
+			ChangedAt:          change.At.UTC(),
+			FromRedirectTarget: change.FromRedirectTarget,
+			ToRedirectTarget:   change.ToRedirectTarget,
+		}
+		events = append(events, event)
+	}
+
+	if err := target.Signer.Sign(events); err != nil {
+		log.Printf("Failed to sign events: %v", err)
+	}
+	return events
+}
+
+// LogStatusChanges is a method for HealthCheckTargets that prints each change to the console in
+// the configured output format.
+func (target *HealthCheckTargets) LogStatusChanges(changes []StatusChange) {
+	if target.Settings.Output == OutputJSON {
+		if err := WriteEvents(os.Stdout, target.StatusChangeEvents(changes)); err != nil {
+			log.Printf("Failed to write JSON output: %v", err)
+		}
+		return
+	}
+
+	for _, change := range changes {
+		fmt.Println(change.String())
+	}
+}
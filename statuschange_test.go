@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-playground/assert/v2"
+)
+
+func TestStatusChanges(t *testing.T) {
+	cases := []struct {
+		name            string
+		previous        CheckResult
+		result          CheckResult
+		expectedChanged bool
+		expectedString  string
+	}{
+		{name: "Same Status Code", previous: CheckResult{StatusCode: 200}, result: CheckResult{StatusCode: 200}},
+		{name: "Success Range", previous: CheckResult{StatusCode: 200}, result: CheckResult{StatusCode: 204}, expectedChanged: true, expectedString: "index status code changed from 200 to 204"},
+		{name: "Redirect Target", previous: CheckResult{StatusCode: 301, RedirectTarget: "https://fetch.com/en/"}, result: CheckResult{StatusCode: 301, RedirectTarget: "https://fetch.com/login"}, expectedChanged: true,
+			expectedString: `index redirect target changed from "https://fetch.com/en/" to "https://fetch.com/login"`},
+		{name: "Redirect Lost", previous: CheckResult{StatusCode: 302, RedirectTarget: "https://fetch.com/en/"}, result: CheckResult{StatusCode: 200}, expectedChanged: true,
+			expectedString: `index status code changed from 302 to 200, redirect target from "https://fetch.com/en/" to ""`},
+		{name: "No Response", previous: CheckResult{StatusCode: 200}, result: CheckResult{Status: StatusDown, ErrorKind: ErrorKindTimeout}},
+		{name: "First Response", previous: CheckResult{Status: StatusDown}, result: CheckResult{StatusCode: 200}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			endpoints := Endpoints{{Name: "index", Url: "https://fetch.com/", AlertStatusChange: true}}
+			targets, err := endpoints.CreateNewTargets()
+			assert.Equal(t, err, nil)
+
+			targets.RecordResults([]CheckResult{tc.previous})
+			assert.Equal(t, len(targets.StatusChanges([]CheckResult{tc.previous})), 0)
+			targets.RecordResults([]CheckResult{tc.result})
+			changes := targets.StatusChanges([]CheckResult{tc.result})
+			if !tc.expectedChanged {
+				assert.Equal(t, len(changes), 0)
+				return
+			}
+			assert.Equal(t, len(changes), 1)
+			assert.Equal(t, changes[0].String(), tc.expectedString)
+		})
+	}
+
+	// responses are only compared for endpoints with alert_status_change
+	endpoints := Endpoints{{Name: "index", Url: "https://fetch.com/"}}
+	targets, err := endpoints.CreateNewTargets()
+	assert.Equal(t, err, nil)
+	for _, status_code := range []int{200, 204} {
+		results := []CheckResult{{StatusCode: status_code}}
+		targets.RecordResults(results)
+		assert.Equal(t, len(targets.StatusChanges(results)), 0)
+	}
+}
+
+func TestStatusChangeEvents(t *testing.T) {
+	location := "/en/"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, location, http.StatusMovedPermanently)
+	}))
+	defer server.Close()
+
+	endpoints := Endpoints{{Name: "index", Url: server.URL, FollowRedirects: new(bool)}}
+	config := Config{Settings: Settings{AlertStatusChange: true}, Endpoints: endpoints}
+	assert.Equal(t, config.ApplySettings(), nil)
+	targets, err := config.Endpoints.CreateNewTargets()
+	assert.Equal(t, err, nil)
+
+	check := func() []StatusChange {
+		results := []CheckResult{(*targets.Endpoints)[0].GetEndpointHealth(2 * time.Second)}
+		targets.RecordResults(results)
+		return targets.StatusChanges(results)
+	}
+	assert.Equal(t, len(check()), 0)
+	location = "/login"
+	changes := check()
+	assert.Equal(t, len(changes), 1)
+	assert.Equal(t, changes[0].FromRedirectTarget, "/en/")
+	assert.Equal(t, changes[0].ToRedirectTarget, "/login")
+
+	changes[0].At = time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+	changes[0].Url = "https://fetch.com/"
+	var output bytes.Buffer
+	assert.Equal(t, WriteEvents(&output, targets.StatusChangeEvents(changes)), nil)
+	assert.Equal(t, output.String(), `{"schema_version":"1.18","type":"status_change","timestamp":"2023-06-01T12:00:00Z",`+
+		`"status_change":{"endpoint":"index","url":"https://fetch.com/","from_status_code":301,"to_status_code":301,`+
+		`"changed_at":"2023-06-01T12:00:00Z","from_redirect_target":"/en/","to_redirect_target":"/login"}}`+"\n")
+}
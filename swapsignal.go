@@ -0,0 +1,12 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// SwapSignal is the signal swapping to the configuration preloaded with -next-config.
+var SwapSignal os.Signal = syscall.SIGUSR2
@@ -0,0 +1,7 @@
+package main
+
+import "os"
+
+// SwapSignal is nil on Windows, which has no SIGUSR2, so the configuration preloaded with
+// -next-config can't be swapped to.
+var SwapSignal os.Signal
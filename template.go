@@ -0,0 +1,129 @@
+package main
+
+import (
+	"embed"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+// TemplateUsage provides help text for the init subcommand.
+const TemplateUsage string = `
+USAGE: checkhealth init [-template name] [-force] [file]
+       checkhealth init -list
+
+	Writes a default configuration file to start from, embedded in the binary, to file or to
+	the console when no file is provided.
+
+FLAGS:
+
+	-template name
+		The configuration template to write, "basic" by default. "service" configures
+		CheckHealth as a long-lived service with metrics, a state file and a file sink.
+
+	-force
+		Overwrites file when it already exists.
+
+	-list
+		Lists the available templates.
+`
+
+// DefaultTemplate is the configuration template written by the init subcommand by default.
+const DefaultTemplate string = "basic"
+
+// templates are the default configuration templates embedded into the binary, named after their
+// file without the .yaml extension.
+//
+//go:embed templates/*.yaml
+var templates embed.FS
+
+// ConfigTemplates returns the names of the embedded configuration templates, in order.
+func ConfigTemplates() []string {
+	entries, err := fs.ReadDir(templates, "templates")
+	if err != nil {
+		return nil
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, strings.TrimSuffix(entry.Name(), path.Ext(entry.Name())))
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ConfigTemplate returns the embedded configuration template named name, or an error listing the
+// available templates when there is none.
+func ConfigTemplate(name string) ([]byte, error) {
+	template, err := templates.ReadFile("templates/" + name + ".yaml")
+	if err != nil || strings.ContainsAny(name, "/.") {
+		return nil, fmt.Errorf("unknown template %q, expected one of %s", name, strings.Join(ConfigTemplates(), ", "))
+	}
+	return template, nil
+}
+
+// RunInit is the entry point for the init subcommand. It parses the init flags from args and
+// writes the selected configuration template to the file argument, or to w without one.
+func RunInit(args []string, w io.Writer) error {
+	flags := flag.NewFlagSet("init", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	name := flags.String("template", DefaultTemplate, "")
+	force := flags.Bool("force", false, "")
+	list := flags.Bool("list", false, "")
+
+	if err := flags.Parse(args); err != nil {
+		return fmt.Errorf("failed to parse init arguments: %v\n%s", err, TemplateUsage)
+	}
+	if flags.NArg() > 1 {
+		return fmt.Errorf("init accepts at most one file.\n%s", TemplateUsage)
+	}
+
+	if *list {
+		_, err := fmt.Fprintln(w, strings.Join(ConfigTemplates(), "\n"))
+		return err
+	}
+
+	template, err := ConfigTemplate(*name)
+	if err != nil {
+		return err
+	}
+	if flags.NArg() == 0 {
+		_, err := w.Write(template)
+		return err
+	}
+
+	file := flags.Arg(0)
+	mode := os.O_WRONLY | os.O_CREATE | os.O_EXCL
+	if *force {
+		mode = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	}
+	output, err := os.OpenFile(file, mode, 0o644)
+	if err != nil {
+		if os.IsExist(err) {
+			return fmt.Errorf("%s already exists, use -force to overwrite it", file)
+		}
+		return fmt.Errorf("failed to write configuration: %v", err)
+	}
+	if _, err := output.Write(template); err != nil {
+		output.Close()
+		return fmt.Errorf("failed to write configuration: %v", err)
+	}
+	if err := output.Close(); err != nil {
+		return fmt.Errorf("failed to write configuration: %v", err)
+	}
+	_, err = fmt.Fprintf(w, "Wrote the %s configuration template to %s\n", *name, file)
+	return err
+}
+
+func init() {
+	RegisterCommand(Command{
+		Name: "init",
+		Run: func(args []string) error {
+			return RunInit(args, os.Stdout)
+		},
+	})
+}
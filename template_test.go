@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-playground/assert/v2"
+)
+
+func TestConfigTemplates(t *testing.T) {
+	assert.Equal(t, ConfigTemplates(), []string{"basic", "service"})
+
+	// every template is a valid configuration
+	for _, name := range ConfigTemplates() {
+		t.Run(name, func(t *testing.T) {
+			template, err := ConfigTemplate(name)
+			assert.Equal(t, err, nil)
+			config, err := ParseConfig(template)
+			assert.Equal(t, err, nil)
+			assert.Equal(t, ValidateConfig(template, config), nil)
+			assert.Equal(t, config.ApplySettings(), nil)
+			_, err = config.Endpoints.CreateNewTargets()
+			assert.Equal(t, err, nil)
+		})
+	}
+
+	_, err := ConfigTemplate("../go.mod")
+	assert.NotEqual(t, err, nil)
+}
+
+func TestRunInit(t *testing.T) {
+	dir := t.TempDir()
+	existing := filepath.Join(dir, "existing.yaml")
+	assert.Equal(t, os.WriteFile(existing, []byte("endpoints: []\n"), 0o644), nil)
+	basic, err := ConfigTemplate("basic")
+	assert.Equal(t, err, nil)
+	service, err := ConfigTemplate("service")
+	assert.Equal(t, err, nil)
+
+	cases := []struct {
+		name          string
+		args          []string
+		expectedError string
+		expectedFile  string
+		expected      []byte
+	}{
+		{name: "Console", args: []string{}, expected: basic},
+		{name: "File", args: []string{"-template", "service", filepath.Join(dir, "config.yaml")}, expectedFile: filepath.Join(dir, "config.yaml"), expected: service},
+		{name: "Existing File", args: []string{existing}, expectedError: "already exists"},
+		{name: "Overwrite", args: []string{"-force", existing}, expectedFile: existing, expected: basic},
+		{name: "Unknown Template", args: []string{"-template", "missing"}, expectedError: "unknown template"},
+		{name: "Too Many Files", args: []string{"a.yaml", "b.yaml"}, expectedError: "at most one file"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var output bytes.Buffer
+			err := RunInit(tc.args, &output)
+			if tc.expectedError != "" {
+				assert.NotEqual(t, err, nil)
+				assert.Equal(t, strings.Contains(err.Error(), tc.expectedError), true)
+				return
+			}
+			assert.Equal(t, err, nil)
+			if tc.expectedFile == "" {
+				assert.Equal(t, output.Bytes(), tc.expected)
+				return
+			}
+			written, err := os.ReadFile(tc.expectedFile)
+			assert.Equal(t, err, nil)
+			assert.Equal(t, written, tc.expected)
+		})
+	}
+
+	var output bytes.Buffer
+	assert.Equal(t, RunInit([]string{"-list"}, &output), nil)
+	assert.Equal(t, output.String(), "basic\nservice\n")
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Endpoints separate the hard timeout of their checks from the latency they are expected to
+// respond within: checks still running after timeout are cancelled and down, while successful
+// checks slower than max_latency are degraded, so a slow but working endpoint isn't killed
+// mid-request. Both default to the max_latency setting, which keeps checks slower than it down.
+
+// checkTimeout returns the time after which a check of the endpoint is cancelled: its timeout, or
+// the max_latency setting when it doesn't set one.
+func (endpoint *Endpoint) checkTimeout(max_latency time.Duration) time.Duration {
+	if endpoint.Timeout > 0 {
+		return endpoint.Timeout
+	}
+	return max_latency
+}
+
+// latencyThreshold returns the latency above which a successful check of the endpoint is
+// degraded: its max_latency, or the max_latency setting when it doesn't set one.
+func (endpoint *Endpoint) latencyThreshold(max_latency time.Duration) time.Duration {
+	if endpoint.MaxLatency > 0 {
+		return endpoint.MaxLatency
+	}
+	return max_latency
+}
+
+// judgeLatency marks successful results slower than the endpoint's latency threshold degraded,
+// with the latency error kind. Thresholds that aren't below the timeout are ignored, as slower
+// checks are already cancelled.
+func (endpoint *Endpoint) judgeLatency(result *CheckResult, max_latency time.Duration) {
+	threshold := endpoint.latencyThreshold(max_latency)
+	if result.Status != StatusUp || threshold >= endpoint.checkTimeout(max_latency) {
+		return
+	}
+	// redirects budgeted with max_redirect_latency aren't counted twice
+	latency := result.Latency
+	if endpoint.MaxRedirectLatency > 0 {
+		latency -= result.RedirectLatency()
+	}
+	if latency > threshold {
+		result.fail(StatusDegraded, ErrorKindLatency, fmt.Errorf("latency %s is above the max latency of %s", latency, threshold))
+	}
+}
+
+// validateTimeouts rejects negative timeouts, a max_latency above the timeout, and timeouts
+// above the interval, which would overlap check cycles.
+func (endpoint *Endpoint) validateTimeouts(max_latency time.Duration, interval time.Duration) error {
+	if endpoint.Timeout < 0 || endpoint.MaxLatency < 0 {
+		return errors.New("timeout and max_latency must be positive")
+	}
+	timeout := endpoint.checkTimeout(max_latency)
+	if endpoint.MaxLatency > timeout {
+		return fmt.Errorf("max_latency %s must not exceed the timeout %s", endpoint.MaxLatency, timeout)
+	}
+	if timeout > interval {
+		return fmt.Errorf("timeout %s must not exceed the interval %s", timeout, interval)
+	}
+	return nil
+}
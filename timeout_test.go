@@ -0,0 +1,79 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-playground/assert/v2"
+)
+
+func TestEndpointTimeouts(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(150 * time.Millisecond)
+	}))
+	defer server.Close()
+
+	cases := []struct {
+		name              string
+		endpoint          Endpoint
+		expectedStatus    string
+		expectedErrorKind string
+	}{
+		{
+			name:              "Setting Timeout",
+			endpoint:          Endpoint{Name: "slow", Url: server.URL},
+			expectedStatus:    StatusDown,
+			expectedErrorKind: ErrorKindTimeout,
+		},
+		{
+			name:              "Slow But Working",
+			endpoint:          Endpoint{Name: "slow", Url: server.URL, Timeout: time.Second},
+			expectedStatus:    StatusDegraded,
+			expectedErrorKind: ErrorKindLatency,
+		},
+		{
+			name:           "Within Max Latency",
+			endpoint:       Endpoint{Name: "slow", Url: server.URL, Timeout: time.Second, MaxLatency: 500 * time.Millisecond},
+			expectedStatus: StatusUp,
+		},
+		{
+			name:              "Own Max Latency",
+			endpoint:          Endpoint{Name: "slow", Url: server.URL, Timeout: time.Second, MaxLatency: 50 * time.Millisecond},
+			expectedStatus:    StatusDegraded,
+			expectedErrorKind: ErrorKindLatency,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			result := tc.endpoint.GetEndpointHealth(100 * time.Millisecond)
+			assert.Equal(t, result.Status, tc.expectedStatus)
+			assert.Equal(t, result.ErrorKind, tc.expectedErrorKind)
+		})
+	}
+}
+
+func TestValidateTimeouts(t *testing.T) {
+	cases := []struct {
+		name         string
+		endpoint     Endpoint
+		expectedFail bool
+	}{
+		{name: "Defaults", endpoint: Endpoint{}},
+		{name: "Timeout Above Setting", endpoint: Endpoint{Timeout: 5 * time.Second}},
+		{name: "Both", endpoint: Endpoint{Timeout: 5 * time.Second, MaxLatency: time.Second}},
+		{name: "Negative", endpoint: Endpoint{Timeout: -time.Second}, expectedFail: true},
+		{name: "Max Latency Above Timeout", endpoint: Endpoint{Timeout: time.Second, MaxLatency: 2 * time.Second}, expectedFail: true},
+		{name: "Max Latency Above Setting", endpoint: Endpoint{MaxLatency: time.Second}, expectedFail: true},
+		{name: "Timeout Above Interval", endpoint: Endpoint{Timeout: time.Minute}, expectedFail: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.endpoint.validateTimeouts(500*time.Millisecond, 15*time.Second)
+			assert.Equal(t, err != nil, tc.expectedFail)
+		})
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// The latency of an HTTP check is broken down with httptrace into the DNS lookup, the TCP
+// connection, the TLS handshake and the time to the first byte of the response, so a slow network
+// or TLS terminator can be told apart from a slow application. The breakdown is that of the last
+// request of the check, after its redirects, and is logged at the debug level, served with the
+// state of the endpoint and published on /metrics.
+
+// CheckTiming is the latency breakdown of the last request of a check. DNS, Connect and TLS are
+// zero when the request reused a connection, or when the phase wasn't needed, e.g. TLS for plain
+// HTTP. FirstByte is the time from the request of a connection to the first byte of the response,
+// which includes the other phases, zero when no response was received.
+type CheckTiming struct {
+	DNS       time.Duration `json:"dns,omitempty"`
+	Connect   time.Duration `json:"connect,omitempty"`
+	TLS       time.Duration `json:"tls,omitempty"`
+	FirstByte time.Duration `json:"first_byte,omitempty"`
+	Reused    bool          `json:"reused,omitempty"`
+}
+
+// TimingStatus is a CheckTiming in milliseconds, as served with the state of an endpoint.
+type TimingStatus struct {
+	DNSMs       float64 `json:"dns_ms"`
+	ConnectMs   float64 `json:"connect_ms"`
+	TLSMs       float64 `json:"tls_ms"`
+	FirstByteMs float64 `json:"first_byte_ms"`
+	Reused      bool    `json:"reused"`
+}
+
+// timingTrace records the phases of the requests of a check, see withTimingTrace.
+type timingTrace struct {
+	mu     sync.Mutex
+	traced bool
+	timing CheckTiming
+
+	start         time.Time
+	dns_start     time.Time
+	connect_start time.Time
+	tls_start     time.Time
+}
+
+// withTimingTrace returns a context recording the latency breakdown of the requests made with it.
+// Every request restarts the breakdown when it requests a connection, so the trace holds the
+// breakdown of the last request, see timingTrace.Timing.
+func withTimingTrace(ctx context.Context) (context.Context, *timingTrace) {
+	trace := &timingTrace{}
+	return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GetConn: func(string) {
+			trace.mu.Lock()
+			defer trace.mu.Unlock()
+			trace.traced, trace.timing, trace.start = true, CheckTiming{}, time.Now()
+			trace.dns_start, trace.connect_start, trace.tls_start = time.Time{}, time.Time{}, time.Time{}
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			trace.mu.Lock()
+			defer trace.mu.Unlock()
+			trace.timing.Reused = info.Reused
+		},
+		DNSStart: func(httptrace.DNSStartInfo) {
+			trace.mu.Lock()
+			defer trace.mu.Unlock()
+			trace.dns_start = time.Now()
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			trace.mu.Lock()
+			defer trace.mu.Unlock()
+			if !trace.dns_start.IsZero() {
+				trace.timing.DNS = time.Since(trace.dns_start)
+			}
+		},
+		ConnectStart: func(string, string) {
+			trace.mu.Lock()
+			defer trace.mu.Unlock()
+			// dual-stack dials race several connections, the first one started is timed
+			if trace.connect_start.IsZero() {
+				trace.connect_start = time.Now()
+			}
+		},
+		ConnectDone: func(_ string, _ string, err error) {
+			trace.mu.Lock()
+			defer trace.mu.Unlock()
+			if err == nil && trace.timing.Connect == 0 && !trace.connect_start.IsZero() {
+				trace.timing.Connect = time.Since(trace.connect_start)
+			}
+		},
+		TLSHandshakeStart: func() {
+			trace.mu.Lock()
+			defer trace.mu.Unlock()
+			trace.tls_start = time.Now()
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			trace.mu.Lock()
+			defer trace.mu.Unlock()
+			if !trace.tls_start.IsZero() {
+				trace.timing.TLS = time.Since(trace.tls_start)
+			}
+		},
+		GotFirstResponseByte: func() {
+			trace.mu.Lock()
+			defer trace.mu.Unlock()
+			if !trace.start.IsZero() {
+				trace.timing.FirstByte = time.Since(trace.start)
+			}
+		},
+	}), trace
+}
+
+// Timing returns the latency breakdown of the last request traced, nil if no request requested a
+// connection.
+func (trace *timingTrace) Timing() *CheckTiming {
+	trace.mu.Lock()
+	defer trace.mu.Unlock()
+
+	if !trace.traced {
+		return nil
+	}
+	timing := trace.timing
+	return &timing
+}
+
+// Status returns the breakdown in milliseconds.
+func (timing CheckTiming) Status() *TimingStatus {
+	return &TimingStatus{
+		DNSMs:       latencyMilliseconds(timing.DNS),
+		ConnectMs:   latencyMilliseconds(timing.Connect),
+		TLSMs:       latencyMilliseconds(timing.TLS),
+		FirstByteMs: latencyMilliseconds(timing.FirstByte),
+		Reused:      timing.Reused,
+	}
+}
+
+// phases returns the phases of the breakdown with their name, in the order they happen.
+func (timing CheckTiming) phases() []timingPhase {
+	return []timingPhase{
+		{"dns", timing.DNS},
+		{"connect", timing.Connect},
+		{"tls", timing.TLS},
+		{"first_byte", timing.FirstByte},
+	}
+}
+
+// timingPhase is a named phase of a CheckTiming.
+type timingPhase struct {
+	name     string
+	duration time.Duration
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-playground/assert/v2"
+)
+
+func TestTimingTrace(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	client := server.Client()
+
+	get := func() *CheckTiming {
+		ctx, trace := withTimingTrace(context.Background())
+		request, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+		assert.Equal(t, err, nil)
+		response, err := client.Do(request)
+		assert.Equal(t, err, nil)
+		response.Body.Close()
+		return trace.Timing()
+	}
+
+	// the server URL is an IP address, so there is no DNS lookup
+	timing := get()
+	assert.NotEqual(t, timing, (*CheckTiming)(nil))
+	assert.Equal(t, timing.DNS, time.Duration(0))
+	assert.Equal(t, timing.Connect > 0, true)
+	assert.Equal(t, timing.TLS > 0, true)
+	assert.Equal(t, timing.FirstByte >= timing.Connect+timing.TLS, true)
+	assert.Equal(t, timing.Reused, false)
+
+	// the kept-alive connection is reused without connecting again
+	timing = get()
+	assert.Equal(t, timing.Reused, true)
+	assert.Equal(t, timing.Connect, time.Duration(0))
+	assert.Equal(t, timing.TLS, time.Duration(0))
+	assert.Equal(t, timing.FirstByte > 0, true)
+
+	// nothing is traced until a connection is requested
+	_, trace := withTimingTrace(context.Background())
+	assert.Equal(t, trace.Timing(), (*CheckTiming)(nil))
+}
+
+func TestEndpointStatusTiming(t *testing.T) {
+	state := NewEndpointState(1, 0)
+	at := time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+	state.Record(CheckResult{Status: StatusUp, Latency: 50 * time.Millisecond, Timing: &CheckTiming{DNS: 2 * time.Millisecond, Connect: 5 * time.Millisecond, TLS: 10 * time.Millisecond, FirstByte: 45 * time.Millisecond}}, at)
+
+	// checks without a breakdown, such as TCP checks, keep the last one
+	state.Record(CheckResult{Status: StatusUp, Latency: 5 * time.Millisecond}, at.Add(time.Minute))
+	assert.Equal(t, state.Status().Timing, &TimingStatus{DNSMs: 2, ConnectMs: 5, TLSMs: 10, FirstByteMs: 45})
+}
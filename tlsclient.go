@@ -0,0 +1,252 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HTTPS endpoints verify the certificate of their server against the host of their URL, or against
+// their tls_server_name, which is also sent as SNI, so servers can be checked by IP address before
+// their DNS records are cut over. Certificates valid for one of the names in tls_accept_names are
+// accepted too, with a warning every time, while the rest of the verification still applies, so
+// verification doesn't have to be disabled entirely for a known hostname mismatch.
+//
+// Internal endpoints with self-signed certificates either trust the certificate authority of
+// tls_ca_file, or skip the verification entirely with tls_insecure_skip_verify, which is logged as
+// a warning.
+//
+// Endpoints behind mutual TLS present the client certificate of tls_client_cert and
+// tls_client_key, and may trust the certificate authorities of tls_ca_file instead of the system
+// ones. Client certificates are read again when their files change, so rotated certificates are
+// picked up without a restart.
+
+// TLSOptions are the TLS options of the HTTP client of an HTTPS endpoint. AcceptNames is a comma
+// separated list, so the options can key the cache of the clients.
+type TLSOptions struct {
+	ServerName            string
+	AcceptNames           string
+	InsecureSkipVerify    bool
+	CAFile                string
+	ClientCert            string
+	ClientKey             string
+	ExpectContinueTimeout time.Duration
+}
+
+// tls_clients caches the HTTP clients with TLS options, so connections are reused across checks.
+var tls_clients = struct {
+	sync.Mutex
+	clients map[TLSOptions]*http.Client
+}{
+	clients: map[TLSOptions]*http.Client{},
+}
+
+// TLSClient returns an HTTP client verifying server certificates, and presenting a client
+// certificate, with the provided options. An error is returned if the CA file or the client
+// certificate can't be loaded.
+func TLSClient(options TLSOptions) (*http.Client, error) {
+	tls_clients.Lock()
+	defer tls_clients.Unlock()
+
+	if client, ok := tls_clients.clients[options]; ok {
+		return client, nil
+	}
+
+	config := &tls.Config{ServerName: options.ServerName, InsecureSkipVerify: options.InsecureSkipVerify}
+	if err := configureTLS(config, options.CAFile, options.ClientCert, options.ClientKey); err != nil {
+		return nil, err
+	}
+	acceptNames(config, options.AcceptNames)
+	if options.InsecureSkipVerify {
+		log.Printf("WARNING: server certificates aren't verified for endpoints with tls_insecure_skip_verify")
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = config
+	if options.ExpectContinueTimeout > 0 {
+		transport.ExpectContinueTimeout = options.ExpectContinueTimeout
+	}
+
+	client := &http.Client{Transport: transport}
+	tls_clients.clients[options] = client
+	return client, nil
+}
+
+// configureTLS makes config trust the certificate authorities of the PEM ca_file instead of the
+// system ones, and present the client certificate of cert_file and key_file, when they are set.
+func configureTLS(config *tls.Config, ca_file string, cert_file string, key_file string) error {
+	if ca_file != "" {
+		content, err := os.ReadFile(ca_file)
+		if err != nil {
+			return fmt.Errorf("failed to read tls_ca_file: %v", err)
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(content) {
+			return fmt.Errorf("tls_ca_file %s contains no PEM certificates", ca_file)
+		}
+	}
+	if cert_file != "" || key_file != "" {
+		certificate, err := newClientCertificate(cert_file, key_file)
+		if err != nil {
+			return err
+		}
+		config.GetClientCertificate = certificate.get
+	}
+	return nil
+}
+
+// clientCertificate is a client certificate and its key, read again from their files when they
+// change.
+type clientCertificate struct {
+	mu          sync.Mutex
+	cert_file   string
+	key_file    string
+	modified    time.Time
+	certificate *tls.Certificate
+}
+
+// newClientCertificate loads the client certificate of the PEM cert_file and key_file. An error is
+// returned if they can't be loaded.
+func newClientCertificate(cert_file string, key_file string) (*clientCertificate, error) {
+	certificate := &clientCertificate{cert_file: cert_file, key_file: key_file}
+	if err := certificate.load(); err != nil {
+		return nil, err
+	}
+	return certificate, nil
+}
+
+// load is a method for clientCertificate that reads the certificate and its key again when either
+// file was modified since they were last read.
+func (certificate *clientCertificate) load() error {
+	modified := time.Time{}
+	for _, file := range []string{certificate.cert_file, certificate.key_file} {
+		info, err := os.Stat(file)
+		if err != nil {
+			return fmt.Errorf("failed to read client certificate: %v", err)
+		}
+		if info.ModTime().After(modified) {
+			modified = info.ModTime()
+		}
+	}
+	if certificate.certificate != nil && modified.Equal(certificate.modified) {
+		return nil
+	}
+
+	loaded, err := tls.LoadX509KeyPair(certificate.cert_file, certificate.key_file)
+	if err != nil {
+		return fmt.Errorf("failed to load client certificate: %v", err)
+	}
+	certificate.certificate = &loaded
+	certificate.modified = modified
+	return nil
+}
+
+// get is a method for clientCertificate that returns the certificate presented to servers
+// requesting one, as tls.Config.GetClientCertificate. When the files can't be read again, the
+// previous certificate is presented and a warning is logged.
+func (certificate *clientCertificate) get(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	certificate.mu.Lock()
+	defer certificate.mu.Unlock()
+
+	if err := certificate.load(); err != nil {
+		log.Printf("WARNING: keeping the previous client certificate of %s: %v", certificate.cert_file, err)
+	}
+	return certificate.certificate, nil
+}
+
+// tlsOptions returns the TLS options of the endpoint.
+func (endpoint *Endpoint) tlsOptions() TLSOptions {
+	return TLSOptions{
+		ServerName:            endpoint.TLSServerName,
+		AcceptNames:           strings.Join(endpoint.TLSAcceptNames, ","),
+		InsecureSkipVerify:    endpoint.TLSInsecureSkipVerify,
+		CAFile:                endpoint.TLSCAFile,
+		ClientCert:            endpoint.TLSClientCert,
+		ClientKey:             endpoint.TLSClientKey,
+		ExpectContinueTimeout: endpoint.ExpectContinueTimeout,
+	}
+}
+
+// hasTLSOptions reports whether the endpoint overrides how its server certificate is verified,
+// skips its verification, or presents a client certificate.
+func (endpoint *Endpoint) hasTLSOptions() bool {
+	return endpoint.TLSServerName != "" || len(endpoint.TLSAcceptNames) > 0 || endpoint.TLSInsecureSkipVerify || endpoint.TLSCAFile != "" || endpoint.TLSClientCert != "" || endpoint.TLSClientKey != ""
+}
+
+// validateTLS rejects blank accepted names, client certificates without a key or the reverse, and
+// TLS options of HTTP endpoints that don't use TLS or use a client of their own. The CA file and
+// client certificate of HTTP endpoints are loaded, so invalid files are reported on startup.
+func (endpoint *Endpoint) validateTLS() error {
+	for _, name := range endpoint.TLSAcceptNames {
+		if strings.TrimSpace(name) == "" || strings.Contains(name, ",") {
+			return fmt.Errorf("invalid name %q in tls_accept_names", name)
+		}
+	}
+	if len(endpoint.TLSAcceptNames) > 0 && endpoint.TLSInsecureSkipVerify {
+		return errors.New("tls_accept_names can't be combined with tls_insecure_skip_verify, which disables the verification entirely")
+	}
+	if (endpoint.TLSClientCert == "") != (endpoint.TLSClientKey == "") {
+		return errors.New("tls_client_cert and tls_client_key must be set together")
+	}
+	if (endpoint.Type != "" && endpoint.Type != EndpointTypeHTTP) || !endpoint.hasTLSOptions() {
+		return nil
+	}
+
+	target, err := url.Parse(endpoint.Url)
+	if err != nil || target.Scheme != "https" {
+		return errors.New("tls_server_name, tls_accept_names, tls_insecure_skip_verify, tls_ca_file and tls_client_cert require an https:// url")
+	}
+	if endpoint.DualStack || endpoint.Netns != "" || endpoint.VRF != "" || endpoint.ProxyProtocol != "" {
+		return errors.New("tls_server_name, tls_accept_names, tls_insecure_skip_verify, tls_ca_file and tls_client_cert can't be combined with dual_stack, netns, vrf or proxy_protocol")
+	}
+	_, err = TLSClient(endpoint.tlsOptions())
+	return err
+}
+
+// acceptNames makes config accept server certificates valid for one of the comma separated
+// accept_names when they aren't valid for the name verified, the ServerName of the connection.
+// The certificate chain is still verified against config.RootCAs, the system roots when nil.
+// Every certificate accepted this way is logged as a warning.
+func acceptNames(config *tls.Config, accept_names string) {
+	if accept_names == "" {
+		return
+	}
+	names := strings.Split(accept_names, ",")
+	roots := config.RootCAs
+
+	// the verification is replaced, not skipped
+	config.InsecureSkipVerify = true
+	config.VerifyConnection = func(state tls.ConnectionState) error {
+		if len(state.PeerCertificates) == 0 {
+			return errors.New("tls: server sent no certificate")
+		}
+		leaf := state.PeerCertificates[0]
+		intermediates := x509.NewCertPool()
+		for _, certificate := range state.PeerCertificates[1:] {
+			intermediates.AddCert(certificate)
+		}
+		if _, err := leaf.Verify(x509.VerifyOptions{Roots: roots, Intermediates: intermediates}); err != nil {
+			return err
+		}
+
+		err := leaf.VerifyHostname(state.ServerName)
+		if err == nil {
+			return nil
+		}
+		for _, name := range names {
+			if leaf.VerifyHostname(name) == nil {
+				log.Printf("WARNING: accepted a certificate of %s that isn't valid for it, but for %s in tls_accept_names", state.ServerName, name)
+				return nil
+			}
+		}
+		return err
+	}
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-playground/assert/v2"
+)
+
+// selfSignedCertificate returns a certificate valid for example.com that isn't signed by the
+// certificate of httptest servers.
+func selfSignedCertificate(t *testing.T) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Equal(t, err, nil)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		DNSNames:     []string{"example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	certificate, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.Equal(t, err, nil)
+	return tls.Certificate{Certificate: [][]byte{certificate}, PrivateKey: key}
+}
+
+// writeClientCertificate writes a client certificate for name, signed by a new certificate
+// authority, and its key to PEM files in dir, and returns the pool of the authority.
+func writeClientCertificate(t *testing.T, dir string, name string) *x509.CertPool {
+	ca_key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Equal(t, err, nil)
+	ca_template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "checkhealth CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	ca_der, err := x509.CreateCertificate(rand.Reader, ca_template, ca_template, &ca_key.PublicKey, ca_key)
+	assert.Equal(t, err, nil)
+	ca, err := x509.ParseCertificate(ca_der)
+	assert.Equal(t, err, nil)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Equal(t, err, nil)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	certificate, err := x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, ca_key)
+	assert.Equal(t, err, nil)
+	key_der, err := x509.MarshalPKCS8PrivateKey(key)
+	assert.Equal(t, err, nil)
+
+	cert_pem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certificate})
+	key_pem := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: key_der})
+	assert.Equal(t, os.WriteFile(filepath.Join(dir, "client.pem"), cert_pem, 0o600), nil)
+	assert.Equal(t, os.WriteFile(filepath.Join(dir, "client-key.pem"), key_pem, 0o600), nil)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ca)
+	return pool
+}
+
+func TestAcceptNames(t *testing.T) {
+	// the certificate of httptest servers is valid for example.com and 127.0.0.1
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	other := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	other.TLS = &tls.Config{Certificates: []tls.Certificate{selfSignedCertificate(t)}}
+	other.StartTLS()
+	defer other.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(server.Certificate())
+
+	cases := []struct {
+		name         string
+		url          string
+		server_name  string
+		accept_names string
+		expectedFail bool
+	}{
+		{name: "Valid Name", url: server.URL, server_name: "example.com"},
+		{name: "Name Mismatch", url: server.URL, server_name: "fetch.com", expectedFail: true},
+		{name: "Accepted Name Mismatch", url: server.URL, server_name: "fetch.com", accept_names: "checkout.fetch.com,example.com"},
+		{name: "Valid Name With Accepted Names", url: server.URL, server_name: "example.com", accept_names: "fetch.com"},
+		{name: "Unaccepted Name Mismatch", url: server.URL, server_name: "fetch.com", accept_names: "checkout.fetch.com", expectedFail: true},
+		{name: "Untrusted Certificate", url: other.URL, server_name: "fetch.com", accept_names: "example.com", expectedFail: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			config := &tls.Config{RootCAs: roots, ServerName: tc.server_name}
+			acceptNames(config, tc.accept_names)
+			transport := &http.Transport{TLSClientConfig: config}
+			defer transport.CloseIdleConnections()
+
+			response, err := (&http.Client{Transport: transport}).Get(tc.url)
+			if tc.expectedFail {
+				assert.NotEqual(t, err, nil)
+				return
+			}
+			assert.Equal(t, err, nil)
+			response.Body.Close()
+		})
+	}
+}
+
+func TestValidateTLS(t *testing.T) {
+	dir := t.TempDir()
+	writeClientCertificate(t, dir, "checkhealth")
+	cert := filepath.Join(dir, "client.pem")
+	key := filepath.Join(dir, "client-key.pem")
+
+	cases := []struct {
+		name         string
+		endpoint     Endpoint
+		expectedFail bool
+	}{
+		{name: "No TLS Names", endpoint: Endpoint{Url: "http://fetch.com"}},
+		{name: "Server Name", endpoint: Endpoint{Url: "https://10.0.4.12", TLSServerName: "fetch.com"}},
+		{name: "Accepted Names", endpoint: Endpoint{Url: "https://fetch.com", TLSAcceptNames: []string{"lb.fetch.com"}}},
+		{name: "gRPC Endpoint", endpoint: Endpoint{Url: "10.0.4.12:443", Type: EndpointTypeGRPC, TLSAcceptNames: []string{"lb.fetch.com"}}},
+		{name: "Blank Name", endpoint: Endpoint{Url: "https://fetch.com", TLSAcceptNames: []string{" "}}, expectedFail: true},
+		{name: "Comma In Name", endpoint: Endpoint{Url: "https://fetch.com", TLSAcceptNames: []string{"a.com,b.com"}}, expectedFail: true},
+		{name: "Insecure Skip Verify", endpoint: Endpoint{Url: "https://fetch.com", TLSAcceptNames: []string{"lb.fetch.com"}, TLSInsecureSkipVerify: true}, expectedFail: true},
+		{name: "Plain HTTP", endpoint: Endpoint{Url: "http://fetch.com", TLSServerName: "fetch.com"}, expectedFail: true},
+		{name: "Proxy Protocol", endpoint: Endpoint{Url: "https://fetch.com", TLSServerName: "fetch.com", ProxyProtocol: "v1"}, expectedFail: true},
+		{name: "Client Certificate", endpoint: Endpoint{Url: "https://fetch.com", TLSClientCert: cert, TLSClientKey: key}},
+		{name: "gRPC Client Certificate", endpoint: Endpoint{Url: "10.0.4.12:443", Type: EndpointTypeGRPC, TLSClientCert: cert, TLSClientKey: key}},
+		{name: "Client Certificate Without Key", endpoint: Endpoint{Url: "https://fetch.com", TLSClientCert: cert}, expectedFail: true},
+		{name: "Missing Client Certificate", endpoint: Endpoint{Url: "https://fetch.com", TLSClientCert: filepath.Join(dir, "missing.pem"), TLSClientKey: key}, expectedFail: true},
+		{name: "Mismatched Client Key", endpoint: Endpoint{Url: "https://fetch.com", TLSClientCert: key, TLSClientKey: cert}, expectedFail: true},
+		{name: "Missing CA File", endpoint: Endpoint{Url: "https://fetch.com", TLSCAFile: filepath.Join(dir, "missing.pem")}, expectedFail: true},
+		{name: "CA File Without Certificates", endpoint: Endpoint{Url: "https://fetch.com", TLSCAFile: key}, expectedFail: true},
+		{name: "HTTPS Insecure Skip Verify", endpoint: Endpoint{Url: "https://10.0.9.20", TLSInsecureSkipVerify: true}},
+		{name: "Plain HTTP Insecure Skip Verify", endpoint: Endpoint{Url: "http://10.0.9.20", TLSInsecureSkipVerify: true}, expectedFail: true},
+		{name: "Plain HTTP Client Certificate", endpoint: Endpoint{Url: "http://fetch.com", TLSClientCert: cert, TLSClientKey: key}, expectedFail: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.endpoint.validateTLS()
+			if tc.expectedFail {
+				assert.NotEqual(t, err, nil)
+			} else {
+				assert.Equal(t, err, nil)
+			}
+		})
+	}
+}
+
+func TestTLSClient(t *testing.T) {
+	endpoint := Endpoint{Url: "https://10.0.4.12", TLSServerName: "fetch.com", TLSAcceptNames: []string{"lb.fetch.com"}}
+	client := endpointClient(t, &endpoint)
+	assert.Equal(t, client == endpointClient(t, &endpoint), true)
+
+	config := client.Transport.(*http.Transport).TLSClientConfig
+	assert.Equal(t, config.ServerName, "fetch.com")
+	assert.NotEqual(t, config.VerifyConnection, nil)
+}
+
+func TestSelfSignedCertificate(t *testing.T) {
+	certificate := selfSignedCertificate(t)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.TLS = &tls.Config{Certificates: []tls.Certificate{certificate}}
+	server.StartTLS()
+	defer server.Close()
+
+	ca_file := filepath.Join(t.TempDir(), "ca.pem")
+	assert.Equal(t, os.WriteFile(ca_file, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certificate.Certificate[0]}), 0o600), nil)
+
+	cases := []struct {
+		name         string
+		endpoint     Endpoint
+		expectedFail bool
+	}{
+		{name: "Untrusted", endpoint: Endpoint{Url: server.URL, TLSServerName: "example.com"}, expectedFail: true},
+		{name: "Trusted CA File", endpoint: Endpoint{Url: server.URL, TLSServerName: "example.com", TLSCAFile: ca_file}},
+		{name: "Insecure Skip Verify", endpoint: Endpoint{Url: server.URL, TLSInsecureSkipVerify: true}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.endpoint.validateTLS(), nil)
+			response, err := endpointClient(t, &tc.endpoint).Get(server.URL)
+			if tc.expectedFail {
+				assert.NotEqual(t, err, nil)
+				assert.Equal(t, ErrorKind(err), ErrorKindTLS)
+				return
+			}
+			assert.Equal(t, err, nil)
+			response.Body.Close()
+		})
+	}
+}
+
+func TestClientCertificate(t *testing.T) {
+	dir := t.TempDir()
+	client_cas := writeClientCertificate(t, dir, "checkhealth")
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: client_cas}
+	server.StartTLS()
+	defer server.Close()
+
+	// the server requires a client certificate
+	server_ca := filepath.Join(dir, "server-ca.pem")
+	assert.Equal(t, os.WriteFile(server_ca, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0o600), nil)
+	client, err := TLSClient(TLSOptions{ServerName: "example.com", CAFile: server_ca})
+	assert.Equal(t, err, nil)
+	_, err = client.Get(server.URL)
+	assert.NotEqual(t, err, nil)
+
+	endpoint := Endpoint{
+		Url:           server.URL,
+		TLSServerName: "example.com",
+		TLSCAFile:     server_ca,
+		TLSClientCert: filepath.Join(dir, "client.pem"),
+		TLSClientKey:  filepath.Join(dir, "client-key.pem"),
+	}
+	assert.Equal(t, endpoint.validateTLS(), nil)
+	assert.Equal(t, checkName(t, endpointClient(t, &endpoint), server.URL), "checkhealth")
+
+	// rotated certificates are presented to new connections
+	server.TLS.ClientCAs = writeClientCertificate(t, dir, "rotated")
+	later := time.Now().Add(time.Minute)
+	assert.Equal(t, os.Chtimes(endpoint.TLSClientCert, later, later), nil)
+	endpointClient(t, &endpoint).Transport.(*http.Transport).CloseIdleConnections()
+	assert.Equal(t, checkName(t, endpointClient(t, &endpoint), server.URL), "rotated")
+
+	// the previous certificate is kept when the files can't be read
+	assert.Equal(t, os.Remove(endpoint.TLSClientKey), nil)
+	endpointClient(t, &endpoint).Transport.(*http.Transport).CloseIdleConnections()
+	assert.Equal(t, checkName(t, endpointClient(t, &endpoint), server.URL), "rotated")
+}
+
+// endpointClient returns the HTTP client of the endpoint, failing the test when it can't be created.
+func endpointClient(t *testing.T, endpoint *Endpoint) *http.Client {
+	t.Helper()
+	client, err := endpoint.client()
+	assert.Equal(t, err, nil)
+	return client
+}
+
+// checkName returns the common name of the client certificate the server received.
+func checkName(t *testing.T, client *http.Client, url string) string {
+	t.Helper()
+	response, err := client.Get(url)
+	assert.Equal(t, err, nil)
+	defer response.Body.Close()
+	body, err := io.ReadAll(response.Body)
+	assert.Equal(t, err, nil)
+	return string(body)
+}
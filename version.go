@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"strings"
+)
+
+// VersionUsage provides help text for the version subcommand.
+const VersionUsage string = `
+USAGE: checkhealth version [-json]
+
+	Prints the version, commit, build date, Go version and the features compiled into the
+	binary.
+
+FLAGS:
+
+	-json
+		Prints the build information as a JSON object for use by automation.
+`
+
+// Version, Commit and BuildDate describe the build of the binary. They are expected to be set at
+// build time through the linker, for example:
+//
+//	go build -ldflags "-X main.Version=v1.0.0 -X main.Commit=$(git rev-parse HEAD)"
+var (
+	Version   string = "dev"
+	Commit    string = "unknown"
+	BuildDate string = "unknown"
+)
+
+// BuildInfo is the machine-readable description of the binary printed by the version subcommand.
+type BuildInfo struct {
+	Version   string   `json:"version"`
+	Commit    string   `json:"commit"`
+	BuildDate string   `json:"build_date"`
+	GoVersion string   `json:"go_version"`
+	Platform  string   `json:"platform"`
+	Features  Features `json:"features"`
+}
+
+// GetBuildInfo returns the BuildInfo for the running binary. When the version wasn't set through
+// the linker, the module version recorded by "go install module@version" is used if available.
+func GetBuildInfo() BuildInfo {
+	version := Version
+	if version == "dev" {
+		if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" && info.Main.Version != "(devel)" {
+			version = info.Main.Version
+		}
+	}
+
+	return BuildInfo{
+		Version:   version,
+		Commit:    Commit,
+		BuildDate: BuildDate,
+		GoVersion: runtime.Version(),
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+		Features:  EnabledFeatures(),
+	}
+}
+
+// WriteText writes the build information in a human readable format.
+func (info BuildInfo) WriteText(w io.Writer) error {
+	_, err := fmt.Fprintf(w,
+		"checkhealth %s\n  commit:      %s\n  build date:  %s\n  go version:  %s\n  platform:    %s\n  check types: %s\n  sinks:       %s\n  notifiers:   %s\n  commands:    %s\n  formats:     %s\n  exports:     %s\n",
+		info.Version,
+		info.Commit,
+		info.BuildDate,
+		info.GoVersion,
+		info.Platform,
+		strings.Join(info.Features.CheckTypes, ", "),
+		strings.Join(info.Features.Sinks, ", "),
+		strings.Join(info.Features.Notifiers, ", "),
+		strings.Join(info.Features.Commands, ", "),
+		strings.Join(info.Features.ConfigFormats, ", "),
+		strings.Join(info.Features.Exports, ", "),
+	)
+	return err
+}
+
+// WriteJSON writes the build information as an indented JSON object.
+func (info BuildInfo) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(info)
+}
+
+// RunVersion is the entry point for the version subcommand. It parses the version flags from args
+// and writes the build information to w.
+func RunVersion(args []string, w io.Writer) error {
+	flags := flag.NewFlagSet("version", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	as_json := flags.Bool("json", false, "")
+
+	if err := flags.Parse(args); err != nil {
+		return fmt.Errorf("failed to parse version arguments: %v\n%s", err, VersionUsage)
+	}
+	if flags.NArg() != 0 {
+		return fmt.Errorf("version does not accept positional arguments.\n%s", VersionUsage)
+	}
+
+	if *as_json {
+		return GetBuildInfo().WriteJSON(w)
+	}
+	return GetBuildInfo().WriteText(w)
+}
+
+func init() {
+	RegisterCommand(Command{
+		Name: "version",
+		Run: func(args []string) error {
+			return RunVersion(args, os.Stdout)
+		},
+	})
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/go-playground/assert/v2"
+)
+
+func TestRunVersion(t *testing.T) {
+	cases := []struct {
+		name         string
+		args         []string
+		expectedFail bool
+	}{
+		{
+			name: "Text Output",
+			args: []string{},
+		},
+		{
+			name: "JSON Output",
+			args: []string{"-json"},
+		},
+		{
+			name: "JSON Output With Double Dash",
+			args: []string{"--json"},
+		},
+		{
+			name:         "Unknown Flag",
+			args:         []string{"-foo"},
+			expectedFail: true,
+		},
+		{
+			name:         "Positional Argument",
+			args:         []string{"foo"},
+			expectedFail: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var output bytes.Buffer
+
+			err := RunVersion(tc.args, &output)
+			if tc.expectedFail {
+				assert.NotEqual(t, err, nil)
+				return
+			}
+
+			assert.Equal(t, err, nil)
+			assert.Equal(t, strings.Contains(output.String(), runtime.Version()), true)
+		})
+	}
+}
+
+func TestBuildInfoJSON(t *testing.T) {
+	var output bytes.Buffer
+
+	err := RunVersion([]string{"-json"}, &output)
+	assert.Equal(t, err, nil)
+
+	var info BuildInfo
+	err = json.Unmarshal(output.Bytes(), &info)
+	assert.Equal(t, err, nil)
+
+	assert.Equal(t, info, GetBuildInfo())
+	assert.Equal(t, info.Platform, runtime.GOOS+"/"+runtime.GOARCH)
+	assert.Equal(t, hasFeature(info.Features.CheckTypes, "http"), true)
+}